@@ -0,0 +1,260 @@
+// Command loadgen drives concurrent run_sse turns against an adk2goose proxy
+// and reports latency percentiles and stream error rates.
+//
+// With -mock it starts an in-process proxy backed by a mock Goose server, so
+// the proxy's own overhead can be measured without a real model behind it.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/innomon/adk2goose/gooseclient"
+	"github.com/innomon/adk2goose/internal/config"
+	"github.com/innomon/adk2goose/internal/proxy"
+)
+
+func main() {
+	target := flag.String("target", "http://127.0.0.1:8080", "proxy base URL")
+	mock := flag.Bool("mock", false, "start an in-process proxy backed by a mock Goose server instead of using -target")
+	mockDelay := flag.Duration("mock-delay", 20*time.Millisecond, "delay between mock Goose stream chunks")
+	sessions := flag.Int("sessions", 10, "number of sessions to create")
+	turns := flag.Int("turns", 5, "run_sse turns per session")
+	concurrency := flag.Int("concurrency", 0, "sessions driven at once (default: all)")
+	app := flag.String("app", "loadgen", "ADK app name")
+	user := flag.String("user", "loadgen", "ADK user ID")
+	timeout := flag.Duration("timeout", 2*time.Minute, "per-turn timeout")
+	flag.Parse()
+
+	if *concurrency <= 0 || *concurrency > *sessions {
+		*concurrency = *sessions
+	}
+
+	baseURL := strings.TrimRight(*target, "/")
+	if *mock {
+		gooseSrv := httptest.NewServer(newMockGoose(*mockDelay))
+		defer gooseSrv.Close()
+
+		cfg := &config.Config{WorkingDir: os.TempDir()}
+		client := gooseclient.New(gooseSrv.URL, "", gooseclient.WithTransport(gooseclient.TransportConfig{MaxIdleConnsPerHost: *concurrency}))
+		proxySrv := httptest.NewServer(proxy.NewHandler(proxy.NewSessionManager(client, cfg.WorkingDir), client, cfg))
+		defer proxySrv.Close()
+		baseURL = proxySrv.URL
+	}
+
+	lg := &loadGen{
+		baseURL: baseURL,
+		app:     *app,
+		user:    *user,
+		timeout: *timeout,
+		http: &http.Client{Transport: &http.Transport{
+			MaxIdleConnsPerHost: *concurrency,
+		}},
+	}
+
+	log.Printf("driving %d sessions x %d turns (concurrency %d) against %s", *sessions, *turns, *concurrency, baseURL)
+	start := time.Now()
+
+	results := make(chan turnResult)
+	sem := make(chan struct{}, *concurrency)
+	var wg sync.WaitGroup
+	for i := 0; i < *sessions; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			lg.runSession(i, *turns, results)
+		}(i)
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	var all []turnResult
+	for r := range results {
+		all = append(all, r)
+	}
+	report(all, time.Since(start))
+}
+
+// turnResult records the outcome of one run_sse turn.
+type turnResult struct {
+	firstEvent time.Duration
+	total      time.Duration
+	events     int
+	err        error
+}
+
+type loadGen struct {
+	baseURL string
+	app     string
+	user    string
+	timeout time.Duration
+	http    *http.Client
+}
+
+// runSession creates a session and runs turns on it sequentially.
+func (lg *loadGen) runSession(n, turns int, results chan<- turnResult) {
+	sessionID, err := lg.createSession()
+	if err != nil {
+		for i := 0; i < turns; i++ {
+			results <- turnResult{err: fmt.Errorf("create session: %w", err)}
+		}
+		return
+	}
+	for i := 0; i < turns; i++ {
+		results <- lg.runTurn(sessionID, fmt.Sprintf("Session %d turn %d: %s", n, i+1, prompts[(n+i)%len(prompts)]))
+	}
+}
+
+var prompts = []string{
+	"Summarize the README in one sentence.",
+	"List the Go files in this directory.",
+	"What does the proxy do with tool confirmations?",
+	"Write a haiku about server-sent events.",
+}
+
+func (lg *loadGen) createSession() (string, error) {
+	resp, err := lg.http.Post(fmt.Sprintf("%s/apps/%s/users/%s/sessions", lg.baseURL, lg.app, lg.user), "application/json", strings.NewReader("{}"))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("status %d", resp.StatusCode)
+	}
+	var sess struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&sess); err != nil {
+		return "", err
+	}
+	return sess.ID, nil
+}
+
+func (lg *loadGen) runTurn(sessionID, prompt string) turnResult {
+	ctx, cancel := context.WithTimeout(context.Background(), lg.timeout)
+	defer cancel()
+
+	body, _ := json.Marshal(map[string]any{
+		"new_message": map[string]any{
+			"role":  "user",
+			"parts": []map[string]any{{"text": prompt}},
+		},
+	})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+		fmt.Sprintf("%s/apps/%s/users/%s/sessions/%s/run_sse", lg.baseURL, lg.app, lg.user, sessionID),
+		bytes.NewReader(body))
+	if err != nil {
+		return turnResult{err: err}
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	start := time.Now()
+	resp, err := lg.http.Do(req)
+	if err != nil {
+		return turnResult{err: err}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return turnResult{err: fmt.Errorf("status %d", resp.StatusCode), total: time.Since(start)}
+	}
+
+	var r turnResult
+	complete := false
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		payload, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		if r.events == 0 {
+			r.firstEvent = time.Since(start)
+		}
+		r.events++
+
+		var evt struct {
+			TurnComplete bool   `json:"turnComplete"`
+			ErrorCode    string `json:"errorCode"`
+			ErrorMessage string `json:"errorMessage"`
+		}
+		if err := json.Unmarshal([]byte(payload), &evt); err != nil {
+			r.err = fmt.Errorf("decode event: %w", err)
+			break
+		}
+		if evt.ErrorCode != "" {
+			r.err = fmt.Errorf("%s: %s", evt.ErrorCode, evt.ErrorMessage)
+		}
+		complete = complete || evt.TurnComplete
+	}
+	r.total = time.Since(start)
+	if r.err == nil {
+		r.err = scanner.Err()
+	}
+	if r.err == nil && !complete {
+		r.err = errors.New("stream ended without turnComplete")
+	}
+	return r
+}
+
+// report prints throughput, error rates, and latency percentiles.
+func report(results []turnResult, elapsed time.Duration) {
+	var firstEvent, total []time.Duration
+	errCounts := make(map[string]int)
+	failed := 0
+	for _, r := range results {
+		if r.err != nil {
+			failed++
+			errCounts[r.err.Error()]++
+			continue
+		}
+		firstEvent = append(firstEvent, r.firstEvent)
+		total = append(total, r.total)
+	}
+
+	fmt.Printf("\nturns:      %d in %s (%.1f turns/s)\n", len(results), elapsed.Round(time.Millisecond), float64(len(results))/elapsed.Seconds())
+	if len(results) > 0 {
+		fmt.Printf("errors:     %d (%.2f%%)\n", failed, 100*float64(failed)/float64(len(results)))
+	}
+	printPercentiles("first event", firstEvent)
+	printPercentiles("turn total", total)
+
+	if len(errCounts) > 0 {
+		fmt.Println("\nerrors by cause:")
+		causes := make([]string, 0, len(errCounts))
+		for cause := range errCounts {
+			causes = append(causes, cause)
+		}
+		sort.Slice(causes, func(i, j int) bool { return errCounts[causes[i]] > errCounts[causes[j]] })
+		for _, cause := range causes {
+			fmt.Printf("  %6d  %s\n", errCounts[cause], cause)
+		}
+	}
+}
+
+func printPercentiles(name string, d []time.Duration) {
+	if len(d) == 0 {
+		return
+	}
+	sort.Slice(d, func(i, j int) bool { return d[i] < d[j] })
+	pct := func(p float64) time.Duration {
+		return d[int(p*float64(len(d)-1))].Round(time.Microsecond)
+	}
+	fmt.Printf("%-11s p50=%s p90=%s p99=%s max=%s\n", name+":", pct(0.5), pct(0.9), pct(0.99), d[len(d)-1].Round(time.Microsecond))
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// newMockGoose returns a minimal Goose server that streams a canned reply in
+// several chunks separated by delay.
+func newMockGoose(delay time.Duration) http.Handler {
+	var sessions atomic.Int64
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("POST /agent/start", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{
+			"id":          fmt.Sprintf("mock-%d", sessions.Add(1)),
+			"working_dir": "/tmp",
+		})
+	})
+	mux.HandleFunc("POST /agent/stop", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, "{}")
+	})
+
+	chunks := strings.Fields("This is a synthetic response streamed by the mock Goose server.")
+	mux.HandleFunc("POST /reply", func(w http.ResponseWriter, r *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "streaming not supported", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+
+		msgID := fmt.Sprintf("msg-%d", time.Now().UnixNano())
+		for _, chunk := range chunks {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-time.After(delay):
+			}
+			data, _ := json.Marshal(map[string]any{
+				"type": "Message",
+				"message": map[string]any{
+					"id":      msgID,
+					"role":    "assistant",
+					"created": time.Now().Unix(),
+					"content": []map[string]any{{"type": "text", "text": chunk + " "}},
+				},
+			})
+			fmt.Fprintf(w, "data: %s\n\n", data)
+			flusher.Flush()
+		}
+		fmt.Fprint(w, `data: {"type":"Finish","reason":"stop","token_state":{"input_tokens":12,"output_tokens":11,"total_tokens":23}}`+"\n\n")
+		flusher.Flush()
+	})
+
+	return mux
+}
@@ -2,27 +2,120 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"flag"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strings"
 	"syscall"
 	"time"
 
+	"github.com/innomon/adk2goose/gooseclient"
+	"github.com/innomon/adk2goose/internal/buildinfo"
 	"github.com/innomon/adk2goose/internal/config"
-	"github.com/innomon/adk2goose/internal/gooseclient"
+	"github.com/innomon/adk2goose/internal/eventsink"
 	"github.com/innomon/adk2goose/internal/proxy"
+	"github.com/innomon/adk2goose/internal/secrets"
+	"github.com/innomon/adk2goose/internal/sentry"
+	"github.com/innomon/adk2goose/internal/supervisor"
 )
 
 func main() {
-	cfg, err := config.Load()
+	profile := flag.String("profile", "", "profile of CONFIG_FILE to run as, such as dev or prod (default $CONFIG_PROFILE)")
+	flag.Parse()
+
+	cfg, err := config.LoadProfile(*profile)
 	if err != nil {
 		log.Fatalf("failed to load config: %v", err)
 	}
+	if cfg.Profile != "" {
+		log.Printf("using config profile %s", cfg.Profile)
+	}
+	for _, name := range cfg.Features.Changed() {
+		log.Printf("feature %s enabled: %t", name, cfg.Features.Enabled(name))
+	}
+
+	// Secrets given as secret manager references are read before anything
+	// uses them.
+	resolver := secrets.FromEnv()
+	loadCtx, cancelLoad := context.WithTimeout(context.Background(), 30*time.Second)
+	gooseSecret, err := resolver.Load(loadCtx, cfg.GooseSecret)
+	if err != nil {
+		log.Fatalf("failed to load goose secret key: %v", err)
+	}
+	cfg.GooseSecret = gooseSecret.Value()
+	var cert *secrets.Certificate
+	var refreshed []*secrets.Secret
+	if cfg.TLSCert != "" {
+		certPEM, err := resolver.Load(loadCtx, cfg.TLSCert)
+		if err != nil {
+			log.Fatalf("failed to load tls certificate: %v", err)
+		}
+		keyPEM, err := resolver.Load(loadCtx, cfg.TLSKey)
+		if err != nil {
+			log.Fatalf("failed to load tls key: %v", err)
+		}
+		if cert, err = secrets.NewCertificate(certPEM, keyPEM); err != nil {
+			log.Fatalf("failed to load tls certificate: %v", err)
+		}
+		refreshed = append(refreshed, certPEM, keyPEM)
+	}
+	cancelLoad()
 
-	gooseClient := gooseclient.New(cfg.GooseBaseURL, cfg.GooseSecret)
-	sessionMgr := proxy.NewSessionManager(gooseClient, cfg.WorkingDir)
-	handler := proxy.NewHandler(sessionMgr, gooseClient)
+	bgCtx, stopBackground := context.WithCancel(context.Background())
+	clientOpts := []gooseclient.Option{gooseclient.WithTransport(cfg.GooseTransport)}
+	if cfg.Goosed.Binary != "" {
+		backends := startGoosed(bgCtx, cfg)
+		if len(backends) > 1 || cfg.Goosed.WorkerSessions > 0 {
+			clientOpts = append(clientOpts, gooseclient.WithPool(gooseclient.NewPool(backends...)))
+		}
+	}
+
+	if cfg.GooseStandbyURL != "" {
+		clientOpts = append(clientOpts, gooseclient.WithStandby(cfg.GooseStandbyURL))
+	}
+	gooseClient := gooseclient.New(cfg.GooseBaseURL, cfg.GooseSecret, clientOpts...)
+	// Supervised goosed workers keep the key they were started with.
+	if cfg.Goosed.Binary == "" {
+		gooseSecret.OnChange(gooseClient.SetSecretKey)
+		refreshed = append(refreshed, gooseSecret)
+	}
+	var goose gooseclient.API = gooseClient
+	if cfg.GooseCLI.Binary != "" {
+		goose = startCLI(cfg)
+	} else {
+		negotiateGoose(gooseClient)
+	}
+	requireApproveMode(cfg, goose)
+	sessionMgr := proxy.NewSessionManager(goose, cfg.WorkingDir)
+	if cfg.EventStoreDir != "" {
+		sessionMgr.UseEventStore(proxy.NewFileEventStore(cfg.EventStoreDir))
+	}
+	handler := proxy.NewHandler(sessionMgr, goose, cfg)
+	if cfg.AdminListenAddr == "" && !cfg.AdminCredentials() {
+		log.Printf("admin routes not served: set ADMIN_TOKEN, an admin key in API_KEYS_FILE, or ADMIN_LISTEN_ADDR")
+	}
+	if cfg.EventSinkURL != "" {
+		sink, err := eventsink.Open(cfg.EventSinkURL, cfg.EventSinkTopic)
+		if err != nil {
+			log.Fatalf("failed to open event sink: %v", err)
+		}
+		defer sink.Close()
+		handler.UseEventSink(sink)
+	}
+	if cfg.SentryDSN != "" {
+		reporter, err := sentry.New(cfg.SentryDSN, cfg.SentryEnvironment)
+		if err != nil {
+			log.Fatalf("failed to configure error reporting: %v", err)
+		}
+		handler.UseErrorReporter(reporter)
+	}
 
 	srv := &http.Server{
 		Addr:         cfg.ListenAddr,
@@ -31,19 +124,171 @@ func main() {
 		WriteTimeout: cfg.RequestTimeout + 10*time.Second, // extra buffer for streaming
 	}
 
+	servers := []*http.Server{srv}
+	if cfg.AdminListenAddr != "" {
+		adminSrv := &http.Server{
+			Addr:        cfg.AdminListenAddr,
+			Handler:     handler.AdminHandler(),
+			ReadTimeout: 30 * time.Second,
+		}
+		servers = append(servers, adminSrv)
+		go func() {
+			log.Printf("admin listening on %s", cfg.AdminListenAddr)
+			if err := listen(adminSrv, cert); err != http.ErrServerClosed {
+				log.Fatalf("admin server error: %v", err)
+			}
+		}()
+	}
+
+	go handler.RunSchedules(bgCtx)
+	go handler.RunJanitor(bgCtx)
+	go handler.RunHealthChecks(bgCtx)
+	go handler.RunOrphanGC(bgCtx)
+	go handler.RunAPIKeyReload(bgCtx)
+	go secrets.Refresh(bgCtx, cfg.SecretsRefreshInterval, refreshed...)
+
 	// Graceful shutdown on SIGINT/SIGTERM
+	shutdownDone := make(chan struct{})
 	go func() {
+		defer close(shutdownDone)
 		sigCh := make(chan os.Signal, 1)
 		signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
 		<-sigCh
 		log.Println("shutting down...")
+		stopBackground()
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 		defer cancel()
-		srv.Shutdown(ctx)
+		for _, s := range servers {
+			s.Shutdown(ctx)
+		}
+		// Goose replies still streaming once the servers stop waiting are
+		// cut, so no reader goroutine outlives the proxy.
+		closeCtx, cancelClose := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancelClose()
+		if err := goose.CloseStreams(closeCtx); err != nil {
+			log.Printf("close goose reply streams: %v (%d left)", err, len(goose.Streams()))
+		}
 	}()
 
-	log.Printf("adk2goose proxy listening on %s → %s", cfg.ListenAddr, cfg.GooseBaseURL)
-	if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+	build := buildinfo.Get()
+	log.Printf("adk2goose proxy %s (%s) listening on %s → %s", build.Version, build.Commit, cfg.ListenAddr, goose.Active())
+	if err := listen(srv, cert); err != http.ErrServerClosed {
 		log.Fatalf("server error: %v", err)
 	}
+	<-shutdownDone
+}
+
+// negotiateGoose probes the Goose servers' releases, exiting if one is too
+// old for the proxy. Servers that cannot be reached yet are probed again
+// when requests fail over to them or GET /version asks.
+func negotiateGoose(client *gooseclient.Client) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	err := client.Negotiate(ctx)
+	if errors.Is(err, gooseclient.ErrUnsupportedVersion) {
+		log.Fatalf("%v; upgrade Goose to %s or later", err, gooseclient.MinVersion)
+	}
+	if err != nil {
+		log.Printf("goose version not probed: %v", err)
+	}
+	v := client.ServerVersion()
+	if v == nil {
+		return
+	}
+	switch {
+	case v.Version == "":
+		log.Printf("goose at %s does not report its version; adapting to %s", v.URL, strings.Join(v.Legacy, ", "))
+	case len(v.Legacy) > 0:
+		log.Printf("goose %s at %s; adapting to %s", v.Version, v.URL, strings.Join(v.Legacy, ", "))
+	default:
+		log.Printf("goose %s at %s", v.Version, v.URL)
+	}
+}
+
+// startCLI returns the goose command line backend, exiting if it does not
+// run.
+func startCLI(cfg *config.Config) gooseclient.API {
+	dir := cfg.GooseCLI.SessionsDir
+	if dir == "" {
+		dir = filepath.Join(cfg.WorkingDir, ".adk2goose", "goose-sessions")
+	}
+	cli := gooseclient.NewCLI(cfg.GooseCLI.Binary, dir, cfg.GooseCLI.Args, cfg.Goosed.Env)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	v, err := cli.ProbeVersion(ctx)
+	if err != nil {
+		log.Fatalf("failed to run goose CLI: %v", err)
+	}
+	log.Printf("running turns through goose %s (%s), sessions in %s", v.Version, cfg.GooseCLI.Binary, dir)
+	return cli
+}
+
+// requireApproveMode exits unless Goose runs in approve mode when some app's
+// tool calls are policed: in any other mode Goose runs tools without waiting
+// for the proxy to deny them.
+func requireApproveMode(cfg *config.Config, goose gooseclient.API) {
+	apps := cfg.PolicedApps()
+	if len(apps) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	mode, err := goose.ReadConfig(ctx, "GOOSE_MODE", false)
+	if err != nil {
+		log.Fatalf("apps %s police tool calls, which needs GOOSE_MODE=approve, but it could not be checked: %v", strings.Join(apps, ", "), err)
+	}
+	if mode != "approve" {
+		log.Fatalf("apps %s police tool calls, which needs GOOSE_MODE=approve; Goose has GOOSE_MODE=%v", strings.Join(apps, ", "), mode)
+	}
+}
+
+// listen serves srv, over TLS with cert if it is not nil.
+func listen(srv *http.Server, cert *secrets.Certificate) error {
+	if cert == nil {
+		return srv.ListenAndServe()
+	}
+	srv.TLSConfig = &tls.Config{GetCertificate: cert.GetCertificate}
+	return srv.ListenAndServeTLS("", "")
+}
+
+// startGoosed launches the configured goosed workers under supervision,
+// points the proxy at the first, and waits for them to be ready. It returns
+// the workers as pool backends. Supervised workers without a configured
+// secret get a random one.
+func startGoosed(ctx context.Context, cfg *config.Config) []gooseclient.Backend {
+	if cfg.GooseSecret == "" {
+		key := make([]byte, 32)
+		rand.Read(key)
+		cfg.GooseSecret = hex.EncodeToString(key)
+	}
+
+	var backends []gooseclient.Backend
+	var sups []*supervisor.Supervisor
+	for i := range cfg.Goosed.Workers {
+		sup := supervisor.New(supervisor.Config{
+			Binary:       cfg.Goosed.Binary,
+			Args:         cfg.Goosed.Args,
+			Env:          cfg.Goosed.Env,
+			Port:         cfg.Goosed.Port + i,
+			SecretKey:    cfg.GooseSecret,
+			ReadyTimeout: cfg.Goosed.ReadyTimeout,
+		})
+		go func() {
+			if err := sup.Run(ctx); err != nil {
+				log.Fatalf("failed to run goosed: %v", err)
+			}
+		}()
+		backends = append(backends, gooseclient.Backend{
+			URL:      sup.BaseURL(),
+			Capacity: cfg.Goosed.WorkerSessions,
+			Ready:    sup.Ready,
+		})
+		sups = append(sups, sup)
+	}
+	for _, sup := range sups {
+		log.Printf("waiting for goosed on %s", sup.BaseURL())
+		sup.WaitReady(ctx)
+	}
+	cfg.GooseBaseURL = backends[0].URL
+	return backends
 }
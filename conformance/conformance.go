@@ -0,0 +1,377 @@
+// Package conformance checks that an HTTP handler behaves like the ADK REST
+// API: the status codes, session JSON shape, SSE framing, and event fields
+// ADK clients rely on. Forks and embedders of the proxy run it against
+// their own handler to verify they have not broken compatibility:
+//
+//	func TestConformance(t *testing.T) {
+//		conformance.Run(t, myHandler, conformance.Options{})
+//	}
+//
+// The handler must be backed by an agent that answers prompts; the checks
+// only assume that a turn produces at least one event with content.
+package conformance
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// Options configures the checks.
+type Options struct {
+	// App and User scope the sessions the checks create; they default to
+	// "conformance" and "conformance-user".
+	App, User string
+	// Prompt is the text sent on each turn; it defaults to "Hello".
+	Prompt string
+}
+
+func (o *Options) defaults() {
+	if o.App == "" {
+		o.App = "conformance"
+	}
+	if o.User == "" {
+		o.User = "conformance-user"
+	}
+	if o.Prompt == "" {
+		o.Prompt = "Hello"
+	}
+}
+
+// Run serves h on a test server and runs every check against it as a
+// subtest of t.
+func Run(t *testing.T, h http.Handler, opts Options) {
+	opts.defaults()
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+	c := &client{t: t, base: srv.URL, opts: opts}
+
+	checks := []struct {
+		name string
+		run  func(c *client)
+	}{
+		{"CreateSession", checkCreateSession},
+		{"CreateSessionWithID", checkCreateSessionWithID},
+		{"GetSession", checkGetSession},
+		{"GetUnknownSession", checkGetUnknownSession},
+		{"ListSessions", checkListSessions},
+		{"OtherUsersSessions", checkOtherUsersSessions},
+		{"RunSSE", checkRunSSE},
+		{"RunSSEHistory", checkRunSSEHistory},
+		{"RunSSEMissingMessage", checkRunSSEMissingMessage},
+		{"RunSSEMalformedBody", checkRunSSEMalformedBody},
+		{"DeleteSession", checkDeleteSession},
+	}
+	for _, check := range checks {
+		t.Run(check.name, func(t *testing.T) {
+			check.run(&client{t: t, base: c.base, opts: c.opts})
+		})
+	}
+}
+
+// client issues API requests for one check, failing it on transport
+// errors.
+type client struct {
+	t    *testing.T
+	base string
+	opts Options
+}
+
+func (c *client) sessionsURL(user string) string {
+	return fmt.Sprintf("%s/apps/%s/users/%s/sessions", c.base, c.opts.App, user)
+}
+
+func (c *client) sessionURL(id string) string {
+	return c.sessionsURL(c.opts.User) + "/" + id
+}
+
+// do sends a request and returns the response with its body read.
+func (c *client) do(method, url, body string) (*http.Response, []byte) {
+	c.t.Helper()
+	var r io.Reader
+	if body != "" {
+		r = strings.NewReader(body)
+	}
+	req, err := http.NewRequest(method, url, r)
+	if err != nil {
+		c.t.Fatalf("%s %s: %v", method, url, err)
+	}
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		c.t.Fatalf("%s %s: %v", method, url, err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		c.t.Fatalf("%s %s: read body: %v", method, url, err)
+	}
+	return resp, data
+}
+
+// expectJSON checks a response's status and JSON content type and decodes
+// its body into v.
+func (c *client) expectJSON(resp *http.Response, body []byte, status int, v any) {
+	c.t.Helper()
+	if resp.StatusCode != status {
+		c.t.Fatalf("%s %s: expected status %d, got %d: %s", resp.Request.Method, resp.Request.URL.Path, status, resp.StatusCode, body)
+	}
+	if mt, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); mt != "application/json" {
+		c.t.Errorf("%s %s: expected Content-Type application/json, got %q", resp.Request.Method, resp.Request.URL.Path, resp.Header.Get("Content-Type"))
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		c.t.Fatalf("%s %s: decode body: %v: %s", resp.Request.Method, resp.Request.URL.Path, err, body)
+	}
+}
+
+// expectError checks for an error status with an ADK error body.
+func (c *client) expectError(resp *http.Response, body []byte, status int) {
+	c.t.Helper()
+	var e struct {
+		Error string `json:"error"`
+	}
+	c.expectJSON(resp, body, status, &e)
+	if e.Error == "" {
+		c.t.Errorf("%s %s: expected an error message, got %s", resp.Request.Method, resp.Request.URL.Path, body)
+	}
+}
+
+// createSession creates a session and returns its JSON.
+func (c *client) createSession() map[string]any {
+	c.t.Helper()
+	resp, body := c.do(http.MethodPost, c.sessionsURL(c.opts.User), "{}")
+	var sess map[string]any
+	c.expectJSON(resp, body, http.StatusOK, &sess)
+	c.checkSessionShape(sess)
+	return sess
+}
+
+// checkSessionShape checks the fields of an ADK session.
+func (c *client) checkSessionShape(sess map[string]any) {
+	c.t.Helper()
+	if id, _ := sess["id"].(string); id == "" {
+		c.t.Errorf("session: expected a non-empty id, got %v", sess["id"])
+	}
+	if sess["appName"] != c.opts.App {
+		c.t.Errorf("session: expected appName %q, got %v", c.opts.App, sess["appName"])
+	}
+	if sess["userId"] != c.opts.User {
+		c.t.Errorf("session: expected userId %q, got %v", c.opts.User, sess["userId"])
+	}
+	if _, ok := sess["state"].(map[string]any); !ok {
+		c.t.Errorf("session: expected a state object, got %v", sess["state"])
+	}
+	if _, ok := sess["events"].([]any); !ok {
+		c.t.Errorf("session: expected an events array, got %v", sess["events"])
+	}
+	if _, ok := sess["lastUpdateTime"].(float64); !ok {
+		c.t.Errorf("session: expected a numeric lastUpdateTime, got %v", sess["lastUpdateTime"])
+	}
+}
+
+// runSSE posts a turn and returns the response with its events, checking
+// the SSE framing: every frame is a block of field lines ended by a blank
+// line, and every data field is one JSON object.
+func (c *client) runSSE(sessionID, body string) (*http.Response, []map[string]any) {
+	c.t.Helper()
+	resp, data := c.do(http.MethodPost, c.sessionURL(sessionID)+"/run_sse", body)
+	if resp.StatusCode != http.StatusOK {
+		return resp, nil
+	}
+
+	var events []map[string]any
+	var frame []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, 16<<20)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line != "" {
+			frame = append(frame, line)
+			continue
+		}
+		var payload []string
+		for _, field := range frame {
+			name, value, _ := strings.Cut(field, ":")
+			switch name {
+			case "":
+				// A comment.
+			case "data":
+				payload = append(payload, strings.TrimPrefix(value, " "))
+			case "id", "event", "retry":
+			default:
+				c.t.Errorf("run_sse: unexpected SSE field line %q", field)
+			}
+		}
+		frame = nil
+		if payload == nil {
+			continue
+		}
+		var evt map[string]any
+		if err := json.Unmarshal([]byte(strings.Join(payload, "\n")), &evt); err != nil {
+			c.t.Errorf("run_sse: data is not a JSON object: %v: %s", err, strings.Join(payload, "\n"))
+			continue
+		}
+		events = append(events, evt)
+	}
+	if len(frame) > 0 {
+		c.t.Errorf("run_sse: stream ends inside a frame: %q", frame)
+	}
+	return resp, events
+}
+
+func (c *client) newMessage() string {
+	body, _ := json.Marshal(map[string]any{
+		"new_message": map[string]any{"role": "user", "parts": []any{map[string]any{"text": c.opts.Prompt}}},
+	})
+	return string(body)
+}
+
+func checkCreateSession(c *client) {
+	c.createSession()
+}
+
+func checkCreateSessionWithID(c *client) {
+	id := "conformance-fixed-id"
+	c.do(http.MethodDelete, c.sessionURL(id), "")
+	defer c.do(http.MethodDelete, c.sessionURL(id), "")
+
+	for range 2 {
+		resp, body := c.do(http.MethodPost, c.sessionURL(id), "{}")
+		var sess map[string]any
+		c.expectJSON(resp, body, http.StatusOK, &sess)
+		if sess["id"] != id {
+			c.t.Errorf("expected session id %q, got %v", id, sess["id"])
+		}
+	}
+}
+
+func checkGetSession(c *client) {
+	created := c.createSession()
+	resp, body := c.do(http.MethodGet, c.sessionURL(created["id"].(string)), "")
+	var sess map[string]any
+	c.expectJSON(resp, body, http.StatusOK, &sess)
+	c.checkSessionShape(sess)
+	if sess["id"] != created["id"] {
+		c.t.Errorf("expected session %v, got %v", created["id"], sess["id"])
+	}
+}
+
+func checkGetUnknownSession(c *client) {
+	resp, body := c.do(http.MethodGet, c.sessionURL("conformance-no-such-session"), "")
+	c.expectError(resp, body, http.StatusNotFound)
+}
+
+func checkListSessions(c *client) {
+	created := c.createSession()
+	resp, body := c.do(http.MethodGet, c.sessionsURL(c.opts.User), "")
+	var sessions []map[string]any
+	c.expectJSON(resp, body, http.StatusOK, &sessions)
+	for _, sess := range sessions {
+		if sess["id"] == created["id"] {
+			return
+		}
+	}
+	c.t.Errorf("expected session %v in the list, got %s", created["id"], body)
+}
+
+func checkOtherUsersSessions(c *client) {
+	created := c.createSession()
+	url := c.sessionsURL(c.opts.User+"-other") + "/" + created["id"].(string)
+	resp, body := c.do(http.MethodGet, url, "")
+	c.expectError(resp, body, http.StatusNotFound)
+}
+
+func checkRunSSE(c *client) {
+	sess := c.createSession()
+	resp, events := c.runSSE(sess["id"].(string), c.newMessage())
+	if resp.StatusCode != http.StatusOK {
+		c.t.Fatalf("run_sse: expected status 200, got %d", resp.StatusCode)
+	}
+	if mt, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); mt != "text/event-stream" {
+		c.t.Errorf("run_sse: expected Content-Type text/event-stream, got %q", resp.Header.Get("Content-Type"))
+	}
+	if len(events) == 0 {
+		c.t.Fatal("run_sse: expected events")
+	}
+
+	invocation := events[0]["invocationId"]
+	hasContent := false
+	for i, evt := range events {
+		for _, field := range []string{"id", "invocationId", "author"} {
+			if v, _ := evt[field].(string); v == "" {
+				c.t.Errorf("run_sse: event %d: expected a non-empty %s, got %v", i, field, evt[field])
+			}
+		}
+		if _, ok := evt["time"].(float64); !ok {
+			c.t.Errorf("run_sse: event %d: expected a numeric time, got %v", i, evt["time"])
+		}
+		if evt["invocationId"] != invocation {
+			c.t.Errorf("run_sse: event %d: expected invocation %v, got %v", i, invocation, evt["invocationId"])
+		}
+		if content, ok := evt["content"].(map[string]any); ok {
+			hasContent = true
+			if _, ok := content["parts"].([]any); !ok {
+				c.t.Errorf("run_sse: event %d: expected content parts, got %v", i, content)
+			}
+		}
+	}
+	if !hasContent {
+		c.t.Error("run_sse: expected an event with content")
+	}
+	if last := events[len(events)-1]; last["turnComplete"] != true {
+		c.t.Errorf("run_sse: expected the last event to complete the turn, got %v", last)
+	}
+}
+
+func checkRunSSEHistory(c *client) {
+	id := c.createSession()["id"].(string)
+	if resp, _ := c.runSSE(id, c.newMessage()); resp.StatusCode != http.StatusOK {
+		c.t.Fatalf("run_sse: expected status 200, got %d", resp.StatusCode)
+	}
+
+	resp, body := c.do(http.MethodGet, c.sessionURL(id), "")
+	var sess map[string]any
+	c.expectJSON(resp, body, http.StatusOK, &sess)
+	events, _ := sess["events"].([]any)
+	var authors []string
+	for _, e := range events {
+		if evt, ok := e.(map[string]any); ok {
+			author, _ := evt["author"].(string)
+			authors = append(authors, author)
+		}
+	}
+	if len(authors) < 2 || authors[0] != "user" {
+		c.t.Errorf("expected the user's message and the reply in the session's events, got authors %v", authors)
+	}
+}
+
+func checkRunSSEMissingMessage(c *client) {
+	id := c.createSession()["id"].(string)
+	resp, body := c.do(http.MethodPost, c.sessionURL(id)+"/run_sse", "{}")
+	c.expectError(resp, body, http.StatusBadRequest)
+}
+
+func checkRunSSEMalformedBody(c *client) {
+	id := c.createSession()["id"].(string)
+	resp, body := c.do(http.MethodPost, c.sessionURL(id)+"/run_sse", `{"new_message":`)
+	c.expectError(resp, body, http.StatusBadRequest)
+}
+
+func checkDeleteSession(c *client) {
+	id := c.createSession()["id"].(string)
+	resp, body := c.do(http.MethodDelete, c.sessionURL(id), "")
+	if resp.StatusCode != http.StatusOK {
+		c.t.Fatalf("delete session: expected status 200, got %d: %s", resp.StatusCode, body)
+	}
+	resp, body = c.do(http.MethodGet, c.sessionURL(id), "")
+	c.expectError(resp, body, http.StatusNotFound)
+}
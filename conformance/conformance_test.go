@@ -0,0 +1,65 @@
+package conformance_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/innomon/adk2goose/conformance"
+	"github.com/innomon/adk2goose/gooseclient"
+	"github.com/innomon/adk2goose/internal/config"
+	"github.com/innomon/adk2goose/internal/proxy"
+)
+
+// newGoose returns a Goose server that answers every prompt with one
+// message and keeps each session's conversation.
+func newGoose(t *testing.T) *httptest.Server {
+	var sessions atomic.Int64
+	var mu sync.Mutex
+	history := make(map[string][]any)
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /agent/start", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{
+			"id":          fmt.Sprintf("goose-%d", sessions.Add(1)),
+			"working_dir": "/tmp",
+		})
+	})
+	mux.HandleFunc("POST /agent/stop", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, "{}")
+	})
+	mux.HandleFunc("POST /reply", func(w http.ResponseWriter, r *http.Request) {
+		var reply gooseclient.ReplyRequest
+		json.NewDecoder(r.Body).Decode(&reply)
+		mu.Lock()
+		history[reply.SessionID] = append(history[reply.SessionID],
+			map[string]any{"role": "user", "created": 1700000000, "content": []any{map[string]any{"type": "text", "text": "Hello"}}},
+			map[string]any{"role": "assistant", "created": 1700000001, "content": []any{map[string]any{"type": "text", "text": "Hi there"}}},
+		)
+		mu.Unlock()
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, `data: {"type":"Message","message":{"id":"msg-1","role":"assistant","created":1700000000,"content":[{"type":"text","text":"Hi there"}]}}`+"\n\n")
+		fmt.Fprint(w, `data: {"type":"Finish","reason":"stop"}`+"\n\n")
+	})
+	mux.HandleFunc("GET /sessions/{id}", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		messages := append([]any{}, history[r.PathValue("id")]...)
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"sessionId": r.PathValue("id"), "messages": messages})
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestProxy(t *testing.T) {
+	client := gooseclient.New(newGoose(t).URL, "")
+	h := proxy.NewHandler(proxy.NewSessionManager(client, t.TempDir()), client, &config.Config{})
+	conformance.Run(t, h, conformance.Options{})
+}
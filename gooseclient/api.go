@@ -0,0 +1,44 @@
+package gooseclient
+
+import "context"
+
+// API is the Goose agent API the proxy drives. Client serves it from goosed
+// HTTP servers and CLI from the goose command line; operations a backend
+// cannot perform fail with ErrUnsupported.
+type API interface {
+	StartAgent(ctx context.Context, req *StartAgentRequest) (*StartAgentResponse, error)
+	ResumeAgent(ctx context.Context, req *ResumeAgentRequest) (*StartAgentResponse, error)
+	StopAgent(ctx context.Context, sessionID string) error
+	Reply(ctx context.Context, req *ReplyRequest) (<-chan SSEEvent, error)
+
+	GetSession(ctx context.Context, sessionID string) (*SessionHistoryResponse, error)
+	ListSessions(ctx context.Context) (*SessionListResponse, error)
+	DeleteSession(ctx context.Context, sessionID string) error
+
+	ConfirmTool(ctx context.Context, req *ToolConfirmationRequest) error
+	SubmitToolResult(ctx context.Context, req *ToolResultRequest) error
+	UpdateProvider(ctx context.Context, req *UpdateProviderRequest) error
+	ExtendPrompt(ctx context.Context, req *ExtendPromptRequest) error
+	ListTools(ctx context.Context, sessionID string) ([]ToolInfo, error)
+
+	ReadAllConfig(ctx context.Context) (*ConfigResponse, error)
+	ReadConfig(ctx context.Context, key string, isSecret bool) (any, error)
+	UpsertConfig(ctx context.Context, req *UpsertConfigRequest) error
+
+	// Active names the server requests go to, and FailOver moves them
+	// elsewhere after it failed; Pool is nil without a pool.
+	Active() string
+	FailOver(ctx context.Context, from string) bool
+	Pool() *Pool
+
+	Streams() []StreamInfo
+	CloseStreams(ctx context.Context) error
+
+	ProbeVersion(ctx context.Context) (*ServerVersion, error)
+	ServerVersion() *ServerVersion
+}
+
+var (
+	_ API = (*Client)(nil)
+	_ API = (*CLI)(nil)
+)
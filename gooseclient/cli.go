@@ -0,0 +1,562 @@
+package gooseclient
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/innomon/adk2goose/internal/secrets"
+)
+
+// ErrUnsupported is returned for operations a Goose backend cannot perform,
+// such as confirming tool calls through the goose CLI, which runs them
+// unattended.
+var ErrUnsupported = errors.New("not supported by this Goose backend")
+
+// cliErrorTail caps the goose stderr kept to report a failed run.
+const cliErrorTail = 4 << 10
+
+// CLI runs Goose through its command line, for hosts with the goose binary
+// but no goosed server. Each turn is a headless "goose run" on the session's
+// file in Dir, which goose resumes, so conversations carry across turns as
+// they do in goosed. A turn's messages arrive once its run exits rather
+// than streaming, tool calls run without confirmation, and Goose's own
+// configuration is left to the goose config files.
+type CLI struct {
+	Binary string   // goose executable, looked up in PATH
+	Dir    string   // session files, one JSON Lines file per session
+	Args   []string // added to every run, such as "--with-builtin developer"
+	Env    []string // extra KEY=VALUE variables
+
+	streams streamRegistry // running turns
+
+	mu       sync.Mutex
+	sessions map[string]*cliSession // run settings, by session ID
+	version  *ServerVersion         // learned by ProbeVersion
+}
+
+// cliSession is what a session's runs are started with besides its file.
+type cliSession struct {
+	provider string
+	model    string
+	system   []string // prompt extensions, in order
+}
+
+// NewCLI returns a backend running the goose binary with session files in
+// dir, which is created as needed.
+func NewCLI(binary, dir string, args, env []string) *CLI {
+	return &CLI{Binary: binary, Dir: dir, Args: args, Env: env}
+}
+
+// StartAgent creates a session file for a new conversation. Recipes are
+// not supported.
+func (c *CLI) StartAgent(ctx context.Context, req *StartAgentRequest) (*StartAgentResponse, error) {
+	if req.RecipeID != "" {
+		return nil, fmt.Errorf("recipe %s: %w", req.RecipeID, ErrUnsupported)
+	}
+	if err := os.MkdirAll(c.Dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create session dir: %w", err)
+	}
+	id := newCLISessionID()
+	path, err := c.path(id)
+	if err != nil {
+		return nil, err
+	}
+	meta := &SessionMetadata{WorkingDir: req.WorkingDir, Description: req.Name}
+	if err := writeSessionFile(path, meta, nil); err != nil {
+		return nil, err
+	}
+	return &StartAgentResponse{ID: id, Name: req.Name, WorkingDir: req.WorkingDir}, nil
+}
+
+// ResumeAgent checks that the session's file still exists; there is no
+// agent to load between runs.
+func (c *CLI) ResumeAgent(ctx context.Context, req *ResumeAgentRequest) (*StartAgentResponse, error) {
+	path, err := c.path(req.SessionID)
+	if err != nil {
+		return nil, err
+	}
+	meta, _, err := readSessionFile(path, req.SessionID)
+	if err != nil {
+		return nil, err
+	}
+	return &StartAgentResponse{ID: req.SessionID, Name: meta.Description, WorkingDir: meta.WorkingDir}, nil
+}
+
+// StopAgent kills the session's running turn, if any.
+func (c *CLI) StopAgent(ctx context.Context, sessionID string) error {
+	c.streams.cancelSession(sessionID)
+	return nil
+}
+
+// Reply runs goose on the session's file with the user message's text. The
+// run is registered with the backend until it exits, ctx is done, or
+// CloseStreams is called; its new messages are then sent, followed by a
+// Finish event, or an Error event with the end of its stderr if it failed.
+// A run that left the session file untouched has its stdout sent as the
+// reply, and the exchange recorded in the file.
+func (c *CLI) Reply(ctx context.Context, req *ReplyRequest) (<-chan SSEEvent, error) {
+	path, err := c.path(req.SessionID)
+	if err != nil {
+		return nil, err
+	}
+	meta, history, err := readSessionFile(path, req.SessionID)
+	if err != nil {
+		return nil, err
+	}
+	text := messageText(req.UserMessage)
+	if text == "" {
+		return nil, fmt.Errorf("message without text: %w", ErrUnsupported)
+	}
+	if len(history) == 0 && len(req.ConversationSoFar) > 0 {
+		history = req.ConversationSoFar
+		if err := writeSessionFile(path, meta, history); err != nil {
+			return nil, err
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	cmd := c.command(ctx, c.runArgs(req.SessionID, path, len(history) > 0)...)
+	cmd.Dir = meta.WorkingDir
+	cmd.Stdin = strings.NewReader(text)
+	var stdout bytes.Buffer
+	stderr := &tailBuffer{max: cliErrorTail}
+	cmd.Stdout = &stdout
+	cmd.Stderr = stderr
+
+	id, err := c.streams.add(req.SessionID, c.Active(), cancel)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		c.streams.remove(id, "completed")
+		cancel()
+		return nil, fmt.Errorf("run goose: %w", err)
+	}
+	ch := make(chan SSEEvent)
+	go func() {
+		// Unregistered before ch closes, so readers seeing the end see it
+		// gone.
+		defer close(ch)
+		defer func() {
+			end := "completed"
+			if ctx.Err() != nil {
+				end = "cancelled"
+			}
+			c.streams.remove(id, end)
+		}()
+		defer cancel()
+
+		runErr := cmd.Wait()
+		if ctx.Err() != nil {
+			return
+		}
+		var events []SSEEvent
+		for _, msg := range c.replyMessages(path, meta, history, req.UserMessage, runErr, stdout.String()) {
+			events = append(events, SSEEvent{Type: "Message", Message: msg})
+		}
+		if runErr != nil {
+			msg := strings.TrimSpace(stderr.String())
+			if msg == "" {
+				msg = runErr.Error()
+			}
+			events = append(events, SSEEvent{Type: "Error", Error: "goose run failed: " + msg})
+		} else {
+			events = append(events, SSEEvent{Type: "Finish", Reason: "stop"})
+		}
+		for _, evt := range events {
+			select {
+			case ch <- evt:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch, nil
+}
+
+// command returns a goose command with args, in the proxy's environment
+// without its credentials, plus Env.
+func (c *CLI) command(ctx context.Context, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, c.Binary, args...)
+	cmd.Env = secrets.ChildEnviron(c.Env...)
+	return cmd
+}
+
+// runArgs returns the arguments of a run in the session at path, resuming
+// its conversation if it has one. The prompt is read from stdin, where its
+// length is not limited, it cannot be taken for a flag, and it does not
+// show in the process list; values of other flags are attached with = for
+// the same reason.
+func (c *CLI) runArgs(sessionID, path string, resume bool) []string {
+	args := []string{"run", "--instructions", "-", "--path=" + path}
+	if resume {
+		args = append(args, "--resume")
+	}
+	c.mu.Lock()
+	if s := c.sessions[sessionID]; s != nil {
+		if s.provider != "" {
+			args = append(args, "--provider="+s.provider)
+		}
+		if s.model != "" {
+			args = append(args, "--model="+s.model)
+		}
+		if len(s.system) > 0 {
+			args = append(args, "--system="+strings.Join(s.system, "\n\n"))
+		}
+	}
+	c.mu.Unlock()
+	return append(args, c.Args...)
+}
+
+// replyMessages returns the messages a run added to the session at path
+// after history, leaving out the user message goose records first. A
+// successful run that added none is taken to have printed its reply, which
+// is recorded in the file with the user message.
+func (c *CLI) replyMessages(path string, meta *SessionMetadata, history []GooseMessage, user *GooseMessage, runErr error, stdout string) []*GooseMessage {
+	var added []GooseMessage
+	if _, after, err := readSessionFile(path, ""); err == nil && len(after) > len(history) {
+		added = after[len(history):]
+	}
+	if len(added) > 0 && added[0].Role == "user" {
+		added = added[1:]
+	} else if len(added) == 0 && runErr == nil && strings.TrimSpace(stdout) != "" {
+		reply := GooseMessage{
+			Role:    "assistant",
+			Created: time.Now().Unix(),
+			Content: []MessageContent{{Type: "text", Text: strings.TrimSpace(stdout)}},
+		}
+		added = []GooseMessage{reply}
+		if user != nil {
+			if err := writeSessionFile(path, meta, append(slices.Clip(history), *user, reply)); err != nil {
+				// The reply still reaches the client; only the next
+				// turn misses it.
+				log.Printf("goose cli: record reply in session %s: %v", filepath.Base(path), err)
+			}
+		}
+	}
+	msgs := make([]*GooseMessage, len(added))
+	for i := range added {
+		msgs[i] = &added[i]
+	}
+	return msgs
+}
+
+// GetSession reads the session's conversation from its file.
+func (c *CLI) GetSession(ctx context.Context, sessionID string) (*SessionHistoryResponse, error) {
+	path, err := c.path(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	meta, msgs, err := readSessionFile(path, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	return &SessionHistoryResponse{SessionID: sessionID, Metadata: meta, Messages: msgs}, nil
+}
+
+// ListSessions lists the session files in Dir.
+func (c *CLI) ListSessions(ctx context.Context) (*SessionListResponse, error) {
+	entries, err := os.ReadDir(c.Dir)
+	if os.IsNotExist(err) {
+		return &SessionListResponse{Sessions: []SessionInfo{}}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("list sessions: %w", err)
+	}
+	resp := &SessionListResponse{Sessions: []SessionInfo{}}
+	for _, e := range entries {
+		id, ok := strings.CutSuffix(e.Name(), ".jsonl")
+		if !ok || e.IsDir() {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		path := filepath.Join(c.Dir, e.Name())
+		meta, _, err := readSessionFile(path, id)
+		if err != nil {
+			continue
+		}
+		resp.Sessions = append(resp.Sessions, SessionInfo{
+			ID:       id,
+			Name:     meta.Description,
+			Path:     path,
+			Modified: info.ModTime().UTC().Format(time.RFC3339),
+			Metadata: meta,
+		})
+	}
+	sort.Slice(resp.Sessions, func(i, j int) bool { return resp.Sessions[i].ID < resp.Sessions[j].ID })
+	return resp, nil
+}
+
+// DeleteSession deletes the session's file and run settings.
+func (c *CLI) DeleteSession(ctx context.Context, sessionID string) error {
+	path, err := c.path(sessionID)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	delete(c.sessions, sessionID)
+	c.mu.Unlock()
+	if err := os.Remove(path); err != nil {
+		if os.IsNotExist(err) {
+			return notFound(sessionID)
+		}
+		return fmt.Errorf("delete session: %w", err)
+	}
+	return nil
+}
+
+// UpdateProvider sets the provider and model of the session's next runs.
+// The CLI takes no provider request parameters.
+func (c *CLI) UpdateProvider(ctx context.Context, req *UpdateProviderRequest) error {
+	if len(req.RequestParams) > 0 {
+		return fmt.Errorf("provider request parameters: %w", ErrUnsupported)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := c.session(req.SessionID)
+	s.provider, s.model = req.Provider, req.Model
+	return nil
+}
+
+// ExtendPrompt adds standing instructions to the system prompt of the
+// session's next runs.
+func (c *CLI) ExtendPrompt(ctx context.Context, req *ExtendPromptRequest) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := c.session(req.SessionID)
+	s.system = append(s.system, req.Extension)
+	return nil
+}
+
+// session returns the run settings of a session, creating them. c.mu must
+// be held.
+func (c *CLI) session(sessionID string) *cliSession {
+	if c.sessions == nil {
+		c.sessions = make(map[string]*cliSession)
+	}
+	s := c.sessions[sessionID]
+	if s == nil {
+		s = &cliSession{}
+		c.sessions[sessionID] = s
+	}
+	return s
+}
+
+// ConfirmTool is not supported: runs call tools without confirmation.
+func (c *CLI) ConfirmTool(ctx context.Context, req *ToolConfirmationRequest) error {
+	return fmt.Errorf("confirm tool call: %w", ErrUnsupported)
+}
+
+// SubmitToolResult is not supported: runs execute their tools themselves.
+func (c *CLI) SubmitToolResult(ctx context.Context, req *ToolResultRequest) error {
+	return fmt.Errorf("submit tool result: %w", ErrUnsupported)
+}
+
+// ListTools is not supported.
+func (c *CLI) ListTools(ctx context.Context, sessionID string) ([]ToolInfo, error) {
+	return nil, fmt.Errorf("list tools: %w", ErrUnsupported)
+}
+
+// ReadAllConfig is not supported; use goose configure.
+func (c *CLI) ReadAllConfig(ctx context.Context) (*ConfigResponse, error) {
+	return nil, fmt.Errorf("read config: %w", ErrUnsupported)
+}
+
+// ReadConfig is not supported; use goose configure.
+func (c *CLI) ReadConfig(ctx context.Context, key string, isSecret bool) (any, error) {
+	return nil, fmt.Errorf("read config: %w", ErrUnsupported)
+}
+
+// UpsertConfig is not supported; use goose configure.
+func (c *CLI) UpsertConfig(ctx context.Context, req *UpsertConfigRequest) error {
+	return fmt.Errorf("update config: %w", ErrUnsupported)
+}
+
+// Active names the goose binary in place of a server.
+func (c *CLI) Active() string {
+	return "cli:" + c.Binary
+}
+
+// FailOver reports false: there is no other server.
+func (c *CLI) FailOver(ctx context.Context, from string) bool {
+	return false
+}
+
+// Pool returns nil.
+func (c *CLI) Pool() *Pool {
+	return nil
+}
+
+// Streams returns the running turns, oldest first.
+func (c *CLI) Streams() []StreamInfo {
+	return c.streams.list()
+}
+
+// CloseStreams kills every running turn and waits until they have exited,
+// or ctx is done. Reply fails afterwards, so it is meant for shutdown.
+func (c *CLI) CloseStreams(ctx context.Context) error {
+	return c.streams.close(ctx)
+}
+
+// ProbeVersion runs goose --version. The CLI needs no adaptations.
+func (c *CLI) ProbeVersion(ctx context.Context) (*ServerVersion, error) {
+	out, err := c.command(ctx, "--version").Output()
+	if err != nil {
+		return nil, fmt.Errorf("probe goose version: %w", err)
+	}
+	v := &ServerVersion{URL: c.Active(), ProbedAt: time.Now()}
+	if fields := strings.Fields(string(out)); len(fields) > 0 {
+		v.Version = strings.TrimPrefix(fields[len(fields)-1], "v")
+		v.release, v.known = parseSemver(v.Version)
+	}
+	c.mu.Lock()
+	c.version = v
+	c.mu.Unlock()
+	return v, nil
+}
+
+// ServerVersion returns what ProbeVersion learned, or nil if it was not
+// called.
+func (c *CLI) ServerVersion() *ServerVersion {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.version
+}
+
+// path returns the file of a session, which 404s for IDs that are not a
+// plain file name.
+func (c *CLI) path(sessionID string) (string, error) {
+	if sessionID == "" || sessionID == ".." || filepath.Base(sessionID) != sessionID {
+		return "", notFound(sessionID)
+	}
+	return filepath.Join(c.Dir, sessionID+".jsonl"), nil
+}
+
+func notFound(sessionID string) error {
+	return &StatusError{StatusCode: http.StatusNotFound, Body: fmt.Sprintf("session %q not found", sessionID)}
+}
+
+// newCLISessionID returns a session ID in the style of goose's, the start
+// time, with a random suffix so that sessions started together differ.
+func newCLISessionID() string {
+	b := make([]byte, 4)
+	rand.Read(b)
+	return time.Now().Format("20060102_150405") + "_" + hex.EncodeToString(b)
+}
+
+// readSessionFile reads a session file: a line of metadata followed by a
+// line per message. A missing file is a 404 for sessionID.
+func readSessionFile(path, sessionID string) (*SessionMetadata, []GooseMessage, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil, notFound(sessionID)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("read session: %w", err)
+	}
+	defer f.Close()
+
+	var meta SessionMetadata
+	msgs := []GooseMessage{}
+	r := bufio.NewReader(f)
+	for n := 1; ; n++ {
+		line, err := r.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 {
+			var uerr error
+			if n == 1 {
+				uerr = json.Unmarshal(line, &meta)
+			} else {
+				var msg GooseMessage
+				uerr = json.Unmarshal(line, &msg)
+				msgs = append(msgs, msg)
+			}
+			if uerr != nil {
+				return nil, nil, fmt.Errorf("read session %s line %d: %w", filepath.Base(path), n, uerr)
+			}
+		}
+		if err == io.EOF {
+			return &meta, msgs, nil
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("read session: %w", err)
+		}
+	}
+}
+
+// writeSessionFile replaces the session file at path with meta and msgs.
+func writeSessionFile(path string, meta *SessionMetadata, msgs []GooseMessage) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	m := *meta
+	m.MessageCount = len(msgs)
+	if err := enc.Encode(&m); err != nil {
+		return fmt.Errorf("write session: %w", err)
+	}
+	for i := range msgs {
+		if err := enc.Encode(&msgs[i]); err != nil {
+			return fmt.Errorf("write session: %w", err)
+		}
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0o644); err != nil {
+		return fmt.Errorf("write session: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("write session: %w", err)
+	}
+	return nil
+}
+
+// messageText joins the text of a message's content.
+func messageText(msg *GooseMessage) string {
+	if msg == nil {
+		return ""
+	}
+	var parts []string
+	for _, c := range msg.Content {
+		if c.Type == "text" && c.Text != "" {
+			parts = append(parts, c.Text)
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+// tailBuffer keeps the last max bytes written to it.
+type tailBuffer struct {
+	max int
+	buf []byte
+}
+
+func (t *tailBuffer) Write(p []byte) (int, error) {
+	t.buf = append(t.buf, p...)
+	if over := len(t.buf) - t.max; over > 0 {
+		t.buf = t.buf[over:]
+	}
+	return len(p), nil
+}
+
+func (t *tailBuffer) String() string {
+	return string(t.buf)
+}
@@ -0,0 +1,449 @@
+package gooseclient
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Client is an HTTP client for the Goose agent API.
+type Client struct {
+	BaseURL   string
+	SecretKey string
+	HTTP      *http.Client
+
+	pool    *Pool          // spreads sessions across servers; nil sends all to BaseURL
+	streams streamRegistry // open reply streams
+
+	replyIdleTimeout time.Duration // see TransportConfig.ReplyIdleTimeout
+
+	standby string                 // server FailOver switches to; empty for none
+	failMu  sync.Mutex             // serializes FailOver
+	active  atomic.Pointer[string] // server failed over to; nil for BaseURL
+
+	secret atomic.Pointer[string] // key set by SetSecretKey; nil for SecretKey
+
+	versions versions // releases learned by Negotiate
+}
+
+// StatusError is returned for Goose responses with a non-2xx status.
+type StatusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("unexpected status %d: %s", e.StatusCode, e.Body)
+}
+
+// IsNotFound reports whether err is a 404 from Goose, such as for a session
+// the Goose server does not know.
+func IsNotFound(err error) bool {
+	var se *StatusError
+	return errors.As(err, &se) && se.StatusCode == http.StatusNotFound
+}
+
+// New creates a new Goose API client.
+func New(baseURL, secretKey string, opts ...Option) *Client {
+	c := &Client{
+		BaseURL:   strings.TrimRight(baseURL, "/"),
+		SecretKey: secretKey,
+		HTTP:      &http.Client{},
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// SetSecretKey replaces the key sent in X-Secret-Key, such as when it is
+// rotated in a secret manager. It is safe to call while requests are made.
+func (c *Client) SetSecretKey(key string) {
+	c.secret.Store(&key)
+}
+
+// secretKey returns the key to send in X-Secret-Key.
+func (c *Client) secretKey() string {
+	if key := c.secret.Load(); key != nil {
+		return *key
+	}
+	return c.SecretKey
+}
+
+// baseURL returns the base URL of the Goose server hosting sessionID.
+// Sessions a pool does not know go to the active server.
+func (c *Client) baseURL(sessionID string) string {
+	if c.pool != nil {
+		if u, ok := c.pool.locate(sessionID); ok {
+			return u
+		}
+	}
+	return c.Active()
+}
+
+// doSessionJSON is doJSON for a request about sessionID, sent to the Goose
+// server hosting it. A session the server no longer knows is forgotten by
+// the pool.
+func (c *Client) doSessionJSON(ctx context.Context, sessionID, method, path string, body, result any) error {
+	err := c.doJSONAt(ctx, c.baseURL(sessionID), method, path, body, result)
+	if c.pool != nil && IsNotFound(err) {
+		c.pool.unpin(sessionID)
+	}
+	return err
+}
+
+// doJSON is a helper that sends a JSON request to the active server and
+// decodes the JSON response.
+func (c *Client) doJSON(ctx context.Context, method, path string, body, result any) error {
+	return c.doJSONAt(ctx, c.Active(), method, path, body, result)
+}
+
+// doJSONAt is doJSON for the Goose server at base.
+func (c *Client) doJSONAt(ctx context.Context, base, method, path string, body, result any) error {
+	var bodyReader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("marshal request body: %w", err)
+		}
+		bodyReader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, base+path, bodyReader)
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if key := c.secretKey(); key != "" {
+		req.Header.Set("X-Secret-Key", key)
+	}
+	setTraceHeaders(ctx, req.Header)
+
+	start := time.Now()
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		observeRequest(method, path, start, 0, err)
+		return fmt.Errorf("execute request: %w", err)
+	}
+	defer resp.Body.Close()
+	observeRequest(method, path, start, resp.StatusCode, nil)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(resp.Body)
+		return &StatusError{StatusCode: resp.StatusCode, Body: string(respBody)}
+	}
+
+	if result != nil {
+		if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+			return fmt.Errorf("decode response: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// StartAgent starts a new Goose agent session. With a pool, the session
+// starts on the least loaded server with room, and ErrPoolFull is returned
+// if there is none.
+func (c *Client) StartAgent(ctx context.Context, req *StartAgentRequest) (*StartAgentResponse, error) {
+	return c.startOn(ctx, "/agent/start", req)
+}
+
+// StopAgent stops a running Goose agent session.
+func (c *Client) StopAgent(ctx context.Context, sessionID string) error {
+	err := c.doSessionJSON(ctx, sessionID, http.MethodPost, "/agent/stop", &StopAgentRequest{SessionID: sessionID}, nil)
+	if c.pool != nil && err == nil {
+		c.pool.unpin(sessionID)
+	}
+	return err
+}
+
+// ResumeAgent resumes a previously stopped session, on the server that ran
+// it if the pool knows it.
+func (c *Client) ResumeAgent(ctx context.Context, req *ResumeAgentRequest) (*StartAgentResponse, error) {
+	if c.pool != nil {
+		if _, ok := c.pool.lookup(req.SessionID); !ok {
+			return c.startOn(ctx, "/agent/resume", req)
+		}
+	}
+	var resp StartAgentResponse
+	if err := c.doSessionJSON(ctx, req.SessionID, http.MethodPost, "/agent/resume", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// startOn posts a request that starts a session to path, on a server the
+// pool picks if there is one.
+func (c *Client) startOn(ctx context.Context, path string, req any) (*StartAgentResponse, error) {
+	var resp StartAgentResponse
+	if c.pool == nil {
+		if err := c.doJSON(ctx, http.MethodPost, path, req, &resp); err != nil {
+			return nil, err
+		}
+		return &resp, nil
+	}
+	b, err := c.pool.acquire()
+	if err != nil {
+		return nil, err
+	}
+	if err := c.doJSONAt(ctx, b.URL, http.MethodPost, path, req, &resp); err != nil {
+		c.pool.abandon(b)
+		return nil, err
+	}
+	c.pool.pin(resp.ID, b)
+	return &resp, nil
+}
+
+// Reply sends a user message and returns a channel of server-sent events.
+// The stream is read by a goroutine registered with the client until it
+// ends, ctx is done, or CloseStreams is called; the channel is then closed.
+func (c *Client) Reply(ctx context.Context, req *ReplyRequest) (<-chan SSEEvent, error) {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("marshal request body: %w", err)
+	}
+
+	base := c.baseURL(req.SessionID)
+	ctx, cancel := context.WithCancel(ctx)
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, base+"/reply", bytes.NewReader(data))
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+
+	httpReq.Header.Set("Content-Type", "application/json")
+	if key := c.secretKey(); key != "" {
+		httpReq.Header.Set("X-Secret-Key", key)
+	}
+	setTraceHeaders(ctx, httpReq.Header)
+
+	start := time.Now()
+	resp, err := c.HTTP.Do(httpReq)
+	if err != nil {
+		cancel()
+		observeRequest(http.MethodPost, "/reply", start, 0, err)
+		return nil, fmt.Errorf("execute request: %w", err)
+	}
+	observeRequest(http.MethodPost, "/reply", start, resp.StatusCode, nil)
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		cancel()
+		if c.pool != nil && resp.StatusCode == http.StatusNotFound {
+			c.pool.unpin(req.SessionID)
+		}
+		return nil, &StatusError{StatusCode: resp.StatusCode, Body: string(respBody)}
+	}
+
+	id, err := c.streams.add(req.SessionID, base, cancel)
+	if err != nil {
+		resp.Body.Close()
+		cancel()
+		return nil, err
+	}
+	ch := make(chan SSEEvent)
+	go func() {
+		// Unregistered before ch closes, so readers seeing the end see it
+		// gone.
+		var idled atomic.Bool
+		defer close(ch)
+		defer func() {
+			end := "completed"
+			switch {
+			case idled.Load():
+				end = "idle_timeout"
+			case ctx.Err() != nil:
+				end = "cancelled"
+			}
+			c.streams.remove(id, end)
+		}()
+		defer resp.Body.Close()
+
+		firstEvent := true
+		tap := streamTap(ctx)
+		scanner := bufio.NewScanner(resp.Body)
+		scan := scanner.Scan
+		if c.replyIdleTimeout > 0 {
+			// A read deadline refreshed per line: a connection left
+			// half-open, which would block the read forever, is cut
+			// once no line arrived for the timeout. It is paused while
+			// the reader hands an event on.
+			idle := time.AfterFunc(c.replyIdleTimeout, func() {
+				idled.Store(true)
+				cancel()
+			})
+			defer idle.Stop()
+			scan = func() bool {
+				idle.Reset(c.replyIdleTimeout)
+				ok := scanner.Scan()
+				idle.Stop()
+				return ok
+			}
+		}
+		for scan() {
+			line := scanner.Text()
+			if tap != nil {
+				io.WriteString(tap, line+"\n")
+			}
+
+			if line == "" || strings.HasPrefix(line, ":") {
+				continue
+			}
+
+			if strings.HasPrefix(line, "data: ") {
+				payload := strings.TrimPrefix(line, "data: ")
+				var event SSEEvent
+				if err := json.Unmarshal([]byte(payload), &event); err != nil {
+					continue
+				}
+				c.adaptEvent(base, req.SessionID, &event)
+				if firstEvent {
+					sseFirstEvent.Observe(time.Since(start).Seconds())
+					firstEvent = false
+				}
+				select {
+				case ch <- event:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return ch, nil
+}
+
+// GetSession retrieves the full history of a session.
+func (c *Client) GetSession(ctx context.Context, sessionID string) (*SessionHistoryResponse, error) {
+	var resp SessionHistoryResponse
+	if err := c.doSessionJSON(ctx, sessionID, http.MethodGet, "/sessions/"+sessionID, nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// ListSessions returns all known sessions, from every server of the pool.
+// The pool remembers which server listed each session, so requests about
+// sessions it did not start, such as ones left by an earlier run, reach it.
+func (c *Client) ListSessions(ctx context.Context) (*SessionListResponse, error) {
+	var all SessionListResponse
+	listed := make(map[string]string)
+	for _, base := range c.servers() {
+		var resp SessionListResponse
+		if err := c.doJSONAt(ctx, base, http.MethodGet, "/sessions", nil, &resp); err != nil {
+			return nil, err
+		}
+		for _, s := range resp.Sessions {
+			listed[s.ID] = base
+		}
+		all.Sessions = append(all.Sessions, resp.Sessions...)
+	}
+	if c.pool != nil {
+		c.pool.setListed(listed)
+	}
+	return &all, nil
+}
+
+// DeleteSession deletes a session and its stored conversation. Stop its
+// agent first if it may be running.
+func (c *Client) DeleteSession(ctx context.Context, sessionID string) error {
+	c.forgetSession(sessionID)
+	return c.doSessionJSON(ctx, sessionID, http.MethodDelete, "/sessions/"+sessionID, nil, nil)
+}
+
+// ConfirmTool approves or denies a pending tool call in a session.
+func (c *Client) ConfirmTool(ctx context.Context, req *ToolConfirmationRequest) error {
+	return c.doSessionJSON(ctx, req.SessionID, http.MethodPost, "/confirm", req, nil)
+}
+
+// SubmitToolResult delivers the result of a tool call the client executed to
+// the agent waiting on it.
+func (c *Client) SubmitToolResult(ctx context.Context, req *ToolResultRequest) error {
+	return c.doSessionJSON(ctx, req.SessionID, http.MethodPost, "/tool_result", req, nil)
+}
+
+// UpdateProvider changes the provider, model, or provider request parameters
+// used by a session.
+func (c *Client) UpdateProvider(ctx context.Context, req *UpdateProviderRequest) error {
+	return c.doSessionJSON(ctx, req.SessionID, http.MethodPost, "/agent/update_provider", req, nil)
+}
+
+// ExtendPrompt appends standing instructions to a session's system prompt.
+func (c *Client) ExtendPrompt(ctx context.Context, req *ExtendPromptRequest) error {
+	return c.doSessionJSON(ctx, req.SessionID, http.MethodPost, "/agent/prompt", req, nil)
+}
+
+// ListTools returns the tools the session's agent can call, from every
+// enabled extension.
+func (c *Client) ListTools(ctx context.Context, sessionID string) ([]ToolInfo, error) {
+	var tools []ToolInfo
+	path := "/agent/tools?session_id=" + url.QueryEscape(sessionID)
+	if err := c.doSessionJSON(ctx, sessionID, http.MethodGet, path, nil, &tools); err != nil {
+		return nil, err
+	}
+	return tools, nil
+}
+
+// ReadAllConfig returns the Goose server's configuration. Secret values are
+// masked by Goose.
+func (c *Client) ReadAllConfig(ctx context.Context) (*ConfigResponse, error) {
+	var resp ConfigResponse
+	if err := c.doJSON(ctx, http.MethodGet, "/config", nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// ReadConfig returns the value of a single configuration key, looking it up
+// in Goose's secret store when isSecret is set.
+func (c *Client) ReadConfig(ctx context.Context, key string, isSecret bool) (any, error) {
+	var value any
+	if err := c.doJSON(ctx, http.MethodPost, "/config/read", &ConfigKeyRequest{Key: key, IsSecret: isSecret}, &value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// UpsertConfig creates or updates a configuration key, such as a provider
+// API key or the default model, on every server of the pool.
+func (c *Client) UpsertConfig(ctx context.Context, req *UpsertConfigRequest) error {
+	for _, base := range c.servers() {
+		if err := c.doJSONAt(ctx, base, http.MethodPost, "/config/upsert", req, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SystemInfo returns the version and platform of the active Goose server.
+// Goose releases without the endpoint answer 404.
+func (c *Client) SystemInfo(ctx context.Context) (*SystemInfo, error) {
+	var info SystemInfo
+	if err := c.doJSON(ctx, http.MethodGet, "/system_info", nil, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// servers returns the base URLs of every Goose server the client uses.
+func (c *Client) servers() []string {
+	if c.pool == nil {
+		return []string{c.Active()}
+	}
+	return c.pool.urls()
+}
@@ -0,0 +1,468 @@
+package gooseclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestMain doubles as a fake goose CLI when a CLI backend runs the test
+// binary with fakeGooseCLIEnv set.
+func TestMain(m *testing.M) {
+	if os.Getenv(fakeGooseCLIEnv) == "1" {
+		fakeGooseCLI(os.Args[1:])
+		return
+	}
+	os.Exit(m.Run())
+}
+
+const fakeGooseCLIEnv = "GOOSECLIENT_FAKE_GOOSE_CLI"
+
+// fakeGooseCLI answers goose --version and goose run, recording the prompt
+// read from stdin and a reply echoing it, the system prompt, and FAKE_GOOSE_GREETING in the
+// session file. Prompts starting "fail" exit with an error, and ones
+// starting "print" only print the reply.
+func fakeGooseCLI(args []string) {
+	if len(args) > 0 && args[0] == "--version" {
+		fmt.Println("goose 1.9.1")
+		return
+	}
+	var text, path, system string
+	for i := 1; i < len(args); i++ {
+		switch name, value, _ := strings.Cut(args[i], "="); name {
+		case "--instructions":
+			if i+1 < len(args) && args[i+1] == "-" {
+				i++
+				in, _ := io.ReadAll(os.Stdin)
+				text = string(in)
+			}
+		case "--path":
+			path = value
+		case "--system":
+			system = value
+		}
+	}
+	switch {
+	case strings.HasPrefix(text, "fail"):
+		fmt.Fprintln(os.Stderr, "provider not configured")
+		os.Exit(1)
+	case strings.HasPrefix(text, "print"):
+		fmt.Println("printed reply")
+		return
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		os.Exit(2)
+	}
+	defer f.Close()
+	enc := json.NewEncoder(f)
+	enc.Encode(GooseMessage{Role: "user", Content: []MessageContent{{Type: "text", Text: text}}})
+	reply := strings.Join([]string{os.Getenv("FAKE_GOOSE_GREETING"), text, system}, " ")
+	enc.Encode(GooseMessage{Role: "assistant", Content: []MessageContent{{Type: "text", Text: reply}}})
+}
+
+func TestNew_WithTransport(t *testing.T) {
+	c := New("http://goose.local/", "secret", WithTransport(TransportConfig{
+		MaxIdleConnsPerHost:   64,
+		TLSHandshakeTimeout:   3 * time.Second,
+		ResponseHeaderTimeout: 7 * time.Second,
+	}))
+
+	if c.BaseURL != "http://goose.local" {
+		t.Errorf("expected trailing slash trimmed, got %q", c.BaseURL)
+	}
+	tr, ok := c.HTTP.Transport.(*http.Transport)
+	if !ok {
+		t.Fatalf("expected *http.Transport, got %T", c.HTTP.Transport)
+	}
+	if tr.MaxIdleConnsPerHost != 64 {
+		t.Errorf("expected MaxIdleConnsPerHost 64, got %d", tr.MaxIdleConnsPerHost)
+	}
+	if tr.TLSHandshakeTimeout != 3*time.Second {
+		t.Errorf("expected TLSHandshakeTimeout 3s, got %v", tr.TLSHandshakeTimeout)
+	}
+	if tr.ResponseHeaderTimeout != 7*time.Second {
+		t.Errorf("expected ResponseHeaderTimeout 7s, got %v", tr.ResponseHeaderTimeout)
+	}
+	if tr.Proxy == nil {
+		t.Error("expected default transport settings such as Proxy to be preserved")
+	}
+}
+
+// poolServer is a fake Goose server that starts sessions named after it
+// and knows only the sessions it started.
+func poolServer(t *testing.T, name string) *httptest.Server {
+	t.Helper()
+	var n atomic.Int64
+	var sessions sync.Map
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /agent/start", func(w http.ResponseWriter, r *http.Request) {
+		id := fmt.Sprintf("%s-%d", name, n.Add(1))
+		sessions.Store(id, true)
+		json.NewEncoder(w).Encode(StartAgentResponse{ID: id})
+	})
+	mux.HandleFunc("POST /agent/stop", func(w http.ResponseWriter, r *http.Request) {
+		var req StopAgentRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		sessions.Delete(req.SessionID)
+	})
+	mux.HandleFunc("GET /sessions/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := sessions.Load(r.PathValue("id")); !ok {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(SessionHistoryResponse{SessionID: r.PathValue("id")})
+	})
+	mux.HandleFunc("GET /sessions", func(w http.ResponseWriter, r *http.Request) {
+		var resp SessionListResponse
+		sessions.Range(func(id, _ any) bool {
+			resp.Sessions = append(resp.Sessions, SessionInfo{ID: id.(string)})
+			return true
+		})
+		json.NewEncoder(w).Encode(resp)
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestPool(t *testing.T) {
+	a, b, c := poolServer(t, "a"), poolServer(t, "b"), poolServer(t, "c")
+	var cReady atomic.Bool
+	pool := NewPool(
+		Backend{URL: a.URL, Capacity: 1},
+		Backend{URL: b.URL, Capacity: 1},
+		Backend{URL: c.URL, Ready: cReady.Load},
+	)
+	client := New(a.URL, "", WithPool(pool))
+	ctx := context.Background()
+
+	first, err := client.StartAgent(ctx, &StartAgentRequest{})
+	if err != nil {
+		t.Fatalf("StartAgent: %v", err)
+	}
+	second, err := client.StartAgent(ctx, &StartAgentRequest{})
+	if err != nil {
+		t.Fatalf("StartAgent: %v", err)
+	}
+	if first.ID[0] == second.ID[0] {
+		t.Errorf("expected sessions spread across servers, got %s and %s", first.ID, second.ID)
+	}
+	if _, err := client.StartAgent(ctx, &StartAgentRequest{}); !errors.Is(err, ErrPoolFull) {
+		t.Errorf("expected ErrPoolFull with the free server not ready, got %v", err)
+	}
+
+	// Requests about a session go to the server that started it.
+	for _, id := range []string{first.ID, second.ID} {
+		if _, err := client.GetSession(ctx, id); err != nil {
+			t.Errorf("GetSession(%s): %v", id, err)
+		}
+	}
+	list, err := client.ListSessions(ctx)
+	if err != nil || len(list.Sessions) != 2 {
+		t.Errorf("expected both sessions listed, got %+v, %v", list, err)
+	}
+
+	// Stopping a session frees its slot.
+	if err := client.StopAgent(ctx, first.ID); err != nil {
+		t.Fatalf("StopAgent: %v", err)
+	}
+	third, err := client.StartAgent(ctx, &StartAgentRequest{})
+	if err != nil || third.ID[0] != first.ID[0] {
+		t.Fatalf("expected the freed server reused, got %+v, %v", third, err)
+	}
+
+	cReady.Store(true)
+	fourth, err := client.StartAgent(ctx, &StartAgentRequest{})
+	if err != nil || !strings.HasPrefix(fourth.ID, "c-") {
+		t.Fatalf("expected the unlimited server once ready, got %+v, %v", fourth, err)
+	}
+
+	stats := pool.Stats()
+	if stats[0].Sessions != 1 || stats[1].Sessions != 1 || stats[2].Sessions != 1 || !stats[2].Ready {
+		t.Errorf("unexpected pool stats %+v", stats)
+	}
+}
+
+func TestTraceContext(t *testing.T) {
+	const parent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	var got []http.Header
+	var mu sync.Mutex
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		got = append(got, r.Header.Clone())
+		mu.Unlock()
+		fmt.Fprint(w, "{}")
+	}))
+	defer srv.Close()
+	c := New(srv.URL, "")
+
+	tc := NewTraceContext(parent, "vendor=1", "")
+	if !strings.HasPrefix(tc.TraceParent, "00-4bf92f3577b34da6a3ce929d0e0e4736-") || tc.TraceParent == parent ||
+		!strings.HasSuffix(tc.TraceParent, "-01") || tc.TraceState != "vendor=1" || tc.CorrelationID != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Fatalf("expected the trace continued with a new span, got %+v", tc)
+	}
+	fresh := NewTraceContext("00-00000000000000000000000000000000-00f067aa0ba902b7-01", "vendor=1", "req-7")
+	if _, _, ok := parseTraceParent(fresh.TraceParent); !ok || strings.Contains(fresh.TraceParent, "-00f067aa0ba902b7-") || fresh.TraceState != "" || fresh.CorrelationID != "req-7" {
+		t.Fatalf("expected a new trace for an invalid traceparent, got %+v", fresh)
+	}
+
+	ctx := WithTraceContext(context.Background(), tc)
+	c.StopAgent(ctx, "s1")
+	c.StopAgent(ctx, "s1")
+	c.StopAgent(context.Background(), "s1")
+	if len(got) != 3 {
+		t.Fatalf("expected 3 requests, got %d", len(got))
+	}
+	for _, h := range got[:2] {
+		if p := h.Get("traceparent"); !strings.HasPrefix(p, "00-4bf92f3577b34da6a3ce929d0e0e4736-") || p == tc.TraceParent ||
+			h.Get("tracestate") != "vendor=1" || h.Get(CorrelationIDHeader) != tc.CorrelationID {
+			t.Errorf("expected a child span of the trace, got %v", h)
+		}
+	}
+	if got[0].Get("traceparent") == got[1].Get("traceparent") {
+		t.Error("expected a span per request")
+	}
+	if got[2].Get("traceparent") != "" || got[2].Get(CorrelationIDHeader) != "" {
+		t.Errorf("expected no trace headers without a trace context, got %v", got[2])
+	}
+}
+
+func TestReplyStreamRegistry(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: {\"type\":\"Ping\"}\n\n")
+		w.(http.Flusher).Flush()
+		<-r.Context().Done() // a stream Goose never finishes
+	}))
+	defer srv.Close()
+	c := New(srv.URL, "")
+	open := replyStreams.Value()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	first, err := c.Reply(ctx, &ReplyRequest{SessionID: "s1"})
+	if err != nil {
+		t.Fatalf("reply: %v", err)
+	}
+	second, err := c.Reply(context.Background(), &ReplyRequest{SessionID: "s2"})
+	if err != nil {
+		t.Fatalf("reply: %v", err)
+	}
+	<-first
+	<-second
+	streams := c.Streams()
+	if len(streams) != 2 || streams[0].SessionID != "s1" || streams[1].SessionID != "s2" || streams[0].Server != srv.URL {
+		t.Fatalf("expected both streams registered in order, got %+v", streams)
+	}
+	if got := replyStreams.Value() - open; got != 2 {
+		t.Errorf("expected 2 open streams counted, got %v", got)
+	}
+
+	cancel()
+	for range first {
+	}
+	if streams := c.Streams(); len(streams) != 1 || streams[0].SessionID != "s2" {
+		t.Fatalf("expected the cancelled stream unregistered, got %+v", streams)
+	}
+
+	closeCtx, cancelClose := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelClose()
+	if err := c.CloseStreams(closeCtx); err != nil {
+		t.Fatalf("close streams: %v", err)
+	}
+	if _, ok := <-second; ok {
+		t.Error("expected the remaining stream closed")
+	}
+	if len(c.Streams()) != 0 || replyStreams.Value() != open {
+		t.Errorf("expected no streams left, got %+v", c.Streams())
+	}
+	if _, err := c.Reply(context.Background(), &ReplyRequest{SessionID: "s3"}); !errors.Is(err, ErrClientClosed) {
+		t.Errorf("expected ErrClientClosed after CloseStreams, got %v", err)
+	}
+}
+
+func TestReply_IdleTimeout(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for range 3 {
+			fmt.Fprint(w, "data: {\"type\":\"Ping\"}\n\n")
+			w.(http.Flusher).Flush()
+			time.Sleep(30 * time.Millisecond)
+		}
+		<-r.Context().Done() // the backend goes silent
+	}))
+	defer srv.Close()
+	c := New(srv.URL, "", WithTransport(TransportConfig{ReplyIdleTimeout: 200 * time.Millisecond}))
+	timeouts := replyStreamDuration.Count("idle_timeout")
+
+	ch, err := c.Reply(context.Background(), &ReplyRequest{SessionID: "s1"})
+	if err != nil {
+		t.Fatalf("reply: %v", err)
+	}
+	start := time.Now()
+	var events int
+	for range ch {
+		events++
+	}
+	if events != 3 {
+		t.Errorf("expected the events before the silence, got %d", events)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("expected the silent stream cut after the idle timeout, took %s", elapsed)
+	}
+	if got := replyStreamDuration.Count("idle_timeout") - timeouts; got != 1 {
+		t.Errorf("expected one idle timeout recorded, got %d", got)
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	var version atomic.Value
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/system_info":
+			v := version.Load().(string)
+			if v == "" {
+				http.NotFound(w, r)
+				return
+			}
+			json.NewEncoder(w).Encode(SystemInfo{AppVersion: v})
+		case "/reply":
+			w.Header().Set("Content-Type", "text/event-stream")
+			fmt.Fprint(w, "data: {\"type\":\"Finish\",\"reason\":\"stop\",\"token_state\":{\"input_tokens\":10,\"output_tokens\":5,\"total_tokens\":15}}\n\n")
+		}
+	}))
+	defer srv.Close()
+	c := New(srv.URL, "")
+
+	finish := func() *TokenState {
+		t.Helper()
+		ch, err := c.Reply(context.Background(), &ReplyRequest{SessionID: "s1"})
+		if err != nil {
+			t.Fatalf("reply: %v", err)
+		}
+		var ts *TokenState
+		for evt := range ch {
+			ts = evt.TokenState
+		}
+		return ts
+	}
+	if ts := finish(); ts.AccumulatedTotalTokens != 0 {
+		t.Errorf("expected no adaptation before negotiating, got %+v", ts)
+	}
+
+	version.Store("1.9.2")
+	if err := c.Negotiate(context.Background()); err != nil {
+		t.Fatalf("negotiate: %v", err)
+	}
+	if v := c.ServerVersion(); v.Version != "1.9.2" || len(v.Legacy) != 1 {
+		t.Fatalf("expected 1.9.2 with accumulated tokens adapted, got %+v", v)
+	}
+	finish()
+	if ts := finish(); ts.AccumulatedInputTokens != 20 || ts.AccumulatedOutputTokens != 10 || ts.AccumulatedTotalTokens != 30 {
+		t.Errorf("expected the session's token counts accumulated over two turns, got %+v", ts)
+	}
+
+	version.Store("v1.10.0")
+	if err := c.Negotiate(context.Background()); err != nil {
+		t.Fatalf("negotiate: %v", err)
+	}
+	if v := c.ServerVersion(); len(v.Legacy) != 0 {
+		t.Errorf("expected no adaptation for 1.10.0, got %+v", v)
+	}
+
+	version.Store("")
+	if err := c.Negotiate(context.Background()); err != nil {
+		t.Fatalf("negotiate: %v", err)
+	}
+	if v := c.ServerVersion(); v.Version != "" || len(v.Legacy) != 1 {
+		t.Errorf("expected a server without /system_info adapted for, got %+v", v)
+	}
+
+	version.Store("1.7.9-rc.1")
+	if err := c.Negotiate(context.Background()); !errors.Is(err, ErrUnsupportedVersion) {
+		t.Errorf("expected ErrUnsupportedVersion for 1.7.9, got %v", err)
+	}
+}
+
+func TestCLI(t *testing.T) {
+	c := NewCLI(os.Args[0], t.TempDir(), nil, []string{fakeGooseCLIEnv + "=1", "FAKE_GOOSE_GREETING=hello"})
+	ctx := context.Background()
+
+	if v, err := c.ProbeVersion(ctx); err != nil || v.Version != "1.9.1" {
+		t.Fatalf("expected goose 1.9.1, got %+v, %v", v, err)
+	}
+	start, err := c.StartAgent(ctx, &StartAgentRequest{WorkingDir: t.TempDir(), Name: "cli test"})
+	if err != nil {
+		t.Fatalf("start agent: %v", err)
+	}
+	if err := c.ExtendPrompt(ctx, &ExtendPromptRequest{SessionID: start.ID, Extension: "be brief"}); err != nil {
+		t.Fatalf("extend prompt: %v", err)
+	}
+
+	turn := func(text string) []SSEEvent {
+		t.Helper()
+		ch, err := c.Reply(ctx, &ReplyRequest{
+			SessionID:   start.ID,
+			UserMessage: &GooseMessage{Role: "user", Content: []MessageContent{{Type: "text", Text: text}}},
+		})
+		if err != nil {
+			t.Fatalf("reply: %v", err)
+		}
+		var events []SSEEvent
+		for evt := range ch {
+			events = append(events, evt)
+		}
+		return events
+	}
+	events := turn("hi")
+	if len(events) != 2 || events[0].Message == nil || events[0].Message.Content[0].Text != "hello hi be brief" || events[1].Type != "Finish" {
+		t.Fatalf("expected the reply and a Finish event, got %+v", events)
+	}
+	if events = turn("--help me"); len(events) != 2 || events[0].Message.Content[0].Text != "hello --help me be brief" {
+		t.Fatalf("expected a prompt starting with a dash sent as the prompt, got %+v", events)
+	}
+	if events = turn("print it"); len(events) != 2 || events[0].Message.Content[0].Text != "printed reply" {
+		t.Fatalf("expected the printed reply, got %+v", events)
+	}
+	if events = turn("fail now"); len(events) != 1 || events[0].Type != "Error" || !strings.Contains(events[0].Error, "provider not configured") {
+		t.Fatalf("expected an Error event with goose's stderr, got %+v", events)
+	}
+	if streams := c.Streams(); len(streams) != 0 {
+		t.Errorf("expected no turn left running, got %+v", streams)
+	}
+
+	hist, err := c.GetSession(ctx, start.ID)
+	if err != nil {
+		t.Fatalf("get session: %v", err)
+	}
+	if len(hist.Messages) != 6 || hist.Metadata.Description != "cli test" {
+		t.Errorf("expected every exchange in the session file, got %+v", hist)
+	}
+	list, err := c.ListSessions(ctx)
+	if err != nil || len(list.Sessions) != 1 || list.Sessions[0].ID != start.ID {
+		t.Errorf("expected the session listed, got %+v, %v", list, err)
+	}
+
+	if err := c.ConfirmTool(ctx, &ToolConfirmationRequest{SessionID: start.ID}); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("expected ErrUnsupported confirming a tool call, got %v", err)
+	}
+	if _, err := c.GetSession(ctx, "../"+start.ID); !IsNotFound(err) {
+		t.Errorf("expected a path outside the session dir to 404, got %v", err)
+	}
+	if err := c.DeleteSession(ctx, start.ID); err != nil {
+		t.Fatalf("delete session: %v", err)
+	}
+	if _, err := c.Reply(ctx, &ReplyRequest{SessionID: start.ID}); !IsNotFound(err) {
+		t.Errorf("expected a deleted session to 404, got %v", err)
+	}
+}
@@ -0,0 +1,47 @@
+package gooseclient
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// knownContentTypes are the MessageContent types its fields model.
+var knownContentTypes = map[string]bool{
+	"text":                    true,
+	"image":                   true,
+	"toolRequest":             true,
+	"toolResponse":            true,
+	"toolConfirmationRequest": true,
+	"thinking":                true,
+	"reasoning":               true,
+	"redactedThinking":        true,
+}
+
+// UnmarshalJSON decodes message content, keeping the raw JSON of content
+// types without modeled fields in Raw.
+func (c *MessageContent) UnmarshalJSON(data []byte) error {
+	type plain MessageContent
+	if err := json.Unmarshal(data, (*plain)(c)); err != nil {
+		return err
+	}
+	c.Raw = nil
+	if !knownContentTypes[c.Type] {
+		c.Raw = bytes.Clone(data)
+	}
+	return nil
+}
+
+// MarshalJSON encodes message content, sending Raw verbatim when set.
+func (c MessageContent) MarshalJSON() ([]byte, error) {
+	if len(c.Raw) > 0 {
+		return c.Raw, nil
+	}
+	type plain MessageContent
+	return json.Marshal(plain(c))
+}
+
+// PartialToolRequest reports whether c is a piece of a tool request Goose is
+// still streaming rather than a complete one.
+func (c *MessageContent) PartialToolRequest() bool {
+	return c.Type == "toolRequest" && c.ToolCall != nil && c.ToolCall.ArgumentsDelta != ""
+}
@@ -0,0 +1,73 @@
+package gooseclient
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/innomon/adk2goose/internal/metrics"
+)
+
+// statusProbeTimeout bounds the /status probe FailOver makes before moving
+// away from a server.
+const statusProbeTimeout = 2 * time.Second
+
+var failovers = metrics.NewCounterVec(
+	"goose_failovers_total",
+	"Switches between the primary and standby Goose servers, by the server switched to.",
+	"to")
+
+// WithStandby makes url a standby Goose server: FailOver moves the client's
+// requests to it when BaseURL stops answering, and back when the standby
+// does. Goose sessions do not move along; requests about them get 404s
+// from the other server.
+func WithStandby(url string) Option {
+	return func(c *Client) {
+		c.standby = strings.TrimRight(url, "/")
+	}
+}
+
+// Active returns the base URL of the server that requests a pool does not
+// route go to: BaseURL, or the standby after a failover.
+func (c *Client) Active() string {
+	if u := c.active.Load(); u != nil {
+		return *u
+	}
+	return c.BaseURL
+}
+
+// FailOver is called after a request to the server at from failed. If from
+// is still the active server and does not answer /status, the other of
+// BaseURL and the standby becomes active. It reports whether requests now
+// go elsewhere than from: false without a standby, or if from still
+// answers, so the failure was not the server's death.
+func (c *Client) FailOver(ctx context.Context, from string) bool {
+	if c.standby == "" {
+		return false
+	}
+	c.failMu.Lock()
+	defer c.failMu.Unlock()
+	if c.Active() != from {
+		// Another request already failed over.
+		return true
+	}
+	if c.alive(ctx, from) {
+		return false
+	}
+	to := c.standby
+	if from == c.standby {
+		to = c.BaseURL
+	}
+	c.active.Store(&to)
+	failovers.Inc(to)
+	go c.renegotiate(to)
+	return true
+}
+
+// alive reports whether the server at base answers /status.
+func (c *Client) alive(ctx context.Context, base string) bool {
+	ctx, cancel := context.WithTimeout(ctx, statusProbeTimeout)
+	defer cancel()
+	return c.doJSONAt(ctx, base, http.MethodGet, "/status", nil, nil) == nil
+}
@@ -0,0 +1,48 @@
+package gooseclient
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/innomon/adk2goose/internal/metrics"
+)
+
+var (
+	requestDuration = metrics.NewHistogramVec(
+		"goose_request_duration_seconds",
+		"Latency of Goose API requests until response headers arrive, by endpoint.",
+		nil, "method", "endpoint")
+	requestErrors = metrics.NewCounterVec(
+		"goose_request_errors_total",
+		"Goose API requests that failed, by endpoint and cause (transport or HTTP status).",
+		"method", "endpoint", "cause")
+	sseFirstEvent = metrics.NewHistogramVec(
+		"goose_sse_time_to_first_event_seconds",
+		"Time from sending a /reply request to receiving its first SSE event.",
+		nil)
+)
+
+// observeRequest records the latency of a request to path and, if it failed,
+// the cause. statusCode is 0 for transport errors.
+func observeRequest(method, path string, start time.Time, statusCode int, err error) {
+	endpoint := endpointLabel(path)
+	requestDuration.Observe(time.Since(start).Seconds(), method, endpoint)
+
+	switch {
+	case err != nil:
+		requestErrors.Inc(method, endpoint, "transport")
+	case statusCode < 200 || statusCode >= 300:
+		requestErrors.Inc(method, endpoint, strconv.Itoa(statusCode))
+	}
+}
+
+// endpointLabel collapses IDs in request paths and drops query strings so
+// each API endpoint maps to a single metric series.
+func endpointLabel(path string) string {
+	path, _, _ = strings.Cut(path, "?")
+	if strings.HasPrefix(path, "/sessions/") {
+		return "/sessions/{id}"
+	}
+	return path
+}
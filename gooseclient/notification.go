@@ -0,0 +1,27 @@
+package gooseclient
+
+import "encoding/json"
+
+// UnmarshalJSON decodes an SSE event, routing the "message" field to
+// Notification for Notification events and to Message otherwise.
+func (e *SSEEvent) UnmarshalJSON(data []byte) error {
+	type plain SSEEvent
+	var raw struct {
+		plain
+		Message json.RawMessage `json:"message,omitempty"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*e = SSEEvent(raw.plain)
+
+	if len(raw.Message) == 0 || string(raw.Message) == "null" {
+		return nil
+	}
+	if e.Type == "Notification" {
+		e.Notification = new(MCPNotification)
+		return json.Unmarshal(raw.Message, e.Notification)
+	}
+	e.Message = new(GooseMessage)
+	return json.Unmarshal(raw.Message, e.Message)
+}
@@ -0,0 +1,178 @@
+package gooseclient
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/innomon/adk2goose/internal/metrics"
+)
+
+// ErrPoolFull is returned when starting a session while every Goose server
+// in a Pool is at capacity or not ready.
+var ErrPoolFull = errors.New("every Goose server is at capacity")
+
+var poolSessions = metrics.NewGaugeVec(
+	"goose_pool_sessions",
+	"Goose sessions pinned to each server of the pool.",
+	"backend")
+
+// Backend is a Goose server in a Pool.
+type Backend struct {
+	// URL is the server's base URL.
+	URL string
+	// Capacity caps the sessions started on the server. Zero means no
+	// limit.
+	Capacity int
+	// Ready reports whether the server can take new sessions. Nil means
+	// always.
+	Ready func() bool
+}
+
+// BackendStats describes the load of a Goose server in a Pool.
+type BackendStats struct {
+	URL      string `json:"url"`
+	Sessions int    `json:"sessions"`
+	Capacity int    `json:"capacity,omitempty"`
+	Ready    bool   `json:"ready"`
+}
+
+// Pool spreads Goose sessions across several Goose servers. A session stays
+// on the server that started it, and new sessions go to the ready server
+// with the fewest sessions that is under its capacity, so one busy server
+// does not slow every session down. It is safe for concurrent use.
+type Pool struct {
+	backends []*poolBackend
+
+	mu       sync.Mutex
+	sessions map[string]*poolBackend // Goose session ID → its server
+	listed   map[string]string       // Goose session ID → URL of the server that last listed it
+}
+
+type poolBackend struct {
+	Backend
+	sessions int // sessions pinned or being started; guarded by Pool.mu
+}
+
+// NewPool returns a Pool of the given servers. It panics if there are none.
+func NewPool(backends ...Backend) *Pool {
+	if len(backends) == 0 {
+		panic("gooseclient: empty pool")
+	}
+	p := &Pool{sessions: make(map[string]*poolBackend)}
+	for _, b := range backends {
+		p.backends = append(p.backends, &poolBackend{Backend: b})
+		poolSessions.Add(0, b.URL)
+	}
+	return p
+}
+
+// Stats returns the load of each server, in pool order.
+func (p *Pool) Stats() []BackendStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	stats := make([]BackendStats, len(p.backends))
+	for i, b := range p.backends {
+		stats[i] = BackendStats{URL: b.URL, Sessions: b.sessions, Capacity: b.Capacity, Ready: b.ready()}
+	}
+	return stats
+}
+
+// acquire reserves a session slot on the least loaded ready server with
+// room. Pin a session to the slot, or free it with abandon.
+func (p *Pool) acquire() (*poolBackend, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var best *poolBackend
+	for _, b := range p.backends {
+		if !b.ready() || (b.Capacity > 0 && b.sessions >= b.Capacity) {
+			continue
+		}
+		if best == nil || b.sessions < best.sessions {
+			best = b
+		}
+	}
+	if best == nil {
+		return nil, ErrPoolFull
+	}
+	best.sessions++
+	poolSessions.Inc(best.URL)
+	return best, nil
+}
+
+// pin records that sessionID runs on b, in the slot acquired for it.
+func (p *Pool) pin(sessionID string, b *poolBackend) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if old, ok := p.sessions[sessionID]; ok {
+		// Goose resumed a session it already had: keep one slot.
+		p.release(old)
+	}
+	p.sessions[sessionID] = b
+}
+
+// unpin forgets sessionID, freeing its slot.
+func (p *Pool) unpin(sessionID string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if b, ok := p.sessions[sessionID]; ok {
+		delete(p.sessions, sessionID)
+		p.release(b)
+	}
+}
+
+// abandon frees a slot acquired for a session that did not start.
+func (p *Pool) abandon(b *poolBackend) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.release(b)
+}
+
+// release frees one of b's slots. p.mu must be held.
+func (p *Pool) release(b *poolBackend) {
+	b.sessions--
+	poolSessions.Dec(b.URL)
+}
+
+// lookup returns the base URL of the server sessionID runs on.
+func (p *Pool) lookup(sessionID string) (string, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	b, ok := p.sessions[sessionID]
+	if !ok {
+		return "", false
+	}
+	return b.URL, true
+}
+
+// locate returns the base URL of the server sessionID runs on, or, for a
+// session the pool did not start, of the server that last listed it.
+func (p *Pool) locate(sessionID string) (string, bool) {
+	if u, ok := p.lookup(sessionID); ok {
+		return u, true
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	u, ok := p.listed[sessionID]
+	return u, ok
+}
+
+// setListed records which server listed each session, replacing the
+// previous listing.
+func (p *Pool) setListed(listed map[string]string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.listed = listed
+}
+
+// urls returns the base URLs of every server.
+func (p *Pool) urls() []string {
+	urls := make([]string, len(p.backends))
+	for i, b := range p.backends {
+		urls[i] = b.URL
+	}
+	return urls
+}
+
+func (b *poolBackend) ready() bool {
+	return b.Ready == nil || b.Ready()
+}
@@ -0,0 +1,143 @@
+package gooseclient
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/innomon/adk2goose/internal/metrics"
+)
+
+// ErrClientClosed is returned by Reply once CloseStreams was called.
+var ErrClientClosed = errors.New("goose client closed")
+
+var (
+	replyStreams = metrics.NewGaugeVec(
+		"goose_reply_streams",
+		"Goose reply streams open, each read by a goroutine of its own.")
+	replyStreamDuration = metrics.NewHistogramVec(
+		"goose_reply_stream_duration_seconds",
+		"How long Goose reply streams stayed open, by how they ended (completed, cancelled, or idle_timeout).",
+		[]float64{1, 5, 15, 60, 300, 900, 3600}, "end")
+)
+
+// StreamInfo describes an open Goose reply stream.
+type StreamInfo struct {
+	ID        uint64    `json:"id"`
+	SessionID string    `json:"sessionId"`
+	Server    string    `json:"server"`
+	Started   time.Time `json:"started"`
+}
+
+// streamRegistry tracks the goroutines reading Goose reply streams, with
+// the cancel function of each, so they can be listed and none outlives
+// CloseStreams. The zero value is ready to use.
+type streamRegistry struct {
+	mu      sync.Mutex
+	seq     uint64
+	streams map[uint64]*replyStream
+	closed  bool
+	wg      sync.WaitGroup
+}
+
+type replyStream struct {
+	StreamInfo
+	cancel context.CancelFunc
+}
+
+// add registers a stream about to be opened, which cancel stops, and
+// returns its ID. It fails once the registry is closed.
+func (r *streamRegistry) add(sessionID, server string, cancel context.CancelFunc) (uint64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return 0, ErrClientClosed
+	}
+	if r.streams == nil {
+		r.streams = make(map[uint64]*replyStream)
+	}
+	r.seq++
+	r.streams[r.seq] = &replyStream{
+		StreamInfo: StreamInfo{ID: r.seq, SessionID: sessionID, Server: server, Started: time.Now()},
+		cancel:     cancel,
+	}
+	r.wg.Add(1)
+	replyStreams.Inc()
+	return r.seq, nil
+}
+
+// remove unregisters a stream that ended, recording how long it was open
+// and how it ended.
+func (r *streamRegistry) remove(id uint64, end string) {
+	r.mu.Lock()
+	s, ok := r.streams[id]
+	delete(r.streams, id)
+	r.mu.Unlock()
+	if !ok {
+		return
+	}
+	s.cancel()
+	replyStreamDuration.Observe(time.Since(s.Started).Seconds(), end)
+	replyStreams.Dec()
+	r.wg.Done()
+}
+
+// Streams returns the open Goose reply streams, oldest first.
+func (c *Client) Streams() []StreamInfo {
+	return c.streams.list()
+}
+
+// CloseStreams cancels every open reply stream and waits until their
+// goroutines have exited, or ctx is done. Reply fails afterwards, so it is
+// meant for shutdown.
+func (c *Client) CloseStreams(ctx context.Context) error {
+	return c.streams.close(ctx)
+}
+
+// list returns the open streams, oldest first.
+func (r *streamRegistry) list() []StreamInfo {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	infos := make([]StreamInfo, 0, len(r.streams))
+	for _, s := range r.streams {
+		infos = append(infos, s.StreamInfo)
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].ID < infos[j].ID })
+	return infos
+}
+
+// cancelSession cancels the open streams of a session.
+func (r *streamRegistry) cancelSession(sessionID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, s := range r.streams {
+		if s.SessionID == sessionID {
+			s.cancel()
+		}
+	}
+}
+
+// close cancels every open stream and refuses new ones, then waits until
+// their goroutines have exited, or ctx is done.
+func (r *streamRegistry) close(ctx context.Context) error {
+	r.mu.Lock()
+	r.closed = true
+	for _, s := range r.streams {
+		s.cancel()
+	}
+	r.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		r.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
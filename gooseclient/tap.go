@@ -0,0 +1,20 @@
+package gooseclient
+
+import (
+	"context"
+	"io"
+)
+
+type streamTapKey struct{}
+
+// WithStreamTap returns a context that makes Reply copy every raw line of the
+// Goose SSE stream, as received, to w. It is meant for debugging captures;
+// write errors are ignored.
+func WithStreamTap(ctx context.Context, w io.Writer) context.Context {
+	return context.WithValue(ctx, streamTapKey{}, w)
+}
+
+func streamTap(ctx context.Context) io.Writer {
+	w, _ := ctx.Value(streamTapKey{}).(io.Writer)
+	return w
+}
@@ -0,0 +1,109 @@
+package gooseclient
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strings"
+)
+
+// CorrelationIDHeader carries the correlation ID of a TraceContext.
+const CorrelationIDHeader = "X-Correlation-ID"
+
+// TraceContext is the W3C trace context, and a correlation ID, that Goose
+// requests made with a context carrying it are sent with, so a distributed
+// trace connects the proxy's clients to Goose.
+type TraceContext struct {
+	TraceParent   string `json:"traceparent"`
+	TraceState    string `json:"tracestate,omitempty"`
+	CorrelationID string `json:"correlationId,omitempty"`
+}
+
+type traceContextKey struct{}
+
+// WithTraceContext returns a context that makes every Goose request sent
+// with it carry tc: traceparent names tc's trace with a new span ID per
+// request, and tracestate and the correlation ID are passed on as is.
+func WithTraceContext(ctx context.Context, tc TraceContext) context.Context {
+	return context.WithValue(ctx, traceContextKey{}, tc)
+}
+
+// TraceContextFrom returns the trace context set on ctx with
+// WithTraceContext.
+func TraceContextFrom(ctx context.Context) (TraceContext, bool) {
+	tc, ok := ctx.Value(traceContextKey{}).(TraceContext)
+	return tc, ok
+}
+
+// NewTraceContext continues the trace of a valid traceparent, with a new
+// span ID, keeping its tracestate; otherwise it starts a new sampled trace
+// and drops tracestate, as W3C Trace Context requires. An empty
+// correlationID defaults to the trace ID.
+func NewTraceContext(traceparent, tracestate, correlationID string) TraceContext {
+	traceID, flags, ok := parseTraceParent(traceparent)
+	if !ok {
+		traceID, flags, tracestate = randomHex(16), "01", ""
+	}
+	if correlationID == "" {
+		correlationID = traceID
+	}
+	return TraceContext{
+		TraceParent:   formatTraceParent(traceID, flags),
+		TraceState:    tracestate,
+		CorrelationID: correlationID,
+	}
+}
+
+// setTraceHeaders adds the trace context of ctx, if any, to h, as a child
+// span of it.
+func setTraceHeaders(ctx context.Context, h http.Header) {
+	tc, ok := TraceContextFrom(ctx)
+	if !ok {
+		return
+	}
+	if traceID, flags, ok := parseTraceParent(tc.TraceParent); ok {
+		h.Set("traceparent", formatTraceParent(traceID, flags))
+		if tc.TraceState != "" {
+			h.Set("tracestate", tc.TraceState)
+		}
+	}
+	if tc.CorrelationID != "" {
+		h.Set(CorrelationIDHeader, tc.CorrelationID)
+	}
+}
+
+// parseTraceParent returns the trace ID and flags of a version 00
+// traceparent ("00-<trace-id>-<parent-id>-<flags>").
+func parseTraceParent(s string) (traceID, flags string, ok bool) {
+	parts := strings.Split(strings.TrimSpace(s), "-")
+	if len(parts) != 4 || parts[0] != "00" ||
+		!isHex(parts[1], 32) || !isHex(parts[2], 16) || !isHex(parts[3], 2) ||
+		strings.Trim(parts[1], "0") == "" || strings.Trim(parts[2], "0") == "" {
+		return "", "", false
+	}
+	return parts[1], parts[3], true
+}
+
+func formatTraceParent(traceID, flags string) string {
+	return "00-" + traceID + "-" + randomHex(8) + "-" + flags
+}
+
+// isHex reports whether s is n lowercase hex digits.
+func isHex(s string, n int) bool {
+	if len(s) != n {
+		return false
+	}
+	for _, c := range s {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
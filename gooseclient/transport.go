@@ -0,0 +1,94 @@
+package gooseclient
+
+import (
+	"net"
+	"net/http"
+	"time"
+)
+
+// TransportConfig tunes the HTTP transport used to reach Goose. Zero fields
+// keep the net/http defaults.
+type TransportConfig struct {
+	// MaxIdleConnsPerHost bounds the idle keep-alive connections kept to the
+	// Goose server. The net/http default of 2 forces constant reconnects when
+	// many SSE streams share one goosed instance.
+	MaxIdleConnsPerHost int
+	// DialTimeout limits how long establishing a TCP connection may take.
+	DialTimeout time.Duration
+	// TLSHandshakeTimeout limits the TLS handshake for https base URLs.
+	TLSHandshakeTimeout time.Duration
+	// ResponseHeaderTimeout limits the wait for response headers after the
+	// request is written. It does not bound how long an SSE body streams.
+	ResponseHeaderTimeout time.Duration
+	// KeepAlive is the idle time before TCP keepalive probes start on a
+	// Goose connection, and the interval between them; after 3 unanswered
+	// probes the connection is closed, so a peer that vanished, as behind
+	// a NAT that dropped the mapping, is noticed within 4 KeepAlive
+	// periods. Zero keeps the net/http default; negative disables probes.
+	KeepAlive time.Duration
+	// ReplyIdleTimeout ends a /reply stream that delivers no data,
+	// including SSE comments and pings, for this long: a read deadline
+	// refreshed per event. Zero disables it.
+	ReplyIdleTimeout time.Duration
+}
+
+// Option customizes a Client created by New.
+type Option func(*Client)
+
+// WithTransport configures the client's HTTP transport.
+func WithTransport(tc TransportConfig) Option {
+	return func(c *Client) {
+		c.HTTP.Transport = newTransport(tc)
+		c.replyIdleTimeout = tc.ReplyIdleTimeout
+	}
+}
+
+// WithPool spreads the client's sessions across the servers of p. Requests
+// not about a session, such as reading configuration, go to BaseURL.
+func WithPool(p *Pool) Option {
+	return func(c *Client) {
+		c.pool = p
+	}
+}
+
+// Pool returns the pool set with WithPool, or nil.
+func (c *Client) Pool() *Pool {
+	return c.pool
+}
+
+// newTransport builds an *http.Transport from the default transport with the
+// tuning in tc applied.
+func newTransport(tc TransportConfig) *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	if tc.MaxIdleConnsPerHost > 0 {
+		t.MaxIdleConnsPerHost = tc.MaxIdleConnsPerHost
+		if t.MaxIdleConns < tc.MaxIdleConnsPerHost {
+			t.MaxIdleConns = tc.MaxIdleConnsPerHost
+		}
+	}
+	if tc.DialTimeout > 0 || tc.KeepAlive != 0 {
+		dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+		if tc.DialTimeout > 0 {
+			dialer.Timeout = tc.DialTimeout
+		}
+		switch {
+		case tc.KeepAlive > 0:
+			dialer.KeepAliveConfig = net.KeepAliveConfig{
+				Enable:   true,
+				Idle:     tc.KeepAlive,
+				Interval: tc.KeepAlive,
+				Count:    3,
+			}
+		case tc.KeepAlive < 0:
+			dialer.KeepAlive = -1
+		}
+		t.DialContext = dialer.DialContext
+	}
+	if tc.TLSHandshakeTimeout > 0 {
+		t.TLSHandshakeTimeout = tc.TLSHandshakeTimeout
+	}
+	if tc.ResponseHeaderTimeout > 0 {
+		t.ResponseHeaderTimeout = tc.ResponseHeaderTimeout
+	}
+	return t
+}
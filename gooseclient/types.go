@@ -1,5 +1,7 @@
 package gooseclient
 
+import "encoding/json"
+
 // GooseMessage represents a message in a Goose conversation.
 type GooseMessage struct {
 	ID       string           `json:"id,omitempty"`
@@ -42,12 +44,22 @@ type MessageContent struct {
 	// Thinking / RedactedThinking
 	Thinking  string `json:"thinking,omitempty"`
 	Signature string `json:"signature,omitempty"`
+
+	// Raw holds the original JSON of content types this package does not
+	// model, such as those added by Goose extensions. When set, it is
+	// encoded verbatim in place of the fields above.
+	Raw json.RawMessage `json:"-"`
 }
 
-// ToolCall describes a tool invocation within a tool request.
+// ToolCall describes a tool invocation within a tool request. Goose may
+// stream a call as it forms: each piece repeats the request's ID and name
+// and carries the next fragment of the arguments' JSON text in
+// ArgumentsDelta, and the complete call follows with Arguments set and no
+// delta.
 type ToolCall struct {
-	Name      string         `json:"name"`
-	Arguments map[string]any `json:"arguments"`
+	Name           string         `json:"name"`
+	Arguments      map[string]any `json:"arguments"`
+	ArgumentsDelta string         `json:"arguments_delta,omitempty"`
 }
 
 // ToolResult carries the output of a tool execution.
@@ -66,6 +78,20 @@ type SSEEvent struct {
 	TokenState *TokenState   `json:"token_state,omitempty"`
 	Model      string        `json:"model,omitempty"`
 	Mode       string        `json:"mode,omitempty"`
+
+	// Notification events relay an MCP server notification for the tool
+	// request identified by RequestID. Goose sends the notification in the
+	// "message" field, so it is decoded by SSEEvent.UnmarshalJSON.
+	RequestID    string           `json:"request_id,omitempty"`
+	Notification *MCPNotification `json:"-"`
+}
+
+// MCPNotification is an MCP server notification, such as
+// notifications/progress or notifications/message, relayed by Goose while a
+// tool runs.
+type MCPNotification struct {
+	Method string         `json:"method"`
+	Params map[string]any `json:"params,omitempty"`
 }
 
 // TokenState tracks token usage for a streaming response.
@@ -82,6 +108,7 @@ type TokenState struct {
 type StartAgentRequest struct {
 	WorkingDir string `json:"working_dir"`
 	RecipeID   string `json:"recipe_id,omitempty"`
+	Name       string `json:"name,omitempty"`
 }
 
 // StartAgentResponse is the session object returned after starting an agent.
@@ -117,6 +144,7 @@ type SessionListResponse struct {
 // SessionInfo describes a single session in a listing.
 type SessionInfo struct {
 	ID       string           `json:"id"`
+	Name     string           `json:"name,omitempty"`
 	Path     string           `json:"path"`
 	Modified string           `json:"modified"`
 	Metadata *SessionMetadata `json:"metadata,omitempty"`
@@ -142,3 +170,66 @@ type ToolConfirmationRequest struct {
 	RequestID string `json:"request_id"`
 	Approved  bool   `json:"approved"`
 }
+
+// UpdateProviderRequest is the payload sent to change the model provider and
+// its request parameters for a session.
+type UpdateProviderRequest struct {
+	Provider      string         `json:"provider,omitempty"`
+	Model         string         `json:"model,omitempty"`
+	SessionID     string         `json:"session_id"`
+	RequestParams map[string]any `json:"request_params,omitempty"`
+}
+
+// ConfigResponse is the full Goose configuration, with secret values masked.
+type ConfigResponse struct {
+	Config map[string]any `json:"config"`
+}
+
+// ConfigKeyRequest is the payload sent to read a single configuration key.
+type ConfigKeyRequest struct {
+	Key      string `json:"key"`
+	IsSecret bool   `json:"is_secret"`
+}
+
+// UpsertConfigRequest is the payload sent to create or update a
+// configuration key. Secret keys are stored in Goose's secret store.
+type UpsertConfigRequest struct {
+	Key      string `json:"key"`
+	Value    any    `json:"value"`
+	IsSecret bool   `json:"is_secret"`
+}
+
+// ExtendPromptRequest is the payload sent to append text to a session's
+// system prompt.
+type ExtendPromptRequest struct {
+	Extension string `json:"extension"`
+	SessionID string `json:"session_id"`
+}
+
+// ToolInfo describes a tool available to a session's agent.
+type ToolInfo struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	// Parameters lists the tool's argument names.
+	Parameters []string `json:"parameters"`
+	// InputSchema is the tool's JSON schema, when Goose reports it.
+	InputSchema map[string]any `json:"input_schema,omitempty"`
+	Permission  string         `json:"permission,omitempty"`
+}
+
+// ToolResultRequest is the payload sent to deliver the result of a tool call
+// executed outside Goose to the session's waiting agent.
+type ToolResultRequest struct {
+	ID        string      `json:"id"`
+	Result    *ToolResult `json:"result"`
+	SessionID string      `json:"session_id"`
+}
+
+// SystemInfo describes the Goose server, as reported by its /system_info
+// endpoint.
+type SystemInfo struct {
+	AppVersion   string `json:"app_version"`
+	OS           string `json:"os,omitempty"`
+	OSVersion    string `json:"os_version,omitempty"`
+	Architecture string `json:"architecture,omitempty"`
+}
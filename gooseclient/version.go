@@ -0,0 +1,200 @@
+package gooseclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MinVersion is the oldest Goose release the client supports: the first
+// with the agent session API (/agent/start, /agent/resume, /agent/stop).
+const MinVersion = "1.8.0"
+
+// accumulatedTokensVersion is the first Goose release whose Finish events
+// carry the session's accumulated token counts. The client fills them in
+// for older releases.
+const accumulatedTokensVersion = "1.10.0"
+
+// ErrUnsupportedVersion is returned by Negotiate for a Goose server older
+// than MinVersion.
+var ErrUnsupportedVersion = errors.New("unsupported Goose version")
+
+// ServerVersion is the release of a Goose server, as probed by Negotiate.
+type ServerVersion struct {
+	URL string `json:"url"`
+	// Version is the release the server reports, or empty if it predates
+	// the /system_info endpoint.
+	Version  string    `json:"version,omitempty"`
+	ProbedAt time.Time `json:"probedAt"`
+	// Legacy lists the older response shapes the client adapts for this
+	// server.
+	Legacy []string `json:"legacy,omitempty"`
+
+	release semver
+	known   bool
+}
+
+// before reports whether the server is a release older than v. A server
+// that does not report its version counts as older than any.
+func (v *ServerVersion) before(release string) bool {
+	if !v.known {
+		return true
+	}
+	r, _ := parseSemver(release)
+	return v.release.less(r)
+}
+
+// versions holds what the client learned of each server's release.
+type versions struct {
+	mu      sync.Mutex
+	servers map[string]*ServerVersion
+	// tokens sums the token counts of each Goose session on servers that
+	// do not accumulate them.
+	tokens map[string]TokenState
+}
+
+// Negotiate probes the release of every Goose server the client uses,
+// remembering it to adapt to older response shapes. It fails with
+// ErrUnsupportedVersion if a server is older than MinVersion, or with the
+// probe's error if one cannot be reached. Servers that do not report their
+// version are assumed to need every adaptation.
+func (c *Client) Negotiate(ctx context.Context) error {
+	var errs []error
+	for _, base := range c.servers() {
+		if _, err := c.negotiate(ctx, base); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ProbeVersion probes the release of the active server, as Negotiate does.
+func (c *Client) ProbeVersion(ctx context.Context) (*ServerVersion, error) {
+	return c.negotiate(ctx, c.Active())
+}
+
+// negotiate probes the release of the server at base.
+func (c *Client) negotiate(ctx context.Context, base string) (*ServerVersion, error) {
+	v := &ServerVersion{URL: base, ProbedAt: time.Now()}
+	var info SystemInfo
+	err := c.doJSONAt(ctx, base, http.MethodGet, "/system_info", nil, &info)
+	switch {
+	case IsNotFound(err):
+	case err != nil:
+		return nil, fmt.Errorf("probe goose version at %s: %w", base, err)
+	default:
+		v.Version = info.AppVersion
+		v.release, v.known = parseSemver(info.AppVersion)
+	}
+	if v.known && v.before(MinVersion) {
+		return nil, fmt.Errorf("goose %s at %s is older than %s: %w", v.Version, base, MinVersion, ErrUnsupportedVersion)
+	}
+	if v.before(accumulatedTokensVersion) {
+		v.Legacy = append(v.Legacy, "accumulated_tokens")
+	}
+
+	c.versions.mu.Lock()
+	if c.versions.servers == nil {
+		c.versions.servers = make(map[string]*ServerVersion)
+	}
+	c.versions.servers[base] = v
+	c.versions.mu.Unlock()
+	return v, nil
+}
+
+// renegotiate probes the server at base again after the client switched
+// to it, logging rather than failing: requests already go there.
+func (c *Client) renegotiate(base string) {
+	ctx, cancel := context.WithTimeout(context.Background(), statusProbeTimeout)
+	defer cancel()
+	if v, err := c.negotiate(ctx, base); err != nil {
+		log.Printf("goose version: %v", err)
+	} else if v.Version != "" {
+		log.Printf("goose %s at %s", v.Version, base)
+	}
+}
+
+// ServerVersion returns what Negotiate learned of the active server's
+// release, or nil if it was not probed.
+func (c *Client) ServerVersion() *ServerVersion {
+	return c.serverVersion(c.Active())
+}
+
+func (c *Client) serverVersion(base string) *ServerVersion {
+	c.versions.mu.Lock()
+	defer c.versions.mu.Unlock()
+	return c.versions.servers[base]
+}
+
+// adaptEvent rewrites an event of the server at base in the shape current
+// releases send.
+func (c *Client) adaptEvent(base, sessionID string, evt *SSEEvent) {
+	ts := evt.TokenState
+	if evt.Type != "Finish" || ts == nil || ts.AccumulatedTotalTokens > 0 {
+		return
+	}
+	v := c.serverVersion(base)
+	if v == nil || !v.before(accumulatedTokensVersion) {
+		return
+	}
+	c.versions.mu.Lock()
+	defer c.versions.mu.Unlock()
+	if c.versions.tokens == nil {
+		c.versions.tokens = make(map[string]TokenState)
+	}
+	sum := c.versions.tokens[sessionID]
+	sum.AccumulatedInputTokens += ts.InputTokens
+	sum.AccumulatedOutputTokens += ts.OutputTokens
+	sum.AccumulatedTotalTokens += ts.TotalTokens
+	c.versions.tokens[sessionID] = sum
+	ts.AccumulatedInputTokens = sum.AccumulatedInputTokens
+	ts.AccumulatedOutputTokens = sum.AccumulatedOutputTokens
+	ts.AccumulatedTotalTokens = sum.AccumulatedTotalTokens
+}
+
+// forgetSession drops the token counts kept for a deleted session.
+func (c *Client) forgetSession(sessionID string) {
+	c.versions.mu.Lock()
+	delete(c.versions.tokens, sessionID)
+	c.versions.mu.Unlock()
+}
+
+// semver is a major.minor.patch release number.
+type semver [3]int
+
+// parseSemver parses versions such as "1.9.0", "v1.10", or "1.9.0-rc.1",
+// ignoring any pre-release or build suffix.
+func parseSemver(s string) (semver, bool) {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "v")
+	if i := strings.IndexAny(s, "-+ "); i >= 0 {
+		s = s[:i]
+	}
+	fields := strings.Split(s, ".")
+	if len(fields) > 3 {
+		return semver{}, false
+	}
+	var v semver
+	for i, f := range fields {
+		n, err := strconv.Atoi(f)
+		if err != nil || n < 0 {
+			return semver{}, false
+		}
+		v[i] = n
+	}
+	return v, true
+}
+
+func (v semver) less(o semver) bool {
+	for i := range v {
+		if v[i] != o[i] {
+			return v[i] < o[i]
+		}
+	}
+	return false
+}
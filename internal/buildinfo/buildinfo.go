@@ -0,0 +1,75 @@
+// Package buildinfo identifies the running build of the proxy.
+//
+// Release builds set the version, commit, and date with the linker:
+//
+//	go build -ldflags "-X github.com/innomon/adk2goose/internal/buildinfo.Version=v1.4.0 \
+//	  -X github.com/innomon/adk2goose/internal/buildinfo.Commit=$(git rev-parse HEAD) \
+//	  -X github.com/innomon/adk2goose/internal/buildinfo.Date=$(date -u +%Y-%m-%dT%H:%M:%SZ)" ./cmd/proxy
+//
+// Otherwise they fall back to what the Go toolchain records: the module
+// version for go install builds, and the VCS revision and commit time for
+// builds in a checkout.
+package buildinfo
+
+import (
+	"runtime"
+	"runtime/debug"
+	"sync"
+)
+
+// Set with -ldflags "-X".
+var (
+	Version string
+	Commit  string
+	Date    string
+)
+
+// Info describes a build.
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	Date      string `json:"buildDate,omitempty"`
+	Modified  bool   `json:"modified,omitempty"`
+	GoVersion string `json:"goVersion"`
+}
+
+var (
+	once sync.Once
+	info Info
+)
+
+// Get returns the running build's information. The version is "dev" when
+// neither the linker nor the toolchain recorded one.
+func Get() Info {
+	once.Do(func() {
+		info = Info{Version: Version, Commit: Commit, Date: Date, GoVersion: runtime.Version()}
+		if bi, ok := debug.ReadBuildInfo(); ok {
+			info.fill(bi)
+		}
+		if info.Version == "" {
+			info.Version = "dev"
+		}
+	})
+	return info
+}
+
+// fill sets the fields the linker did not from the toolchain's record.
+func (i *Info) fill(bi *debug.BuildInfo) {
+	if v := bi.Main.Version; i.Version == "" && v != "" && v != "(devel)" {
+		i.Version = v
+	}
+	for _, s := range bi.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			if i.Commit == "" {
+				i.Commit = s.Value
+			}
+		case "vcs.time":
+			if i.Date == "" {
+				i.Date = s.Value
+			}
+		case "vcs.modified":
+			i.Modified = s.Value == "true"
+		}
+	}
+}
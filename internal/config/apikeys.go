@@ -0,0 +1,131 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Roles an API key grants its client application.
+const (
+	// APIKeyRoleUser acts as the single user the key names.
+	APIKeyRoleUser = "user"
+	// APIKeyRoleService acts on behalf of any user, as a trusted backend.
+	APIKeyRoleService = "service"
+	// APIKeyRoleAdmin is a service key that may also use the admin routes.
+	APIKeyRoleAdmin = "admin"
+)
+
+// APIKey is a named credential of a client application, read from the API
+// keys file. Several keys may share a role and user, so that a new key can
+// be rolled out before the one it replaces expires or is revoked.
+type APIKey struct {
+	// Name identifies the key in logs, metrics, and the admin listing.
+	Name string `json:"name"`
+	// Key is the secret clients present. SHA256 is the hex SHA-256 digest
+	// of the secret, for files that should not hold it; exactly one of the
+	// two must be set.
+	Key    string `json:"key,omitempty"`
+	SHA256 string `json:"sha256,omitempty"`
+	// Role is APIKeyRoleUser, the default, APIKeyRoleService, or
+	// APIKeyRoleAdmin.
+	Role string `json:"role,omitempty"`
+	// User is the user a user key acts as.
+	User string `json:"user,omitempty"`
+	// ExpiresAt, when set, is when the key stops being accepted.
+	ExpiresAt time.Time `json:"expiresAt,omitzero"`
+	// Revoked keys are refused, but stay listed.
+	Revoked bool `json:"revoked,omitempty"`
+
+	digest [sha256.Size]byte
+}
+
+// Digest returns the SHA-256 digest of the key's secret.
+func (k *APIKey) Digest() [sha256.Size]byte {
+	return k.digest
+}
+
+// Expired reports whether the key has expired by now.
+func (k *APIKey) Expired(now time.Time) bool {
+	return !k.ExpiresAt.IsZero() && !now.Before(k.ExpiresAt)
+}
+
+func (k *APIKey) validate() error {
+	if k.Name == "" {
+		return fmt.Errorf("api key requires a name")
+	}
+	switch {
+	case k.Key != "" && k.SHA256 == "":
+		k.digest = sha256.Sum256([]byte(k.Key))
+	case k.Key == "" && k.SHA256 != "":
+		b, err := hex.DecodeString(k.SHA256)
+		if err != nil || len(b) != sha256.Size {
+			return fmt.Errorf("api key %s: sha256 must be 64 hex digits", k.Name)
+		}
+		copy(k.digest[:], b)
+	default:
+		return fmt.Errorf("api key %s: exactly one of key and sha256 is required", k.Name)
+	}
+	if k.Role == "" {
+		k.Role = APIKeyRoleUser
+	}
+	switch k.Role {
+	case APIKeyRoleUser:
+		if k.User == "" {
+			return fmt.Errorf("api key %s: role %q requires a user", k.Name, k.Role)
+		}
+	case APIKeyRoleService, APIKeyRoleAdmin:
+	default:
+		return fmt.Errorf("api key %s: role %q must be %q, %q, or %q", k.Name, k.Role, APIKeyRoleUser, APIKeyRoleService, APIKeyRoleAdmin)
+	}
+	return nil
+}
+
+// LoadAPIKeys reads and validates the API keys file, a JSON object with a
+// "keys" array. Names and secrets must be unique.
+func LoadAPIKeys(file string) ([]APIKey, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("read api keys: %w", err)
+	}
+	var f struct {
+		Keys []APIKey `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("parse api keys %s: %w", file, err)
+	}
+	names := make(map[string]bool, len(f.Keys))
+	digests := make(map[[sha256.Size]byte]bool, len(f.Keys))
+	for i := range f.Keys {
+		k := &f.Keys[i]
+		if err := k.validate(); err != nil {
+			return nil, err
+		}
+		if names[k.Name] {
+			return nil, fmt.Errorf("api key %s is defined twice", k.Name)
+		}
+		if digests[k.digest] {
+			return nil, fmt.Errorf("api key %s reuses another key's secret", k.Name)
+		}
+		names[k.Name] = true
+		digests[k.digest] = true
+	}
+	return f.Keys, nil
+}
+
+// AdminCredentials reports whether the admin routes can authenticate their
+// callers: with ADMIN_TOKEN, or an admin key of API_KEYS_FILE.
+func (c *Config) AdminCredentials() bool {
+	if c.AdminToken != "" {
+		return true
+	}
+	for _, k := range c.APIKeys {
+		if k.Role == APIKeyRoleAdmin {
+			return true
+		}
+	}
+	return false
+}
@@ -1,38 +1,895 @@
 package config
 
 import (
+	"fmt"
 	"os"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
+
+	"github.com/innomon/adk2goose/gooseclient"
+	"github.com/innomon/adk2goose/internal/cron"
+	"github.com/innomon/adk2goose/internal/features"
+	"github.com/innomon/adk2goose/internal/policy"
+	"github.com/innomon/adk2goose/internal/transform"
 )
 
 type Config struct {
 	GooseBaseURL   string
 	GooseSecret    string
+	GooseProvider  string
+	GooseModel     string
 	ListenAddr     string
 	WorkingDir     string
 	RequestTimeout time.Duration
+
+	// Profile names the CONFIG_FILE profile the configuration was loaded
+	// as, if any.
+	Profile string
+
+	// WorkingDirIsolation gives each user of an app, or each session, a
+	// private subdirectory of WorkingDir to start its Goose agents in:
+	// WorkingDirShared, WorkingDirIsolationUser, or
+	// WorkingDirIsolationSession.
+	WorkingDirIsolation string
+
+	// GooseSecret, TLSCert, and TLSKey may be secret manager references
+	// (see package secrets) rather than the secrets themselves; referenced
+	// ones are read again every SecretsRefreshInterval. TLSCert and TLSKey,
+	// a PEM certificate chain and private key, serve the listeners over
+	// TLS.
+	TLSCert                string
+	TLSKey                 string
+	SecretsRefreshInterval time.Duration
+
+	// GooseStandbyURL, when set, names a standby Goose server that turns
+	// move to, rebuilding their conversation, when the active one dies.
+	GooseStandbyURL string
+
+	// GooseTransport tunes the HTTP connections to Goose.
+	GooseTransport gooseclient.TransportConfig
+
+	// Goosed, when its Binary is set, has the proxy launch and supervise a
+	// local goosed and send Goose requests to it instead of GooseBaseURL.
+	Goosed GoosedConfig
+
+	// GooseCLI, when its Binary is set, has the proxy run turns through the
+	// goose command line instead of a goosed.
+	GooseCLI GooseCLIConfig
+
+	// SlowTurnThreshold and SlowTurnTokens trigger a warning log for turns
+	// that take longer or consume more tokens. Zero disables each check.
+	SlowTurnThreshold time.Duration
+	SlowTurnTokens    int
+
+	// MaxConcurrentStreams caps simultaneously open run_sse streams; zero
+	// means unlimited. Requests over the cap wait up to StreamQueueTimeout
+	// for a slot before being rejected with 503.
+	MaxConcurrentStreams int
+	StreamQueueTimeout   time.Duration
+
+	// RunWorkers caps how many turns queued through the async runs route
+	// execute at once; the rest wait in the queue. Zero means unlimited.
+	RunWorkers int
+
+	// StreamStallTimeout abandons a turn when Goose sends no SSE event
+	// (including pings) for this long. Zero disables stall detection.
+	StreamStallTimeout time.Duration
+
+	// SSEGzip compresses run_sse responses for clients that send
+	// Accept-Encoding: gzip. Off by default because some SSE consumers
+	// mishandle compressed streams.
+	SSEGzip bool
+
+	// SSEMaxEventBytes caps the encoded size of one event in a run_sse
+	// stream, for clients whose SSE parsers limit line length. Larger
+	// events are replaced by an EVENT_TOO_LARGE error event. Zero disables
+	// the limit.
+	SSEMaxEventBytes int
+
+	// DebugCaptureDir, when set, receives per-invocation captures of each
+	// turn's raw ADK request, raw Goose SSE stream, and emitted ADK events,
+	// with credentials redacted. Each file stops at DebugCaptureMaxBytes.
+	DebugCaptureDir      string
+	DebugCaptureMaxBytes int
+
+	// InlineDataOffloadBytes is the size above which inlineData parts of
+	// ADK messages are written to the working directory and passed to Goose
+	// as a file reference instead of inline base64. Zero disables offloading.
+	InlineDataOffloadBytes int
+
+	// UploadMaxBytes caps the size of fileData attachments downloaded into
+	// the working directory's uploads folder.
+	UploadMaxBytes int
+
+	// UploadFetchHosts are the hosts fileData attachments are downloaded
+	// from; "*.example.com" allows its subdomains. Without any, fileData
+	// URIs are only passed on to Goose.
+	UploadFetchHosts []string
+
+	// RunCallbackHosts are the hosts async runs may POST their results to,
+	// as for UploadFetchHosts; without any, callbackUrl is refused.
+	// RunCallbackSecret, when set, signs each callback with an HMAC-SHA256
+	// of its body, like lifecycle webhooks.
+	RunCallbackHosts  []string
+	RunCallbackSecret string
+
+	// PushOriginHosts are the hosts, besides the proxy's own, of the web
+	// pages browsers may open push channel WebSockets from, as for
+	// UploadFetchHosts.
+	PushOriginHosts []string
+
+	// WorkingDirArtifacts saves files created or modified in the working
+	// directory during a turn as session artifacts. It needs private working
+	// directories, or one session would collect another's files.
+	WorkingDirArtifacts bool
+
+	// ToolResultMaxBytes truncates tool results in the ADK stream to this
+	// many bytes, saving the full output as a session artifact. Zero
+	// disables truncation.
+	ToolResultMaxBytes int
+
+	// AuthUserHeader names a request header, set by an authenticating
+	// gateway, that carries the caller's identity. When set, ADK requests
+	// must carry it and may only address the sessions of the user it names.
+	AuthUserHeader string
+
+	// APIKeysFile, when set, names a JSON file of client API keys (see
+	// APIKey), which ADK requests must then present and admin keys may use
+	// on the admin routes. It is read again every APIKeysReloadInterval, so
+	// keys can be rotated and revoked without a restart. APIKeys holds the
+	// keys read at startup.
+	APIKeysFile           string
+	APIKeysReloadInterval time.Duration
+	APIKeys               []APIKey
+
+	// AdminListenAddr, when set, moves /admin, /metrics, and /debug off
+	// ListenAddr onto a separate listener. AdminToken, when set, is the
+	// bearer token those routes require, wherever they are served.
+	AdminListenAddr string
+	AdminToken      string
+
+	// EventStoreDir, when set, persists each session's ADK events as JSON
+	// Lines files under this directory instead of in memory.
+	EventStoreDir string
+
+	// EventSinkURL, when set, names a broker (nats://host:port, or a Kafka
+	// REST Proxy at kafka+http(s)://host:port) every ADK event is mirrored
+	// to, on EventSinkTopic. EventSinkFormat is EventSinkEnvelope or
+	// EventSinkEvent.
+	EventSinkURL    string
+	EventSinkTopic  string
+	EventSinkFormat string
+
+	// SentryDSN, when set, names a Sentry (or compatible) project that
+	// handler panics, translation failures, and repeated Goose errors are
+	// reported to, tagged with SentryEnvironment if set.
+	SentryDSN         string
+	SentryEnvironment string
+
+	// SessionHealthInterval is how often the Goose sessions of mapped
+	// sessions are checked, recovering those Goose has lost before a turn
+	// runs into it. Zero disables the checks.
+	SessionHealthInterval time.Duration
+
+	// GooseSessionPrefix starts the name of every Goose session the proxy
+	// starts, marking it as the proxy's. OrphanGCInterval is how often
+	// Goose sessions with that prefix but no mapped ADK session are
+	// stopped and deleted. Zero disables the collection.
+	GooseSessionPrefix string
+	OrphanGCInterval   time.Duration
+
+	// Retention bounds how long sessions, event logs, artifacts, and debug
+	// captures are kept.
+	Retention Retention
+
+	// Apps holds per-app settings keyed by ADK app name, loaded from the
+	// optional JSON file named by CONFIG_FILE.
+	Apps map[string]AppConfig
+
+	// Priorities maps principals to priority classes (PriorityHigh,
+	// PriorityNormal, or PriorityLow) that order their requests when they
+	// queue for stream slots. Principals not listed are normal. Loaded from
+	// CONFIG_FILE.
+	Priorities map[string]string
+
+	// Prices maps Goose model names to their token prices, for estimating
+	// the cost of turns and sessions. The "*" entry prices models not
+	// listed. Loaded from CONFIG_FILE.
+	Prices map[string]ModelPrice
+
+	// Budgets fire alert webhooks as users' or apps' accumulated usage
+	// crosses fractions of a limit. Loaded from CONFIG_FILE.
+	Budgets []Budget
+
+	// Webhooks receive session and turn lifecycle events. Loaded from
+	// CONFIG_FILE.
+	Webhooks []Webhook
+
+	// ToolResultRules reshape matching tools' results before they are
+	// surfaced as FunctionResponse payloads, loaded from the optional JSON
+	// file named by TOOL_RESULT_RULES_FILE.
+	ToolResultRules []transform.Rule
+
+	// Features turns experimental behaviors on or off: CONFIG_FILE's
+	// "features" object, overridden by FEATURE_FLAGS.
+	Features features.Set
+}
+
+// Retention limits, enforced by a background janitor every Interval. Zero
+// disables each limit.
+type Retention struct {
+	Interval time.Duration
+	// SessionMaxAge deletes sessions idle for longer, and SessionMaxCount
+	// the least recently used of a user's sessions in an app beyond it.
+	SessionMaxAge   time.Duration
+	SessionMaxCount int
+	// EventLogMaxAge deletes the event logs of sessions that are no longer
+	// mapped, such as those left by a restart, once unchanged for longer.
+	EventLogMaxAge time.Duration
+	// ArtifactMaxAge deletes artifact versions saved longer ago, and
+	// ArtifactMaxVersions the oldest versions of an artifact beyond it.
+	ArtifactMaxAge      time.Duration
+	ArtifactMaxVersions int
+	// DebugCaptureMaxAge and DebugCaptureMaxCount delete the oldest turn
+	// captures under DebugCaptureDir.
+	DebugCaptureMaxAge   time.Duration
+	DebugCaptureMaxCount int
+}
+
+// Enabled reports whether any retention limit is set.
+func (r Retention) Enabled() bool {
+	return r.SessionMaxAge > 0 || r.SessionMaxCount > 0 || r.EventLogMaxAge > 0 ||
+		r.ArtifactMaxAge > 0 || r.ArtifactMaxVersions > 0 || r.DebugCaptureMaxAge > 0 || r.DebugCaptureMaxCount > 0
+}
+
+// AppConfig holds settings that apply to a single ADK app.
+type AppConfig struct {
+	ToolPolicy    policy.ToolPolicy     `json:"toolPolicy"`
+	ArgumentRules []policy.ArgumentRule `json:"argumentRules,omitempty"`
+	Approval      policy.ApprovalPolicy `json:"approval"`
+	// StripThoughts drops thinking/reasoning parts from the ADK stream, for
+	// apps whose clients are end users rather than developers.
+	StripThoughts bool `json:"stripThoughts,omitempty"`
+	// FinalOnly streams only each turn's consolidated final response and
+	// its turn-complete event, for chat UIs that render nothing else.
+	FinalOnly bool `json:"finalOnly,omitempty"`
+	// Author is the author name set on the app's ADK events. It defaults to
+	// the ADK app name, which multi-agent clients key their behavior off.
+	Author string `json:"author,omitempty"`
+	// Images downscales and re-encodes inlineData images before they are
+	// sent to Goose.
+	Images ImageConfig `json:"images,omitempty"`
+	// Instructions are standing instructions (coding standards, a persona)
+	// appended to the system prompt of every Goose agent started for the
+	// app.
+	Instructions string `json:"instructions,omitempty"`
+	// StateRules copy fields of Goose tools' structured results into the
+	// stateDelta of the ADK events carrying them.
+	StateRules []StateRule `json:"stateRules,omitempty"`
+	// Schedules inject prompts into the app's sessions on cron schedules,
+	// for agents such as daily standups that run without a client.
+	Schedules []Schedule `json:"schedules,omitempty"`
+	// OnDisconnect is what happens to a running turn once every client
+	// streaming it has disconnected: DisconnectCancel (the default) ends
+	// it, DisconnectContinue lets it finish in the background.
+	OnDisconnect string `json:"onDisconnect,omitempty"`
+
+	// Agents configures the app as a multi-agent tree: each named sub-agent
+	// runs in its own Goose session started from its recipe. Runs select an
+	// agent by name or ADK branch, falling back to DefaultAgent; with no
+	// selection they go to the root Goose session.
+	Agents       map[string]AgentConfig `json:"agents,omitempty"`
+	DefaultAgent string                 `json:"defaultAgent,omitempty"`
+}
+
+// What happens to a turn whose clients have all disconnected.
+const (
+	DisconnectCancel   = "cancel"
+	DisconnectContinue = "continue"
+)
+
+// ContinueOnDisconnect reports whether the app's turns keep running after
+// their clients disconnect.
+func (a AppConfig) ContinueOnDisconnect() bool {
+	return a.OnDisconnect == DisconnectContinue
+}
+
+// EventAuthor returns the author for ADK events of the app named app.
+func (a AppConfig) EventAuthor(app string) string {
+	if a.Author != "" {
+		return a.Author
+	}
+	return app
+}
+
+// ImageConfig limits the images an app forwards to Goose. The zero value
+// forwards images unchanged.
+type ImageConfig struct {
+	// MaxWidth and MaxHeight bound image dimensions in pixels; larger images
+	// are scaled down to fit, keeping their aspect ratio. Zero means no limit.
+	MaxWidth  int `json:"maxWidth,omitempty"`
+	MaxHeight int `json:"maxHeight,omitempty"`
+	// JPEGQuality, when set (1-100), re-encodes images as JPEG at that
+	// quality whenever that makes them smaller.
+	JPEGQuality int `json:"jpegQuality,omitempty"`
+}
+
+// Enabled reports whether any image processing is configured.
+func (c ImageConfig) Enabled() bool {
+	return c.MaxWidth > 0 || c.MaxHeight > 0 || c.JPEGQuality > 0
+}
+
+func (c ImageConfig) validate() error {
+	if c.MaxWidth < 0 || c.MaxHeight < 0 {
+		return fmt.Errorf("images: max dimensions must not be negative")
+	}
+	if c.JPEGQuality < 0 || c.JPEGQuality > 100 {
+		return fmt.Errorf("images: jpegQuality must be between 1 and 100")
+	}
+	return nil
+}
+
+// StateRule copies one field of a Goose tool's structured_content result
+// into ADK session state.
+type StateRule struct {
+	// Tool is a path.Match pattern selecting the tools the rule applies to.
+	Tool string `json:"tool"`
+	// Field is the dot-separated path of the value in structured_content,
+	// e.g. "repo.defaultBranch".
+	Field string `json:"field"`
+	// Key is the state key to set, which may carry an app:, user:, or temp:
+	// prefix. It defaults to Field.
+	Key string `json:"key,omitempty"`
+}
+
+// StateKey returns the state key the rule sets.
+func (r StateRule) StateKey() string {
+	if r.Key != "" {
+		return r.Key
+	}
+	return r.Field
+}
+
+func (r StateRule) validate() error {
+	if r.Tool == "" || r.Field == "" {
+		return fmt.Errorf("state rule requires both tool and field")
+	}
+	if _, err := path.Match(r.Tool, ""); err != nil {
+		return fmt.Errorf("state rule tool pattern %q: %w", r.Tool, err)
+	}
+	return nil
 }
 
+// Schedule runs a turn with Prompt in a session on a cron schedule. The
+// session is created on the first run if it does not exist.
+type Schedule struct {
+	// Cron is a five-field cron spec (minute hour day-of-month month
+	// day-of-week) or a shorthand such as @daily, in the proxy's local time.
+	Cron    string `json:"cron"`
+	User    string `json:"user"`
+	Session string `json:"session"`
+	Prompt  string `json:"prompt"`
+
+	spec *cron.Schedule
+}
+
+// Compile validates the schedule and parses its cron spec.
+func (s *Schedule) Compile() error {
+	if s.User == "" || s.Session == "" || s.Prompt == "" {
+		return fmt.Errorf("schedule requires user, session, and prompt")
+	}
+	spec, err := cron.Parse(s.Cron)
+	if err != nil {
+		return fmt.Errorf("schedule for session %s: %w", s.Session, err)
+	}
+	s.spec = spec
+	return nil
+}
+
+// Next returns the first time after t the schedule fires, or the zero time
+// if it never does. The schedule must have been compiled.
+func (s *Schedule) Next(t time.Time) time.Time {
+	return s.spec.Next(t)
+}
+
+// AgentConfig describes one sub-agent of a multi-agent app.
+type AgentConfig struct {
+	RecipeID string `json:"recipeId"`
+}
+
+// fileConfig is the on-disk shape of CONFIG_FILE.
+type fileConfig struct {
+	fileSections
+	Profiles map[string]Profile `json:"profiles"`
+}
+
+// Serializations of events mirrored to the event sink.
+const (
+	// EventSinkEnvelope wraps each event with its app, user, and session.
+	EventSinkEnvelope = "envelope"
+	// EventSinkEvent sends the bare ADK event, keyed by its session.
+	EventSinkEvent = "event"
+)
+
+// Working directory isolation modes.
+const (
+	// WorkingDirShared starts every Goose agent in WorkingDir.
+	WorkingDirShared = "none"
+	// WorkingDirIsolationUser gives each user of an app a directory.
+	WorkingDirIsolationUser = "user"
+	// WorkingDirIsolationSession gives each session a directory, inside
+	// its user's.
+	WorkingDirIsolationSession = "session"
+)
+
+// Lifecycle events delivered to webhooks.
+const (
+	WebhookSessionCreated = "session.created"
+	WebhookTurnCompleted  = "turn.completed"
+	WebhookToolDenied     = "tool.denied"
+	WebhookError          = "error"
+
+	WebhookSessionRecovered = "session.recovered"
+	WebhookSessionLost      = "session.lost"
+)
+
+// Webhook is an endpoint lifecycle events are POSTed to.
+type Webhook struct {
+	URL string `json:"url"`
+	// Events selects the lifecycle events to deliver; empty delivers all.
+	Events []string `json:"events,omitempty"`
+	// Secret, when set, signs each delivery with an HMAC-SHA256 of its
+	// body.
+	Secret string `json:"secret,omitempty"`
+}
+
+// Wants reports whether the webhook subscribes to event.
+func (w Webhook) Wants(event string) bool {
+	return len(w.Events) == 0 || slices.Contains(w.Events, event)
+}
+
+func (w Webhook) validate() error {
+	if w.URL == "" {
+		return fmt.Errorf("webhook requires a url")
+	}
+	for _, event := range w.Events {
+		switch event {
+		case WebhookSessionCreated, WebhookTurnCompleted, WebhookToolDenied, WebhookError,
+			WebhookSessionRecovered, WebhookSessionLost:
+		default:
+			return fmt.Errorf("webhook %s: unknown event %q", w.URL, event)
+		}
+	}
+	return nil
+}
+
+// Budget scopes.
+const (
+	BudgetScopeUser = "user"
+	BudgetScopeApp  = "app"
+)
+
+// Budget is a usage limit on each user of an app, or on an app as a whole.
+// As usage crosses each of Thresholds (fractions of MaxCost or MaxTokens),
+// an alert is POSTed to Webhook.
+type Budget struct {
+	// App limits the budget to one app; empty applies it to every app.
+	App string `json:"app,omitempty"`
+	// Scope is BudgetScopeUser or BudgetScopeApp.
+	Scope string `json:"scope"`
+	// MaxCost is a limit on estimated cost and MaxTokens on input plus
+	// output tokens; at least one is required.
+	MaxCost   float64 `json:"maxCost,omitempty"`
+	MaxTokens int64   `json:"maxTokens,omitempty"`
+	// Thresholds default to [1], alerting when the limit is reached.
+	Thresholds []float64 `json:"thresholds,omitempty"`
+	Webhook    string    `json:"webhook"`
+}
+
+func (b *Budget) validate() error {
+	if b.Scope != BudgetScopeUser && b.Scope != BudgetScopeApp {
+		return fmt.Errorf("budget scope %q must be %q or %q", b.Scope, BudgetScopeUser, BudgetScopeApp)
+	}
+	if b.MaxCost <= 0 && b.MaxTokens <= 0 {
+		return fmt.Errorf("budget requires maxCost or maxTokens")
+	}
+	if b.Webhook == "" {
+		return fmt.Errorf("budget requires a webhook")
+	}
+	if len(b.Thresholds) == 0 {
+		b.Thresholds = []float64{1}
+	}
+	for _, t := range b.Thresholds {
+		if t <= 0 {
+			return fmt.Errorf("budget threshold %v must be positive", t)
+		}
+	}
+	return nil
+}
+
+// GoosedConfig describes a goosed process the proxy supervises.
+type GoosedConfig struct {
+	Binary       string
+	Args         []string
+	Env          []string // extra KEY=VALUE variables
+	Port         int
+	ReadyTimeout time.Duration
+
+	// Workers is how many goosed processes run, on consecutive ports from
+	// Port. Sessions are spread across them, each staying on the process
+	// that started it; a process takes at most WorkerSessions sessions, or
+	// any number if zero.
+	Workers        int
+	WorkerSessions int
+}
+
+// GooseCLIConfig describes the goose command line the proxy runs turns
+// through instead of a goosed.
+// Runs get the environment of GoosedConfig.Env too.
+type GooseCLIConfig struct {
+	Binary string
+	Args   []string
+	// SessionsDir holds the session files of the runs; empty for
+	// .adk2goose/goose-sessions under WorkingDir.
+	SessionsDir string
+}
+
+// ModelPrice is the price of a model's tokens, per million, in whatever
+// currency the price table uses.
+type ModelPrice struct {
+	InputPerMillion  float64 `json:"inputPerMillion"`
+	OutputPerMillion float64 `json:"outputPerMillion"`
+}
+
+// Cost returns the price of inputTokens and outputTokens.
+func (p ModelPrice) Cost(inputTokens, outputTokens int64) float64 {
+	return (float64(inputTokens)*p.InputPerMillion + float64(outputTokens)*p.OutputPerMillion) / 1e6
+}
+
+// Priority classes of principals queueing for stream slots.
+const (
+	PriorityHigh   = "high"
+	PriorityNormal = "normal"
+	PriorityLow    = "low"
+)
+
+// Load reads the configuration from the environment and CONFIG_FILE, as
+// the profile named by CONFIG_PROFILE, if any.
 func Load() (*Config, error) {
+	return LoadProfile("")
+}
+
+// LoadProfile is Load as the named profile of CONFIG_FILE, or the one named
+// by CONFIG_PROFILE if name is empty. The profile's environment variables
+// are set before the environment is read.
+//
+// Every problem found in the settings is reported together, in a
+// *ValidationError, rather than only the first.
+func LoadProfile(name string) (*Config, error) {
+	if name == "" {
+		name = os.Getenv("CONFIG_PROFILE")
+	}
+	var p problems
+	var sections *fileSections
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		if fc, err := readFile(path); err != nil {
+			p.add(err)
+		} else if s, env, err := fc.profile(name); err != nil {
+			p.add(err)
+		} else {
+			p.add(setProfileEnv(env))
+			sections = &s
+		}
+	} else if name != "" {
+		p.addf("profile %q requires CONFIG_FILE", name)
+	}
+
 	cfg := &Config{
+		Profile:        name,
 		GooseBaseURL:   envOrDefault("GOOSE_BASE_URL", "http://127.0.0.1:3000"),
 		GooseSecret:    os.Getenv("GOOSE_SECRET_KEY"),
+		GooseProvider:  os.Getenv("GOOSE_PROVIDER"),
+		GooseModel:     os.Getenv("GOOSE_MODEL"),
 		ListenAddr:     envOrDefault("LISTEN_ADDR", ":8080"),
 		WorkingDir:     envOrDefault("WORKING_DIR", "."),
 		RequestTimeout: 5 * time.Minute,
+		GooseTransport: gooseclient.TransportConfig{
+			MaxIdleConnsPerHost: 100,
+			DialTimeout:         10 * time.Second,
+			TLSHandshakeTimeout: 10 * time.Second,
+			KeepAlive:           15 * time.Second,
+		},
+		Goosed: GoosedConfig{
+			Binary:       os.Getenv("GOOSED_BINARY"),
+			Args:         strings.Fields(envOrDefault("GOOSED_ARGS", "agent")),
+			Port:         3000,
+			ReadyTimeout: 30 * time.Second,
+			Workers:      1,
+		},
+		GooseCLI: GooseCLIConfig{
+			Binary:      os.Getenv("GOOSE_CLI_BINARY"),
+			Args:        strings.Fields(os.Getenv("GOOSE_CLI_ARGS")),
+			SessionsDir: os.Getenv("GOOSE_CLI_SESSIONS_DIR"),
+		},
+		DebugCaptureDir:      os.Getenv("DEBUG_CAPTURE_DIR"),
+		AuthUserHeader:       os.Getenv("AUTH_USER_HEADER"),
+		AdminListenAddr:      os.Getenv("ADMIN_LISTEN_ADDR"),
+		AdminToken:           os.Getenv("ADMIN_TOKEN"),
+		RunCallbackSecret:    os.Getenv("RUN_CALLBACK_SECRET"),
+		EventStoreDir:        os.Getenv("EVENT_STORE_DIR"),
+		EventSinkURL:         os.Getenv("EVENT_SINK_URL"),
+		EventSinkTopic:       envOrDefault("EVENT_SINK_TOPIC", "adk.events"),
+		EventSinkFormat:      envOrDefault("EVENT_SINK_FORMAT", EventSinkEnvelope),
+		SentryDSN:            os.Getenv("SENTRY_DSN"),
+		SentryEnvironment:    os.Getenv("SENTRY_ENVIRONMENT"),
+		GooseSessionPrefix:   envOrDefault("GOOSE_SESSION_PREFIX", "adk2goose-"),
+		GooseStandbyURL:      os.Getenv("GOOSE_STANDBY_URL"),
+		WorkingDirIsolation:  envOrDefault("WORKING_DIR_ISOLATION", WorkingDirShared),
+		APIKeysFile:          os.Getenv("API_KEYS_FILE"),
+		TLSCert:              os.Getenv("TLS_CERT"),
+		TLSKey:               os.Getenv("TLS_KEY"),
+		DebugCaptureMaxBytes: 10 << 20,
+		UploadMaxBytes:       25 << 20,
+		ToolResultMaxBytes:   64 << 10,
+		RunWorkers:           4,
+		Retention:            Retention{Interval: 10 * time.Minute},
+
+		APIKeysReloadInterval:  30 * time.Second,
+		SecretsRefreshInterval: 5 * time.Minute,
+	}
+
+	p.add(durationEnv("REQUEST_TIMEOUT", &cfg.RequestTimeout))
+	p.add(intEnv("GOOSE_MAX_IDLE_CONNS_PER_HOST", &cfg.GooseTransport.MaxIdleConnsPerHost))
+	p.add(durationEnv("GOOSE_DIAL_TIMEOUT", &cfg.GooseTransport.DialTimeout))
+	p.add(durationEnv("GOOSE_TLS_HANDSHAKE_TIMEOUT", &cfg.GooseTransport.TLSHandshakeTimeout))
+	p.add(durationEnv("GOOSE_RESPONSE_HEADER_TIMEOUT", &cfg.GooseTransport.ResponseHeaderTimeout))
+	p.add(durationEnv("GOOSE_TCP_KEEPALIVE", &cfg.GooseTransport.KeepAlive))
+	p.add(durationEnv("GOOSE_REPLY_IDLE_TIMEOUT", &cfg.GooseTransport.ReplyIdleTimeout))
+	p.add(intEnv("GOOSED_PORT", &cfg.Goosed.Port))
+	p.add(durationEnv("GOOSED_READY_TIMEOUT", &cfg.Goosed.ReadyTimeout))
+	p.add(intEnv("GOOSED_WORKERS", &cfg.Goosed.Workers))
+	p.add(intEnv("GOOSED_WORKER_SESSIONS", &cfg.Goosed.WorkerSessions))
+	if v := os.Getenv("GOOSED_ENV"); v != "" {
+		for _, kv := range strings.Split(v, ",") {
+			if !strings.Contains(kv, "=") {
+				p.addf("GOOSED_ENV: %q is not KEY=VALUE", kv)
+				continue
+			}
+			cfg.Goosed.Env = append(cfg.Goosed.Env, strings.TrimSpace(kv))
+		}
 	}
+	p.add(durationEnv("SLOW_TURN_THRESHOLD", &cfg.SlowTurnThreshold))
+	p.add(intEnv("SLOW_TURN_TOKENS", &cfg.SlowTurnTokens))
+	p.add(intEnv("MAX_CONCURRENT_STREAMS", &cfg.MaxConcurrentStreams))
+	p.add(durationEnv("STREAM_QUEUE_TIMEOUT", &cfg.StreamQueueTimeout))
+	p.add(intEnv("RUN_WORKERS", &cfg.RunWorkers))
+	p.add(durationEnv("STREAM_STALL_TIMEOUT", &cfg.StreamStallTimeout))
+	p.add(boolEnv("SSE_GZIP", &cfg.SSEGzip))
+	p.add(intEnv("SSE_MAX_EVENT_BYTES", &cfg.SSEMaxEventBytes))
+	p.add(intEnv("DEBUG_CAPTURE_MAX_BYTES", &cfg.DebugCaptureMaxBytes))
+	p.add(intEnv("INLINE_DATA_OFFLOAD_BYTES", &cfg.InlineDataOffloadBytes))
+	p.add(intEnv("UPLOAD_MAX_BYTES", &cfg.UploadMaxBytes))
+	p.add(hostsEnv("UPLOAD_FETCH_HOSTS", &cfg.UploadFetchHosts))
+	p.add(hostsEnv("RUN_CALLBACK_HOSTS", &cfg.RunCallbackHosts))
+	p.add(hostsEnv("PUSH_ORIGIN_HOSTS", &cfg.PushOriginHosts))
+	p.add(boolEnv("WORKING_DIR_ARTIFACTS", &cfg.WorkingDirArtifacts))
+	p.add(intEnv("TOOL_RESULT_MAX_BYTES", &cfg.ToolResultMaxBytes))
+	p.add(durationEnv("SESSION_HEALTH_INTERVAL", &cfg.SessionHealthInterval))
+	p.add(durationEnv("ORPHAN_GC_INTERVAL", &cfg.OrphanGCInterval))
+	p.add(durationEnv("RETENTION_INTERVAL", &cfg.Retention.Interval))
+	p.add(durationEnv("SESSION_MAX_AGE", &cfg.Retention.SessionMaxAge))
+	p.add(intEnv("SESSION_MAX_COUNT", &cfg.Retention.SessionMaxCount))
+	p.add(durationEnv("EVENT_LOG_MAX_AGE", &cfg.Retention.EventLogMaxAge))
+	p.add(durationEnv("ARTIFACT_MAX_AGE", &cfg.Retention.ArtifactMaxAge))
+	p.add(intEnv("ARTIFACT_MAX_VERSIONS", &cfg.Retention.ArtifactMaxVersions))
+	p.add(durationEnv("DEBUG_CAPTURE_MAX_AGE", &cfg.Retention.DebugCaptureMaxAge))
+	p.add(intEnv("DEBUG_CAPTURE_MAX_COUNT", &cfg.Retention.DebugCaptureMaxCount))
 
-	if v := os.Getenv("REQUEST_TIMEOUT"); v != "" {
-		d, err := time.ParseDuration(v)
+	if sections != nil {
+		cfg.applyFile(sections, &p)
+	}
+	p.add(durationEnv("SECRETS_REFRESH_INTERVAL", &cfg.SecretsRefreshInterval))
+	p.add(durationEnv("API_KEYS_RELOAD_INTERVAL", &cfg.APIKeysReloadInterval))
+	if cfg.APIKeysFile != "" {
+		keys, err := LoadAPIKeys(cfg.APIKeysFile)
+		p.add(err)
+		cfg.APIKeys = keys
+	}
+	if v := os.Getenv("FEATURE_FLAGS"); v != "" {
+		flags, err := features.Parse(v)
 		if err != nil {
-			return nil, err
+			p.addf("FEATURE_FLAGS: %v", err)
 		}
-		cfg.RequestTimeout = d
+		cfg.Features = cfg.Features.With(flags)
+	}
+	if path := os.Getenv("TOOL_RESULT_RULES_FILE"); path != "" {
+		rules, err := transform.LoadFile(path)
+		p.add(err)
+		cfg.ToolResultRules = rules
 	}
 
+	cfg.validate(&p)
+	if err := p.err(); err != nil {
+		return nil, err
+	}
 	return cfg, nil
 }
 
+// App returns the settings for the named app, or the zero AppConfig if the
+// app is not configured.
+func (c *Config) App(name string) AppConfig {
+	return c.Apps[name]
+}
+
+// PolicedApps returns the names of the apps, sorted, whose tool calls the
+// proxy decides on: those with a tool policy, argument rules, or approval
+// rules. Goose only waits for those decisions in approve mode.
+func (c *Config) PolicedApps() []string {
+	var names []string
+	for name, app := range c.Apps {
+		if len(app.ToolPolicy.Allow) > 0 || len(app.ToolPolicy.Deny) > 0 || len(app.ArgumentRules) > 0 || len(app.Approval.Rules) > 0 {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	return names
+}
+
+// Price returns the token price of model, falling back to the "*" entry. It
+// reports false if the model has no price.
+func (c *Config) Price(model string) (ModelPrice, bool) {
+	if p, ok := c.Prices[model]; ok {
+		return p, true
+	}
+	p, ok := c.Prices["*"]
+	return p, ok
+}
+
+// Priority returns the priority class of principal.
+func (c *Config) Priority(principal string) string {
+	if class, ok := c.Priorities[principal]; ok {
+		return class
+	}
+	return PriorityNormal
+}
+
+// applyFile validates the settings of CONFIG_FILE, adding every problem to
+// p, and adopts them.
+func (c *Config) applyFile(fc *fileSections, p *problems) {
+	for name, app := range fc.Apps {
+		for i := range app.ArgumentRules {
+			if err := app.ArgumentRules[i].Compile(); err != nil {
+				p.addf("app %s: %w", name, err)
+			}
+		}
+		if err := app.Approval.Compile(); err != nil {
+			p.addf("app %s: %w", name, err)
+		}
+		if err := app.Images.validate(); err != nil {
+			p.addf("app %s: %w", name, err)
+		}
+		for _, rule := range app.StateRules {
+			if err := rule.validate(); err != nil {
+				p.addf("app %s: %w", name, err)
+			}
+		}
+		for i := range app.Schedules {
+			if err := app.Schedules[i].Compile(); err != nil {
+				p.addf("app %s: %w", name, err)
+			}
+		}
+		switch app.OnDisconnect {
+		case "", DisconnectCancel, DisconnectContinue:
+		default:
+			p.addf("app %s: unknown onDisconnect %q", name, app.OnDisconnect)
+		}
+		if _, ok := app.Agents[app.DefaultAgent]; app.DefaultAgent != "" && !ok {
+			p.addf("app %s: default agent %q is not configured", name, app.DefaultAgent)
+		}
+		fc.Apps[name] = app
+	}
+	for principal, class := range fc.Priorities {
+		switch class {
+		case PriorityHigh, PriorityNormal, PriorityLow:
+		default:
+			p.addf("priority of %s: unknown class %q", principal, class)
+		}
+	}
+	for model, price := range fc.Prices {
+		if price.InputPerMillion < 0 || price.OutputPerMillion < 0 {
+			p.addf("price of %s: must not be negative", model)
+		}
+	}
+	if err := fc.Features.Validate(); err != nil {
+		p.addf("features: %v", err)
+	}
+	for i := range fc.Budgets {
+		if err := fc.Budgets[i].validate(); err != nil {
+			p.add(err)
+		}
+	}
+	for _, hook := range fc.Webhooks {
+		if err := hook.validate(); err != nil {
+			p.add(err)
+		}
+	}
+	c.Apps = fc.Apps
+	c.Priorities = fc.Priorities
+	c.Webhooks = fc.Webhooks
+	c.Budgets = fc.Budgets
+	c.Prices = fc.Prices
+	c.Features = fc.Features
+}
+
+// durationEnv parses the Go duration in env var key into dst, leaving dst
+// unchanged if the variable is unset.
+func durationEnv(key string, dst *time.Duration) error {
+	v := os.Getenv(key)
+	if v == "" {
+		return nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return fmt.Errorf("%s=%q is not a duration, such as 30s or 5m", key, v)
+	}
+	*dst = d
+	return nil
+}
+
+// intEnv parses the integer in env var key into dst, leaving dst unchanged if
+// the variable is unset.
+func intEnv(key string, dst *int) error {
+	v := os.Getenv(key)
+	if v == "" {
+		return nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return fmt.Errorf("%s=%q is not an integer", key, v)
+	}
+	*dst = n
+	return nil
+}
+
+// hostsEnv parses the comma-separated host names in env var key into dst,
+// leaving dst unchanged if the variable is unset. A name may start with "*."
+// to stand for the subdomains of the rest.
+func hostsEnv(key string, dst *[]string) error {
+	v := os.Getenv(key)
+	if v == "" {
+		return nil
+	}
+	var hosts []string
+	for _, h := range strings.Split(v, ",") {
+		h = strings.TrimSpace(h)
+		name := strings.TrimPrefix(h, "*.")
+		if name == "" || strings.ContainsAny(name, "*/:@ ") {
+			return fmt.Errorf("%s: %q is not a host name", key, h)
+		}
+		hosts = append(hosts, h)
+	}
+	*dst = hosts
+	return nil
+}
+
+// boolEnv parses the boolean in env var key into dst, leaving dst unchanged
+// if the variable is unset.
+func boolEnv(key string, dst *bool) error {
+	v := os.Getenv(key)
+	if v == "" {
+		return nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return fmt.Errorf("%s=%q is not a boolean, such as true or false", key, v)
+	}
+	*dst = b
+	return nil
+}
+
 func envOrDefault(key, fallback string) string {
 	if v := os.Getenv(key); v != "" {
 		return v
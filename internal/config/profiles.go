@@ -0,0 +1,113 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/innomon/adk2goose/internal/features"
+)
+
+// fileSections are the settings CONFIG_FILE holds at its top level, and
+// that its profiles may override.
+type fileSections struct {
+	Apps       map[string]AppConfig  `json:"apps"`
+	Priorities map[string]string     `json:"priorities"`
+	Prices     map[string]ModelPrice `json:"prices"`
+	Budgets    []Budget              `json:"budgets"`
+	Webhooks   []Webhook             `json:"webhooks"`
+	Features   features.Set          `json:"features"`
+}
+
+// Profile is a named environment, such as dev, staging, or prod, described
+// in CONFIG_FILE. It starts from the profile it extends, or from the
+// file's top-level settings. Its apps, priorities, prices, and features
+// replace those of the same name, and its budgets and webhooks, if set,
+// replace the whole list. Env sets environment variables that are not
+// already set, so a profile can pick the Goose backend, auth mode, and
+// limits while the real environment still has the last word.
+type Profile struct {
+	Extends string            `json:"extends,omitempty"`
+	Env     map[string]string `json:"env,omitempty"`
+	fileSections
+}
+
+// readFile reads CONFIG_FILE.
+func readFile(path string) (*fileConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read config file: %w", err)
+	}
+	var fc fileConfig
+	if err := json.Unmarshal(data, &fc); err != nil {
+		return nil, fmt.Errorf("parse config file %s: %w", path, err)
+	}
+	return &fc, nil
+}
+
+// profile returns the file's settings as the profile name, or the
+// top-level ones if name is empty, and the environment it sets.
+func (fc *fileConfig) profile(name string) (fileSections, map[string]string, error) {
+	var chain []*Profile
+	seen := make(map[string]bool)
+	for n := name; n != ""; n = chain[len(chain)-1].Extends {
+		if seen[n] {
+			return fileSections{}, nil, fmt.Errorf("profile %s: extends itself through %s", name, n)
+		}
+		seen[n] = true
+		p, ok := fc.Profiles[n]
+		if !ok {
+			return fileSections{}, nil, fmt.Errorf("unknown profile %q (config file has %s)", n, strings.Join(slices.Sorted(maps.Keys(fc.Profiles)), ", "))
+		}
+		chain = append(chain, &p)
+	}
+
+	sections := fc.fileSections
+	env := make(map[string]string)
+	for _, p := range slices.Backward(chain) {
+		sections.overlay(p.fileSections)
+		maps.Copy(env, p.Env)
+	}
+	return sections, env, nil
+}
+
+// overlay applies the settings o sets over s.
+func (s *fileSections) overlay(o fileSections) {
+	s.Apps = overlayMap(s.Apps, o.Apps)
+	s.Priorities = overlayMap(s.Priorities, o.Priorities)
+	s.Prices = overlayMap(s.Prices, o.Prices)
+	s.Features = overlayMap(s.Features, o.Features)
+	if o.Budgets != nil {
+		s.Budgets = o.Budgets
+	}
+	if o.Webhooks != nil {
+		s.Webhooks = o.Webhooks
+	}
+}
+
+func overlayMap[V any](base, over map[string]V) map[string]V {
+	if over == nil {
+		return base
+	}
+	out := make(map[string]V, len(base)+len(over))
+	maps.Copy(out, base)
+	maps.Copy(out, over)
+	return out
+}
+
+// setProfileEnv sets the profile's environment variables that are not set
+// already.
+func setProfileEnv(env map[string]string) error {
+	for _, key := range slices.Sorted(maps.Keys(env)) {
+		if _, ok := os.LookupEnv(key); ok {
+			continue
+		}
+		if err := os.Setenv(key, env[key]); err != nil {
+			return fmt.Errorf("profile env %s: %w", key, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,174 @@
+package config
+
+import (
+	"cmp"
+	"encoding/json"
+	"maps"
+	"os"
+	"strings"
+	"testing"
+)
+
+const profilesFile = `{
+	"apps": {"chat": {"stripThoughts": true}, "ops": {}},
+	"priorities": {"chat": "high"},
+	"prices": {"gpt-4o": {"inputPerMillion": 2.5, "outputPerMillion": 10}},
+	"budgets": [{"scope": "user", "maxTokens": 1000}],
+	"webhooks": [{"url": "https://hooks.example.com/top"}],
+	"features": {"tool_bridge": true},
+	"profiles": {
+		"base": {
+			"env": {"LOG_LEVEL": "info", "GOOSE_MODE": "approve"},
+			"apps": {"ops": {"stripThoughts": true}},
+			"priorities": {"ops": "low"}
+		},
+		"staging": {
+			"extends": "base",
+			"env": {"LOG_LEVEL": "debug"},
+			"budgets": [],
+			"features": {"tool_bridge": false}
+		},
+		"prod": {
+			"extends": "staging",
+			"apps": {"chat": {}},
+			"webhooks": [{"url": "https://hooks.example.com/prod"}]
+		},
+		"loop-a": {"extends": "loop-b"},
+		"loop-b": {"extends": "loop-a"},
+		"self": {"extends": "self"},
+		"dangling": {"extends": "missing"}
+	}
+}`
+
+func TestFileConfigProfile(t *testing.T) {
+	var fc fileConfig
+	if err := json.Unmarshal([]byte(profilesFile), &fc); err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+
+	tests := []struct {
+		profile string
+
+		stripThoughts map[string]bool // by app
+		priorities    map[string]string
+		budgets       int
+		webhook       string
+		toolBridge    bool
+		env           map[string]string
+	}{
+		{
+			profile:       "",
+			stripThoughts: map[string]bool{"chat": true, "ops": false},
+			priorities:    map[string]string{"chat": "high"},
+			budgets:       1,
+			webhook:       "https://hooks.example.com/top",
+			toolBridge:    true,
+			env:           map[string]string{},
+		},
+		{
+			// Maps merge by key over the top-level settings.
+			profile:       "base",
+			stripThoughts: map[string]bool{"chat": true, "ops": true},
+			priorities:    map[string]string{"chat": "high", "ops": "low"},
+			budgets:       1,
+			webhook:       "https://hooks.example.com/top",
+			toolBridge:    true,
+			env:           map[string]string{"LOG_LEVEL": "info", "GOOSE_MODE": "approve"},
+		},
+		{
+			// A set list, even an empty one, replaces the inherited list;
+			// the nearer profile's env wins.
+			profile:       "staging",
+			stripThoughts: map[string]bool{"chat": true, "ops": true},
+			priorities:    map[string]string{"chat": "high", "ops": "low"},
+			budgets:       0,
+			webhook:       "https://hooks.example.com/top",
+			toolBridge:    false,
+			env:           map[string]string{"LOG_LEVEL": "debug", "GOOSE_MODE": "approve"},
+		},
+		{
+			// An app is replaced whole, not merged field by field.
+			profile:       "prod",
+			stripThoughts: map[string]bool{"chat": false, "ops": true},
+			priorities:    map[string]string{"chat": "high", "ops": "low"},
+			budgets:       0,
+			webhook:       "https://hooks.example.com/prod",
+			toolBridge:    false,
+			env:           map[string]string{"LOG_LEVEL": "debug", "GOOSE_MODE": "approve"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(cmp.Or(tt.profile, "top-level"), func(t *testing.T) {
+			s, env, err := fc.profile(tt.profile)
+			if err != nil {
+				t.Fatalf("profile: %v", err)
+			}
+			for app, want := range tt.stripThoughts {
+				if got := s.Apps[app].StripThoughts; got != want {
+					t.Errorf("app %s: stripThoughts = %t, want %t", app, got, want)
+				}
+			}
+			if !maps.Equal(s.Priorities, tt.priorities) {
+				t.Errorf("priorities = %v, want %v", s.Priorities, tt.priorities)
+			}
+			if s.Prices["gpt-4o"].InputPerMillion != 2.5 {
+				t.Errorf("expected the top-level prices inherited, got %v", s.Prices)
+			}
+			if len(s.Budgets) != tt.budgets {
+				t.Errorf("got %d budgets, want %d", len(s.Budgets), tt.budgets)
+			}
+			if len(s.Webhooks) != 1 || s.Webhooks[0].URL != tt.webhook {
+				t.Errorf("webhooks = %+v, want only %s", s.Webhooks, tt.webhook)
+			}
+			if s.Features.Enabled("tool_bridge") != tt.toolBridge {
+				t.Errorf("tool_bridge = %t, want %t", !tt.toolBridge, tt.toolBridge)
+			}
+			if !maps.Equal(env, tt.env) {
+				t.Errorf("env = %v, want %v", env, tt.env)
+			}
+		})
+	}
+
+	// A profile leaves the file's own settings alone.
+	if _, _, err := fc.profile("prod"); err != nil || !fc.Apps["chat"].StripThoughts || len(fc.Budgets) != 1 {
+		t.Errorf("expected the top-level settings unchanged, got %+v", fc.fileSections)
+	}
+
+	for profile, want := range map[string]string{
+		"loop-a":   "extends itself",
+		"self":     "extends itself",
+		"dangling": `unknown profile "missing"`,
+		"nope":     `unknown profile "nope"`,
+	} {
+		if _, _, err := fc.profile(profile); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("profile %s: expected an error containing %q, got %v", profile, want, err)
+		}
+	}
+}
+
+func TestSetProfileEnv(t *testing.T) {
+	t.Setenv("ADK2GOOSE_TEST_SET", "from-environment")
+	t.Setenv("ADK2GOOSE_TEST_EMPTY", "")
+	os.Unsetenv("ADK2GOOSE_TEST_UNSET")
+	t.Cleanup(func() { os.Unsetenv("ADK2GOOSE_TEST_UNSET") })
+
+	err := setProfileEnv(map[string]string{
+		"ADK2GOOSE_TEST_SET":   "from-profile",
+		"ADK2GOOSE_TEST_EMPTY": "from-profile",
+		"ADK2GOOSE_TEST_UNSET": "from-profile",
+	})
+	if err != nil {
+		t.Fatalf("setProfileEnv: %v", err)
+	}
+
+	// A variable set in the real environment wins, even when empty.
+	for key, want := range map[string]string{
+		"ADK2GOOSE_TEST_SET":   "from-environment",
+		"ADK2GOOSE_TEST_EMPTY": "",
+		"ADK2GOOSE_TEST_UNSET": "from-profile",
+	} {
+		if got := os.Getenv(key); got != want {
+			t.Errorf("%s = %q, want %q", key, got, want)
+		}
+	}
+}
@@ -0,0 +1,263 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// minSSEMaxEventBytes is the smallest SSE_MAX_EVENT_BYTES other than 0: an
+// EVENT_TOO_LARGE event, with its ID, invocation, and message, must fit.
+const minSSEMaxEventBytes = 1024
+
+// ValidationError reports every problem found in the configuration, so
+// that they can all be fixed at once rather than one restart at a time.
+type ValidationError struct {
+	Problems []error
+}
+
+func (e *ValidationError) Error() string {
+	var b strings.Builder
+	if len(e.Problems) == 1 {
+		b.WriteString("1 configuration problem:")
+	} else {
+		fmt.Fprintf(&b, "%d configuration problems:", len(e.Problems))
+	}
+	for _, p := range e.Problems {
+		b.WriteString("\n  - ")
+		b.WriteString(p.Error())
+	}
+	return b.String()
+}
+
+func (e *ValidationError) Unwrap() []error {
+	return e.Problems
+}
+
+// problems collects the configuration problems found so far.
+type problems []error
+
+func (p *problems) add(err error) {
+	if err != nil {
+		*p = append(*p, err)
+	}
+}
+
+func (p *problems) addf(format string, args ...any) {
+	*p = append(*p, fmt.Errorf(format, args...))
+}
+
+// err returns the problems as a ValidationError, or nil if there are none.
+func (p problems) err() error {
+	if len(p) == 0 {
+		return nil
+	}
+	return &ValidationError{Problems: p}
+}
+
+// validate checks settings that parse but cannot work: malformed URLs,
+// missing directories and binaries, out-of-range numbers, and options that
+// exclude or require each other.
+func (c *Config) validate(p *problems) {
+	p.add(checkURL("GOOSE_BASE_URL", c.GooseBaseURL, "http", "https"))
+	if c.GooseStandbyURL != "" {
+		p.add(checkURL("GOOSE_STANDBY_URL", c.GooseStandbyURL, "http", "https"))
+	}
+	if c.EventSinkURL != "" {
+		p.add(checkURL("EVENT_SINK_URL", c.EventSinkURL, "nats", "kafka+http", "kafka+https"))
+	}
+	if c.SentryDSN != "" {
+		p.add(checkURL("SENTRY_DSN", c.SentryDSN, "http", "https"))
+	}
+
+	if info, err := os.Stat(c.WorkingDir); err != nil {
+		p.addf("WORKING_DIR=%q: %v; Goose agents are started in it, so it must exist", c.WorkingDir, unwrapPath(err))
+	} else if !info.IsDir() {
+		p.addf("WORKING_DIR=%q is not a directory", c.WorkingDir)
+	}
+	if c.EventStoreDir != "" {
+		p.add(checkCreatableDir("EVENT_STORE_DIR", c.EventStoreDir))
+	}
+	if c.DebugCaptureDir != "" {
+		p.add(checkCreatableDir("DEBUG_CAPTURE_DIR", c.DebugCaptureDir))
+	}
+	if c.Goosed.Binary != "" {
+		if _, err := exec.LookPath(c.Goosed.Binary); err != nil {
+			p.addf("GOOSED_BINARY=%q: %v", c.Goosed.Binary, unwrapPath(err))
+		}
+	}
+	if c.GooseCLI.Binary != "" {
+		if _, err := exec.LookPath(c.GooseCLI.Binary); err != nil {
+			p.addf("GOOSE_CLI_BINARY=%q: %v", c.GooseCLI.Binary, unwrapPath(err))
+		}
+	}
+	if c.GooseCLI.SessionsDir != "" {
+		p.add(checkCreatableDir("GOOSE_CLI_SESSIONS_DIR", c.GooseCLI.SessionsDir))
+	}
+
+	if c.RequestTimeout <= 0 {
+		p.addf("REQUEST_TIMEOUT=%s must be positive", c.RequestTimeout)
+	}
+	if c.Retention.Interval <= 0 {
+		p.addf("RETENTION_INTERVAL=%s must be positive", c.Retention.Interval)
+	}
+	for _, d := range []struct {
+		name  string
+		value time.Duration
+	}{
+		{"GOOSE_DIAL_TIMEOUT", c.GooseTransport.DialTimeout},
+		{"GOOSE_TLS_HANDSHAKE_TIMEOUT", c.GooseTransport.TLSHandshakeTimeout},
+		{"GOOSE_RESPONSE_HEADER_TIMEOUT", c.GooseTransport.ResponseHeaderTimeout},
+		{"GOOSE_REPLY_IDLE_TIMEOUT", c.GooseTransport.ReplyIdleTimeout},
+		{"GOOSED_READY_TIMEOUT", c.Goosed.ReadyTimeout},
+		{"SLOW_TURN_THRESHOLD", c.SlowTurnThreshold},
+		{"STREAM_QUEUE_TIMEOUT", c.StreamQueueTimeout},
+		{"STREAM_STALL_TIMEOUT", c.StreamStallTimeout},
+		{"SESSION_HEALTH_INTERVAL", c.SessionHealthInterval},
+		{"ORPHAN_GC_INTERVAL", c.OrphanGCInterval},
+		{"SESSION_MAX_AGE", c.Retention.SessionMaxAge},
+		{"EVENT_LOG_MAX_AGE", c.Retention.EventLogMaxAge},
+		{"ARTIFACT_MAX_AGE", c.Retention.ArtifactMaxAge},
+		{"DEBUG_CAPTURE_MAX_AGE", c.Retention.DebugCaptureMaxAge},
+		{"API_KEYS_RELOAD_INTERVAL", c.APIKeysReloadInterval},
+		{"SECRETS_REFRESH_INTERVAL", c.SecretsRefreshInterval},
+	} {
+		if d.value < 0 {
+			p.addf("%s=%s must not be negative; 0 disables it", d.name, d.value)
+		}
+	}
+	for _, n := range []struct {
+		name  string
+		value int
+	}{
+		{"GOOSE_MAX_IDLE_CONNS_PER_HOST", c.GooseTransport.MaxIdleConnsPerHost},
+		{"GOOSED_WORKER_SESSIONS", c.Goosed.WorkerSessions},
+		{"SLOW_TURN_TOKENS", c.SlowTurnTokens},
+		{"MAX_CONCURRENT_STREAMS", c.MaxConcurrentStreams},
+		{"SSE_MAX_EVENT_BYTES", c.SSEMaxEventBytes},
+		{"DEBUG_CAPTURE_MAX_BYTES", c.DebugCaptureMaxBytes},
+		{"INLINE_DATA_OFFLOAD_BYTES", c.InlineDataOffloadBytes},
+		{"UPLOAD_MAX_BYTES", c.UploadMaxBytes},
+		{"TOOL_RESULT_MAX_BYTES", c.ToolResultMaxBytes},
+		{"SESSION_MAX_COUNT", c.Retention.SessionMaxCount},
+		{"ARTIFACT_MAX_VERSIONS", c.Retention.ArtifactMaxVersions},
+		{"DEBUG_CAPTURE_MAX_COUNT", c.Retention.DebugCaptureMaxCount},
+	} {
+		if n.value < 0 {
+			p.addf("%s=%d must not be negative; 0 disables it", n.name, n.value)
+		}
+	}
+	if c.SSEMaxEventBytes > 0 && c.SSEMaxEventBytes < minSSEMaxEventBytes {
+		p.addf("SSE_MAX_EVENT_BYTES=%d must be 0 or at least %d, to fit the EVENT_TOO_LARGE event sent in place of a larger one", c.SSEMaxEventBytes, minSSEMaxEventBytes)
+	}
+	if c.Goosed.Workers < 1 {
+		p.addf("GOOSED_WORKERS=%d must be at least 1", c.Goosed.Workers)
+	}
+	if c.RunWorkers < 1 {
+		p.addf("RUN_WORKERS=%d must be at least 1", c.RunWorkers)
+	}
+	if last := c.Goosed.Port + c.Goosed.Workers - 1; c.Goosed.Port < 1 || last > 65535 {
+		p.addf("GOOSED_PORT=%d: the ports of %d workers must lie between 1 and 65535", c.Goosed.Port, c.Goosed.Workers)
+	}
+
+	if !slices.Contains([]string{EventSinkEnvelope, EventSinkEvent}, c.EventSinkFormat) {
+		p.addf("EVENT_SINK_FORMAT=%q must be %q or %q", c.EventSinkFormat, EventSinkEnvelope, EventSinkEvent)
+	}
+	if !slices.Contains([]string{WorkingDirShared, WorkingDirIsolationUser, WorkingDirIsolationSession}, c.WorkingDirIsolation) {
+		p.addf("WORKING_DIR_ISOLATION=%q must be %q, %q, or %q", c.WorkingDirIsolation, WorkingDirShared, WorkingDirIsolationUser, WorkingDirIsolationSession)
+	}
+	if c.WorkingDirArtifacts && c.WorkingDirIsolation == WorkingDirShared {
+		p.addf("WORKING_DIR_ARTIFACTS needs WORKING_DIR_ISOLATION=%s or %s: in a shared working directory, sessions would collect each other's files", WorkingDirIsolationUser, WorkingDirIsolationSession)
+	}
+	if c.OrphanGCInterval > 0 && c.GooseSessionPrefix == "" {
+		// Every unmapped Goose session would count as the proxy's.
+		p.addf("ORPHAN_GC_INTERVAL requires GOOSE_SESSION_PREFIX")
+	}
+	if (c.TLSCert == "") != (c.TLSKey == "") {
+		p.addf("TLS_CERT and TLS_KEY must be set together")
+	}
+	if c.APIKeysFile != "" && c.AuthUserHeader != "" {
+		p.addf("API_KEYS_FILE and AUTH_USER_HEADER cannot both be set; use one way of authenticating clients")
+	}
+	// Authenticated clients must not find the admin routes, which purge
+	// users and read Goose's secrets, open.
+	switch {
+	case c.AdminCredentials():
+	case c.AuthUserHeader != "":
+		p.addf("AUTH_USER_HEADER authenticates clients, but the admin routes would not be: set ADMIN_TOKEN")
+	case c.APIKeysFile != "" && len(c.APIKeys) > 0:
+		p.addf("API_KEYS_FILE=%q has no admin key, so the admin routes would not be authenticated: add one or set ADMIN_TOKEN", c.APIKeysFile)
+	}
+	if c.AdminListenAddr != "" && c.AdminListenAddr == c.ListenAddr {
+		p.addf("ADMIN_LISTEN_ADDR=%q is LISTEN_ADDR; leave it unset to serve the admin routes on LISTEN_ADDR", c.AdminListenAddr)
+	}
+	if c.GooseCLI.Binary != "" {
+		switch {
+		case c.Goosed.Binary != "":
+			p.addf("GOOSE_CLI_BINARY cannot be set with GOOSED_BINARY")
+		case c.GooseStandbyURL != "":
+			p.addf("GOOSE_CLI_BINARY cannot be set with GOOSE_STANDBY_URL")
+		}
+		// goose run calls tools without asking, so nothing can be denied.
+		if apps := c.PolicedApps(); len(apps) > 0 {
+			p.addf("GOOSE_CLI_BINARY runs tools without confirmation, so apps %s cannot police tool calls: remove their toolPolicy, argumentRules, and approval, or use goosed", strings.Join(apps, ", "))
+		}
+	}
+	if c.GooseStandbyURL != "" && c.GooseStandbyURL == c.GooseBaseURL {
+		p.addf("GOOSE_STANDBY_URL=%q is GOOSE_BASE_URL; a standby must be another server", c.GooseStandbyURL)
+	}
+}
+
+// checkURL reports a value of env var name that is not an absolute URL with
+// one of schemes and a host.
+func checkURL(name, value string, schemes ...string) error {
+	u, err := url.Parse(value)
+	if err != nil {
+		return fmt.Errorf("%s=%q is not a URL: %v", name, value, errors.Unwrap(err))
+	}
+	if !slices.Contains(schemes, u.Scheme) || u.Host == "" {
+		return fmt.Errorf("%s=%q must be a URL with scheme %s and a host", name, value, strings.Join(schemes, " or "))
+	}
+	return nil
+}
+
+// checkCreatableDir reports a directory setting that names something other
+// than a directory, or that cannot be created because its closest existing
+// ancestor is not a directory.
+func checkCreatableDir(name, dir string) error {
+	for p := filepath.Clean(dir); ; p = filepath.Dir(p) {
+		info, err := os.Stat(p)
+		if err == nil {
+			if !info.IsDir() {
+				return fmt.Errorf("%s=%q: %s is not a directory", name, dir, p)
+			}
+			return nil
+		}
+		if !os.IsNotExist(err) {
+			return fmt.Errorf("%s=%q: %v", name, dir, unwrapPath(err))
+		}
+		if filepath.Dir(p) == p {
+			return nil
+		}
+	}
+}
+
+// unwrapPath drops the operation and path that a settings problem already
+// names from a file system error.
+func unwrapPath(err error) error {
+	var pe *os.PathError
+	if errors.As(err, &pe) {
+		return pe.Err
+	}
+	var ee *exec.Error
+	if errors.As(err, &ee) {
+		return ee.Err
+	}
+	return err
+}
@@ -0,0 +1,193 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/innomon/adk2goose/internal/policy"
+)
+
+// validConfig returns settings that pass validation, for tests to break one
+// at a time.
+func validConfig(t *testing.T) *Config {
+	t.Helper()
+	return &Config{
+		GooseBaseURL:        "http://127.0.0.1:3000",
+		ListenAddr:          ":8080",
+		WorkingDir:          t.TempDir(),
+		RequestTimeout:      5 * time.Minute,
+		Goosed:              GoosedConfig{Port: 3000, Workers: 1},
+		RunWorkers:          4,
+		Retention:           Retention{Interval: 10 * time.Minute},
+		EventSinkFormat:     EventSinkEnvelope,
+		WorkingDirIsolation: WorkingDirShared,
+		GooseSessionPrefix:  "adk2goose-",
+	}
+}
+
+func TestValidate(t *testing.T) {
+	// The test binary stands in for the goose and goosed binaries.
+	binary, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(file, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	policed := map[string]AppConfig{
+		"ops":  {ToolPolicy: policy.ToolPolicy{Deny: []string{"developer__shell"}}},
+		"chat": {StripThoughts: true},
+	}
+
+	tests := []struct {
+		name   string
+		change func(c *Config)
+		want   string // a substring of the only problem, or "" for none
+	}{
+		{"valid", func(c *Config) {}, ""},
+		{"goose url", func(c *Config) { c.GooseBaseURL = "127.0.0.1:3000" }, "GOOSE_BASE_URL"},
+		{"event sink url", func(c *Config) { c.EventSinkURL = "http://broker" }, "EVENT_SINK_URL"},
+		{"missing working dir", func(c *Config) { c.WorkingDir = filepath.Join(c.WorkingDir, "missing") }, "must exist"},
+		{"working dir file", func(c *Config) { c.WorkingDir = file }, "is not a directory"},
+		{"event store under file", func(c *Config) { c.EventStoreDir = filepath.Join(file, "events") }, "EVENT_STORE_DIR"},
+		{"missing goosed", func(c *Config) { c.Goosed.Binary = "no-such-goosed-binary" }, "GOOSED_BINARY"},
+		{"request timeout", func(c *Config) { c.RequestTimeout = 0 }, "REQUEST_TIMEOUT=0s must be positive"},
+		{"negative duration", func(c *Config) { c.StreamStallTimeout = -time.Second }, "STREAM_STALL_TIMEOUT=-1s must not be negative"},
+		{"negative size", func(c *Config) { c.UploadMaxBytes = -1 }, "UPLOAD_MAX_BYTES=-1 must not be negative"},
+		{"sse event limit too small", func(c *Config) { c.SSEMaxEventBytes = 100 }, "SSE_MAX_EVENT_BYTES=100 must be 0 or at least 1024"},
+		{"sse event limit", func(c *Config) { c.SSEMaxEventBytes = 1024 }, ""},
+		{"no workers", func(c *Config) { c.Goosed.Workers = 0 }, "GOOSED_WORKERS=0"},
+		{"run workers", func(c *Config) { c.RunWorkers = 0 }, "RUN_WORKERS=0"},
+		{"worker ports", func(c *Config) { c.Goosed.Port, c.Goosed.Workers = 65535, 2 }, "GOOSED_PORT=65535"},
+		{"event sink format", func(c *Config) { c.EventSinkFormat = "avro" }, "EVENT_SINK_FORMAT"},
+		{"isolation", func(c *Config) { c.WorkingDirIsolation = "tenant" }, "WORKING_DIR_ISOLATION"},
+		{"orphan gc without prefix", func(c *Config) { c.OrphanGCInterval, c.GooseSessionPrefix = time.Hour, "" }, "requires GOOSE_SESSION_PREFIX"},
+		{"tls pair", func(c *Config) { c.TLSCert = "cert.pem" }, "TLS_CERT and TLS_KEY"},
+		{"admin on listen addr", func(c *Config) { c.AdminListenAddr = c.ListenAddr }, "ADMIN_LISTEN_ADDR"},
+		{"standby is base", func(c *Config) { c.GooseStandbyURL = c.GooseBaseURL }, "a standby must be another server"},
+
+		// Working-dir artifacts need private working directories.
+		{"shared artifacts", func(c *Config) { c.WorkingDirArtifacts = true }, "WORKING_DIR_ARTIFACTS needs WORKING_DIR_ISOLATION"},
+		{"user artifacts", func(c *Config) {
+			c.WorkingDirArtifacts, c.WorkingDirIsolation = true, WorkingDirIsolationUser
+		}, ""},
+		{"session artifacts", func(c *Config) {
+			c.WorkingDirArtifacts, c.WorkingDirIsolation = true, WorkingDirIsolationSession
+		}, ""},
+
+		// Authenticated clients need authenticated admin routes.
+		{"auth header without admin token", func(c *Config) { c.AuthUserHeader = "X-User" }, "set ADMIN_TOKEN"},
+		{"auth header with admin token", func(c *Config) { c.AuthUserHeader, c.AdminToken = "X-User", "secret" }, ""},
+		{"api keys without admin key", func(c *Config) {
+			c.APIKeysFile, c.APIKeys = "keys.json", []APIKey{{Name: "app", Key: "k1", Role: APIKeyRoleUser}}
+		}, "has no admin key"},
+		{"api keys with admin key", func(c *Config) {
+			c.APIKeysFile, c.APIKeys = "keys.json", []APIKey{{Name: "ops", Key: "k1", Role: APIKeyRoleAdmin}}
+		}, ""},
+		{"api keys and auth header", func(c *Config) {
+			c.APIKeysFile, c.AuthUserHeader, c.AdminToken = "keys.json", "X-User", "secret"
+		}, "cannot both be set"},
+
+		// The goose CLI backend excludes goosed, a standby, and policed apps.
+		{"cli", func(c *Config) { c.GooseCLI.Binary = binary; c.Apps = map[string]AppConfig{"chat": policed["chat"]} }, ""},
+		{"missing cli", func(c *Config) { c.GooseCLI.Binary = "no-such-goose-binary" }, "GOOSE_CLI_BINARY"},
+		{"cli with goosed", func(c *Config) { c.GooseCLI.Binary, c.Goosed.Binary = binary, binary }, "cannot be set with GOOSED_BINARY"},
+		{"cli with standby", func(c *Config) {
+			c.GooseCLI.Binary, c.GooseStandbyURL = binary, "http://127.0.0.1:3001"
+		}, "cannot be set with GOOSE_STANDBY_URL"},
+		{"cli with policed app", func(c *Config) { c.GooseCLI.Binary, c.Apps = binary, policed }, "apps ops cannot police tool calls"},
+		{"cli sessions dir under file", func(c *Config) {
+			c.GooseCLI.Binary, c.GooseCLI.SessionsDir = binary, filepath.Join(file, "sessions")
+		}, "GOOSE_CLI_SESSIONS_DIR"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := validConfig(t)
+			tt.change(c)
+			var p problems
+			c.validate(&p)
+			switch {
+			case tt.want == "" && len(p) > 0:
+				t.Errorf("expected no problems, got %v", p)
+			case tt.want != "" && (len(p) != 1 || !strings.Contains(p[0].Error(), tt.want)):
+				t.Errorf("expected one problem containing %q, got %v", tt.want, p)
+			}
+		})
+	}
+}
+
+func TestValidate_ReportsEveryProblem(t *testing.T) {
+	c := validConfig(t)
+	c.RequestTimeout = 0
+	c.EventSinkFormat = "avro"
+	c.TLSKey = "key.pem"
+	var p problems
+	c.validate(&p)
+
+	err := p.err()
+	var verr *ValidationError
+	if !errors.As(err, &verr) || len(verr.Problems) != 3 {
+		t.Fatalf("expected a ValidationError with 3 problems, got %v", err)
+	}
+	lines := strings.Split(err.Error(), "\n")
+	if lines[0] != "3 configuration problems:" || len(lines) != 4 {
+		t.Fatalf("unexpected message %q", err.Error())
+	}
+	for i, want := range []string{"REQUEST_TIMEOUT", "EVENT_SINK_FORMAT", "TLS_CERT"} {
+		if !strings.HasPrefix(lines[i+1], "  - ") || !strings.Contains(lines[i+1], want) {
+			t.Errorf("line %d: expected a problem about %s, got %q", i+1, want, lines[i+1])
+		}
+	}
+	if !errors.Is(err, verr.Problems[1]) {
+		t.Error("expected the ValidationError to unwrap to its problems")
+	}
+
+	single := (&ValidationError{Problems: verr.Problems[:1]}).Error()
+	if !strings.HasPrefix(single, "1 configuration problem:\n") {
+		t.Errorf("unexpected message %q", single)
+	}
+	if (problems{}).err() != nil {
+		t.Error("expected no error without problems")
+	}
+}
+
+func TestHostsEnv(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    []string
+		wantErr bool
+	}{
+		{value: "", want: []string{"kept.example.com"}},
+		{value: "files.example.com", want: []string{"files.example.com"}},
+		{value: " a.example.com , *.cdn.example.com", want: []string{"a.example.com", "*.cdn.example.com"}},
+		{value: "127.0.0.1", want: []string{"127.0.0.1"}},
+		{value: "a.example.com,", wantErr: true},
+		{value: "*.", wantErr: true},
+		{value: "*", wantErr: true},
+		{value: "a.*.example.com", wantErr: true},
+		{value: "example.com:8080", wantErr: true},
+		{value: "user@example.com", wantErr: true},
+		{value: "example.com/files", wantErr: true},
+		{value: "https://example.com", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Setenv("UPLOAD_FETCH_HOSTS", tt.value)
+		hosts := []string{"kept.example.com"}
+		err := hostsEnv("UPLOAD_FETCH_HOSTS", &hosts)
+		if tt.wantErr {
+			if err == nil || !strings.Contains(err.Error(), "UPLOAD_FETCH_HOSTS") {
+				t.Errorf("%q: expected an error naming UPLOAD_FETCH_HOSTS, got %v (hosts %v)", tt.value, err, hosts)
+			}
+			continue
+		}
+		if err != nil || !slices.Equal(hosts, tt.want) {
+			t.Errorf("%q: got %v, %v; want %v", tt.value, hosts, err, tt.want)
+		}
+	}
+}
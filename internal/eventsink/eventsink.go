@@ -0,0 +1,277 @@
+// Package eventsink publishes messages to event streaming systems: NATS
+// subjects over the NATS client protocol, and Kafka topics through a Kafka
+// REST Proxy.
+package eventsink
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Publisher sends messages to a topic of an event streaming system.
+type Publisher interface {
+	// Publish sends data, a JSON document, under key. Brokers that do not
+	// key messages ignore key.
+	Publish(key string, data []byte) error
+	Close() error
+}
+
+// Open returns a Publisher for the broker at rawURL publishing to topic.
+// nats://host:port publishes to the NATS subject topic; kafka+http:// and
+// kafka+https:// URLs name a Kafka REST Proxy (v2 API) that produces to the
+// Kafka topic topic.
+func Open(rawURL, topic string) (Publisher, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("event sink URL: %w", err)
+	}
+	if topic == "" {
+		return nil, fmt.Errorf("event sink %s: a topic is required", rawURL)
+	}
+	switch u.Scheme {
+	case "nats":
+		// The client speaks plain, unauthenticated NATS only; settings it
+		// would ignore are refused rather than dropped.
+		if u.User != nil || u.RawQuery != "" {
+			return nil, fmt.Errorf("event sink %s: NATS credentials and options are not supported", u.Redacted())
+		}
+		host := u.Host
+		if u.Port() == "" {
+			host = net.JoinHostPort(u.Hostname(), "4222")
+		}
+		return &NATS{addr: host, subject: topic}, nil
+	case "kafka+http", "kafka+https":
+		base := *u
+		base.Scheme = strings.TrimPrefix(u.Scheme, "kafka+")
+		return &KafkaREST{
+			url:    strings.TrimSuffix(base.String(), "/") + "/topics/" + url.PathEscape(topic),
+			client: &http.Client{Timeout: 10 * time.Second},
+		}, nil
+	}
+	return nil, fmt.Errorf("event sink %s: unsupported scheme %q", rawURL, u.Scheme)
+}
+
+// NATS publishes to a NATS subject. It connects on first use and
+// reconnects on the next publish after the connection fails. Each publish
+// is followed by a PING, so that the server's -ERR for it, which arrives
+// before the PONG, fails it.
+type NATS struct {
+	addr, subject string
+
+	mu   sync.Mutex // serializes publishes
+	conn *natsConn
+}
+
+// natsConn is a connection to a NATS server, read by a goroutine that
+// answers the server's PINGs and passes on the replies to the publisher's.
+type natsConn struct {
+	net.Conn
+	wmu     sync.Mutex    // serializes writes
+	replies chan string   // "" for a PONG, or an -ERR line
+	done    chan struct{} // closed once the connection fails
+}
+
+// natsTimeout bounds connecting to the NATS server, each write, and waiting
+// for a publish to be acknowledged.
+const natsTimeout = 5 * time.Second
+
+// Publish sends data to the subject. NATS messages are not keyed.
+func (n *NATS) Publish(key string, data []byte) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.conn == nil {
+		c, err := n.connect()
+		if err != nil {
+			return err
+		}
+		n.conn = c
+	}
+	c := n.conn
+	// Drop replies left by an earlier publish that timed out.
+	for len(c.replies) > 0 {
+		<-c.replies
+	}
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "PUB %s %d\r\n", n.subject, len(data))
+	msg.Write(data)
+	msg.WriteString("\r\nPING\r\n")
+	err := c.write(msg.Bytes())
+	if err == nil {
+		err = c.await()
+	}
+	if err != nil {
+		c.Close()
+		n.conn = nil
+		return fmt.Errorf("nats publish: %w", err)
+	}
+	return nil
+}
+
+// connect dials the server, reads its INFO, and sends CONNECT, waiting for
+// the server to accept it. A reader goroutine then answers the server's
+// PINGs for the life of the connection.
+func (n *NATS) connect() (*natsConn, error) {
+	conn, err := net.DialTimeout("tcp", n.addr, natsTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("nats connect: %w", err)
+	}
+	c := &natsConn{Conn: conn, replies: make(chan string, 1), done: make(chan struct{})}
+	r := bufio.NewReader(conn)
+	conn.SetReadDeadline(time.Now().Add(natsTimeout))
+	err = c.handshake(r)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("nats connect to %s: %w", n.addr, err)
+	}
+	conn.SetReadDeadline(time.Time{})
+	go c.serve(r)
+	return c, nil
+}
+
+// handshake reads the server's INFO, sends CONNECT, and waits for the PONG
+// answering the PING after it, or the server's -ERR refusing it.
+func (c *natsConn) handshake(r *bufio.Reader) error {
+	line, err := r.ReadString('\n')
+	info, ok := strings.CutPrefix(line, "INFO ")
+	if err != nil || !ok {
+		return fmt.Errorf("expected INFO, got %q: %v", line, err)
+	}
+	var server struct {
+		TLSRequired  bool `json:"tls_required"`
+		AuthRequired bool `json:"auth_required"`
+	}
+	if err := json.Unmarshal([]byte(info), &server); err != nil {
+		return fmt.Errorf("decode INFO: %w", err)
+	}
+	if server.TLSRequired || server.AuthRequired {
+		return errors.New("the server requires TLS or authentication, which are not supported")
+	}
+	if err := c.write([]byte("CONNECT {\"verbose\":false,\"pedantic\":false,\"name\":\"adk2goose\"}\r\nPING\r\n")); err != nil {
+		return err
+	}
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		switch line = strings.TrimSpace(line); {
+		case line == "PONG":
+			return nil
+		case strings.HasPrefix(line, "-ERR"):
+			return fmt.Errorf("server refused the connection: %s", line)
+		}
+	}
+}
+
+// write sends p within natsTimeout.
+func (c *natsConn) write(p []byte) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	c.SetWriteDeadline(time.Now().Add(natsTimeout))
+	_, err := c.Write(p)
+	return err
+}
+
+// await waits for the server's reply to the publisher's PING.
+func (c *natsConn) await() error {
+	timer := time.NewTimer(natsTimeout)
+	defer timer.Stop()
+	select {
+	case reply := <-c.replies:
+		if reply != "" {
+			return fmt.Errorf("server error: %s", reply)
+		}
+		return nil
+	case <-c.done:
+		return errors.New("connection closed")
+	case <-timer.C:
+		return fmt.Errorf("no reply within %s", natsTimeout)
+	}
+}
+
+// serve reads server messages until the connection fails, answering PINGs
+// and passing on PONGs and errors.
+func (c *natsConn) serve(r *bufio.Reader) {
+	defer close(c.done)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		switch line = strings.TrimSpace(line); {
+		case line == "PING":
+			if c.write([]byte("PONG\r\n")) != nil {
+				c.Close()
+				return
+			}
+		case line == "PONG":
+			c.reply("")
+		case strings.HasPrefix(line, "-ERR"):
+			c.reply(line)
+		}
+	}
+}
+
+// reply passes on a reply, keeping the first if the publisher has not
+// taken it yet: an -ERR comes before the PONG of the same publish.
+func (c *natsConn) reply(r string) {
+	select {
+	case c.replies <- r:
+	default:
+	}
+}
+
+// Close closes the connection, if any.
+func (n *NATS) Close() error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.conn == nil {
+		return nil
+	}
+	err := n.conn.Close()
+	n.conn = nil
+	return err
+}
+
+// KafkaREST produces to a Kafka topic through a Kafka REST Proxy.
+type KafkaREST struct {
+	url    string
+	client *http.Client
+}
+
+// Publish produces data as a JSON record with key.
+func (k *KafkaREST) Publish(key string, data []byte) error {
+	body, err := json.Marshal(map[string]any{
+		"records": []map[string]any{{"key": key, "value": json.RawMessage(data)}},
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, k.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/vnd.kafka.json.v2+json")
+	req.Header.Set("Accept", "application/vnd.kafka.v2+json")
+	resp, err := k.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("kafka produce: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("kafka produce: status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Close does nothing; the REST proxy holds no connection state.
+func (k *KafkaREST) Close() error { return nil }
@@ -0,0 +1,138 @@
+// Package features gates experimental proxy behaviors behind named flags,
+// so that a risky change can ship switched off and be turned on, or back
+// off, per deployment without a new build.
+//
+// Flags are set in CONFIG_FILE's "features" object and overridden by the
+// FEATURE_FLAGS environment variable, a comma-separated list such as
+// "tool_bridge=false,partial_streaming".
+package features
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Names of the flags.
+const (
+	// PartialStreaming streams the pieces of a tool call Goose is still
+	// generating as partial events ahead of the complete call.
+	PartialStreaming = "partial_streaming"
+	// StructuredToolResponses passes a tool result's structured_content to
+	// the agent as the FunctionResponse payload, rather than its text
+	// under "result".
+	StructuredToolResponses = "structured_tool_responses"
+	// ToolBridge delivers function responses an ADK client sends during a
+	// turn to Goose as the results of tools it waits on.
+	ToolBridge = "tool_bridge"
+)
+
+// Flag describes a feature flag.
+type Flag struct {
+	Name string
+	// Default is the flag's state where a deployment does not set it.
+	Default bool
+}
+
+// Flags lists every flag.
+var Flags = []Flag{
+	{Name: PartialStreaming, Default: true},
+	{Name: StructuredToolResponses, Default: true},
+	{Name: ToolBridge, Default: true},
+}
+
+func lookup(name string) (Flag, bool) {
+	i := slices.IndexFunc(Flags, func(f Flag) bool { return f.Name == name })
+	if i < 0 {
+		return Flag{}, false
+	}
+	return Flags[i], true
+}
+
+// Set holds the flags a deployment turned on or off; the others keep their
+// default. The nil Set holds none.
+type Set map[string]bool
+
+// Enabled reports whether the flag name is on.
+func (s Set) Enabled(name string) bool {
+	if on, ok := s[name]; ok {
+		return on
+	}
+	f, _ := lookup(name)
+	return f.Default
+}
+
+// State returns whether each flag is on.
+func (s Set) State() map[string]bool {
+	state := make(map[string]bool, len(Flags))
+	for _, f := range Flags {
+		state[f.Name] = s.Enabled(f.Name)
+	}
+	return state
+}
+
+// Changed returns the names of the flags s sets away from their default,
+// sorted.
+func (s Set) Changed() []string {
+	var names []string
+	for name, on := range s {
+		if f, ok := lookup(name); ok && on != f.Default {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	return names
+}
+
+// Validate reports flags that do not exist.
+func (s Set) Validate() error {
+	for _, name := range slices.Sorted(maps.Keys(s)) {
+		if _, ok := lookup(name); !ok {
+			return unknown(name)
+		}
+	}
+	return nil
+}
+
+// With returns s with the flags over sets replacing its own.
+func (s Set) With(over Set) Set {
+	out := make(Set, len(s)+len(over))
+	maps.Copy(out, s)
+	maps.Copy(out, over)
+	return out
+}
+
+// Parse reads a comma-separated list of flags: "name" or "name=true" turns
+// a flag on, and "name=false" turns it off.
+func Parse(spec string) (Set, error) {
+	s := make(Set)
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		name, value, hasValue := strings.Cut(item, "=")
+		if _, ok := lookup(name); !ok {
+			return nil, unknown(name)
+		}
+		on := true
+		if hasValue {
+			var err error
+			if on, err = strconv.ParseBool(value); err != nil {
+				return nil, fmt.Errorf("feature %s: %q is not a boolean", name, value)
+			}
+		}
+		s[name] = on
+	}
+	return s, nil
+}
+
+func unknown(name string) error {
+	names := make([]string, len(Flags))
+	for i, f := range Flags {
+		names[i] = f.Name
+	}
+	return fmt.Errorf("unknown feature %q (known: %s)", name, strings.Join(names, ", "))
+}
@@ -0,0 +1,41 @@
+package features
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	s, err := Parse(" tool_bridge=false, partial_streaming ,structured_tool_responses=true")
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if s.Enabled(ToolBridge) || !s.Enabled(PartialStreaming) || !s.Enabled(StructuredToolResponses) {
+		t.Errorf("unexpected flags %v", s.State())
+	}
+	if got := s.Changed(); !slices.Equal(got, []string{ToolBridge}) {
+		t.Errorf("Changed() = %v, want [%s]", got, ToolBridge)
+	}
+
+	for _, spec := range []string{"no_such_flag", "tool_bridge=maybe"} {
+		if _, err := Parse(spec); err == nil {
+			t.Errorf("Parse(%q): expected an error", spec)
+		}
+	}
+}
+
+func TestSetDefaults(t *testing.T) {
+	var s Set
+	for _, f := range Flags {
+		if s.Enabled(f.Name) != f.Default {
+			t.Errorf("flag %s: expected its default %t in the nil Set", f.Name, f.Default)
+		}
+	}
+	over := Set{ToolBridge: false}
+	if s.With(over).Enabled(ToolBridge) {
+		t.Errorf("expected With to turn %s off", ToolBridge)
+	}
+	if err := (Set{"bogus": true}).Validate(); err == nil {
+		t.Errorf("expected an unknown flag to be reported")
+	}
+}
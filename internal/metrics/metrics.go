@@ -0,0 +1,337 @@
+// Package metrics is a minimal, dependency-free metrics registry that exposes
+// counters, gauges, and histograms in the Prometheus text exposition format.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets are histogram upper bounds, in seconds, suited to HTTP
+// request latencies.
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+// Default is the registry used by the package-level constructors.
+var Default = NewRegistry()
+
+// collector is implemented by every metric type the registry can expose.
+type collector interface {
+	write(w io.Writer)
+}
+
+// Registry holds a set of metrics and renders them for scraping.
+type Registry struct {
+	mu         sync.Mutex
+	collectors []collector
+}
+
+// NewRegistry creates an empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+func (r *Registry) register(c collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.collectors = append(r.collectors, c)
+}
+
+// Write renders every registered metric in the Prometheus text format.
+func (r *Registry) Write(w io.Writer) {
+	r.mu.Lock()
+	collectors := append([]collector(nil), r.collectors...)
+	r.mu.Unlock()
+
+	bw := bufio.NewWriter(w)
+	for _, c := range collectors {
+		c.write(bw)
+	}
+	bw.Flush()
+}
+
+// Handler returns an http.Handler serving the registry for Prometheus.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		r.Write(w)
+	})
+}
+
+// Handler serves the Default registry.
+func Handler() http.Handler {
+	return Default.Handler()
+}
+
+// desc holds the identity shared by every child of a labelled metric.
+type desc struct {
+	name   string
+	help   string
+	labels []string
+}
+
+func (d *desc) key(values []string) string {
+	if len(values) != len(d.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", d.name, len(d.labels), len(values)))
+	}
+	return strings.Join(values, "\xff")
+}
+
+func (d *desc) header(w io.Writer, typ string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", d.name, d.help, d.name, typ)
+}
+
+// labelString renders label pairs, with optional extra pairs appended, in
+// Prometheus {k="v",...} syntax.
+func (d *desc) labelString(values []string, extra ...string) string {
+	if len(d.labels) == 0 && len(extra) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	n := 0
+	add := func(k, v string) {
+		if n > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(k)
+		b.WriteString(`="`)
+		b.WriteString(escapeLabel(v))
+		b.WriteByte('"')
+		n++
+	}
+	for i, l := range d.labels {
+		add(l, values[i])
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		add(extra[i], extra[i+1])
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+func escapeLabel(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v)
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// values is a labelled set of float samples.
+type values struct {
+	desc
+	typ string
+
+	mu      sync.Mutex
+	samples map[string]float64
+	labels  map[string][]string
+}
+
+func newValues(typ, name, help string, labels []string) *values {
+	return &values{
+		desc:    desc{name: name, help: help, labels: labels},
+		typ:     typ,
+		samples: make(map[string]float64),
+		labels:  make(map[string][]string),
+	}
+}
+
+func (v *values) add(delta float64, labelValues []string) {
+	k := v.key(labelValues)
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if _, ok := v.labels[k]; !ok {
+		v.labels[k] = append([]string(nil), labelValues...)
+	}
+	v.samples[k] += delta
+}
+
+func (v *values) get(labelValues []string) float64 {
+	k := v.key(labelValues)
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.samples[k]
+}
+
+func (v *values) write(w io.Writer) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.header(w, v.typ)
+	for _, k := range sortedKeys(v.samples) {
+		fmt.Fprintf(w, "%s%s %s\n", v.name, v.labelString(v.labels[k]), formatFloat(v.samples[k]))
+	}
+}
+
+// CounterVec is a monotonically increasing counter partitioned by labels.
+type CounterVec struct{ v *values }
+
+// NewCounterVec registers a counter with the Default registry.
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	return Default.NewCounterVec(name, help, labels...)
+}
+
+// NewCounterVec registers a counter with r.
+func (r *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{v: newValues("counter", name, help, labels)}
+	r.register(c.v)
+	return c
+}
+
+// Inc adds one to the counter for labelValues.
+func (c *CounterVec) Inc(labelValues ...string) { c.v.add(1, labelValues) }
+
+// Add adds delta, which must not be negative, to the counter for labelValues.
+func (c *CounterVec) Add(delta float64, labelValues ...string) {
+	if delta < 0 {
+		panic("metrics: counter cannot decrease")
+	}
+	c.v.add(delta, labelValues)
+}
+
+// Value returns the current counter value for labelValues.
+func (c *CounterVec) Value(labelValues ...string) float64 { return c.v.get(labelValues) }
+
+// GaugeVec is a value that can go up and down, partitioned by labels.
+type GaugeVec struct{ v *values }
+
+// NewGaugeVec registers a gauge with the Default registry.
+func NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	return Default.NewGaugeVec(name, help, labels...)
+}
+
+// NewGaugeVec registers a gauge with r.
+func (r *Registry) NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	g := &GaugeVec{v: newValues("gauge", name, help, labels)}
+	r.register(g.v)
+	return g
+}
+
+// Add adds delta, which may be negative, to the gauge for labelValues.
+func (g *GaugeVec) Add(delta float64, labelValues ...string) { g.v.add(delta, labelValues) }
+
+// Inc adds one to the gauge for labelValues.
+func (g *GaugeVec) Inc(labelValues ...string) { g.v.add(1, labelValues) }
+
+// Dec subtracts one from the gauge for labelValues.
+func (g *GaugeVec) Dec(labelValues ...string) { g.v.add(-1, labelValues) }
+
+// Value returns the current gauge value for labelValues.
+func (g *GaugeVec) Value(labelValues ...string) float64 { return g.v.get(labelValues) }
+
+// HistogramVec counts observations into cumulative buckets, partitioned by
+// labels.
+type HistogramVec struct {
+	desc
+	buckets []float64
+
+	mu     sync.Mutex
+	series map[string]*histogramSeries
+}
+
+type histogramSeries struct {
+	labels []string
+	counts []uint64 // per bucket, non-cumulative
+	count  uint64
+	sum    float64
+}
+
+// NewHistogramVec registers a histogram with the Default registry. Nil
+// buckets selects DefaultBuckets.
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	return Default.NewHistogramVec(name, help, buckets, labels...)
+}
+
+// NewHistogramVec registers a histogram with r. Nil buckets selects
+// DefaultBuckets.
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	if buckets == nil {
+		buckets = DefaultBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+
+	h := &HistogramVec{
+		desc:    desc{name: name, help: help, labels: labels},
+		buckets: buckets,
+		series:  make(map[string]*histogramSeries),
+	}
+	r.register(h)
+	return h
+}
+
+// Observe records v for labelValues.
+func (h *HistogramVec) Observe(v float64, labelValues ...string) {
+	k := h.key(labelValues)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s, ok := h.series[k]
+	if !ok {
+		s = &histogramSeries{
+			labels: append([]string(nil), labelValues...),
+			counts: make([]uint64, len(h.buckets)),
+		}
+		h.series[k] = s
+	}
+	for i, upper := range h.buckets {
+		if v <= upper {
+			s.counts[i]++
+			break
+		}
+	}
+	s.count++
+	s.sum += v
+}
+
+// Count returns the number of observations recorded for labelValues.
+func (h *HistogramVec) Count(labelValues ...string) uint64 {
+	k := h.key(labelValues)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if s, ok := h.series[k]; ok {
+		return s.count
+	}
+	return 0
+}
+
+func (h *HistogramVec) write(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.header(w, "histogram")
+	for _, k := range sortedKeys(h.series) {
+		s := h.series[k]
+		var cumulative uint64
+		for i, upper := range h.buckets {
+			cumulative += s.counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.labelString(s.labels, "le", formatFloat(upper)), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.labelString(s.labels, "le", "+Inf"), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, h.labelString(s.labels), formatFloat(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, h.labelString(s.labels), s.count)
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,51 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRegistry_WriteTo(t *testing.T) {
+	r := NewRegistry()
+	requests := r.NewCounterVec("test_requests_total", "Requests handled.", "code")
+	latency := r.NewHistogramVec("test_latency_seconds", "Request latency.", []float64{0.1, 1}, "endpoint")
+
+	requests.Inc("200")
+	requests.Inc("200")
+	requests.Add(3, "500")
+	latency.Observe(0.05, "/reply")
+	latency.Observe(0.5, "/reply")
+	latency.Observe(5, "/reply")
+
+	var b strings.Builder
+	r.Write(&b)
+	out := b.String()
+
+	for _, want := range []string{
+		"# TYPE test_requests_total counter",
+		`test_requests_total{code="200"} 2`,
+		`test_requests_total{code="500"} 3`,
+		"# TYPE test_latency_seconds histogram",
+		`test_latency_seconds_bucket{endpoint="/reply",le="0.1"} 1`,
+		`test_latency_seconds_bucket{endpoint="/reply",le="1"} 2`,
+		`test_latency_seconds_bucket{endpoint="/reply",le="+Inf"} 3`,
+		`test_latency_seconds_sum{endpoint="/reply"} 5.55`,
+		`test_latency_seconds_count{endpoint="/reply"} 3`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected output to contain %q, got:\n%s", want, out)
+		}
+	}
+}
+
+func TestLabelEscaping(t *testing.T) {
+	r := NewRegistry()
+	c := r.NewCounterVec("test_total", "Test.", "path")
+	c.Inc("a\"b\\c\n")
+
+	var b strings.Builder
+	r.Write(&b)
+	if !strings.Contains(b.String(), `test_total{path="a\"b\\c\n"} 1`) {
+		t.Errorf("expected escaped label, got:\n%s", b.String())
+	}
+}
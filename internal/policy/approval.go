@@ -0,0 +1,93 @@
+package policy
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"slices"
+)
+
+// ApprovalAction is the outcome of evaluating an ApprovalPolicy.
+type ApprovalAction string
+
+const (
+	// ApprovalEscalate forwards the confirmation request to the ADK client.
+	ApprovalEscalate ApprovalAction = ""
+	// ApprovalApprove confirms the tool call on the client's behalf.
+	ApprovalApprove ApprovalAction = "approve"
+	// ApprovalDeny rejects the tool call on the client's behalf.
+	ApprovalDeny ApprovalAction = "deny"
+)
+
+// ApprovalRule decides a tool confirmation request when all of its
+// conditions match.
+type ApprovalRule struct {
+	// Tool is a path.Match pattern selecting the tools the rule applies to.
+	Tool string `json:"tool"`
+	// Arguments maps argument names to regexps that must all match the
+	// argument's string value.
+	Arguments map[string]string `json:"arguments,omitempty"`
+	// Users limits the rule to the listed ADK users; empty means everyone.
+	Users []string `json:"users,omitempty"`
+	// Action is "approve" or "deny".
+	Action ApprovalAction `json:"action"`
+
+	args map[string]*regexp.Regexp
+}
+
+// ApprovalPolicy auto-answers Goose tool confirmation requests. Rules are
+// evaluated in order and the first match wins; requests no rule matches are
+// escalated to the ADK client.
+type ApprovalPolicy struct {
+	Rules []ApprovalRule `json:"rules,omitempty"`
+}
+
+// Compile validates the policy and prepares its regular expressions. It must
+// be called before Decide.
+func (p *ApprovalPolicy) Compile() error {
+	for i := range p.Rules {
+		rule := &p.Rules[i]
+		if rule.Action != ApprovalApprove && rule.Action != ApprovalDeny {
+			return fmt.Errorf("approval rule %d: action must be %q or %q, got %q", i, ApprovalApprove, ApprovalDeny, rule.Action)
+		}
+		if _, err := path.Match(rule.Tool, ""); err != nil {
+			return fmt.Errorf("approval rule %d: tool pattern %q: %w", i, rule.Tool, err)
+		}
+		rule.args = make(map[string]*regexp.Regexp, len(rule.Arguments))
+		for name, pattern := range rule.Arguments {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return fmt.Errorf("approval rule %d: argument %q: %w", i, name, err)
+			}
+			rule.args[name] = re
+		}
+	}
+	return nil
+}
+
+// Decide returns the action for a confirmation request raised for toolName
+// with args on behalf of user.
+func (p ApprovalPolicy) Decide(user, toolName string, args map[string]any) ApprovalAction {
+	for _, rule := range p.Rules {
+		if rule.matches(user, toolName, args) {
+			return rule.Action
+		}
+	}
+	return ApprovalEscalate
+}
+
+func (r ApprovalRule) matches(user, toolName string, args map[string]any) bool {
+	if ok, _ := path.Match(r.Tool, toolName); !ok {
+		return false
+	}
+	if len(r.Users) > 0 && !slices.Contains(r.Users, user) {
+		return false
+	}
+	for name, re := range r.args {
+		value, ok := args[name].(string)
+		if !ok || !re.MatchString(value) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,38 @@
+package policy
+
+import "testing"
+
+func TestApprovalPolicy_Decide(t *testing.T) {
+	p := ApprovalPolicy{Rules: []ApprovalRule{
+		{Tool: "developer__shell", Arguments: map[string]string{"command": `^(ls|cat|git status)\b`}, Action: ApprovalApprove},
+		{Tool: "developer__shell", Users: []string{"admin"}, Action: ApprovalApprove},
+		{Tool: "developer__shell", Arguments: map[string]string{"command": `\brm\b`}, Action: ApprovalDeny},
+	}}
+	if err := p.Compile(); err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+
+	tests := []struct {
+		user, tool, command string
+		want                ApprovalAction
+	}{
+		{"alice", "developer__shell", "ls -la", ApprovalApprove},
+		{"alice", "developer__shell", "rm -rf build", ApprovalDeny},
+		{"admin", "developer__shell", "rm -rf build", ApprovalApprove},
+		{"alice", "developer__shell", "make test", ApprovalEscalate},
+		{"alice", "developer__text_editor", "ls", ApprovalEscalate},
+	}
+	for _, tt := range tests {
+		got := p.Decide(tt.user, tt.tool, map[string]any{"command": tt.command})
+		if got != tt.want {
+			t.Errorf("Decide(%q, %q, %q) = %q, want %q", tt.user, tt.tool, tt.command, got, tt.want)
+		}
+	}
+}
+
+func TestApprovalPolicy_CompileRejectsUnknownAction(t *testing.T) {
+	p := ApprovalPolicy{Rules: []ApprovalRule{{Tool: "*", Action: "maybe"}}}
+	if err := p.Compile(); err == nil {
+		t.Fatal("expected error for unknown action")
+	}
+}
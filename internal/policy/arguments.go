@@ -0,0 +1,103 @@
+package policy
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+)
+
+// ArgumentHook validates the arguments of a Goose tool call before the call
+// is surfaced to the ADK client or approved. Returning an error rejects the
+// call. Goose runs the call with the arguments it asked for, so a hook must
+// not change them; a call whose arguments a hook changed is rejected.
+type ArgumentHook func(toolName string, args map[string]any) error
+
+// ArgumentRule is a configured check on one string argument of matching tools.
+type ArgumentRule struct {
+	// Tool is a path.Match pattern selecting the tools the rule applies to.
+	Tool string `json:"tool"`
+	// Argument names the argument to inspect, e.g. "command" or "path".
+	Argument string `json:"argument"`
+	// Deny rejects the call if the argument matches any of these regexps.
+	Deny []string `json:"deny,omitempty"`
+	// Allow rejects the call unless the argument matches one of these regexps.
+	Allow []string `json:"allow,omitempty"`
+	// ConfinePath resolves the argument as a file path relative to the
+	// session's working directory, as Goose does, and rejects paths that
+	// escape the working directory, also through symlinks.
+	ConfinePath bool `json:"confinePath,omitempty"`
+
+	deny  []*regexp.Regexp
+	allow []*regexp.Regexp
+}
+
+// Compile validates the rule and prepares its regular expressions. It must be
+// called before Hook.
+func (r *ArgumentRule) Compile() error {
+	if r.Tool == "" || r.Argument == "" {
+		return fmt.Errorf("argument rule requires both tool and argument")
+	}
+	if _, err := path.Match(r.Tool, ""); err != nil {
+		return fmt.Errorf("argument rule tool pattern %q: %w", r.Tool, err)
+	}
+
+	var err error
+	if r.deny, err = compileAll(r.Deny); err != nil {
+		return err
+	}
+	if r.allow, err = compileAll(r.Allow); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Hook returns an ArgumentHook enforcing the rule. Confined paths are
+// resolved against root.
+func (r *ArgumentRule) Hook(root string) ArgumentHook {
+	return func(toolName string, args map[string]any) error {
+		if ok, _ := path.Match(r.Tool, toolName); !ok {
+			return nil
+		}
+		value, ok := args[r.Argument].(string)
+		if !ok {
+			return nil
+		}
+
+		for _, re := range r.deny {
+			if re.MatchString(value) {
+				return fmt.Errorf("tool %q argument %q matches denied pattern %q", toolName, r.Argument, re.String())
+			}
+		}
+		if len(r.allow) > 0 && !matchesAny(r.allow, value) {
+			return fmt.Errorf("tool %q argument %q does not match any allowed pattern", toolName, r.Argument)
+		}
+
+		if r.ConfinePath {
+			if _, err := ResolveWithin(root, value); err != nil {
+				return fmt.Errorf("tool %q argument %q: %w", toolName, r.Argument, err)
+			}
+		}
+		return nil
+	}
+}
+
+func compileAll(patterns []string) ([]*regexp.Regexp, error) {
+	out := make([]*regexp.Regexp, 0, len(patterns))
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("argument rule pattern %q: %w", p, err)
+		}
+		out = append(out, re)
+	}
+	return out, nil
+}
+
+func matchesAny(res []*regexp.Regexp, s string) bool {
+	for _, re := range res {
+		if re.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,96 @@
+package policy
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestArgumentRule_DenyCommand(t *testing.T) {
+	rule := ArgumentRule{
+		Tool:     "developer__shell",
+		Argument: "command",
+		Deny:     []string{`\brm\s+-rf\b`, `\bsudo\b`},
+	}
+	if err := rule.Compile(); err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+	hook := rule.Hook("/work")
+
+	if err := hook("developer__shell", map[string]any{"command": "ls -la"}); err != nil {
+		t.Errorf("expected ls to pass, got %v", err)
+	}
+	if err := hook("developer__shell", map[string]any{"command": "sudo rm -rf /"}); err == nil {
+		t.Error("expected sudo rm -rf to be rejected")
+	}
+	if err := hook("developer__text_editor", map[string]any{"command": "sudo"}); err != nil {
+		t.Errorf("expected rule to ignore other tools, got %v", err)
+	}
+}
+
+func TestArgumentRule_ConfinePath(t *testing.T) {
+	rule := ArgumentRule{Tool: "developer__*", Argument: "path", ConfinePath: true}
+	if err := rule.Compile(); err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+	hook := rule.Hook("/work")
+
+	for _, p := range []string{"src/main.go", "/work/src/main.go"} {
+		args := map[string]any{"path": p}
+		if err := hook("developer__text_editor", args); err != nil {
+			t.Fatalf("%q: unexpected error: %v", p, err)
+		}
+		if args["path"] != p {
+			t.Errorf("expected %q to be left as Goose sent it, got %v", p, args["path"])
+		}
+	}
+
+	for _, p := range []string{"../etc/passwd", "/etc/passwd", "a/../../b"} {
+		if err := hook("developer__text_editor", map[string]any{"path": p}); err == nil {
+			t.Errorf("expected %q to be rejected", p)
+		}
+	}
+}
+
+func TestResolveWithin(t *testing.T) {
+	root := t.TempDir()
+	outside := t.TempDir()
+	if err := os.Symlink(outside, filepath.Join(root, "escape")); err != nil {
+		t.Fatalf("symlink: %v", err)
+	}
+	if err := os.Mkdir(filepath.Join(root, "sub"), 0o700); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+
+	for _, p := range []string{"sub/new.txt", "new/dir/file", filepath.Join(root, "sub")} {
+		if _, err := ResolveWithin(root, p); err != nil {
+			t.Errorf("ResolveWithin(%q): unexpected error %v", p, err)
+		}
+	}
+	for _, p := range []string{"../x", "sub/../../x", "escape", "escape/new.txt", outside} {
+		if _, err := ResolveWithin(root, p); !errors.Is(err, ErrPathEscape) {
+			t.Errorf("ResolveWithin(%q): expected ErrPathEscape, got %v", p, err)
+		}
+	}
+
+	rule := ArgumentRule{Tool: "developer__*", Argument: "path", ConfinePath: true}
+	if err := rule.Compile(); err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+	if err := rule.Hook(root)("developer__text_editor", map[string]any{"path": "escape/passwd"}); err == nil {
+		t.Error("expected a path through a symlink out of the root to be rejected")
+	}
+}
+
+func TestArgumentRule_CompileErrors(t *testing.T) {
+	bad := []ArgumentRule{
+		{Argument: "command"},
+		{Tool: "shell", Argument: "command", Deny: []string{"("}},
+	}
+	for _, rule := range bad {
+		if err := rule.Compile(); err == nil {
+			t.Errorf("expected compile error for %+v", rule)
+		}
+	}
+}
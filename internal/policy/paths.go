@@ -0,0 +1,71 @@
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrPathEscape is returned for a path that lies, or through symlinks
+// leads, outside the directory it must stay in.
+var ErrPathEscape = errors.New("path escapes its root")
+
+// ResolveWithin returns the absolute path p, relative to root unless it is
+// absolute, with the symlinks in its existing part resolved. It fails with
+// ErrPathEscape if p climbs out of root with "..", or if a symlink under
+// root leads out of it, so that Goose agents cannot turn the files they
+// name, or that the proxy reads or writes for them, into links elsewhere.
+// root itself may be a symlink, and neither needs to exist.
+func ResolveWithin(root, p string) (string, error) {
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return "", fmt.Errorf("resolve %s: %w", root, err)
+	}
+	if !filepath.IsAbs(p) {
+		p = filepath.Join(absRoot, p)
+	}
+	p = filepath.Clean(p)
+	if !isWithin(absRoot, p) {
+		return "", fmt.Errorf("%w: %s is not under %s", ErrPathEscape, p, absRoot)
+	}
+
+	realRoot, err := evalExisting(absRoot)
+	if err != nil {
+		return "", err
+	}
+	resolved, err := evalExisting(p)
+	if err != nil {
+		return "", err
+	}
+	if !isWithin(realRoot, resolved) {
+		return "", fmt.Errorf("%w: %s leads out of %s", ErrPathEscape, p, absRoot)
+	}
+	return resolved, nil
+}
+
+// evalExisting resolves the symlinks in the longest existing prefix of the
+// clean absolute path p; what does not exist yet cannot be a symlink.
+func evalExisting(p string) (string, error) {
+	existing, rest := p, ""
+	for {
+		resolved, err := filepath.EvalSymlinks(existing)
+		if err == nil {
+			return filepath.Join(resolved, rest), nil
+		}
+		parent := filepath.Dir(existing)
+		if !os.IsNotExist(err) || parent == existing {
+			return "", fmt.Errorf("resolve %s: %w", p, err)
+		}
+		rest = filepath.Join(filepath.Base(existing), rest)
+		existing = parent
+	}
+}
+
+// isWithin reports whether the clean absolute path p is root or lies under
+// it.
+func isWithin(root, p string) bool {
+	rel, err := filepath.Rel(root, p)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
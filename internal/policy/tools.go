@@ -0,0 +1,40 @@
+package policy
+
+import (
+	"fmt"
+	"path"
+)
+
+// ToolPolicy is a per-app allowlist/denylist of Goose tool names. Patterns use
+// path.Match syntax, so "developer__*" matches every tool exposed by the
+// developer extension.
+type ToolPolicy struct {
+	Allow []string `json:"allow,omitempty"`
+	Deny  []string `json:"deny,omitempty"`
+}
+
+// Check reports whether toolName may run under the policy. Deny patterns take
+// precedence over allow patterns; when Allow is non-empty a tool must match at
+// least one of its entries. The returned reason explains a denial.
+func (p ToolPolicy) Check(toolName string) (bool, string) {
+	if pattern, ok := matchAny(p.Deny, toolName); ok {
+		return false, fmt.Sprintf("tool %q matches deny pattern %q", toolName, pattern)
+	}
+	if len(p.Allow) == 0 {
+		return true, ""
+	}
+	if _, ok := matchAny(p.Allow, toolName); ok {
+		return true, ""
+	}
+	return false, fmt.Sprintf("tool %q is not in the allowlist", toolName)
+}
+
+// matchAny returns the first pattern in patterns that matches name.
+func matchAny(patterns []string, name string) (string, bool) {
+	for _, pattern := range patterns {
+		if ok, err := path.Match(pattern, name); err == nil && ok {
+			return pattern, true
+		}
+	}
+	return "", false
+}
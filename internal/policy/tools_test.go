@@ -0,0 +1,37 @@
+package policy
+
+import "testing"
+
+func TestToolPolicy_Check(t *testing.T) {
+	p := ToolPolicy{
+		Allow: []string{"developer__*", "memory__remember"},
+		Deny:  []string{"developer__shell"},
+	}
+
+	tests := []struct {
+		tool string
+		want bool
+	}{
+		{"developer__text_editor", true},
+		{"developer__shell", false},
+		{"memory__remember", true},
+		{"computercontroller__web_scrape", false},
+	}
+
+	for _, tt := range tests {
+		got, reason := p.Check(tt.tool)
+		if got != tt.want {
+			t.Errorf("Check(%q) = %v (%s), want %v", tt.tool, got, reason, tt.want)
+		}
+		if !got && reason == "" {
+			t.Errorf("Check(%q): expected a denial reason", tt.tool)
+		}
+	}
+}
+
+func TestToolPolicy_EmptyAllowsEverything(t *testing.T) {
+	var p ToolPolicy
+	if ok, _ := p.Check("developer__shell"); !ok {
+		t.Error("expected empty policy to allow all tools")
+	}
+}
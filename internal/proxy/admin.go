@@ -0,0 +1,97 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/innomon/adk2goose/gooseclient"
+)
+
+// handleAdminListSessions lists every mapped session across apps and users,
+// including its Goose session ID and labels. It accepts the same ?label=
+// filters as the ADK list endpoint.
+func (h *Handler) handleAdminListSessions(w http.ResponseWriter, r *http.Request) {
+	labels, err := parseLabelFilter(r.URL.Query()["label"])
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, h.sessions.ListSessions("", "", labels))
+}
+
+// handleAdminGetGooseConfig returns the Goose server's configuration, with
+// secrets masked by Goose.
+func (h *Handler) handleAdminGetGooseConfig(w http.ResponseWriter, r *http.Request) {
+	resp, err := h.client.ReadAllConfig(r.Context())
+	if err != nil {
+		writeError(w, http.StatusBadGateway, fmt.Sprintf("read goose config: %v", err))
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// handleAdminGetGooseConfigKey returns a single Goose configuration value.
+// ?secret=true reads it from Goose's secret store, which is only served on
+// the separate admin listener: on the client port, a leaked admin token
+// would otherwise expose every provider key.
+func (h *Handler) handleAdminGetGooseConfigKey(w http.ResponseWriter, r *http.Request) {
+	key := r.PathValue("key")
+	secret := r.URL.Query().Get("secret") == "true"
+	if secret && h.cfg.AdminListenAddr == "" {
+		writeError(w, http.StatusForbidden, "secret config values are only served on ADMIN_LISTEN_ADDR")
+		return
+	}
+	value, err := h.client.ReadConfig(r.Context(), key, secret)
+	if err != nil {
+		writeError(w, http.StatusBadGateway, fmt.Sprintf("read goose config %s: %v", key, err))
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"key": key, "value": value})
+}
+
+// GooseConfigUpdate is the JSON body of the admin Goose config upsert
+// endpoint.
+type GooseConfigUpdate struct {
+	Value    any  `json:"value"`
+	IsSecret bool `json:"isSecret,omitempty"`
+}
+
+// handleAdminPutGooseConfigKey creates or updates a Goose configuration
+// value, such as a provider API key.
+func (h *Handler) handleAdminPutGooseConfigKey(w http.ResponseWriter, r *http.Request) {
+	key := r.PathValue("key")
+
+	var req GooseConfigUpdate
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("decode request: %v", err))
+		return
+	}
+	if req.Value == nil {
+		writeError(w, http.StatusBadRequest, "value is required")
+		return
+	}
+
+	err := h.client.UpsertConfig(r.Context(), &gooseclient.UpsertConfigRequest{
+		Key:      key,
+		Value:    req.Value,
+		IsSecret: req.IsSecret,
+	})
+	if err != nil {
+		writeError(w, http.StatusBadGateway, fmt.Sprintf("update goose config %s: %v", key, err))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleAdminGoosePool reports the load of each Goose server of the pool
+// sessions are spread across.
+func (h *Handler) handleAdminGoosePool(w http.ResponseWriter, r *http.Request) {
+	pool := h.client.Pool()
+	if pool == nil {
+		writeError(w, http.StatusNotFound, "no Goose pool configured")
+		return
+	}
+	writeJSON(w, http.StatusOK, pool.Stats())
+}
@@ -0,0 +1,134 @@
+package proxy
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/innomon/adk2goose/internal/config"
+)
+
+// priority orders requests competing for stream slots; higher is served
+// first.
+type priority int
+
+const (
+	priorityLow priority = iota
+	priorityNormal
+	priorityHigh
+	numPriorities
+)
+
+// parsePriority maps a configured priority class to its priority. Unknown
+// classes, which config validation rejects, are normal.
+func parsePriority(class string) priority {
+	switch class {
+	case config.PriorityLow:
+		return priorityLow
+	case config.PriorityHigh:
+		return priorityHigh
+	}
+	return priorityNormal
+}
+
+// admission caps the number of concurrently open run_sse streams. Requests
+// over the cap queue for up to queueTimeout before being turned away. When a
+// slot frees, it goes to the longest-waiting request of the highest
+// priority, so interactive traffic jumps ahead of queued batch work.
+type admission struct {
+	limit        int
+	queueTimeout time.Duration
+
+	mu      sync.Mutex
+	inUse   int
+	waiting [numPriorities][]chan struct{} // closed when granted a slot
+}
+
+// newAdmission returns an admission controller allowing limit concurrent
+// streams, or nil if limit is not positive.
+func newAdmission(limit int, queueTimeout time.Duration) *admission {
+	if limit <= 0 {
+		return nil
+	}
+	return &admission{
+		limit:        limit,
+		queueTimeout: queueTimeout,
+	}
+}
+
+// acquire reserves a stream slot for a request of priority p, waiting up to
+// the queue timeout. It reports false if no slot became available or ctx
+// ended first. A nil admission always admits.
+func (a *admission) acquire(ctx context.Context, p priority) bool {
+	if a == nil {
+		return true
+	}
+
+	a.mu.Lock()
+	if a.inUse < a.limit {
+		a.inUse++
+		a.mu.Unlock()
+		return true
+	}
+	if a.queueTimeout <= 0 {
+		a.mu.Unlock()
+		return false
+	}
+	granted := make(chan struct{})
+	a.waiting[p] = append(a.waiting[p], granted)
+	a.mu.Unlock()
+
+	timer := time.NewTimer(a.queueTimeout)
+	defer timer.Stop()
+	select {
+	case <-granted:
+		return true
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	select {
+	case <-granted:
+		// The slot was handed over while giving up; keep it.
+		return true
+	default:
+	}
+	for i, ch := range a.waiting[p] {
+		if ch == granted {
+			a.waiting[p] = append(a.waiting[p][:i], a.waiting[p][i+1:]...)
+			break
+		}
+	}
+	return false
+}
+
+// release frees a slot reserved by acquire, handing it to the next waiting
+// request, if any.
+func (a *admission) release() {
+	if a == nil {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for p := numPriorities - 1; p >= priorityLow; p-- {
+		if len(a.waiting[p]) > 0 {
+			close(a.waiting[p][0])
+			a.waiting[p] = a.waiting[p][1:]
+			return
+		}
+	}
+	a.inUse--
+}
+
+// retryAfter is the Retry-After value, in whole seconds, sent with 503s.
+func (a *admission) retryAfter() string {
+	secs := math.Ceil(a.queueTimeout.Seconds())
+	if secs < 1 {
+		secs = 1
+	}
+	return strconv.Itoa(int(secs))
+}
@@ -0,0 +1,91 @@
+package proxy
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestAdmission_RejectsOverLimit(t *testing.T) {
+	a := newAdmission(1, 0)
+	ctx := context.Background()
+
+	if !a.acquire(ctx, priorityNormal) {
+		t.Fatal("expected first stream to be admitted")
+	}
+	if a.acquire(ctx, priorityNormal) {
+		t.Fatal("expected second stream to be rejected")
+	}
+	a.release()
+	if !a.acquire(ctx, priorityNormal) {
+		t.Fatal("expected stream to be admitted after release")
+	}
+}
+
+func TestAdmission_QueuesBriefly(t *testing.T) {
+	a := newAdmission(1, time.Second)
+	ctx := context.Background()
+	a.acquire(ctx, priorityNormal)
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		a.release()
+	}()
+	if !a.acquire(ctx, priorityNormal) {
+		t.Fatal("expected queued stream to be admitted once a slot frees")
+	}
+	if got := a.retryAfter(); got != "1" {
+		t.Errorf("expected Retry-After 1, got %q", got)
+	}
+}
+
+func TestAdmission_NilAdmitsEverything(t *testing.T) {
+	var a *admission
+	if !a.acquire(context.Background(), priorityNormal) {
+		t.Fatal("expected nil admission to admit")
+	}
+	a.release()
+}
+
+func TestAdmission_HigherPriorityServedFirst(t *testing.T) {
+	a := newAdmission(1, 5*time.Second)
+	ctx := context.Background()
+	a.acquire(ctx, priorityNormal)
+
+	order := make(chan priority, 2)
+	queue := func(p priority) {
+		if a.acquire(ctx, p) {
+			order <- p
+			a.release()
+		}
+	}
+	go queue(priorityLow)
+	waitForWaiters(t, a, 1)
+	go queue(priorityHigh)
+	waitForWaiters(t, a, 2)
+
+	// The batch request queued first, but the interactive one jumps it.
+	a.release()
+	if first, second := <-order, <-order; first != priorityHigh || second != priorityLow {
+		t.Fatalf("expected high then low priority, got %v then %v", first, second)
+	}
+}
+
+// waitForWaiters waits until n requests are queued on a.
+func waitForWaiters(t *testing.T, a *admission, n int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		a.mu.Lock()
+		queued := 0
+		for _, w := range a.waiting {
+			queued += len(w)
+		}
+		a.mu.Unlock()
+		if queued == n {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("expected %d queued requests", n)
+}
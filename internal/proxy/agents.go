@@ -0,0 +1,34 @@
+package proxy
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/innomon/adk2goose/internal/config"
+)
+
+// resolveAgent returns the sub-agent a run targets: the explicit agent
+// selector, else the last segment of the ADK branch (e.g. "root.researcher"),
+// else the app's default agent. An empty name means the root Goose session.
+func resolveAgent(app config.AppConfig, req *RunSSERequest) (string, *config.AgentConfig, error) {
+	name := req.Agent
+	if name == "" && req.Branch != "" {
+		name = req.Branch[strings.LastIndex(req.Branch, ".")+1:]
+		// A branch naming only the root agent selects no sub-agent.
+		if _, ok := app.Agents[name]; !ok && !strings.Contains(req.Branch, ".") {
+			name = ""
+		}
+	}
+	if name == "" {
+		name = app.DefaultAgent
+	}
+	if name == "" {
+		return "", nil, nil
+	}
+
+	agent, ok := app.Agents[name]
+	if !ok {
+		return "", nil, fmt.Errorf("agent %q is not configured for this app", name)
+	}
+	return name, &agent, nil
+}
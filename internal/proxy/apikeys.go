@@ -0,0 +1,208 @@
+package proxy
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/innomon/adk2goose/internal/config"
+)
+
+// apiKeyHeader carries a client API key, as an alternative to an
+// Authorization bearer token.
+const apiKeyHeader = "X-API-Key"
+
+// errNoAPIKey is returned for requests that present no API key.
+var errNoAPIKey = errors.New("missing API key")
+
+// keyring holds the client API keys of the keys file, replaced whole each
+// time the file changes.
+type keyring struct {
+	file string
+
+	mu      sync.RWMutex
+	keys    []config.APIKey
+	byHash  map[[sha256.Size]byte]*config.APIKey
+	modTime time.Time
+	size    int64
+}
+
+// newKeyring creates a keyring holding keys, as read from file.
+func newKeyring(file string, keys []config.APIKey) *keyring {
+	k := &keyring{file: file}
+	if info, err := os.Stat(file); err == nil {
+		k.modTime, k.size = info.ModTime(), info.Size()
+	}
+	k.set(keys)
+	return k
+}
+
+func (k *keyring) set(keys []config.APIKey) {
+	byHash := make(map[[sha256.Size]byte]*config.APIKey, len(keys))
+	for i := range keys {
+		byHash[keys[i].Digest()] = &keys[i]
+	}
+	k.mu.Lock()
+	k.keys, k.byHash = keys, byHash
+	k.mu.Unlock()
+}
+
+// reload reads the keys file again if it changed since it was last read.
+// If it cannot be read or is invalid, the current keys stay in use. It
+// reports whether the keys were replaced.
+func (k *keyring) reload() (bool, error) {
+	info, err := os.Stat(k.file)
+	if err != nil {
+		return false, err
+	}
+	if info.ModTime().Equal(k.modTime) && info.Size() == k.size {
+		return false, nil
+	}
+	// A broken file is reported once, not on every check.
+	k.modTime, k.size = info.ModTime(), info.Size()
+	keys, err := config.LoadAPIKeys(k.file)
+	if err != nil {
+		return false, err
+	}
+	k.set(keys)
+	return true, nil
+}
+
+// lookup returns the valid key the request presents, as a bearer token or
+// in the X-API-Key header.
+func (k *keyring) lookup(r *http.Request) (*config.APIKey, error) {
+	secret := r.Header.Get(apiKeyHeader)
+	if secret == "" {
+		secret, _ = strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	}
+	if secret == "" {
+		return nil, errNoAPIKey
+	}
+	k.mu.RLock()
+	key, ok := k.byHash[sha256.Sum256([]byte(secret))]
+	k.mu.RUnlock()
+	switch {
+	case !ok:
+		return nil, errors.New("invalid API key")
+	case key.Revoked:
+		return nil, fmt.Errorf("API key %s is revoked", key.Name)
+	case key.Expired(time.Now()):
+		return nil, fmt.Errorf("API key %s expired", key.Name)
+	}
+	return key, nil
+}
+
+// authenticate is an Authenticator for API keys: user keys authenticate as
+// their user, and service and admin keys as the user in the path, on whose
+// behalf they act.
+func (k *keyring) authenticate(r *http.Request) (string, error) {
+	key, err := k.lookup(r)
+	if err != nil {
+		return "", err
+	}
+	apiKeyRequests.Inc(key.Name)
+	if key.Role == config.APIKeyRoleUser {
+		return key.User, nil
+	}
+	return r.PathValue("user"), nil
+}
+
+// admits reports whether the request presents a valid admin key.
+func (k *keyring) admits(r *http.Request) bool {
+	key, err := k.lookup(r)
+	if err != nil || key.Role != config.APIKeyRoleAdmin {
+		return false
+	}
+	apiKeyRequests.Inc(key.Name)
+	return true
+}
+
+// hasAdmin reports whether the keys include an admin key, as of the last
+// reload.
+func (k *keyring) hasAdmin() bool {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	for i := range k.keys {
+		if k.keys[i].Role == config.APIKeyRoleAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+// APIKeyInfo describes an API key, without its secret, in the admin
+// listing.
+type APIKeyInfo struct {
+	Name      string     `json:"name"`
+	Role      string     `json:"role"`
+	User      string     `json:"user,omitempty"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+	Expired   bool       `json:"expired,omitempty"`
+	Revoked   bool       `json:"revoked,omitempty"`
+}
+
+// list describes the keys, in file order.
+func (k *keyring) list() []APIKeyInfo {
+	now := time.Now()
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	infos := make([]APIKeyInfo, 0, len(k.keys))
+	for i := range k.keys {
+		key := &k.keys[i]
+		info := APIKeyInfo{
+			Name:    key.Name,
+			Role:    key.Role,
+			User:    key.User,
+			Expired: key.Expired(now),
+			Revoked: key.Revoked,
+		}
+		if !key.ExpiresAt.IsZero() {
+			info.ExpiresAt = &key.ExpiresAt
+		}
+		infos = append(infos, info)
+	}
+	return infos
+}
+
+// RunAPIKeyReload reads the API keys file again every
+// APIKeysReloadInterval until ctx is done, picking up added, rotated, and
+// revoked keys. It returns at once without a keys file.
+func (h *Handler) RunAPIKeyReload(ctx context.Context) {
+	if h.keys == nil || h.cfg.APIKeysReloadInterval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(h.cfg.APIKeysReloadInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		changed, err := h.keys.reload()
+		if err != nil {
+			log.Printf("reload api keys: %v", err)
+			apiKeyReloads.Inc("failed")
+			continue
+		}
+		if changed {
+			log.Printf("reloaded api keys from %s", h.keys.file)
+			apiKeyReloads.Inc("ok")
+		}
+	}
+}
+
+func (h *Handler) handleAdminListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	if h.keys == nil {
+		writeJSON(w, http.StatusOK, []APIKeyInfo{})
+		return
+	}
+	writeJSON(w, http.StatusOK, h.keys.list())
+}
@@ -0,0 +1,414 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/innomon/adk2goose/internal/policy"
+	"google.golang.org/genai"
+)
+
+// artifactsDir holds copies of every artifact version, relative to the Goose
+// working directory.
+const artifactsDir = ".adk2goose/artifacts"
+
+// errArtifactNotFound is returned for unknown artifacts or versions.
+var errArtifactNotFound = errors.New("artifact not found")
+
+// fileStamp identifies one state of a file for change detection.
+type fileStamp struct {
+	size    int64
+	modTime time.Time
+}
+
+// outputState maps working-directory files, by slash-separated relative
+// path, to their stamps.
+type outputState map[string]fileStamp
+
+// scanOutputs records the regular files under root, skipping version
+// control, the proxy's own files, uploaded attachments, and the directories
+// skip. It stops after maxManifestFiles files.
+func scanOutputs(root string, skip []string) outputState {
+	skipped := make(map[string]bool, len(skip))
+	if absRoot, err := filepath.Abs(root); err == nil {
+		for _, dir := range skip {
+			if abs, err := filepath.Abs(dir); err == nil {
+				if rel, err := filepath.Rel(absRoot, abs); err == nil && filepath.IsLocal(rel) {
+					skipped[rel] = true
+				}
+			}
+		}
+	}
+	state := make(outputState)
+	filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			if path != root && (d.Name() == ".git" || d.Name() == ".adk2goose") ||
+				filepath.Dir(path) == root && d.Name() == uploadsDir {
+				return filepath.SkipDir
+			}
+			if rel, err := filepath.Rel(root, path); err == nil && skipped[rel] {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		if len(state) == maxManifestFiles {
+			return filepath.SkipAll
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return nil
+		}
+		state[filepath.ToSlash(rel)] = fileStamp{size: info.Size(), modTime: info.ModTime()}
+		return nil
+	})
+	return state
+}
+
+// scanOutputs records the files under root that may be Goose's outputs.
+func (s *artifactStore) scanOutputs(root string) outputState {
+	return scanOutputs(root, s.skip)
+}
+
+// changedSince lists, sorted, the files in s that are new or modified
+// compared to before.
+func (s outputState) changedSince(before outputState) []string {
+	var changed []string
+	for name, stamp := range s {
+		if prev, ok := before[name]; !ok || prev != stamp {
+			changed = append(changed, name)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+// artifactVersion is one saved version of a session artifact. Versions
+// removed by retention keep their number but have no path.
+type artifactVersion struct {
+	path     string
+	mimeType string
+	saved    time.Time
+}
+
+// artifactStore keeps versioned copies of the files Goose produced, per ADK
+// session, so earlier versions stay downloadable after Goose overwrites a
+// file.
+type artifactStore struct {
+	root string // the working directory dir lies in
+	dir  string
+
+	// skip lists the proxy's own directories that may lie in a working
+	// directory, such as EVENT_STORE_DIR, which are not Goose's outputs.
+	skip []string
+
+	mu       sync.Mutex
+	seq      int
+	sessions map[string]map[string][]artifactVersion // session → name → versions
+}
+
+// newArtifactStore creates a store keeping its files in the artifacts
+// folder under root.
+func newArtifactStore(root string) *artifactStore {
+	return &artifactStore{
+		root:     root,
+		dir:      filepath.Join(root, artifactsDir),
+		sessions: make(map[string]map[string][]artifactVersion),
+	}
+}
+
+// save copies src as the next version of the session's artifact name and
+// returns that version number.
+func (s *artifactStore) save(sessionID, name, src string) (int, error) {
+	return s.add(sessionID, name, func(dst string) error { return copyFile(dst, src) })
+}
+
+// saveData stores data as the next version of the session's artifact name
+// and returns that version number.
+func (s *artifactStore) saveData(sessionID, name string, data []byte) (int, error) {
+	return s.add(sessionID, name, func(dst string) error {
+		if err := os.MkdirAll(filepath.Dir(dst), 0o700); err != nil {
+			return err
+		}
+		return os.WriteFile(dst, data, 0o600)
+	})
+}
+
+// add records a new artifact version whose content write stores at the
+// given path.
+func (s *artifactStore) add(sessionID, name string, write func(dst string) error) (int, error) {
+	s.mu.Lock()
+	s.seq++
+	dst := filepath.Join(s.dir, strconv.Itoa(s.seq))
+	s.mu.Unlock()
+
+	if err := os.MkdirAll(s.dir, 0o700); err != nil {
+		return 0, fmt.Errorf("save artifact %s: %w", name, err)
+	}
+	if _, err := policy.ResolveWithin(s.root, dst); err != nil {
+		return 0, fmt.Errorf("save artifact %s: %w", name, err)
+	}
+
+	if err := write(dst); err != nil {
+		return 0, fmt.Errorf("save artifact %s: %w", name, err)
+	}
+	mimeType := mime.TypeByExtension(filepath.Ext(name))
+	if mimeType == "" {
+		mimeType = "application/octet-stream"
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	artifacts := s.sessions[sessionID]
+	if artifacts == nil {
+		artifacts = make(map[string][]artifactVersion)
+		s.sessions[sessionID] = artifacts
+	}
+	artifacts[name] = append(artifacts[name], artifactVersion{path: dst, mimeType: mimeType, saved: time.Now()})
+	return len(artifacts[name]) - 1, nil
+}
+
+// list returns the session's artifact names, sorted.
+func (s *artifactStore) list(sessionID string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	names := make([]string, 0, len(s.sessions[sessionID]))
+	for name := range s.sessions[sessionID] {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// versions returns the version numbers of a session artifact.
+func (s *artifactStore) versions(sessionID, name string) ([]int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	saved, ok := s.sessions[sessionID][name]
+	if !ok {
+		return nil, errArtifactNotFound
+	}
+	versions := make([]int, 0, len(saved))
+	for i, v := range saved {
+		if v.path != "" {
+			versions = append(versions, i)
+		}
+	}
+	return versions, nil
+}
+
+// load returns a version of a session artifact as an inline-data part; a
+// negative version means the latest.
+func (s *artifactStore) load(sessionID, name string, version int) (*genai.Part, error) {
+	s.mu.Lock()
+	saved := s.sessions[sessionID][name]
+	if version < 0 {
+		version = len(saved) - 1
+	}
+	if version < 0 || version >= len(saved) {
+		s.mu.Unlock()
+		return nil, errArtifactNotFound
+	}
+	v := saved[version]
+	s.mu.Unlock()
+	if v.path == "" {
+		return nil, errArtifactNotFound
+	}
+
+	data, err := os.ReadFile(v.path)
+	if err != nil {
+		return nil, fmt.Errorf("load artifact %s: %w", name, err)
+	}
+	return &genai.Part{InlineData: &genai.Blob{Data: data, MIMEType: v.mimeType, DisplayName: name}}, nil
+}
+
+// delete removes every version of a session artifact.
+func (s *artifactStore) delete(sessionID, name string) error {
+	s.mu.Lock()
+	saved, ok := s.sessions[sessionID][name]
+	delete(s.sessions[sessionID], name)
+	s.mu.Unlock()
+	if !ok {
+		return errArtifactNotFound
+	}
+	for _, v := range saved {
+		if v.path != "" {
+			os.Remove(v.path)
+		}
+	}
+	return nil
+}
+
+// deleteSession removes all of a session's artifacts.
+func (s *artifactStore) deleteSession(sessionID string) {
+	for _, name := range s.list(sessionID) {
+		s.delete(sessionID, name)
+	}
+	s.mu.Lock()
+	delete(s.sessions, sessionID)
+	s.mu.Unlock()
+}
+
+// count returns how many artifact versions the session has.
+func (s *artifactStore) count(sessionID string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for _, versions := range s.sessions[sessionID] {
+		for _, v := range versions {
+			if v.path != "" {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+// prune removes artifact versions saved before cutoff (unless it is zero)
+// and all but the newest maxVersions of each artifact (unless it is zero),
+// returning how many it removed. Artifacts left with no versions are
+// forgotten.
+func (s *artifactStore) prune(cutoff time.Time, maxVersions int) int {
+	s.mu.Lock()
+	var paths []string
+	for _, artifacts := range s.sessions {
+		for name, saved := range artifacts {
+			kept := 0
+			for i := len(saved) - 1; i >= 0; i-- {
+				v := &saved[i]
+				if v.path == "" {
+					continue
+				}
+				if (!cutoff.IsZero() && v.saved.Before(cutoff)) || (maxVersions > 0 && kept >= maxVersions) {
+					paths = append(paths, v.path)
+					v.path = ""
+					continue
+				}
+				kept++
+			}
+			if kept == 0 {
+				delete(artifacts, name)
+			}
+		}
+	}
+	s.mu.Unlock()
+
+	for _, path := range paths {
+		os.Remove(path)
+	}
+	return len(paths)
+}
+
+// recordOutputs saves the files under root that changed since before as new
+// artifact versions of the session, returning the ADK artifact delta (name
+// → version). It returns nil when nothing changed.
+func (s *artifactStore) recordOutputs(sessionID, root string, before outputState) map[string]int {
+	changed := s.scanOutputs(root).changedSince(before)
+	if len(changed) == 0 {
+		return nil
+	}
+	delta := make(map[string]int, len(changed))
+	for _, name := range changed {
+		// The file may have been swapped for a symlink since the scan.
+		src, err := policy.ResolveWithin(root, filepath.FromSlash(name))
+		if err != nil {
+			log.Printf("session %s: artifact %s: %v", sessionID, name, err)
+			continue
+		}
+		version, err := s.save(sessionID, name, src)
+		if err != nil {
+			log.Printf("session %s: %v", sessionID, err)
+			continue
+		}
+		delta[name] = version
+	}
+	return delta
+}
+
+func copyFile(dst, src string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0o700); err != nil {
+		return err
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+func (h *Handler) handleListArtifacts(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, h.artifacts.list(sessionKey(r).String()))
+}
+
+func (h *Handler) handleLoadArtifact(w http.ResponseWriter, r *http.Request) {
+	version := -1
+	v := r.PathValue("version")
+	if v == "" {
+		v = r.URL.Query().Get("version")
+	}
+	if v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid version %q", v))
+			return
+		}
+		version = n
+	}
+
+	part, err := h.artifacts.load(sessionKey(r).String(), r.PathValue("name"), version)
+	if errors.Is(err, errArtifactNotFound) {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, part)
+}
+
+func (h *Handler) handleListArtifactVersions(w http.ResponseWriter, r *http.Request) {
+	versions, err := h.artifacts.versions(sessionKey(r).String(), r.PathValue("name"))
+	if err != nil {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, versions)
+}
+
+func (h *Handler) handleDeleteArtifact(w http.ResponseWriter, r *http.Request) {
+	if err := h.artifacts.delete(sessionKey(r).String(), r.PathValue("name")); err != nil {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,129 @@
+package proxy
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Authenticator identifies the principal making a request. It returns an
+// error if the request carries no valid credentials.
+type Authenticator func(r *http.Request) (principal string, err error)
+
+// HeaderAuthenticator trusts the principal named by header, as set by an
+// authenticating gateway in front of the proxy.
+func HeaderAuthenticator(header string) Authenticator {
+	return func(r *http.Request) (string, error) {
+		principal := r.Header.Get(header)
+		if principal == "" {
+			return "", fmt.Errorf("missing %s header", header)
+		}
+		return principal, nil
+	}
+}
+
+// SetAuthenticator makes the ADK routes authenticate each request with a and
+// only let the principal access the sessions of the user of the same name.
+// With no authenticator, requests are not checked.
+func (h *Handler) SetAuthenticator(a Authenticator) {
+	h.authn = a
+}
+
+type principalKey struct{}
+
+// Principal returns the authenticated principal of a request's context, if
+// any.
+func Principal(ctx context.Context) (string, bool) {
+	p, ok := ctx.Value(principalKey{}).(string)
+	return p, ok
+}
+
+// requestPriority returns the priority of a request's principal, or, with
+// no authenticator, of the user in its path.
+func (h *Handler) requestPriority(r *http.Request) priority {
+	principal, ok := Principal(r.Context())
+	if !ok {
+		principal = r.PathValue("user")
+	}
+	return parsePriority(h.cfg.Priority(principal))
+}
+
+// handleApp registers an ADK route, which is authorized for the user in its
+// path.
+func (h *Handler) handleApp(pattern string, fn http.HandlerFunc) {
+	h.routes = append(h.routes, route{pattern: pattern})
+	h.mux.HandleFunc(pattern, h.authorize(fn))
+}
+
+// authorize rejects requests whose authenticated principal is not the
+// {user} in the path with 401 or 403. Sessions are keyed by user, so this
+// also keeps principals away from sessions they do not own.
+func (h *Handler) authorize(fn http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if h.authn == nil {
+			fn(w, r)
+			return
+		}
+		principal, err := h.authn(r)
+		if err != nil {
+			authFailures.Inc("unauthenticated")
+			writeError(w, http.StatusUnauthorized, fmt.Sprintf("unauthenticated: %v", err))
+			return
+		}
+		if user := r.PathValue("user"); principal != user {
+			authFailures.Inc("forbidden")
+			writeError(w, http.StatusForbidden, fmt.Sprintf("%s may not access sessions of user %s", principal, user))
+			return
+		}
+		fn(w, r.WithContext(context.WithValue(r.Context(), principalKey{}, principal)))
+	}
+}
+
+// handleAdmin registers an operational route on the admin mux, guarded by
+// the admin token.
+func (h *Handler) handleAdmin(pattern string, handler http.Handler) {
+	h.routes = append(h.routes, route{pattern: pattern, admin: true})
+	h.admin.Handle(pattern, h.authorizeAdmin(handler))
+}
+
+// authorizeAdmin requires the configured admin bearer token or, with an API
+// keys file, an admin key, independently of how ADK clients authenticate.
+// With neither configured, requests are not checked: the admin routes are
+// then only served on the separate admin listener.
+func (h *Handler) authorizeAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if h.cfg.AdminToken != "" || h.keys != nil {
+			token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			tokenOK := ok && h.cfg.AdminToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(h.cfg.AdminToken)) == 1
+			if !tokenOK && (h.keys == nil || !h.keys.admits(r)) {
+				authFailures.Inc("admin")
+				w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+				writeError(w, http.StatusUnauthorized, "admin token required")
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// adminCredentials reports whether the admin routes can authenticate their
+// callers now: with ADMIN_TOKEN, or an admin key among the keys last read
+// from API_KEYS_FILE.
+func (h *Handler) adminCredentials() bool {
+	return h.cfg.AdminToken != "" || h.keys != nil && h.keys.hasAdmin()
+}
+
+// requireAdminCredentials answers 404 while the admin routes cannot
+// authenticate their callers, checked on each request so that a reloaded
+// keys file adding or removing the last admin key takes effect.
+func (h *Handler) requireAdminCredentials(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !h.adminCredentials() {
+			writeError(w, http.StatusNotFound, "served only with ADMIN_TOKEN or an admin API key")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
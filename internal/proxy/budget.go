@@ -0,0 +1,83 @@
+package proxy
+
+import (
+	"context"
+	"log"
+	"log/slog"
+
+	"github.com/innomon/adk2goose/internal/config"
+)
+
+// BudgetAlert is the JSON payload POSTed to a budget's webhook when usage
+// crosses one of its thresholds.
+type BudgetAlert struct {
+	Scope string `json:"scope"`
+	App   string `json:"app"`
+	User  string `json:"user,omitempty"`
+	// Metric is "cost" or "tokens"; Limit is the budget's limit on it and
+	// Threshold the fraction of Limit crossed.
+	Metric    string  `json:"metric"`
+	Limit     float64 `json:"limit"`
+	Threshold float64 `json:"threshold"`
+	Usage     Usage   `json:"usage"`
+}
+
+// checkBudgets alerts each configured budget whose thresholds the turn's
+// usage pushed its user or app across.
+func (h *Handler) checkBudgets(key SessionKey, totals usageTotals) {
+	for i := range h.cfg.Budgets {
+		b := &h.cfg.Budgets[i]
+		if b.App != "" && b.App != key.App {
+			continue
+		}
+		alert := BudgetAlert{Scope: b.Scope, App: key.App, Usage: totals.App}
+		if b.Scope == config.BudgetScopeUser {
+			alert.User, alert.Usage = key.User, totals.User
+		}
+		after := alert.Usage
+		before := Usage{
+			InputTokens:   after.InputTokens - totals.Turn.InputTokens,
+			OutputTokens:  after.OutputTokens - totals.Turn.OutputTokens,
+			EstimatedCost: after.EstimatedCost - totals.Turn.EstimatedCost,
+		}
+
+		for _, t := range b.Thresholds {
+			if b.MaxCost > 0 && crossed(before.EstimatedCost, after.EstimatedCost, t*b.MaxCost) {
+				alert.Metric, alert.Limit, alert.Threshold = "cost", b.MaxCost, t
+				h.sendBudgetAlert(b.Webhook, alert)
+			}
+			maxTokens := float64(b.MaxTokens)
+			if b.MaxTokens > 0 && crossed(float64(before.InputTokens+before.OutputTokens), float64(after.InputTokens+after.OutputTokens), t*maxTokens) {
+				alert.Metric, alert.Limit, alert.Threshold = "tokens", maxTokens, t
+				h.sendBudgetAlert(b.Webhook, alert)
+			}
+		}
+	}
+}
+
+// crossed reports whether usage going from before to after reached level.
+func crossed(before, after, level float64) bool {
+	return before < level && after >= level
+}
+
+// sendBudgetAlert logs a budget alert and POSTs it to webhook in the
+// background.
+func (h *Handler) sendBudgetAlert(webhook string, alert BudgetAlert) {
+	budgetAlerts.Inc(alert.Scope, alert.Metric)
+	slog.Warn("budget threshold crossed",
+		"scope", alert.Scope,
+		"app", alert.App,
+		"user", alert.User,
+		"metric", alert.Metric,
+		"limit", alert.Limit,
+		"threshold", alert.Threshold,
+		"inputTokens", alert.Usage.InputTokens,
+		"outputTokens", alert.Usage.OutputTokens,
+		"estimatedCost", alert.Usage.EstimatedCost,
+	)
+	go func() {
+		if err := postWebhook(context.Background(), webhook, alert); err != nil {
+			log.Printf("budget alert webhook: %v", err)
+		}
+	}()
+}
@@ -0,0 +1,235 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+)
+
+// captureTruncated marks where a capture file hit its size limit.
+const captureTruncated = "\n[capture truncated]\n"
+
+// secretFieldPattern matches JSON string fields whose names suggest
+// credentials, so their values can be redacted from captures.
+var secretFieldPattern = regexp.MustCompile(`(?i)("[^"]*(?:api[_-]?key|token|secret|password|passwd|authorization|credential)[^"]*"\s*:\s*)"(?:[^"\\]|\\.)*"`)
+
+// bearerPattern matches bearer credentials embedded in text.
+var bearerPattern = regexp.MustCompile(`(?i)(bearer\s+)[A-Za-z0-9._~+/=-]+`)
+
+// turnCapture holds the debug capture files of one run_sse invocation:
+// the raw ADK request, the raw Goose SSE stream, and the emitted ADK events.
+type turnCapture struct {
+	request *captureFile
+	goose   *captureFile
+	adk     *captureFile
+}
+
+// captureSessionFile names, in each capture directory, the session the
+// invocation ran in, so a user's captures can be found when they are purged.
+const captureSessionFile = "session.json"
+
+// captureSession is the content of captureSessionFile.
+type captureSession struct {
+	App     string `json:"app"`
+	User    string `json:"user"`
+	Session string `json:"session"`
+}
+
+// startCapture creates the capture files for invocationID of session key
+// under DEBUG_CAPTURE_DIR. It returns nil if capture is disabled or the
+// files cannot be created.
+func (h *Handler) startCapture(key SessionKey, invocationID string) *turnCapture {
+	if h.cfg.DebugCaptureDir == "" {
+		return nil
+	}
+	dir := filepath.Join(h.cfg.DebugCaptureDir, invocationID)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		log.Printf("debug capture: %v", err)
+		return nil
+	}
+	owner, _ := json.Marshal(captureSession{App: key.App, User: key.User, Session: key.ID})
+	if err := os.WriteFile(filepath.Join(dir, captureSessionFile), owner, 0o600); err != nil {
+		log.Printf("debug capture: %v", err)
+		return nil
+	}
+
+	redact := newRedactor(h.cfg.GooseSecret)
+	open := func(name string, lines bool) *captureFile {
+		f, err := os.OpenFile(filepath.Join(dir, name), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+		if err != nil {
+			log.Printf("debug capture: %v", err)
+			return nil
+		}
+		return &captureFile{f: f, limit: int64(h.cfg.DebugCaptureMaxBytes), redact: redact, lines: lines}
+	}
+	return &turnCapture{
+		request: open("adk_request.json", false),
+		goose:   open("goose_stream.sse", true),
+		adk:     open("adk_events.sse", true),
+	}
+}
+
+// removeUserCaptures deletes the debug captures of user's invocations in
+// app, or in every app if app is empty, and returns how many there were.
+// With dryRun it only counts them.
+func (h *Handler) removeUserCaptures(app, user string, dryRun bool) (int, error) {
+	if h.cfg.DebugCaptureDir == "" {
+		return 0, nil
+	}
+	entries, err := os.ReadDir(h.cfg.DebugCaptureDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	n := 0
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		dir := filepath.Join(h.cfg.DebugCaptureDir, e.Name())
+		data, err := os.ReadFile(filepath.Join(dir, captureSessionFile))
+		if err != nil {
+			continue
+		}
+		var owner captureSession
+		if json.Unmarshal(data, &owner) != nil || owner.User != user || (app != "" && owner.App != app) {
+			continue
+		}
+		n++
+		if dryRun {
+			continue
+		}
+		if err := os.RemoveAll(dir); err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// captureRequest records the raw ADK request body. It is written whole, so a
+// secret is redacted however the body was split as it was read.
+func (c *turnCapture) captureRequest(body []byte) {
+	if c == nil {
+		return
+	}
+	c.request.Write(body)
+}
+
+// Close closes every capture file.
+func (c *turnCapture) Close() {
+	if c == nil {
+		return
+	}
+	for _, f := range []*captureFile{c.request, c.goose, c.adk} {
+		f.Close()
+	}
+}
+
+// captureFile is a size-limited, redacting capture sink. It is safe for
+// concurrent use, ignores writes after Close, and never reports errors so it
+// can't disturb the traffic being captured. A nil captureFile discards
+// everything.
+type captureFile struct {
+	mu      sync.Mutex
+	f       *os.File
+	limit   int64
+	written int64
+	redact  func([]byte) []byte
+
+	// lines makes Write redact and write complete lines only, holding the
+	// rest in partial, so a secret split across writes of a stream is still
+	// caught. Otherwise each write is redacted on its own.
+	lines   bool
+	partial []byte
+}
+
+func (c *captureFile) Write(p []byte) (int, error) {
+	if c == nil {
+		return len(p), nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.f == nil || (c.limit > 0 && c.written >= c.limit) {
+		return len(p), nil
+	}
+	if !c.lines {
+		c.write(p)
+		return len(p), nil
+	}
+
+	c.partial = append(c.partial, p...)
+	if i := bytes.LastIndexByte(c.partial, '\n'); i >= 0 {
+		c.write(c.partial[:i+1])
+		c.partial = append(c.partial[:0], c.partial[i+1:]...)
+	}
+	// A line past the limit would be truncated anyway.
+	if c.limit > 0 && int64(len(c.partial)) > c.limit {
+		c.write(c.partial)
+		c.partial = nil
+	}
+	return len(p), nil
+}
+
+// write redacts p and appends it to the file, up to the limit. c.mu must be
+// held.
+func (c *captureFile) write(p []byte) {
+	if c.limit > 0 && c.written >= c.limit {
+		return
+	}
+	data := c.redact(p)
+	if c.limit > 0 && c.written+int64(len(data)) > c.limit {
+		data = append(data[:c.limit-c.written:c.limit-c.written], captureTruncated...)
+		c.written = c.limit
+	} else {
+		c.written += int64(len(data))
+	}
+	c.f.Write(data)
+}
+
+// Close writes any unterminated last line and closes the file.
+func (c *captureFile) Close() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.f != nil {
+		if len(c.partial) > 0 {
+			c.write(c.partial)
+			c.partial = nil
+		}
+		c.f.Close()
+		c.f = nil
+	}
+}
+
+// writer returns c as an io.Writer, or io.Discard when c is nil, so callers
+// can tee into it unconditionally.
+func (c *captureFile) writer() io.Writer {
+	if c == nil {
+		return io.Discard
+	}
+	return c
+}
+
+// newRedactor returns a function that masks credential-like JSON fields,
+// bearer tokens, and the given literal secrets.
+func newRedactor(secrets ...string) func([]byte) []byte {
+	return func(p []byte) []byte {
+		out := secretFieldPattern.ReplaceAll(p, []byte(`$1"[REDACTED]"`))
+		out = bearerPattern.ReplaceAll(out, []byte(`${1}[REDACTED]`))
+		for _, s := range secrets {
+			if s != "" {
+				out = bytes.ReplaceAll(out, []byte(s), []byte("[REDACTED]"))
+			}
+		}
+		return out
+	}
+}
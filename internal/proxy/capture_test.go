@@ -0,0 +1,58 @@
+package proxy
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCaptureFile_Limit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "capture")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &captureFile{f: f, limit: 8, redact: newRedactor()}
+	c.Write([]byte("0123456789"))
+	c.Write([]byte("more"))
+	c.Close()
+	c.Write([]byte("after close"))
+
+	data, _ := os.ReadFile(path)
+	if string(data) != "01234567"+captureTruncated {
+		t.Errorf("unexpected capture contents %q", data)
+	}
+}
+
+func TestRedactor(t *testing.T) {
+	redact := newRedactor("literal-secret")
+	got := string(redact([]byte(`{"Authorization":"Bearer abc.def","accessToken":"x\"y","note":"literal-secret","text":"auth: Bearer xyz"}`)))
+	for _, leaked := range []string{"abc.def", `x\"y`, "literal-secret", "xyz"} {
+		if strings.Contains(got, leaked) {
+			t.Errorf("expected %q to be redacted, got %s", leaked, got)
+		}
+	}
+	if !strings.Contains(got, `"note":"[REDACTED]"`) {
+		t.Errorf("expected non-secret field to be kept with literal redacted, got %s", got)
+	}
+}
+
+func TestCaptureFile_RedactsSplitLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "capture")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &captureFile{f: f, redact: newRedactor("literal-secret"), lines: true}
+	c.Write([]byte("data: {\"note\":\"literal-"))
+	c.Write([]byte("secret\"}\n\ndata: {\"apiKey\":\"ab"))
+	c.Write([]byte("c\"}"))
+	c.Close()
+
+	data, _ := os.ReadFile(path)
+	want := "data: {\"note\":\"[REDACTED]\"}\n\ndata: {\"apiKey\":\"[REDACTED]\"}"
+	if string(data) != want {
+		t.Errorf("capture contents = %q, want %q", data, want)
+	}
+}
@@ -0,0 +1,85 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/innomon/adk2goose/gooseclient"
+	"github.com/innomon/adk2goose/internal/features"
+	"github.com/innomon/adk2goose/translator"
+	"google.golang.org/genai"
+)
+
+// continuationMetadataKey is the customMetadata key of the event answering a
+// continuation request, listing the function response IDs it delivered.
+const continuationMetadataKey = "goose:continuation"
+
+// functionResponsesOnly returns the function responses of content if they
+// are all it carries, as when an ADK client answers a confirmation prompt or
+// returns the result of a long-running tool.
+func functionResponsesOnly(content *genai.Content) ([]*genai.FunctionResponse, bool) {
+	var responses []*genai.FunctionResponse
+	for _, part := range content.Parts {
+		if part.FunctionResponse == nil || part.Text != "" || part.FunctionCall != nil || part.InlineData != nil || part.FileData != nil {
+			return nil, false
+		}
+		responses = append(responses, part.FunctionResponse)
+	}
+	return responses, len(responses) > 0
+}
+
+// continueTurn delivers function responses to the Goose turn running for the
+// session: confirmation answers go to Goose's confirm endpoint and other
+// responses are submitted as tool results. The running turn's own stream
+// carries what follows, so this stream reports what was delivered and ends.
+func (h *Handler) continueTurn(w http.ResponseWriter, r *http.Request, gooseSessionID, invocationID string, responses []*genai.FunctionResponse) {
+	if !h.cfg.Features.Enabled(features.ToolBridge) {
+		for _, fr := range responses {
+			if fr.Name != translator.ConfirmationFunctionName {
+				writeError(w, http.StatusBadRequest, fmt.Sprintf("function response %s: delivering tool results to Goose is turned off (feature %s)", fr.ID, features.ToolBridge))
+				return
+			}
+		}
+	}
+	delivered := make([]string, 0, len(responses))
+	for _, fr := range responses {
+		var err error
+		if fr.Name == translator.ConfirmationFunctionName {
+			confirmed, _ := fr.Response["confirmed"].(bool)
+			err = h.client.ConfirmTool(r.Context(), &gooseclient.ToolConfirmationRequest{
+				SessionID: gooseSessionID,
+				RequestID: fr.ID,
+				Approved:  confirmed,
+			})
+		} else {
+			err = h.client.SubmitToolResult(r.Context(), &gooseclient.ToolResultRequest{
+				ID:        fr.ID,
+				Result:    translator.ADKFunctionResponseToGooseToolResult(fr),
+				SessionID: gooseSessionID,
+			})
+		}
+		if err != nil {
+			writeError(w, http.StatusBadGateway, fmt.Sprintf("deliver function response %s: %v", fr.ID, err))
+			return
+		}
+		delivered = append(delivered, fr.ID)
+	}
+
+	flusher, _ := w.(http.Flusher)
+	sw := newSSEWriter(w, flusher)
+	if acceptsNDJSON(r) {
+		w.Header().Set("Content-Type", ndjsonContentType)
+		sw = newNDJSONWriter(w, flusher)
+	} else {
+		w.Header().Set("Content-Type", "text/event-stream")
+	}
+	sw.maxEvent = h.cfg.SSEMaxEventBytes
+	w.Header().Set("Cache-Control", "no-cache")
+
+	evt := translator.NewMetadataEvent(invocationID, continuationMetadataKey, map[string]any{"functionResponses": delivered})
+	app := r.PathValue("app")
+	evt.Author = h.cfg.App(app).EventAuthor(app)
+	evt.TurnComplete = true
+	sw.write(evt)
+	translator.ReleaseEvent(evt)
+}
@@ -0,0 +1,45 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// requestTimeoutHeader lets a client shorten the turn timeout for one run_sse
+// request. It accepts a Go duration ("90s") or a number of seconds.
+const requestTimeoutHeader = "X-Request-Timeout"
+
+// turnTimeout returns how long a turn may run: the configured RequestTimeout,
+// shortened by the request's X-Request-Timeout header. Zero means no limit.
+func turnTimeout(r *http.Request, configured time.Duration) (time.Duration, error) {
+	v := r.Header.Get(requestTimeoutHeader)
+	if v == "" {
+		return configured, nil
+	}
+	d, err := parseTimeout(v)
+	if err != nil {
+		return 0, fmt.Errorf("%s %q: %w", requestTimeoutHeader, v, err)
+	}
+	if configured > 0 && d > configured {
+		return configured, nil
+	}
+	return d, nil
+}
+
+// parseTimeout parses a positive Go duration or number of seconds.
+func parseTimeout(v string) (time.Duration, error) {
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		secs, serr := strconv.ParseFloat(v, 64)
+		if serr != nil {
+			return 0, fmt.Errorf("want a duration or seconds")
+		}
+		d = time.Duration(secs * float64(time.Second))
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("must be positive")
+	}
+	return d, nil
+}
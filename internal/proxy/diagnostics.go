@@ -0,0 +1,186 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"time"
+)
+
+// Diagnostics is the live runtime state reported by the admin diagnostics
+// endpoint, for telling a leak from load in a long-running proxy.
+type Diagnostics struct {
+	Goroutines int                `json:"goroutines"`
+	Memory     MemoryDiagnostics  `json:"memory"`
+	Streams    StreamDiagnostics  `json:"streams"`
+	Backlogs   map[string]Backlog `json:"backlogs"`
+}
+
+// MemoryDiagnostics summarizes the Go heap.
+type MemoryDiagnostics struct {
+	HeapAllocBytes uint64 `json:"heapAllocBytes"`
+	HeapObjects    uint64 `json:"heapObjects"`
+	SysBytes       uint64 `json:"sysBytes"`
+	NumGC          uint32 `json:"numGC"`
+	LastGC         string `json:"lastGC,omitempty"`
+}
+
+// StreamDiagnostics counts the streams and turns in flight.
+type StreamDiagnostics struct {
+	// Active counts open run_sse streams; Queued those waiting for a slot
+	// under MAX_CONCURRENT_STREAMS.
+	Active int `json:"active"`
+	Queued int `json:"queued"`
+	// RunningTurns counts sessions with a turn in progress, and
+	// RetainedTurns finished turns kept for Last-Event-ID resumption.
+	RunningTurns  int `json:"runningTurns"`
+	RetainedTurns int `json:"retainedTurns"`
+	// GooseReplies counts the open Goose reply streams, and
+	// OldestGooseReplySeconds is the age of the oldest; one far older than
+	// the turn timeout points at a leak.
+	GooseReplies            int     `json:"gooseReplies"`
+	OldestGooseReplySeconds float64 `json:"oldestGooseReplySeconds,omitempty"`
+}
+
+// Backlog is the fill of a buffered queue: Len items waiting, out of Cap,
+// summed over its channels when it has several.
+type Backlog struct {
+	Channels int `json:"channels"`
+	Len      int `json:"len"`
+	Cap      int `json:"cap"`
+}
+
+// add counts one more channel of n items waiting, out of c.
+func (b *Backlog) add(n, c int) {
+	b.Channels++
+	b.Len += n
+	b.Cap += c
+}
+
+// handleAdminDiagnostics reports goroutine and heap figures, the streams in
+// flight, and the backlog of the proxy's internal queues.
+func (h *Handler) handleAdminDiagnostics(w http.ResponseWriter, r *http.Request) {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	d := Diagnostics{
+		Goroutines: runtime.NumGoroutine(),
+		Memory: MemoryDiagnostics{
+			HeapAllocBytes: mem.HeapAlloc,
+			HeapObjects:    mem.HeapObjects,
+			SysBytes:       mem.Sys,
+			NumGC:          mem.NumGC,
+		},
+		Streams: StreamDiagnostics{
+			Active: int(activeStreams.Value()),
+			Queued: h.streams.queued(),
+		},
+		Backlogs: map[string]Backlog{
+			"push":         h.push.backlog(),
+			"tap":          h.tap.backlog(),
+			"attached":     h.fanouts.backlog(),
+			"eventSink":    h.sink.backlog(),
+			"errorReports": h.errs.backlog(),
+			"asyncRuns":    h.runs.backlog(),
+		},
+	}
+	if mem.LastGC > 0 {
+		d.Memory.LastGC = time.Unix(0, int64(mem.LastGC)).UTC().Format(time.RFC3339Nano)
+	}
+	d.Streams.RunningTurns, d.Streams.RetainedTurns = h.fanouts.counts()
+	if replies := h.client.Streams(); len(replies) > 0 {
+		d.Streams.GooseReplies = len(replies)
+		d.Streams.OldestGooseReplySeconds = time.Since(replies[0].Started).Seconds()
+	}
+	writeJSON(w, http.StatusOK, d)
+}
+
+// handlePprof registers the net/http/pprof profiles on the admin routes.
+func (h *Handler) handlePprof() {
+	h.handleAdmin("GET /debug/pprof/", http.HandlerFunc(pprof.Index))
+	h.handleAdmin("GET /debug/pprof/cmdline", http.HandlerFunc(pprof.Cmdline))
+	h.handleAdmin("GET /debug/pprof/profile", http.HandlerFunc(pprof.Profile))
+	h.handleAdmin("GET /debug/pprof/symbol", http.HandlerFunc(pprof.Symbol))
+	h.handleAdmin("POST /debug/pprof/symbol", http.HandlerFunc(pprof.Symbol))
+	h.handleAdmin("GET /debug/pprof/trace", http.HandlerFunc(pprof.Trace))
+}
+
+// queued returns how many streams wait for a slot. A nil admission queues
+// none.
+func (a *admission) queued() int {
+	if a == nil {
+		return 0
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	n := 0
+	for _, q := range a.waiting {
+		n += len(q)
+	}
+	return n
+}
+
+// backlog returns the events waiting to be written to subscribers.
+func (p *pushHub) backlog() Backlog {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var b Backlog
+	for _, subs := range p.subs {
+		for ch := range subs {
+			b.add(len(ch), cap(ch))
+		}
+	}
+	return b
+}
+
+// backlog returns the events waiting to be written to attached clients.
+func (t *turnFanouts) backlog() Backlog {
+	t.mu.Lock()
+	fanouts := make([]*turnFanout, 0, len(t.active))
+	for _, f := range t.active {
+		fanouts = append(fanouts, f)
+	}
+	t.mu.Unlock()
+	var b Backlog
+	for _, f := range fanouts {
+		f.mu.Lock()
+		for ch := range f.subs {
+			b.add(len(ch), cap(ch))
+		}
+		f.mu.Unlock()
+	}
+	return b
+}
+
+// counts returns the number of running and of retained finished turns.
+func (t *turnFanouts) counts() (running, retained int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.active), len(t.finished)
+}
+
+// backlog returns the events waiting to be published. A nil sink has none.
+func (s *eventSink) backlog() Backlog {
+	var b Backlog
+	if s != nil {
+		b.add(len(s.queue), cap(s.queue))
+	}
+	return b
+}
+
+// backlog returns the reports waiting to be sent. A nil reporter has none.
+func (e *errorReporter) backlog() Backlog {
+	var b Backlog
+	if e != nil {
+		b.add(len(e.queue), cap(e.queue))
+	}
+	return b
+}
+
+// backlog returns the async runs executing, out of the worker limit.
+func (r *asyncRuns) backlog() Backlog {
+	var b Backlog
+	if r.workers != nil {
+		b.add(len(r.workers), cap(r.workers))
+	}
+	return b
+}
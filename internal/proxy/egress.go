@@ -0,0 +1,131 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// egressRedirects caps the redirects followed by an egress client.
+const egressRedirects = 5
+
+// errEgressDenied is returned for a request the egress policy refuses.
+var errEgressDenied = errors.New("destination not allowed")
+
+var (
+	// sharedAddrs is the carrier-grade NAT range, internal to a provider's
+	// network like the private ranges.
+	sharedAddrs = netip.MustParsePrefix("100.64.0.0/10")
+
+	// nat64Addrs is the well-known NAT64 prefix, whose addresses reach the
+	// IPv4 address in their last 4 bytes.
+	nat64Addrs = netip.MustParsePrefix("64:ff9b::/96")
+)
+
+// egressBlocked reports whether the proxy refuses to connect to ip on a
+// client's behalf: loopback, private, shared, link-local, and unspecified
+// addresses would reach the proxy's own host and network, and so would a
+// NAT64 address embedding one. Tests replace it to reach their local
+// servers.
+var egressBlocked = func(ip net.IP) bool {
+	addr, ok := netip.AddrFromSlice(ip)
+	if !ok {
+		return true
+	}
+	addr = addr.Unmap()
+	if nat64Addrs.Contains(addr) {
+		b := addr.As16()
+		addr = netip.AddrFrom4([4]byte(b[12:]))
+	}
+	return addr.IsLoopback() || addr.IsPrivate() || sharedAddrs.Contains(addr) || addr.IsLinkLocalUnicast() ||
+		addr.IsLinkLocalMulticast() || addr.IsInterfaceLocalMulticast() || addr.IsUnspecified()
+}
+
+// egressPolicy limits the URLs the proxy requests on a client's behalf, such
+// as fileData downloads and run callbacks, to http(s) URLs on allowed hosts
+// that do not resolve to an internal address. A nil egressPolicy allows
+// nothing.
+type egressPolicy struct {
+	// hosts are the allowed host names; "*.example.com" allows the
+	// subdomains of example.com.
+	hosts []string
+
+	// http sends the requests, enforcing the policy on each connection and
+	// redirect.
+	http *http.Client
+}
+
+// newEgressPolicy returns the policy allowing hosts, whose requests time
+// out after timeout if positive, or nil if hosts is empty.
+func newEgressPolicy(hosts []string, timeout time.Duration) *egressPolicy {
+	if len(hosts) == 0 {
+		return nil
+	}
+	e := &egressPolicy{hosts: hosts}
+	e.http = e.client(timeout)
+	return e
+}
+
+// allows reports whether u is an http(s) URL on an allowed host.
+func (e *egressPolicy) allows(u *url.URL) bool {
+	if e == nil || u.Scheme != "http" && u.Scheme != "https" {
+		return false
+	}
+	return hostListed(e.hosts, u.Hostname())
+}
+
+// hostListed reports whether host is one of hosts, or a subdomain of one
+// listed as "*.example.com".
+func hostListed(hosts []string, host string) bool {
+	host = strings.ToLower(host)
+	for _, h := range hosts {
+		h = strings.ToLower(h)
+		if host == h || strings.HasPrefix(h, "*.") && strings.HasSuffix(host, h[1:]) {
+			return true
+		}
+	}
+	return false
+}
+
+// client returns an HTTP client that enforces the policy on every redirect
+// and checks the address each connection is made to, after DNS resolution,
+// so a host cannot be pointed at an internal address.
+func (e *egressPolicy) client(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: 10 * time.Second,
+		Control: func(_, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || egressBlocked(ip) {
+				return fmt.Errorf("%w: %s", errEgressDenied, host)
+			}
+			return nil
+		},
+	}
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			// No HTTP proxy: the checked address must be the destination's.
+			DialContext:           dialer.DialContext,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ResponseHeaderTimeout: 30 * time.Second,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= egressRedirects {
+				return fmt.Errorf("stopped after %d redirects", egressRedirects)
+			}
+			if !e.allows(req.URL) {
+				return fmt.Errorf("redirect to %s: %w", req.URL.Redacted(), errEgressDenied)
+			}
+			return nil
+		},
+	}
+}
@@ -0,0 +1,130 @@
+package proxy
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+
+	"github.com/innomon/adk2goose/internal/sentry"
+)
+
+const (
+	// errorReportBuffer is how many reports may wait to be sent before
+	// further ones are dropped.
+	errorReportBuffer = 256
+
+	// backendErrorStreak is how many consecutive failed Goose requests are
+	// reported as a repeated backend error. Isolated failures are not.
+	backendErrorStreak = 3
+)
+
+// errorReporter sends error reports to an error tracker in the background.
+type errorReporter struct {
+	client *sentry.Client
+	queue  chan *sentry.Event
+
+	mu              sync.Mutex
+	backendFailures int
+}
+
+// UseErrorReporter reports handler panics, translation failures, and
+// repeated Goose errors to client. It must be called before the handler
+// serves requests.
+func (h *Handler) UseErrorReporter(client *sentry.Client) {
+	e := &errorReporter{client: client, queue: make(chan *sentry.Event, errorReportBuffer)}
+	go e.run()
+	h.errs = e
+}
+
+// capture queues evt. A nil reporter does nothing.
+func (e *errorReporter) capture(evt *sentry.Event) {
+	if e == nil {
+		return
+	}
+	select {
+	case e.queue <- evt:
+	default:
+		errorReports.Inc("dropped")
+	}
+}
+
+func (e *errorReporter) run() {
+	for evt := range e.queue {
+		if _, err := e.client.Capture(evt); err != nil {
+			errorReports.Inc("failed")
+			log.Printf("report error: %v", err)
+			continue
+		}
+		errorReports.Inc("sent")
+	}
+}
+
+// backendFailed counts a failed Goose request, reporting the failure that
+// completes a streak of them.
+func (e *errorReporter) backendFailed(err error, tags map[string]string) {
+	if e == nil {
+		return
+	}
+	e.mu.Lock()
+	e.backendFailures++
+	n := e.backendFailures
+	e.mu.Unlock()
+	if n != backendErrorStreak {
+		return
+	}
+	e.capture(&sentry.Event{
+		Message:     fmt.Sprintf("goose request failed %d times in a row: %v", n, err),
+		Type:        "BackendError",
+		Value:       err.Error(),
+		Tags:        tags,
+		Fingerprint: []string{"goose-backend-error"},
+	})
+}
+
+// backendOK ends a streak of failed Goose requests.
+func (e *errorReporter) backendOK() {
+	if e == nil {
+		return
+	}
+	e.mu.Lock()
+	e.backendFailures = 0
+	e.mu.Unlock()
+}
+
+// recoverPanic, deferred around serving r, reports a handler panic and
+// panics again, so the server still logs it and drops the connection.
+func (h *Handler) recoverPanic(r *http.Request) {
+	v := recover()
+	if v == nil {
+		return
+	}
+	if v != http.ErrAbortHandler {
+		h.errs.capture(&sentry.Event{
+			Level:   sentry.LevelFatal,
+			Message: fmt.Sprintf("panic serving %s %s: %v", r.Method, r.URL.Path, v),
+			Type:    "panic",
+			Value:   fmt.Sprint(v),
+			Stack:   sentry.Callers(1),
+			Tags:    requestTags(r, ""),
+		})
+	}
+	panic(v)
+}
+
+// requestTags returns the tags identifying r's route, session, and, if
+// known, invocation.
+func requestTags(r *http.Request, invocationID string) map[string]string {
+	tags := make(map[string]string)
+	for name, v := range map[string]string{
+		"route":      r.Pattern,
+		"app":        r.PathValue("app"),
+		"session":    r.PathValue("session"),
+		"invocation": invocationID,
+	} {
+		if v != "" {
+			tags[name] = v
+		}
+	}
+	return tags
+}
@@ -0,0 +1,249 @@
+package proxy
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/innomon/adk2goose/translator"
+)
+
+// EventStore is an append-only log of the ADK events sent for each session,
+// in order. Each event carries the invocation it belongs to. It backs
+// session history, so history need not be re-translated from the Goose
+// transcript, and the conversation rebuilt when Goose loses a session.
+type EventStore interface {
+	// Append adds events to the end of the session's log. The events must
+	// not be modified afterwards.
+	Append(key SessionKey, events ...*translator.ADKEvent) error
+	// Events returns the session's logged events, oldest first.
+	Events(key SessionKey) ([]*translator.ADKEvent, error)
+	// Delete drops the session's log, when the session is deleted.
+	Delete(key SessionKey) error
+	// Sessions returns the keys of user's sessions that have a log, in app
+	// or, if app is empty, in any app.
+	Sessions(app, user string) ([]SessionKey, error)
+	// Prune drops the logs last appended to before cutoff, except those of
+	// sessions keep reports true for, returning the keys of those dropped.
+	Prune(cutoff time.Time, keep func(SessionKey) bool) ([]SessionKey, error)
+}
+
+// memoryEventStore keeps event logs in memory.
+type memoryEventStore struct {
+	mu      sync.RWMutex
+	logs    map[SessionKey][]*translator.ADKEvent
+	updated map[SessionKey]time.Time
+}
+
+// NewMemoryEventStore returns an EventStore that keeps event logs in memory,
+// for as long as the process runs.
+func NewMemoryEventStore() EventStore {
+	return &memoryEventStore{
+		logs:    make(map[SessionKey][]*translator.ADKEvent),
+		updated: make(map[SessionKey]time.Time),
+	}
+}
+
+func (s *memoryEventStore) Append(key SessionKey, events ...*translator.ADKEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.logs[key] = append(s.logs[key], events...)
+	s.updated[key] = time.Now()
+	return nil
+}
+
+func (s *memoryEventStore) Events(key SessionKey) ([]*translator.ADKEvent, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return slices.Clone(s.logs[key]), nil
+}
+
+func (s *memoryEventStore) Delete(key SessionKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.logs, key)
+	delete(s.updated, key)
+	return nil
+}
+
+func (s *memoryEventStore) Sessions(app, user string) ([]SessionKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var keys []SessionKey
+	for key := range s.logs {
+		if (app == "" || key.App == app) && key.User == user {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+func (s *memoryEventStore) Prune(cutoff time.Time, keep func(SessionKey) bool) ([]SessionKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var pruned []SessionKey
+	for key, updated := range s.updated {
+		if updated.Before(cutoff) && !keep(key) {
+			delete(s.logs, key)
+			delete(s.updated, key)
+			pruned = append(pruned, key)
+		}
+	}
+	return pruned, nil
+}
+
+// fileEventStore keeps each session's event log as a JSON Lines file.
+type fileEventStore struct {
+	dir string
+	mu  sync.Mutex
+}
+
+// NewFileEventStore returns an EventStore that appends each session's events
+// to a JSON Lines file under dir, so logs survive restarts.
+func NewFileEventStore(dir string) EventStore {
+	return &fileEventStore{dir: dir}
+}
+
+// path returns the log file of key. Each key part is encoded so no app, user,
+// or session ID can escape dir.
+func (s *fileEventStore) path(key SessionKey) string {
+	enc := base64.RawURLEncoding.EncodeToString
+	return filepath.Join(s.dir, enc([]byte(key.App)), enc([]byte(key.User)), enc([]byte(key.ID))+".jsonl")
+}
+
+func (s *fileEventStore) Append(key SessionKey, events ...*translator.ADKEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+	var buf []byte
+	for _, evt := range events {
+		line, err := json.Marshal(evt)
+		if err != nil {
+			return fmt.Errorf("encode event %s: %w", evt.ID, err)
+		}
+		buf = append(append(buf, line...), '\n')
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	path := s.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(buf); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func (s *fileEventStore) Events(key SessionKey) ([]*translator.ADKEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, err := os.Open(s.path(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var events []*translator.ADKEvent
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 64<<20)
+	for scanner.Scan() {
+		var evt translator.ADKEvent
+		if err := json.Unmarshal(scanner.Bytes(), &evt); err != nil {
+			return nil, fmt.Errorf("decode event log of session %s: %w", key, err)
+		}
+		events = append(events, &evt)
+	}
+	return events, scanner.Err()
+}
+
+func (s *fileEventStore) Delete(key SessionKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := os.Remove(s.path(key)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (s *fileEventStore) Sessions(app, user string) ([]SessionKey, error) {
+	enc := base64.RawURLEncoding.EncodeToString
+	appDir := "*"
+	if app != "" {
+		appDir = enc([]byte(app))
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	paths, err := filepath.Glob(filepath.Join(s.dir, appDir, enc([]byte(user)), "*.jsonl"))
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]SessionKey, 0, len(paths))
+	for _, path := range paths {
+		if key, ok := s.key(path); ok {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+func (s *fileEventStore) Prune(cutoff time.Time, keep func(SessionKey) bool) ([]SessionKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	paths, err := filepath.Glob(filepath.Join(s.dir, "*", "*", "*.jsonl"))
+	if err != nil {
+		return nil, err
+	}
+	var pruned []SessionKey
+	for _, path := range paths {
+		key, ok := s.key(path)
+		if !ok || keep(key) {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil || !info.ModTime().Before(cutoff) {
+			continue
+		}
+		if err := os.Remove(path); err != nil {
+			return pruned, err
+		}
+		pruned = append(pruned, key)
+	}
+	return pruned, nil
+}
+
+// key decodes the session key of a log file path, the inverse of path.
+func (s *fileEventStore) key(path string) (SessionKey, bool) {
+	dec := base64.RawURLEncoding.DecodeString
+	id, err := dec(strings.TrimSuffix(filepath.Base(path), ".jsonl"))
+	if err != nil {
+		return SessionKey{}, false
+	}
+	user, err := dec(filepath.Base(filepath.Dir(path)))
+	if err != nil {
+		return SessionKey{}, false
+	}
+	app, err := dec(filepath.Base(filepath.Dir(filepath.Dir(path))))
+	if err != nil {
+		return SessionKey{}, false
+	}
+	return SessionKey{App: string(app), User: string(user), ID: string(id)}, true
+}
@@ -0,0 +1,61 @@
+package proxy
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/innomon/adk2goose/translator"
+)
+
+func TestFileEventStore(t *testing.T) {
+	dir := t.TempDir()
+	store := NewFileEventStore(dir)
+	key := SessionKey{App: "app", User: "../..", ID: "s1"}
+
+	if events, err := store.Events(key); err != nil || len(events) != 0 {
+		t.Fatalf("expected no events for a new session, got %v, %v", events, err)
+	}
+	if err := store.Append(key, &translator.ADKEvent{ID: "e1", InvocationID: "inv_1", Author: "user"}); err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+	if err := store.Append(key, &translator.ADKEvent{ID: "e2", InvocationID: "inv_1", TurnComplete: true}); err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+
+	// A new store over the same directory sees the log.
+	events, err := NewFileEventStore(dir).Events(key)
+	if err != nil {
+		t.Fatalf("Events: %v", err)
+	}
+	if len(events) != 2 || events[0].ID != "e1" || events[0].Author != "user" || !events[1].TurnComplete {
+		t.Fatalf("unexpected events %+v", events)
+	}
+
+	matches, _ := filepath.Glob(filepath.Join(dir, "*", "*", "*.jsonl"))
+	if len(matches) != 1 {
+		t.Fatalf("expected the log under %s, got %v", dir, matches)
+	}
+
+	if keys, err := NewFileEventStore(dir).Sessions("", "../.."); err != nil || len(keys) != 1 || keys[0] != key {
+		t.Fatalf("expected the user's logged session, got %v, %v", keys, err)
+	}
+	if keys, _ := store.Sessions("other", "../.."); len(keys) != 0 {
+		t.Errorf("expected no sessions in another app, got %v", keys)
+	}
+
+	if pruned, _ := store.Prune(time.Now().Add(-time.Hour), func(SessionKey) bool { return false }); len(pruned) != 0 {
+		t.Errorf("expected a fresh log kept, got %v pruned", pruned)
+	}
+	if pruned, _ := store.Prune(time.Now().Add(time.Hour), func(SessionKey) bool { return true }); len(pruned) != 0 {
+		t.Errorf("expected a kept session's log kept, got %v pruned", pruned)
+	}
+
+	if err := store.Delete(key); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := os.Stat(matches[0]); !os.IsNotExist(err) {
+		t.Errorf("expected the log removed, got %v", err)
+	}
+}
@@ -0,0 +1,190 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/innomon/adk2goose/translator"
+	"google.golang.org/genai"
+)
+
+// exportVersion is the transcript format written by the export endpoint.
+const exportVersion = 1
+
+// SessionExport is a portable transcript of a session: its identity,
+// labels, state, and full ADK event history, including tool calls and
+// results.
+type SessionExport struct {
+	Version    int                    `json:"version"`
+	ExportedAt time.Time              `json:"exportedAt"`
+	App        string                 `json:"app"`
+	User       string                 `json:"user"`
+	Session    string                 `json:"session"`
+	Labels     map[string]string      `json:"labels,omitempty"`
+	State      map[string]any         `json:"state,omitempty"`
+	Events     []*translator.ADKEvent `json:"events"`
+}
+
+// handleExportSession renders the session's conversation as a portable JSON
+// transcript (?format=json, the default) or a readable Markdown document
+// (?format=markdown), served as an attachment.
+func (h *Handler) handleExportSession(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "json"
+	}
+	if format != "json" && format != "markdown" {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("unknown export format %q", format))
+		return
+	}
+
+	key := sessionKey(r)
+	sess, ok := h.sessions.Get(key)
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("%v: %s", ErrSessionNotFound, key))
+		return
+	}
+	events, err := h.sessionHistory(r.Context(), sess)
+	if errors.Is(err, ErrSessionNotFound) {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusBadGateway, fmt.Sprintf("export session: %v", err))
+		return
+	}
+
+	exp := &SessionExport{
+		Version:    exportVersion,
+		ExportedAt: time.Now().UTC(),
+		App:        key.App,
+		User:       key.User,
+		Session:    key.ID,
+		Labels:     sess.Labels,
+		State:      sess.State(),
+		Events:     events,
+	}
+	if format == "markdown" {
+		w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", key.ID+".md"))
+		w.Write([]byte(exportMarkdown(exp)))
+		return
+	}
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", key.ID+".json"))
+	writeJSON(w, http.StatusOK, exp)
+}
+
+// exportMarkdown renders a transcript as Markdown: a heading per message
+// naming its author, text as is, thoughts as quotes, and tool calls and
+// results as fenced JSON.
+func exportMarkdown(exp *SessionExport) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Session %s\n\n", exp.Session)
+	fmt.Fprintf(&b, "- App: %s\n- User: %s\n- Exported: %s\n", exp.App, exp.User, exp.ExportedAt.Format(time.RFC3339))
+
+	for _, evt := range exp.Events {
+		if evt.Partial {
+			continue
+		}
+		var body strings.Builder
+		if evt.Content != nil {
+			for _, p := range evt.Content.Parts {
+				writeMarkdownPart(&body, p)
+			}
+		}
+		if evt.ErrorCode != "" {
+			fmt.Fprintf(&body, "**Error** `%s`: %s\n\n", evt.ErrorCode, evt.ErrorMessage)
+		}
+		if evt.Interrupted {
+			body.WriteString("_Turn interrupted._\n\n")
+		}
+		if body.Len() == 0 {
+			continue
+		}
+
+		author := evt.Author
+		if author == "" {
+			author = "unknown"
+		}
+		fmt.Fprintf(&b, "\n## %s", author)
+		if evt.Time > 0 {
+			fmt.Fprintf(&b, " · %s", time.Unix(evt.Time, 0).UTC().Format(time.RFC3339))
+		}
+		b.WriteString("\n\n")
+		b.WriteString(body.String())
+	}
+	return b.String()
+}
+
+func writeMarkdownPart(b *strings.Builder, p *genai.Part) {
+	switch {
+	case p.Thought && p.Text != "":
+		for _, line := range strings.Split(strings.TrimRight(p.Text, "\n"), "\n") {
+			fmt.Fprintf(b, "> %s\n", line)
+		}
+		b.WriteString("\n")
+	case p.Text != "":
+		b.WriteString(strings.TrimRight(p.Text, "\n"))
+		b.WriteString("\n\n")
+	case p.FunctionCall != nil:
+		fmt.Fprintf(b, "**Tool call** `%s`\n\n", p.FunctionCall.Name)
+		writeMarkdownJSON(b, p.FunctionCall.Args)
+	case p.FunctionResponse != nil:
+		// Results name their tool when it is known, else the call they answer.
+		name := p.FunctionResponse.Name
+		if name == "" {
+			name = p.FunctionResponse.ID
+		}
+		fmt.Fprintf(b, "**Tool result** `%s`\n\n", name)
+		writeMarkdownJSON(b, p.FunctionResponse.Response)
+	case p.InlineData != nil:
+		fmt.Fprintf(b, "_[%s attachment, %d bytes]_\n\n", p.InlineData.MIMEType, len(p.InlineData.Data))
+	case p.FileData != nil:
+		fmt.Fprintf(b, "_[file: %s]_\n\n", p.FileData.FileURI)
+	}
+}
+
+func writeMarkdownJSON(b *strings.Builder, v any) {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		data = []byte(fmt.Sprint(v))
+	}
+	fmt.Fprintf(b, "```json\n%s\n```\n\n", data)
+}
+
+// importTranscript creates the session key seeded with an exported
+// transcript: the root agent's conversation is replayed to Goose on the
+// first turn, the events become the session's history, and the session's
+// own state is restored. labels default to the transcript's.
+func (h *Handler) importTranscript(ctx context.Context, key SessionKey, labels map[string]string, exp *SessionExport) (*Session, error) {
+	if labels == nil {
+		labels = exp.Labels
+	}
+	events := slices.DeleteFunc(slices.Clone(exp.Events), func(evt *translator.ADKEvent) bool {
+		return evt == nil || evt.Partial
+	})
+	// Sub-agents run on Goose sessions of their own.
+	root := slices.DeleteFunc(slices.Clone(events), func(evt *translator.ADKEvent) bool { return evt.Branch != "" })
+
+	sess, err := h.sessions.Restore(ctx, key, labels, translator.ADKEventsToGooseConversation(root))
+	if err != nil {
+		return nil, err
+	}
+	if err := h.applySystemHistory(ctx, sess.GooseID, root); err != nil {
+		return nil, fmt.Errorf("apply system instructions: %w", err)
+	}
+	// The app's and user's shared state stays as it is here.
+	if state := sessionScopedState(exp.State); len(state) > 0 {
+		if sess, err = h.sessions.ApplyStateDelta(key, state); err != nil {
+			return nil, err
+		}
+	}
+	h.sessions.RecordEvents(key, events...)
+	return sess, nil
+}
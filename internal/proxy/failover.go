@@ -0,0 +1,61 @@
+package proxy
+
+import (
+	"context"
+	"log"
+	"slices"
+
+	"github.com/innomon/adk2goose/gooseclient"
+	"github.com/innomon/adk2goose/translator"
+)
+
+// failoverMetadataKey carries, in the custom metadata of the warning event
+// sent when a turn moves to the standby Goose server, where it moved and
+// why.
+const failoverMetadataKey = "goose:failover"
+
+// failOver moves the session's turn to the standby Goose server after the
+// server at from failed it, if that server is gone: a new root agent is
+// started on the standby and given the session's history, without the
+// events of invocationID, which the turn sends again. It returns the new
+// Goose session ID and the conversation to reply with, and false if the
+// turn cannot fail over. On success the caller holds the new session's turn
+// lock and must release it; held is the session whose lock the turn holds
+// already, which the standby may have reused the ID of.
+func (h *Handler) failOver(ctx context.Context, key SessionKey, from, held, invocationID string) (string, []gooseclient.GooseMessage, bool) {
+	if !h.client.FailOver(ctx, from) {
+		return "", nil, false
+	}
+	gooseSessionID, history, err := h.sessions.Reattach(ctx, key)
+	if err == nil {
+		err = h.applySystemHistory(ctx, gooseSessionID, history)
+	}
+	if err != nil {
+		log.Printf("session %s: goose server %s failed, failover to %s: %v", key, from, h.client.Active(), err)
+		turnFailovers.Inc("failed")
+		return "", nil, false
+	}
+	if gooseSessionID != held && !h.turns.tryAcquire(gooseSessionID) {
+		log.Printf("session %s: goose server %s failed, failover to %s: a turn is already running on %s", key, from, h.client.Active(), gooseSessionID)
+		turnFailovers.Inc("failed")
+		return "", nil, false
+	}
+	history = slices.DeleteFunc(history, func(evt *translator.ADKEvent) bool {
+		return evt.InvocationID == invocationID
+	})
+	log.Printf("session %s: goose server %s failed, continuing on %s as %s with %d events of history",
+		key, from, h.client.Active(), gooseSessionID, len(history))
+	turnFailovers.Inc("ok")
+	return gooseSessionID, translator.ADKEventsToGooseConversation(history), true
+}
+
+// failoverEvent returns the warning event telling clients that the turn
+// restarted on another Goose server, so output already streamed may be
+// repeated.
+func failoverEvent(invocationID, from, to, reason string) *translator.ADKEvent {
+	return translator.NewMetadataEvent(invocationID, failoverMetadataKey, map[string]any{
+		"from":   from,
+		"to":     to,
+		"reason": reason,
+	})
+}
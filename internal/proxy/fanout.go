@@ -0,0 +1,279 @@
+package proxy
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// fanoutBuffer is how many events an attached client may fall behind before
+// it is disconnected.
+const fanoutBuffer = 256
+
+// resumeRetention is how long a finished turn's events are kept for clients
+// resuming with Last-Event-ID.
+const resumeRetention = 5 * time.Minute
+
+// resumeMaxBytes caps the encoded events a turn keeps for attaching and
+// resuming clients; the oldest are dropped past it.
+const resumeMaxBytes = 1 << 20
+
+// turnFanout records the events of one turn and broadcasts them to the
+// clients attached to it besides the one that started it. The turn keeps
+// running while any of them is connected, or to the end if detachable.
+type turnFanout struct {
+	key          SessionKey
+	invocationID string
+	cancel       func() // ends the turn
+	detachable   bool   // runs on without clients; set before the first publish
+
+	mu         sync.Mutex
+	sent       [][]byte // the events kept, in order; sent[i] has ID invocationID:first+i+1
+	first      int      // events dropped from the front of sent
+	size       int      // bytes in sent
+	subs       map[chan []byte]struct{}
+	originGone bool
+	done       bool
+	ended      time.Time
+}
+
+// turnFanouts tracks the running turn of each session, and recently
+// finished turns by invocation ID.
+type turnFanouts struct {
+	mu       sync.Mutex
+	active   map[SessionKey]*turnFanout
+	finished map[string]*turnFanout
+}
+
+// start registers a running turn for the session and returns its fanout;
+// cancel ends the turn once no client is left.
+func (t *turnFanouts) start(key SessionKey, invocationID string, cancel func()) *turnFanout {
+	f := &turnFanout{key: key, invocationID: invocationID, cancel: cancel, subs: make(map[chan []byte]struct{})}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.active == nil {
+		t.active = make(map[SessionKey]*turnFanout)
+		t.finished = make(map[string]*turnFanout)
+	}
+	for id, old := range t.finished {
+		if time.Since(old.ended) > resumeRetention {
+			delete(t.finished, id)
+		}
+	}
+	t.active[key] = f
+	return f
+}
+
+// finish disconnects the turn's attached clients and keeps its events for
+// resumption.
+func (t *turnFanouts) finish(f *turnFanout) {
+	f.mu.Lock()
+	f.done = true
+	f.ended = time.Now()
+	for ch := range f.subs {
+		close(ch)
+	}
+	f.subs = nil
+	f.mu.Unlock()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.active[f.key] == f {
+		delete(t.active, f.key)
+	}
+	t.finished[f.invocationID] = f
+}
+
+// running returns the session's running turn, if any.
+func (t *turnFanouts) running(key SessionKey) (*turnFanout, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	f, ok := t.active[key]
+	return f, ok
+}
+
+// lookup returns the session's turn with the given invocation ID, whether it
+// is still running or finished within resumeRetention.
+func (t *turnFanouts) lookup(key SessionKey, invocationID string) (*turnFanout, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if f, ok := t.active[key]; ok && f.invocationID == invocationID {
+		return f, true
+	}
+	f, ok := t.finished[invocationID]
+	if !ok || f.key != key || time.Since(f.ended) > resumeRetention {
+		return nil, false
+	}
+	return f, true
+}
+
+// publish records an event's JSON, as encoded by the origin's sseWriter,
+// sends it to the attached clients, and returns its SSE event ID. data is
+// copied, so the caller may reuse it. A client too far behind is
+// disconnected rather than left with a gap in its stream.
+func (f *turnFanout) publish(data []byte) string {
+	data = bytes.Clone(data)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.sent = append(f.sent, data)
+	f.size += len(data)
+	for f.size > resumeMaxBytes && len(f.sent) > 1 {
+		f.size -= len(f.sent[0])
+		f.sent[0] = nil
+		f.sent = f.sent[1:]
+		f.first++
+	}
+	for ch := range f.subs {
+		select {
+		case ch <- data:
+		default:
+			close(ch)
+			delete(f.subs, ch)
+		}
+	}
+	f.cancelIfAbandoned()
+	return f.eventID(f.first + len(f.sent))
+}
+
+// eventID returns the SSE event ID of the turn's nth event, counting from 1.
+func (f *turnFanout) eventID(n int) string {
+	return fmt.Sprintf("%s:%d", f.invocationID, n)
+}
+
+// join attaches a client, returning the kept events sent after the first
+// skip, how many events came before them, and a channel of later ones that
+// is closed when the turn ends. The channel is nil if the turn has already
+// ended. More than skip events come first if some were dropped past
+// resumeMaxBytes.
+func (f *turnFanout) join(skip int) ([][]byte, int, chan []byte) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	from := max(skip, f.first)
+	sent := append([][]byte(nil), f.sent[min(from-f.first, len(f.sent)):]...)
+	if f.done {
+		return sent, from, nil
+	}
+	ch := make(chan []byte, fanoutBuffer)
+	f.subs[ch] = struct{}{}
+	return sent, from, ch
+}
+
+// leave detaches a client.
+func (f *turnFanout) leave(ch chan []byte) {
+	if ch == nil {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.subs, ch)
+	f.cancelIfAbandoned()
+}
+
+// originLeft records that the client that started the turn disconnected.
+func (f *turnFanout) originLeft() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.originGone = true
+	f.cancelIfAbandoned()
+}
+
+// cancelIfAbandoned ends the turn once every client is gone, unless it is
+// detachable. f.mu must be held.
+func (f *turnFanout) cancelIfAbandoned() {
+	if f.originGone && len(f.subs) == 0 && !f.done && !f.detachable {
+		f.cancel()
+	}
+}
+
+// parseEventID splits an SSE event ID into its invocation ID and sequence
+// number.
+func parseEventID(id string) (invocationID string, n int, err error) {
+	invocationID, seq, ok := strings.Cut(id, ":")
+	if ok {
+		n, err = strconv.Atoi(seq)
+	}
+	if !ok || err != nil || n < 0 {
+		return "", 0, fmt.Errorf("invalid Last-Event-ID %q", id)
+	}
+	return invocationID, n, nil
+}
+
+// handleAttachRunSSE attaches to the session's running turn, streaming the
+// events sent so far and then every later one, in the same formats as
+// run_sse, until the turn ends. With Last-Event-ID, it resumes that turn
+// after the given event instead, even if the turn has since finished.
+func (h *Handler) handleAttachRunSSE(w http.ResponseWriter, r *http.Request) {
+	key := sessionKey(r)
+
+	var f *turnFanout
+	var ok bool
+	skip := 0
+	if lastID := r.Header.Get("Last-Event-ID"); lastID != "" {
+		invocationID, n, err := parseEventID(lastID)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if f, ok = h.fanouts.lookup(key, invocationID); !ok {
+			writeError(w, http.StatusNotFound, fmt.Sprintf("turn %s of session %s is no longer available", invocationID, key))
+			return
+		}
+		skip = n
+	} else if f, ok = h.fanouts.running(key); !ok {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("no turn is running for session %s", key))
+		return
+	}
+	sent, n, events := f.join(skip)
+	defer f.leave(events)
+	if n > skip && r.Header.Get("Last-Event-ID") != "" {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("events of turn %s after %d are no longer available", f.invocationID, skip))
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "streaming not supported")
+		return
+	}
+
+	ndjson := acceptsNDJSON(r)
+	if ndjson {
+		w.Header().Set("Content-Type", ndjsonContentType)
+	} else {
+		w.Header().Set("Content-Type", "text/event-stream")
+	}
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	sw := newSSEWriter(w, flusher)
+	if ndjson {
+		sw = newNDJSONWriter(w, flusher)
+	}
+	write := func(data []byte) {
+		n++
+		sw.writeEncoded(f.eventID(n), data)
+	}
+	for _, data := range sent {
+		write(data)
+	}
+	if events == nil {
+		return
+	}
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case data, ok := <-events:
+			if !ok {
+				return
+			}
+			write(data)
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package proxy
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestTurnFanout_ResumeLimit(t *testing.T) {
+	f := (&turnFanouts{}).start(SessionKey{App: "myapp", User: "user1", ID: "s1"}, "inv-1", func() {})
+	event := bytes.Repeat([]byte("x"), resumeMaxBytes/4)
+	var id string
+	for range 6 {
+		id = f.publish(event)
+	}
+	if id != "inv-1:6" {
+		t.Fatalf("expected IDs to keep counting past dropped events, got %s", id)
+	}
+	if f.size > resumeMaxBytes || f.first != 2 {
+		t.Fatalf("expected the oldest events dropped past %d bytes, kept %d bytes after dropping %d", resumeMaxBytes, f.size, f.first)
+	}
+
+	sent, n, ch := f.join(0)
+	defer f.leave(ch)
+	if n != 2 || len(sent) != 4 {
+		t.Errorf("expected the 4 kept events after 2 dropped, got %d after %d", len(sent), n)
+	}
+	sent, n, ch = f.join(5)
+	defer f.leave(ch)
+	if n != 5 || len(sent) != 1 {
+		t.Errorf("expected the last event after skipping 5, got %d after %d", len(sent), n)
+	}
+}
@@ -0,0 +1,75 @@
+package proxy
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/innomon/adk2goose/translator"
+	"google.golang.org/genai"
+)
+
+// finalOnly reports whether a run should stream only the final response:
+// the final_only query parameter, when present, overrides the app setting.
+func finalOnly(r *http.Request, appDefault bool) bool {
+	if v := r.URL.Query().Get("final_only"); v != "" {
+		if b, err := strconv.ParseBool(v); err == nil {
+			return b
+		}
+	}
+	return appDefault
+}
+
+// finalFilter reduces a turn's events to its final response. Model text is
+// collected instead of streamed, and text that precedes a tool call is
+// dropped as intermediate narration; when the turn completes, the remaining
+// text is emitted as one consolidated event ahead of the turn-complete
+// event. Errors and tool confirmation prompts, which the client must act
+// on, pass through unchanged.
+type finalFilter struct {
+	invocationID string
+	text         strings.Builder
+}
+
+// filter returns the events to emit in place of evt. Events it drops are
+// released.
+func (f *finalFilter) filter(evt *translator.ADKEvent) []*translator.ADKEvent {
+	if evt.TurnComplete {
+		if f.text.Len() == 0 {
+			return []*translator.ADKEvent{evt}
+		}
+		final := translator.NewContentEvent(f.invocationID, genai.NewContentFromText(f.text.String(), genai.RoleModel))
+		f.text.Reset()
+		return []*translator.ADKEvent{final, evt}
+	}
+	if evt.ErrorCode != "" || isConfirmationEvent(evt) {
+		return []*translator.ADKEvent{evt}
+	}
+
+	if evt.Content != nil {
+		for _, part := range evt.Content.Parts {
+			switch {
+			case part.FunctionCall != nil || part.FunctionResponse != nil:
+				f.text.Reset()
+			case part.Text != "" && !part.Thought:
+				f.text.WriteString(part.Text)
+			}
+		}
+	}
+	translator.ReleaseEvent(evt)
+	return nil
+}
+
+// isConfirmationEvent reports whether evt asks the client to confirm a tool
+// call.
+func isConfirmationEvent(evt *translator.ADKEvent) bool {
+	if evt.Content == nil {
+		return false
+	}
+	for _, part := range evt.Content.Parts {
+		if part.FunctionCall != nil && part.FunctionCall.Name == translator.ConfirmationFunctionName {
+			return true
+		}
+	}
+	return false
+}
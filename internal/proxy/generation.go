@@ -0,0 +1,59 @@
+package proxy
+
+import (
+	"context"
+	"log"
+
+	"github.com/innomon/adk2goose/gooseclient"
+	"github.com/innomon/adk2goose/translator"
+	"google.golang.org/genai"
+)
+
+// generationConfigMetadataKey is the customMetadata key under which the first
+// ADK event of a turn reports the generation settings applied to Goose.
+const generationConfigMetadataKey = "goose:generationConfig"
+
+// applyGenerationConfig pushes the Goose equivalents of an ADK generation
+// config to the session's provider and returns a description of what was
+// applied and what had no Goose counterpart, and a function restoring the
+// provider's own settings, to be called when the turn ends so the
+// parameters do not carry over into later turns. Goose's update_provider
+// needs a provider and model, so without GOOSE_PROVIDER and GOOSE_MODEL
+// nothing is applied.
+func (h *Handler) applyGenerationConfig(ctx context.Context, gooseSessionID string, gc *genai.GenerationConfig) (map[string]any, func(), error) {
+	params, ignored := translator.ADKGenerationConfigToGooseParams(gc)
+	restore := func() {}
+	if len(params) > 0 && (h.cfg.GooseProvider == "" || h.cfg.GooseModel == "") {
+		return map[string]any{
+			"applied": map[string]any{},
+			"ignored": ignored,
+			"skipped": "GOOSE_PROVIDER and GOOSE_MODEL must both be set to apply generation settings",
+		}, restore, nil
+	}
+	if len(params) > 0 {
+		if err := h.client.UpdateProvider(ctx, &gooseclient.UpdateProviderRequest{
+			Provider:      h.cfg.GooseProvider,
+			Model:         h.cfg.GooseModel,
+			SessionID:     gooseSessionID,
+			RequestParams: params,
+		}); err != nil {
+			return nil, restore, err
+		}
+		restore = func() {
+			err := h.client.UpdateProvider(context.WithoutCancel(ctx), &gooseclient.UpdateProviderRequest{
+				Provider:  h.cfg.GooseProvider,
+				Model:     h.cfg.GooseModel,
+				SessionID: gooseSessionID,
+			})
+			if err != nil {
+				log.Printf("session %s: restore provider settings: %v", gooseSessionID, err)
+			}
+		}
+	}
+
+	applied := map[string]any{"applied": params}
+	if len(ignored) > 0 {
+		applied["ignored"] = ignored
+	}
+	return applied, restore, nil
+}
@@ -1,14 +1,25 @@
 package proxy
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"sync"
 	"time"
 
-	"github.com/innomon/adk2goose/internal/gooseclient"
-	"github.com/innomon/adk2goose/internal/translator"
+	"github.com/gorilla/websocket"
+	"github.com/innomon/adk2goose/gooseclient"
+	"github.com/innomon/adk2goose/internal/config"
+	"github.com/innomon/adk2goose/internal/features"
+	"github.com/innomon/adk2goose/internal/metrics"
+	"github.com/innomon/adk2goose/internal/policy"
+	"github.com/innomon/adk2goose/internal/sentry"
+	"github.com/innomon/adk2goose/translator"
 	"google.golang.org/genai"
 )
 
@@ -16,77 +27,337 @@ import (
 // translator and gooseclient packages.
 type Handler struct {
 	sessions *SessionManager
-	client   *gooseclient.Client
+	client   gooseclient.API
+	cfg      *config.Config
 	mux      *http.ServeMux
+	admin    *http.ServeMux
+	argHooks []policy.ArgumentHook
+	authn    Authenticator
+	keys     *keyring
+	streams  *admission
+	turns    turnLocks
+	fanouts  turnFanouts
+	usage    usageLedger
+
+	artifacts *artifactStore
+	push      *pushHub
+	tap       *pushHub
+	polls     pollTurns
+	runs      *asyncRuns
+	sink      *eventSink
+	errs      *errorReporter
+
+	// fetches are the fileData downloads allowed by UPLOAD_FETCH_HOSTS.
+	fetches *egressPolicy
+
+	// callbacks are the async run callbacks allowed by RUN_CALLBACK_HOSTS.
+	callbacks *egressPolicy
+
+	// upgrader opens push channels from the origins PUSH_ORIGIN_HOSTS
+	// allows.
+	upgrader *websocket.Upgrader
+
+	// ids generates the unique part of invocation and webhook event IDs.
+	ids func() string
+
+	// routes lists the registered routes, for the OpenAPI spec, which is
+	// built on first request.
+	routes      []route
+	openAPIOnce sync.Once
+	openAPISpec []byte
 }
 
 // NewHandler creates a Handler that serves the ADK REST API routes.
-func NewHandler(sessions *SessionManager, client *gooseclient.Client) *Handler {
+func NewHandler(sessions *SessionManager, client gooseclient.API, cfg *config.Config) *Handler {
 	h := &Handler{
 		sessions: sessions,
 		client:   client,
+		cfg:      cfg,
 		mux:      http.NewServeMux(),
+		admin:    http.NewServeMux(),
+		streams:  newAdmission(cfg.MaxConcurrentStreams, cfg.StreamQueueTimeout),
+
+		artifacts: newArtifactStore(sessions.WorkingDir()),
+		push:      newPushHub(),
+		tap:       newTapHub(),
+		runs:      newAsyncRuns(cfg.RunWorkers),
+		fetches:   newEgressPolicy(cfg.UploadFetchHosts, 0),
+		callbacks: newEgressPolicy(cfg.RunCallbackHosts, webhookTimeout),
+		upgrader:  newUpgrader(cfg.PushOriginHosts),
+		ids:       translator.NewULID,
+	}
+	for _, dir := range []string{cfg.EventStoreDir, cfg.DebugCaptureDir, cfg.GooseCLI.SessionsDir} {
+		if dir != "" {
+			h.artifacts.skip = append(h.artifacts.skip, dir)
+		}
+	}
+	sessions.OnAgentStart(h.applyInstructions)
+	sessions.NameSessions(cfg.GooseSessionPrefix)
+	sessions.IsolateWorkingDirs(cfg.WorkingDirIsolation)
+	sessions.OnSessionCreate(func(key SessionKey) {
+		h.publishLifecycle(config.WebhookSessionCreated, key, nil)
+	})
+	if cfg.AuthUserHeader != "" {
+		h.authn = HeaderAuthenticator(cfg.AuthUserHeader)
+	}
+	if cfg.APIKeysFile != "" {
+		h.keys = newKeyring(cfg.APIKeysFile, cfg.APIKeys)
+		h.authn = h.keys.authenticate
 	}
 
-	h.mux.HandleFunc("POST /apps/{app}/users/{user}/sessions", h.handleCreateSession)
-	h.mux.HandleFunc("GET /apps/{app}/users/{user}/sessions", h.handleListSessions)
-	h.mux.HandleFunc("POST /apps/{app}/users/{user}/sessions/{session}/run_sse", h.handleRunSSE)
-	h.mux.HandleFunc("DELETE /apps/{app}/users/{user}/sessions/{session}", h.handleDeleteSession)
+	h.handleApp("POST /apps/{app}/users/{user}/sessions", h.handleCreateSession)
+	h.handleApp("POST /apps/{app}/users/{user}/sessions/{session}", h.handleCreateSession)
+	h.handleApp("GET /apps/{app}/users/{user}/sessions", h.handleListSessions)
+	h.handleApp("POST /apps/{app}/users/{user}/sessions/{session}/run_sse", h.handleRunSSE)
+	h.handleApp("GET /apps/{app}/users/{user}/sessions/{session}/run_sse", h.handleAttachRunSSE)
+	h.handleApp("GET /apps/{app}/users/{user}/sessions/{session}", h.handleGetSession)
+	h.handleApp("PATCH /apps/{app}/users/{user}/sessions/{session}", h.handleUpdateSession)
+	h.handleApp("DELETE /apps/{app}/users/{user}/sessions/{session}", h.handleDeleteSession)
+	h.handleApp("POST /apps/{app}/users/{user}/sessions/{session}/fork", h.handleForkSession)
+	h.handleApp("GET /apps/{app}/users/{user}/sessions/{session}/snapshot", h.handleSnapshotSession)
+	h.handleApp("GET /apps/{app}/users/{user}/sessions/{session}/export", h.handleExportSession)
+	h.handleApp("POST /apps/{app}/users/{user}/sessions/restore", h.handleRestoreSession)
+	h.handleApp("POST /apps/{app}/users/{user}/sessions/{session}/replay", h.handleReplaySession)
+	h.handleApp("POST /apps/{app}/users/{user}/sessions/{session}/run_poll", h.handleRunPoll)
+	h.handleApp("GET /apps/{app}/users/{user}/sessions/{session}/run_poll/{poll}", h.handlePollEvents)
+	h.handleApp("POST /apps/{app}/users/{user}/sessions/{session}/runs", h.handleCreateRun)
+	h.handleApp("GET /apps/{app}/users/{user}/sessions/{session}/runs/{run}", h.handleGetRun)
+	h.handleApp("GET /apps/{app}/users/{user}/sessions/{session}/push", h.handlePush)
+	h.handleApp("GET /apps/{app}/users/{user}/sessions/{session}/tools", h.handleListTools)
+	h.handleApp("GET /apps/{app}/users/{user}/sessions/{session}/artifacts", h.handleListArtifacts)
+	h.handleApp("GET /apps/{app}/users/{user}/sessions/{session}/artifacts/{name}", h.handleLoadArtifact)
+	h.handleApp("DELETE /apps/{app}/users/{user}/sessions/{session}/artifacts/{name}", h.handleDeleteArtifact)
+	h.handleApp("GET /apps/{app}/users/{user}/sessions/{session}/artifacts/{name}/versions", h.handleListArtifactVersions)
+	h.handleApp("GET /apps/{app}/users/{user}/sessions/{session}/artifacts/{name}/versions/{version}", h.handleLoadArtifact)
+
+	h.handleAdmin("GET /admin/sessions", http.HandlerFunc(h.handleAdminListSessions))
+	h.handleAdmin("GET /admin/sessions/{session}/tap", http.HandlerFunc(h.handleAdminTap))
+	h.handleAdmin("GET /admin/usage", http.HandlerFunc(h.handleAdminUsage))
+	h.handleAdmin("DELETE /admin/users/{user}/data", http.HandlerFunc(h.handleAdminPurgeUser))
+	h.handleAdmin("GET /admin/goose/pool", http.HandlerFunc(h.handleAdminGoosePool))
+	// Goose's configuration holds provider keys, so it is never served
+	// without admin credentials, even on a separate admin listener.
+	h.handleAdmin("GET /admin/goose/config", h.requireAdminCredentials(http.HandlerFunc(h.handleAdminGetGooseConfig)))
+	h.handleAdmin("GET /admin/goose/config/{key}", h.requireAdminCredentials(http.HandlerFunc(h.handleAdminGetGooseConfigKey)))
+	h.handleAdmin("PUT /admin/goose/config/{key}", h.requireAdminCredentials(http.HandlerFunc(h.handleAdminPutGooseConfigKey)))
+	h.handleAdmin("GET /admin/diagnostics", http.HandlerFunc(h.handleAdminDiagnostics))
+	h.handleAdmin("GET /admin/api-keys", http.HandlerFunc(h.handleAdminListAPIKeys))
+	h.handleAdmin("GET /metrics", metrics.Handler())
+	h.handlePprof()
+	h.mux.HandleFunc("GET /openapi.json", h.handleOpenAPI)
+	h.mux.HandleFunc("GET /version", h.handleVersion)
+	// Also on a separate admin listener, where operators are likely to ask.
+	h.admin.HandleFunc("GET /version", h.handleVersion)
+
+	// Without a separate admin listener, operational routes share the
+	// client-facing one, but only behind admin credentials: anyone who can
+	// reach the ADK routes could otherwise purge users and read Goose's
+	// secrets. With a keys file, authorizeAdmin requires an admin key even
+	// before a reload adds one.
+	if cfg.AdminListenAddr == "" && (cfg.AdminToken != "" || h.keys != nil) {
+		for _, prefix := range []string{"/admin/", "/metrics", "/debug/"} {
+			h.mux.Handle(prefix, h.admin)
+		}
+	}
 
 	return h
 }
 
-// ServeHTTP delegates to the internal mux.
+// SetIDSource makes the handler build invocation and webhook event IDs from
+// newID instead of ULIDs, for deterministic tests.
+func (h *Handler) SetIDSource(newID func() string) {
+	h.ids = newID
+}
+
+// newID returns a fresh ID with the given prefix.
+func (h *Handler) newID(prefix string) string {
+	return prefix + h.ids()
+}
+
+// ServeHTTP delegates to the internal mux and records per-route latency.
 func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	h.mux.ServeHTTP(w, r)
+	r = withTrace(w, r)
+	defer h.recoverPanic(r)
+	serveTimed(h.mux, w, r)
+}
+
+// AdminHandler serves the operational routes (/admin, /metrics, /debug) for
+// a separate admin listener.
+func (h *Handler) AdminHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r = withTrace(w, r)
+		defer h.recoverPanic(r)
+		serveTimed(h.admin, w, r)
+	})
+}
+
+// serveTimed serves r with mux and records the matched route's latency.
+func serveTimed(mux *http.ServeMux, w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	mux.ServeHTTP(w, r)
+	if r.Pattern != "" {
+		routeDuration.Observe(time.Since(start).Seconds(), r.Pattern)
+	}
 }
 
 // RunSSERequest is the JSON body sent by the ADK for the run_sse endpoint.
 type RunSSERequest struct {
-	NewMessage *genai.Content `json:"new_message"`
+	NewMessage       *genai.Content          `json:"new_message"`
+	RunConfig        *RunConfig              `json:"run_config,omitempty"`
+	GenerationConfig *genai.GenerationConfig `json:"generation_config,omitempty"`
+
+	// Agent selects a configured sub-agent of a multi-agent app. Branch is
+	// the ADK event branch (e.g. "root.researcher"); its last segment selects
+	// the sub-agent when Agent is empty.
+	Agent  string `json:"agent,omitempty"`
+	Branch string `json:"branch,omitempty"`
+}
+
+// CreateSessionRequest is the optional JSON body of the create-session
+// endpoint.
+type CreateSessionRequest struct {
+	State  map[string]any    `json:"state,omitempty"`
+	Labels map[string]string `json:"labels,omitempty"`
+	// Transcript seeds the new session with an exported conversation,
+	// which Goose receives as conversation_so_far on the first turn.
+	Transcript *SessionExport `json:"transcript,omitempty"`
 }
 
 func (h *Handler) handleCreateSession(w http.ResponseWriter, r *http.Request) {
 	app := r.PathValue("app")
 	user := r.PathValue("user")
 
-	adkSessionID := fmt.Sprintf("%s_%s_%d", app, user, time.Now().UnixNano())
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("read request: %v", err))
+		return
+	}
+	var req CreateSessionRequest
+	if err := validateBody(body, req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if len(bytes.TrimSpace(body)) > 0 {
+		if err := json.Unmarshal(body, &req); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("decode request: %v", err))
+			return
+		}
+	}
+	if err := validateLabels(req.Labels); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := validateStateDelta(req.State); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if req.Transcript != nil && req.Transcript.Version != exportVersion {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("unsupported transcript version %d", req.Transcript.Version))
+		return
+	}
+
+	// Creating a session under an ID that is already mapped returns the
+	// existing session, as ADK session services do.
+	key := sessionKey(r)
+	if key.ID == "" {
+		key.ID = fmt.Sprintf("%s_%s_%d", app, user, time.Now().UnixNano())
+	} else if sess, ok := h.sessions.Get(key); ok {
+		events, err := h.sessionHistory(r.Context(), sess)
+		if err != nil {
+			writeError(w, http.StatusBadGateway, fmt.Sprintf("get session: %v", err))
+			return
+		}
+		resp := sessionResponse(sess)
+		resp["events"] = events
+		writeJSON(w, http.StatusOK, resp)
+		return
+	}
 
-	_, err := h.sessions.GetOrCreate(r.Context(), adkSessionID)
+	var sess *Session
+	if req.Transcript != nil {
+		sess, err = h.importTranscript(r.Context(), key, req.Labels, req.Transcript)
+	} else {
+		sess, err = h.sessions.Create(r.Context(), key, req.Labels)
+	}
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, fmt.Sprintf("create session: %v", err))
+		writeStartError(w, http.StatusInternalServerError, "create session", err)
 		return
 	}
+	if len(req.State) > 0 {
+		if sess, err = h.sessions.ApplyStateDelta(key, req.State); err != nil {
+			writeError(w, http.StatusInternalServerError, fmt.Sprintf("create session: %v", err))
+			return
+		}
+	}
 
-	writeJSON(w, http.StatusOK, map[string]any{
-		"id":      adkSessionID,
-		"appName": app,
-		"userId":  user,
-		"state":   map[string]any{},
-		"events":  []any{},
-	})
+	writeJSON(w, http.StatusOK, sessionResponse(sess))
 }
 
 func (h *Handler) handleListSessions(w http.ResponseWriter, r *http.Request) {
-	sessions := h.sessions.ListMappedSessions()
+	labels, err := parseLabelFilter(r.URL.Query()["label"])
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	sessions, next, err := pageSessions(h.sessions.ListSessions(r.PathValue("app"), r.PathValue("user"), labels), r.URL.Query())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if next != "" {
+		w.Header().Set(nextPageTokenHeader, next)
+	}
 
 	result := make([]map[string]any, 0, len(sessions))
-	for adkID := range sessions {
-		result = append(result, map[string]any{
-			"id":     adkID,
-			"state":  map[string]any{},
-			"events": []any{},
-		})
+	for _, sess := range sessions {
+		result = append(result, sessionResponse(sess))
 	}
 
 	writeJSON(w, http.StatusOK, result)
 }
 
+// sessionResponse renders a session record in the ADK session JSON shape.
+func sessionResponse(sess *Session) map[string]any {
+	resp := map[string]any{
+		"id":             sess.ID,
+		"appName":        sess.AppName,
+		"userId":         sess.UserID,
+		"state":          sess.State(),
+		"events":         []any{},
+		"lastUpdateTime": float64(sess.LastUpdateTime.UnixNano()) / 1e9,
+	}
+	if len(sess.Labels) > 0 {
+		resp["labels"] = sess.Labels
+	}
+	if sess.ForkedFrom != "" {
+		resp["forkedFrom"] = sess.ForkedFrom
+	}
+	return resp
+}
+
 func (h *Handler) handleRunSSE(w http.ResponseWriter, r *http.Request) {
+	app := r.PathValue("app")
+	user := r.PathValue("user")
 	adkSessionID := r.PathValue("session")
+	key := sessionKey(r)
+	invocationID := h.newID("inv_")
+
+	capture := h.startCapture(key, invocationID)
+	defer capture.Close()
 
+	body, err := io.ReadAll(r.Body)
+	capture.captureRequest(body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("read request: %v", err))
+		return
+	}
 	var req RunSSERequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+	if err := validateBody(body, req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
 		writeError(w, http.StatusBadRequest, fmt.Sprintf("decode request: %v", err))
 		return
 	}
@@ -95,24 +366,216 @@ func (h *Handler) handleRunSSE(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusBadRequest, "new_message is required")
 		return
 	}
+	if role := req.NewMessage.Role; role == genai.RoleModel || role == translator.RoleSystem {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("new_message.role: must be %q", genai.RoleUser))
+		return
+	}
+	if err := req.RunConfig.validate(); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	timeout, err := turnTimeout(r, h.cfg.RequestTimeout)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if !h.streams.acquire(r.Context(), h.requestPriority(r)) {
+		rejectedStreams.Inc()
+		w.Header().Set("Retry-After", h.streams.retryAfter())
+		writeError(w, http.StatusServiceUnavailable, "too many concurrent streams, retry later")
+		return
+	}
+	defer h.streams.release()
+	activeStreams.Inc()
+	defer activeStreams.Dec()
 
-	gooseSessionID, err := h.sessions.GetOrCreate(r.Context(), adkSessionID)
+	agentName, agent, err := resolveAgent(h.cfg.App(app), &req)
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, fmt.Sprintf("session lookup: %v", err))
+		writeError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	replyReq := translator.ADKRunSSERequestToReplyRequest(gooseSessionID, req.NewMessage)
+	// Sessions not created explicitly are started, for app and user, by
+	// their first run.
+	var gooseSessionID string
+	sess, err := h.sessions.Create(r.Context(), key, nil)
+	if err == nil {
+		h.sessions.Touch(key)
+		gooseSessionID = sess.GooseID
+		if agent != nil {
+			gooseSessionID, err = h.sessions.GetOrCreateAgent(r.Context(), key, agentName, agent.RecipeID)
+		}
+	}
+	if err != nil {
+		h.errs.backendFailed(err, requestTags(r, invocationID))
+		writeStartError(w, http.StatusInternalServerError, "session lookup", err)
+		return
+	}
+
+	if !h.turns.tryAcquire(gooseSessionID) {
+		// A message of only function responses continues the running turn
+		// rather than starting a new one.
+		if responses, ok := functionResponsesOnly(req.NewMessage); ok {
+			h.continueTurn(w, r, gooseSessionID, invocationID, responses)
+			return
+		}
+		writeError(w, http.StatusConflict, "a turn is already running for this session")
+		return
+	}
+	defer h.turns.release(gooseSessionID)
+
+	var generationMeta map[string]any
+	if req.GenerationConfig != nil {
+		var restore func()
+		generationMeta, restore, err = h.applyGenerationConfig(r.Context(), gooseSessionID, req.GenerationConfig)
+		if err != nil {
+			writeError(w, http.StatusBadGateway, fmt.Sprintf("apply generation config: %v", err))
+			return
+		}
+		defer restore()
+	}
 
-	eventCh, err := h.client.Reply(r.Context(), replyReq)
+	workingDir, err := h.sessions.WorkingDirFor(key)
 	if err != nil {
-		writeError(w, http.StatusBadGateway, fmt.Sprintf("goose reply: %v", err))
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	message, err := materializeFiles(r.Context(), req.NewMessage, workingDir, h.sessions.FilesSubdir(key), h.fetches, int64(h.cfg.UploadMaxBytes))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	message = processImages(message, h.cfg.App(app).Images)
+	message, err = offloadInlineData(message, workingDir, h.sessions.FilesSubdir(key), h.cfg.InlineDataOffloadBytes)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	w.Header().Set("Content-Type", "text/event-stream")
-	w.Header().Set("Cache-Control", "no-cache")
-	w.Header().Set("Connection", "keep-alive")
+	replyReq := translator.ADKRunSSERequestToReplyRequest(gooseSessionID, message)
+	if agent == nil {
+		replyReq.ConversationSoFar = h.sessions.Seed(key)
+	}
+
+	// The turn deadline also bounds the Goose reply: when it passes, the
+	// reply stream is closed, which ends the turn on the backend as well.
+	// Other clients may attach to the turn, so it is only cancelled once
+	// this one and all of them have disconnected, and not at all if the app
+	// lets turns continue in the background; their events are still
+	// recorded in the session's event log.
+	turnCtx := context.WithoutCancel(r.Context())
+	ctx, cancel := context.WithCancel(turnCtx)
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(turnCtx, timeout)
+	}
+	defer cancel()
+	fanout := h.fanouts.start(key, invocationID, cancel)
+	fanout.detachable = h.cfg.App(app).ContinueOnDisconnect()
+	defer h.fanouts.finish(fanout)
+	defer context.AfterFunc(r.Context(), fanout.originLeft)()
+
+	stats := newTurnStats()
+	defer h.reportSlowTurn(stats, app, user, adkSessionID, invocationID)
+
+	author := h.cfg.App(app).EventAuthor(app)
+	if agentName != "" {
+		author = agentName
+	}
+
+	// Files Goose creates or modifies during the turn become session
+	// artifacts, reported on the turn's final event.
+	var outputsBefore outputState
+	if h.cfg.WorkingDirArtifacts {
+		outputsBefore = h.artifacts.scanOutputs(workingDir)
+	}
+
+	replyCtx := ctx
+	if capture != nil {
+		replyCtx = gooseclient.WithStreamTap(ctx, capture.goose.writer())
+	}
+	// A root agent's turn whose Goose server dies, before or during the
+	// reply, restarts once on the standby server, if there is one.
+	from := h.client.Active()
+	var failover *translator.ADKEvent
+	eventCh, err := h.client.Reply(replyCtx, replyReq)
+	if agent == nil && err != nil && !gooseclient.IsNotFound(err) && ctx.Err() == nil {
+		if id, conversation, ok := h.failOver(ctx, key, from, gooseSessionID, invocationID); ok {
+			defer h.turns.release(id)
+			gooseSessionID = id
+			replyReq.SessionID = id
+			replyReq.ConversationSoFar = conversation
+			failover = failoverEvent(invocationID, from, h.client.Active(), err.Error())
+			eventCh, err = h.client.Reply(replyCtx, replyReq)
+		}
+	}
+	if agent == nil && gooseclient.IsNotFound(err) {
+		// Goose lost the session, as after failing over to another instance:
+		// continue on a new agent with the conversation rebuilt from the
+		// session's ADK history instead of starting cold.
+		// A restarted Goose may have given the new agent the lost one's ID,
+		// whose turn lock this turn holds already.
+		held := gooseSessionID
+		var history []*translator.ADKEvent
+		gooseSessionID, history, err = h.sessions.Reattach(r.Context(), key)
+		if err == nil {
+			err = h.applySystemHistory(r.Context(), gooseSessionID, history)
+		}
+		if err == nil && gooseSessionID != held && !h.turns.tryAcquire(gooseSessionID) {
+			writeError(w, http.StatusConflict, "a turn is already running for this session")
+			return
+		}
+		if err == nil {
+			log.Printf("session %s: goose session lost, continuing on %s with %d events of history", adkSessionID, gooseSessionID, len(history))
+			defer h.turns.release(gooseSessionID)
+			replyReq.SessionID = gooseSessionID
+			replyReq.ConversationSoFar = append(replyReq.ConversationSoFar, translator.ADKEventsToGooseConversation(history)...)
+			eventCh, err = h.client.Reply(replyCtx, replyReq)
+		}
+	}
+	if err != nil {
+		h.errs.backendFailed(err, requestTags(r, invocationID))
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		writeError(w, http.StatusGatewayTimeout, fmt.Sprintf("goose reply: %v", err))
+		return
+	}
+	if err != nil {
+		writeStartError(w, http.StatusBadGateway, "goose reply", err)
+		return
+	}
+	h.errs.backendOK()
+	stats.replyAccepted()
+	if agent == nil {
+		h.sessions.ClearSeed(key)
+	}
+	userEvent := translator.NewContentEvent(invocationID, message)
+	userEvent.Author = "user"
+	if agentName != "" {
+		userEvent.Branch = req.Branch
+		if userEvent.Branch == "" {
+			userEvent.Branch = agentName
+		}
+	}
+	h.sessions.RecordEvents(key, userEvent)
+
+	// A turn that ends without completing is kept in session history as
+	// interrupted.
+	var outcome turnOutcome
+	defer func() {
+		if !outcome.completed {
+			h.sessions.RecordInterruption(key, outcome.interruption(invocationID, author,
+				r.Context().Err() != nil && !fanout.detachable, errors.Is(ctx.Err(), context.DeadlineExceeded)))
+			return
+		}
+		h.publishLifecycle(config.WebhookTurnCompleted, key, map[string]any{
+			"invocationId": invocationID,
+			"durationMs":   time.Since(stats.start).Milliseconds(),
+			"llmCalls":     stats.llmCalls,
+			"toolCalls":    stats.toolCalls,
+			"totalTokens":  stats.totalTokens,
+		})
+	}()
 
 	flusher, ok := w.(http.Flusher)
 	if !ok {
@@ -120,49 +583,321 @@ func (h *Handler) handleRunSSE(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	invocationID := fmt.Sprintf("inv_%d", time.Now().UnixNano())
+	ndjson := acceptsNDJSON(r)
+	if ndjson {
+		w.Header().Set("Content-Type", ndjsonContentType)
+	} else {
+		w.Header().Set("Content-Type", "text/event-stream")
+	}
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	if acceptsTrailers(r) {
+		w.Header().Set("Trailer", estimatedCostTrailer)
+	}
+
+	var out io.Writer = w
+	if h.cfg.SSEGzip {
+		w.Header().Add("Vary", "Accept-Encoding")
+		if acceptsGzip(r) {
+			w.Header().Set("Content-Encoding", "gzip")
+			gz := newGzipStream(w, flusher)
+			defer gz.Close()
+			out, flusher = gz, gz
+		}
+	}
+
+	if capture != nil {
+		out = io.MultiWriter(out, capture.adk.writer())
+	}
+	sw := newSSEWriter(out, flusher)
+	if ndjson {
+		sw = newNDJSONWriter(out, flusher)
+	}
+	sw.maxEvent = h.cfg.SSEMaxEventBytes
+	send := func(evt *translator.ADKEvent) {
+		defer translator.ReleaseEvent(evt)
+		// Once the client has gone, only attached clients see the event.
+		if err := sw.writePublished(fanout, evt); err != nil && r.Context().Err() == nil {
+			log.Printf("write ADK event: %v", err)
+		}
+	}
+
+	// With streaming_mode NONE, events are held back and delivered together
+	// once the turn ends.
+	var pending []*translator.ADKEvent
+	traced := false
+	emit := func(evt *translator.ADKEvent) {
+		evt.Author = author
+		if agentName != "" {
+			evt.Branch = req.Branch
+			if evt.Branch == "" {
+				evt.Branch = agentName
+			}
+		}
+		outcome.observe(evt)
+		if evt.ErrorCode != "" && !isToolDenial(evt.ErrorCode) {
+			h.publishLifecycle(config.WebhookError, key, map[string]any{
+				"invocationId": invocationID,
+				"errorCode":    evt.ErrorCode,
+				"errorMessage": evt.ErrorMessage,
+			})
+		}
+		h.push.publish(key.String(), evt)
+		if generationMeta != nil {
+			if evt.CustomMetadata == nil {
+				evt.CustomMetadata = make(map[string]any)
+			}
+			evt.CustomMetadata[generationConfigMetadataKey] = generationMeta
+			generationMeta = nil
+		}
+		if !traced {
+			stampTrace(evt, r)
+			traced = true
+		}
+		h.tap.publish(key.String(), evt)
+		h.sink.publish(key, evt)
+		if !evt.Partial {
+			if evt.Actions != nil && len(evt.Actions.StateDelta) > 0 {
+				if _, err := h.sessions.ApplyStateDelta(key, evt.Actions.StateDelta); err != nil {
+					log.Printf("session %s: apply state delta: %v", key, err)
+				}
+			}
+			// Sent events are released, so the event log keeps a copy,
+			// without the turn's temp: state.
+			recorded := *evt
+			if evt.Actions != nil {
+				actions := *evt.Actions
+				actions.StateDelta = withoutTempState(actions.StateDelta)
+				recorded.Actions = &actions
+			}
+			h.sessions.RecordEvents(key, &recorded)
+		}
+		if req.RunConfig.buffered() {
+			pending = append(pending, evt)
+			return
+		}
+		send(evt)
+	}
+	defer func() {
+		for _, evt := range pending {
+			send(evt)
+		}
+	}()
+
+	thoughts := includeThoughts(h.cfg.App(app), req.GenerationConfig)
+	var final *finalFilter
+	if finalOnly(r, h.cfg.App(app).FinalOnly) {
+		final = &finalFilter{invocationID: invocationID}
+	}
+	// The reply stream may end either way once the deadline passes.
+	reportDeadline := func() {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			emit(outcome.interrupt("deadline_exceeded", translator.NewErrorEvent(invocationID, "DEADLINE_EXCEEDED",
+				fmt.Sprintf("turn exceeded its %s deadline", timeout))))
+		}
+	}
+
+	toolState := newToolResultState(h.cfg.App(app).StateRules, h.cfg.ToolResultRules)
+	var toolCalls translator.ToolCallStream
+	var messages translator.MessageEvents
+	deniedTools := make(map[string]bool)
+	model := h.cfg.GooseModel
+	var llmCalls llmCallCounter
+	maxLLMCalls := req.RunConfig.maxLLMCalls()
+
+	// A stalled reply stream is abandoned: returning cancels the Goose request
+	// and releases the session's turn lock.
+	var stallTimer *time.Timer
+	var stalled <-chan time.Time
+	if h.cfg.StreamStallTimeout > 0 {
+		stallTimer = time.NewTimer(h.cfg.StreamStallTimeout)
+		defer stallTimer.Stop()
+		stalled = stallTimer.C
+	}
+
+	if failover != nil {
+		emit(failover)
+	}
+	finished := false
 
 	for {
 		select {
-		case <-r.Context().Done():
+		case <-ctx.Done():
+			reportDeadline()
+			return
+		case <-stalled:
+			log.Printf("session %s: no Goose event for %s, abandoning turn %s", gooseSessionID, h.cfg.StreamStallTimeout, invocationID)
+			emit(outcome.interrupt("stream_stalled", translator.NewErrorEvent(invocationID, "STREAM_STALLED",
+				fmt.Sprintf("no event from Goose for %s", h.cfg.StreamStallTimeout))))
 			return
 		case sse, ok := <-eventCh:
+			if !ok && !finished && failover == nil && agent == nil && ctx.Err() == nil {
+				// The stream broke off before Goose finished the turn.
+				if id, conversation, moved := h.failOver(ctx, key, from, gooseSessionID, invocationID); moved {
+					defer h.turns.release(id)
+					gooseSessionID = id
+					replyReq.SessionID = id
+					replyReq.ConversationSoFar = conversation
+					failover = failoverEvent(invocationID, from, h.client.Active(), "reply stream ended before the turn finished")
+					if eventCh, err = h.client.Reply(replyCtx, replyReq); err == nil {
+						emit(failover)
+						continue
+					}
+					log.Printf("session %s: goose reply after failover: %v", key, err)
+				}
+			}
 			if !ok {
+				reportDeadline()
 				return
 			}
+			if sse.Type == "Finish" {
+				finished = true
+			}
+			if stallTimer != nil {
+				stallTimer.Reset(h.cfg.StreamStallTimeout)
+			}
+			stats.observe(&sse)
+			if sse.Type == "ModelChange" && sse.Model != "" {
+				model = sse.Model
+			}
+
+			if sse.Type == "Message" && sse.Message != nil {
+				n := llmCalls.observe(sse.Message)
+				stats.llmCalls = n
+				if maxLLMCalls > 0 && n > maxLLMCalls {
+					emit(outcome.interrupt("max_llm_calls", translator.NewErrorEvent(invocationID, "MAX_LLM_CALLS_EXCEEDED",
+						fmt.Sprintf("turn exceeded run_config.max_llm_calls (%d)", maxLLMCalls))))
+					return
+				}
+			}
+
+			if sse.Type == "Message" && sse.Message != nil && len(sse.Message.Content) > 0 {
+				toolCalls.Accumulate(sse.Message)
+				if !messages.Dedupe(sse.Message) {
+					continue
+				}
+				blocked, err := h.enforceToolPolicy(ctx, key, gooseSessionID, invocationID, sse.Message, deniedTools)
+				for _, evt := range blocked {
+					emit(evt)
+				}
+				if err != nil {
+					emit(outcome.interrupt("tool_answer_failed", translator.NewErrorEvent(invocationID, "TOOL_ANSWER_FAILED",
+						fmt.Sprintf("could not answer a tool call, so the turn was stopped: %v", err))))
+					return
+				}
+				if len(sse.Message.Content) == 0 {
+					continue
+				}
+			}
+
+			var stateDelta map[string]any
+			if sse.Type == "Message" && sse.Message != nil {
+				stateDelta = toolState.extract(sse.Message)
+			}
 
 			adkEvent, err := translator.GooseSSEEventToADKEvent(&sse, invocationID)
 			if err != nil {
 				log.Printf("translate SSE event: %v", err)
+				tags := requestTags(r, invocationID)
+				tags["gooseEvent"] = sse.Type
+				h.errs.capture(&sentry.Event{
+					Message: fmt.Sprintf("translate Goose %s event: %v", sse.Type, err),
+					Type:    "TranslationError",
+					Value:   err.Error(),
+					Tags:    tags,
+				})
 				continue
 			}
 			if adkEvent == nil {
 				continue
 			}
-
-			jsonBytes, err := json.Marshal(adkEvent)
-			if err != nil {
-				log.Printf("marshal ADK event: %v", err)
+			if adkEvent.Partial && sse.Type == "Message" && !h.cfg.Features.Enabled(features.PartialStreaming) {
+				translator.ReleaseEvent(adkEvent)
+				continue
+			}
+			addStateDelta(adkEvent, stateDelta)
+			if sse.Type == "Finish" && sse.TokenState != nil {
+				h.recordTurnUsage(w, key, model, sse.TokenState, adkEvent)
+			}
+			if sse.Type == "Message" && sse.Message != nil {
+				messages.Stamp(adkEvent, sse.Message)
+				if !h.cfg.Features.Enabled(features.StructuredToolResponses) {
+					flattenToolResults(sse.Message, adkEvent)
+				}
+				toolState.reshape(sse.Message, adkEvent)
+			}
+			if !thoughts && !stripThoughts(adkEvent) {
+				translator.ReleaseEvent(adkEvent)
 				continue
 			}
 
-			fmt.Fprintf(w, "data: %s\n\n", jsonBytes)
-			flusher.Flush()
+			if adkEvent.TurnComplete && outputsBefore != nil {
+				if delta := h.artifacts.recordOutputs(key.String(), workingDir, outputsBefore); delta != nil {
+					if adkEvent.Actions == nil {
+						adkEvent.Actions = &translator.ADKEventActions{}
+					}
+					adkEvent.Actions.ArtifactDelta = delta
+				}
+			}
+
+			h.truncateToolResults(app, user, adkSessionID, adkEvent)
+			if final != nil {
+				for _, evt := range final.filter(adkEvent) {
+					emit(evt)
+				}
+				continue
+			}
+			emit(adkEvent)
 		}
 	}
 }
 
+func (h *Handler) handleForkSession(w http.ResponseWriter, r *http.Request) {
+	app := r.PathValue("app")
+	user := r.PathValue("user")
+	src := sessionKey(r)
+
+	adkSessionID := fmt.Sprintf("%s_%s_%d", app, user, time.Now().UnixNano())
+
+	sess, err := h.sessions.Fork(r.Context(), src, adkSessionID)
+	if errors.Is(err, ErrSessionNotFound) {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		writeStartError(w, http.StatusBadGateway, "fork session", err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, sessionResponse(sess))
+}
+
 func (h *Handler) handleDeleteSession(w http.ResponseWriter, r *http.Request) {
-	adkSessionID := r.PathValue("session")
+	key := sessionKey(r)
 
-	if err := h.sessions.Stop(r.Context(), adkSessionID); err != nil {
+	err := h.sessions.Stop(r.Context(), key)
+	if errors.Is(err, ErrSessionNotFound) {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
 		writeError(w, http.StatusInternalServerError, fmt.Sprintf("stop session: %v", err))
 		return
 	}
+	h.forgetSession(key)
 
 	w.WriteHeader(http.StatusOK)
 }
 
+// forgetSession drops what the handler holds for a deleted session: its
+// artifacts, async run results, and push and tap subscribers.
+func (h *Handler) forgetSession(key SessionKey) {
+	h.artifacts.deleteSession(key.String())
+	h.runs.removeSession(key)
+	h.push.closeSession(key.String())
+	h.tap.closeSession(key.String())
+}
+
 func writeJSON(w http.ResponseWriter, status int, v any) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
@@ -174,3 +909,13 @@ func writeJSON(w http.ResponseWriter, status int, v any) {
 func writeError(w http.ResponseWriter, status int, msg string) {
 	writeJSON(w, status, map[string]string{"error": msg})
 }
+
+// writeStartError reports a failure to start or look up a session's Goose
+// agent. A full Goose pool is temporary, so clients are told to retry.
+func writeStartError(w http.ResponseWriter, status int, msg string, err error) {
+	if errors.Is(err, gooseclient.ErrPoolFull) {
+		w.Header().Set("Retry-After", "5")
+		status = http.StatusServiceUnavailable
+	}
+	writeError(w, status, fmt.Sprintf("%s: %v", msg, err))
+}
@@ -3,38 +3,164 @@ package proxy
 import (
 	"bufio"
 	"bytes"
+	"compress/gzip"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log"
+	"log/slog"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
-	"github.com/innomon/adk2goose/internal/gooseclient"
+	"github.com/innomon/adk2goose/gooseclient"
+	"github.com/innomon/adk2goose/internal/config"
+	"github.com/innomon/adk2goose/internal/features"
+	"github.com/innomon/adk2goose/internal/policy"
+	"github.com/innomon/adk2goose/internal/sentry"
+	"github.com/innomon/adk2goose/internal/transform"
 	"google.golang.org/genai"
 )
 
-func newMockGooseServer(t *testing.T) *httptest.Server {
+// defaultReplyEvents is the SSE stream the mock Goose server returns from
+// /reply unless a test supplies its own.
+var defaultReplyEvents = []string{
+	`{"type":"Message","message":{"role":"assistant","created":1234567890,"content":[{"type":"text","text":"Hello from Goose!"}]},"token_state":{"input_tokens":10,"output_tokens":5,"total_tokens":15}}`,
+	`{"type":"Finish","reason":"stop","token_state":{"input_tokens":10,"output_tokens":5,"total_tokens":15}}`,
+}
+
+// mockGoose is a fake Goose server that records the calls the proxy makes.
+type mockGoose struct {
+	*httptest.Server
+
+	mu    sync.Mutex
+	calls map[string][][]byte // path → request bodies
+	delay time.Duration       // pause before each /reply event
+	lost  map[string]bool     // Goose session IDs Goose answers 404 for
+	names map[string]string   // Goose session ID → name it was started with
+	dying bool                // /reply streams break off before Finish, /status fails
+
+	confirmFails bool // /confirm answers 500
+	replyFails   int  // how many more /reply calls answer 500
+}
+
+// record stores the body of a request made to path.
+func (m *mockGoose) record(path string, body []byte) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.calls[path] = append(m.calls[path], body)
+}
+
+// Calls decodes the bodies of every request made to path into a slice of T.
+func Calls[T any](t *testing.T, m *mockGoose, path string) []T {
 	t.Helper()
+	m.mu.Lock()
+	defer m.mu.Unlock()
 
+	out := make([]T, 0, len(m.calls[path]))
+	for _, body := range m.calls[path] {
+		var v T
+		if err := json.Unmarshal(body, &v); err != nil {
+			t.Fatalf("decode %s request: %v", path, err)
+		}
+		out = append(out, v)
+	}
+	return out
+}
+
+func newMockGooseServer(t *testing.T, replyEvents []string) *mockGoose {
+	t.Helper()
+
+	m := &mockGoose{calls: make(map[string][][]byte), names: make(map[string]string)}
 	mux := http.NewServeMux()
 
+	// Record every request body before dispatching it.
+	recording := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		m.record(r.URL.Path, body)
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		mux.ServeHTTP(w, r)
+	})
+
+	var started int
 	mux.HandleFunc("POST /agent/start", func(w http.ResponseWriter, r *http.Request) {
+		var req gooseclient.StartAgentRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		m.mu.Lock()
+		started++
+		id := fmt.Sprintf("goose-session-%d", started)
+		m.names[id] = req.Name
+		m.mu.Unlock()
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]string{
-			"id":          "goose-session-1",
+			"id":          id,
 			"name":        "test",
 			"working_dir": "/tmp",
 		})
 	})
 
-	mux.HandleFunc("POST /agent/stop", func(w http.ResponseWriter, r *http.Request) {
+	mux.HandleFunc("GET /agent/tools", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
-		fmt.Fprint(w, "{}")
+		fmt.Fprint(w, `[
+			{"name":"developer__shell","description":"Run a shell command","parameters":["command"],"permission":"ask_before"},
+			{"name":"developer__text_editor","description":"Edit files","parameters":["path","command"],"input_schema":{"type":"object","properties":{"path":{"type":"string"}}}}
+		]`)
 	})
 
+	mux.HandleFunc("GET /config", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"config":{"GOOSE_PROVIDER":"openai","OPENAI_API_KEY":"********"}}`)
+	})
+
+	mux.HandleFunc("POST /config/read", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `"gpt-4o"`)
+	})
+
+	for _, path := range []string{"/agent/stop", "/confirm", "/agent/update_provider", "/agent/prompt", "/tool_result", "/config/upsert"} {
+		mux.HandleFunc("POST "+path, func(w http.ResponseWriter, r *http.Request) {
+			m.mu.Lock()
+			fail := path == "/confirm" && m.confirmFails
+			m.mu.Unlock()
+			if fail {
+				http.Error(w, "confirmation failed", http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, "{}")
+		})
+	}
+
 	mux.HandleFunc("POST /reply", func(w http.ResponseWriter, r *http.Request) {
+		var reply gooseclient.ReplyRequest
+		json.NewDecoder(r.Body).Decode(&reply)
+		m.mu.Lock()
+		lost := m.lost[reply.SessionID]
+		fail := m.replyFails > 0
+		if fail {
+			m.replyFails--
+		}
+		m.mu.Unlock()
+		if lost {
+			http.Error(w, "session not found", http.StatusNotFound)
+			return
+		}
+		if fail {
+			http.Error(w, "provider unavailable", http.StatusInternalServerError)
+			return
+		}
+
 		flusher, ok := w.(http.Flusher)
 		if !ok {
 			http.Error(w, "streaming not supported", http.StatusInternalServerError)
@@ -45,30 +171,117 @@ func newMockGooseServer(t *testing.T) *httptest.Server {
 		w.Header().Set("Cache-Control", "no-cache")
 		w.Header().Set("Connection", "keep-alive")
 
-		fmt.Fprint(w, `data: {"type":"Message","message":{"role":"assistant","created":1234567890,"content":[{"type":"text","text":"Hello from Goose!"}]},"token_state":{"input_tokens":10,"output_tokens":5,"total_tokens":15}}`+"\n\n")
+		w.WriteHeader(http.StatusOK)
 		flusher.Flush()
 
-		fmt.Fprint(w, `data: {"type":"Finish","reason":"stop","token_state":{"input_tokens":10,"output_tokens":5,"total_tokens":15}}`+"\n\n")
-		flusher.Flush()
+		m.mu.Lock()
+		delay, dying := m.delay, m.dying
+		m.mu.Unlock()
+
+		for _, evt := range replyEvents {
+			if dying && strings.Contains(evt, `"type":"Finish"`) {
+				return
+			}
+			select {
+			case <-r.Context().Done():
+				return
+			case <-time.After(delay):
+			}
+			fmt.Fprint(w, "data: "+evt+"\n\n")
+			flusher.Flush()
+		}
+	})
+
+	mux.HandleFunc("POST /agent/resume", func(w http.ResponseWriter, r *http.Request) {
+		var req gooseclient.ResumeAgentRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		m.mu.Lock()
+		lost := m.lost[req.SessionID]
+		m.mu.Unlock()
+		if lost {
+			http.Error(w, "session not found", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"id": req.SessionID})
+	})
+
+	mux.HandleFunc("GET /sessions/{id}", func(w http.ResponseWriter, r *http.Request) {
+		m.mu.Lock()
+		lost := m.lost[r.PathValue("id")]
+		m.mu.Unlock()
+		if lost {
+			http.Error(w, "session not found", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"sessionId": r.PathValue("id"),
+			"messages": []any{
+				map[string]any{"role": "user", "created": 1, "content": []any{map[string]any{"type": "text", "text": "hello"}}},
+				map[string]any{"role": "assistant", "created": 2, "content": []any{map[string]any{"type": "text", "text": "Hello from Goose!"}}},
+			},
+		})
+	})
+
+	mux.HandleFunc("GET /status", func(w http.ResponseWriter, r *http.Request) {
+		m.mu.Lock()
+		dying := m.dying
+		m.mu.Unlock()
+		if dying {
+			http.Error(w, "shutting down", http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(w, "ok")
+	})
+
+	mux.HandleFunc("GET /system_info", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(gooseclient.SystemInfo{AppVersion: "1.9.0", OS: "linux"})
+	})
+
+	mux.HandleFunc("DELETE /sessions/{id}", func(w http.ResponseWriter, r *http.Request) {
+		m.mu.Lock()
+		if m.lost == nil {
+			m.lost = make(map[string]bool)
+		}
+		m.lost[r.PathValue("id")] = true
+		m.mu.Unlock()
+		w.WriteHeader(http.StatusOK)
 	})
 
 	mux.HandleFunc("GET /sessions", func(w http.ResponseWriter, r *http.Request) {
+		var sessions []gooseclient.SessionInfo
+		m.mu.Lock()
+		for i := 1; i <= started; i++ {
+			if id := fmt.Sprintf("goose-session-%d", i); !m.lost[id] {
+				sessions = append(sessions, gooseclient.SessionInfo{ID: id, Name: m.names[id]})
+			}
+		}
+		m.mu.Unlock()
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]any{"sessions": []any{}})
+		json.NewEncoder(w).Encode(gooseclient.SessionListResponse{Sessions: sessions})
 	})
 
-	srv := httptest.NewServer(mux)
-	t.Cleanup(srv.Close)
-	return srv
+	m.Server = httptest.NewServer(recording)
+	t.Cleanup(m.Server.Close)
+	return m
 }
 
-func setupProxy(t *testing.T) (*httptest.Server, *httptest.Server) {
+func setupProxy(t *testing.T) (*mockGoose, *httptest.Server) {
+	t.Helper()
+	return setupProxyWith(t, &config.Config{}, defaultReplyEvents)
+}
+
+// setupProxyWith starts a proxy using cfg in front of a mock Goose server
+// that answers /reply with replyEvents.
+func setupProxyWith(t *testing.T, cfg *config.Config, replyEvents []string) (*mockGoose, *httptest.Server) {
 	t.Helper()
 
-	gooseSrv := newMockGooseServer(t)
+	gooseSrv := newMockGooseServer(t, replyEvents)
 	client := gooseclient.New(gooseSrv.URL, "")
-	sessions := NewSessionManager(client, "/tmp")
-	handler := NewHandler(sessions, client)
+	sessions := NewSessionManager(client, t.TempDir())
+	handler := NewHandler(sessions, client, cfg)
 
 	proxySrv := httptest.NewServer(handler)
 	t.Cleanup(proxySrv.Close)
@@ -76,6 +289,100 @@ func setupProxy(t *testing.T) (*httptest.Server, *httptest.Server) {
 	return gooseSrv, proxySrv
 }
 
+// testAdminToken is the ADMIN_TOKEN of proxies whose admin routes tests
+// use: without admin credentials they are not served on the client port.
+const testAdminToken = "admin-s3cret"
+
+// adminDo sends an admin request with testAdminToken.
+func adminDo(t *testing.T, method, url string, body io.Reader) *http.Response {
+	t.Helper()
+	req, _ := http.NewRequest(method, url, body)
+	req.Header.Set("Authorization", "Bearer "+testAdminToken)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, url, err)
+	}
+	return resp
+}
+
+// createSession creates an ADK session through the proxy and returns its ID.
+func createSession(t *testing.T, proxyURL, app, user string) string {
+	t.Helper()
+
+	resp, err := http.Post(fmt.Sprintf("%s/apps/%s/users/%s/sessions", proxyURL, app, user), "application/json", strings.NewReader("{}"))
+	if err != nil {
+		t.Fatalf("POST create session: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var result map[string]any
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatalf("decode create response: %v", err)
+	}
+	id, _ := result["id"].(string)
+	if id == "" {
+		t.Fatal("expected non-empty session id")
+	}
+	return id
+}
+
+// runSSE sends text to a session's run_sse endpoint and returns the decoded
+// ADK events from the stream.
+func runSSE(t *testing.T, proxyURL, app, user, sessionID, text string) []map[string]any {
+	t.Helper()
+
+	resp := postRunSSE(t, proxyURL, app, user, sessionID, map[string]any{
+		"new_message": &genai.Content{
+			Parts: []*genai.Part{genai.NewPartFromText(text)},
+			Role:  "user",
+		},
+	})
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		t.Fatalf("expected status 200, got %d: %s", resp.StatusCode, body)
+	}
+	return readSSEEvents(t, resp.Body)
+}
+
+// postRunSSE posts body to a session's run_sse endpoint and returns the raw
+// response.
+func postRunSSE(t *testing.T, proxyURL, app, user, sessionID string, body map[string]any) *http.Response {
+	t.Helper()
+
+	reqBytes, _ := json.Marshal(body)
+	resp, err := http.Post(
+		fmt.Sprintf("%s/apps/%s/users/%s/sessions/%s/run_sse", proxyURL, app, user, sessionID),
+		"application/json",
+		bytes.NewReader(reqBytes),
+	)
+	if err != nil {
+		t.Fatalf("POST run_sse: %v", err)
+	}
+	return resp
+}
+
+// readSSEEvents decodes every SSE data frame in r.
+func readSSEEvents(t *testing.T, r io.Reader) []map[string]any {
+	t.Helper()
+
+	var events []map[string]any
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "data: ") {
+			continue
+		}
+		var evt map[string]any
+		if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &evt); err != nil {
+			t.Fatalf("unmarshal SSE event: %v", err)
+		}
+		events = append(events, evt)
+	}
+	return events
+}
+
 func TestCreateSession(t *testing.T) {
 	_, proxySrv := setupProxy(t)
 
@@ -241,3 +548,3422 @@ func TestListSessions(t *testing.T) {
 		t.Fatalf("expected status 200, got %d", resp.StatusCode)
 	}
 }
+
+func TestRunSSE_DeniedTool(t *testing.T) {
+	denials := make(chan LifecycleEvent, 10)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var evt LifecycleEvent
+		json.NewDecoder(r.Body).Decode(&evt)
+		denials <- evt
+	}))
+	t.Cleanup(hook.Close)
+	cfg := &config.Config{
+		Apps: map[string]config.AppConfig{
+			"myapp": {ToolPolicy: policy.ToolPolicy{Deny: []string{"developer__shell"}}},
+		},
+		Webhooks: []config.Webhook{{URL: hook.URL, Events: []string{config.WebhookToolDenied}}},
+	}
+	// In approve mode Goose announces the call, then asks to confirm it.
+	gooseSrv, proxySrv := setupProxyWith(t, cfg, []string{
+		`{"type":"Message","message":{"role":"assistant","created":1,"content":[{"type":"toolRequest","id":"call-1","toolCall":{"name":"developer__shell","arguments":{"command":"rm -rf /"}}}]}}`,
+		`{"type":"Message","message":{"role":"assistant","created":2,"content":[{"type":"toolConfirmationRequest","id":"call-1","toolName":"developer__shell","arguments":{"command":"rm -rf /"}}]}}`,
+		`{"type":"Finish","reason":"stop"}`,
+	})
+
+	sessionID := createSession(t, proxySrv.URL, "myapp", "user1")
+	events := runSSE(t, proxySrv.URL, "myapp", "user1", sessionID, "clean up")
+
+	if len(events) != 2 {
+		t.Fatalf("expected 2 events (denial + finish), got %d: %+v", len(events), events)
+	}
+	if code, _ := events[0]["errorCode"].(string); code != "TOOL_DENIED" {
+		t.Fatalf("expected errorCode TOOL_DENIED, got %+v", events[0])
+	}
+	if events[0]["content"] != nil {
+		t.Fatalf("expected denied tool call to be stripped, got %+v", events[0])
+	}
+
+	confirms := Calls[gooseclient.ToolConfirmationRequest](t, gooseSrv, "/confirm")
+	if len(confirms) != 1 {
+		t.Fatalf("expected 1 confirmation sent to Goose, got %d", len(confirms))
+	}
+	if confirms[0].RequestID != "call-1" || confirms[0].Approved {
+		t.Fatalf("expected denial of call-1, got %+v", confirms[0])
+	}
+
+	select {
+	case evt := <-denials:
+		if evt.Type != config.WebhookToolDenied {
+			t.Fatalf("expected a tool.denied webhook, got %+v", evt)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the tool.denied webhook")
+	}
+	select {
+	case evt := <-denials:
+		t.Fatalf("expected a single tool.denied webhook, got another %+v", evt)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestRunSSE_DenialFails(t *testing.T) {
+	cfg := &config.Config{
+		Apps: map[string]config.AppConfig{
+			"myapp": {ToolPolicy: policy.ToolPolicy{Deny: []string{"developer__shell"}}},
+		},
+	}
+	gooseSrv, proxySrv := setupProxyWith(t, cfg, []string{
+		`{"type":"Message","message":{"role":"assistant","created":1,"content":[{"type":"toolRequest","id":"call-1","toolCall":{"name":"developer__shell","arguments":{"command":"rm -rf /"}}}]}}`,
+		`{"type":"Message","message":{"role":"assistant","created":2,"content":[{"type":"toolConfirmationRequest","id":"call-1","toolName":"developer__shell","arguments":{"command":"rm -rf /"}}]}}`,
+		`{"type":"Message","message":{"role":"user","created":2,"content":[{"type":"toolResponse","id":"call-1","toolResult":{"status":"success","value":[]}}]}}`,
+		`{"type":"Finish","reason":"stop"}`,
+	})
+	gooseSrv.mu.Lock()
+	gooseSrv.confirmFails = true
+	gooseSrv.mu.Unlock()
+
+	sessionID := createSession(t, proxySrv.URL, "myapp", "user1")
+	events := runSSE(t, proxySrv.URL, "myapp", "user1", sessionID, "clean up")
+
+	// The turn ends instead of carrying on as if the call were denied.
+	if len(events) != 2 || events[0]["errorCode"] != "TOOL_DENIED" {
+		t.Fatalf("expected the denial and the error ending the turn, got %d: %+v", len(events), events)
+	}
+	if code, _ := events[1]["errorCode"].(string); code != "TOOL_ANSWER_FAILED" || events[1]["interrupted"] != true {
+		t.Fatalf("expected an interrupting TOOL_ANSWER_FAILED, got %+v", events[1])
+	}
+}
+
+func TestRunSSE_RejectedToolArguments(t *testing.T) {
+	rule := policy.ArgumentRule{Tool: "developer__shell", Argument: "command", Deny: []string{`\bsudo\b`}}
+	if err := rule.Compile(); err != nil {
+		t.Fatalf("compile rule: %v", err)
+	}
+	cfg := &config.Config{
+		Apps: map[string]config.AppConfig{
+			"myapp": {ArgumentRules: []policy.ArgumentRule{rule}},
+		},
+	}
+	gooseSrv, proxySrv := setupProxyWith(t, cfg, []string{
+		`{"type":"Message","message":{"role":"assistant","created":1,"content":[{"type":"text","text":"running it"},{"type":"toolRequest","id":"call-1","toolCall":{"name":"developer__shell","arguments":{"command":"sudo reboot"}}}]}}`,
+		`{"type":"Message","message":{"role":"assistant","created":2,"content":[{"type":"toolConfirmationRequest","id":"call-1","toolName":"developer__shell","arguments":{"command":"sudo reboot"}}]}}`,
+		`{"type":"Finish","reason":"stop"}`,
+	})
+
+	sessionID := createSession(t, proxySrv.URL, "myapp", "user1")
+	events := runSSE(t, proxySrv.URL, "myapp", "user1", sessionID, "reboot")
+
+	if len(events) != 3 {
+		t.Fatalf("expected 3 events (rejection, text, finish), got %d: %+v", len(events), events)
+	}
+	if code, _ := events[0]["errorCode"].(string); code != "TOOL_ARGUMENT_REJECTED" {
+		t.Fatalf("expected errorCode TOOL_ARGUMENT_REJECTED, got %+v", events[0])
+	}
+	parts := events[1]["content"].(map[string]any)["parts"].([]any)
+	if len(parts) != 1 {
+		t.Fatalf("expected only the text part to remain, got %+v", parts)
+	}
+	if len(Calls[gooseclient.ToolConfirmationRequest](t, gooseSrv, "/confirm")) != 1 {
+		t.Fatalf("expected the call to be denied on Goose")
+	}
+
+	// Goose cannot be given rewritten arguments, so a hook rewriting them
+	// denies the call.
+	gooseSrv = newMockGooseServer(t, []string{
+		`{"type":"Message","message":{"role":"assistant","created":1,"content":[{"type":"toolRequest","id":"call-1","toolCall":{"name":"developer__shell","arguments":{"command":"ls"}}}]}}`,
+		`{"type":"Message","message":{"role":"assistant","created":2,"content":[{"type":"toolConfirmationRequest","id":"call-1","toolName":"developer__shell","arguments":{"command":"ls"}}]}}`,
+		`{"type":"Finish","reason":"stop"}`,
+	})
+	client := gooseclient.New(gooseSrv.URL, "")
+	handler := NewHandler(NewSessionManager(client, t.TempDir()), client, &config.Config{})
+	handler.AddArgumentHook(func(_ string, args map[string]any) error {
+		args["command"] = "ls -a"
+		return nil
+	})
+	proxySrv = httptest.NewServer(handler)
+	t.Cleanup(proxySrv.Close)
+
+	sessionID = createSession(t, proxySrv.URL, "myapp", "user1")
+	events = runSSE(t, proxySrv.URL, "myapp", "user1", sessionID, "list")
+	if code, _ := events[0]["errorCode"].(string); code != "TOOL_ARGUMENT_REJECTED" {
+		t.Fatalf("expected a rewritten call to be rejected, got %+v", events[0])
+	}
+	confirms := Calls[gooseclient.ToolConfirmationRequest](t, gooseSrv, "/confirm")
+	if len(confirms) != 1 || confirms[0].Approved {
+		t.Fatalf("expected the rewritten call to be denied on Goose, got %+v", confirms)
+	}
+}
+
+func TestRunSSE_StreamingToolCall(t *testing.T) {
+	pieces := []string{
+		`{"type":"Message","message":{"id":"msg-1","role":"assistant","created":1,"content":[{"type":"toolRequest","id":"call-1","toolCall":{"name":"developer__text_editor","arguments_delta":"{\"path\": \"/tmp/a"}}]}}`,
+		`{"type":"Message","message":{"id":"msg-1","role":"assistant","created":1,"content":[{"type":"toolRequest","id":"call-1","toolCall":{"name":"developer__text_editor","arguments_delta":".txt\", \"command\": \"wri"}}]}}`,
+		`{"type":"Message","message":{"id":"msg-1","role":"assistant","created":1,"content":[{"type":"toolRequest","id":"call-1","toolCall":{"name":"developer__text_editor","arguments":{"path":"/tmp/a.txt","command":"write"}}}]}}`,
+		`{"type":"Finish","reason":"stop"}`,
+	}
+	_, proxySrv := setupProxyWith(t, &config.Config{}, pieces)
+	sessionID := createSession(t, proxySrv.URL, "myapp", "user1")
+	events := runSSE(t, proxySrv.URL, "myapp", "user1", sessionID, "write a file")
+
+	if len(events) != 4 {
+		t.Fatalf("expected 2 partial calls, the complete call, and finish, got %d: %+v", len(events), events)
+	}
+	call := func(evt map[string]any) map[string]any {
+		return evt["content"].(map[string]any)["parts"].([]any)[0].(map[string]any)["functionCall"].(map[string]any)
+	}
+	for i, want := range []map[string]any{
+		{"path": "/tmp/a"},
+		{"path": "/tmp/a.txt", "command": "wri"},
+	} {
+		fc := call(events[i])
+		if events[i]["partial"] != true || fc["willContinue"] != true || !reflect.DeepEqual(fc["args"], want) {
+			t.Errorf("event %d: expected a partial call with args %v, got %+v", i, want, events[i])
+		}
+	}
+	if fc := call(events[2]); events[2]["partial"] == true || fc["willContinue"] != nil || fc["args"].(map[string]any)["command"] != "write" {
+		t.Errorf("expected the complete call, got %+v", events[2])
+	}
+
+	// Pieces of a call to a denied tool are not streamed.
+	cfg := &config.Config{Apps: map[string]config.AppConfig{
+		"myapp": {ToolPolicy: policy.ToolPolicy{Deny: []string{"developer__text_editor"}}},
+	}}
+	_, proxySrv = setupProxyWith(t, cfg, pieces)
+	sessionID = createSession(t, proxySrv.URL, "myapp", "user1")
+	events = runSSE(t, proxySrv.URL, "myapp", "user1", sessionID, "write a file")
+	if len(events) != 2 || events[0]["errorCode"] != "TOOL_DENIED" {
+		t.Errorf("expected only the denial and finish, got %+v", events)
+	}
+}
+
+func TestRunSSE_IDSource(t *testing.T) {
+	gooseSrv := newMockGooseServer(t, defaultReplyEvents)
+	client := gooseclient.New(gooseSrv.URL, "")
+	handler := NewHandler(NewSessionManager(client, t.TempDir()), client, &config.Config{})
+	n := 0
+	handler.SetIDSource(func() string { n++; return fmt.Sprint(n) })
+	proxySrv := httptest.NewServer(handler)
+	t.Cleanup(proxySrv.Close)
+
+	sessionID := createSession(t, proxySrv.URL, "myapp", "user1")
+	for _, want := range []string{"inv_1", "inv_2"} {
+		events := runSSE(t, proxySrv.URL, "myapp", "user1", sessionID, "hello")
+		if got := events[len(events)-1]["invocationId"]; got != want {
+			t.Errorf("expected invocation ID %q, got %v", want, got)
+		}
+	}
+}
+
+func TestRunSSE_GooseMessageIDs(t *testing.T) {
+	_, proxySrv := setupProxyWith(t, &config.Config{}, []string{
+		`{"type":"Message","message":{"id":"msg-1","role":"assistant","created":1,"content":[{"type":"text","text":"Let me "}]}}`,
+		`{"type":"Message","message":{"id":"msg-1","role":"assistant","created":1,"content":[{"type":"text","text":"check."},{"type":"toolRequest","id":"call-1","toolCall":{"name":"developer__shell","arguments":{"command":"ls"}}}]}}`,
+		`{"type":"Message","message":{"id":"msg-2","role":"user","created":2,"content":[{"type":"toolResponse","id":"call-1","toolResult":{"content":[{"type":"text","text":"a.txt"}]}}]}}`,
+		// Re-delivered tool request and response.
+		`{"type":"Message","message":{"id":"msg-1","role":"assistant","created":1,"content":[{"type":"toolRequest","id":"call-1","toolCall":{"name":"developer__shell","arguments":{"command":"ls"}}}]}}`,
+		`{"type":"Message","message":{"id":"msg-2","role":"user","created":2,"content":[{"type":"toolResponse","id":"call-1","toolResult":{"content":[{"type":"text","text":"a.txt"}]}}]}}`,
+		`{"type":"Finish","reason":"stop"}`,
+	})
+	sessionID := createSession(t, proxySrv.URL, "myapp", "user1")
+	events := runSSE(t, proxySrv.URL, "myapp", "user1", sessionID, "list files")
+
+	var ids []string
+	for _, evt := range events[:len(events)-1] {
+		ids = append(ids, evt["id"].(string))
+	}
+	if !slices.Equal(ids, []string{"msg-1", "msg-1_1", "msg-2"}) {
+		t.Fatalf("expected events named after their Goose messages without re-deliveries, got %v", ids)
+	}
+	if meta := events[1]["customMetadata"].(map[string]any); meta["goose:messageId"] != "msg-1" {
+		t.Errorf("expected the Goose message ID in metadata, got %+v", meta)
+	}
+}
+
+func TestRunSSE_AutoApproval(t *testing.T) {
+	approval := policy.ApprovalPolicy{Rules: []policy.ApprovalRule{
+		{Tool: "developer__shell", Arguments: map[string]string{"command": `^ls\b`}, Action: policy.ApprovalApprove},
+	}}
+	if err := approval.Compile(); err != nil {
+		t.Fatalf("compile approval policy: %v", err)
+	}
+	cfg := &config.Config{
+		Apps: map[string]config.AppConfig{"myapp": {Approval: approval}},
+	}
+	gooseSrv, proxySrv := setupProxyWith(t, cfg, []string{
+		`{"type":"Message","message":{"role":"assistant","created":1,"content":[{"type":"toolConfirmationRequest","id":"req-1","toolName":"developer__shell","arguments":{"command":"ls"}}]}}`,
+		`{"type":"Message","message":{"role":"assistant","created":2,"content":[{"type":"toolConfirmationRequest","id":"req-2","toolName":"developer__shell","arguments":{"command":"make"}}]}}`,
+		`{"type":"Finish","reason":"stop"}`,
+	})
+
+	gooseSrv.delay = 100 * time.Millisecond
+	sessionID := createSession(t, proxySrv.URL, "myapp", "user1")
+	running := postRunSSE(t, proxySrv.URL, "myapp", "user1", sessionID, map[string]any{
+		"new_message": genai.NewContentFromText("build it", genai.RoleUser),
+	})
+	defer running.Body.Close()
+	reader := bufio.NewReader(running.Body)
+
+	// The auto-approved request is consumed; the ambiguous one escalates.
+	var escalated []string
+	for len(escalated) == 0 {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("expected a confirmation prompt, stream ended: %v", err)
+		}
+		data, ok := strings.CutPrefix(strings.TrimSpace(line), "data: ")
+		if !ok {
+			continue
+		}
+		var evt map[string]any
+		json.Unmarshal([]byte(data), &evt)
+		content, _ := evt["content"].(map[string]any)
+		parts, _ := content["parts"].([]any)
+		for _, p := range parts {
+			fc, _ := p.(map[string]any)["functionCall"].(map[string]any)
+			if fc != nil {
+				escalated = append(escalated, fc["id"].(string))
+			}
+		}
+	}
+	if len(escalated) != 1 || escalated[0] != "req-2" {
+		t.Fatalf("expected only req-2 to escalate to the client, got %v", escalated)
+	}
+
+	// The client's answer to the escalated request reaches the running turn.
+	resp := postRunSSE(t, proxySrv.URL, "myapp", "user1", sessionID, map[string]any{
+		"new_message": &genai.Content{Role: genai.RoleUser, Parts: []*genai.Part{
+			{FunctionResponse: &genai.FunctionResponse{ID: "req-2", Name: "adk_request_confirmation", Response: map[string]any{"confirmed": false}}},
+		}},
+	})
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected the answer delivered to the running turn, got %d", resp.StatusCode)
+	}
+	readSSEEvents(t, reader)
+
+	confirms := Calls[gooseclient.ToolConfirmationRequest](t, gooseSrv, "/confirm")
+	if len(confirms) != 2 || confirms[0].RequestID != "req-1" || !confirms[0].Approved || confirms[1].RequestID != "req-2" || confirms[1].Approved {
+		t.Fatalf("expected req-1 auto-approved and req-2 denied by the client, got %+v", confirms)
+	}
+}
+
+func TestRunSSE_MaxLLMCalls(t *testing.T) {
+	_, proxySrv := setupProxyWith(t, &config.Config{}, []string{
+		`{"type":"Message","message":{"id":"m1","role":"assistant","created":1,"content":[{"type":"text","text":"first "}]}}`,
+		`{"type":"Message","message":{"id":"m1","role":"assistant","created":1,"content":[{"type":"text","text":"call"}]}}`,
+		`{"type":"Message","message":{"id":"m2","role":"assistant","created":2,"content":[{"type":"text","text":"second call"}]}}`,
+		`{"type":"Finish","reason":"stop"}`,
+	})
+
+	sessionID := createSession(t, proxySrv.URL, "myapp", "user1")
+	resp := postRunSSE(t, proxySrv.URL, "myapp", "user1", sessionID, map[string]any{
+		"new_message": genai.NewContentFromText("go", genai.RoleUser),
+		"run_config":  map[string]any{"max_llm_calls": 1, "streaming_mode": "NONE"},
+	})
+	defer resp.Body.Close()
+	events := readSSEEvents(t, resp.Body)
+
+	if len(events) != 3 {
+		t.Fatalf("expected 2 chunks of the first call plus a limit error, got %d: %+v", len(events), events)
+	}
+	if code, _ := events[2]["errorCode"].(string); code != "MAX_LLM_CALLS_EXCEEDED" {
+		t.Fatalf("expected MAX_LLM_CALLS_EXCEEDED, got %+v", events[2])
+	}
+}
+
+func TestRunSSE_UnsupportedResponseModality(t *testing.T) {
+	_, proxySrv := setupProxy(t)
+
+	sessionID := createSession(t, proxySrv.URL, "myapp", "user1")
+	resp := postRunSSE(t, proxySrv.URL, "myapp", "user1", sessionID, map[string]any{
+		"new_message": genai.NewContentFromText("speak", genai.RoleUser),
+		"run_config":  map[string]any{"response_modalities": []string{"AUDIO"}},
+	})
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected status 400, got %d", resp.StatusCode)
+	}
+}
+
+func TestRunSSE_ValidatesRequest(t *testing.T) {
+	_, proxySrv := setupProxy(t)
+	sessionID := createSession(t, proxySrv.URL, "myapp", "user1")
+	url := fmt.Sprintf("%s/apps/myapp/users/user1/sessions/%s/run_sse", proxySrv.URL, sessionID)
+
+	for body, want := range map[string]string{
+		`{"new_message": {"role": "user", "parts": [{"text": "hi"}]}, "stream": true}`:          "stream: unknown field",
+		`{"new_message": {"role": "assistant", "parts": [{"text": "hi"}]}}`:                     `new_message.role: role "assistant" must be`,
+		`{"new_message": {"role": "model", "parts": [{"text": "hi"}]}}`:                         `new_message.role: must be "user"`,
+		`{"new_message": {"parts": [{"text": "hi"}, {"txt": "typo"}]}}`:                         "new_message.parts[1].txt: unknown field",
+		`{"new_message": {"parts": [{}]}}`:                                                      "new_message.parts[0]: part has no data",
+		`{"new_message": {"parts": [{"text": "hi", "inlineData": {"mimeType": "image/png"}}]}}`: "new_message.parts[0]: part sets both text and inlineData",
+		`{"new_message": {"parts": [{"inlineData": {"data": "AAAA"}}]}}`:                        "new_message.parts[0].inlineData.mimeType: mimeType is required",
+		`{"new_message": {"parts": [{"functionCall": {"args": {}}}]}}`:                          "new_message.parts[0].functionCall.name: name is required",
+		`{"new_message": {"parts": "hi"}}`:                                                      "new_message.parts: must be an array",
+		`{"new_message": {"parts": [{"text": "hi"}]}, "run_config": {"max_llm_calls": "3"}}`:    "run_config.max_llm_calls: must be a number",
+	} {
+		resp, err := http.Post(url, "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("POST run_sse: %v", err)
+		}
+		var got struct {
+			Error string `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&got)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest || !strings.Contains(got.Error, want) {
+			t.Errorf("%s: expected 400 %q, got %d %q", body, want, resp.StatusCode, got.Error)
+		}
+	}
+
+	resp, err := http.Post(proxySrv.URL+"/apps/myapp/users/user1/sessions", "application/json", strings.NewReader(`{"lables": {"a": "b"}}`))
+	if err != nil {
+		t.Fatalf("POST create session: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected an unknown create-session field rejected, got %d", resp.StatusCode)
+	}
+}
+
+func TestRunSSE_GenerationConfig(t *testing.T) {
+	gooseSrv, proxySrv := setupProxyWith(t, &config.Config{GooseProvider: "openai", GooseModel: "gpt-4o"}, defaultReplyEvents)
+
+	sessionID := createSession(t, proxySrv.URL, "myapp", "user1")
+	resp := postRunSSE(t, proxySrv.URL, "myapp", "user1", sessionID, map[string]any{
+		"new_message":       genai.NewContentFromText("hi", genai.RoleUser),
+		"generation_config": map[string]any{"temperature": 0.5, "maxOutputTokens": 256, "candidateCount": 3},
+	})
+	defer resp.Body.Close()
+	events := readSSEEvents(t, resp.Body)
+
+	// The parameters apply to this turn only.
+	updates := Calls[gooseclient.UpdateProviderRequest](t, gooseSrv, "/agent/update_provider")
+	if len(updates) != 2 {
+		t.Fatalf("expected the provider updated and then restored, got %d updates", len(updates))
+	}
+	if updates[0].SessionID != "goose-session-1" || updates[0].Provider != "openai" || updates[0].Model != "gpt-4o" || updates[0].RequestParams["max_tokens"] != float64(256) {
+		t.Fatalf("unexpected provider update: %+v", updates[0])
+	}
+	if updates[1].SessionID != "goose-session-1" || updates[1].Provider != "openai" || updates[1].RequestParams != nil {
+		t.Fatalf("expected the provider's own settings restored, got %+v", updates[1])
+	}
+
+	meta, _ := events[0]["customMetadata"].(map[string]any)
+	applied, _ := meta["goose:generationConfig"].(map[string]any)
+	if applied == nil {
+		t.Fatalf("expected generation config metadata on first event, got %+v", events[0])
+	}
+	if ignored, _ := applied["ignored"].([]any); len(ignored) != 1 || ignored[0] != "candidateCount" {
+		t.Fatalf("expected candidateCount to be reported as ignored, got %+v", applied)
+	}
+	if events[1]["customMetadata"] != nil {
+		t.Fatalf("expected metadata only on the first event, got %+v", events[1])
+	}
+
+	// Without a configured provider and model Goose cannot be updated.
+	gooseSrv, proxySrv = setupProxy(t)
+	sessionID = createSession(t, proxySrv.URL, "myapp", "user1")
+	resp = postRunSSE(t, proxySrv.URL, "myapp", "user1", sessionID, map[string]any{
+		"new_message":       genai.NewContentFromText("hi", genai.RoleUser),
+		"generation_config": map[string]any{"temperature": 0.5},
+	})
+	defer resp.Body.Close()
+	events = readSSEEvents(t, resp.Body)
+	if updates := Calls[gooseclient.UpdateProviderRequest](t, gooseSrv, "/agent/update_provider"); len(updates) != 0 {
+		t.Fatalf("expected no provider update, got %+v", updates)
+	}
+	meta, _ = events[0]["customMetadata"].(map[string]any)
+	if applied, _ := meta["goose:generationConfig"].(map[string]any); applied["skipped"] == nil {
+		t.Fatalf("expected the skipped update reported, got %+v", events[0])
+	}
+}
+
+func TestListSessions_LabelFilter(t *testing.T) {
+	_, proxySrv := setupProxy(t)
+
+	for _, team := range []string{"search", "ads", "search"} {
+		body := fmt.Sprintf(`{"labels":{"team":%q,"env":"prod"}}`, team)
+		resp, err := http.Post(proxySrv.URL+"/apps/myapp/users/user1/sessions", "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("POST create session: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", resp.StatusCode)
+		}
+	}
+
+	resp, err := http.Get(proxySrv.URL + "/apps/myapp/users/user1/sessions?label=team:search&label=env:prod")
+	if err != nil {
+		t.Fatalf("GET list sessions: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var sessions []map[string]any
+	if err := json.NewDecoder(resp.Body).Decode(&sessions); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if len(sessions) != 2 {
+		t.Fatalf("expected 2 sessions labelled team:search, got %d", len(sessions))
+	}
+	labels, _ := sessions[0]["labels"].(map[string]any)
+	if labels["team"] != "search" {
+		t.Fatalf("expected labels in response, got %+v", sessions[0])
+	}
+
+	bad, err := http.Get(proxySrv.URL + "/apps/myapp/users/user1/sessions?label=team")
+	if err != nil {
+		t.Fatalf("GET list sessions: %v", err)
+	}
+	bad.Body.Close()
+	if bad.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected status 400 for malformed filter, got %d", bad.StatusCode)
+	}
+}
+
+func TestMetrics_GooseLatency(t *testing.T) {
+	_, proxySrv := setupProxyWith(t, &config.Config{AdminToken: testAdminToken}, defaultReplyEvents)
+
+	sessionID := createSession(t, proxySrv.URL, "myapp", "user1")
+	runSSE(t, proxySrv.URL, "myapp", "user1", sessionID, "hello")
+
+	resp := adminDo(t, http.MethodGet, proxySrv.URL+"/metrics", nil)
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+
+	for _, want := range []string{
+		`goose_request_duration_seconds_count{method="POST",endpoint="/agent/start"}`,
+		`goose_request_duration_seconds_count{method="POST",endpoint="/reply"}`,
+		`goose_sse_time_to_first_event_seconds_count`,
+		`adk_request_duration_seconds_count{route="POST /apps/{app}/users/{user}/sessions/{session}/run_sse"}`,
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("expected metrics to contain %q", want)
+		}
+	}
+}
+
+func TestRunSSE_SlowTurnLog(t *testing.T) {
+	var logs bytes.Buffer
+	prev := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&logs, nil)))
+	t.Cleanup(func() { slog.SetDefault(prev) })
+
+	_, proxySrv := setupProxyWith(t, &config.Config{SlowTurnTokens: 10}, []string{
+		`{"type":"Message","message":{"role":"assistant","created":1,"content":[{"type":"toolRequest","id":"call-1","toolCall":{"name":"developer__shell","arguments":{"command":"ls"}}}]}}`,
+		`{"type":"Finish","reason":"stop","token_state":{"input_tokens":10,"output_tokens":5,"total_tokens":15}}`,
+	})
+
+	sessionID := createSession(t, proxySrv.URL, "myapp", "user1")
+	runSSE(t, proxySrv.URL, "myapp", "user1", sessionID, "list files")
+
+	var record map[string]any
+	if err := json.Unmarshal(logs.Bytes(), &record); err != nil {
+		t.Fatalf("expected one JSON log record, got %q: %v", logs.String(), err)
+	}
+	if record["msg"] != "slow turn" || record["session"] != sessionID {
+		t.Fatalf("unexpected log record: %+v", record)
+	}
+	if tools, _ := record["toolCalls"].([]any); len(tools) != 1 || tools[0] != "developer__shell" {
+		t.Fatalf("expected tool calls in log record, got %+v", record["toolCalls"])
+	}
+}
+
+func TestRunSSE_Gzip(t *testing.T) {
+	_, proxySrv := setupProxyWith(t, &config.Config{SSEGzip: true}, defaultReplyEvents)
+	sessionID := createSession(t, proxySrv.URL, "myapp", "user1")
+
+	reqBytes, _ := json.Marshal(map[string]any{
+		"new_message": genai.NewContentFromText("hello", genai.RoleUser),
+	})
+	req, _ := http.NewRequest(http.MethodPost,
+		fmt.Sprintf("%s/apps/myapp/users/user1/sessions/%s/run_sse", proxySrv.URL, sessionID),
+		bytes.NewReader(reqBytes))
+	req.Header.Set("Content-Type", "application/json")
+	// Setting Accept-Encoding explicitly disables the transport's transparent
+	// decompression, so the test sees the raw compressed stream.
+	req.Header.Set("Accept-Encoding", "gzip")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("POST run_sse: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if ce := resp.Header.Get("Content-Encoding"); ce != "gzip" {
+		t.Fatalf("expected Content-Encoding gzip, got %q", ce)
+	}
+	gz, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		t.Fatalf("gzip reader: %v", err)
+	}
+	events := readSSEEvents(t, gz)
+	if len(events) < 2 {
+		t.Fatalf("expected at least 2 SSE events, got %d", len(events))
+	}
+	if tc, _ := events[len(events)-1]["turnComplete"].(bool); !tc {
+		t.Fatalf("expected final event to complete the turn, got %+v", events[len(events)-1])
+	}
+}
+
+func TestRunSSE_StripThoughts(t *testing.T) {
+	cfg := &config.Config{
+		Apps: map[string]config.AppConfig{"myapp": {StripThoughts: true}},
+	}
+	_, proxySrv := setupProxyWith(t, cfg, []string{
+		`{"type":"Message","message":{"id":"m1","role":"assistant","created":1,"content":[{"type":"thinking","thinking":"pondering"}]}}`,
+		`{"type":"Message","message":{"id":"m1","role":"assistant","created":1,"content":[{"type":"thinking","thinking":"more"},{"type":"text","text":"answer"}]}}`,
+		`{"type":"Finish","reason":"stop"}`,
+	})
+	sessionID := createSession(t, proxySrv.URL, "myapp", "user1")
+
+	events := runSSE(t, proxySrv.URL, "myapp", "user1", sessionID, "hi")
+	if len(events) != 2 {
+		t.Fatalf("expected thought-only event to be dropped, got %d events: %+v", len(events), events)
+	}
+	parts := events[0]["content"].(map[string]any)["parts"].([]any)
+	if len(parts) != 1 || parts[0].(map[string]any)["text"] != "answer" {
+		t.Fatalf("expected only the answer text, got %+v", parts)
+	}
+
+	// A request asking for thoughts overrides the app setting.
+	resp := postRunSSE(t, proxySrv.URL, "myapp", "user1", sessionID, map[string]any{
+		"new_message":       genai.NewContentFromText("hi", genai.RoleUser),
+		"generation_config": map[string]any{"thinkingConfig": map[string]any{"includeThoughts": true}},
+	})
+	defer resp.Body.Close()
+	if events := readSSEEvents(t, resp.Body); len(events) != 3 {
+		t.Fatalf("expected thoughts to be kept on request, got %d events", len(events))
+	}
+}
+
+func TestRunSSE_SubAgentRouting(t *testing.T) {
+	cfg := &config.Config{
+		Apps: map[string]config.AppConfig{
+			"myapp": {Agents: map[string]config.AgentConfig{
+				"researcher": {RecipeID: "recipe-research"},
+			}},
+		},
+	}
+	gooseSrv, proxySrv := setupProxyWith(t, cfg, defaultReplyEvents)
+	sessionID := createSession(t, proxySrv.URL, "myapp", "user1")
+
+	resp := postRunSSE(t, proxySrv.URL, "myapp", "user1", sessionID, map[string]any{
+		"new_message": genai.NewContentFromText("find sources", genai.RoleUser),
+		"branch":      "root.researcher",
+	})
+	defer resp.Body.Close()
+	events := readSSEEvents(t, resp.Body)
+
+	starts := Calls[gooseclient.StartAgentRequest](t, gooseSrv, "/agent/start")
+	if len(starts) != 2 || starts[1].RecipeID != "recipe-research" {
+		t.Fatalf("expected a second agent started from the researcher recipe, got %+v", starts)
+	}
+	if events[0]["author"] != "researcher" || events[0]["branch"] != "root.researcher" {
+		t.Fatalf("expected event attributed to the sub-agent, got %+v", events[0])
+	}
+
+	// The sub-agent session is reused on later turns.
+	runAgain := postRunSSE(t, proxySrv.URL, "myapp", "user1", sessionID, map[string]any{
+		"new_message": genai.NewContentFromText("more", genai.RoleUser),
+		"agent":       "researcher",
+	})
+	runAgain.Body.Close()
+	if n := len(Calls[gooseclient.StartAgentRequest](t, gooseSrv, "/agent/start")); n != 2 {
+		t.Fatalf("expected sub-agent session to be reused, got %d starts", n)
+	}
+
+	unknown := postRunSSE(t, proxySrv.URL, "myapp", "user1", sessionID, map[string]any{
+		"new_message": genai.NewContentFromText("hi", genai.RoleUser),
+		"agent":       "writer",
+	})
+	unknown.Body.Close()
+	if unknown.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400 for unknown agent, got %d", unknown.StatusCode)
+	}
+}
+
+func TestForkSession(t *testing.T) {
+	gooseSrv, proxySrv := setupProxy(t)
+	sessionID := createSession(t, proxySrv.URL, "myapp", "user1")
+
+	resp, err := http.Post(fmt.Sprintf("%s/apps/myapp/users/user1/sessions/%s/fork", proxySrv.URL, sessionID), "application/json", nil)
+	if err != nil {
+		t.Fatalf("POST fork: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", resp.StatusCode)
+	}
+	var fork map[string]any
+	if err := json.NewDecoder(resp.Body).Decode(&fork); err != nil {
+		t.Fatalf("decode fork response: %v", err)
+	}
+	forkID, _ := fork["id"].(string)
+	if forkID == "" || forkID == sessionID || fork["forkedFrom"] != sessionID {
+		t.Fatalf("expected a new session forked from %s, got %+v", sessionID, fork)
+	}
+
+	// The fork's first turn replays the copied history; later turns don't. A
+	// first turn Goose fails leaves the history for the next.
+	gooseSrv.mu.Lock()
+	gooseSrv.replyFails = 1
+	gooseSrv.mu.Unlock()
+	failed := postRunSSE(t, proxySrv.URL, "myapp", "user1", forkID, map[string]any{
+		"new_message": genai.NewContentFromText("try another way", genai.RoleUser),
+	})
+	failed.Body.Close()
+	if failed.StatusCode != http.StatusBadGateway {
+		t.Fatalf("expected the failed turn to answer 502, got %d", failed.StatusCode)
+	}
+	runSSE(t, proxySrv.URL, "myapp", "user1", forkID, "try another way")
+	runSSE(t, proxySrv.URL, "myapp", "user1", forkID, "and again")
+	replies := Calls[gooseclient.ReplyRequest](t, gooseSrv, "/reply")
+	if len(replies) != 3 {
+		t.Fatalf("expected 3 replies, got %d", len(replies))
+	}
+	for _, reply := range replies[:2] {
+		if reply.SessionID != "goose-session-2" || len(reply.ConversationSoFar) != 2 {
+			t.Fatalf("expected history replayed into the forked Goose session, got %+v", reply)
+		}
+	}
+	if len(replies[2].ConversationSoFar) != 0 {
+		t.Fatalf("expected history only until a turn is accepted, got %+v", replies[2].ConversationSoFar)
+	}
+
+	missing, err := http.Post(proxySrv.URL+"/apps/myapp/users/user1/sessions/nope/fork", "application/json", nil)
+	if err != nil {
+		t.Fatalf("POST fork: %v", err)
+	}
+	missing.Body.Close()
+	if missing.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected 404 for unknown session, got %d", missing.StatusCode)
+	}
+}
+
+func TestSnapshotRestore(t *testing.T) {
+	gooseSrv, proxySrv := setupProxy(t)
+	sessionID := createSession(t, proxySrv.URL, "myapp", "user1")
+
+	resp, err := http.Get(fmt.Sprintf("%s/apps/myapp/users/user1/sessions/%s/snapshot", proxySrv.URL, sessionID))
+	if err != nil {
+		t.Fatalf("GET snapshot: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", resp.StatusCode)
+	}
+	raw, _ := io.ReadAll(resp.Body)
+	var snap SessionSnapshot
+	if err := json.Unmarshal(raw, &snap); err != nil {
+		t.Fatalf("decode snapshot: %v", err)
+	}
+	if snap.Session == nil || snap.Session.ID != sessionID || len(snap.Transcript) != 2 {
+		t.Fatalf("expected snapshot of %s with its transcript, got %+v", sessionID, snap)
+	}
+	// The bundle names no Goose session, and the shared working directory
+	// is not the session's to list.
+	if bytes.Contains(raw, []byte("gooseSessionId")) || bytes.Contains(raw, []byte("goose-session-")) {
+		t.Errorf("expected the bundle to leave out Goose session IDs, got %s", raw)
+	}
+	if snap.WorkingDir != "" || len(snap.Files) != 0 {
+		t.Errorf("expected no manifest of the shared working directory, got %q with %d files", snap.WorkingDir, len(snap.Files))
+	}
+
+	bundle, _ := json.Marshal(snap)
+	restoreResp, err := http.Post(proxySrv.URL+"/apps/otherapp/users/user2/sessions/restore", "application/json", bytes.NewReader(bundle))
+	if err != nil {
+		t.Fatalf("POST restore: %v", err)
+	}
+	defer restoreResp.Body.Close()
+	var restored map[string]any
+	if err := json.NewDecoder(restoreResp.Body).Decode(&restored); err != nil {
+		t.Fatalf("decode restore response: %v", err)
+	}
+	restoredID, _ := restored["id"].(string)
+	if restoredID == "" || restoredID == sessionID || restored["appName"] != "otherapp" {
+		t.Fatalf("expected a new session under otherapp, got %+v", restored)
+	}
+
+	runSSE(t, proxySrv.URL, "otherapp", "user2", restoredID, "continue")
+	replies := Calls[gooseclient.ReplyRequest](t, gooseSrv, "/reply")
+	if len(replies) != 1 || len(replies[0].ConversationSoFar) != 2 {
+		t.Fatalf("expected restored transcript replayed on first turn, got %+v", replies)
+	}
+}
+
+func TestReplaySession(t *testing.T) {
+	gooseSrv, proxySrv := setupProxyWith(t, &config.Config{GooseProvider: "openai", GooseModel: "gpt-4o"}, []string{
+		`{"type":"Message","message":{"id":"m1","role":"assistant","created":1,"content":[{"type":"text","text":"Hi from a new model!"}]}}`,
+		`{"type":"Finish","reason":"stop"}`,
+	})
+	sessionID := createSession(t, proxySrv.URL, "myapp", "user1")
+
+	resp, err := http.Post(fmt.Sprintf("%s/apps/myapp/users/user1/sessions/%s/replay", proxySrv.URL, sessionID), "application/json", nil)
+	if err != nil {
+		t.Fatalf("POST replay: %v", err)
+	}
+	defer resp.Body.Close()
+	events := readSSEEvents(t, resp.Body)
+
+	if len(events) != 2 {
+		t.Fatalf("expected one turn event and a summary, got %d: %+v", len(events), events)
+	}
+	turn := events[0]["customMetadata"].(map[string]any)["goose:replay"].(map[string]any)
+	if turn["user"] != "hello" || turn["changed"] != true {
+		t.Fatalf("expected changed first turn, got %+v", turn)
+	}
+	diff, _ := turn["diff"].([]any)
+	if len(diff) != 2 || diff[0] != "- Hello from Goose!" || diff[1] != "+ Hi from a new model!" {
+		t.Fatalf("unexpected diff: %+v", diff)
+	}
+	if events[1]["turnComplete"] != true {
+		t.Fatalf("expected final summary event, got %+v", events[1])
+	}
+
+	replies := Calls[gooseclient.ReplyRequest](t, gooseSrv, "/reply")
+	if len(replies) != 1 || replies[0].SessionID == "goose-session-1" {
+		t.Fatalf("expected the turn replayed into a fresh Goose session, got %+v", replies)
+	}
+	if stops := Calls[gooseclient.StopAgentRequest](t, gooseSrv, "/agent/stop"); len(stops) != 1 {
+		t.Fatalf("expected replay agent to be stopped, got %d stops", len(stops))
+	}
+
+	// The replay agent works on a scratch copy, removed afterwards.
+	starts := Calls[gooseclient.StartAgentRequest](t, gooseSrv, "/agent/start")
+	if len(starts) != 2 || starts[1].WorkingDir == starts[0].WorkingDir {
+		t.Fatalf("expected the replay agent started outside the session's working dir, got %+v", starts)
+	}
+	if _, err := os.Stat(starts[1].WorkingDir); !os.IsNotExist(err) {
+		t.Errorf("expected the scratch dir removed, got %v", err)
+	}
+	updates := Calls[gooseclient.UpdateProviderRequest](t, gooseSrv, "/agent/update_provider")
+	if len(updates) != 1 || updates[0].SessionID != replies[0].SessionID || updates[0].RequestParams["temperature"] != float64(0) || updates[0].RequestParams["seed"] != float64(replaySeed) {
+		t.Errorf("expected temperature and seed pinned on the replay agent, got %+v", updates)
+	}
+
+	// A replay agent whose ID already has a turn running is not used.
+	handler := proxySrv.Config.Handler.(*Handler)
+	if !handler.turns.tryAcquire("goose-session-3") {
+		t.Fatal("expected the lock free")
+	}
+	defer handler.turns.release("goose-session-3")
+	resp, err = http.Post(fmt.Sprintf("%s/apps/myapp/users/user1/sessions/%s/replay", proxySrv.URL, sessionID), "application/json", nil)
+	if err != nil {
+		t.Fatalf("POST replay: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusConflict {
+		t.Fatalf("expected 409, got %d", resp.StatusCode)
+	}
+	if replies := Calls[gooseclient.ReplyRequest](t, gooseSrv, "/reply"); len(replies) != 1 {
+		t.Errorf("expected nothing replayed, got %+v", replies)
+	}
+	if stops := Calls[gooseclient.StopAgentRequest](t, gooseSrv, "/agent/stop"); len(stops) != 2 {
+		t.Errorf("expected the unused replay agent stopped, got %d stops", len(stops))
+	}
+}
+
+func TestRunSSE_Deadline(t *testing.T) {
+	gooseSrv, proxySrv := setupProxyWith(t, &config.Config{RequestTimeout: time.Minute}, defaultReplyEvents)
+	gooseSrv.mu.Lock()
+	gooseSrv.delay = 200 * time.Millisecond
+	gooseSrv.mu.Unlock()
+	sessionID := createSession(t, proxySrv.URL, "myapp", "user1")
+
+	reqBytes, _ := json.Marshal(map[string]any{"new_message": genai.NewContentFromText("hi", genai.RoleUser)})
+	req, _ := http.NewRequest(http.MethodPost,
+		fmt.Sprintf("%s/apps/myapp/users/user1/sessions/%s/run_sse", proxySrv.URL, sessionID),
+		bytes.NewReader(reqBytes))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Request-Timeout", "50ms")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("POST run_sse: %v", err)
+	}
+	defer resp.Body.Close()
+	events := readSSEEvents(t, resp.Body)
+
+	if len(events) != 1 || events[0]["errorCode"] != "DEADLINE_EXCEEDED" {
+		t.Fatalf("expected a single DEADLINE_EXCEEDED event, got %+v", events)
+	}
+}
+
+func TestRunSSE_StallReleasesSession(t *testing.T) {
+	gooseSrv, proxySrv := setupProxyWith(t, &config.Config{StreamStallTimeout: 50 * time.Millisecond}, defaultReplyEvents)
+	gooseSrv.mu.Lock()
+	gooseSrv.delay = time.Second
+	gooseSrv.mu.Unlock()
+	sessionID := createSession(t, proxySrv.URL, "myapp", "user1")
+
+	done := make(chan []map[string]any)
+	go func() {
+		resp := postRunSSE(t, proxySrv.URL, "myapp", "user1", sessionID, map[string]any{
+			"new_message": genai.NewContentFromText("hi", genai.RoleUser),
+		})
+		defer resp.Body.Close()
+		done <- readSSEEvents(t, resp.Body)
+	}()
+
+	// While the first turn is running, a second one on the same session is
+	// refused.
+	time.Sleep(20 * time.Millisecond)
+	busy := postRunSSE(t, proxySrv.URL, "myapp", "user1", sessionID, map[string]any{
+		"new_message": genai.NewContentFromText("hi again", genai.RoleUser),
+	})
+	busy.Body.Close()
+	if busy.StatusCode != http.StatusConflict {
+		t.Fatalf("expected 409 for a concurrent turn, got %d", busy.StatusCode)
+	}
+
+	if events := <-done; len(events) != 1 || events[0]["errorCode"] != "STREAM_STALLED" {
+		t.Fatalf("expected a single STREAM_STALLED event, got %+v", events)
+	}
+
+	// The stalled turn released the session.
+	gooseSrv.mu.Lock()
+	gooseSrv.delay = 0
+	gooseSrv.mu.Unlock()
+	if events := runSSE(t, proxySrv.URL, "myapp", "user1", sessionID, "retry"); len(events) != 2 {
+		t.Fatalf("expected the session to accept a new turn, got %+v", events)
+	}
+}
+
+func TestRunSSE_DebugCapture(t *testing.T) {
+	dir := t.TempDir()
+	_, proxySrv := setupProxyWith(t, &config.Config{DebugCaptureDir: dir, GooseSecret: "goose-s3cret"}, defaultReplyEvents)
+	sessionID := createSession(t, proxySrv.URL, "myapp", "user1")
+
+	resp := postRunSSE(t, proxySrv.URL, "myapp", "user1", sessionID, map[string]any{
+		"new_message": genai.NewContentFromParts([]*genai.Part{
+			genai.NewPartFromText("my key is goose-s3cret"),
+			genai.NewPartFromFunctionResponse("login", map[string]any{"api_key": "sk-live-123"}),
+		}, genai.RoleUser),
+	})
+	readSSEEvents(t, resp.Body)
+	resp.Body.Close()
+
+	invocations, _ := os.ReadDir(dir)
+	if len(invocations) != 1 {
+		t.Fatalf("expected one capture directory, got %d", len(invocations))
+	}
+	read := func(name string) string {
+		data, err := os.ReadFile(filepath.Join(dir, invocations[0].Name(), name))
+		if err != nil {
+			t.Fatalf("read capture: %v", err)
+		}
+		return string(data)
+	}
+
+	request := read("adk_request.json")
+	if strings.Contains(request, "sk-live-123") || strings.Contains(request, "goose-s3cret") {
+		t.Errorf("expected secrets to be redacted, got %s", request)
+	}
+	if !strings.Contains(request, `"api_key":"[REDACTED]"`) {
+		t.Errorf("expected redaction marker in request capture, got %s", request)
+	}
+	if goose := read("goose_stream.sse"); !strings.Contains(goose, `"type":"Finish"`) {
+		t.Errorf("expected raw Goose stream in capture, got %s", goose)
+	}
+	if adk := read("adk_events.sse"); !strings.Contains(adk, `"turnComplete":true`) {
+		t.Errorf("expected emitted ADK events in capture, got %s", adk)
+	}
+}
+
+func TestRunSSE_EventAuthor(t *testing.T) {
+	cfg := &config.Config{
+		Apps: map[string]config.AppConfig{"custom": {Author: "helper_agent"}},
+	}
+	_, proxySrv := setupProxyWith(t, cfg, defaultReplyEvents)
+
+	for app, want := range map[string]string{"myapp": "myapp", "custom": "helper_agent"} {
+		sessionID := createSession(t, proxySrv.URL, app, "user1")
+		for _, evt := range runSSE(t, proxySrv.URL, app, "user1", sessionID, "hi") {
+			if evt["author"] != want {
+				t.Errorf("app %s: expected author %q, got %v", app, want, evt["author"])
+			}
+		}
+	}
+}
+
+func TestGetSession_RecordsInterruptedTurn(t *testing.T) {
+	gooseSrv, proxySrv := setupProxyWith(t, &config.Config{RequestTimeout: time.Minute}, defaultReplyEvents)
+	gooseSrv.mu.Lock()
+	gooseSrv.delay = 200 * time.Millisecond
+	gooseSrv.mu.Unlock()
+	sessionID := createSession(t, proxySrv.URL, "myapp", "user1")
+
+	reqBytes, _ := json.Marshal(map[string]any{"new_message": genai.NewContentFromText("hi", genai.RoleUser)})
+	req, _ := http.NewRequest(http.MethodPost,
+		fmt.Sprintf("%s/apps/myapp/users/user1/sessions/%s/run_sse", proxySrv.URL, sessionID),
+		bytes.NewReader(reqBytes))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Request-Timeout", "50ms")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("POST run_sse: %v", err)
+	}
+	readSSEEvents(t, resp.Body)
+	resp.Body.Close()
+
+	getResp, err := http.Get(fmt.Sprintf("%s/apps/myapp/users/user1/sessions/%s", proxySrv.URL, sessionID))
+	if err != nil {
+		t.Fatalf("GET session: %v", err)
+	}
+	defer getResp.Body.Close()
+	if getResp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", getResp.StatusCode)
+	}
+	var body struct {
+		Events []map[string]any `json:"events"`
+	}
+	if err := json.NewDecoder(getResp.Body).Decode(&body); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+
+	var interrupted map[string]any
+	for _, evt := range body.Events {
+		if evt["interrupted"] == true {
+			interrupted = evt
+		}
+	}
+	if interrupted == nil {
+		t.Fatalf("expected an interrupted event, got %+v", body.Events)
+	}
+	meta, _ := interrupted["customMetadata"].(map[string]any)
+	if meta[interruptionReasonMetadataKey] != "deadline_exceeded" {
+		t.Errorf("expected reason deadline_exceeded, got %+v", meta)
+	}
+	if len(body.Events) != 3 {
+		t.Errorf("expected 2 history events plus the interruption, got %d", len(body.Events))
+	}
+}
+
+func TestRunSSE_OnDisconnect(t *testing.T) {
+	for _, tc := range []struct {
+		onDisconnect string
+		want         func(evt map[string]any) bool
+	}{
+		{config.DisconnectCancel, func(evt map[string]any) bool {
+			meta, _ := evt["customMetadata"].(map[string]any)
+			return evt["interrupted"] == true && meta[interruptionReasonMetadataKey] == "client_disconnected"
+		}},
+		{config.DisconnectContinue, func(evt map[string]any) bool {
+			return evt["turnComplete"] == true && evt["interrupted"] != true
+		}},
+	} {
+		t.Run(tc.onDisconnect, func(t *testing.T) {
+			cfg := &config.Config{Apps: map[string]config.AppConfig{"myapp": {OnDisconnect: tc.onDisconnect}}}
+			gooseSrv, proxySrv := setupProxyWith(t, cfg, defaultReplyEvents)
+			gooseSrv.mu.Lock()
+			gooseSrv.delay = 200 * time.Millisecond
+			gooseSrv.mu.Unlock()
+			sessionID := createSession(t, proxySrv.URL, "myapp", "user1")
+
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+			reqBytes, _ := json.Marshal(map[string]any{"new_message": genai.NewContentFromText("hi", genai.RoleUser)})
+			req, _ := http.NewRequestWithContext(ctx, http.MethodPost,
+				fmt.Sprintf("%s/apps/myapp/users/user1/sessions/%s/run_sse", proxySrv.URL, sessionID),
+				bytes.NewReader(reqBytes))
+			req.Header.Set("Content-Type", "application/json")
+			if resp, err := http.DefaultClient.Do(req); err == nil {
+				resp.Body.Close()
+				t.Fatal("expected the request to be cut off")
+			}
+
+			deadline := time.Now().Add(5 * time.Second)
+			for {
+				resp, err := http.Get(fmt.Sprintf("%s/apps/myapp/users/user1/sessions/%s", proxySrv.URL, sessionID))
+				if err != nil {
+					t.Fatalf("GET session: %v", err)
+				}
+				var body struct {
+					Events []map[string]any `json:"events"`
+				}
+				err = json.NewDecoder(resp.Body).Decode(&body)
+				resp.Body.Close()
+				if err != nil {
+					t.Fatalf("decode: %v", err)
+				}
+				if slices.ContainsFunc(body.Events, tc.want) {
+					return
+				}
+				if time.Now().After(deadline) {
+					t.Fatalf("expected the turn to end with onDisconnect %q, got %+v", tc.onDisconnect, body.Events)
+				}
+				time.Sleep(50 * time.Millisecond)
+			}
+		})
+	}
+}
+
+func TestGetSession_NotFound(t *testing.T) {
+	_, proxySrv := setupProxy(t)
+	resp, err := http.Get(proxySrv.URL + "/apps/myapp/users/user1/sessions/missing")
+	if err != nil {
+		t.Fatalf("GET session: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", resp.StatusCode)
+	}
+}
+
+func TestRunSSE_OffloadsLargeInlineData(t *testing.T) {
+	gooseSrv, proxySrv := setupProxyWith(t, &config.Config{InlineDataOffloadBytes: 8}, defaultReplyEvents)
+	sessionID := createSession(t, proxySrv.URL, "myapp", "user1")
+
+	data := []byte("a screenshot that is too big to inline")
+	resp := postRunSSE(t, proxySrv.URL, "myapp", "user1", sessionID, map[string]any{
+		"new_message": &genai.Content{Role: genai.RoleUser, Parts: []*genai.Part{
+			genai.NewPartFromText("what is this?"),
+			genai.NewPartFromBytes(data, "image/png"),
+			genai.NewPartFromBytes([]byte("tiny"), "image/png"),
+		}},
+	})
+	readSSEEvents(t, resp.Body)
+	resp.Body.Close()
+
+	replies := Calls[gooseclient.ReplyRequest](t, gooseSrv, "/reply")
+	if len(replies) != 1 {
+		t.Fatalf("expected 1 reply, got %d", len(replies))
+	}
+	content := replies[0].UserMessage.Content
+	if len(content) != 3 || content[1].Type != "text" || content[2].Type != "image" {
+		t.Fatalf("expected only the large part offloaded, got %+v", content)
+	}
+
+	ref := content[1].Text
+	start := strings.Index(ref, " is saved at ")
+	if start < 0 || !strings.HasSuffix(ref, "]") {
+		t.Fatalf("unexpected reference text %q", ref)
+	}
+	path := ref[start+len(" is saved at ") : len(ref)-1]
+	if !strings.Contains(path, filepath.FromSlash(inlineDataDir)) {
+		t.Errorf("expected the file under %s, got %s", inlineDataDir, path)
+	}
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read offloaded file: %v", err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("offloaded file content = %q, want %q", got, data)
+	}
+}
+
+// allowLocalEgress lets egress policies reach the tests' local servers.
+func allowLocalEgress(t *testing.T) {
+	blocked := egressBlocked
+	egressBlocked = func(net.IP) bool { return false }
+	t.Cleanup(func() { egressBlocked = blocked })
+}
+
+func TestRunSSE_MaterializesFiles(t *testing.T) {
+	allowLocalEgress(t)
+	gooseSrv, proxySrv := setupProxyWith(t, &config.Config{UploadFetchHosts: []string{"127.0.0.1"}}, defaultReplyEvents)
+	sessionID := createSession(t, proxySrv.URL, "myapp", "user1")
+
+	files := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "ERROR disk full\n")
+	}))
+	defer files.Close()
+
+	resp := postRunSSE(t, proxySrv.URL, "myapp", "user1", sessionID, map[string]any{
+		"new_message": &genai.Content{Role: genai.RoleUser, Parts: []*genai.Part{
+			genai.NewPartFromText("summarize these"),
+			{InlineData: &genai.Blob{Data: []byte("a,b\n1,2\n"), MIMEType: "text/csv", DisplayName: "../data.csv"}},
+			genai.NewPartFromURI(files.URL+"/logs/app.log", "text/plain"),
+			genai.NewPartFromURI("gs://bucket/report.pdf", "application/pdf"),
+		}},
+	})
+	readSSEEvents(t, resp.Body)
+	resp.Body.Close()
+
+	replies := Calls[gooseclient.ReplyRequest](t, gooseSrv, "/reply")
+	if len(replies) != 1 {
+		t.Fatalf("expected 1 reply, got %d", len(replies))
+	}
+	content := replies[0].UserMessage.Content
+	if len(content) != 2 || content[1].Text != "summarize these" {
+		t.Fatalf("expected a note followed by the text, got %+v", content)
+	}
+
+	note := content[0].Text
+	lines := strings.Split(note, "\n")
+	if len(lines) != 4 {
+		t.Fatalf("expected three attachments in the note, got %q", note)
+	}
+	want := map[string]string{"data.csv": "a,b\n1,2\n", "app.log": "ERROR disk full\n"}
+	for _, line := range lines[1:3] {
+		p, _, _ := strings.Cut(strings.TrimPrefix(line, "- "), " (")
+		// The working dir is shared, so each user's files have their own folder.
+		if dir := filepath.Join(uploadsDir, "myapp", "user1"); !strings.HasSuffix(filepath.Dir(p), string(filepath.Separator)+dir) {
+			t.Errorf("expected %s under %s", p, dir)
+		}
+		got, err := os.ReadFile(p)
+		if err != nil {
+			t.Fatalf("read upload: %v", err)
+		}
+		if string(got) != want[filepath.Base(p)] {
+			t.Errorf("%s = %q, want %q", p, got, want[filepath.Base(p)])
+		}
+	}
+	if !strings.Contains(lines[3], "gs://bucket/report.pdf") {
+		t.Errorf("expected the unfetchable URI in the note, got %q", lines[3])
+	}
+}
+
+func TestFetchFileData_EgressPolicy(t *testing.T) {
+	files := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/moved" {
+			http.Redirect(w, r, "http://localhost:1/secret", http.StatusFound)
+			return
+		}
+		fmt.Fprint(w, "data")
+	}))
+	defer files.Close()
+	root := t.TempDir()
+	fetch := newEgressPolicy([]string{"127.0.0.1"}, 5*time.Second)
+	get := func(fetch *egressPolicy, uri string) (attachment, error) {
+		return fetchFileData(t.Context(), root, "", fetch, &genai.FileData{FileURI: uri}, 0)
+	}
+
+	// Without allowed hosts nothing is downloaded, only listed.
+	if a, err := get(nil, files.URL+"/a.txt"); err != nil || a.path != "" || a.uri != files.URL+"/a.txt" {
+		t.Errorf("expected the URI listed, got %+v, %v", a, err)
+	}
+	if a, err := get(newEgressPolicy([]string{"*.example.com"}, 0), files.URL+"/a.txt"); err != nil || a.path != "" {
+		t.Errorf("expected a host off the list not downloaded, got %+v, %v", a, err)
+	}
+	// An allowed host is still refused when it is an internal address.
+	if _, err := get(fetch, files.URL+"/a.txt"); !errors.Is(err, errEgressDenied) {
+		t.Errorf("expected a loopback address refused, got %v", err)
+	}
+
+	allowLocalEgress(t)
+	if a, err := get(fetch, files.URL+"/a.txt"); err != nil || a.path == "" {
+		t.Errorf("expected the file downloaded, got %+v, %v", a, err)
+	}
+	if _, err := get(fetch, files.URL+"/moved"); !errors.Is(err, errEgressDenied) {
+		t.Errorf("expected a redirect off the allowed hosts refused, got %v", err)
+	}
+}
+
+func TestEgressBlocked(t *testing.T) {
+	for ip, want := range map[string]bool{
+		"93.184.216.34":        false,
+		"2606:2800:220:1::":    false,
+		"127.0.0.1":            true,
+		"10.1.2.3":             true,
+		"100.64.0.1":           true,
+		"100.127.255.254":      true,
+		"100.128.0.1":          false,
+		"169.254.169.254":      true,
+		"::1":                  true,
+		"fd00::1":              true,
+		"::ffff:127.0.0.1":     true,
+		"64:ff9b::7f00:1":      true,
+		"64:ff9b::a9fe:a9fe":   true,
+		"64:ff9b::5db8:d822":   false,
+		"64:ff9b:1::a9fe:a9fe": false,
+		"0.0.0.0":              true,
+	} {
+		if got := egressBlocked(net.ParseIP(ip)); got != want {
+			t.Errorf("egressBlocked(%s) = %t, want %t", ip, got, want)
+		}
+	}
+}
+
+func TestScanOutputs_SkipsProxyDirs(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{"report.md", "captures/inv_1/adk_request.json", "events/log.jsonl", uploadsDir + "/in.csv"} {
+		os.MkdirAll(filepath.Dir(filepath.Join(root, name)), 0o755)
+		os.WriteFile(filepath.Join(root, name), []byte("x"), 0o644)
+	}
+
+	state := scanOutputs(root, []string{filepath.Join(root, "captures"), filepath.Join(root, "events"), t.TempDir()})
+	if len(state) != 1 {
+		t.Fatalf("expected only report.md scanned, got %v", state)
+	}
+	if _, ok := state["report.md"]; !ok {
+		t.Errorf("expected report.md scanned, got %v", state)
+	}
+}
+
+func TestRunSSE_WorkingDirArtifacts(t *testing.T) {
+	gooseSrv, proxySrv := setupProxyWith(t, &config.Config{WorkingDirArtifacts: true, WorkingDirIsolation: config.WorkingDirIsolationSession}, defaultReplyEvents)
+	sessionID := createSession(t, proxySrv.URL, "myapp", "user1")
+	base := fmt.Sprintf("%s/apps/myapp/users/user1/sessions/%s", proxySrv.URL, sessionID)
+
+	resp, err := http.Get(base + "/snapshot")
+	if err != nil {
+		t.Fatalf("GET snapshot: %v", err)
+	}
+	var snap SessionSnapshot
+	json.NewDecoder(resp.Body).Decode(&snap)
+	resp.Body.Close()
+	dir := snap.WorkingDir
+	os.WriteFile(filepath.Join(dir, "existing.txt"), []byte("untouched"), 0o644)
+
+	// Goose "writes" its outputs while the turn is streaming.
+	gooseSrv.mu.Lock()
+	gooseSrv.delay = 50 * time.Millisecond
+	gooseSrv.mu.Unlock()
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		os.MkdirAll(filepath.Join(dir, "out"), 0o755)
+		os.WriteFile(filepath.Join(dir, "out", "report.md"), []byte("# Report v1"), 0o644)
+		os.MkdirAll(filepath.Join(dir, uploadsDir), 0o755)
+		os.WriteFile(filepath.Join(dir, uploadsDir, "input.csv"), []byte("a,b"), 0o644)
+	}()
+	events := runSSE(t, proxySrv.URL, "myapp", "user1", sessionID, "write a report")
+
+	final := events[len(events)-1]
+	actions, _ := final["actions"].(map[string]any)
+	delta, _ := actions["artifactDelta"].(map[string]any)
+	if len(delta) != 1 || delta["out/report.md"] != float64(0) {
+		t.Fatalf("expected out/report.md version 0 in the final event's artifactDelta, got %+v", final)
+	}
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		os.WriteFile(filepath.Join(dir, "out", "report.md"), []byte("# Report v2, longer"), 0o644)
+	}()
+	runSSE(t, proxySrv.URL, "myapp", "user1", sessionID, "revise it")
+
+	getJSON := func(path string, v any) int {
+		t.Helper()
+		resp, err := http.Get(base + path)
+		if err != nil {
+			t.Fatalf("GET %s: %v", path, err)
+		}
+		defer resp.Body.Close()
+		if v != nil {
+			json.NewDecoder(resp.Body).Decode(v)
+		}
+		return resp.StatusCode
+	}
+
+	var names []string
+	getJSON("/artifacts", &names)
+	if len(names) != 1 || names[0] != "out/report.md" {
+		t.Fatalf("expected [out/report.md], got %v", names)
+	}
+	var versions []int
+	getJSON("/artifacts/out%2Freport.md/versions", &versions)
+	if len(versions) != 2 {
+		t.Fatalf("expected 2 versions, got %v", versions)
+	}
+	var part genai.Part
+	getJSON("/artifacts/out%2Freport.md/versions/0", &part)
+	if part.InlineData == nil || string(part.InlineData.Data) != "# Report v1" {
+		t.Fatalf("expected version 0 content, got %+v", part)
+	}
+	getJSON("/artifacts/out%2Freport.md", &part)
+	if string(part.InlineData.Data) != "# Report v2, longer" {
+		t.Fatalf("expected latest content, got %q", part.InlineData.Data)
+	}
+
+	req, _ := http.NewRequest(http.MethodDelete, base+"/artifacts/out%2Freport.md", nil)
+	del, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("DELETE artifact: %v", err)
+	}
+	del.Body.Close()
+	if del.StatusCode != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d", del.StatusCode)
+	}
+	if code := getJSON("/artifacts/out%2Freport.md", nil); code != http.StatusNotFound {
+		t.Fatalf("expected 404 after delete, got %d", code)
+	}
+}
+
+func TestRunSSE_FinalOnly(t *testing.T) {
+	replyEvents := []string{
+		`{"type":"Message","message":{"role":"assistant","created":1,"content":[{"type":"thinking","thinking":"let me look"}]}}`,
+		`{"type":"Message","message":{"role":"assistant","created":1,"content":[{"type":"text","text":"I'll list the files."},{"type":"toolRequest","id":"call-1","toolCall":{"name":"developer__shell","arguments":{"command":"ls"}}}]}}`,
+		`{"type":"Message","message":{"role":"user","created":2,"content":[{"type":"toolResponse","id":"call-1","toolResult":{"content":[{"type":"text","text":"a.txt"}]}}]}}`,
+		`{"type":"Message","message":{"role":"assistant","created":3,"content":[{"type":"text","text":"There is "}]}}`,
+		`{"type":"Message","message":{"role":"assistant","created":3,"content":[{"type":"text","text":"one file."}]}}`,
+		`{"type":"Finish","reason":"stop"}`,
+	}
+
+	tests := []struct {
+		name  string
+		apps  map[string]config.AppConfig
+		query string
+		want  int
+	}{
+		{name: "query", query: "?final_only=true", want: 2},
+		{name: "app setting", apps: map[string]config.AppConfig{"myapp": {FinalOnly: true}}, want: 2},
+		{name: "query overrides app", apps: map[string]config.AppConfig{"myapp": {FinalOnly: true}}, query: "?final_only=false", want: 6},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, proxySrv := setupProxyWith(t, &config.Config{Apps: tt.apps}, replyEvents)
+			sessionID := createSession(t, proxySrv.URL, "myapp", "user1")
+
+			reqBytes, _ := json.Marshal(map[string]any{"new_message": genai.NewContentFromText("what's here?", genai.RoleUser)})
+			resp, err := http.Post(fmt.Sprintf("%s/apps/myapp/users/user1/sessions/%s/run_sse%s", proxySrv.URL, sessionID, tt.query),
+				"application/json", bytes.NewReader(reqBytes))
+			if err != nil {
+				t.Fatalf("POST run_sse: %v", err)
+			}
+			defer resp.Body.Close()
+			events := readSSEEvents(t, resp.Body)
+
+			if len(events) != tt.want {
+				t.Fatalf("expected %d events, got %d: %+v", tt.want, len(events), events)
+			}
+			if tt.want != 2 {
+				return
+			}
+			content, _ := events[0]["content"].(map[string]any)
+			parts, _ := content["parts"].([]any)
+			if len(parts) != 1 || parts[0].(map[string]any)["text"] != "There is one file." {
+				t.Errorf("expected the consolidated final answer, got %+v", events[0])
+			}
+			if events[1]["turnComplete"] != true {
+				t.Errorf("expected the turn-complete event last, got %+v", events[1])
+			}
+		})
+	}
+}
+
+func TestRunSSE_TruncatesToolResults(t *testing.T) {
+	long := strings.Repeat("é", 20) // 40 bytes
+	_, proxySrv := setupProxyWith(t, &config.Config{ToolResultMaxBytes: 11}, []string{
+		`{"type":"Message","message":{"role":"user","created":1,"content":[{"type":"toolResponse","id":"call-1","toolResult":{"content":[{"type":"text","text":"` + long + `"}]}}]}}`,
+		`{"type":"Message","message":{"role":"user","created":1,"content":[{"type":"toolResponse","id":"call-2","toolResult":{"content":[{"type":"text","text":"short"}]}}]}}`,
+		`{"type":"Finish","reason":"stop"}`,
+	})
+	sessionID := createSession(t, proxySrv.URL, "myapp", "user1")
+	events := runSSE(t, proxySrv.URL, "myapp", "user1", sessionID, "read the log")
+	if len(events) != 3 {
+		t.Fatalf("expected 3 events, got %+v", events)
+	}
+
+	response := func(evt map[string]any) map[string]any {
+		parts := evt["content"].(map[string]any)["parts"].([]any)
+		return parts[0].(map[string]any)["functionResponse"].(map[string]any)["response"].(map[string]any)
+	}
+	truncated := response(events[0])
+	if truncated["result"] != strings.Repeat("é", 5) || truncated["truncated"] != true || truncated["originalBytes"] != float64(40) {
+		t.Fatalf("expected a 10-byte preview of the 40-byte result, got %+v", truncated)
+	}
+	delta := events[0]["actions"].(map[string]any)["artifactDelta"].(map[string]any)
+	if delta["tool-results/call-1.txt"] != float64(0) {
+		t.Errorf("expected the spilled result in artifactDelta, got %+v", delta)
+	}
+	if short := response(events[1]); short["result"] != "short" || short["truncated"] != nil {
+		t.Errorf("expected the short result untouched, got %+v", short)
+	}
+
+	resp, err := http.Get(proxySrv.URL + truncated["artifactUrl"].(string))
+	if err != nil {
+		t.Fatalf("GET artifact: %v", err)
+	}
+	defer resp.Body.Close()
+	var part genai.Part
+	json.NewDecoder(resp.Body).Decode(&part)
+	if part.InlineData == nil || string(part.InlineData.Data) != long {
+		t.Fatalf("expected the full result in the artifact, got %d %+v", resp.StatusCode, part)
+	}
+}
+
+func TestRunSSE_TruncatesStructuredToolResults(t *testing.T) {
+	_, proxySrv := setupProxyWith(t, &config.Config{ToolResultMaxBytes: 20}, []string{
+		`{"type":"Message","message":{"role":"user","created":1,"content":[{"type":"toolResponse","id":"call-1","toolResult":{"content":[{"type":"text","text":"x"}],"structured_content":{"rows":[1,2,3,4,5,6,7,8,9]}}}]}}`,
+		`{"type":"Message","message":{"role":"user","created":1,"content":[{"type":"toolResponse","id":"call-2","toolResult":{"content":[{"type":"text","text":"x"}],"structured_content":{"ok":true}}}]}}`,
+		`{"type":"Finish","reason":"stop"}`,
+	})
+	sessionID := createSession(t, proxySrv.URL, "myapp", "user1")
+	events := runSSE(t, proxySrv.URL, "myapp", "user1", sessionID, "query")
+	if len(events) != 3 {
+		t.Fatalf("expected 3 events, got %+v", events)
+	}
+
+	response := func(evt map[string]any) map[string]any {
+		parts := evt["content"].(map[string]any)["parts"].([]any)
+		return parts[0].(map[string]any)["functionResponse"].(map[string]any)["response"].(map[string]any)
+	}
+	truncated := response(events[0])
+	if truncated["result"] != `{"rows":[1,2,3,4,5,6` || truncated["truncated"] != true || truncated["artifact"] != "tool-results/call-1.json" || truncated["rows"] != nil {
+		t.Errorf("expected a preview of the structured result's JSON, got %+v", truncated)
+	}
+	if small := response(events[1]); small["ok"] != true || small["result"] != nil {
+		t.Errorf("expected the small structured result as is, got %+v", small)
+	}
+}
+
+func TestAdminGooseConfig(t *testing.T) {
+	mock, proxySrv := setupProxyWith(t, &config.Config{AdminToken: testAdminToken}, defaultReplyEvents)
+
+	resp := adminDo(t, http.MethodGet, proxySrv.URL+"/admin/goose/config", nil)
+	var all struct {
+		Config map[string]any `json:"config"`
+	}
+	json.NewDecoder(resp.Body).Decode(&all)
+	resp.Body.Close()
+	if all.Config["GOOSE_PROVIDER"] != "openai" {
+		t.Errorf("expected the Goose config, got %+v", all.Config)
+	}
+
+	resp = adminDo(t, http.MethodGet, proxySrv.URL+"/admin/goose/config/GOOSE_MODEL", nil)
+	var one map[string]any
+	json.NewDecoder(resp.Body).Decode(&one)
+	resp.Body.Close()
+	if one["key"] != "GOOSE_MODEL" || one["value"] != "gpt-4o" {
+		t.Errorf("unexpected config value %+v", one)
+	}
+	if reads := Calls[gooseclient.ConfigKeyRequest](t, mock, "/config/read"); len(reads) != 1 || reads[0].Key != "GOOSE_MODEL" || reads[0].IsSecret {
+		t.Errorf("unexpected config reads %+v", reads)
+	}
+	resp = adminDo(t, http.MethodGet, proxySrv.URL+"/admin/goose/config/OPENAI_API_KEY?secret=true", nil)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("expected secrets refused on the client port, got %d", resp.StatusCode)
+	}
+	if reads := Calls[gooseclient.ConfigKeyRequest](t, mock, "/config/read"); len(reads) != 1 {
+		t.Errorf("expected no secret read from Goose, got %+v", reads)
+	}
+
+	resp = adminDo(t, http.MethodPut, proxySrv.URL+"/admin/goose/config/OPENAI_API_KEY",
+		strings.NewReader(`{"value":"sk-test","isSecret":true}`))
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("expected status 204, got %d", resp.StatusCode)
+	}
+	upserts := Calls[gooseclient.UpsertConfigRequest](t, mock, "/config/upsert")
+	if len(upserts) != 1 || upserts[0].Key != "OPENAI_API_KEY" || upserts[0].Value != "sk-test" || !upserts[0].IsSecret {
+		t.Errorf("unexpected config upserts %+v", upserts)
+	}
+
+	resp = adminDo(t, http.MethodPut, proxySrv.URL+"/admin/goose/config/GOOSE_MODEL", strings.NewReader(`{}`))
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected status 400 for a missing value, got %d", resp.StatusCode)
+	}
+}
+
+func TestSession_AppInstructions(t *testing.T) {
+	cfg := &config.Config{
+		Apps: map[string]config.AppConfig{"myapp": {Instructions: "Follow the team's Go style guide."}},
+	}
+	mock, proxySrv := setupProxyWith(t, cfg, defaultReplyEvents)
+
+	createSession(t, proxySrv.URL, "myapp", "user1")
+	runSSE(t, proxySrv.URL, "myapp", "user1", "implicit-session", "hello")
+	createSession(t, proxySrv.URL, "otherapp", "user1")
+
+	prompts := Calls[gooseclient.ExtendPromptRequest](t, mock, "/agent/prompt")
+	if len(prompts) != 2 {
+		t.Fatalf("expected instructions for both myapp sessions only, got %+v", prompts)
+	}
+	for i, p := range prompts {
+		if want := fmt.Sprintf("goose-session-%d", i+1); p.SessionID != want || p.Extension != "Follow the team's Go style guide." {
+			t.Errorf("prompt %d: unexpected request %+v", i, p)
+		}
+	}
+}
+
+func TestListTools(t *testing.T) {
+	cfg := &config.Config{
+		Apps: map[string]config.AppConfig{
+			"restricted": {ToolPolicy: policy.ToolPolicy{Deny: []string{"developer__shell"}}},
+		},
+	}
+	_, proxySrv := setupProxyWith(t, cfg, defaultReplyEvents)
+
+	listTools := func(app, sessionID string) (int, []*genai.FunctionDeclaration) {
+		t.Helper()
+		resp, err := http.Get(fmt.Sprintf("%s/apps/%s/users/user1/sessions/%s/tools", proxySrv.URL, app, sessionID))
+		if err != nil {
+			t.Fatalf("GET tools: %v", err)
+		}
+		defer resp.Body.Close()
+		var decls []*genai.FunctionDeclaration
+		json.NewDecoder(resp.Body).Decode(&decls)
+		return resp.StatusCode, decls
+	}
+
+	status, decls := listTools("myapp", createSession(t, proxySrv.URL, "myapp", "user1"))
+	if status != http.StatusOK || len(decls) != 2 {
+		t.Fatalf("expected 2 tools, got status %d and %+v", status, decls)
+	}
+	if shell := decls[0]; shell.Name != "developer__shell" || shell.Description != "Run a shell command" || shell.Parameters == nil || shell.Parameters.Properties["command"] == nil {
+		t.Errorf("unexpected shell declaration %+v", shell)
+	}
+	if editor := decls[1]; editor.ParametersJsonSchema == nil || editor.Parameters != nil {
+		t.Errorf("expected the editor's JSON schema, got %+v", editor)
+	}
+
+	status, decls = listTools("restricted", createSession(t, proxySrv.URL, "restricted", "user1"))
+	if status != http.StatusOK || len(decls) != 1 || decls[0].Name != "developer__text_editor" {
+		t.Errorf("expected the denied tool to be hidden, got status %d and %+v", status, decls)
+	}
+
+	if status, _ := listTools("myapp", "missing"); status != http.StatusNotFound {
+		t.Errorf("expected status 404 for an unknown session, got %d", status)
+	}
+}
+
+func TestRunSSE_RebuildsLostGooseSession(t *testing.T) {
+	mock, proxySrv := setupProxy(t)
+	sessionID := createSession(t, proxySrv.URL, "myapp", "user1")
+	runSSE(t, proxySrv.URL, "myapp", "user1", sessionID, "hello")
+
+	mock.mu.Lock()
+	mock.lost = map[string]bool{"goose-session-1": true}
+	mock.mu.Unlock()
+
+	events := runSSE(t, proxySrv.URL, "myapp", "user1", sessionID, "still there?")
+	if len(events) == 0 || events[len(events)-1]["turnComplete"] != true {
+		t.Fatalf("expected the turn to complete on a new agent, got %+v", events)
+	}
+
+	replies := Calls[gooseclient.ReplyRequest](t, mock, "/reply")
+	if len(replies) != 3 {
+		t.Fatalf("expected 3 reply calls, got %d", len(replies))
+	}
+	retry := replies[2]
+	if retry.SessionID != "goose-session-2" {
+		t.Errorf("expected the retry on goose-session-2, got %q", retry.SessionID)
+	}
+	var history []string
+	for _, msg := range retry.ConversationSoFar {
+		history = append(history, msg.Role+": "+msg.Content[0].Text)
+	}
+	want := []string{"user: hello", "assistant: Hello from Goose!"}
+	if !slices.Equal(history, want) {
+		t.Errorf("expected conversation_so_far %q, got %q", want, history)
+	}
+	if retry.UserMessage.Content[0].Text != "still there?" {
+		t.Errorf("unexpected user message %+v", retry.UserMessage)
+	}
+
+	// Later turns go straight to the new agent.
+	runSSE(t, proxySrv.URL, "myapp", "user1", sessionID, "thanks")
+	if replies := Calls[gooseclient.ReplyRequest](t, mock, "/reply"); replies[3].SessionID != "goose-session-2" || len(replies[3].ConversationSoFar) != 0 {
+		t.Errorf("unexpected follow-up reply %+v", replies[3])
+	}
+}
+
+func TestRunSSE_LostGooseSessionRebuiltOntoRunningTurn(t *testing.T) {
+	mock, proxySrv := setupProxy(t)
+	sessionID := createSession(t, proxySrv.URL, "myapp", "user1")
+	mock.mu.Lock()
+	mock.lost = map[string]bool{"goose-session-1": true}
+	mock.mu.Unlock()
+
+	// A turn already holds the ID Goose gives the rebuilt session.
+	handler := proxySrv.Config.Handler.(*Handler)
+	if !handler.turns.tryAcquire("goose-session-2") {
+		t.Fatal("expected the lock free")
+	}
+	defer handler.turns.release("goose-session-2")
+	resp := postRunSSE(t, proxySrv.URL, "myapp", "user1", sessionID, map[string]any{
+		"new_message": genai.NewContentFromText("still there?", genai.RoleUser),
+	})
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusConflict {
+		t.Fatalf("expected 409, got %d", resp.StatusCode)
+	}
+	if replies := Calls[gooseclient.ReplyRequest](t, mock, "/reply"); len(replies) != 1 {
+		t.Errorf("expected no reply on the rebuilt session, got %+v", replies)
+	}
+	if !handler.turns.tryAcquire("goose-session-1") {
+		t.Error("expected the turn's own lock released")
+	}
+}
+
+func TestSessionManager_RecoverWithoutLock(t *testing.T) {
+	mock := newMockGooseServer(t, defaultReplyEvents)
+	resuming, resume := make(chan struct{}), make(chan struct{})
+	inner := mock.Config.Handler
+	mock.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/agent/resume" {
+			close(resuming)
+			<-resume
+		}
+		inner.ServeHTTP(w, r)
+	})
+	mock.mu.Lock()
+	mock.lost = map[string]bool{"goose-session-1": true}
+	mock.mu.Unlock()
+	sm := NewSessionManager(gooseclient.New(mock.URL, ""), t.TempDir())
+	lost := SessionKey{App: "myapp", User: "user1", ID: "lost"}
+	kept := SessionKey{App: "myapp", User: "user1", ID: "kept"}
+	for _, key := range []SessionKey{lost, kept} {
+		if _, err := sm.Create(t.Context(), key, nil); err != nil {
+			t.Fatalf("create: %v", err)
+		}
+	}
+
+	recovered := make(chan string, 1)
+	go func() {
+		how, _, _, err := sm.Recover(t.Context(), lost, "goose-session-1")
+		if err != nil {
+			t.Errorf("recover: %v", err)
+		}
+		recovered <- how
+	}()
+	<-resuming
+
+	// Other sessions stay usable while Goose is asked to resume the lost
+	// one, and a second replacement waits for the first.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		sm.Touch(kept)
+		sm.Get(lost)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the session manager unlocked during the resume call")
+	}
+	reattached := make(chan string, 1)
+	go func() {
+		id, _, _ := sm.Reattach(t.Context(), lost)
+		reattached <- id
+	}()
+	select {
+	case id := <-reattached:
+		t.Fatalf("expected the reattach to wait for the recovery, got %s", id)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(resume)
+	if how := <-recovered; how != RecoveryRecreated {
+		t.Errorf("expected the session recreated, got %q", how)
+	}
+	if id := <-reattached; id != "goose-session-4" {
+		t.Errorf("expected the reattach to replace the recreated agent, got %s", id)
+	}
+	if sess, _ := sm.Get(lost); sess.GooseID != "goose-session-4" || sm.Maps("goose-session-3") {
+		t.Errorf("expected the session on goose-session-4 only, got %+v", sess)
+	}
+}
+
+func TestCheckSessions_RecoversLostGooseSession(t *testing.T) {
+	mock := newMockGooseServer(t, defaultReplyEvents)
+	client := gooseclient.New(mock.URL, "")
+	handler := NewHandler(NewSessionManager(client, t.TempDir()), client, &config.Config{})
+	proxySrv := httptest.NewServer(handler)
+	t.Cleanup(proxySrv.Close)
+
+	lostID := createSession(t, proxySrv.URL, "myapp", "user1")
+	keptID := createSession(t, proxySrv.URL, "myapp", "user1")
+	runSSE(t, proxySrv.URL, "myapp", "user1", lostID, "hello")
+
+	mock.mu.Lock()
+	mock.lost = map[string]bool{"goose-session-1": true}
+	mock.mu.Unlock()
+	before := sessionHealth.Value("recreated")
+	handler.checkSessions(context.Background())
+
+	if got := sessionHealth.Value("recreated") - before; got != 1 {
+		t.Errorf("expected one session recreated, got %v", got)
+	}
+	if resumes := Calls[gooseclient.ResumeAgentRequest](t, mock, "/agent/resume"); len(resumes) != 1 || resumes[0].SessionID != "goose-session-1" {
+		t.Errorf("expected the lost session resumed first, got %+v", resumes)
+	}
+	lost, _ := handler.sessions.Get(SessionKey{App: "myapp", User: "user1", ID: lostID})
+	kept, _ := handler.sessions.Get(SessionKey{App: "myapp", User: "user1", ID: keptID})
+	if lost.GooseID != "goose-session-3" || kept.GooseID != "goose-session-2" {
+		t.Fatalf("expected only the lost session moved to a new agent, got %s and %s", lost.GooseID, kept.GooseID)
+	}
+
+	// The next turn replays the conversation on the new agent.
+	runSSE(t, proxySrv.URL, "myapp", "user1", lostID, "still there?")
+	replies := Calls[gooseclient.ReplyRequest](t, mock, "/reply")
+	last := replies[len(replies)-1]
+	if last.SessionID != "goose-session-3" || len(last.ConversationSoFar) != 2 {
+		t.Errorf("expected the history replayed on goose-session-3, got %+v", last)
+	}
+}
+
+func TestCollectOrphans_RemovesUnmappedProxySessions(t *testing.T) {
+	mock := newMockGooseServer(t, defaultReplyEvents)
+	client := gooseclient.New(mock.URL, "")
+	handler := NewHandler(NewSessionManager(client, t.TempDir()), client, &config.Config{GooseSessionPrefix: "adk2goose-"})
+	proxySrv := httptest.NewServer(handler)
+	t.Cleanup(proxySrv.Close)
+
+	keptID := createSession(t, proxySrv.URL, "myapp", "user1")    // goose-session-1
+	deletedID := createSession(t, proxySrv.URL, "myapp", "user1") // goose-session-2
+	req, _ := http.NewRequest(http.MethodDelete, proxySrv.URL+"/apps/myapp/users/user1/sessions/"+deletedID, nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("delete session: %v", err)
+	}
+	resp.Body.Close()
+	ctx := context.Background()
+	client.StartAgent(ctx, &gooseclient.StartAgentRequest{Name: "someone-else"})           // goose-session-3
+	client.StartAgent(ctx, &gooseclient.StartAgentRequest{Name: "adk2goose-myapp/u/gone"}) // goose-session-4
+
+	listed := func() []string {
+		resp, err := client.ListSessions(ctx)
+		if err != nil {
+			t.Fatalf("list sessions: %v", err)
+		}
+		var ids []string
+		for _, s := range resp.Sessions {
+			ids = append(ids, s.ID)
+		}
+		return ids
+	}
+
+	suspects := handler.collectOrphans(ctx, nil)
+	if len(suspects) != 2 || !suspects["goose-session-2"] || !suspects["goose-session-4"] {
+		t.Fatalf("expected the unmapped proxy sessions suspected, got %v", suspects)
+	}
+	if ids := listed(); len(ids) != 4 {
+		t.Fatalf("expected nothing removed on first sight, got %v", ids)
+	}
+
+	if suspects = handler.collectOrphans(ctx, suspects); len(suspects) != 0 {
+		t.Errorf("expected no suspects left, got %v", suspects)
+	}
+	if ids := listed(); !slices.Equal(ids, []string{"goose-session-1", "goose-session-3"}) {
+		t.Errorf("expected only the mapped and foreign sessions kept, got %v", ids)
+	}
+	if s, _ := handler.sessions.Get(SessionKey{App: "myapp", User: "user1", ID: keptID}); s.GooseID != "goose-session-1" {
+		t.Errorf("expected the mapped session untouched, got %s", s.GooseID)
+	}
+	if names := Calls[gooseclient.StartAgentRequest](t, mock, "/agent/start"); names[0].Name != "adk2goose-myapp/user1/"+keptID {
+		t.Errorf("expected the proxy's sessions named with the prefix, got %q", names[0].Name)
+	}
+}
+
+func TestRunSSE_FailsOverToStandby(t *testing.T) {
+	primary := newMockGooseServer(t, defaultReplyEvents)
+	standby := newMockGooseServer(t, defaultReplyEvents)
+	client := gooseclient.New(primary.URL, "", gooseclient.WithStandby(standby.URL))
+	handler := NewHandler(NewSessionManager(client, t.TempDir()), client, &config.Config{})
+	proxySrv := httptest.NewServer(handler)
+	t.Cleanup(proxySrv.Close)
+
+	sessionID := createSession(t, proxySrv.URL, "myapp", "user1")
+	runSSE(t, proxySrv.URL, "myapp", "user1", sessionID, "hello")
+
+	// The primary dies mid-reply: the turn restarts on the standby with the
+	// conversation so far.
+	primary.mu.Lock()
+	primary.dying = true
+	primary.mu.Unlock()
+	events := runSSE(t, proxySrv.URL, "myapp", "user1", sessionID, "again")
+
+	var warning map[string]any
+	for _, evt := range events {
+		if meta, ok := evt["customMetadata"].(map[string]any); ok && meta["goose:failover"] != nil {
+			warning = meta["goose:failover"].(map[string]any)
+		}
+	}
+	if warning == nil || warning["from"] != primary.URL || warning["to"] != standby.URL {
+		t.Fatalf("expected a failover warning from the primary to the standby, got %v", events)
+	}
+	if last := events[len(events)-1]; last["turnComplete"] != true {
+		t.Errorf("expected the turn completed on the standby, got %v", last)
+	}
+	replies := Calls[gooseclient.ReplyRequest](t, standby, "/reply")
+	if len(replies) != 1 || len(replies[0].ConversationSoFar) != 2 || replies[0].UserMessage.Content[0].Text != "again" {
+		t.Fatalf("expected the turn replayed on the standby after the first turn, got %+v", replies)
+	}
+	if sess, _ := handler.sessions.Get(SessionKey{App: "myapp", User: "user1", ID: sessionID}); sess.GooseID != replies[0].SessionID {
+		t.Errorf("expected the session moved to standby agent %s, got %s", replies[0].SessionID, sess.GooseID)
+	}
+
+	// Later turns stay on the standby.
+	runSSE(t, proxySrv.URL, "myapp", "user1", sessionID, "still there?")
+	if replies := Calls[gooseclient.ReplyRequest](t, primary, "/reply"); len(replies) != 2 {
+		t.Errorf("expected no more replies from the primary, got %d", len(replies))
+	}
+}
+
+func TestRunSSE_NoFailoverOntoRunningTurn(t *testing.T) {
+	primary := newMockGooseServer(t, defaultReplyEvents)
+	standby := newMockGooseServer(t, defaultReplyEvents)
+	client := gooseclient.New(primary.URL, "", gooseclient.WithStandby(standby.URL))
+	handler := NewHandler(NewSessionManager(client, t.TempDir()), client, &config.Config{})
+	proxySrv := httptest.NewServer(handler)
+	t.Cleanup(proxySrv.Close)
+
+	createSession(t, proxySrv.URL, "myapp", "user1")
+	sessionID := createSession(t, proxySrv.URL, "myapp", "user1")
+
+	// Another turn holds the ID the standby gives the moved session.
+	if !handler.turns.tryAcquire("goose-session-1") {
+		t.Fatal("expected the lock free")
+	}
+	defer handler.turns.release("goose-session-1")
+	primary.mu.Lock()
+	primary.dying = true
+	primary.mu.Unlock()
+	for _, evt := range runSSE(t, proxySrv.URL, "myapp", "user1", sessionID, "again") {
+		if meta, ok := evt["customMetadata"].(map[string]any); ok && meta["goose:failover"] != nil {
+			t.Fatalf("expected no failover onto a session with a running turn, got %v", evt)
+		}
+	}
+	if replies := Calls[gooseclient.ReplyRequest](t, standby, "/reply"); len(replies) != 0 {
+		t.Errorf("expected no reply on the standby, got %+v", replies)
+	}
+	if !handler.turns.tryAcquire("goose-session-2") {
+		t.Error("expected the turn's own lock released")
+	}
+}
+
+func TestRunSSE_TraceContext(t *testing.T) {
+	var mu sync.Mutex
+	var traceparents []string
+	var correlationIDs []string
+	mock := newMockGooseServer(t, defaultReplyEvents)
+	inner := mock.Config.Handler
+	mock.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		traceparents = append(traceparents, r.Header.Get("traceparent"))
+		correlationIDs = append(correlationIDs, r.Header.Get("X-Correlation-ID"))
+		mu.Unlock()
+		inner.ServeHTTP(w, r)
+	})
+	client := gooseclient.New(mock.URL, "")
+	proxySrv := httptest.NewServer(NewHandler(NewSessionManager(client, t.TempDir()), client, &config.Config{}))
+	t.Cleanup(proxySrv.Close)
+	sessionID := createSession(t, proxySrv.URL, "myapp", "user1")
+
+	body, _ := json.Marshal(map[string]any{"new_message": genai.NewContentFromText("hi", genai.RoleUser)})
+	req, _ := http.NewRequest(http.MethodPost, proxySrv.URL+"/apps/myapp/users/user1/sessions/"+sessionID+"/run_sse", bytes.NewReader(body))
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	req.Header.Set("X-Request-ID", "req-42")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("run_sse: %v", err)
+	}
+	defer resp.Body.Close()
+	if got := resp.Header.Get("X-Correlation-ID"); got != "req-42" {
+		t.Errorf("expected the correlation ID echoed, got %q", got)
+	}
+	events := readSSEEvents(t, resp.Body)
+
+	mu.Lock()
+	last, correlationID := traceparents[len(traceparents)-1], correlationIDs[len(correlationIDs)-1]
+	mu.Unlock()
+	if !strings.HasPrefix(last, "00-4bf92f3577b34da6a3ce929d0e0e4736-") || correlationID != "req-42" {
+		t.Errorf("expected the reply sent within the client's trace, got %q, %q", last, correlationID)
+	}
+	trace, _ := events[0]["customMetadata"].(map[string]any)["goose:trace"].(map[string]any)
+	if p, _ := trace["traceparent"].(string); !strings.HasPrefix(p, "00-4bf92f3577b34da6a3ce929d0e0e4736-") || trace["correlationId"] != "req-42" {
+		t.Errorf("expected the trace context on the first event, got %v", events[0])
+	}
+}
+
+func TestRunSSE_FunctionResponseContinuesRunningTurn(t *testing.T) {
+	mock, proxySrv := setupProxyWith(t, &config.Config{}, []string{
+		`{"type":"Message","message":{"role":"assistant","created":1,"content":[{"type":"toolConfirmationRequest","id":"req-1","toolName":"developer__shell","arguments":{"command":"make"}}]}}`,
+		`{"type":"Message","message":{"role":"assistant","created":2,"content":[{"type":"text","text":"built"}]}}`,
+		`{"type":"Finish","reason":"stop"}`,
+	})
+	mock.delay = 100 * time.Millisecond
+	sessionID := createSession(t, proxySrv.URL, "myapp", "user1")
+
+	running := postRunSSE(t, proxySrv.URL, "myapp", "user1", sessionID, map[string]any{
+		"new_message": genai.NewContentFromText("build it", genai.RoleUser),
+	})
+	defer running.Body.Close()
+	reader := bufio.NewReader(running.Body)
+	line, err := reader.ReadString('\n')
+	if strings.HasPrefix(line, "id: ") {
+		line, err = reader.ReadString('\n')
+	}
+	if err != nil || !strings.Contains(line, "adk_request_confirmation") {
+		t.Fatalf("expected the confirmation prompt first, got %q, %v", line, err)
+	}
+
+	resp := postRunSSE(t, proxySrv.URL, "myapp", "user1", sessionID, map[string]any{
+		"new_message": &genai.Content{Role: genai.RoleUser, Parts: []*genai.Part{
+			{FunctionResponse: &genai.FunctionResponse{ID: "req-1", Name: "adk_request_confirmation", Response: map[string]any{"confirmed": true}}},
+			{FunctionResponse: &genai.FunctionResponse{ID: "call-7", Name: "deploy", Response: map[string]any{"status": "done"}}},
+		}},
+	})
+	events := readSSEEvents(t, resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || len(events) != 1 || events[0]["turnComplete"] != true {
+		t.Fatalf("expected a single completing event, got status %d and %+v", resp.StatusCode, events)
+	}
+	meta, _ := events[0]["customMetadata"].(map[string]any)
+	if got := fmt.Sprint(meta["goose:continuation"]); got != "map[functionResponses:[req-1 call-7]]" {
+		t.Errorf("unexpected continuation metadata %s", got)
+	}
+
+	confirms := Calls[gooseclient.ToolConfirmationRequest](t, mock, "/confirm")
+	if len(confirms) != 1 || confirms[0].RequestID != "req-1" || !confirms[0].Approved || confirms[0].SessionID != "goose-session-1" {
+		t.Errorf("unexpected confirmations %+v", confirms)
+	}
+	results := Calls[gooseclient.ToolResultRequest](t, mock, "/tool_result")
+	if len(results) != 1 || results[0].ID != "call-7" || results[0].Result == nil || results[0].Result.Content[0].Text != `{"status":"done"}` {
+		t.Errorf("unexpected tool results %+v", results)
+	}
+	if replies := Calls[gooseclient.ReplyRequest](t, mock, "/reply"); len(replies) != 1 {
+		t.Errorf("expected no new Goose reply, got %d", len(replies))
+	}
+
+	if rest := readSSEEvents(t, reader); len(rest) == 0 || rest[len(rest)-1]["turnComplete"] != true {
+		t.Errorf("expected the running turn to finish, got %+v", rest)
+	}
+}
+
+func TestSessions_ScopedByAppAndUser(t *testing.T) {
+	mock, proxySrv := setupProxy(t)
+
+	runSSE(t, proxySrv.URL, "app1", "user1", "shared", "hello")
+	runSSE(t, proxySrv.URL, "app2", "user1", "shared", "hello")
+	replies := Calls[gooseclient.ReplyRequest](t, mock, "/reply")
+	if len(replies) != 2 || replies[0].SessionID == replies[1].SessionID {
+		t.Fatalf("expected separate Goose sessions per app, got %+v", replies)
+	}
+
+	status := func(method, path string) int {
+		t.Helper()
+		req, _ := http.NewRequest(method, proxySrv.URL+path, nil)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s: %v", method, path, err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if got := status(http.MethodGet, "/apps/app1/users/user2/sessions/shared"); got != http.StatusNotFound {
+		t.Errorf("expected 404 reading another user's session, got %d", got)
+	}
+	if got := status(http.MethodDelete, "/apps/app3/users/user1/sessions/shared"); got != http.StatusNotFound {
+		t.Errorf("expected 404 deleting through another app, got %d", got)
+	}
+	if got := status(http.MethodDelete, "/apps/app1/users/user1/sessions/shared"); got != http.StatusOK {
+		t.Errorf("expected the owner's delete to succeed, got %d", got)
+	}
+	if got := status(http.MethodGet, "/apps/app2/users/user1/sessions/shared"); got != http.StatusOK {
+		t.Errorf("expected app2's session to survive, got %d", got)
+	}
+
+	resp, err := http.Get(proxySrv.URL + "/apps/app2/users/user1/sessions")
+	if err != nil {
+		t.Fatalf("GET sessions: %v", err)
+	}
+	var sessions []map[string]any
+	json.NewDecoder(resp.Body).Decode(&sessions)
+	resp.Body.Close()
+	if len(sessions) != 1 || sessions[0]["appName"] != "app2" {
+		t.Errorf("expected only app2's session listed, got %+v", sessions)
+	}
+}
+
+func TestAuthorization_OwnSessionsOnly(t *testing.T) {
+	_, proxySrv := setupProxyWith(t, &config.Config{AuthUserHeader: "X-Authenticated-User"}, defaultReplyEvents)
+
+	do := func(method, path, principal string) (int, map[string]any) {
+		t.Helper()
+		req, _ := http.NewRequest(method, proxySrv.URL+path, strings.NewReader("{}"))
+		if principal != "" {
+			req.Header.Set("X-Authenticated-User", principal)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s: %v", method, path, err)
+		}
+		defer resp.Body.Close()
+		var body map[string]any
+		json.NewDecoder(resp.Body).Decode(&body)
+		return resp.StatusCode, body
+	}
+
+	status, body := do(http.MethodPost, "/apps/myapp/users/alice/sessions", "alice")
+	if status != http.StatusOK {
+		t.Fatalf("expected alice to create her session, got %d %+v", status, body)
+	}
+	sessionPath := "/apps/myapp/users/alice/sessions/" + body["id"].(string)
+
+	if status, _ := do(http.MethodGet, sessionPath, ""); status != http.StatusUnauthorized {
+		t.Errorf("expected 401 without credentials, got %d", status)
+	}
+	for _, method := range []string{http.MethodGet, http.MethodDelete} {
+		status, body := do(method, sessionPath, "mallory")
+		if status != http.StatusForbidden || body["error"] == nil {
+			t.Errorf("%s: expected 403 with an error body for another principal, got %d %+v", method, status, body)
+		}
+	}
+	if status, _ := do(http.MethodPost, sessionPath+"/run_sse", "mallory"); status != http.StatusForbidden {
+		t.Errorf("expected 403 running another user's session, got %d", status)
+	}
+	if status, _ := do(http.MethodGet, sessionPath, "alice"); status != http.StatusOK {
+		t.Errorf("expected alice to read her session, got %d", status)
+	}
+}
+
+func TestListSessions_PaginationAndOrder(t *testing.T) {
+	_, proxySrv := setupProxy(t)
+	var ids []string
+	for range 5 {
+		ids = append(ids, createSession(t, proxySrv.URL, "myapp", "user1"))
+	}
+	// The oldest session becomes the most recently active.
+	runSSE(t, proxySrv.URL, "myapp", "user1", ids[0], "hello")
+
+	list := func(query string) ([]string, string, int) {
+		t.Helper()
+		resp, err := http.Get(proxySrv.URL + "/apps/myapp/users/user1/sessions?" + query)
+		if err != nil {
+			t.Fatalf("GET sessions: %v", err)
+		}
+		defer resp.Body.Close()
+		var sessions []map[string]any
+		json.NewDecoder(resp.Body).Decode(&sessions)
+		var got []string
+		for _, s := range sessions {
+			got = append(got, s["id"].(string))
+		}
+		return got, resp.Header.Get("X-Next-Page-Token"), resp.StatusCode
+	}
+
+	var all []string
+	token := ""
+	for pages := 0; ; pages++ {
+		page, next, status := list("pageSize=2&pageToken=" + token)
+		if status != http.StatusOK || len(page) > 2 || pages > 3 {
+			t.Fatalf("unexpected page: status %d, %v", status, page)
+		}
+		all = append(all, page...)
+		if next == "" {
+			break
+		}
+		token = next
+	}
+	if !slices.Equal(all, ids) {
+		t.Errorf("expected every session in creation order, got %v", all)
+	}
+
+	recent, _, _ := list("orderBy=lastUpdateTime&pageSize=1")
+	if len(recent) != 1 || recent[0] != ids[0] {
+		t.Errorf("expected the most recently active session first, got %v", recent)
+	}
+
+	for _, query := range []string{"pageSize=0", "pageToken=%21%21", "orderBy=name"} {
+		if _, _, status := list(query); status != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", query, status)
+		}
+	}
+}
+
+func TestAPIKeys(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "keys.json")
+	writeKeys := func(keys string) {
+		t.Helper()
+		if err := os.WriteFile(file, []byte(`{"keys": [`+keys+`]}`), 0o600); err != nil {
+			t.Fatalf("write keys: %v", err)
+		}
+	}
+	writeKeys(`
+		{"name": "alice-app", "key": "alice-secret", "user": "alice"},
+		{"name": "backend", "key": "backend-secret", "role": "service"},
+		{"name": "ops", "key": "ops-secret", "role": "admin"},
+		{"name": "old", "key": "old-secret", "user": "alice", "expiresAt": "2020-01-01T00:00:00Z"},
+		{"name": "leaked", "key": "leaked-secret", "user": "alice", "revoked": true}`)
+	keys, err := config.LoadAPIKeys(file)
+	if err != nil {
+		t.Fatalf("load keys: %v", err)
+	}
+	_, proxySrv := setupProxyWith(t, &config.Config{APIKeysFile: file, APIKeys: keys}, defaultReplyEvents)
+
+	do := func(method, path, key string) int {
+		t.Helper()
+		req, _ := http.NewRequest(method, proxySrv.URL+path, strings.NewReader("{}"))
+		if key != "" {
+			req.Header.Set("X-API-Key", key)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s: %v", method, path, err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	for _, tc := range []struct {
+		path, key string
+		want      int
+	}{
+		{"/apps/myapp/users/alice/sessions", "alice-secret", http.StatusOK},
+		{"/apps/myapp/users/bob/sessions", "alice-secret", http.StatusForbidden},
+		{"/apps/myapp/users/bob/sessions", "backend-secret", http.StatusOK},
+		{"/apps/myapp/users/alice/sessions", "", http.StatusUnauthorized},
+		{"/apps/myapp/users/alice/sessions", "wrong", http.StatusUnauthorized},
+		{"/apps/myapp/users/alice/sessions", "old-secret", http.StatusUnauthorized},
+		{"/apps/myapp/users/alice/sessions", "leaked-secret", http.StatusUnauthorized},
+	} {
+		if got := do(http.MethodGet, tc.path, tc.key); got != tc.want {
+			t.Errorf("GET %s with key %q: expected %d, got %d", tc.path, tc.key, tc.want, got)
+		}
+	}
+	if got := do(http.MethodGet, "/admin/api-keys", "backend-secret"); got != http.StatusUnauthorized {
+		t.Errorf("expected a service key refused on the admin routes, got %d", got)
+	}
+	if got := do(http.MethodGet, "/admin/api-keys", "ops-secret"); got != http.StatusOK {
+		t.Errorf("expected an admin key admitted to the admin routes, got %d", got)
+	}
+
+	// Rotating the file replaces the keys without a restart; a broken file
+	// keeps the previous ones.
+	ring := newKeyring(file, keys)
+	writeKeys(`{"name": "alice-app-2", "key": "alice-secret-2", "user": "alice"}`)
+	os.Chtimes(file, time.Now(), time.Now().Add(time.Second))
+	if changed, err := ring.reload(); !changed || err != nil {
+		t.Fatalf("expected keys reloaded, got %v, %v", changed, err)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer alice-secret")
+	if _, err := ring.lookup(req); err == nil {
+		t.Error("expected the rotated-out key refused")
+	}
+	req.Header.Set("Authorization", "Bearer alice-secret-2")
+	if key, err := ring.lookup(req); err != nil || key.Name != "alice-app-2" {
+		t.Errorf("expected the new key accepted, got %+v, %v", key, err)
+	}
+	writeKeys(`{"name": "broken"}`)
+	os.Chtimes(file, time.Now(), time.Now().Add(2*time.Second))
+	if _, err := ring.reload(); err == nil {
+		t.Error("expected an invalid keys file reported")
+	}
+	if _, err := ring.lookup(req); err != nil {
+		t.Errorf("expected the previous keys kept after a failed reload, got %v", err)
+	}
+}
+
+func TestAdminRoutes_ClosedWithoutCredentials(t *testing.T) {
+	_, proxySrv := setupProxyWith(t, &config.Config{AuthUserHeader: "X-User"}, defaultReplyEvents)
+	for _, tc := range []struct{ method, path string }{
+		{http.MethodGet, "/admin/sessions"},
+		{http.MethodDelete, "/admin/users/alice/data"},
+		{http.MethodGet, "/admin/goose/config/OPENAI_API_KEY?secret=true"},
+		{http.MethodGet, "/metrics"},
+	} {
+		req, _ := http.NewRequest(tc.method, proxySrv.URL+tc.path, nil)
+		req.Header.Set("X-User", "bob")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s: %v", tc.method, tc.path, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNotFound {
+			t.Errorf("%s %s without admin credentials: expected 404 on the client port, got %d", tc.method, tc.path, resp.StatusCode)
+		}
+	}
+}
+
+func TestAdminListener_GooseConfigNeedsCredentials(t *testing.T) {
+	mock := newMockGooseServer(t, defaultReplyEvents)
+	client := gooseclient.New(mock.URL, "")
+	cfg := &config.Config{AdminListenAddr: "127.0.0.1:0"}
+	handler := NewHandler(NewSessionManager(client, t.TempDir()), client, cfg)
+	adminSrv := httptest.NewServer(handler.AdminHandler())
+	t.Cleanup(adminSrv.Close)
+
+	for _, path := range []string{"/admin/goose/config", "/admin/goose/config/OPENAI_API_KEY?secret=true"} {
+		resp, err := http.Get(adminSrv.URL + path)
+		if err != nil {
+			t.Fatalf("GET %s: %v", path, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNotFound {
+			t.Errorf("GET %s without admin credentials: expected 404, got %d", path, resp.StatusCode)
+		}
+	}
+	if reads := Calls[gooseclient.ConfigKeyRequest](t, mock, "/config/read"); len(reads) != 0 {
+		t.Errorf("expected Goose's config not read, got %+v", reads)
+	}
+}
+
+func TestAdminRoutes_GooseConfigAfterKeyReload(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "keys.json")
+	writeKeys := func(keys string) {
+		t.Helper()
+		if err := os.WriteFile(file, []byte(`{"keys": [`+keys+`]}`), 0o600); err != nil {
+			t.Fatalf("write keys: %v", err)
+		}
+	}
+	writeKeys(`{"name": "alice-app", "key": "alice-secret", "user": "alice"}`)
+	keys, err := config.LoadAPIKeys(file)
+	if err != nil {
+		t.Fatalf("load keys: %v", err)
+	}
+	_, proxySrv := setupProxyWith(t, &config.Config{APIKeysFile: file, APIKeys: keys}, defaultReplyEvents)
+	handler := proxySrv.Config.Handler.(*Handler)
+
+	get := func() int {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodGet, proxySrv.URL+"/admin/goose/config", nil)
+		req.Header.Set("X-API-Key", "ops-secret")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("GET /admin/goose/config: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if got := get(); got != http.StatusUnauthorized {
+		t.Errorf("expected 401 before the admin key exists, got %d", got)
+	}
+
+	// An admin key added to the file opens the routes without a restart.
+	writeKeys(`
+		{"name": "alice-app", "key": "alice-secret", "user": "alice"},
+		{"name": "ops", "key": "ops-secret", "role": "admin"}`)
+	os.Chtimes(file, time.Now(), time.Now().Add(time.Second))
+	if changed, err := handler.keys.reload(); !changed || err != nil {
+		t.Fatalf("expected keys reloaded, got %v, %v", changed, err)
+	}
+	if got := get(); got != http.StatusOK {
+		t.Errorf("expected 200 after the admin key was added, got %d", got)
+	}
+}
+
+func TestAdminListener_SeparateWithToken(t *testing.T) {
+	gooseSrv := newMockGooseServer(t, defaultReplyEvents)
+	client := gooseclient.New(gooseSrv.URL, "")
+	cfg := &config.Config{AdminListenAddr: "127.0.0.1:0", AdminToken: "s3cret"}
+	handler := NewHandler(NewSessionManager(client, t.TempDir()), client, cfg)
+
+	proxySrv := httptest.NewServer(handler)
+	t.Cleanup(proxySrv.Close)
+	adminSrv := httptest.NewServer(handler.AdminHandler())
+	t.Cleanup(adminSrv.Close)
+
+	for _, path := range []string{"/admin/sessions", "/metrics"} {
+		resp, err := http.Get(proxySrv.URL + path)
+		if err != nil {
+			t.Fatalf("GET %s: %v", path, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNotFound {
+			t.Errorf("GET %s on the client port: expected 404, got %d", path, resp.StatusCode)
+		}
+	}
+
+	resp, err := http.Get(adminSrv.URL + "/admin/sessions")
+	if err != nil {
+		t.Fatalf("GET admin sessions: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected 401 without the admin token, got %d", resp.StatusCode)
+	}
+
+	for _, path := range []string{"/admin/sessions", "/metrics"} {
+		req, _ := http.NewRequest(http.MethodGet, adminSrv.URL+path, nil)
+		req.Header.Set("Authorization", "Bearer s3cret")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("GET %s: %v", path, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("GET %s with the admin token: expected 200, got %d", path, resp.StatusCode)
+		}
+	}
+}
+
+func TestAdminDiagnostics(t *testing.T) {
+	_, proxySrv := setupProxy(t)
+	resp, err := http.Get(proxySrv.URL + "/debug/pprof/")
+	if err != nil {
+		t.Fatalf("GET pprof: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected no profiles without admin protection, got %d", resp.StatusCode)
+	}
+
+	client := gooseclient.New(newMockGooseServer(t, defaultReplyEvents).URL, "")
+	cfg := &config.Config{AdminToken: "s3cret"}
+	proxySrv = httptest.NewServer(NewHandler(NewSessionManager(client, t.TempDir()), client, cfg))
+	t.Cleanup(proxySrv.Close)
+	get := func(path string) *http.Response {
+		req, _ := http.NewRequest(http.MethodGet, proxySrv.URL+path, nil)
+		req.Header.Set("Authorization", "Bearer s3cret")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("GET %s: %v", path, err)
+		}
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+
+	for _, path := range []string{"/admin/diagnostics", "/debug/pprof/"} {
+		resp, err := http.Get(proxySrv.URL + path)
+		if err != nil {
+			t.Fatalf("GET %s: %v", path, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("GET %s: expected 401 without the admin token, got %d", path, resp.StatusCode)
+		}
+	}
+	if resp := get("/debug/pprof/goroutine?debug=1"); resp.StatusCode != http.StatusOK {
+		t.Errorf("expected the goroutine profile, got %d", resp.StatusCode)
+	}
+
+	resp = get("/admin/diagnostics")
+	var d Diagnostics
+	if err := json.NewDecoder(resp.Body).Decode(&d); err != nil {
+		t.Fatalf("decode diagnostics: %v", err)
+	}
+	if d.Goroutines == 0 || d.Memory.HeapAllocBytes == 0 {
+		t.Errorf("expected runtime figures, got %+v", d)
+	}
+	if b, ok := d.Backlogs["push"]; !ok || b.Channels != 0 {
+		t.Errorf("expected an empty push backlog, got %+v", d.Backlogs)
+	}
+}
+
+func TestAdminTap_MirrorsTurnEvents(t *testing.T) {
+	_, proxySrv := setupProxyWith(t, &config.Config{AdminToken: testAdminToken}, defaultReplyEvents)
+	sessionID := createSession(t, proxySrv.URL, "app", "alice")
+
+	resp := adminDo(t, http.MethodGet, proxySrv.URL+"/admin/sessions/missing/tap", nil)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404 tapping an unknown session, got %d", resp.StatusCode)
+	}
+
+	tap := adminDo(t, http.MethodGet, proxySrv.URL+"/admin/sessions/"+sessionID+"/tap", nil)
+	defer tap.Body.Close()
+	if tap.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 from tap, got %d", tap.StatusCode)
+	}
+
+	events := runSSE(t, proxySrv.URL, "app", "alice", sessionID, "hello")
+
+	req, _ := http.NewRequest(http.MethodDelete, fmt.Sprintf("%s/apps/app/users/alice/sessions/%s", proxySrv.URL, sessionID), nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("DELETE session: %v", err)
+	}
+	resp.Body.Close()
+
+	mirrored := readSSEEvents(t, tap.Body)
+	if len(mirrored) != len(events) {
+		t.Fatalf("expected the tap to mirror %d events, got %d", len(events), len(mirrored))
+	}
+	for i := range events {
+		if mirrored[i]["id"] != events[i]["id"] {
+			t.Errorf("event %d: tap saw %v, client saw %v", i, mirrored[i]["id"], events[i]["id"])
+		}
+	}
+}
+
+func TestRunSSE_FanOutToAttachedClients(t *testing.T) {
+	gooseSrv, proxySrv := setupProxy(t)
+	gooseSrv.mu.Lock()
+	gooseSrv.delay = 50 * time.Millisecond
+	gooseSrv.mu.Unlock()
+	sessionID := createSession(t, proxySrv.URL, "myapp", "user1")
+	streamURL := fmt.Sprintf("%s/apps/myapp/users/user1/sessions/%s/run_sse", proxySrv.URL, sessionID)
+
+	resp, err := http.Get(streamURL)
+	if err != nil {
+		t.Fatalf("GET run_sse: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404 attaching with no turn running, got %d", resp.StatusCode)
+	}
+
+	origin := make(chan []map[string]any)
+	go func() {
+		resp := postRunSSE(t, proxySrv.URL, "myapp", "user1", sessionID, map[string]any{
+			"new_message": genai.NewContentFromText("hi", genai.RoleUser),
+		})
+		defer resp.Body.Close()
+		origin <- readSSEEvents(t, resp.Body)
+	}()
+
+	// Attach a second tab once the turn is running.
+	var attached *http.Response
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+		resp, err := http.Get(streamURL)
+		if err != nil {
+			t.Fatalf("GET run_sse: %v", err)
+		}
+		if resp.StatusCode == http.StatusOK {
+			attached = resp
+			break
+		}
+		resp.Body.Close()
+	}
+	if attached == nil {
+		t.Fatal("could not attach to the running turn")
+	}
+	defer attached.Body.Close()
+
+	mirrored := readSSEEvents(t, attached.Body)
+	events := <-origin
+	if len(events) == 0 || len(mirrored) != len(events) {
+		t.Fatalf("expected the attached client to get all %d events, got %d", len(events), len(mirrored))
+	}
+	for i := range events {
+		if mirrored[i]["id"] != events[i]["id"] {
+			t.Errorf("event %d: attached client saw %v, origin saw %v", i, mirrored[i]["id"], events[i]["id"])
+		}
+	}
+}
+
+func TestRunSSE_ResumeWithLastEventID(t *testing.T) {
+	_, proxySrv := setupProxy(t)
+	sessionID := createSession(t, proxySrv.URL, "myapp", "user1")
+
+	resp := postRunSSE(t, proxySrv.URL, "myapp", "user1", sessionID, map[string]any{
+		"new_message": genai.NewContentFromText("hi", genai.RoleUser),
+	})
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	var ids []string
+	for _, line := range strings.Split(string(body), "\n") {
+		if id, ok := strings.CutPrefix(line, "id: "); ok {
+			ids = append(ids, id)
+		}
+	}
+	events := readSSEEvents(t, bytes.NewReader(body))
+	if len(ids) != len(events) || len(ids) < 2 {
+		t.Fatalf("expected an ID per event, got %d IDs for %d events", len(ids), len(events))
+	}
+
+	// The client dropped after the first event and reconnects.
+	resume := func(lastID string) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/apps/myapp/users/user1/sessions/%s/run_sse", proxySrv.URL, sessionID), nil)
+		req.Header.Set("Last-Event-ID", lastID)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("GET run_sse: %v", err)
+		}
+		return resp
+	}
+	resp = resume(ids[0])
+	rest := readSSEEvents(t, resp.Body)
+	resp.Body.Close()
+	if len(rest) != len(events)-1 {
+		t.Fatalf("expected the %d remaining events, got %d", len(events)-1, len(rest))
+	}
+	for i := range rest {
+		if rest[i]["id"] != events[i+1]["id"] {
+			t.Errorf("resumed event %d: got %v, want %v", i, rest[i]["id"], events[i+1]["id"])
+		}
+	}
+
+	resp = resume("inv_unknown:1")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404 resuming an unknown turn, got %d", resp.StatusCode)
+	}
+}
+
+func TestGetSession_EventsFromEventLog(t *testing.T) {
+	_, proxySrv := setupProxy(t)
+	sessionID := createSession(t, proxySrv.URL, "myapp", "user1")
+	sent := runSSE(t, proxySrv.URL, "myapp", "user1", sessionID, "what's up")
+
+	resp, err := http.Get(fmt.Sprintf("%s/apps/myapp/users/user1/sessions/%s", proxySrv.URL, sessionID))
+	if err != nil {
+		t.Fatalf("GET session: %v", err)
+	}
+	defer resp.Body.Close()
+	var body struct {
+		Events []map[string]any `json:"events"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+
+	// The user message, then every non-partial event the turn sent, rather
+	// than the Goose transcript.
+	if len(body.Events) != len(sent)+1 {
+		t.Fatalf("expected %d logged events, got %+v", len(sent)+1, body.Events)
+	}
+	if first := body.Events[0]; first["author"] != "user" || !strings.Contains(fmt.Sprint(first["content"]), "what's up") {
+		t.Errorf("expected the user's message first, got %+v", first)
+	}
+	for i, evt := range body.Events[1:] {
+		if evt["id"] != sent[i]["id"] || evt["invocationId"] != sent[i]["invocationId"] {
+			t.Errorf("event %d: got %v/%v, sent %v/%v", i, evt["invocationId"], evt["id"], sent[i]["invocationId"], sent[i]["id"])
+		}
+	}
+}
+
+func TestCreateSession_Idempotent(t *testing.T) {
+	mock, proxySrv := setupProxy(t)
+	create := func() map[string]any {
+		t.Helper()
+		resp, err := http.Post(proxySrv.URL+"/apps/myapp/users/user1/sessions/chosen-id", "application/json", nil)
+		if err != nil {
+			t.Fatalf("POST create session: %v", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected 200, got %d", resp.StatusCode)
+		}
+		var sess map[string]any
+		json.NewDecoder(resp.Body).Decode(&sess)
+		return sess
+	}
+
+	first := create()
+	if first["id"] != "chosen-id" {
+		t.Fatalf("expected the requested ID, got %+v", first)
+	}
+	runSSE(t, proxySrv.URL, "myapp", "user1", "chosen-id", "hi")
+
+	again := create()
+	if again["id"] != "chosen-id" {
+		t.Fatalf("expected the existing session, got %+v", again)
+	}
+	if events, _ := again["events"].([]any); len(events) == 0 {
+		t.Errorf("expected the existing session's events, got %+v", again["events"])
+	}
+	if starts := Calls[gooseclient.StartAgentRequest](t, mock, "/agent/start"); len(starts) != 1 {
+		t.Errorf("expected a single Goose agent, got %d starts", len(starts))
+	}
+}
+
+func TestUpdateSession_StateDelta(t *testing.T) {
+	_, proxySrv := setupProxy(t)
+	resp, err := http.Post(proxySrv.URL+"/apps/myapp/users/user1/sessions", "application/json", strings.NewReader(`{"state": {"topic": "go"}}`))
+	if err != nil {
+		t.Fatalf("POST create session: %v", err)
+	}
+	var created map[string]any
+	json.NewDecoder(resp.Body).Decode(&created)
+	resp.Body.Close()
+	sessionID, _ := created["id"].(string)
+	if created["state"].(map[string]any)["topic"] != "go" {
+		t.Fatalf("expected the initial state, got %+v", created["state"])
+	}
+
+	patch := func(id, body string) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodPatch, fmt.Sprintf("%s/apps/myapp/users/user1/sessions/%s", proxySrv.URL, id), strings.NewReader(body))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("PATCH session: %v", err)
+		}
+		return resp
+	}
+
+	resp = patch(sessionID, `{"stateDelta": {"step": 2, "topic": "rust"}}`)
+	var updated map[string]any
+	json.NewDecoder(resp.Body).Decode(&updated)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+	if state := updated["state"].(map[string]any); state["topic"] != "rust" || state["step"] != float64(2) {
+		t.Errorf("expected the merged state, got %+v", state)
+	}
+
+	getResp, err := http.Get(fmt.Sprintf("%s/apps/myapp/users/user1/sessions/%s", proxySrv.URL, sessionID))
+	if err != nil {
+		t.Fatalf("GET session: %v", err)
+	}
+	var got map[string]any
+	json.NewDecoder(getResp.Body).Decode(&got)
+	getResp.Body.Close()
+	events, _ := got["events"].([]any)
+	if len(events) != 1 {
+		t.Fatalf("expected the state change logged as an event, got %+v", events)
+	}
+	if evt := events[0].(map[string]any); evt["author"] != "user" || fmt.Sprint(evt["actions"]) != "map[stateDelta:map[step:2 topic:rust]]" {
+		t.Errorf("unexpected state event %+v", evt)
+	}
+
+	for body, want := range map[string]int{
+		`{"stateDelta": {}}`:      http.StatusBadRequest,
+		`{"stateDelta": {"": 1}}`: http.StatusBadRequest,
+	} {
+		resp := patch(sessionID, body)
+		resp.Body.Close()
+		if resp.StatusCode != want {
+			t.Errorf("PATCH %s: expected %d, got %d", body, want, resp.StatusCode)
+		}
+	}
+	resp = patch("missing", `{"stateDelta": {"a": 1}}`)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown session, got %d", resp.StatusCode)
+	}
+}
+
+func TestSessionState_ScopedPrefixes(t *testing.T) {
+	_, proxySrv := setupProxy(t)
+	a := createSession(t, proxySrv.URL, "myapp", "alice")
+	b := createSession(t, proxySrv.URL, "myapp", "alice")
+	c := createSession(t, proxySrv.URL, "myapp", "bob")
+	other := createSession(t, proxySrv.URL, "otherapp", "alice")
+
+	req, _ := http.NewRequest(http.MethodPatch, fmt.Sprintf("%s/apps/myapp/users/alice/sessions/%s", proxySrv.URL, a),
+		strings.NewReader(`{"stateDelta": {"draft": 1, "app:theme": "dark", "user:lang": "de", "temp:scratch": true}}`))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("PATCH session: %v", err)
+	}
+	resp.Body.Close()
+
+	get := func(app, user, id string) map[string]any {
+		t.Helper()
+		resp, err := http.Get(fmt.Sprintf("%s/apps/%s/users/%s/sessions/%s", proxySrv.URL, app, user, id))
+		if err != nil {
+			t.Fatalf("GET session: %v", err)
+		}
+		defer resp.Body.Close()
+		var sess map[string]any
+		json.NewDecoder(resp.Body).Decode(&sess)
+		return sess
+	}
+	for _, tc := range []struct {
+		app, user, id string
+		want          string
+	}{
+		{"myapp", "alice", a, "map[app:theme:dark draft:1 user:lang:de]"},
+		{"myapp", "alice", b, "map[app:theme:dark user:lang:de]"},
+		{"myapp", "bob", c, "map[app:theme:dark]"},
+		{"otherapp", "alice", other, "map[]"},
+	} {
+		if got := fmt.Sprint(get(tc.app, tc.user, tc.id)["state"]); got != tc.want {
+			t.Errorf("%s/%s/%s: state %s, want %s", tc.app, tc.user, tc.id, got, tc.want)
+		}
+	}
+
+	events, _ := get("myapp", "alice", a)["events"].([]any)
+	if len(events) != 1 || strings.Contains(fmt.Sprint(events[0]), "temp:") {
+		t.Errorf("expected the logged delta without temp: state, got %+v", events)
+	}
+}
+
+func TestRunSSE_StateFromStructuredToolResults(t *testing.T) {
+	cfg := &config.Config{Apps: map[string]config.AppConfig{"myapp": {StateRules: []config.StateRule{
+		{Tool: "git__*", Field: "repo.branch", Key: "user:branch"},
+		{Tool: "git__*", Field: "clean"},
+		{Tool: "other", Field: "ignored"},
+	}}}}
+	_, proxySrv := setupProxyWith(t, cfg, []string{
+		`{"type":"Message","message":{"role":"assistant","created":1,"content":[{"type":"toolRequest","id":"call-1","toolCall":{"name":"git__status","arguments":{}}}]}}`,
+		`{"type":"Message","message":{"role":"user","created":2,"content":[{"type":"toolResponse","id":"call-1","toolResult":{"content":[{"type":"text","text":"ok"}],"structured_content":{"repo":{"branch":"main"},"clean":true,"ignored":1}}}]}}`,
+		`{"type":"Finish","reason":"stop"}`,
+	})
+	sessionID := createSession(t, proxySrv.URL, "myapp", "user1")
+
+	events := runSSE(t, proxySrv.URL, "myapp", "user1", sessionID, "status?")
+	var delta any
+	for _, evt := range events {
+		if actions, ok := evt["actions"].(map[string]any); ok {
+			delta = actions["stateDelta"]
+		}
+	}
+	if got := fmt.Sprint(delta); got != "map[clean:true user:branch:main]" {
+		t.Fatalf("expected the tool result's fields in stateDelta, got %s", got)
+	}
+
+	resp, err := http.Get(fmt.Sprintf("%s/apps/myapp/users/user1/sessions/%s", proxySrv.URL, sessionID))
+	if err != nil {
+		t.Fatalf("GET session: %v", err)
+	}
+	defer resp.Body.Close()
+	var sess map[string]any
+	json.NewDecoder(resp.Body).Decode(&sess)
+	if got := fmt.Sprint(sess["state"]); got != "map[clean:true user:branch:main]" {
+		t.Errorf("expected the delta applied to session state, got %s", got)
+	}
+}
+
+func TestRunSSE_TransformsToolResults(t *testing.T) {
+	rule := transform.Rule{Tool: "github__*", Response: map[string]any{
+		"title":  "$.issue.title",
+		"labels": "$.issue.labels[*].name",
+	}}
+	if err := rule.Compile(); err != nil {
+		t.Fatalf("Compile: %v", err)
+	}
+	_, proxySrv := setupProxyWith(t, &config.Config{ToolResultRules: []transform.Rule{rule}}, []string{
+		`{"type":"Message","message":{"role":"assistant","created":1,"content":[{"type":"toolRequest","id":"call-1","toolCall":{"name":"github__get_issue","arguments":{}}},{"type":"toolRequest","id":"call-2","toolCall":{"name":"developer__shell","arguments":{}}}]}}`,
+		`{"type":"Message","message":{"role":"user","created":2,"content":[{"type":"toolResponse","id":"call-1","toolResult":{"content":[{"type":"text","text":"{\"issue\":{\"title\":\"Crash\",\"labels\":[{\"name\":\"bug\"}]}}"}]}},{"type":"toolResponse","id":"call-2","toolResult":{"content":[{"type":"text","text":"{\"a\":1}"}]}}]}}`,
+		`{"type":"Finish","reason":"stop"}`,
+	})
+	sessionID := createSession(t, proxySrv.URL, "myapp", "user1")
+
+	responses := map[string]string{}
+	for _, evt := range runSSE(t, proxySrv.URL, "myapp", "user1", sessionID, "look up the issue") {
+		content, _ := evt["content"].(map[string]any)
+		parts, _ := content["parts"].([]any)
+		for _, p := range parts {
+			if fr, ok := p.(map[string]any)["functionResponse"].(map[string]any); ok {
+				responses[fr["id"].(string)] = fmt.Sprint(fr["response"])
+			}
+		}
+	}
+	if got := responses["call-1"]; got != "map[labels:[bug] title:Crash]" {
+		t.Errorf("expected the reshaped result, got %s", got)
+	}
+	if got := responses["call-2"]; got != `map[result:{"a":1}]` {
+		t.Errorf("expected an unmatched tool's result unchanged, got %s", got)
+	}
+}
+
+func TestScheduledTurn_RecordsEvents(t *testing.T) {
+	gooseSrv := newMockGooseServer(t, defaultReplyEvents)
+	client := gooseclient.New(gooseSrv.URL, "")
+	sessions := NewSessionManager(client, t.TempDir())
+	h := NewHandler(sessions, client, &config.Config{})
+
+	sched := &config.Schedule{Cron: "0 9 * * 1-5", User: "bot", Session: "standup", Prompt: "post the daily standup"}
+	if err := sched.Compile(); err != nil {
+		t.Fatalf("compile schedule: %v", err)
+	}
+	if err := h.runScheduledTurn(context.Background(), "myapp", sched); err != nil {
+		t.Fatalf("scheduled turn: %v", err)
+	}
+
+	// The session is created by the first run, and the prompt and the
+	// turn's events land in its event log.
+	events, err := sessions.Events(SessionKey{App: "myapp", User: "bot", ID: "standup"})
+	if err != nil {
+		t.Fatalf("events: %v", err)
+	}
+	if len(events) < 2 {
+		t.Fatalf("expected the prompt and the turn's events, got %d events", len(events))
+	}
+	if events[0].Author != "user" || !strings.Contains(events[0].Content.Parts[0].Text, "daily standup") {
+		t.Errorf("expected the scheduled prompt first, got %+v", events[0])
+	}
+	if len(Calls[gooseclient.ReplyRequest](t, gooseSrv, "/reply")) != 1 {
+		t.Errorf("expected one /reply call")
+	}
+}
+
+func TestRunSSE_EstimatedCost(t *testing.T) {
+	cfg := &config.Config{Prices: map[string]config.ModelPrice{"*": {InputPerMillion: 3, OutputPerMillion: 15}}, AdminToken: testAdminToken}
+	_, proxySrv := setupProxyWith(t, cfg, defaultReplyEvents)
+	sessionID := createSession(t, proxySrv.URL, "myapp", "user1")
+	runSSE(t, proxySrv.URL, "myapp", "user1", sessionID, "hi")
+
+	body, _ := json.Marshal(map[string]any{"new_message": genai.NewContentFromText("again", genai.RoleUser)})
+	req, _ := http.NewRequest(http.MethodPost, fmt.Sprintf("%s/apps/myapp/users/user1/sessions/%s/run_sse", proxySrv.URL, sessionID), bytes.NewReader(body))
+	req.Header.Set("TE", "trailers")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("POST run_sse: %v", err)
+	}
+	events := readSSEEvents(t, resp.Body)
+	resp.Body.Close()
+
+	// 10 input and 5 output tokens per turn.
+	const turnCost = (10*3 + 5*15) / 1e6
+	last := events[len(events)-1]
+	cost, _ := last["customMetadata"].(map[string]any)["goose:estimatedCost"].(map[string]any)
+	if cost["turn"] != turnCost || cost["session"] != 2*turnCost {
+		t.Errorf("expected turn and session cost on the final event, got %+v", last["customMetadata"])
+	}
+	if got := resp.Trailer.Get("X-Estimated-Cost"); got != "0.000105" {
+		t.Errorf("expected the turn cost trailer, got %q", got)
+	}
+
+	resp = adminDo(t, http.MethodGet, proxySrv.URL+"/admin/usage?app=myapp", nil)
+	defer resp.Body.Close()
+	var report UsageReport
+	json.NewDecoder(resp.Body).Decode(&report)
+	if len(report.Sessions) != 1 || len(report.Users) != 1 || len(report.Apps) != 1 {
+		t.Fatalf("expected one session, user, and app, got %+v", report)
+	}
+	if u := report.Users[0]; u.User != "user1" || u.InputTokens != 20 || u.OutputTokens != 10 || u.EstimatedCost != 2*turnCost {
+		t.Errorf("unexpected user usage %+v", u)
+	}
+}
+
+func TestAdminPurgeUser(t *testing.T) {
+	captures := t.TempDir()
+	gooseSrv, proxySrv := setupProxyWith(t, &config.Config{AdminToken: testAdminToken, DebugCaptureDir: captures, GooseSessionPrefix: "adk:"}, defaultReplyEvents)
+	resp, err := http.Post(proxySrv.URL+"/apps/myapp/users/user1/sessions", "application/json", strings.NewReader(`{"state": {"user:lang": "go"}}`))
+	if err != nil {
+		t.Fatalf("POST create session: %v", err)
+	}
+	var created map[string]any
+	json.NewDecoder(resp.Body).Decode(&created)
+	resp.Body.Close()
+	sessionID := created["id"].(string)
+	resp = postRunSSE(t, proxySrv.URL, "myapp", "user1", sessionID, map[string]any{
+		"new_message": &genai.Content{Role: genai.RoleUser, Parts: []*genai.Part{
+			genai.NewPartFromText("read this"),
+			{InlineData: &genai.Blob{Data: []byte("a,b"), MIMEType: "text/csv", DisplayName: "data.csv"}},
+		}},
+	})
+	readSSEEvents(t, resp.Body)
+	resp.Body.Close()
+	otherID := createSession(t, proxySrv.URL, "myapp", "user2")
+	runSSE(t, proxySrv.URL, "myapp", "user2", otherID, "hi")
+	upload, _, _ := strings.Cut(strings.TrimPrefix(strings.Split(Calls[gooseclient.ReplyRequest](t, gooseSrv, "/reply")[0].UserMessage.Content[0].Text, "\n")[1], "- "), " (")
+
+	purge := func(query string) UserPurgeReport {
+		t.Helper()
+		resp := adminDo(t, http.MethodDelete, proxySrv.URL+"/admin/users/user1/data"+query, nil)
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected 200, got %d", resp.StatusCode)
+		}
+		var rep UserPurgeReport
+		json.NewDecoder(resp.Body).Decode(&rep)
+		return rep
+	}
+
+	rep := purge("?dryRun=true")
+	if !rep.DryRun || len(rep.Sessions) != 1 || rep.Sessions[0].Session != sessionID || !slices.Equal(rep.StateApps, []string{"myapp"}) || rep.UsageRows != 2 ||
+		rep.GooseSessions != 1 || rep.Captures != 1 || rep.Files != 1 {
+		t.Fatalf("unexpected dry run report %+v", rep)
+	}
+	if resp, _ := http.Get(fmt.Sprintf("%s/apps/myapp/users/user1/sessions/%s", proxySrv.URL, sessionID)); resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected a dry run to keep the session, got %d", resp.StatusCode)
+	}
+	if _, err := os.Stat(upload); err != nil {
+		t.Fatalf("expected a dry run to keep the upload: %v", err)
+	}
+
+	if rep := purge(""); rep.DryRun || len(rep.Sessions) != 1 || rep.UsageRows != 2 || rep.GooseSessions != 1 || rep.Captures != 1 || rep.Files != 1 {
+		t.Fatalf("unexpected purge report %+v", rep)
+	}
+	if resp, _ := http.Get(fmt.Sprintf("%s/apps/myapp/users/user1/sessions/%s", proxySrv.URL, sessionID)); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected the session deleted, got %d", resp.StatusCode)
+	}
+	gooseSrv.mu.Lock()
+	deleted := gooseSrv.lost["goose-session-1"]
+	gooseSrv.mu.Unlock()
+	if !deleted {
+		t.Error("expected the Goose session deleted")
+	}
+	if _, err := os.Stat(upload); !os.IsNotExist(err) {
+		t.Errorf("expected the upload deleted, got %v", err)
+	}
+	if entries, _ := os.ReadDir(captures); len(entries) != 1 {
+		t.Errorf("expected only the other user's capture kept, got %d", len(entries))
+	}
+	if resp, _ := http.Get(fmt.Sprintf("%s/apps/myapp/users/user2/sessions/%s", proxySrv.URL, otherID)); resp.StatusCode != http.StatusOK {
+		t.Errorf("expected other users' sessions kept, got %d", resp.StatusCode)
+	}
+	if rep := purge("?dryRun=true"); len(rep.Sessions) != 0 || len(rep.StateApps) != 0 || rep.UsageRows != 0 || rep.GooseSessions != 0 || rep.Captures != 0 || rep.Files != 0 {
+		t.Errorf("expected nothing left to purge, got %+v", rep)
+	}
+}
+
+func TestBudgetAlerts(t *testing.T) {
+	alerts := make(chan BudgetAlert, 10)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var alert BudgetAlert
+		json.NewDecoder(r.Body).Decode(&alert)
+		alerts <- alert
+	}))
+	t.Cleanup(hook.Close)
+
+	cfg := &config.Config{Budgets: []config.Budget{
+		{App: "myapp", Scope: config.BudgetScopeUser, MaxTokens: 40, Thresholds: []float64{0.5, 1}, Webhook: hook.URL},
+		{App: "otherapp", Scope: config.BudgetScopeApp, MaxTokens: 1, Thresholds: []float64{1}, Webhook: hook.URL},
+	}}
+	_, proxySrv := setupProxyWith(t, cfg, defaultReplyEvents)
+	sessionID := createSession(t, proxySrv.URL, "myapp", "user1")
+
+	// Each turn uses 15 tokens: the second crosses 20, the third 40.
+	runSSE(t, proxySrv.URL, "myapp", "user1", sessionID, "one")
+	select {
+	case alert := <-alerts:
+		t.Fatalf("unexpected alert after the first turn: %+v", alert)
+	case <-time.After(50 * time.Millisecond):
+	}
+	for _, want := range []float64{0.5, 1} {
+		runSSE(t, proxySrv.URL, "myapp", "user1", sessionID, "again")
+		select {
+		case alert := <-alerts:
+			if alert.Scope != "user" || alert.App != "myapp" || alert.User != "user1" || alert.Metric != "tokens" || alert.Threshold != want || alert.Limit != 40 {
+				t.Errorf("unexpected alert %+v", alert)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for the %v alert", want)
+		}
+	}
+}
+
+func TestLifecycleWebhooks(t *testing.T) {
+	webhookRetryDelay = time.Millisecond
+	t.Cleanup(func() { webhookRetryDelay = time.Second })
+
+	type delivery struct {
+		event LifecycleEvent
+		valid bool
+	}
+	deliveries := make(chan delivery, 10)
+	var attempts sync.Map
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var evt LifecycleEvent
+		json.Unmarshal(body, &evt)
+		// Fail each event's first delivery to exercise the retry.
+		if _, retried := attempts.LoadOrStore(evt.ID, true); !retried {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		valid := r.Header.Get("X-Webhook-Signature") == signWebhook("s3cret", body) && r.Header.Get("X-Webhook-Event") == evt.Type
+		deliveries <- delivery{evt, valid}
+	}))
+	t.Cleanup(hook.Close)
+
+	cfg := &config.Config{
+		Apps: map[string]config.AppConfig{
+			"myapp": {ToolPolicy: policy.ToolPolicy{Deny: []string{"developer__shell"}}},
+		},
+		Webhooks: []config.Webhook{{URL: hook.URL, Secret: "s3cret"}},
+	}
+	_, proxySrv := setupProxyWith(t, cfg, []string{
+		`{"type":"Message","message":{"role":"assistant","created":1,"content":[{"type":"toolRequest","id":"call-1","toolCall":{"name":"developer__shell","arguments":{"command":"rm -rf /"}}}]}}`,
+		`{"type":"Finish","reason":"stop"}`,
+	})
+	sessionID := createSession(t, proxySrv.URL, "myapp", "user1")
+	runSSE(t, proxySrv.URL, "myapp", "user1", sessionID, "clean up")
+
+	got := make(map[string]LifecycleEvent)
+	for range 3 {
+		select {
+		case d := <-deliveries:
+			if !d.valid {
+				t.Errorf("%s delivery has a bad signature or event header", d.event.Type)
+			}
+			got[d.event.Type] = d.event
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for webhooks, got %v", got)
+		}
+	}
+	for _, typ := range []string{"session.created", "tool.denied", "turn.completed"} {
+		if evt, ok := got[typ]; !ok || evt.App != "myapp" || evt.User != "user1" || evt.Session != sessionID {
+			t.Errorf("expected a %s event for the session, got %+v", typ, evt)
+		}
+	}
+	if tool := got["tool.denied"].Data["tool"]; tool != "developer__shell" {
+		t.Errorf("expected the denied tool's name, got %v", tool)
+	}
+}
+
+// recordingPublisher is an event sink publisher that keeps what it is sent.
+type recordingPublisher struct {
+	msgs chan map[string]any
+}
+
+func (p *recordingPublisher) Publish(key string, data []byte) error {
+	var msg map[string]any
+	json.Unmarshal(data, &msg)
+	msg["_key"] = key
+	p.msgs <- msg
+	return nil
+}
+
+func (p *recordingPublisher) Close() error { return nil }
+
+func TestRunSSE_MirrorsEventsToSink(t *testing.T) {
+	gooseSrv := newMockGooseServer(t, defaultReplyEvents)
+	client := gooseclient.New(gooseSrv.URL, "")
+	h := NewHandler(NewSessionManager(client, t.TempDir()), client, &config.Config{EventSinkFormat: config.EventSinkEnvelope})
+	pub := &recordingPublisher{msgs: make(chan map[string]any, 10)}
+	h.UseEventSink(pub)
+	proxySrv := httptest.NewServer(h)
+	t.Cleanup(proxySrv.Close)
+
+	sessionID := createSession(t, proxySrv.URL, "myapp", "user1")
+	sent := runSSE(t, proxySrv.URL, "myapp", "user1", sessionID, "hi")
+
+	for i, want := range sent {
+		select {
+		case msg := <-pub.msgs:
+			evt, _ := msg["event"].(map[string]any)
+			if msg["app"] != "myapp" || msg["user"] != "user1" || msg["session"] != sessionID || msg["_key"] != "myapp/user1/"+sessionID {
+				t.Errorf("message %d: unexpected envelope %+v", i, msg)
+			}
+			if evt["id"] != want["id"] {
+				t.Errorf("message %d: expected event %v, got %+v", i, want["id"], evt)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for event %d", i)
+		}
+	}
+}
+
+func TestExportSession(t *testing.T) {
+	_, proxySrv := setupProxyWith(t, &config.Config{}, []string{
+		`{"type":"Message","message":{"role":"assistant","created":1,"content":[{"type":"toolRequest","id":"call-1","toolCall":{"name":"developer__shell","arguments":{"command":"ls"}}}]}}`,
+		`{"type":"Message","message":{"role":"user","created":2,"content":[{"type":"toolResponse","id":"call-1","toolResult":{"content":[{"type":"text","text":"main.go"}]}}]}}`,
+		`{"type":"Message","message":{"role":"assistant","created":3,"content":[{"type":"text","text":"There is one Go file."}]}}`,
+		`{"type":"Finish","reason":"stop"}`,
+	})
+	sessionID := createSession(t, proxySrv.URL, "myapp", "user1")
+	runSSE(t, proxySrv.URL, "myapp", "user1", sessionID, "what files are here?")
+	base := fmt.Sprintf("%s/apps/myapp/users/user1/sessions/%s/export", proxySrv.URL, sessionID)
+
+	resp, err := http.Get(base)
+	if err != nil {
+		t.Fatalf("GET export: %v", err)
+	}
+	var exp SessionExport
+	json.NewDecoder(resp.Body).Decode(&exp)
+	resp.Body.Close()
+	if exp.Version != 1 || exp.Session != sessionID || len(exp.Events) < 4 {
+		t.Fatalf("expected the session's events in the JSON export, got %+v", exp)
+	}
+
+	resp, err = http.Get(base + "?format=markdown")
+	if err != nil {
+		t.Fatalf("GET export: %v", err)
+	}
+	md, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/markdown") {
+		t.Errorf("expected a Markdown document, got %s", ct)
+	}
+	for _, want := range []string{"## user", "what files are here?", "**Tool call** `developer__shell`", `"command": "ls"`, "**Tool result** `call-1`", "main.go", "There is one Go file."} {
+		if !strings.Contains(string(md), want) {
+			t.Errorf("expected %q in the Markdown export:\n%s", want, md)
+		}
+	}
+
+	resp, err = http.Get(base + "?format=pdf")
+	if err != nil {
+		t.Fatalf("GET export: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400 for an unknown format, got %d", resp.StatusCode)
+	}
+}
+
+func TestCreateSession_ImportsTranscript(t *testing.T) {
+	gooseSrv, proxySrv := setupProxy(t)
+	srcID := createSession(t, proxySrv.URL, "myapp", "user1")
+	runSSE(t, proxySrv.URL, "myapp", "user1", srcID, "remember the number 42")
+
+	resp, err := http.Get(fmt.Sprintf("%s/apps/myapp/users/user1/sessions/%s/export", proxySrv.URL, srcID))
+	if err != nil {
+		t.Fatalf("GET export: %v", err)
+	}
+	var exp map[string]any
+	json.NewDecoder(resp.Body).Decode(&exp)
+	resp.Body.Close()
+	// System content from another ADK runtime belongs in the system prompt.
+	system := map[string]any{"id": "evt-system", "author": "user", "content": map[string]any{"role": "system", "parts": []any{map[string]any{"text": "Answer tersely."}}}}
+	exp["events"] = append([]any{system}, exp["events"].([]any)...)
+
+	body, _ := json.Marshal(map[string]any{"transcript": exp})
+	resp, err = http.Post(proxySrv.URL+"/apps/myapp/users/user2/sessions/imported", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("POST create session: %v", err)
+	}
+	var sess map[string]any
+	json.NewDecoder(resp.Body).Decode(&sess)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || sess["id"] != "imported" {
+		t.Fatalf("expected the imported session, got %d %+v", resp.StatusCode, sess)
+	}
+
+	// The first turn carries the imported conversation to Goose.
+	runSSE(t, proxySrv.URL, "myapp", "user2", "imported", "what number?")
+	replies := Calls[gooseclient.ReplyRequest](t, gooseSrv, "/reply")
+	last := replies[len(replies)-1]
+	if len(last.ConversationSoFar) != 2 || last.ConversationSoFar[0].Role != "user" || last.ConversationSoFar[1].Role != "assistant" {
+		t.Fatalf("expected the imported user and assistant messages, got %+v", last.ConversationSoFar)
+	}
+	if text := last.ConversationSoFar[0].Content[0].Text; text != "remember the number 42" {
+		t.Errorf("expected the imported prompt, got %q", text)
+	}
+	prompts := Calls[gooseclient.ExtendPromptRequest](t, gooseSrv, "/agent/prompt")
+	if len(prompts) != 1 || prompts[0].Extension != "Answer tersely." || prompts[0].SessionID != last.SessionID {
+		t.Errorf("expected the system content added to the system prompt, got %+v", prompts)
+	}
+
+	resp, err = http.Post(proxySrv.URL+"/apps/myapp/users/user2/sessions/other", "application/json", strings.NewReader(`{"transcript": {"version": 99}}`))
+	if err != nil {
+		t.Fatalf("POST create session: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400 for an unknown transcript version, got %d", resp.StatusCode)
+	}
+}
+
+func TestRetention(t *testing.T) {
+	gooseSrv := newMockGooseServer(t, defaultReplyEvents)
+	client := gooseclient.New(gooseSrv.URL, "")
+	captures := t.TempDir()
+	cfg := &config.Config{
+		DebugCaptureDir: captures,
+		Retention:       config.Retention{SessionMaxAge: time.Hour, SessionMaxCount: 2, ArtifactMaxVersions: 1, DebugCaptureMaxCount: 1},
+	}
+	h := NewHandler(NewSessionManager(client, t.TempDir()), client, cfg)
+	proxySrv := httptest.NewServer(h)
+	t.Cleanup(proxySrv.Close)
+
+	var ids []string
+	for range 3 {
+		ids = append(ids, createSession(t, proxySrv.URL, "myapp", "user1"))
+		time.Sleep(time.Millisecond)
+	}
+	key := SessionKey{App: "myapp", User: "user1", ID: ids[2]}
+	h.artifacts.saveData(key.String(), "out.txt", []byte("v0"))
+	h.artifacts.saveData(key.String(), "out.txt", []byte("v1"))
+	for _, name := range []string{"inv_1", "inv_2"} {
+		os.Mkdir(filepath.Join(captures, name), 0o700)
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// The least recently used session is beyond the count.
+	h.enforceRetention(context.Background(), time.Now())
+	if sessions := h.sessions.ListSessions("myapp", "user1", nil); len(sessions) != 2 || sessions[0].ID != ids[1] {
+		t.Fatalf("expected the two newest sessions kept, got %+v", sessions)
+	}
+	if versions, _ := h.artifacts.versions(key.String(), "out.txt"); !slices.Equal(versions, []int{1}) {
+		t.Errorf("expected only the newest artifact version kept, got %v", versions)
+	}
+	if entries, _ := os.ReadDir(captures); len(entries) != 1 || entries[0].Name() != "inv_2" {
+		t.Errorf("expected only the newest capture kept, got %v", entries)
+	}
+
+	// Two hours later every session has been idle too long.
+	h.enforceRetention(context.Background(), time.Now().Add(2*time.Hour))
+	if sessions := h.sessions.ListSessions("", "", nil); len(sessions) != 0 {
+		t.Errorf("expected idle sessions deleted, got %+v", sessions)
+	}
+}
+
+func TestErrorReporting(t *testing.T) {
+	reports := make(chan map[string]any, 10)
+	tracker := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var evt map[string]any
+		json.NewDecoder(r.Body).Decode(&evt)
+		reports <- evt
+	}))
+	t.Cleanup(tracker.Close)
+	reporter, err := sentry.New(strings.Replace(tracker.URL, "://", "://key@", 1)+"/1", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Goose is down.
+	gooseSrv := httptest.NewServer(http.NotFoundHandler())
+	gooseSrv.Close()
+	client := gooseclient.New(gooseSrv.URL, "")
+	h := NewHandler(NewSessionManager(client, t.TempDir()), client, &config.Config{})
+	h.UseErrorReporter(reporter)
+	h.mux.HandleFunc("GET /panic", func(http.ResponseWriter, *http.Request) { panic("boom") })
+	proxySrv := httptest.NewServer(h)
+	proxySrv.Config.ErrorLog = log.New(io.Discard, "", 0)
+	t.Cleanup(proxySrv.Close)
+
+	for range backendErrorStreak {
+		postRunSSE(t, proxySrv.URL, "myapp", "user1", "s1", map[string]any{
+			"new_message": genai.NewContentFromText("hi", genai.RoleUser),
+		}).Body.Close()
+	}
+	select {
+	case evt := <-reports:
+		if tags := evt["tags"].(map[string]any); tags["app"] != "myapp" || tags["session"] != "s1" || tags["invocation"] == nil {
+			t.Errorf("expected session and invocation tags, got %+v", tags)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected a repeated backend error report")
+	}
+	postRunSSE(t, proxySrv.URL, "myapp", "user1", "s1", map[string]any{
+		"new_message": genai.NewContentFromText("hi", genai.RoleUser),
+	}).Body.Close()
+	select {
+	case evt := <-reports:
+		t.Errorf("expected one report per streak, got %+v", evt)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	if resp, err := http.Get(proxySrv.URL + "/panic"); err == nil {
+		resp.Body.Close()
+	}
+	select {
+	case evt := <-reports:
+		if evt["level"] != "fatal" || evt["tags"].(map[string]any)["route"] != "GET /panic" {
+			t.Errorf("unexpected panic report %+v", evt)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected a panic report")
+	}
+}
+
+func TestOpenAPI(t *testing.T) {
+	_, proxySrv := setupProxy(t)
+	resp, err := http.Get(proxySrv.URL + "/openapi.json")
+	if err != nil {
+		t.Fatalf("GET openapi.json: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	var spec struct {
+		Paths      map[string]map[string]map[string]any `json:"paths"`
+		Components struct {
+			Schemas map[string]any `json:"schemas"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal(body, &spec); err != nil {
+		t.Fatalf("decode spec: %v", err)
+	}
+
+	h := NewHandler(NewSessionManager(nil, t.TempDir()), nil, &config.Config{})
+	for _, rt := range h.routes {
+		method, path, _ := strings.Cut(rt.pattern, " ")
+		op := spec.Paths[path][strings.ToLower(method)]
+		if op == nil || op["summary"] == "" {
+			t.Errorf("route %s is not documented", rt.pattern)
+		}
+	}
+
+	run := spec.Paths["/apps/{app}/users/{user}/sessions/{session}/run_sse"]["post"]
+	schema := run["requestBody"].(map[string]any)["content"].(map[string]any)["application/json"].(map[string]any)["schema"]
+	if schema.(map[string]any)["$ref"] != "#/components/schemas/RunSSERequest" {
+		t.Errorf("expected the run_sse body to reference RunSSERequest, got %v", schema)
+	}
+	for _, ref := range regexp.MustCompile(`"#/components/schemas/([^"]+)"`).FindAllStringSubmatch(string(body), -1) {
+		if spec.Components.Schemas[ref[1]] == nil {
+			t.Errorf("unresolved schema reference %s", ref[1])
+		}
+	}
+}
+
+func TestWorkingDirIsolation(t *testing.T) {
+	cfg := &config.Config{WorkingDirIsolation: config.WorkingDirIsolationSession}
+	gooseSrv, proxySrv := setupProxyWith(t, cfg, nil)
+
+	aliceID := createSession(t, proxySrv.URL, "myapp", "alice")
+	createSession(t, proxySrv.URL, "myapp", "..%2Falice")
+
+	starts := Calls[gooseclient.StartAgentRequest](t, gooseSrv, "/agent/start")
+	if len(starts) != 2 {
+		t.Fatalf("expected 2 agent starts, got %d", len(starts))
+	}
+	aliceDir, otherDir := starts[0].WorkingDir, starts[1].WorkingDir
+	if want := filepath.Join(workDirsDir, "myapp", "alice", aliceID); !strings.HasSuffix(aliceDir, want) {
+		t.Fatalf("expected alice's agent in .../%s, got %s", want, aliceDir)
+	}
+	root := strings.TrimSuffix(aliceDir, filepath.Join(workDirsDir, "myapp", "alice", aliceID))
+	if rel, err := filepath.Rel(filepath.Join(root, workDirsDir, "myapp"), otherDir); err != nil || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		t.Fatalf("expected the \"../alice\" user's agent inside the app's directory, got %s", otherDir)
+	}
+	if otherDir == aliceDir || strings.HasPrefix(otherDir, aliceDir+string(filepath.Separator)) {
+		t.Fatalf("expected the \"../alice\" user kept out of alice's directory, got %s", otherDir)
+	}
+	info, err := os.Stat(aliceDir)
+	if err != nil {
+		t.Fatalf("stat working dir: %v", err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o700 {
+		t.Fatalf("expected working dir mode 0700, got %v", perm)
+	}
+
+	req, _ := http.NewRequest(http.MethodDelete, fmt.Sprintf("%s/apps/myapp/users/alice/sessions/%s", proxySrv.URL, aliceID), nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("DELETE session: %v", err)
+	}
+	resp.Body.Close()
+	if _, err := os.Stat(aliceDir); !os.IsNotExist(err) {
+		t.Fatalf("expected the session's working dir removed with it, got %v", err)
+	}
+}
+
+func TestWriteUpload_RejectsSymlinkEscape(t *testing.T) {
+	root := t.TempDir()
+	outside := t.TempDir()
+
+	// An agent that links the uploads folder elsewhere cannot redirect
+	// uploads there.
+	if err := os.Symlink(outside, filepath.Join(root, uploadsDir)); err != nil {
+		t.Fatalf("symlink: %v", err)
+	}
+	if _, err := writeUpload(root, "", "notes.txt", "text/plain", []byte("hi")); !errors.Is(err, policy.ErrPathEscape) {
+		t.Fatalf("expected upload through a symlink rejected, got %v", err)
+	}
+	if entries, _ := os.ReadDir(outside); len(entries) != 0 {
+		t.Fatalf("expected nothing written outside the root, got %v", entries)
+	}
+}
+
+func TestVersion(t *testing.T) {
+	_, proxySrv := setupProxy(t)
+	resp, err := http.Get(proxySrv.URL + "/version")
+	if err != nil {
+		t.Fatalf("GET /version: %v", err)
+	}
+	defer resp.Body.Close()
+	var v VersionInfo
+	if err := json.NewDecoder(resp.Body).Decode(&v); err != nil {
+		t.Fatalf("decode version: %v", err)
+	}
+	if v.Version == "" || v.GoVersion == "" {
+		t.Errorf("expected the proxy's version and Go version, got %+v", v.Info)
+	}
+	if v.ADKAPILevel != ADKAPILevel {
+		t.Errorf("expected ADK API level %d, got %d", ADKAPILevel, v.ADKAPILevel)
+	}
+	if v.Goose.Version != "1.9.0" || v.Goose.Error != "" {
+		t.Errorf("expected Goose version 1.9.0, got %+v", v.Goose)
+	}
+	if on, ok := v.Features[features.ToolBridge]; !ok || !on {
+		t.Errorf("expected the default feature flags, got %v", v.Features)
+	}
+}
+
+func TestFeatureFlags(t *testing.T) {
+	cfg := &config.Config{Features: features.Set{
+		features.PartialStreaming:        false,
+		features.StructuredToolResponses: false,
+		features.ToolBridge:              false,
+	}}
+	mock, proxySrv := setupProxyWith(t, cfg, []string{
+		`{"type":"Message","message":{"id":"msg-1","role":"assistant","created":1,"content":[{"type":"toolRequest","id":"call-1","toolCall":{"name":"git__status","arguments_delta":"{\"pa"}}]}}`,
+		`{"type":"Message","message":{"id":"msg-1","role":"assistant","created":1,"content":[{"type":"toolRequest","id":"call-1","toolCall":{"name":"git__status","arguments":{"path":"."}}}]}}`,
+		`{"type":"Message","message":{"role":"user","created":2,"content":[{"type":"toolResponse","id":"call-1","toolResult":{"content":[{"type":"text","text":"clean"}],"structured_content":{"clean":true}}}]}}`,
+		`{"type":"Finish","reason":"stop"}`,
+	})
+	sessionID := createSession(t, proxySrv.URL, "myapp", "user1")
+
+	events := runSSE(t, proxySrv.URL, "myapp", "user1", sessionID, "status?")
+	if len(events) != 3 {
+		t.Fatalf("expected the complete call, its result, and finish without partial pieces, got %d: %+v", len(events), events)
+	}
+	fr := events[1]["content"].(map[string]any)["parts"].([]any)[0].(map[string]any)["functionResponse"].(map[string]any)
+	if got := fmt.Sprint(fr["response"]); got != "map[result:clean]" {
+		t.Errorf("expected the result's text rather than its structured content, got %s", got)
+	}
+
+	mock.delay = 100 * time.Millisecond
+	running := postRunSSE(t, proxySrv.URL, "myapp", "user1", sessionID, map[string]any{
+		"new_message": genai.NewContentFromText("again", genai.RoleUser),
+	})
+	defer running.Body.Close()
+	bufio.NewReader(running.Body).ReadString('\n')
+	resp := postRunSSE(t, proxySrv.URL, "myapp", "user1", sessionID, map[string]any{
+		"new_message": &genai.Content{Role: genai.RoleUser, Parts: []*genai.Part{
+			{FunctionResponse: &genai.FunctionResponse{ID: "call-7", Name: "deploy", Response: map[string]any{"status": "done"}}},
+		}},
+	})
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected a tool result to be refused with the tool bridge off, got %d", resp.StatusCode)
+	}
+	if results := Calls[gooseclient.ToolResultRequest](t, mock, "/tool_result"); len(results) != 0 {
+		t.Errorf("expected no tool result delivered to Goose, got %+v", results)
+	}
+}
@@ -0,0 +1,100 @@
+package proxy
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/innomon/adk2goose/gooseclient"
+	"github.com/innomon/adk2goose/internal/config"
+)
+
+// RunHealthChecks checks now and every SessionHealthInterval until ctx is
+// done that Goose still has the sessions the proxy maps, recovering those
+// it lost. It returns at once if the interval is not set.
+func (h *Handler) RunHealthChecks(ctx context.Context) {
+	if h.cfg.SessionHealthInterval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(h.cfg.SessionHealthInterval)
+	defer ticker.Stop()
+	for {
+		h.checkSessions(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// checkSessions recovers the mapped sessions whose root Goose session is
+// gone. Sessions with a turn in progress are left for the next check.
+func (h *Handler) checkSessions(ctx context.Context) {
+	// Sessions are listed before asking Goose, so none of them can be too
+	// new to appear in its listing.
+	sessions := h.sessions.ListSessions("", "", nil)
+	listed, err := h.client.ListSessions(ctx)
+	if err != nil {
+		log.Printf("session health check: list goose sessions: %v", err)
+		return
+	}
+	live := make(map[string]bool, len(listed.Sessions))
+	for _, s := range listed.Sessions {
+		live[s.ID] = true
+	}
+
+	for _, sess := range sessions {
+		if ctx.Err() != nil {
+			return
+		}
+		if live[sess.GooseID] {
+			sessionHealth.Inc("ok")
+			continue
+		}
+		if !h.turns.tryAcquire(sess.GooseID) {
+			continue
+		}
+		h.checkSession(ctx, sess)
+		h.turns.release(sess.GooseID)
+	}
+}
+
+// checkSession confirms that a session Goose did not list is gone, and
+// recovers it if so. The session's turn lock must be held.
+func (h *Handler) checkSession(ctx context.Context, sess *Session) {
+	key := sess.Key()
+	_, err := h.client.GetSession(ctx, sess.GooseID)
+	if err == nil {
+		sessionHealth.Inc("ok")
+		return
+	}
+	if !gooseclient.IsNotFound(err) {
+		log.Printf("session %s: health check: %v", key, err)
+		return
+	}
+
+	recovery, gooseSessionID, history, err := h.sessions.Recover(ctx, key, sess.GooseID)
+	if err == nil && recovery == RecoveryRecreated {
+		err = h.applySystemHistory(ctx, gooseSessionID, history)
+	}
+	if err != nil {
+		log.Printf("session %s: goose session %s lost and not recovered: %v", key, sess.GooseID, err)
+		sessionHealth.Inc("failed")
+		h.publishLifecycle(config.WebhookSessionLost, key, map[string]any{
+			"gooseSessionId": sess.GooseID,
+			"error":          err.Error(),
+		})
+		return
+	}
+	if recovery == "" {
+		return
+	}
+	log.Printf("session %s: goose session %s lost, %s as %s", key, sess.GooseID, recovery, gooseSessionID)
+	sessionHealth.Inc(recovery)
+	h.publishLifecycle(config.WebhookSessionRecovered, key, map[string]any{
+		"recovery":           recovery,
+		"lostGooseSessionId": sess.GooseID,
+		"gooseSessionId":     gooseSessionID,
+	})
+}
@@ -0,0 +1,120 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/innomon/adk2goose/gooseclient"
+	"github.com/innomon/adk2goose/translator"
+)
+
+func (h *Handler) handleGetSession(w http.ResponseWriter, r *http.Request) {
+	key := sessionKey(r)
+	sess, ok := h.sessions.Get(key)
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("%v: %s", ErrSessionNotFound, key))
+		return
+	}
+	events, err := h.sessionHistory(r.Context(), sess)
+	if errors.Is(err, ErrSessionNotFound) {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusBadGateway, fmt.Sprintf("get session: %v", err))
+		return
+	}
+
+	resp := sessionResponse(sess)
+	resp["events"] = events
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// sessionHistory returns the session's events from its event log or, for
+// sessions that have none logged, as translated from the Goose transcript.
+func (h *Handler) sessionHistory(ctx context.Context, sess *Session) ([]*translator.ADKEvent, error) {
+	key := sess.Key()
+	events, err := h.sessions.Events(key)
+	if err != nil || len(events) > 0 {
+		return uniqueEvents(events), err
+	}
+	sess, transcript, err := h.sessions.Transcript(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return sessionEvents(transcript, sess.Interruptions, h.cfg.App(key.App).EventAuthor(key.App)), nil
+}
+
+// sessionEvents renders a Goose transcript as ADK events, with an
+// interrupted event for each incomplete turn placed after the messages that
+// preceded it.
+func sessionEvents(transcript []gooseclient.GooseMessage, interruptions []Interruption, author string) []*translator.ADKEvent {
+	events := make([]*translator.ADKEvent, 0, len(transcript)+len(interruptions))
+	pending := interruptions
+	flush := func(before int64) {
+		for len(pending) > 0 && pending[0].At.Unix() < before {
+			events = append(events, interruptedEvent(pending[0]))
+			pending = pending[1:]
+		}
+	}
+
+	for i, msg := range transcript {
+		flush(msg.Created)
+		evt := &translator.ADKEvent{
+			ID:      msg.ID,
+			Time:    msg.Created,
+			Author:  author,
+			Content: translator.GooseMessageToADKContent(&msg),
+		}
+		if evt.ID == "" {
+			evt.ID = fmt.Sprintf("msg_%d", i)
+		} else {
+			evt.CustomMetadata = map[string]any{translator.GooseMessageIDMetadataKey: msg.ID}
+		}
+		if isUserTurn(msg) {
+			evt.Author = "user"
+		}
+		events = append(events, evt)
+	}
+	for _, in := range pending {
+		events = append(events, interruptedEvent(in))
+	}
+	return events
+}
+
+// uniqueEvents drops events whose ID an earlier event has, as when a
+// retried turn logged the same Goose messages again.
+func uniqueEvents(events []*translator.ADKEvent) []*translator.ADKEvent {
+	seen := make(map[string]struct{}, len(events))
+	return slices.DeleteFunc(events, func(evt *translator.ADKEvent) bool {
+		if evt.ID == "" {
+			return false
+		}
+		if _, ok := seen[evt.ID]; ok {
+			return true
+		}
+		seen[evt.ID] = struct{}{}
+		return false
+	})
+}
+
+func interruptedEvent(in Interruption) *translator.ADKEvent {
+	return &translator.ADKEvent{
+		ID:           "int_" + in.InvocationID,
+		Time:         in.At.Unix(),
+		InvocationID: in.InvocationID,
+		Author:       in.Author,
+		Content:      in.Content,
+		Interrupted:  true,
+		CustomMetadata: map[string]any{
+			interruptionReasonMetadataKey: in.Reason,
+		},
+	}
+}
+
+// interruptionReasonMetadataKey is the customMetadata key explaining why an
+// interrupted history event's turn ended early.
+const interruptionReasonMetadataKey = "goose:interruptionReason"
@@ -0,0 +1,163 @@
+package proxy
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"log"
+
+	_ "image/gif" // register the GIF decoder
+
+	"github.com/innomon/adk2goose/internal/config"
+	"google.golang.org/genai"
+)
+
+// processImages returns content with its inlineData images downscaled and
+// re-encoded according to cfg. Images the standard library cannot decode are
+// forwarded unchanged. content itself is not modified; when no image changes
+// it is returned as is.
+func processImages(content *genai.Content, cfg config.ImageConfig) *genai.Content {
+	if !cfg.Enabled() {
+		return content
+	}
+
+	var out *genai.Content
+	for i, part := range content.Parts {
+		if part == nil || part.InlineData == nil {
+			continue
+		}
+		blob, err := processImage(part.InlineData, cfg)
+		if err != nil {
+			log.Printf("image processing: %v", err)
+			continue
+		}
+		if blob == part.InlineData {
+			continue
+		}
+		if out == nil {
+			out = &genai.Content{Role: content.Role, Parts: append([]*genai.Part(nil), content.Parts...)}
+		}
+		p := *part
+		p.InlineData = blob
+		out.Parts[i] = &p
+		processedImages.Inc()
+	}
+	if out == nil {
+		return content
+	}
+	return out
+}
+
+// processImage applies cfg to one image, returning blob itself when the
+// image is left as it is.
+func processImage(blob *genai.Blob, cfg config.ImageConfig) (*genai.Blob, error) {
+	switch blob.MIMEType {
+	case "image/png", "image/jpeg", "image/gif":
+	default:
+		return blob, nil
+	}
+	src, _, err := image.Decode(bytes.NewReader(blob.Data))
+	if err != nil {
+		return nil, fmt.Errorf("decode %s: %w", blob.MIMEType, err)
+	}
+
+	img := src
+	w, h := fitWithin(src.Bounds().Dx(), src.Bounds().Dy(), cfg.MaxWidth, cfg.MaxHeight)
+	resized := w != src.Bounds().Dx() || h != src.Bounds().Dy()
+	if resized {
+		img = downscale(src, w, h)
+	}
+
+	var buf bytes.Buffer
+	mimeType := blob.MIMEType
+	switch {
+	case cfg.JPEGQuality > 0:
+		if err := jpeg.Encode(&buf, flatten(img), &jpeg.Options{Quality: cfg.JPEGQuality}); err != nil {
+			return nil, fmt.Errorf("encode jpeg: %w", err)
+		}
+		mimeType = "image/jpeg"
+		if !resized && buf.Len() >= len(blob.Data) {
+			return blob, nil
+		}
+	case resized && blob.MIMEType == "image/jpeg":
+		if err := jpeg.Encode(&buf, img, nil); err != nil {
+			return nil, fmt.Errorf("encode jpeg: %w", err)
+		}
+	case resized:
+		if err := png.Encode(&buf, img); err != nil {
+			return nil, fmt.Errorf("encode png: %w", err)
+		}
+		mimeType = "image/png"
+	default:
+		return blob, nil
+	}
+
+	return &genai.Blob{Data: buf.Bytes(), MIMEType: mimeType, DisplayName: blob.DisplayName}, nil
+}
+
+// fitWithin scales w×h down to fit maxW×maxH, keeping the aspect ratio. A
+// zero bound is unlimited.
+func fitWithin(w, h, maxW, maxH int) (int, int) {
+	scale := 1.0
+	if maxW > 0 && w > maxW {
+		scale = float64(maxW) / float64(w)
+	}
+	if maxH > 0 && h > maxH {
+		scale = min(scale, float64(maxH)/float64(h))
+	}
+	if scale == 1 {
+		return w, h
+	}
+	return max(1, int(float64(w)*scale)), max(1, int(float64(h)*scale))
+}
+
+// downscale resizes src to w×h by averaging the source pixels that fall in
+// each destination pixel, which keeps text in screenshots legible.
+func downscale(src image.Image, w, h int) *image.RGBA {
+	b := src.Bounds()
+	in := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(in, in.Bounds(), src, b.Min, draw.Src)
+
+	out := image.NewRGBA(image.Rect(0, 0, w, h))
+	sw, sh := b.Dx(), b.Dy()
+	for y := 0; y < h; y++ {
+		y0, y1 := y*sh/h, max((y+1)*sh/h, y*sh/h+1)
+		for x := 0; x < w; x++ {
+			x0, x1 := x*sw/w, max((x+1)*sw/w, x*sw/w+1)
+			var r, g, bl, a, n int
+			for sy := y0; sy < y1; sy++ {
+				row := in.Pix[sy*in.Stride:]
+				for sx := x0; sx < x1; sx++ {
+					p := row[sx*4 : sx*4+4]
+					r += int(p[0])
+					g += int(p[1])
+					bl += int(p[2])
+					a += int(p[3])
+					n++
+				}
+			}
+			i := out.PixOffset(x, y)
+			out.Pix[i] = uint8(r / n)
+			out.Pix[i+1] = uint8(g / n)
+			out.Pix[i+2] = uint8(bl / n)
+			out.Pix[i+3] = uint8(a / n)
+		}
+	}
+	return out
+}
+
+// flatten composites img over white, since JPEG has no alpha channel.
+func flatten(img image.Image) image.Image {
+	if o, ok := img.(interface{ Opaque() bool }); ok && o.Opaque() {
+		return img
+	}
+	b := img.Bounds()
+	out := image.NewRGBA(b)
+	draw.Draw(out, b, &image.Uniform{C: color.White}, image.Point{}, draw.Src)
+	draw.Draw(out, b, img, b.Min, draw.Over)
+	return out
+}
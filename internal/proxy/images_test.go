@@ -0,0 +1,87 @@
+package proxy
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"math/rand/v2"
+	"testing"
+
+	"github.com/innomon/adk2goose/internal/config"
+	"google.golang.org/genai"
+)
+
+// testPNG encodes a w×h PNG of noise, which PNG cannot compress well.
+func testPNG(t *testing.T, w, h int) []byte {
+	t.Helper()
+	rng := rand.New(rand.NewPCG(1, 2))
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.NRGBA{R: uint8(rng.Uint32()), G: uint8(rng.Uint32()), B: uint8(rng.Uint32()), A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("encode png: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestProcessImages(t *testing.T) {
+	large := testPNG(t, 400, 200)
+
+	tests := []struct {
+		name     string
+		cfg      config.ImageConfig
+		data     []byte
+		mimeType string
+		wantMIME string
+		wantW    int
+		wantH    int
+		same     bool
+	}{
+		{name: "disabled", data: large, mimeType: "image/png", same: true},
+		{name: "within limits", cfg: config.ImageConfig{MaxWidth: 800}, data: large, mimeType: "image/png", same: true},
+		{name: "downscaled", cfg: config.ImageConfig{MaxWidth: 100, MaxHeight: 100}, data: large, mimeType: "image/png",
+			wantMIME: "image/png", wantW: 100, wantH: 50},
+		{name: "height bound", cfg: config.ImageConfig{MaxHeight: 50}, data: large, mimeType: "image/png",
+			wantMIME: "image/png", wantW: 100, wantH: 50},
+		{name: "jpeg re-encode", cfg: config.ImageConfig{JPEGQuality: 60}, data: large, mimeType: "image/png",
+			wantMIME: "image/jpeg", wantW: 400, wantH: 200},
+		{name: "undecodable type", cfg: config.ImageConfig{MaxWidth: 10}, data: []byte("RIFF"), mimeType: "image/webp", same: true},
+		{name: "not an image", cfg: config.ImageConfig{MaxWidth: 10}, data: []byte("a,b\n"), mimeType: "text/csv", same: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			in := &genai.Content{Role: genai.RoleUser, Parts: []*genai.Part{
+				genai.NewPartFromText("look"),
+				genai.NewPartFromBytes(tt.data, tt.mimeType),
+			}}
+			out := processImages(in, tt.cfg)
+			if tt.same {
+				if out != in {
+					t.Fatalf("expected content unchanged")
+				}
+				return
+			}
+			if out == in || in.Parts[1].InlineData.MIMEType != tt.mimeType {
+				t.Fatalf("expected a modified copy, leaving the input intact")
+			}
+
+			blob := out.Parts[1].InlineData
+			if blob.MIMEType != tt.wantMIME {
+				t.Errorf("MIME type = %s, want %s", blob.MIMEType, tt.wantMIME)
+			}
+			cfg, _, err := image.DecodeConfig(bytes.NewReader(blob.Data))
+			if err != nil {
+				t.Fatalf("decode result: %v", err)
+			}
+			if cfg.Width != tt.wantW || cfg.Height != tt.wantH {
+				t.Errorf("size = %dx%d, want %dx%d", cfg.Width, cfg.Height, tt.wantW, tt.wantH)
+			}
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package proxy
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/innomon/adk2goose/internal/policy"
+	"google.golang.org/genai"
+)
+
+// inlineDataDir is where offloaded inline data is written, relative to the
+// Goose working directory.
+const inlineDataDir = ".adk2goose/inline"
+
+// inlineDataExtensions gives file extensions for common inline MIME types.
+var inlineDataExtensions = map[string]string{
+	"image/png":        ".png",
+	"image/jpeg":       ".jpg",
+	"image/gif":        ".gif",
+	"image/webp":       ".webp",
+	"application/pdf":  ".pdf",
+	"application/json": ".json",
+	"text/plain":       ".txt",
+	"text/csv":         ".csv",
+}
+
+// offloadInlineData returns content with every inlineData part larger than
+// limit written to a file under root, in the subfolder sub of the inline data
+// folder if not empty, and replaced by a text part telling
+// Goose where the file is. Files are named by content hash, so resending the
+// same data reuses the file. content itself is not modified; when nothing is
+// offloaded it is returned as is.
+func offloadInlineData(content *genai.Content, root, sub string, limit int) (*genai.Content, error) {
+	if limit <= 0 {
+		return content, nil
+	}
+
+	var out *genai.Content
+	for i, part := range content.Parts {
+		if part == nil || part.InlineData == nil || len(part.InlineData.Data) <= limit {
+			continue
+		}
+		path, err := writeInlineData(root, sub, part.InlineData)
+		if err != nil {
+			return nil, err
+		}
+		if out == nil {
+			out = &genai.Content{Role: content.Role, Parts: append([]*genai.Part(nil), content.Parts...)}
+		}
+		out.Parts[i] = genai.NewPartFromText(inlineDataReference(part.InlineData, path))
+		offloadedInlineData.Inc()
+	}
+	if out == nil {
+		return content, nil
+	}
+	return out, nil
+}
+
+// writeInlineData stores blob under root, in the subfolder sub of the
+// inline data folder, and returns its absolute path,
+// refusing to write through symlinks that lead out of root.
+func writeInlineData(root, sub string, blob *genai.Blob) (string, error) {
+	dir, err := filepath.Abs(filepath.Join(root, inlineDataDir, sub))
+	if err != nil {
+		return "", fmt.Errorf("offload inline data: %w", err)
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", fmt.Errorf("offload inline data: %w", err)
+	}
+	if dir, err = policy.ResolveWithin(root, dir); err != nil {
+		return "", fmt.Errorf("offload inline data: %w", err)
+	}
+
+	sum := sha256.Sum256(blob.Data)
+	ext, ok := inlineDataExtensions[blob.MIMEType]
+	if !ok {
+		ext = ".bin"
+	}
+	path := filepath.Join(dir, hex.EncodeToString(sum[:16])+ext)
+	if _, err := policy.ResolveWithin(dir, path); err != nil {
+		return "", fmt.Errorf("offload inline data: %w", err)
+	}
+	if _, err := os.Stat(path); err == nil {
+		return path, nil
+	}
+	if err := os.WriteFile(path, blob.Data, 0o600); err != nil {
+		return "", fmt.Errorf("offload inline data: %w", err)
+	}
+	return path, nil
+}
+
+// inlineDataReference is the text Goose receives in place of offloaded data.
+func inlineDataReference(blob *genai.Blob, path string) string {
+	name := blob.DisplayName
+	if name == "" {
+		name = "attachment"
+	}
+	return fmt.Sprintf("[%s (%s, %d bytes) is saved at %s]", name, blob.MIMEType, len(blob.Data), path)
+}
@@ -0,0 +1,35 @@
+package proxy
+
+import (
+	"context"
+
+	"github.com/innomon/adk2goose/gooseclient"
+	"github.com/innomon/adk2goose/translator"
+)
+
+// applyInstructions extends the system prompt of a Goose agent started for
+// app with the app's configured standing instructions.
+func (h *Handler) applyInstructions(ctx context.Context, app, gooseSessionID string) error {
+	instructions := h.cfg.App(app).Instructions
+	if instructions == "" {
+		return nil
+	}
+	return h.client.ExtendPrompt(ctx, &gooseclient.ExtendPromptRequest{
+		Extension: instructions,
+		SessionID: gooseSessionID,
+	})
+}
+
+// applySystemHistory extends the system prompt of a Goose agent that is
+// replaying ADK history with the history's system-role content, which has
+// no place in the Goose conversation itself.
+func (h *Handler) applySystemHistory(ctx context.Context, gooseSessionID string, history []*translator.ADKEvent) error {
+	instructions := translator.ADKSystemInstructions(history)
+	if instructions == "" {
+		return nil
+	}
+	return h.client.ExtendPrompt(ctx, &gooseclient.ExtendPromptRequest{
+		Extension: instructions,
+		SessionID: gooseSessionID,
+	})
+}
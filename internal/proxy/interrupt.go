@@ -0,0 +1,78 @@
+package proxy
+
+import (
+	"time"
+
+	"github.com/innomon/adk2goose/translator"
+	"google.golang.org/genai"
+)
+
+// Interruption records a turn that ended without completing, so session
+// history can show the half-turn instead of silently dropping it.
+type Interruption struct {
+	InvocationID string         `json:"invocationId"`
+	At           time.Time      `json:"at"`
+	Reason       string         `json:"reason"`
+	Author       string         `json:"author,omitempty"`
+	Content      *genai.Content `json:"content,omitempty"`
+}
+
+// turnOutcome follows the events emitted during a turn to tell whether it
+// completed and, if not, why and what it had produced so far.
+type turnOutcome struct {
+	completed bool
+	reason    string
+	parts     []*genai.Part
+}
+
+// observe records an event about to be emitted.
+func (o *turnOutcome) observe(evt *translator.ADKEvent) {
+	switch {
+	case evt.Interrupted && evt.TurnComplete:
+		o.reason = "cancelled"
+	case evt.TurnComplete:
+		o.completed = true
+	case evt.ErrorCode == "GOOSE_ERROR":
+		o.reason = "goose_error"
+	}
+	if evt.Content != nil && !evt.Partial {
+		for _, p := range evt.Content.Parts {
+			if !p.Thought {
+				o.parts = append(o.parts, p)
+			}
+		}
+	}
+}
+
+// interrupt marks the turn as cut short by the proxy for reason and returns
+// evt flagged as interrupted.
+func (o *turnOutcome) interrupt(reason string, evt *translator.ADKEvent) *translator.ADKEvent {
+	o.reason = reason
+	evt.Interrupted = true
+	return evt
+}
+
+// interruption returns the record of an incomplete turn. clientGone and
+// deadline report how the request context ended, which take precedence over
+// the reason observed in the stream.
+func (o *turnOutcome) interruption(invocationID, author string, clientGone, deadline bool) Interruption {
+	reason := o.reason
+	switch {
+	case clientGone:
+		reason = "client_disconnected"
+	case deadline:
+		reason = "deadline_exceeded"
+	case reason == "":
+		reason = "incomplete"
+	}
+	in := Interruption{
+		InvocationID: invocationID,
+		At:           time.Now(),
+		Reason:       reason,
+		Author:       author,
+	}
+	if len(o.parts) > 0 {
+		in.Content = &genai.Content{Role: genai.RoleModel, Parts: o.parts}
+	}
+	return in
+}
@@ -0,0 +1,34 @@
+package proxy
+
+import (
+	"fmt"
+	"strings"
+)
+
+// validateLabels rejects label keys that can't be expressed in a
+// ?label=key:value filter.
+func validateLabels(labels map[string]string) error {
+	for k := range labels {
+		if k == "" || strings.Contains(k, ":") {
+			return fmt.Errorf("invalid label key %q: keys must be non-empty and must not contain ':'", k)
+		}
+	}
+	return nil
+}
+
+// parseLabelFilter parses repeated ?label=key:value query values into a map
+// that a session must fully match.
+func parseLabelFilter(values []string) (map[string]string, error) {
+	if len(values) == 0 {
+		return nil, nil
+	}
+	labels := make(map[string]string, len(values))
+	for _, v := range values {
+		key, value, ok := strings.Cut(v, ":")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid label filter %q: expected key:value", v)
+		}
+		labels[key] = value
+	}
+	return labels, nil
+}
@@ -0,0 +1,72 @@
+package proxy
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+)
+
+// maxPageSize caps the pageSize of session listings.
+const maxPageSize = 1000
+
+// nextPageTokenHeader carries the token for the next page of a session
+// listing, so the response body stays the plain list ADK clients expect.
+const nextPageTokenHeader = "X-Next-Page-Token"
+
+// pageSessions orders sessions and cuts out the page selected by the
+// pageSize, pageToken, and orderBy query parameters. orderBy=lastUpdateTime
+// lists the most recently active sessions first; the default is creation
+// order. It returns the token for the next page, or "" on the last page.
+func pageSessions(sessions []*Session, q url.Values) ([]*Session, string, error) {
+	switch orderBy := q.Get("orderBy"); orderBy {
+	case "", "createTime":
+	case "lastUpdateTime":
+		sort.SliceStable(sessions, func(i, j int) bool {
+			return sessions[i].LastUpdateTime.After(sessions[j].LastUpdateTime)
+		})
+	default:
+		return nil, "", fmt.Errorf("invalid orderBy %q: expected createTime or lastUpdateTime", orderBy)
+	}
+
+	pageSize := 0
+	if v := q.Get("pageSize"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return nil, "", fmt.Errorf("invalid pageSize %q", v)
+		}
+		pageSize = min(n, maxPageSize)
+	}
+	offset := 0
+	if v := q.Get("pageToken"); v != "" {
+		n, err := decodePageToken(v)
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid pageToken %q", v)
+		}
+		offset = min(n, len(sessions))
+	}
+
+	sessions = sessions[offset:]
+	if pageSize == 0 || len(sessions) <= pageSize {
+		return sessions, "", nil
+	}
+	return sessions[:pageSize], encodePageToken(offset + pageSize), nil
+}
+
+// encodePageToken and decodePageToken keep page tokens opaque to clients.
+func encodePageToken(offset int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(offset)))
+}
+
+func decodePageToken(token string) (int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return 0, err
+	}
+	n, err := strconv.Atoi(string(b))
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("bad offset %q", b)
+	}
+	return n, nil
+}
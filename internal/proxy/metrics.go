@@ -0,0 +1,117 @@
+package proxy
+
+import "github.com/innomon/adk2goose/internal/metrics"
+
+var routeDuration = metrics.NewHistogramVec(
+	"adk_request_duration_seconds",
+	"Time the proxy spends serving ADK API requests, including streaming, by route.",
+	nil, "route")
+
+var (
+	activeStreams = metrics.NewGaugeVec(
+		"adk_active_streams",
+		"run_sse streams currently open.")
+	rejectedStreams = metrics.NewCounterVec(
+		"adk_rejected_streams_total",
+		"run_sse requests rejected because the concurrent-stream limit was reached.")
+)
+
+var offloadedInlineData = metrics.NewCounterVec(
+	"adk_inline_data_offloaded_total",
+	"inlineData parts written to the working directory instead of being sent to Goose inline.")
+
+var processedImages = metrics.NewCounterVec(
+	"adk_images_processed_total",
+	"inlineData images downscaled or re-encoded before being sent to Goose.")
+
+var materializedFiles = metrics.NewCounterVec(
+	"adk_files_materialized_total",
+	"File attachments written to the working directory's uploads folder or passed to Goose by URI.")
+
+var (
+	pushSubscribers = metrics.NewGaugeVec(
+		"adk_push_subscribers",
+		"WebSocket push channel connections currently open.")
+	droppedPushEvents = metrics.NewCounterVec(
+		"adk_push_dropped_total",
+		"Out-of-band events dropped because a push subscriber fell too far behind.")
+	tapSubscribers = metrics.NewGaugeVec(
+		"adk_admin_tap_subscribers",
+		"Admin stream taps currently open.")
+	droppedTapEvents = metrics.NewCounterVec(
+		"adk_admin_tap_dropped_total",
+		"Turn events dropped because an admin tap fell too far behind.")
+)
+
+var truncatedToolResults = metrics.NewCounterVec(
+	"adk_tool_results_truncated_total",
+	"Tool results shortened in the ADK stream, with the full output saved as an artifact.")
+
+var authFailures = metrics.NewCounterVec(
+	"adk_auth_failures_total",
+	"ADK requests rejected as unauthenticated or for addressing another user's sessions.",
+	"reason")
+
+var scheduledTurns = metrics.NewCounterVec(
+	"adk_scheduled_turns_total",
+	"Turns started by configured schedules, by app and result (ok or error).",
+	"app", "result")
+
+var asyncRunsCompleted = metrics.NewCounterVec(
+	"adk_async_runs_total",
+	"Turns queued through the async runs route that have finished, by status (succeeded or failed).",
+	"status")
+
+var budgetAlerts = metrics.NewCounterVec(
+	"adk_budget_alerts_total",
+	"Budget thresholds crossed by a user's or app's accumulated usage, by scope and metric (cost or tokens).",
+	"scope", "metric")
+
+var webhookDeliveries = metrics.NewCounterVec(
+	"adk_webhook_deliveries_total",
+	"Lifecycle webhook deliveries, by result (delivered or failed after retries).",
+	"result")
+
+var sinkEvents = metrics.NewCounterVec(
+	"adk_event_sink_events_total",
+	"ADK events mirrored to the event sink, by result (published, failed, or dropped because the sink fell behind).",
+	"result")
+
+var retentionRemoved = metrics.NewCounterVec(
+	"adk_retention_removed_total",
+	"Items deleted by the retention janitor, by kind (session, event_log, artifact, or debug_capture).",
+	"kind")
+
+var errorReports = metrics.NewCounterVec(
+	"adk_error_reports_total",
+	"Error reports sent to the error tracker, by result (sent, failed, or dropped because the tracker fell behind).",
+	"result")
+
+var oversizedEvents = metrics.NewCounterVec(
+	"adk_stream_events_oversized_total",
+	"Stream events larger than SSE_MAX_EVENT_BYTES, replaced by an EVENT_TOO_LARGE error event.")
+
+var sessionHealth = metrics.NewCounterVec(
+	"adk_session_health_checks_total",
+	"Mapped sessions checked against Goose, by result (ok, resumed, recreated, or failed).",
+	"result")
+
+var orphansCollected = metrics.NewCounterVec(
+	"adk_goose_orphans_collected_total",
+	"Orphaned Goose sessions the proxy stopped and deleted, by result (removed or failed).",
+	"result")
+
+var turnFailovers = metrics.NewCounterVec(
+	"adk_turn_failovers_total",
+	"Turns moved to the standby Goose server after theirs failed, by result (ok or failed).",
+	"result")
+
+var apiKeyRequests = metrics.NewCounterVec(
+	"adk_api_key_requests_total",
+	"ADK and admin requests authenticated with an API key, by key name.",
+	"key")
+
+var apiKeyReloads = metrics.NewCounterVec(
+	"adk_api_key_reloads_total",
+	"Reloads of a changed API keys file, by result (ok or failed, keeping the previous keys).",
+	"result")
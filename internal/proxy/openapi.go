@@ -0,0 +1,376 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"path"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/innomon/adk2goose/gooseclient"
+	"github.com/innomon/adk2goose/translator"
+	"google.golang.org/genai"
+)
+
+// route is a registered API route.
+type route struct {
+	pattern string
+	admin   bool
+}
+
+// apiDoc describes a route in the OpenAPI spec. Request and Response are
+// values of the Go types whose JSON shapes are the request and response
+// bodies; a schema map is used as is.
+type apiDoc struct {
+	summary  string
+	request  any
+	response any
+	// stream is the media type of a streamed response, such as
+	// text/event-stream, whose items have the Response shape.
+	stream string
+	// status is the success status, 200 if zero.
+	status int
+}
+
+// sessionSchema is the ADK session JSON shape rendered by sessionResponse.
+var sessionSchema = map[string]any{
+	"type": "object",
+	"properties": map[string]any{
+		"id":             map[string]any{"type": "string"},
+		"appName":        map[string]any{"type": "string"},
+		"userId":         map[string]any{"type": "string"},
+		"state":          map[string]any{"type": "object", "additionalProperties": map[string]any{}},
+		"events":         map[string]any{"type": "array", "items": map[string]any{"$ref": "#/components/schemas/translator.ADKEvent"}},
+		"lastUpdateTime": map[string]any{"type": "number", "description": "Unix time in seconds"},
+		"labels":         map[string]any{"type": "object", "additionalProperties": map[string]any{"type": "string"}},
+		"forkedFrom":     map[string]any{"type": "string"},
+	},
+}
+
+// routeDocs documents every route the handler registers, by pattern.
+var routeDocs = map[string]apiDoc{
+	"POST /apps/{app}/users/{user}/sessions": {
+		summary: "Create a session", request: CreateSessionRequest{}, response: sessionSchema,
+	},
+	"POST /apps/{app}/users/{user}/sessions/{session}": {
+		summary: "Create a session with the given ID, or return the existing one with its events", request: CreateSessionRequest{}, response: sessionSchema,
+	},
+	"GET /apps/{app}/users/{user}/sessions": {
+		summary: "List the app and user's sessions", response: []map[string]any{sessionSchema},
+	},
+	"POST /apps/{app}/users/{user}/sessions/{session}/run_sse": {
+		summary: "Send a message and stream the turn's events", request: RunSSERequest{}, response: translator.ADKEvent{}, stream: "text/event-stream",
+	},
+	"GET /apps/{app}/users/{user}/sessions/{session}/run_sse": {
+		summary: "Attach to the session's running turn", response: translator.ADKEvent{}, stream: "text/event-stream",
+	},
+	"GET /apps/{app}/users/{user}/sessions/{session}": {
+		summary: "Get a session with its events", response: sessionSchema,
+	},
+	"PATCH /apps/{app}/users/{user}/sessions/{session}": {
+		summary: "Apply a state delta to the session", request: UpdateSessionRequest{}, response: sessionSchema,
+	},
+	"DELETE /apps/{app}/users/{user}/sessions/{session}": {
+		summary: "Delete a session",
+	},
+	"POST /apps/{app}/users/{user}/sessions/{session}/fork": {
+		summary: "Fork a session into a new one", response: sessionSchema,
+	},
+	"GET /apps/{app}/users/{user}/sessions/{session}/snapshot": {
+		summary: "Snapshot a session as a JSON bundle", response: SessionSnapshot{},
+	},
+	"GET /apps/{app}/users/{user}/sessions/{session}/export": {
+		summary: "Export the session's conversation as JSON or Markdown", response: SessionExport{},
+	},
+	"POST /apps/{app}/users/{user}/sessions/restore": {
+		summary: "Restore a snapshot bundle as a new session", request: SessionSnapshot{}, response: sessionSchema,
+	},
+	"POST /apps/{app}/users/{user}/sessions/{session}/replay": {
+		summary: "Replay the session's user turns on a fresh agent and stream a diff", response: translator.ADKEvent{}, stream: "text/event-stream",
+	},
+	"POST /apps/{app}/users/{user}/sessions/{session}/run_poll": {
+		summary: "Start a turn to be fetched by long polling", request: RunSSERequest{}, response: map[string]string{"pollId": ""}, status: http.StatusAccepted,
+	},
+	"GET /apps/{app}/users/{user}/sessions/{session}/run_poll/{poll}": {
+		summary: "Fetch a polled turn's events after a cursor", response: struct {
+			Events []translator.ADKEvent `json:"events"`
+			Cursor int                   `json:"cursor"`
+			Done   bool                  `json:"done"`
+		}{},
+	},
+	"POST /apps/{app}/users/{user}/sessions/{session}/runs": {
+		summary: "Queue a turn as a background job", request: CreateRunRequest{}, response: map[string]string{"runId": "", "status": ""}, status: http.StatusAccepted,
+	},
+	"GET /apps/{app}/users/{user}/sessions/{session}/runs/{run}": {
+		summary: "Get an async run's status and events", response: struct {
+			RunID  string                `json:"runId"`
+			Status string                `json:"status"`
+			Events []translator.ADKEvent `json:"events"`
+			Error  string                `json:"error,omitempty"`
+		}{},
+	},
+	"GET /apps/{app}/users/{user}/sessions/{session}/push": {
+		summary: "WebSocket pushing the session's out-of-band events", response: translator.ADKEvent{}, stream: "application/json",
+	},
+	"GET /apps/{app}/users/{user}/sessions/{session}/tools": {
+		summary: "List the tools available to the session's agent", response: []genai.FunctionDeclaration{},
+	},
+	"GET /apps/{app}/users/{user}/sessions/{session}/artifacts": {
+		summary: "List the session's artifact names", response: []string{},
+	},
+	"GET /apps/{app}/users/{user}/sessions/{session}/artifacts/{name}": {
+		summary: "Load an artifact's latest version, or ?version=", response: genai.Part{},
+	},
+	"DELETE /apps/{app}/users/{user}/sessions/{session}/artifacts/{name}": {
+		summary: "Delete every version of an artifact",
+	},
+	"GET /apps/{app}/users/{user}/sessions/{session}/artifacts/{name}/versions": {
+		summary: "List an artifact's versions", response: []int{},
+	},
+	"GET /apps/{app}/users/{user}/sessions/{session}/artifacts/{name}/versions/{version}": {
+		summary: "Load a version of an artifact", response: genai.Part{},
+	},
+
+	"GET /admin/sessions": {
+		summary: "List every mapped session", response: []Session{},
+	},
+	"GET /admin/sessions/{session}/tap": {
+		summary: "Mirror the events a session's turns send", response: translator.ADKEvent{}, stream: "text/event-stream",
+	},
+	"GET /admin/usage": {
+		summary: "Token usage and estimated cost per session, user, and app", response: UsageReport{},
+	},
+	"DELETE /admin/users/{user}/data": {
+		summary: "Delete everything the proxy holds about a user", response: UserPurgeReport{},
+	},
+	"GET /admin/goose/pool": {
+		summary: "Load of each Goose server sessions are spread across", response: []gooseclient.BackendStats{},
+	},
+	"GET /admin/goose/config": {
+		summary: "Read the Goose server's configuration", response: map[string]any{},
+	},
+	"GET /admin/goose/config/{key}": {
+		summary: "Read one Goose config value", response: map[string]any{"key": "", "value": nil},
+	},
+	"PUT /admin/goose/config/{key}": {
+		summary: "Set a Goose config value", request: GooseConfigUpdate{},
+	},
+	"GET /admin/diagnostics": {
+		summary: "Goroutine and heap figures, streams in flight, and internal queue backlogs", response: Diagnostics{},
+	},
+	"GET /admin/api-keys": {
+		summary: "Client API keys of the keys file, without their secrets", response: []APIKeyInfo{},
+	},
+	"GET /metrics": {
+		summary: "Prometheus metrics", stream: "text/plain",
+	},
+	"GET /debug/pprof/": {
+		summary: "Index of runtime profiles; /debug/pprof/{profile} serves one, such as heap or goroutine", stream: "text/html",
+	},
+	"GET /debug/pprof/cmdline": {
+		summary: "Command line of the proxy process", stream: "text/plain",
+	},
+	"GET /debug/pprof/profile": {
+		summary: "CPU profile over ?seconds (default 30)", stream: "application/octet-stream",
+	},
+	"GET /debug/pprof/symbol": {
+		summary: "Look up program counters' symbols", stream: "text/plain",
+	},
+	"POST /debug/pprof/symbol": {
+		summary: "Look up program counters' symbols", stream: "text/plain",
+	},
+	"GET /debug/pprof/trace": {
+		summary: "Execution trace over ?seconds (default 1)", stream: "application/octet-stream",
+	},
+}
+
+var pathParam = regexp.MustCompile(`\{([^}]+)\}`)
+
+// handleOpenAPI serves the OpenAPI 3 description of the handler's routes.
+func (h *Handler) handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	h.openAPIOnce.Do(func() {
+		h.openAPISpec, _ = json.Marshal(h.openAPI())
+	})
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(h.openAPISpec)
+}
+
+// openAPI builds the OpenAPI document from the registered routes and their
+// documentation, with body schemas generated from their Go types.
+func (h *Handler) openAPI() map[string]any {
+	schemas := make(map[string]any)
+	paths := make(map[string]map[string]any)
+	for _, rt := range h.routes {
+		method, p, _ := strings.Cut(rt.pattern, " ")
+		doc := routeDocs[rt.pattern]
+
+		op := map[string]any{
+			"summary":     doc.summary,
+			"operationId": operationID(method, p),
+		}
+		if rt.admin {
+			op["tags"] = []string{"admin"}
+			op["security"] = []map[string][]string{{"adminToken": {}}}
+		} else {
+			op["tags"] = []string{"adk"}
+		}
+		var params []any
+		for _, m := range pathParam.FindAllStringSubmatch(p, -1) {
+			params = append(params, map[string]any{
+				"name": m[1], "in": "path", "required": true, "schema": map[string]any{"type": "string"},
+			})
+		}
+		if params != nil {
+			op["parameters"] = params
+		}
+		if doc.request != nil {
+			op["requestBody"] = map[string]any{
+				"required": true,
+				"content":  map[string]any{"application/json": map[string]any{"schema": schemaOf(doc.request, schemas)}},
+			}
+		}
+
+		status := doc.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		resp := map[string]any{"description": http.StatusText(status)}
+		switch {
+		case doc.stream != "" && doc.response != nil:
+			resp["content"] = map[string]any{doc.stream: map[string]any{"schema": schemaOf(doc.response, schemas)}}
+		case doc.stream != "":
+			resp["content"] = map[string]any{doc.stream: map[string]any{}}
+		case doc.response != nil:
+			resp["content"] = map[string]any{"application/json": map[string]any{"schema": schemaOf(doc.response, schemas)}}
+		}
+		op["responses"] = map[string]any{
+			strconv.Itoa(status): resp,
+			"default": map[string]any{
+				"description": "Error",
+				"content":     map[string]any{"application/json": map[string]any{"schema": map[string]any{"$ref": "#/components/schemas/Error"}}},
+			},
+		}
+
+		if paths[p] == nil {
+			paths[p] = make(map[string]any)
+		}
+		paths[p][strings.ToLower(method)] = op
+	}
+
+	schemas["Error"] = map[string]any{
+		"type":       "object",
+		"properties": map[string]any{"error": map[string]any{"type": "string"}},
+	}
+	return map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":       "adk2goose",
+			"description": "ADK REST API served by a Goose backend, plus the proxy's operational routes.",
+			"version":     "1.0",
+		},
+		"paths": paths,
+		"components": map[string]any{
+			"schemas": schemas,
+			"securitySchemes": map[string]any{
+				"adminToken": map[string]any{"type": "http", "scheme": "bearer"},
+			},
+		},
+	}
+}
+
+// operationID derives an operation ID such as
+// postAppsUsersSessionsRunSse from a route.
+func operationID(method, p string) string {
+	var b strings.Builder
+	b.WriteString(strings.ToLower(method))
+	for _, seg := range strings.Split(p, "/") {
+		if seg == "" || strings.HasPrefix(seg, "{") {
+			continue
+		}
+		for _, word := range strings.Split(seg, "_") {
+			if word != "" {
+				b.WriteString(strings.ToUpper(word[:1]) + word[1:])
+			}
+		}
+	}
+	return b.String()
+}
+
+var timeType = reflect.TypeFor[time.Time]()
+
+// schemaOf returns the JSON schema of v: v itself if it is a schema map,
+// else one generated from v's type. Named struct types are added to
+// schemas and referenced.
+func schemaOf(v any, schemas map[string]any) any {
+	if m, ok := v.(map[string]any); ok && m["type"] != nil {
+		return m
+	}
+	if list, ok := v.([]map[string]any); ok && len(list) == 1 {
+		return map[string]any{"type": "array", "items": list[0]}
+	}
+	return typeSchema(reflect.TypeOf(v), schemas)
+}
+
+func typeSchema(t reflect.Type, schemas map[string]any) map[string]any {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch {
+	case t == timeType:
+		return map[string]any{"type": "string", "format": "date-time"}
+	case t == rawType:
+		return map[string]any{}
+	}
+
+	switch t.Kind() {
+	case reflect.Interface:
+		return map[string]any{}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return structSchema(t, schemas)
+		}
+		name := schemaName(t)
+		if _, ok := schemas[name]; !ok {
+			schemas[name] = nil // reserve the name, for recursive types
+			schemas[name] = structSchema(t, schemas)
+		}
+		return map[string]any{"$ref": "#/components/schemas/" + name}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": typeSchema(t.Elem(), schemas)}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]any{"type": "string", "format": "byte"}
+		}
+		return map[string]any{"type": "array", "items": typeSchema(t.Elem(), schemas)}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	}
+	return map[string]any{}
+}
+
+func structSchema(t reflect.Type, schemas map[string]any) map[string]any {
+	props := make(map[string]any)
+	for name, ft := range jsonFields(t) {
+		props[name] = typeSchema(ft, schemas)
+	}
+	return map[string]any{"type": "object", "properties": props}
+}
+
+// schemaName names a struct type's schema: proxy types by their name, and
+// others qualified by their package, as in genai.Content.
+func schemaName(t reflect.Type) string {
+	if t.PkgPath() == reflect.TypeFor[Handler]().PkgPath() {
+		return t.Name()
+	}
+	return path.Base(t.PkgPath()) + "." + t.Name()
+}
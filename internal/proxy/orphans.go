@@ -0,0 +1,99 @@
+package proxy
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/innomon/adk2goose/gooseclient"
+)
+
+// RunOrphanGC collects orphaned Goose sessions now and every
+// OrphanGCInterval until ctx is done. It returns at once if the interval is
+// not set.
+func (h *Handler) RunOrphanGC(ctx context.Context) {
+	if h.cfg.OrphanGCInterval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(h.cfg.OrphanGCInterval)
+	defer ticker.Stop()
+	suspects := make(map[string]bool)
+	for {
+		suspects = h.collectOrphans(ctx, suspects)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// collectOrphans stops and deletes the Goose sessions named with the
+// proxy's prefix that no mapped session uses, such as those left behind by
+// a crash or replaced by a recovery. A session is only collected once it
+// was found orphaned by two runs in a row, sparing those just started and
+// not yet mapped; collectOrphans returns the ones seen for the first time,
+// to pass to the next run.
+func (h *Handler) collectOrphans(ctx context.Context, suspects map[string]bool) map[string]bool {
+	listed, err := h.client.ListSessions(ctx)
+	if err != nil {
+		log.Printf("orphan gc: list goose sessions: %v", err)
+		return suspects
+	}
+	next := make(map[string]bool)
+	for _, s := range listed.Sessions {
+		if ctx.Err() != nil {
+			return next
+		}
+		if !h.ownsGooseSession(s) || h.sessions.Maps(s.ID) {
+			continue
+		}
+		if !suspects[s.ID] {
+			next[s.ID] = true
+			continue
+		}
+		// Replays hold the turn lock of their unmapped agent.
+		if !h.turns.tryAcquire(s.ID) {
+			next[s.ID] = true
+			continue
+		}
+		err := h.removeGooseSession(ctx, s.ID)
+		h.turns.release(s.ID)
+		if err != nil {
+			log.Printf("orphan gc: remove goose session %s (%s): %v", s.ID, s.Name, err)
+			orphansCollected.Inc("failed")
+			next[s.ID] = true
+			continue
+		}
+		log.Printf("orphan gc: removed goose session %s (%s)", s.ID, s.Name)
+		orphansCollected.Inc("removed")
+	}
+	return next
+}
+
+// ownsGooseSession reports whether s is named as one the proxy started.
+// Goose versions without session names keep it in the description.
+func (h *Handler) ownsGooseSession(s gooseclient.SessionInfo) bool {
+	prefix := h.cfg.GooseSessionPrefix
+	if prefix == "" {
+		return false
+	}
+	name := s.Name
+	if name == "" && s.Metadata != nil {
+		name = s.Metadata.Description
+	}
+	return strings.HasPrefix(name, prefix)
+}
+
+// removeGooseSession stops the agent of a Goose session and deletes the
+// session. A session Goose no longer has counts as removed.
+func (h *Handler) removeGooseSession(ctx context.Context, id string) error {
+	if err := h.client.StopAgent(ctx, id); err != nil && !gooseclient.IsNotFound(err) {
+		return err
+	}
+	if err := h.client.DeleteSession(ctx, id); err != nil && !gooseclient.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
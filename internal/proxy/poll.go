@@ -0,0 +1,306 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// pollDefaultWait and pollMaxWait bound how long a poll waits for new
+	// events before returning an empty batch.
+	pollDefaultWait = 25 * time.Second
+	pollMaxWait     = 60 * time.Second
+
+	// pollIdleTimeout cancels a running turn nobody has polled for this long.
+	pollIdleTimeout = 2 * time.Minute
+
+	// pollRetention keeps a finished turn's events available for late polls.
+	pollRetention = 5 * time.Minute
+)
+
+// pollTurn is a run_sse turn running in the background for long-polling
+// clients. It implements http.ResponseWriter so the turn runs through the
+// exact run_sse pipeline, collecting each SSE frame as an event.
+type pollTurn struct {
+	id     string
+	key    SessionKey
+	header http.Header
+	cancel context.CancelFunc
+
+	started chan struct{} // closed once the response status is known
+
+	mu       sync.Mutex
+	status   int
+	errBody  bytes.Buffer
+	partial  []byte
+	events   []json.RawMessage
+	done     bool
+	notify   chan struct{} // closed and replaced when events arrive or the turn ends
+	lastPoll time.Time
+}
+
+func (p *pollTurn) Header() http.Header { return p.header }
+
+func (p *pollTurn) WriteHeader(status int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.status != 0 {
+		return
+	}
+	p.status = status
+	close(p.started)
+}
+
+// Write collects the data of complete SSE frames as events; error responses
+// are kept whole.
+func (p *pollTurn) Write(b []byte) (int, error) {
+	p.WriteHeader(http.StatusOK)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.status != http.StatusOK {
+		return p.errBody.Write(b)
+	}
+
+	p.partial = append(p.partial, b...)
+	added := false
+	for {
+		frame, rest, ok := bytes.Cut(p.partial, []byte("\n\n"))
+		if !ok {
+			break
+		}
+		for _, line := range bytes.Split(frame, []byte("\n")) {
+			if data, ok := bytes.CutPrefix(line, []byte("data: ")); ok {
+				p.events = append(p.events, json.RawMessage(bytes.Clone(data)))
+				added = true
+			}
+		}
+		p.partial = rest
+	}
+	if added {
+		p.wake()
+	}
+	return len(b), nil
+}
+
+func (p *pollTurn) Flush() {}
+
+// finish marks the turn ended. It must not be called with mu held.
+func (p *pollTurn) finish() {
+	p.WriteHeader(http.StatusOK)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.done = true
+	p.wake()
+}
+
+// wake releases waiting polls. mu must be held.
+func (p *pollTurn) wake() {
+	close(p.notify)
+	p.notify = make(chan struct{})
+}
+
+// next returns the events after cursor, waiting up to wait for some to
+// arrive if there are none yet and the turn is still running.
+func (p *pollTurn) next(ctx context.Context, cursor int, wait time.Duration) (events []json.RawMessage, done bool) {
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	for {
+		p.mu.Lock()
+		p.lastPoll = time.Now()
+		if cursor < len(p.events) || p.done {
+			events = p.events[min(cursor, len(p.events)):]
+			done = p.done
+			p.mu.Unlock()
+			return events, done
+		}
+		notify := p.notify
+		p.mu.Unlock()
+
+		select {
+		case <-notify:
+		case <-timer.C:
+			return nil, false
+		case <-ctx.Done():
+			return nil, false
+		}
+	}
+}
+
+// idle reports whether nobody has polled the turn for pollIdleTimeout.
+func (p *pollTurn) idle() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return !p.done && time.Since(p.lastPoll) > pollIdleTimeout
+}
+
+// pollTurns tracks background turns by poll ID.
+type pollTurns struct {
+	mu    sync.Mutex
+	turns map[string]*pollTurn
+}
+
+func (t *pollTurns) add(p *pollTurn) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.turns == nil {
+		t.turns = make(map[string]*pollTurn)
+	}
+	t.turns[p.id] = p
+}
+
+func (t *pollTurns) get(id string) (*pollTurn, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	p, ok := t.turns[id]
+	return p, ok
+}
+
+func (t *pollTurns) remove(id string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.turns, id)
+}
+
+// handleRunPoll starts a turn like run_sse but in the background, for
+// clients behind proxies that break event streams. Request validation and
+// setup errors are returned directly; otherwise the response carries a poll
+// ID for fetching events with handlePollEvents.
+func (h *Handler) handleRunPoll(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithCancel(context.WithoutCancel(r.Context()))
+	turn := &pollTurn{
+		id:       h.newID("poll_"),
+		key:      sessionKey(r),
+		header:   make(http.Header),
+		cancel:   cancel,
+		started:  make(chan struct{}),
+		notify:   make(chan struct{}),
+		lastPoll: time.Now(),
+	}
+	h.polls.add(turn)
+
+	// The turn outlives this request, so it needs its own copy of the body.
+	var body bytes.Buffer
+	if _, err := body.ReadFrom(r.Body); err != nil {
+		cancel()
+		h.polls.remove(turn.id)
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("read request: %v", err))
+		return
+	}
+	tr := r.Clone(ctx)
+	tr.Body = http.NoBody
+	if body.Len() > 0 {
+		tr.Body = io.NopCloser(&body)
+	}
+	tr.Header.Del("Accept")
+	tr.Header.Del("Accept-Encoding")
+
+	go func() {
+		defer cancel()
+		defer turn.finish()
+		h.handleRunSSE(turn, tr)
+	}()
+	go h.reapPollTurn(turn)
+
+	<-turn.started
+	turn.mu.Lock()
+	status := turn.status
+	turn.mu.Unlock()
+	if status != http.StatusOK {
+		// Setup failed: wait for the handler to finish writing the error.
+		h.waitPollDone(turn)
+		turn.mu.Lock()
+		errBody := turn.errBody.Bytes()
+		turn.mu.Unlock()
+		h.polls.remove(turn.id)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write(errBody)
+		return
+	}
+
+	writeJSON(w, http.StatusAccepted, map[string]string{"pollId": turn.id})
+}
+
+// handlePollEvents returns the events of a background turn of the session
+// addressed after the cursor query parameter, long-polling up to the wait
+// parameter when there are none yet. The response's cursor is passed to the next poll; done reports
+// that the turn has ended and no more events will follow.
+func (h *Handler) handlePollEvents(w http.ResponseWriter, r *http.Request) {
+	turn, ok := h.polls.get(r.PathValue("poll"))
+	if !ok || turn.key != sessionKey(r) {
+		writeError(w, http.StatusNotFound, "poll not found")
+		return
+	}
+
+	cursor := 0
+	if v := r.URL.Query().Get("cursor"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid cursor %q", v))
+			return
+		}
+		cursor = n
+	}
+	wait := pollDefaultWait
+	if v := r.URL.Query().Get("wait"); v != "" {
+		d, err := parseTimeout(v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid wait %q", v))
+			return
+		}
+		wait = min(d, pollMaxWait)
+	}
+
+	events, done := turn.next(r.Context(), cursor, wait)
+	if events == nil {
+		events = []json.RawMessage{}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"events": events,
+		"cursor": cursor + len(events),
+		"done":   done,
+	})
+}
+
+// waitPollDone blocks until the turn's handler has returned.
+func (h *Handler) waitPollDone(turn *pollTurn) {
+	for {
+		turn.mu.Lock()
+		done, notify := turn.done, turn.notify
+		turn.mu.Unlock()
+		if done {
+			return
+		}
+		<-notify
+	}
+}
+
+// reapPollTurn cancels the turn if its client stops polling, and forgets it
+// pollRetention after it ends.
+func (h *Handler) reapPollTurn(turn *pollTurn) {
+	ticker := time.NewTicker(pollIdleTimeout / 4)
+	defer ticker.Stop()
+	for {
+		turn.mu.Lock()
+		done, notify := turn.done, turn.notify
+		turn.mu.Unlock()
+		if done {
+			break
+		}
+		select {
+		case <-notify:
+		case <-ticker.C:
+			if turn.idle() {
+				turn.cancel()
+			}
+		}
+	}
+	time.AfterFunc(pollRetention, func() { h.polls.remove(turn.id) })
+}
@@ -0,0 +1,99 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"google.golang.org/genai"
+)
+
+func TestRunPoll(t *testing.T) {
+	_, proxySrv := setupProxy(t)
+	sessionID := createSession(t, proxySrv.URL, "myapp", "user1")
+	base := fmt.Sprintf("%s/apps/myapp/users/user1/sessions/%s/run_poll", proxySrv.URL, sessionID)
+
+	body, _ := json.Marshal(map[string]any{"new_message": genai.NewContentFromText("hi", genai.RoleUser)})
+	resp, err := http.Post(base, "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("POST run_poll: %v", err)
+	}
+	var started struct {
+		PollID string `json:"pollId"`
+	}
+	json.NewDecoder(resp.Body).Decode(&started)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted || started.PollID == "" {
+		t.Fatalf("expected 202 with a poll ID, got %d %+v", resp.StatusCode, started)
+	}
+
+	// Poll until the turn is done, following the cursor.
+	var events []map[string]any
+	cursor := 0
+	for range 10 {
+		resp, err := http.Get(fmt.Sprintf("%s/%s?cursor=%d&wait=1s", base, started.PollID, cursor))
+		if err != nil {
+			t.Fatalf("GET poll: %v", err)
+		}
+		var batch struct {
+			Events []map[string]any `json:"events"`
+			Cursor int              `json:"cursor"`
+			Done   bool             `json:"done"`
+		}
+		json.NewDecoder(resp.Body).Decode(&batch)
+		resp.Body.Close()
+		events = append(events, batch.Events...)
+		cursor = batch.Cursor
+		if batch.Done {
+			break
+		}
+	}
+
+	// Another session, even of the same user, cannot read the turn.
+	otherID := createSession(t, proxySrv.URL, "myapp", "user1")
+	resp, err = http.Get(fmt.Sprintf("%s/apps/myapp/users/user1/sessions/%s/run_poll/%s", proxySrv.URL, otherID, started.PollID))
+	if err != nil {
+		t.Fatalf("GET poll: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404 polling from another session, got %d", resp.StatusCode)
+	}
+
+	// Same translation as run_sse.
+	want := runSSE(t, proxySrv.URL, "myapp", "user1", sessionID, "hi")
+	if len(events) != len(want) {
+		t.Fatalf("expected %d events like run_sse, got %d: %+v", len(want), len(events), events)
+	}
+	if events[len(events)-1]["turnComplete"] != true {
+		t.Errorf("expected the last event to complete the turn, got %+v", events[len(events)-1])
+	}
+}
+
+func TestRunPoll_SetupError(t *testing.T) {
+	_, proxySrv := setupProxy(t)
+	resp, err := http.Post(proxySrv.URL+"/apps/myapp/users/user1/sessions/s1/run_poll", "application/json", bytes.NewReader([]byte("{}")))
+	if err != nil {
+		t.Fatalf("POST run_poll: %v", err)
+	}
+	defer resp.Body.Close()
+	var body map[string]string
+	json.NewDecoder(resp.Body).Decode(&body)
+	if resp.StatusCode != http.StatusBadRequest || body["error"] != "new_message is required" {
+		t.Fatalf("expected the run_sse validation error, got %d %+v", resp.StatusCode, body)
+	}
+}
+
+func TestPollEvents_NotFound(t *testing.T) {
+	_, proxySrv := setupProxy(t)
+	resp, err := http.Get(proxySrv.URL + "/apps/myapp/users/user1/sessions/s1/run_poll/nope")
+	if err != nil {
+		t.Fatalf("GET poll: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,159 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// UserPurgeReport is the response of the user data purge route: what was
+// removed or, for a dry run, what would be.
+type UserPurgeReport struct {
+	User   string `json:"user"`
+	DryRun bool   `json:"dryRun"`
+	// Sessions are the user's sessions, running or with only an event log
+	// left. Each is stopped and its event log deleted.
+	Sessions []PurgedSession `json:"sessions"`
+	// GooseSessions counts the Goose sessions deleted with them: those
+	// backing the sessions and, with GOOSE_SESSION_PREFIX, any other named
+	// after one of them.
+	GooseSessions int `json:"gooseSessions"`
+	// StateApps are the apps in which the user had user: scoped state.
+	StateApps []string `json:"stateApps"`
+	// Artifacts counts artifact versions across the sessions.
+	Artifacts int `json:"artifacts"`
+	// UsageRows counts the user's per-session and per-user usage entries.
+	UsageRows int `json:"usageRows"`
+	// Captures counts the debug captures of the user's invocations.
+	Captures int `json:"captures"`
+	// Files counts the uploaded and offloaded files the user sent that are
+	// kept in the shared working directory. Private working directories are
+	// removed whole.
+	Files int `json:"files"`
+}
+
+// PurgedSession is one session in a UserPurgeReport.
+type PurgedSession struct {
+	App     string `json:"app"`
+	Session string `json:"session"`
+}
+
+// handleAdminPurgeUser deletes everything the proxy holds about a user: it
+// stops and deletes their sessions with their event logs, artifacts, async
+// run results, and Goose sessions, drops their user: state, private working
+// directories, and files in the shared one, and removes their usage rows
+// and debug captures.
+// ?app= limits the purge to one app; ?dryRun=true only reports what would
+// be removed.
+func (h *Handler) handleAdminPurgeUser(w http.ResponseWriter, r *http.Request) {
+	user := r.PathValue("user")
+	app := r.URL.Query().Get("app")
+	dryRun := false
+	if v := r.URL.Query().Get("dryRun"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid dryRun %q", v))
+			return
+		}
+		dryRun = b
+	}
+
+	keys, err := h.sessions.UserSessions(app, user)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Sprintf("list sessions: %v", err))
+		return
+	}
+	rep := UserPurgeReport{
+		User:      user,
+		DryRun:    dryRun,
+		Sessions:  make([]PurgedSession, 0, len(keys)),
+		StateApps: h.sessions.UserStateApps(app, user),
+	}
+	if rep.StateApps == nil {
+		rep.StateApps = []string{}
+	}
+	// Stopping a session unmaps it, so its Goose sessions are listed first.
+	gooseIDs := h.userGooseSessions(r.Context(), keys)
+	rep.GooseSessions = len(gooseIDs)
+	for _, key := range keys {
+		rep.Sessions = append(rep.Sessions, PurgedSession{App: key.App, Session: key.ID})
+		rep.Artifacts += h.artifacts.count(key.String())
+		if dryRun {
+			continue
+		}
+		// The session's data is gone even if Goose fails to stop an agent.
+		if err := h.sessions.Purge(r.Context(), key); err != nil {
+			log.Printf("purge session %s: %v", key, err)
+		}
+		h.forgetSession(key)
+	}
+	if !dryRun {
+		for _, id := range gooseIDs {
+			if err := h.removeGooseSession(r.Context(), id); err != nil {
+				log.Printf("purge user %s: remove goose session %s: %v", user, id, err)
+			}
+		}
+		h.sessions.DeleteUserState(app, user)
+		if err := h.sessions.RemoveUserWorkingDirs(app, user); err != nil {
+			log.Printf("purge user %s: remove working dirs: %v", user, err)
+		}
+	}
+	if rep.Files, err = h.sessions.RemoveUserFiles(app, user, dryRun); err != nil {
+		log.Printf("purge user %s: remove files: %v", user, err)
+	}
+	if rep.Captures, err = h.removeUserCaptures(app, user, dryRun); err != nil {
+		log.Printf("purge user %s: remove debug captures: %v", user, err)
+	}
+	rep.UsageRows = h.usage.purgeUser(app, user, dryRun)
+	writeJSON(w, http.StatusOK, rep)
+}
+
+// userGooseSessions returns the Goose sessions of the sessions keys: those
+// backing them and, when sessions are named, those named after one of them,
+// such as ones left behind by a recovery or a replay.
+func (h *Handler) userGooseSessions(ctx context.Context, keys []SessionKey) []string {
+	seen := make(map[string]bool)
+	var ids []string
+	add := func(id string) {
+		if id != "" && !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	for _, key := range keys {
+		for _, id := range h.sessions.GooseIDs(key) {
+			add(id)
+		}
+	}
+	prefix := h.cfg.GooseSessionPrefix
+	if prefix == "" || len(keys) == 0 {
+		return ids
+	}
+	listed, err := h.client.ListSessions(ctx)
+	if err != nil {
+		log.Printf("purge: list goose sessions: %v", err)
+		return ids
+	}
+	names := make(map[string]bool, 2*len(keys))
+	for _, key := range keys {
+		names[prefix+key.String()] = true
+		names[prefix+"replay:"+key.String()] = true
+	}
+	for _, s := range listed.Sessions {
+		name := s.Name
+		if name == "" && s.Metadata != nil {
+			name = s.Metadata.Description
+		}
+		// Sub-agents are named after their session, then #agent.
+		if i := strings.LastIndex(name, "#"); i >= 0 && !names[name] {
+			name = name[:i]
+		}
+		if names[name] {
+			add(s.ID)
+		}
+	}
+	return ids
+}
@@ -0,0 +1,170 @@
+package proxy
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/innomon/adk2goose/internal/metrics"
+	"github.com/innomon/adk2goose/translator"
+)
+
+// pushBuffer is how many events a slow push subscriber may fall behind
+// before further events are dropped for it.
+const pushBuffer = 64
+
+// pushPingInterval keeps idle push connections alive through proxies.
+const pushPingInterval = 30 * time.Second
+
+// pushHub fans out-of-band ADK events (tool confirmation prompts,
+// notifications, state and artifact changes) to the WebSocket subscribers
+// of each session.
+type pushHub struct {
+	mu   sync.Mutex
+	subs map[string]map[chan []byte]struct{} // session → subscriber channels
+
+	filter      func(*translator.ADKEvent) bool // nil passes every event
+	subscribers *metrics.GaugeVec
+	dropped     *metrics.CounterVec
+}
+
+func newPushHub() *pushHub {
+	return &pushHub{
+		subs:        make(map[string]map[chan []byte]struct{}),
+		filter:      isPushEvent,
+		subscribers: pushSubscribers,
+		dropped:     droppedPushEvents,
+	}
+}
+
+// subscribe registers a subscriber for a session's events. The channel is
+// closed when the session is deleted.
+func (p *pushHub) subscribe(sessionID string) chan []byte {
+	ch := make(chan []byte, pushBuffer)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.subs[sessionID] == nil {
+		p.subs[sessionID] = make(map[chan []byte]struct{})
+	}
+	p.subs[sessionID][ch] = struct{}{}
+	p.subscribers.Inc()
+	return ch
+}
+
+// unsubscribe removes a subscriber, unless the session was deleted already.
+func (p *pushHub) unsubscribe(sessionID string, ch chan []byte) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.subs[sessionID][ch]; !ok {
+		return
+	}
+	delete(p.subs[sessionID], ch)
+	if len(p.subs[sessionID]) == 0 {
+		delete(p.subs, sessionID)
+	}
+	p.subscribers.Dec()
+}
+
+// publish sends evt to the session's subscribers if it passes the hub's
+// filter. It encodes evt right away, so the caller may release it afterwards.
+func (p *pushHub) publish(sessionID string, evt *translator.ADKEvent) {
+	if p.filter != nil && !p.filter(evt) {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.subs[sessionID]) == 0 {
+		return
+	}
+	data, err := json.Marshal(evt)
+	if err != nil {
+		log.Printf("encode push event: %v", err)
+		return
+	}
+	for ch := range p.subs[sessionID] {
+		select {
+		case ch <- data:
+		default:
+			p.dropped.Inc()
+		}
+	}
+}
+
+// closeSession disconnects every subscriber of a session.
+func (p *pushHub) closeSession(sessionID string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for ch := range p.subs[sessionID] {
+		close(ch)
+		p.subscribers.Dec()
+	}
+	delete(p.subs, sessionID)
+}
+
+// isPushEvent reports whether evt is worth pushing outside of run_sse: a
+// tool confirmation prompt, a Goose notification, or a state or artifact
+// change.
+func isPushEvent(evt *translator.ADKEvent) bool {
+	if evt.Actions != nil && (len(evt.Actions.StateDelta) > 0 || len(evt.Actions.ArtifactDelta) > 0) {
+		return true
+	}
+	if _, ok := evt.CustomMetadata[translator.NotificationMetadataKey]; ok {
+		return true
+	}
+	return isConfirmationEvent(evt)
+}
+
+// handlePush upgrades to a WebSocket that streams the session's out-of-band
+// events as JSON text messages until either side closes it. Sessions need
+// not exist yet, so clients can subscribe before the first turn.
+func (h *Handler) handlePush(w http.ResponseWriter, r *http.Request) {
+	adkSessionID := sessionKey(r).String()
+
+	conn, err := h.upgradeWebSocket(w, r)
+	if err != nil {
+		log.Printf("session %s: push channel: %v", adkSessionID, err)
+		return
+	}
+	defer conn.Close()
+
+	events := h.push.subscribe(adkSessionID)
+	defer h.push.unsubscribe(adkSessionID, events)
+
+	// Client messages are read only so that pings are answered and a close
+	// is noticed.
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	ping := time.NewTicker(pushPingInterval)
+	defer ping.Stop()
+	for {
+		select {
+		case <-closed:
+			return
+		case <-ping.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteTimeout)); err != nil {
+				return
+			}
+		case data, ok := <-events:
+			if !ok {
+				conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, "session deleted"),
+					time.Now().Add(wsWriteTimeout))
+				return
+			}
+			conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+			if err := conn.WriteMessage(websocket.TextMessage, data); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/innomon/adk2goose/internal/config"
+)
+
+// dialPush opens a push channel WebSocket with the given Origin, if any.
+func dialPush(t *testing.T, proxyURL, path, origin string) (*websocket.Conn, *http.Response, error) {
+	t.Helper()
+	header := http.Header{}
+	if origin != "" {
+		header.Set("Origin", origin)
+	}
+	conn, resp, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(proxyURL, "http")+path, header)
+	if conn != nil {
+		t.Cleanup(func() { conn.Close() })
+	}
+	return conn, resp, err
+}
+
+func TestPush_ToolConfirmation(t *testing.T) {
+	_, proxySrv := setupProxyWith(t, &config.Config{}, []string{
+		`{"type":"Message","message":{"role":"assistant","created":1,"content":[{"type":"text","text":"checking"}]}}`,
+		`{"type":"Message","message":{"role":"assistant","created":2,"content":[{"type":"toolConfirmationRequest","id":"req-1","toolName":"developer__shell","arguments":{"command":"make"}}]}}`,
+		`{"type":"Finish","reason":"stop"}`,
+	})
+	sessionID := createSession(t, proxySrv.URL, "myapp", "user1")
+	conn, _, err := dialPush(t, proxySrv.URL, fmt.Sprintf("/apps/myapp/users/user1/sessions/%s/push", sessionID), "")
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	// Pings are answered; the pong is seen on the next read.
+	pong := make(chan string, 1)
+	conn.SetPongHandler(func(data string) error {
+		pong <- data
+		return nil
+	})
+	if err := conn.WriteControl(websocket.PingMessage, []byte("hi"), time.Now().Add(time.Second)); err != nil {
+		t.Fatalf("ping: %v", err)
+	}
+
+	runSSE(t, proxySrv.URL, "myapp", "user1", sessionID, "build it")
+
+	op, payload, err := conn.ReadMessage()
+	if err != nil || op != websocket.TextMessage {
+		t.Fatalf("expected a text message, got %d, %v", op, err)
+	}
+	if got := <-pong; got != "hi" {
+		t.Errorf("expected the ping answered, got %q", got)
+	}
+	var evt struct {
+		Author  string `json:"author"`
+		Content struct {
+			Parts []struct {
+				FunctionCall *struct {
+					Name string `json:"name"`
+				} `json:"functionCall"`
+			} `json:"parts"`
+		} `json:"content"`
+	}
+	if err := json.Unmarshal(payload, &evt); err != nil {
+		t.Fatalf("decode pushed event: %v", err)
+	}
+	if len(evt.Content.Parts) != 1 || evt.Content.Parts[0].FunctionCall == nil ||
+		evt.Content.Parts[0].FunctionCall.Name != "adk_request_confirmation" || evt.Author != "myapp" {
+		t.Fatalf("expected only the confirmation prompt to be pushed, got %s", payload)
+	}
+
+	// Deleting the session closes the channel.
+	req, _ := http.NewRequest(http.MethodDelete, fmt.Sprintf("%s/apps/myapp/users/user1/sessions/%s", proxySrv.URL, sessionID), nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("DELETE session: %v", err)
+	}
+	resp.Body.Close()
+	if _, _, err := conn.ReadMessage(); !websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+		t.Fatalf("expected a normal close, got %v", err)
+	}
+}
+
+func TestPush_Origin(t *testing.T) {
+	_, proxySrv := setupProxyWith(t, &config.Config{PushOriginHosts: []string{"*.example.com"}}, defaultReplyEvents)
+	path := "/apps/myapp/users/user1/sessions/s1/push"
+
+	for origin, allowed := range map[string]bool{
+		"":                                  true, // not a browser
+		proxySrv.URL:                        true, // the proxy's own pages
+		"https://app.example.com":           true,
+		"https://example.com":               false,
+		"https://evil.test":                 false,
+		"https://app.example.com.evil.test": false,
+	} {
+		_, resp, err := dialPush(t, proxySrv.URL, path, origin)
+		switch {
+		case allowed && err != nil:
+			t.Errorf("origin %q: expected the channel opened, got %v", origin, err)
+		case !allowed && (err == nil || resp == nil || resp.StatusCode != http.StatusForbidden):
+			t.Errorf("origin %q: expected 403, got %v", origin, err)
+		}
+	}
+}
+
+func TestPush_RequiresUpgrade(t *testing.T) {
+	_, proxySrv := setupProxy(t)
+	resp, err := http.Get(proxySrv.URL + "/apps/myapp/users/user1/sessions/s1/push")
+	if err != nil {
+		t.Fatalf("GET push: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUpgradeRequired {
+		t.Fatalf("expected 426, got %d", resp.StatusCode)
+	}
+}
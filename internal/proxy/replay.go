@@ -0,0 +1,389 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/innomon/adk2goose/gooseclient"
+	"github.com/innomon/adk2goose/translator"
+	"google.golang.org/genai"
+)
+
+// replayMetadataKey is the customMetadata key of the per-turn comparison
+// events streamed by the replay endpoint.
+const replayMetadataKey = "goose:replay"
+
+// replaySeed is the sampling seed pinned for replays, with temperature 0.
+const replaySeed int32 = 0
+
+// replayTurn is one user turn of a recorded conversation and the agent's
+// recorded response to it.
+type replayTurn struct {
+	user     gooseclient.GooseMessage
+	response []gooseclient.GooseMessage
+}
+
+// splitTurns groups a Goose transcript into user turns. Tool results are sent
+// by Goose as user-role messages but belong to the agent's response.
+func splitTurns(messages []gooseclient.GooseMessage) []replayTurn {
+	var turns []replayTurn
+	for _, msg := range messages {
+		if isUserTurn(msg) {
+			turns = append(turns, replayTurn{user: msg})
+			continue
+		}
+		if len(turns) > 0 {
+			turns[len(turns)-1].response = append(turns[len(turns)-1].response, msg)
+		}
+	}
+	return turns
+}
+
+func isUserTurn(msg gooseclient.GooseMessage) bool {
+	if msg.Role != "user" {
+		return false
+	}
+	for _, mc := range msg.Content {
+		if mc.Type == "toolResponse" {
+			return false
+		}
+	}
+	return true
+}
+
+// responseLines renders an agent response as comparable lines: text split by
+// line, and one line per tool call.
+func responseLines(messages []gooseclient.GooseMessage) []string {
+	var text strings.Builder
+	var lines []string
+	flush := func() {
+		if text.Len() > 0 {
+			lines = append(lines, strings.Split(strings.TrimRight(text.String(), "\n"), "\n")...)
+			text.Reset()
+		}
+	}
+	for _, msg := range messages {
+		if msg.Role != "assistant" {
+			continue
+		}
+		for _, mc := range msg.Content {
+			switch mc.Type {
+			case "text":
+				text.WriteString(mc.Text)
+			case "toolRequest":
+				flush()
+				args, _ := json.Marshal(toolArguments(mc))
+				lines = append(lines, fmt.Sprintf("[tool] %s %s", toolName(mc), args))
+			}
+		}
+		flush()
+	}
+	return lines
+}
+
+// diffLines returns a line diff of old and new, each line prefixed with
+// "  " (unchanged), "- " (only in old), or "+ " (only in new).
+func diffLines(old, new []string) []string {
+	// lcs[i][j] is the longest common subsequence of old[i:] and new[j:].
+	lcs := make([][]int, len(old)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(new)+1)
+	}
+	for i := len(old) - 1; i >= 0; i-- {
+		for j := len(new) - 1; j >= 0; j-- {
+			if old[i] == new[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var out []string
+	i, j := 0, 0
+	for i < len(old) && j < len(new) {
+		switch {
+		case old[i] == new[j]:
+			out = append(out, "  "+old[i])
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			out = append(out, "- "+old[i])
+			i++
+		default:
+			out = append(out, "+ "+new[j])
+			j++
+		}
+	}
+	for ; i < len(old); i++ {
+		out = append(out, "- "+old[i])
+	}
+	for ; j < len(new); j++ {
+		out = append(out, "+ "+new[j])
+	}
+	return out
+}
+
+// handleReplaySession re-feeds the user turns of a recorded session, one at a
+// time, to a fresh Goose agent and streams one event per turn comparing the
+// recorded and new responses. The source session is left untouched: the
+// agent works in a scratch copy of its working directory, with temperature
+// and seed pinned so that differences come from the model, not sampling. A
+// replay takes a stream slot and is bounded by the turn timeout.
+func (h *Handler) handleReplaySession(w http.ResponseWriter, r *http.Request) {
+	key := sessionKey(r)
+
+	timeout, err := turnTimeout(r, h.cfg.RequestTimeout)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if !h.streams.acquire(r.Context(), h.requestPriority(r)) {
+		rejectedStreams.Inc()
+		w.Header().Set("Retry-After", h.streams.retryAfter())
+		writeError(w, http.StatusServiceUnavailable, "too many concurrent streams, retry later")
+		return
+	}
+	defer h.streams.release()
+	activeStreams.Inc()
+	defer activeStreams.Dec()
+	ctx := r.Context()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	r = r.WithContext(ctx)
+
+	_, transcript, err := h.sessions.Transcript(ctx, key)
+	if errors.Is(err, ErrSessionNotFound) {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusBadGateway, fmt.Sprintf("replay session: %v", err))
+		return
+	}
+	turns := splitTurns(transcript)
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "streaming not supported")
+		return
+	}
+
+	workingDir, err := h.sessions.WorkingDirFor(key)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	scratch, err := os.MkdirTemp("", "adk2goose-replay-")
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Sprintf("replay session: %v", err))
+		return
+	}
+	defer os.RemoveAll(scratch)
+	if err := copyWorkingDir(workingDir, scratch); err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Sprintf("replay session: copy working dir: %v", err))
+		return
+	}
+	req := &gooseclient.StartAgentRequest{WorkingDir: scratch}
+	if h.cfg.GooseSessionPrefix != "" {
+		req.Name = h.cfg.GooseSessionPrefix + "replay:" + key.String()
+	}
+	agent, err := h.client.StartAgent(ctx, req)
+	if err != nil {
+		writeStartError(w, http.StatusBadGateway, "start replay agent", err)
+		return
+	}
+	stop := func() {
+		if err := h.client.StopAgent(context.WithoutCancel(ctx), agent.ID); err != nil {
+			log.Printf("stop replay agent %s: %v", agent.ID, err)
+		}
+	}
+	// The turn lock keeps the orphan collector off the unmapped agent.
+	if !h.turns.tryAcquire(agent.ID) {
+		stop()
+		writeError(w, http.StatusConflict, fmt.Sprintf("replay session: a turn is already running on goose session %s", agent.ID))
+		return
+	}
+	defer func() {
+		stop()
+		h.turns.release(agent.ID)
+	}()
+	// The scratch agent is stopped after the replay, so its settings need no
+	// restoring.
+	generation, _, err := h.applyGenerationConfig(ctx, agent.ID, &genai.GenerationConfig{
+		Temperature: genai.Ptr[float32](0),
+		Seed:        genai.Ptr(replaySeed),
+	})
+	if err != nil {
+		writeError(w, http.StatusBadGateway, fmt.Sprintf("pin replay generation config: %v", err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	invocationID := h.newID("replay_")
+	sw := newSSEWriter(w, flusher)
+	sw.maxEvent = h.cfg.SSEMaxEventBytes
+	send := func(evt *translator.ADKEvent) {
+		if err := sw.write(evt); err != nil {
+			log.Printf("write ADK event: %v", err)
+		}
+		translator.ReleaseEvent(evt)
+	}
+
+	changed := 0
+	for i, turn := range turns {
+		response, err := h.replayTurn(r, key, agent.ID, invocationID, turn.user)
+		if err != nil {
+			send(translator.NewErrorEvent(invocationID, "REPLAY_FAILED", fmt.Sprintf("turn %d: %v", i+1, err)))
+			return
+		}
+
+		oldLines, newLines := responseLines(turn.response), responseLines(response)
+		diff := diffLines(oldLines, newLines)
+		same := len(oldLines) == len(newLines)
+		for _, line := range diff {
+			if !strings.HasPrefix(line, "  ") {
+				same = false
+				break
+			}
+		}
+		if !same {
+			changed++
+		}
+
+		send(translator.NewMetadataEvent(invocationID, replayMetadataKey, map[string]any{
+			"turn":      i + 1,
+			"user":      responseText(turn.user),
+			"changed":   !same,
+			"diff":      diff,
+			"oldLength": len(oldLines),
+			"newLength": len(newLines),
+		}))
+	}
+
+	done := translator.NewMetadataEvent(invocationID, replayMetadataKey, map[string]any{
+		"turns":            len(turns),
+		"changed":          changed,
+		"generationConfig": generation,
+	})
+	done.TurnComplete = true
+	send(done)
+}
+
+// copyWorkingDir copies the regular files and directories under src into
+// dst for a replay agent to work on. The proxy's own .adk2goose folder and
+// symlinks, which could lead anywhere, are left out.
+func copyWorkingDir(src, dst string) error {
+	return filepath.WalkDir(src, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		switch {
+		case d.IsDir() && rel == filepath.Dir(workDirsDir):
+			return filepath.SkipDir
+		case d.IsDir():
+			return os.MkdirAll(target, 0o700)
+		case !d.Type().IsRegular():
+			return nil
+		}
+		in, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer in.Close()
+		out, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(out, in); err != nil {
+			out.Close()
+			return err
+		}
+		return out.Close()
+	})
+}
+
+// replayTurn sends one recorded user message to the replay agent and
+// collects the messages Goose answers with. Tool calls are subject to the
+// app's policies; confirmations no rule approves are denied, since there is
+// no client to escalate to.
+func (h *Handler) replayTurn(r *http.Request, key SessionKey, gooseSessionID, invocationID string, userMsg gooseclient.GooseMessage) ([]gooseclient.GooseMessage, error) {
+	ctx := r.Context()
+	userMsg.ID = ""
+	userMsg.Created = time.Now().Unix()
+	eventCh, err := h.client.Reply(ctx, &gooseclient.ReplyRequest{UserMessage: &userMsg, SessionID: gooseSessionID})
+	if err != nil {
+		return nil, err
+	}
+
+	var response []gooseclient.GooseMessage
+	denied := make(map[string]bool)
+	for sse := range eventCh {
+		switch sse.Type {
+		case "Error":
+			return nil, errors.New(sse.Error)
+		case "Message":
+			if sse.Message == nil {
+				continue
+			}
+			blocked, err := h.enforceToolPolicy(ctx, key, gooseSessionID, invocationID, sse.Message, denied)
+			for _, evt := range blocked {
+				translator.ReleaseEvent(evt)
+			}
+			if err != nil {
+				return nil, err
+			}
+			for _, mc := range sse.Message.Content {
+				if mc.Type == "toolConfirmationRequest" {
+					if err := h.confirmTool(ctx, gooseSessionID, mc.ID, false); err != nil {
+						return nil, err
+					}
+				}
+			}
+			response = appendChunk(response, *sse.Message)
+		}
+	}
+	return response, ctx.Err()
+}
+
+// appendChunk adds a streamed message to msgs, merging it into the previous
+// message when Goose streams one message as several chunks with the same ID.
+func appendChunk(msgs []gooseclient.GooseMessage, msg gooseclient.GooseMessage) []gooseclient.GooseMessage {
+	if n := len(msgs); n > 0 && msg.ID != "" && msgs[n-1].ID == msg.ID {
+		msgs[n-1].Content = append(msgs[n-1].Content, msg.Content...)
+		return msgs
+	}
+	return append(msgs, msg)
+}
+
+// responseText joins the text content of msg.
+func responseText(msg gooseclient.GooseMessage) string {
+	var b strings.Builder
+	for _, mc := range msg.Content {
+		if mc.Type == "text" {
+			b.WriteString(mc.Text)
+		}
+	}
+	return b.String()
+}
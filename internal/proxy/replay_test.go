@@ -0,0 +1,62 @@
+package proxy
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/innomon/adk2goose/gooseclient"
+)
+
+func TestDiffLines(t *testing.T) {
+	got := diffLines([]string{"a", "b", "c"}, []string{"a", "c", "d"})
+	want := []string{"  a", "- b", "  c", "+ d"}
+	if !slices.Equal(got, want) {
+		t.Errorf("diffLines = %q, want %q", got, want)
+	}
+}
+
+func TestSplitTurns(t *testing.T) {
+	text := func(role, s string) gooseclient.GooseMessage {
+		return gooseclient.GooseMessage{Role: role, Content: []gooseclient.MessageContent{{Type: "text", Text: s}}}
+	}
+	toolResult := gooseclient.GooseMessage{Role: "user", Content: []gooseclient.MessageContent{{Type: "toolResponse", ID: "c1"}}}
+
+	turns := splitTurns([]gooseclient.GooseMessage{
+		text("user", "list files"),
+		text("assistant", "running ls"),
+		toolResult,
+		text("assistant", "done"),
+		text("user", "thanks"),
+	})
+
+	if len(turns) != 2 {
+		t.Fatalf("expected 2 turns, got %d", len(turns))
+	}
+	if len(turns[0].response) != 3 || len(turns[1].response) != 0 {
+		t.Errorf("expected tool result grouped with the first response, got %+v", turns)
+	}
+}
+
+func TestCopyWorkingDir(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	os.MkdirAll(filepath.Join(src, "src"), 0o755)
+	os.WriteFile(filepath.Join(src, "src", "main.go"), []byte("package main"), 0o644)
+	os.MkdirAll(filepath.Join(src, workDirsDir, "myapp"), 0o700)
+	os.WriteFile(filepath.Join(src, workDirsDir, "myapp", "other.txt"), []byte("private"), 0o600)
+	os.Symlink("/etc/passwd", filepath.Join(src, "passwd"))
+
+	if err := copyWorkingDir(src, dst); err != nil {
+		t.Fatalf("copyWorkingDir: %v", err)
+	}
+	if got, err := os.ReadFile(filepath.Join(dst, "src", "main.go")); err != nil || string(got) != "package main" {
+		t.Errorf("expected src/main.go copied, got %q, %v", got, err)
+	}
+	if _, err := os.Lstat(filepath.Join(dst, ".adk2goose")); !os.IsNotExist(err) {
+		t.Errorf("expected .adk2goose left out, got %v", err)
+	}
+	if _, err := os.Lstat(filepath.Join(dst, "passwd")); !os.IsNotExist(err) {
+		t.Errorf("expected the symlink left out, got %v", err)
+	}
+}
@@ -0,0 +1,145 @@
+package proxy
+
+import (
+	"context"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// RunJanitor enforces the configured retention limits now and every
+// retention interval until ctx is done. It returns at once if no limit is
+// set.
+func (h *Handler) RunJanitor(ctx context.Context) {
+	if !h.cfg.Retention.Enabled() {
+		return
+	}
+	ticker := time.NewTicker(h.cfg.Retention.Interval)
+	defer ticker.Stop()
+	for {
+		h.enforceRetention(ctx, time.Now())
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// enforceRetention removes whatever is past its retention limit as of now.
+func (h *Handler) enforceRetention(ctx context.Context, now time.Time) {
+	ret := h.cfg.Retention
+	if ret.SessionMaxAge > 0 || ret.SessionMaxCount > 0 {
+		h.pruneSessions(ctx, now)
+	}
+	if ret.EventLogMaxAge > 0 {
+		h.pruneEventLogs(now.Add(-ret.EventLogMaxAge))
+	}
+	if ret.ArtifactMaxAge > 0 || ret.ArtifactMaxVersions > 0 {
+		var cutoff time.Time
+		if ret.ArtifactMaxAge > 0 {
+			cutoff = now.Add(-ret.ArtifactMaxAge)
+		}
+		retentionRemoved.Add(float64(h.artifacts.prune(cutoff, ret.ArtifactMaxVersions)), "artifact")
+	}
+	if h.cfg.DebugCaptureDir != "" && (ret.DebugCaptureMaxAge > 0 || ret.DebugCaptureMaxCount > 0) {
+		h.pruneCaptures(now)
+	}
+}
+
+// pruneSessions deletes sessions idle for longer than the maximum age, and
+// the least recently used of each user's sessions in an app beyond the
+// maximum count. Sessions with a turn in progress are left for the next
+// run.
+func (h *Handler) pruneSessions(ctx context.Context, now time.Time) {
+	ret := h.cfg.Retention
+	byUser := make(map[SessionKey][]*Session)
+	for _, sess := range h.sessions.ListSessions("", "", nil) {
+		userKey := SessionKey{App: sess.AppName, User: sess.UserID}
+		byUser[userKey] = append(byUser[userKey], sess)
+	}
+
+	for _, sessions := range byUser {
+		// Most recently used first.
+		sort.Slice(sessions, func(i, j int) bool { return sessions[i].LastUpdateTime.After(sessions[j].LastUpdateTime) })
+		for i, sess := range sessions {
+			expired := ret.SessionMaxAge > 0 && now.Sub(sess.LastUpdateTime) > ret.SessionMaxAge
+			excess := ret.SessionMaxCount > 0 && i >= ret.SessionMaxCount
+			if expired || excess {
+				h.expireSession(ctx, sess)
+			}
+		}
+	}
+}
+
+// expireSession deletes a session unless a turn is running on it.
+func (h *Handler) expireSession(ctx context.Context, sess *Session) {
+	if !h.turns.tryAcquire(sess.GooseID) {
+		return
+	}
+	defer h.turns.release(sess.GooseID)
+
+	key := sess.Key()
+	if err := h.sessions.Stop(ctx, key); err != nil {
+		log.Printf("retention: delete session %s: %v", key, err)
+	}
+	h.forgetSession(key)
+	retentionRemoved.Inc("session")
+}
+
+// pruneEventLogs deletes the event logs of unmapped sessions unchanged since
+// cutoff.
+func (h *Handler) pruneEventLogs(cutoff time.Time) {
+	pruned, err := h.sessions.events.Prune(cutoff, func(key SessionKey) bool {
+		_, mapped := h.sessions.Get(key)
+		return mapped
+	})
+	if err != nil {
+		log.Printf("retention: prune event logs: %v", err)
+	}
+	retentionRemoved.Add(float64(len(pruned)), "event_log")
+}
+
+// pruneCaptures deletes debug captures older than the maximum age, and the
+// oldest beyond the maximum count.
+func (h *Handler) pruneCaptures(now time.Time) {
+	ret := h.cfg.Retention
+	entries, err := os.ReadDir(h.cfg.DebugCaptureDir)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("retention: read debug captures: %v", err)
+		}
+		return
+	}
+	type capture struct {
+		path string
+		mod  time.Time
+	}
+	var captures []capture
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		captures = append(captures, capture{filepath.Join(h.cfg.DebugCaptureDir, e.Name()), info.ModTime()})
+	}
+	// Newest first.
+	sort.Slice(captures, func(i, j int) bool { return captures[i].mod.After(captures[j].mod) })
+	for i, c := range captures {
+		expired := ret.DebugCaptureMaxAge > 0 && now.Sub(c.mod) > ret.DebugCaptureMaxAge
+		excess := ret.DebugCaptureMaxCount > 0 && i >= ret.DebugCaptureMaxCount
+		if !expired && !excess {
+			continue
+		}
+		if err := os.RemoveAll(c.path); err != nil {
+			log.Printf("retention: delete debug capture %s: %v", c.path, err)
+			continue
+		}
+		retentionRemoved.Inc("debug_capture")
+	}
+}
@@ -0,0 +1,92 @@
+package proxy
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/innomon/adk2goose/gooseclient"
+)
+
+// Streaming modes accepted in RunConfig.StreamingMode.
+const (
+	streamingModeNone = "NONE"
+	streamingModeSSE  = "SSE"
+	streamingModeBidi = "BIDI"
+)
+
+// RunConfig mirrors the ADK run configuration fields the proxy honors. Goose
+// has no per-turn equivalents, so the limits are enforced by the proxy.
+type RunConfig struct {
+	// MaxLLMCalls aborts the turn once Goose starts more than this many model
+	// calls. Zero means unlimited.
+	MaxLLMCalls int `json:"max_llm_calls,omitempty"`
+	// StreamingMode is "SSE" (default) to forward events as they arrive, or
+	// "NONE" to deliver the whole turn at once when it completes.
+	StreamingMode string `json:"streaming_mode,omitempty"`
+	// ResponseModalities lists the output modalities the client accepts.
+	// Goose only produces text, so a non-empty list must include "TEXT".
+	ResponseModalities []string `json:"response_modalities,omitempty"`
+}
+
+// validate reports run configurations the proxy cannot honor.
+func (rc *RunConfig) validate() error {
+	if rc == nil {
+		return nil
+	}
+	switch strings.ToUpper(rc.StreamingMode) {
+	case "", streamingModeNone, streamingModeSSE:
+	case streamingModeBidi:
+		return fmt.Errorf("run_config.streaming_mode %q is not supported by the Goose backend", rc.StreamingMode)
+	default:
+		return fmt.Errorf("run_config.streaming_mode %q is not a known streaming mode", rc.StreamingMode)
+	}
+	if rc.MaxLLMCalls < 0 {
+		return fmt.Errorf("run_config.max_llm_calls must not be negative")
+	}
+	if len(rc.ResponseModalities) > 0 && !slices.ContainsFunc(rc.ResponseModalities, func(m string) bool {
+		return strings.EqualFold(m, "TEXT")
+	}) {
+		return fmt.Errorf("run_config.response_modalities %v: Goose only produces TEXT responses", rc.ResponseModalities)
+	}
+	return nil
+}
+
+// buffered reports whether events should be held until the turn completes.
+func (rc *RunConfig) buffered() bool {
+	return rc != nil && strings.EqualFold(rc.StreamingMode, streamingModeNone)
+}
+
+// maxLLMCalls returns the configured model-call limit, or 0 for unlimited.
+func (rc *RunConfig) maxLLMCalls() int {
+	if rc == nil {
+		return 0
+	}
+	return rc.MaxLLMCalls
+}
+
+// llmCallCounter counts the model calls Goose makes during a turn. Goose
+// streams one assistant message per model call, possibly split into several
+// chunks sharing the same message ID.
+type llmCallCounter struct {
+	seen  map[string]struct{}
+	count int
+}
+
+// observe records msg and returns the number of model calls seen so far.
+func (c *llmCallCounter) observe(msg *gooseclient.GooseMessage) int {
+	if msg == nil || msg.Role != "assistant" {
+		return c.count
+	}
+	if msg.ID != "" {
+		if _, ok := c.seen[msg.ID]; ok {
+			return c.count
+		}
+		if c.seen == nil {
+			c.seen = make(map[string]struct{})
+		}
+		c.seen[msg.ID] = struct{}{}
+	}
+	c.count++
+	return c.count
+}
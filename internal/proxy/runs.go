@@ -0,0 +1,250 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// runRetention keeps a finished async run's result available for this long.
+// The run's events stay in the session's event log after that.
+const runRetention = time.Hour
+
+// Async run statuses.
+const (
+	runQueued    = "queued"
+	runRunning   = "running"
+	runSucceeded = "succeeded"
+	runFailed    = "failed"
+)
+
+// CreateRunRequest is the body of the async runs route: a run_sse request
+// plus an optional URL the finished run is POSTed to.
+type CreateRunRequest struct {
+	RunSSERequest
+	CallbackURL string `json:"callbackUrl,omitempty"`
+}
+
+// asyncRun is a turn queued by the async runs route. Its events are
+// collected by a pollTurn, which runs it through the run_sse pipeline.
+type asyncRun struct {
+	id          string
+	key         SessionKey
+	callbackURL string
+	turn        *pollTurn
+
+	mu     sync.Mutex
+	status string
+}
+
+// result returns the run's status response.
+func (a *asyncRun) result() map[string]any {
+	a.mu.Lock()
+	status := a.status
+	a.mu.Unlock()
+
+	a.turn.mu.Lock()
+	defer a.turn.mu.Unlock()
+	resp := map[string]any{
+		"runId":  a.id,
+		"status": status,
+		"events": append([]json.RawMessage{}, a.turn.events...),
+	}
+	if status == runFailed {
+		var body struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(a.turn.errBody.Bytes(), &body) == nil && body.Error != "" {
+			resp["error"] = body.Error
+		} else {
+			resp["error"] = fmt.Sprintf("run failed with status %d", a.turn.status)
+		}
+	}
+	return resp
+}
+
+func (a *asyncRun) setStatus(status string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.status = status
+}
+
+// asyncRuns tracks async runs by ID and caps how many execute at once.
+type asyncRuns struct {
+	workers chan struct{} // nil when unlimited
+
+	mu   sync.Mutex
+	seq  int
+	runs map[string]*asyncRun
+}
+
+func newAsyncRuns(workers int) *asyncRuns {
+	r := &asyncRuns{runs: make(map[string]*asyncRun)}
+	if workers > 0 {
+		r.workers = make(chan struct{}, workers)
+	}
+	return r
+}
+
+func (r *asyncRuns) add(run *asyncRun) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.seq++
+	run.id = fmt.Sprintf("run_%d_%d", time.Now().UnixNano(), r.seq)
+	r.runs[run.id] = run
+}
+
+func (r *asyncRuns) get(id string) (*asyncRun, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	run, ok := r.runs[id]
+	return run, ok
+}
+
+func (r *asyncRuns) remove(id string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.runs, id)
+}
+
+// removeSession forgets the session's runs and their results.
+func (r *asyncRuns) removeSession(key SessionKey) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for id, run := range r.runs {
+		if run.key == key {
+			delete(r.runs, id)
+		}
+	}
+}
+
+// handleCreateRun queues a turn like run_sse and returns its run ID at
+// once, for clients that cannot hold a streaming connection. A background
+// worker runs the turn; its result is fetched with handleGetRun or POSTed
+// to the request's callbackUrl when the run ends.
+func (h *Handler) handleCreateRun(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("read request: %v", err))
+		return
+	}
+	var req CreateRunRequest
+	if err := validateBody(body, req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("decode request: %v", err))
+		return
+	}
+	if req.NewMessage == nil {
+		writeError(w, http.StatusBadRequest, "new_message is required")
+		return
+	}
+	if err := req.RunConfig.validate(); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if req.CallbackURL != "" {
+		u, err := url.Parse(req.CallbackURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid callbackUrl %q", req.CallbackURL))
+			return
+		}
+		if !h.callbacks.allows(u) {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("callbackUrl host %q is not allowed by RUN_CALLBACK_HOSTS", u.Hostname()))
+			return
+		}
+	}
+
+	// The turn runs the request without the callback URL.
+	turnBody, err := json.Marshal(req.RunSSERequest)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Sprintf("encode run: %v", err))
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.WithoutCancel(r.Context()))
+	run := &asyncRun{
+		key:         sessionKey(r),
+		callbackURL: req.CallbackURL,
+		status:      runQueued,
+		turn: &pollTurn{
+			header:  make(http.Header),
+			cancel:  cancel,
+			started: make(chan struct{}),
+			notify:  make(chan struct{}),
+		},
+	}
+	h.runs.add(run)
+
+	tr := r.Clone(ctx)
+	tr.Body = io.NopCloser(bytes.NewReader(turnBody))
+	tr.Header.Del("Accept")
+	tr.Header.Del("Accept-Encoding")
+	go h.executeRun(ctx, run, tr)
+
+	writeJSON(w, http.StatusAccepted, map[string]string{"runId": run.id, "status": runQueued})
+}
+
+// executeRun waits for a worker slot, runs the turn, and delivers its
+// result to the callback, if any.
+func (h *Handler) executeRun(ctx context.Context, run *asyncRun, r *http.Request) {
+	defer run.turn.cancel()
+	if h.runs.workers != nil {
+		h.runs.workers <- struct{}{}
+		defer func() { <-h.runs.workers }()
+	}
+
+	run.setStatus(runRunning)
+	h.handleRunSSE(run.turn, r)
+	run.turn.finish()
+
+	status := runSucceeded
+	if run.turn.status != http.StatusOK {
+		status = runFailed
+	}
+	run.setStatus(status)
+	asyncRunsCompleted.Inc(status)
+
+	if run.callbackURL != "" {
+		h.deliverRunCallback(ctx, run)
+	}
+	time.AfterFunc(runRetention, func() { h.runs.remove(run.id) })
+}
+
+// deliverRunCallback POSTs a finished run's result to its callback URL
+// under the callback egress policy, signed if RUN_CALLBACK_SECRET is set,
+// logging any failure.
+func (h *Handler) deliverRunCallback(ctx context.Context, run *asyncRun) {
+	body, err := json.Marshal(run.result())
+	if err != nil {
+		log.Printf("run %s: encode callback: %v", run.id, err)
+		return
+	}
+	header := http.Header{}
+	if h.cfg.RunCallbackSecret != "" {
+		header.Set(webhookSignatureHeader, signWebhook(h.cfg.RunCallbackSecret, body))
+	}
+	if _, err := sendWebhook(ctx, h.callbacks.http, run.callbackURL, body, header); err != nil {
+		log.Printf("run %s: callback: %v", run.id, err)
+	}
+}
+
+// handleGetRun returns an async run's status and the events it has sent so
+// far; a failed run also carries the error that ended it.
+func (h *Handler) handleGetRun(w http.ResponseWriter, r *http.Request) {
+	run, ok := h.runs.get(r.PathValue("run"))
+	if !ok || run.key != sessionKey(r) {
+		writeError(w, http.StatusNotFound, "run not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, run.result())
+}
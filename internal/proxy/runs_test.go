@@ -0,0 +1,127 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/innomon/adk2goose/internal/config"
+	"google.golang.org/genai"
+)
+
+func TestAsyncRun_CallbackAndResult(t *testing.T) {
+	allowLocalEgress(t)
+	_, proxySrv := setupProxyWith(t, &config.Config{
+		RunCallbackHosts:  []string{"127.0.0.1"},
+		RunCallbackSecret: "callback-secret",
+	}, defaultReplyEvents)
+	sessionID := createSession(t, proxySrv.URL, "myapp", "user1")
+	base := fmt.Sprintf("%s/apps/myapp/users/user1/sessions/%s/runs", proxySrv.URL, sessionID)
+
+	callbacks := make(chan map[string]any, 1)
+	signatures := make(chan bool, 1)
+	callbackSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		signatures <- r.Header.Get(webhookSignatureHeader) == signWebhook("callback-secret", data)
+		var body map[string]any
+		json.Unmarshal(data, &body)
+		callbacks <- body
+	}))
+	t.Cleanup(callbackSrv.Close)
+
+	body, _ := json.Marshal(map[string]any{
+		"new_message": genai.NewContentFromText("hi", genai.RoleUser),
+		"callbackUrl": callbackSrv.URL,
+	})
+	resp, err := http.Post(base, "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("POST runs: %v", err)
+	}
+	var created struct {
+		RunID  string `json:"runId"`
+		Status string `json:"status"`
+	}
+	json.NewDecoder(resp.Body).Decode(&created)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted || created.RunID == "" {
+		t.Fatalf("expected 202 with a run ID, got %d %+v", resp.StatusCode, created)
+	}
+
+	var callback map[string]any
+	select {
+	case callback = <-callbacks:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the callback")
+	}
+	if callback["runId"] != created.RunID || callback["status"] != "succeeded" {
+		t.Fatalf("unexpected callback %+v", callback)
+	}
+	if !<-signatures {
+		t.Error("expected the callback to carry a valid signature")
+	}
+
+	resp, err = http.Get(base + "/" + created.RunID)
+	if err != nil {
+		t.Fatalf("GET run: %v", err)
+	}
+	defer resp.Body.Close()
+	var result struct {
+		Status string           `json:"status"`
+		Events []map[string]any `json:"events"`
+	}
+	json.NewDecoder(resp.Body).Decode(&result)
+	if result.Status != "succeeded" || len(result.Events) == 0 {
+		t.Fatalf("expected the finished run's events, got %+v", result)
+	}
+	if last := result.Events[len(result.Events)-1]; last["turnComplete"] != true {
+		t.Errorf("expected the last event to complete the turn, got %+v", last)
+	}
+
+	// Runs are only visible through the session that queued them.
+	resp, err = http.Get(fmt.Sprintf("%s/apps/myapp/users/user2/sessions/%s/runs/%s", proxySrv.URL, sessionID, created.RunID))
+	if err != nil {
+		t.Fatalf("GET run: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404 for another user's session, got %d", resp.StatusCode)
+	}
+}
+
+func TestAsyncRun_InvalidRequest(t *testing.T) {
+	_, proxySrv := setupProxy(t)
+	base := proxySrv.URL + "/apps/myapp/users/user1/sessions/s1/runs"
+
+	resp, err := http.Post(base, "application/json", bytes.NewReader([]byte(`{"new_message": {"role": "user", "parts": [{"text": "hi"}]}, "run_config": {"streaming_mode": "bogus"}}`)))
+	if err != nil {
+		t.Fatalf("POST runs: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected request validation to fail up front, got %d", resp.StatusCode)
+	}
+
+	resp, err = http.Post(base, "application/json", bytes.NewReader([]byte(`{"new_message": {"role": "user", "parts": [{"text": "hi"}]}, "callbackUrl": "ftp://example.com"}`)))
+	if err != nil {
+		t.Fatalf("POST runs: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected an invalid callbackUrl to be rejected, got %d", resp.StatusCode)
+	}
+
+	// Without RUN_CALLBACK_HOSTS no callback destination is allowed.
+	resp, err = http.Post(base, "application/json", bytes.NewReader([]byte(`{"new_message": {"role": "user", "parts": [{"text": "hi"}]}, "callbackUrl": "http://169.254.169.254/latest"}`)))
+	if err != nil {
+		t.Fatalf("POST runs: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected a callbackUrl off RUN_CALLBACK_HOSTS to be rejected, got %d", resp.StatusCode)
+	}
+}
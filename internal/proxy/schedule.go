@@ -0,0 +1,109 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/innomon/adk2goose/internal/config"
+	"google.golang.org/genai"
+)
+
+// RunSchedules runs the configured apps' scheduled prompts until ctx is
+// done. Each scheduled turn runs through the run_sse pipeline with nobody
+// attached, so its events are only recorded in the session's event log
+// (and mirrored to any admin tap or attached clients).
+func (h *Handler) RunSchedules(ctx context.Context) {
+	var wg sync.WaitGroup
+	for app, appCfg := range h.cfg.Apps {
+		for i := range appCfg.Schedules {
+			wg.Add(1)
+			go func(sched *config.Schedule) {
+				defer wg.Done()
+				h.runSchedule(ctx, app, sched)
+			}(&appCfg.Schedules[i])
+		}
+	}
+	wg.Wait()
+}
+
+// runSchedule fires sched's turns in app until ctx is done.
+func (h *Handler) runSchedule(ctx context.Context, app string, sched *config.Schedule) {
+	for {
+		next := sched.Next(time.Now())
+		if next.IsZero() {
+			log.Printf("app %s: schedule %q for session %s never fires", app, sched.Cron, sched.Session)
+			return
+		}
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		if err := h.runScheduledTurn(ctx, app, sched); err != nil {
+			scheduledTurns.Inc(app, "error")
+			log.Printf("app %s: scheduled turn in session %s: %v", app, sched.Session, err)
+			continue
+		}
+		scheduledTurns.Inc(app, "ok")
+	}
+}
+
+// runScheduledTurn sends sched's prompt to its session as a new turn and
+// waits for the turn to end.
+func (h *Handler) runScheduledTurn(ctx context.Context, app string, sched *config.Schedule) error {
+	body, err := json.Marshal(RunSSERequest{
+		NewMessage: genai.NewContentFromText(sched.Prompt, genai.RoleUser),
+	})
+	if err != nil {
+		return err
+	}
+	path := fmt.Sprintf("/apps/%s/users/%s/sessions/%s/run_sse", app, sched.User, sched.Session)
+	r, err := http.NewRequestWithContext(ctx, http.MethodPost, path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	r.SetPathValue("app", app)
+	r.SetPathValue("user", sched.User)
+	r.SetPathValue("session", sched.Session)
+
+	w := &scheduledTurn{header: make(http.Header)}
+	h.handleRunSSE(w, r)
+	if w.status != 0 && w.status != http.StatusOK {
+		return fmt.Errorf("status %d: %s", w.status, bytes.TrimSpace(w.errBody.Bytes()))
+	}
+	return nil
+}
+
+// scheduledTurn is the response writer of a scheduled turn. It discards the
+// event stream and keeps error responses for logging.
+type scheduledTurn struct {
+	header  http.Header
+	status  int
+	errBody bytes.Buffer
+}
+
+func (s *scheduledTurn) Header() http.Header { return s.header }
+
+func (s *scheduledTurn) WriteHeader(status int) {
+	if s.status == 0 {
+		s.status = status
+	}
+}
+
+func (s *scheduledTurn) Write(b []byte) (int, error) {
+	s.WriteHeader(http.StatusOK)
+	if s.status != http.StatusOK {
+		return s.errBody.Write(b)
+	}
+	return len(b), nil
+}
+
+func (s *scheduledTurn) Flush() {}
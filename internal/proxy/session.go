@@ -2,40 +2,265 @@ package proxy
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log"
+	"maps"
+	"net/http"
+	"slices"
+	"sort"
 	"sync"
+	"time"
 
-	"github.com/innomon/adk2goose/internal/gooseclient"
+	"github.com/innomon/adk2goose/gooseclient"
+	"github.com/innomon/adk2goose/translator"
 )
 
-// SessionManager maintains bidirectional mappings between ADK session IDs
-// and Goose session IDs, creating Goose sessions on demand.
+// Session is the proxy's record of an ADK session mapped to a Goose session.
+type Session struct {
+	ID        string            `json:"id"`
+	GooseID   string            `json:"gooseSessionId"`
+	AppName   string            `json:"appName,omitempty"`
+	UserID    string            `json:"userId,omitempty"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	CreatedAt time.Time         `json:"createdAt"`
+	// LastUpdateTime is when the session last started a turn.
+	LastUpdateTime time.Time `json:"lastUpdateTime"`
+
+	// Agents maps sub-agent names to the Goose sessions backing them, for
+	// apps configured as multi-agent trees. GooseID backs the root agent.
+	Agents map[string]string `json:"agentSessions,omitempty"`
+
+	// ForkedFrom names the session this one was forked from. Until its first
+	// turn, seed holds the copied history to send as conversation_so_far.
+	ForkedFrom string `json:"forkedFrom,omitempty"`
+	seed       []gooseclient.GooseMessage
+
+	// Interruptions lists turns that ended before completing, oldest first.
+	Interruptions []Interruption `json:"interruptions,omitempty"`
+
+	// state is the session's ADK state, changed by state deltas. Records
+	// handed out by the SessionManager include the app: and user: state
+	// shared with other sessions.
+	state map[string]any
+}
+
+// State returns a copy of the session's ADK state.
+func (s *Session) State() map[string]any {
+	if s.state == nil {
+		return map[string]any{}
+	}
+	return maps.Clone(s.state)
+}
+
+// HasLabels reports whether the session carries every key/value in want.
+func (s *Session) HasLabels(want map[string]string) bool {
+	for k, v := range want {
+		if got, ok := s.Labels[k]; !ok || got != v {
+			return false
+		}
+	}
+	return true
+}
+
+// Key returns the key the session is mapped under.
+func (s *Session) Key() SessionKey {
+	return SessionKey{App: s.AppName, User: s.UserID, ID: s.ID}
+}
+
+// SessionKey identifies an ADK session by the app and user that own it and
+// its ID, as in the ADK REST path. Session IDs are only unique within an app
+// and user, so mappings are keyed on all three.
+type SessionKey struct {
+	App  string
+	User string
+	ID   string
+}
+
+func (k SessionKey) String() string {
+	return k.App + "/" + k.User + "/" + k.ID
+}
+
+// sessionKey returns the key of the session addressed by r's path.
+func sessionKey(r *http.Request) SessionKey {
+	return SessionKey{App: r.PathValue("app"), User: r.PathValue("user"), ID: r.PathValue("session")}
+}
+
+// ErrSessionNotFound is returned for ADK sessions with no mapping, including
+// sessions addressed under an app or user that does not own them.
+var ErrSessionNotFound = errors.New("session not found")
+
+// SessionManager maintains bidirectional mappings between ADK sessions and
+// Goose session IDs, creating Goose sessions on demand.
 type SessionManager struct {
 	mu         sync.RWMutex
-	adkToGoose map[string]string // adkSessionID → gooseSessionID
-	gooseToADK map[string]string // reverse mapping
-	client     *gooseclient.Client
+	adkToGoose map[SessionKey]*Session // ADK session → session record
+	gooseToADK map[string]SessionKey   // reverse mapping
+	client     gooseclient.API
 	workingDir string
+	events     EventStore
+
+	// appState and userState hold the app: and user: scoped state shared
+	// by the sessions of an app, and of a user within an app (keyed with an
+	// empty session ID).
+	appState  map[string]map[string]any
+	userState map[SessionKey]map[string]any
+
+	// onStart, if set, prepares each Goose agent started for an app before
+	// it is used.
+	onStart func(ctx context.Context, app, gooseSessionID string) error
+
+	// onCreate, if set, is told of each new session.
+	onCreate func(key SessionKey)
+
+	// namePrefix, if set, starts the name of each Goose session started.
+	namePrefix string
+
+	// isolation gives each user or session a private working directory.
+	isolation string
+
+	// replacing holds, for each session whose root agent is being
+	// replaced, a channel closed once it has been.
+	replacing map[SessionKey]chan struct{}
+}
+
+// WorkingDir returns the directory Goose agents are started in, or under if
+// working directories are isolated.
+func (sm *SessionManager) WorkingDir() string {
+	return sm.workingDir
+}
+
+// UseEventStore replaces the in-memory log of session events with store. It
+// must be called before the manager is used.
+func (sm *SessionManager) UseEventStore(store EventStore) {
+	sm.events = store
+}
+
+// Events returns the session's logged ADK events, oldest first.
+func (sm *SessionManager) Events(key SessionKey) ([]*translator.ADKEvent, error) {
+	return sm.events.Events(key)
+}
+
+// OnAgentStart registers fn to prepare each Goose agent started for an app,
+// such as by extending its system prompt. If fn fails, the agent is stopped
+// and the start fails. It must be called before the manager is used.
+func (sm *SessionManager) OnAgentStart(fn func(ctx context.Context, app, gooseSessionID string) error) {
+	sm.onStart = fn
+}
+
+// OnSessionCreate registers fn to be told of each session the manager
+// creates, however it was created. fn runs with the manager locked, so it
+// must not call back into it. It must be called before the manager is used.
+func (sm *SessionManager) OnSessionCreate(fn func(key SessionKey)) {
+	sm.onCreate = fn
+}
+
+// NameSessions makes the manager name each Goose session it starts with
+// prefix followed by the ADK session key, and the sub-agent after a "#",
+// telling them apart from sessions others started on the same Goose. It
+// must be called before the manager is used.
+func (sm *SessionManager) NameSessions(prefix string) {
+	sm.namePrefix = prefix
+}
+
+// Maps reports whether gooseSessionID backs a mapped session, as its root
+// agent or a sub-agent.
+func (sm *SessionManager) Maps(gooseSessionID string) bool {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	_, ok := sm.gooseToADK[gooseSessionID]
+	return ok
+}
+
+// GooseIDs returns the Goose sessions backing the session key, its root
+// agent's first, or nil if key is not mapped.
+func (sm *SessionManager) GooseIDs(key SessionKey) []string {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	sess, ok := sm.adkToGoose[key]
+	if !ok {
+		return nil
+	}
+	ids := []string{sess.GooseID}
+	for _, id := range sess.Agents {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// startAgent starts a Goose agent for the session key, or for its named
+// sub-agent, in the session's working directory, and runs the start hook on
+// it.
+func (sm *SessionManager) startAgent(ctx context.Context, key SessionKey, agent string, req *gooseclient.StartAgentRequest) (*gooseclient.StartAgentResponse, error) {
+	dir, err := sm.WorkingDirFor(key)
+	if err != nil {
+		return nil, err
+	}
+	req.WorkingDir = dir
+	if sm.namePrefix != "" {
+		req.Name = sm.namePrefix + key.String()
+		if agent != "" {
+			req.Name += "#" + agent
+		}
+	}
+	resp, err := sm.client.StartAgent(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if sm.onStart != nil {
+		if err := sm.onStart(ctx, key.App, resp.ID); err != nil {
+			sm.client.StopAgent(context.WithoutCancel(ctx), resp.ID)
+			return nil, fmt.Errorf("prepare agent %s: %w", resp.ID, err)
+		}
+	}
+	return resp, nil
 }
 
 // NewSessionManager creates a SessionManager that uses client to start/stop
 // Goose agent sessions rooted at workingDir.
-func NewSessionManager(client *gooseclient.Client, workingDir string) *SessionManager {
+func NewSessionManager(client gooseclient.API, workingDir string) *SessionManager {
 	return &SessionManager{
-		adkToGoose: make(map[string]string),
-		gooseToADK: make(map[string]string),
+		adkToGoose: make(map[SessionKey]*Session),
+		gooseToADK: make(map[string]SessionKey),
 		client:     client,
 		workingDir: workingDir,
+		events:     NewMemoryEventStore(),
+		appState:   make(map[string]map[string]any),
+		userState:  make(map[SessionKey]map[string]any),
+		replacing:  make(map[SessionKey]chan struct{}),
+	}
+}
+
+// Create starts a Goose agent session for a new ADK session and records it
+// with the given labels. If key is already mapped, the existing session is
+// returned unchanged.
+func (sm *SessionManager) Create(ctx context.Context, key SessionKey, labels map[string]string) (*Session, error) {
+	sess, err := sm.getOrCreate(ctx, key, func(s *Session) {
+		s.Labels = labels
+	})
+	if err != nil {
+		return nil, err
 	}
+	return sess, nil
 }
 
-// GetOrCreate returns the Goose session ID mapped to adkSessionID, starting a
-// new Goose agent session if one does not already exist.
-func (sm *SessionManager) GetOrCreate(ctx context.Context, adkSessionID string) (string, error) {
+// GetOrCreate returns the Goose session ID mapped to key, starting a new
+// Goose agent session if one does not already exist.
+func (sm *SessionManager) GetOrCreate(ctx context.Context, key SessionKey) (string, error) {
+	sess, err := sm.getOrCreate(ctx, key, nil)
+	if err != nil {
+		return "", err
+	}
+	return sess.GooseID, nil
+}
+
+// getOrCreate returns a copy of the session record for key, starting a Goose
+// agent and calling init on the new record if none exists.
+func (sm *SessionManager) getOrCreate(ctx context.Context, key SessionKey, init func(*Session)) (*Session, error) {
 	sm.mu.RLock()
-	if gooseID, ok := sm.adkToGoose[adkSessionID]; ok {
+	if sess, ok := sm.adkToGoose[key]; ok {
 		sm.mu.RUnlock()
-		return gooseID, nil
+		return sm.view(sess), nil
 	}
 	sm.mu.RUnlock()
 
@@ -43,54 +268,468 @@ func (sm *SessionManager) GetOrCreate(ctx context.Context, adkSessionID string)
 	defer sm.mu.Unlock()
 
 	// Double-check after acquiring write lock.
-	if gooseID, ok := sm.adkToGoose[adkSessionID]; ok {
-		return gooseID, nil
+	if sess, ok := sm.adkToGoose[key]; ok {
+		return sm.view(sess), nil
+	}
+
+	now := time.Now()
+	sess := &Session{
+		ID:             key.ID,
+		AppName:        key.App,
+		UserID:         key.User,
+		CreatedAt:      now,
+		LastUpdateTime: now,
+	}
+	if init != nil {
+		init(sess)
+	}
+
+	resp, err := sm.startAgent(ctx, key, "", &gooseclient.StartAgentRequest{})
+	if err != nil {
+		return nil, fmt.Errorf("start goose agent for ADK session %s: %w", key, err)
+	}
+	sess.GooseID = resp.ID
+	sm.adkToGoose[key] = sess
+	sm.gooseToADK[resp.ID] = key
+	if sm.onCreate != nil {
+		sm.onCreate(key)
+	}
+
+	return sm.view(sess), nil
+}
+
+// Fork copies the Goose conversation of src into a fresh Goose agent recorded
+// as newSessionID under the same app and user. The copy keeps the source's
+// labels and replays the history on its first turn, leaving the source
+// untouched.
+func (sm *SessionManager) Fork(ctx context.Context, src SessionKey, newSessionID string) (*Session, error) {
+	srcSess, messages, err := sm.Transcript(ctx, src)
+	if err != nil {
+		return nil, err
+	}
+
+	key := SessionKey{App: src.App, User: src.User, ID: newSessionID}
+	sess, err := sm.getOrCreate(ctx, key, func(s *Session) {
+		s.Labels = srcSess.Labels
+		s.ForkedFrom = src.ID
+		s.seed = messages
+	})
+	if err != nil {
+		return nil, err
 	}
+	events, err := sm.events.Events(src)
+	if err == nil {
+		err = sm.events.Append(key, events...)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("copy events of ADK session %s: %w", src, err)
+	}
+	return sess, nil
+}
 
-	resp, err := sm.client.StartAgent(ctx, &gooseclient.StartAgentRequest{
-		WorkingDir: sm.workingDir,
+// Restore records a new session whose first turn replays history, as when
+// restoring a snapshot.
+func (sm *SessionManager) Restore(ctx context.Context, key SessionKey, labels map[string]string, history []gooseclient.GooseMessage) (*Session, error) {
+	return sm.getOrCreate(ctx, key, func(s *Session) {
+		s.Labels = labels
+		s.seed = history
 	})
+}
+
+// Transcript returns a copy of the session record for key and its full Goose
+// conversation, including history a fork has not yet replayed.
+func (sm *SessionManager) Transcript(ctx context.Context, key SessionKey) (*Session, []gooseclient.GooseMessage, error) {
+	sm.mu.RLock()
+	sess, ok := sm.adkToGoose[key]
+	if ok {
+		sess = sm.view(sess)
+	}
+	sm.mu.RUnlock()
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: %s", ErrSessionNotFound, key)
+	}
+
+	history, err := sm.client.GetSession(ctx, sess.GooseID)
 	if err != nil {
-		return "", fmt.Errorf("start goose agent for ADK session %s: %w", adkSessionID, err)
+		return nil, nil, fmt.Errorf("fetch history of ADK session %s: %w", key, err)
 	}
+	return sess, append(sess.seed, history.Messages...), nil
+}
 
-	sm.adkToGoose[adkSessionID] = resp.ID
-	sm.gooseToADK[resp.ID] = adkSessionID
+// Seed returns the history a forked, restored, or imported session must
+// replay on its first turn, or nil for sessions with nothing to replay. It
+// is kept until ClearSeed, so a first turn Goose does not accept leaves it
+// for the next.
+func (sm *SessionManager) Seed(key SessionKey) []gooseclient.GooseMessage {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	sess, ok := sm.adkToGoose[key]
+	if !ok {
+		return nil
+	}
+	return sess.seed
+}
+
+// ClearSeed drops the history of Seed once Goose has accepted it.
+func (sm *SessionManager) ClearSeed(key SessionKey) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	if sess, ok := sm.adkToGoose[key]; ok {
+		sess.seed = nil
+	}
+}
+
+// Touch records activity on the session now.
+func (sm *SessionManager) Touch(key SessionKey) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	if sess, ok := sm.adkToGoose[key]; ok {
+		sess.LastUpdateTime = time.Now()
+	}
+}
+
+// RecordInterruption appends an incomplete turn to the session's history.
+func (sm *SessionManager) RecordInterruption(key SessionKey, in Interruption) {
+	sm.mu.Lock()
+	sess, ok := sm.adkToGoose[key]
+	if ok {
+		sess.Interruptions = append(sess.Interruptions, in)
+	}
+	sm.mu.Unlock()
+	if ok {
+		sm.RecordEvents(key, interruptedEvent(in))
+	}
+}
+
+// RecordEvents appends ADK events to the session's event log. The events
+// must not be released or modified afterwards.
+func (sm *SessionManager) RecordEvents(key SessionKey, events ...*translator.ADKEvent) {
+	sm.mu.RLock()
+	_, ok := sm.adkToGoose[key]
+	sm.mu.RUnlock()
+	if !ok {
+		return
+	}
+	if err := sm.events.Append(key, events...); err != nil {
+		log.Printf("session %s: record events: %v", key, err)
+	}
+}
+
+// Reattach starts a new Goose agent for the session in place of one the
+// Goose server no longer knows, as after failing over to another instance.
+// It returns the new Goose session ID and the root agent's ADK events to
+// rebuild the conversation from.
+func (sm *SessionManager) Reattach(ctx context.Context, key SessionKey) (string, []*translator.ADKEvent, error) {
+	lostID, release, err := sm.claimRoot(ctx, key)
+	if err != nil {
+		return "", nil, err
+	}
+	defer release()
+	return sm.reattach(ctx, key, lostID, false)
+}
+
+// Recovery outcomes of sessions whose Goose session was lost.
+const (
+	RecoveryResumed   = "resumed"
+	RecoveryRecreated = "recreated"
+)
+
+// Recover brings back the session's root Goose agent, found missing under
+// lostID: Goose is first asked to resume it, and failing that a new agent
+// is started that replays the session's history on its next turn, as with
+// Reattach. It returns how the session was recovered, the Goose session ID
+// it now runs on, and, for a recreated agent, the ADK events it replays.
+// It does nothing, returning "", if the session no longer runs on lostID.
+func (sm *SessionManager) Recover(ctx context.Context, key SessionKey, lostID string) (string, string, []*translator.ADKEvent, error) {
+	current, release, err := sm.claimRoot(ctx, key)
+	if errors.Is(err, ErrSessionNotFound) {
+		return "", "", nil, nil
+	}
+	if err != nil {
+		return "", "", nil, err
+	}
+	defer release()
+	if current != lostID {
+		return "", "", nil, nil
+	}
+	_, err = sm.client.ResumeAgent(ctx, &gooseclient.ResumeAgentRequest{SessionID: lostID, LoadModelAndExtensions: true})
+	if err == nil {
+		return RecoveryResumed, lostID, nil, nil
+	}
+	id, events, err := sm.reattach(ctx, key, lostID, true)
+	if err != nil {
+		return "", "", nil, err
+	}
+	return RecoveryRecreated, id, events, nil
+}
+
+// claimRoot claims the session for replacing its root agent, returning the
+// agent's Goose session ID and a function ending the claim. A replacement
+// already in progress is waited out, so Goose calls are made without sm.mu
+// held and the session is still never given two new agents at once.
+func (sm *SessionManager) claimRoot(ctx context.Context, key SessionKey) (string, func(), error) {
+	for {
+		sm.mu.Lock()
+		sess, ok := sm.adkToGoose[key]
+		if !ok {
+			sm.mu.Unlock()
+			return "", nil, fmt.Errorf("%w: %s", ErrSessionNotFound, key)
+		}
+		busy, claimed := sm.replacing[key]
+		if !claimed {
+			done := make(chan struct{})
+			sm.replacing[key] = done
+			sm.mu.Unlock()
+			return sess.GooseID, func() {
+				sm.mu.Lock()
+				delete(sm.replacing, key)
+				sm.mu.Unlock()
+				close(done)
+			}, nil
+		}
+		sm.mu.Unlock()
+		select {
+		case <-busy:
+		case <-ctx.Done():
+			return "", nil, ctx.Err()
+		}
+	}
+}
+
+// reattach starts a new root Goose agent for the session in place of
+// lostID, under a claimRoot claim. With seed, the agent replays the
+// session's history on its next turn.
+func (sm *SessionManager) reattach(ctx context.Context, key SessionKey, lostID string, seed bool) (string, []*translator.ADKEvent, error) {
+	resp, err := sm.startAgent(ctx, key, "", &gooseclient.StartAgentRequest{})
+	if err != nil {
+		return "", nil, fmt.Errorf("restart goose agent for ADK session %s: %w", key, err)
+	}
+	events, err := sm.events.Events(key)
+	if err != nil {
+		sm.client.StopAgent(context.WithoutCancel(ctx), resp.ID)
+		return "", nil, fmt.Errorf("read events of ADK session %s: %w", key, err)
+	}
+	// Sub-agents run on Goose sessions of their own.
+	events = slices.DeleteFunc(events, func(evt *translator.ADKEvent) bool { return evt.Branch != "" })
+
+	sm.mu.Lock()
+	sess, ok := sm.adkToGoose[key]
+	if !ok || sess.GooseID != lostID {
+		// The session was deleted while the agent started.
+		sm.mu.Unlock()
+		sm.client.StopAgent(context.WithoutCancel(ctx), resp.ID)
+		return "", nil, fmt.Errorf("%w: %s", ErrSessionNotFound, key)
+	}
+	delete(sm.gooseToADK, lostID)
+	sess.GooseID = resp.ID
+	sm.gooseToADK[resp.ID] = key
+	if seed && len(events) > 0 {
+		// The event log holds the whole conversation, including any
+		// history a fork had yet to replay.
+		sess.seed = translator.ADKEventsToGooseConversation(events)
+	}
+	sm.mu.Unlock()
+	return resp.ID, events, nil
+}
+
+// GetOrCreateAgent returns the Goose session backing the named sub-agent of
+// the session, starting one from recipeID the first time the agent is used.
+func (sm *SessionManager) GetOrCreateAgent(ctx context.Context, key SessionKey, agent, recipeID string) (string, error) {
+	if _, err := sm.getOrCreate(ctx, key, nil); err != nil {
+		return "", err
+	}
+
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	sess, ok := sm.adkToGoose[key]
+	if !ok {
+		return "", fmt.Errorf("no goose session for ADK session %s", key)
+	}
+	if id, ok := sess.Agents[agent]; ok {
+		return id, nil
+	}
+
+	resp, err := sm.startAgent(ctx, key, agent, &gooseclient.StartAgentRequest{RecipeID: recipeID})
+	if err != nil {
+		return "", fmt.Errorf("start goose agent %s for ADK session %s: %w", agent, key, err)
+	}
+
+	if sess.Agents == nil {
+		sess.Agents = make(map[string]string)
+	}
+	sess.Agents[agent] = resp.ID
+	sm.gooseToADK[resp.ID] = key
 
 	return resp.ID, nil
 }
 
-// Stop stops the Goose agent session mapped to adkSessionID and removes the
-// bidirectional mapping.
-func (sm *SessionManager) Stop(ctx context.Context, adkSessionID string) error {
+// Stop stops every Goose agent session mapped to key and removes the
+// bidirectional mappings, the event log, and any private working directory.
+func (sm *SessionManager) Stop(ctx context.Context, key SessionKey) error {
 	sm.mu.Lock()
-	gooseID, ok := sm.adkToGoose[adkSessionID]
+	sess, ok := sm.adkToGoose[key]
 	if !ok {
 		sm.mu.Unlock()
-		return fmt.Errorf("no goose session for ADK session %s", adkSessionID)
+		return fmt.Errorf("%w: %s", ErrSessionNotFound, key)
+	}
+	delete(sm.adkToGoose, key)
+	delete(sm.gooseToADK, sess.GooseID)
+	for _, id := range sess.Agents {
+		delete(sm.gooseToADK, id)
 	}
-	delete(sm.adkToGoose, adkSessionID)
-	delete(sm.gooseToADK, gooseID)
 	sm.mu.Unlock()
+	if err := sm.events.Delete(key); err != nil {
+		log.Printf("session %s: delete events: %v", key, err)
+	}
+	if err := sm.removeWorkingDir(key); err != nil {
+		log.Printf("session %s: remove working dir: %v", key, err)
+	}
 
-	return sm.client.StopAgent(ctx, gooseID)
+	for agent, id := range sess.Agents {
+		if err := sm.client.StopAgent(ctx, id); err != nil {
+			return fmt.Errorf("stop agent %s: %w", agent, err)
+		}
+	}
+	return sm.client.StopAgent(ctx, sess.GooseID)
+}
+
+// Purge stops and deletes the session key if it is mapped, and drops its
+// event log and private working directory either way, so sessions whose
+// mapping was lost are purged too.
+func (sm *SessionManager) Purge(ctx context.Context, key SessionKey) error {
+	err := sm.Stop(ctx, key)
+	if errors.Is(err, ErrSessionNotFound) {
+		if err := sm.removeWorkingDir(key); err != nil {
+			log.Printf("session %s: remove working dir: %v", key, err)
+		}
+		return sm.events.Delete(key)
+	}
+	return err
 }
 
-// GetGooseSessionID returns the Goose session ID for the given ADK session ID.
-func (sm *SessionManager) GetGooseSessionID(adkSessionID string) (string, bool) {
+// UserSessions returns the keys of user's sessions in app, or in every app
+// if app is empty, sorted: those mapped to Goose and those with only an
+// event log left.
+func (sm *SessionManager) UserSessions(app, user string) ([]SessionKey, error) {
+	logged, err := sm.events.Sessions(app, user)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[SessionKey]bool, len(logged))
+	keys := make([]SessionKey, 0, len(logged))
+	for _, key := range logged {
+		seen[key] = true
+		keys = append(keys, key)
+	}
+	sm.mu.RLock()
+	for key := range sm.adkToGoose {
+		if (app == "" || key.App == app) && key.User == user && !seen[key] {
+			keys = append(keys, key)
+		}
+	}
+	sm.mu.RUnlock()
+
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].App < keys[j].App || keys[i].App == keys[j].App && keys[i].ID < keys[j].ID
+	})
+	return keys, nil
+}
+
+// UserStateApps returns the apps, limited to app if it is not empty, in
+// which user has user: scoped state, sorted.
+func (sm *SessionManager) UserStateApps(app, user string) []string {
 	sm.mu.RLock()
 	defer sm.mu.RUnlock()
-	gooseID, ok := sm.adkToGoose[adkSessionID]
-	return gooseID, ok
+	var apps []string
+	for key := range sm.userState {
+		if (app == "" || key.App == app) && key.User == user {
+			apps = append(apps, key.App)
+		}
+	}
+	sort.Strings(apps)
+	return apps
+}
+
+// DeleteUserState drops user's user: scoped state in app, or in every app
+// if app is empty.
+func (sm *SessionManager) DeleteUserState(app, user string) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	for key := range sm.userState {
+		if (app == "" || key.App == app) && key.User == user {
+			delete(sm.userState, key)
+		}
+	}
+}
+
+// Get returns a copy of the session record for key.
+func (sm *SessionManager) Get(key SessionKey) (*Session, bool) {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	sess, ok := sm.adkToGoose[key]
+	if !ok {
+		return nil, false
+	}
+	return sm.view(sess), true
+}
+
+// GetGooseSessionID returns the Goose session ID for the given ADK session.
+func (sm *SessionManager) GetGooseSessionID(key SessionKey) (string, bool) {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	sess, ok := sm.adkToGoose[key]
+	if !ok {
+		return "", false
+	}
+	return sess.GooseID, true
 }
 
 // ListMappedSessions returns a copy of the current ADK-to-Goose session mappings.
-func (sm *SessionManager) ListMappedSessions() map[string]string {
+func (sm *SessionManager) ListMappedSessions() map[SessionKey]string {
 	sm.mu.RLock()
 	defer sm.mu.RUnlock()
-	out := make(map[string]string, len(sm.adkToGoose))
+	out := make(map[SessionKey]string, len(sm.adkToGoose))
 	for k, v := range sm.adkToGoose {
-		out[k] = v
+		out[k] = v.GooseID
 	}
 	return out
 }
+
+// ListSessions returns copies of the records of app and user's sessions that
+// carry every label in labels, ordered by creation time. An empty app or
+// user matches every app or user.
+func (sm *SessionManager) ListSessions(app, user string, labels map[string]string) []*Session {
+	sm.mu.RLock()
+	out := make([]*Session, 0, len(sm.adkToGoose))
+	for key, sess := range sm.adkToGoose {
+		if (app == "" || key.App == app) && (user == "" || key.User == user) && sess.HasLabels(labels) {
+			out = append(out, sm.view(sess))
+		}
+	}
+	sm.mu.RUnlock()
+
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.Before(out[j].CreatedAt) })
+	return out
+}
+
+// clone returns a deep copy of s so callers can't mutate the stored record.
+func (s *Session) clone() *Session {
+	c := *s
+	if s.Labels != nil {
+		c.Labels = make(map[string]string, len(s.Labels))
+		for k, v := range s.Labels {
+			c.Labels[k] = v
+		}
+	}
+	c.seed = append([]gooseclient.GooseMessage(nil), s.seed...)
+	c.Interruptions = append([]Interruption(nil), s.Interruptions...)
+	c.state = maps.Clone(s.state)
+	if s.Agents != nil {
+		c.Agents = make(map[string]string, len(s.Agents))
+		for k, v := range s.Agents {
+			c.Agents[k] = v
+		}
+	}
+	return &c
+}
@@ -0,0 +1,73 @@
+package proxy
+
+import (
+	"encoding/json"
+	"log"
+
+	"github.com/innomon/adk2goose/internal/config"
+	"github.com/innomon/adk2goose/internal/eventsink"
+	"github.com/innomon/adk2goose/translator"
+)
+
+// sinkBuffer is how many events may wait for the event sink before further
+// events are dropped, so a slow broker never delays a turn.
+const sinkBuffer = 1024
+
+// sinkMessage is an event serialized for the event sink.
+type sinkMessage struct {
+	key  string
+	data []byte
+}
+
+// eventSink mirrors ADK events to a streaming broker in the background.
+type eventSink struct {
+	pub      eventsink.Publisher
+	envelope bool
+	queue    chan sinkMessage
+}
+
+// UseEventSink mirrors every ADK event the proxy sends to pub, serialized as
+// configured by EventSinkFormat. It must be called before the handler
+// serves requests.
+func (h *Handler) UseEventSink(pub eventsink.Publisher) {
+	s := &eventSink{
+		pub:      pub,
+		envelope: h.cfg.EventSinkFormat != config.EventSinkEvent,
+		queue:    make(chan sinkMessage, sinkBuffer),
+	}
+	go s.run()
+	h.sink = s
+}
+
+// publish queues evt for the sink. It serializes evt right away, since sent
+// events are released. A nil sink does nothing.
+func (s *eventSink) publish(key SessionKey, evt *translator.ADKEvent) {
+	if s == nil {
+		return
+	}
+	var v any = evt
+	if s.envelope {
+		v = map[string]any{"app": key.App, "user": key.User, "session": key.ID, "event": evt}
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		log.Printf("encode event for sink: %v", err)
+		return
+	}
+	select {
+	case s.queue <- sinkMessage{key: key.String(), data: data}:
+	default:
+		sinkEvents.Inc("dropped")
+	}
+}
+
+func (s *eventSink) run() {
+	for msg := range s.queue {
+		if err := s.pub.Publish(msg.key, msg.data); err != nil {
+			sinkEvents.Inc("failed")
+			log.Printf("publish event to sink: %v", err)
+			continue
+		}
+		sinkEvents.Inc("published")
+	}
+}
@@ -0,0 +1,207 @@
+package proxy
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/innomon/adk2goose/gooseclient"
+)
+
+// snapshotVersion is the bundle format written by the snapshot endpoint.
+const snapshotVersion = 1
+
+// maxManifestFiles bounds the working-directory manifest of a snapshot.
+const maxManifestFiles = 10000
+
+// SessionSnapshot is a portable bundle of a session: its mapping record,
+// state, Goose transcript, and, for a session with a private working
+// directory, a manifest of it.
+type SessionSnapshot struct {
+	Version    int                        `json:"version"`
+	TakenAt    time.Time                  `json:"takenAt"`
+	Session    *SnapshotSession           `json:"session"`
+	State      map[string]any             `json:"state"`
+	Transcript []gooseclient.GooseMessage `json:"transcript"`
+	WorkingDir string                     `json:"workingDir,omitempty"`
+	Files      []FileEntry                `json:"files,omitempty"`
+	// Truncated reports that the manifest stopped at maxManifestFiles.
+	Truncated bool `json:"filesTruncated,omitempty"`
+}
+
+// SnapshotSession is the mapping record of a snapshotted session. It leaves
+// out the Goose sessions backing it, which belong to this proxy's Goose and
+// are no use to, or business of, whoever holds the bundle.
+type SnapshotSession struct {
+	ID             string            `json:"id"`
+	AppName        string            `json:"appName,omitempty"`
+	UserID         string            `json:"userId,omitempty"`
+	Labels         map[string]string `json:"labels,omitempty"`
+	CreatedAt      time.Time         `json:"createdAt"`
+	LastUpdateTime time.Time         `json:"lastUpdateTime"`
+	ForkedFrom     string            `json:"forkedFrom,omitempty"`
+	Interruptions  []Interruption    `json:"interruptions,omitempty"`
+}
+
+// FileEntry describes one file in a snapshot's working-directory manifest.
+type FileEntry struct {
+	Path    string    `json:"path"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modTime"`
+	SHA256  string    `json:"sha256"`
+}
+
+func (h *Handler) handleSnapshotSession(w http.ResponseWriter, r *http.Request) {
+	key := sessionKey(r)
+	sess, transcript, err := h.sessions.Transcript(r.Context(), key)
+	if errors.Is(err, ErrSessionNotFound) {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusBadGateway, fmt.Sprintf("snapshot session: %v", err))
+		return
+	}
+
+	snap := &SessionSnapshot{
+		Version: snapshotVersion,
+		TakenAt: time.Now().UTC(),
+		Session: &SnapshotSession{
+			ID:             sess.ID,
+			AppName:        sess.AppName,
+			UserID:         sess.UserID,
+			Labels:         sess.Labels,
+			CreatedAt:      sess.CreatedAt,
+			LastUpdateTime: sess.LastUpdateTime,
+			ForkedFrom:     sess.ForkedFrom,
+			Interruptions:  sess.Interruptions,
+		},
+		State:      sess.State(),
+		Transcript: transcript,
+	}
+	// A shared working directory holds every session's files, which are not
+	// this session's to list.
+	if h.sessions.workingDirOf(key) != h.sessions.WorkingDir() {
+		if snap.WorkingDir, err = h.sessions.WorkingDirFor(key); err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		snap.Files, snap.Truncated, err = fileManifest(r.Context(), snap.WorkingDir, maxManifestFiles)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, fmt.Sprintf("working-dir manifest: %v", err))
+			return
+		}
+	}
+
+	writeJSON(w, http.StatusOK, snap)
+}
+
+func (h *Handler) handleRestoreSession(w http.ResponseWriter, r *http.Request) {
+	app := r.PathValue("app")
+	user := r.PathValue("user")
+
+	var snap SessionSnapshot
+	if err := json.NewDecoder(r.Body).Decode(&snap); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("decode snapshot: %v", err))
+		return
+	}
+	if snap.Version != snapshotVersion {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("unsupported snapshot version %d", snap.Version))
+		return
+	}
+	var labels map[string]string
+	if snap.Session != nil {
+		labels = snap.Session.Labels
+	}
+
+	adkSessionID := fmt.Sprintf("%s_%s_%d", app, user, time.Now().UnixNano())
+
+	sess, err := h.sessions.Restore(r.Context(), SessionKey{App: app, User: user, ID: adkSessionID}, labels, snap.Transcript)
+	if err != nil {
+		writeStartError(w, http.StatusInternalServerError, "restore session", err)
+		return
+	}
+	// The app's and user's shared state stays as it is here.
+	if state := sessionScopedState(snap.State); len(state) > 0 {
+		if sess, err = h.sessions.ApplyStateDelta(sess.Key(), state); err != nil {
+			writeError(w, http.StatusInternalServerError, fmt.Sprintf("restore session: %v", err))
+			return
+		}
+	}
+	var interruptions []Interruption
+	if snap.Session != nil {
+		interruptions = snap.Session.Interruptions
+	}
+	h.sessions.RecordEvents(sess.Key(), sessionEvents(snap.Transcript, interruptions, h.cfg.App(app).EventAuthor(app))...)
+
+	writeJSON(w, http.StatusOK, sessionResponse(sess))
+}
+
+// fileManifest lists the regular files under root with their sizes and
+// SHA-256 digests, stopping after limit files or when ctx is done.
+func fileManifest(ctx context.Context, root string, limit int) (files []FileEntry, truncated bool, err error) {
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if d.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		if len(files) == limit {
+			truncated = true
+			return filepath.SkipAll
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		sum, err := fileDigest(path)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		files = append(files, FileEntry{
+			Path:    filepath.ToSlash(rel),
+			Size:    info.Size(),
+			ModTime: info.ModTime().UTC(),
+			SHA256:  sum,
+		})
+		return nil
+	})
+	return files, truncated, err
+}
+
+func fileDigest(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,40 @@
+package proxy
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileManifest(t *testing.T) {
+	root := t.TempDir()
+	for path, data := range map[string]string{
+		"main.go":       "package main\n",
+		"docs/notes.md": "hello",
+		".git/HEAD":     "ref: refs/heads/main\n",
+	} {
+		full := filepath.Join(root, path)
+		if err := os.MkdirAll(filepath.Dir(full), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(full, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	files, truncated, err := fileManifest(t.Context(), root, 10)
+	if err != nil {
+		t.Fatalf("fileManifest: %v", err)
+	}
+	if truncated || len(files) != 2 {
+		t.Fatalf("expected 2 files outside .git, got %+v (truncated=%v)", files, truncated)
+	}
+	if files[0].Path != "docs/notes.md" || files[0].Size != 5 ||
+		files[0].SHA256 != "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824" {
+		t.Errorf("unexpected entry: %+v", files[0])
+	}
+
+	if _, truncated, _ := fileManifest(t.Context(), root, 1); !truncated {
+		t.Error("expected manifest to report truncation at the limit")
+	}
+}
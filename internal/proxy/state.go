@@ -0,0 +1,160 @@
+package proxy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/innomon/adk2goose/translator"
+)
+
+// ADK state key prefixes. app: and user: state is shared by every session of
+// the app, or of the user within the app; temp: state lasts only for the
+// invocation that sets it and is never stored.
+const (
+	appStatePrefix  = "app:"
+	userStatePrefix = "user:"
+	tempStatePrefix = "temp:"
+)
+
+// ApplyStateDelta merges delta into the state of the session, or of its app
+// or user for app: and user: keys, and returns a copy of the updated record.
+// temp: keys are dropped.
+func (sm *SessionManager) ApplyStateDelta(key SessionKey, delta map[string]any) (*Session, error) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	sess, ok := sm.adkToGoose[key]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrSessionNotFound, key)
+	}
+	for k, v := range delta {
+		var scope map[string]any
+		switch {
+		case strings.HasPrefix(k, tempStatePrefix):
+			continue
+		case strings.HasPrefix(k, appStatePrefix):
+			if sm.appState[key.App] == nil {
+				sm.appState[key.App] = make(map[string]any)
+			}
+			scope = sm.appState[key.App]
+		case strings.HasPrefix(k, userStatePrefix):
+			userKey := SessionKey{App: key.App, User: key.User}
+			if sm.userState[userKey] == nil {
+				sm.userState[userKey] = make(map[string]any)
+			}
+			scope = sm.userState[userKey]
+		default:
+			if sess.state == nil {
+				sess.state = make(map[string]any)
+			}
+			scope = sess.state
+		}
+		scope[k] = v
+	}
+	sess.LastUpdateTime = time.Now()
+	return sm.view(sess), nil
+}
+
+// view returns a copy of sess whose state includes its app's and user's
+// shared state. sm.mu must be held.
+func (sm *SessionManager) view(sess *Session) *Session {
+	c := sess.clone()
+	shared := []map[string]any{sm.appState[sess.AppName], sm.userState[SessionKey{App: sess.AppName, User: sess.UserID}]}
+	for _, scope := range shared {
+		if len(scope) == 0 {
+			continue
+		}
+		if c.state == nil {
+			c.state = make(map[string]any)
+		}
+		maps.Copy(c.state, scope)
+	}
+	return c
+}
+
+// withoutTempState returns delta without its temp: keys, or delta itself if
+// it has none.
+func withoutTempState(delta map[string]any) map[string]any {
+	for k := range delta {
+		if strings.HasPrefix(k, tempStatePrefix) {
+			return filterState(delta, tempStatePrefix)
+		}
+	}
+	return delta
+}
+
+// sessionScopedState returns the keys of state that belong to the session
+// itself rather than to its app or user.
+func sessionScopedState(state map[string]any) map[string]any {
+	return filterState(state, appStatePrefix, userStatePrefix)
+}
+
+// filterState returns a copy of state without the keys that have any of the
+// given prefixes.
+func filterState(state map[string]any, prefixes ...string) map[string]any {
+	out := maps.Clone(state)
+	maps.DeleteFunc(out, func(k string, _ any) bool {
+		return slices.ContainsFunc(prefixes, func(p string) bool { return strings.HasPrefix(k, p) })
+	})
+	return out
+}
+
+// UpdateSessionRequest is the JSON body of the session PATCH endpoint.
+type UpdateSessionRequest struct {
+	StateDelta map[string]any `json:"stateDelta"`
+}
+
+// validateStateDelta rejects state deltas with empty keys.
+func validateStateDelta(delta map[string]any) error {
+	for k := range delta {
+		if k == "" {
+			return errors.New("state keys must not be empty")
+		}
+	}
+	return nil
+}
+
+// handleUpdateSession applies a client-supplied state delta to the session,
+// as ADK tools do before a run. The change is logged as a user event
+// carrying the delta, pushed to the session's subscribers, and the updated
+// session is returned.
+func (h *Handler) handleUpdateSession(w http.ResponseWriter, r *http.Request) {
+	key := sessionKey(r)
+
+	var req UpdateSessionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("decode request: %v", err))
+		return
+	}
+	if len(req.StateDelta) == 0 {
+		writeError(w, http.StatusBadRequest, "stateDelta is required")
+		return
+	}
+	if err := validateStateDelta(req.StateDelta); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	sess, err := h.sessions.ApplyStateDelta(key, req.StateDelta)
+	if errors.Is(err, ErrSessionNotFound) {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Sprintf("update session: %v", err))
+		return
+	}
+
+	evt := translator.NewContentEvent(h.newID("inv_"), nil)
+	evt.Author = "user"
+	evt.Actions = &translator.ADKEventActions{StateDelta: withoutTempState(req.StateDelta)}
+	h.sessions.RecordEvents(key, evt)
+	h.push.publish(key.String(), evt)
+
+	writeJSON(w, http.StatusOK, sessionResponse(sess))
+}
@@ -0,0 +1,225 @@
+package proxy
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/innomon/adk2goose/translator"
+)
+
+// ndjsonContentType selects newline-delimited JSON output instead of SSE.
+const ndjsonContentType = "application/x-ndjson"
+
+// eventTooLargeCode is the error code of the event sent in place of one
+// larger than the stream's event size limit.
+const eventTooLargeCode = "EVENT_TOO_LARGE"
+
+// sseWriter writes ADK events to a streaming response as SSE data frames, or
+// as NDJSON lines. It reuses its buffers and JSON encoder for the lifetime
+// of the stream so steady-state writes don't allocate per event.
+//
+// Every frame is well formed whatever the event holds: the JSON encoder
+// escapes newlines and invalid UTF-8 in strings, so the payload is always
+// one line; event IDs are stripped of line breaks; and each frame reaches
+// the underlying writer in a single Write, so a flush never splits one.
+type sseWriter struct {
+	w       io.Writer
+	flusher http.Flusher
+	ndjson  bool
+	data    bytes.Buffer // the JSON of the last encoded event
+	enc     *json.Encoder
+	frame   bytes.Buffer
+
+	// maxEvent caps the encoded size of an event's JSON; zero disables
+	// the cap.
+	maxEvent int
+}
+
+func newSSEWriter(w io.Writer, flusher http.Flusher) *sseWriter {
+	sw := &sseWriter{w: w, flusher: flusher}
+	sw.enc = json.NewEncoder(&sw.data)
+	return sw
+}
+
+// newNDJSONWriter returns a writer that emits one JSON event per line.
+func newNDJSONWriter(w io.Writer, flusher http.Flusher) *sseWriter {
+	sw := newSSEWriter(w, flusher)
+	sw.ndjson = true
+	return sw
+}
+
+// write encodes evt as a single "data: ...\n\n" frame, or a single line for
+// NDJSON, and flushes it.
+func (sw *sseWriter) write(evt *translator.ADKEvent) error {
+	return sw.writeID("", evt)
+}
+
+// writeID is write with an SSE event ID, which clients send back in
+// Last-Event-ID when they reconnect. NDJSON output has no IDs.
+func (sw *sseWriter) writeID(id string, evt *translator.ADKEvent) error {
+	data, err := sw.encode(evt)
+	if err != nil {
+		return err
+	}
+	return sw.writeEncoded(id, data)
+}
+
+// writePublished writes evt as the next event of the turn f, which shares
+// the one encoding of it with the turn's attached and resuming clients.
+func (sw *sseWriter) writePublished(f *turnFanout, evt *translator.ADKEvent) error {
+	data, err := sw.encode(evt)
+	if err != nil {
+		return fmt.Errorf("encode: %w", err)
+	}
+	return sw.writeEncoded(f.publish(data), data)
+}
+
+// encode returns evt's JSON, or that of the event sent in its place if it
+// is over maxEvent. The bytes are only valid until the next encode; an
+// event encoded once can be both written and shared with attached clients.
+func (sw *sseWriter) encode(evt *translator.ADKEvent) ([]byte, error) {
+	data, err := sw.encodeJSON(evt)
+	if err != nil {
+		return nil, err
+	}
+	if n := len(data); sw.maxEvent > 0 && n > sw.maxEvent {
+		oversizedEvents.Inc()
+		replacement := tooLargeEvent(evt, n, sw.maxEvent)
+		data, err = sw.encodeJSON(replacement)
+		translator.ReleaseEvent(replacement)
+	}
+	return data, err
+}
+
+// encodeJSON encodes v into the reused buffer, without the newline the
+// encoder ends it with.
+func (sw *sseWriter) encodeJSON(v any) ([]byte, error) {
+	sw.data.Reset()
+	if err := sw.enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(sw.data.Bytes(), []byte("\n")), nil
+}
+
+// writeEncoded writes an event's JSON, as returned by encode, as a frame
+// with SSE event ID id, and flushes it.
+func (sw *sseWriter) writeEncoded(id string, data []byte) error {
+	sw.frame.Reset()
+	if !sw.ndjson {
+		if id = sseFieldValue(id); id != "" {
+			sw.frame.WriteString("id: ")
+			sw.frame.WriteString(id)
+			sw.frame.WriteByte('\n')
+		}
+		sw.frame.WriteString("data: ")
+	}
+	sw.frame.Write(data)
+	sw.frame.WriteByte('\n')
+	if !sw.ndjson {
+		sw.frame.WriteByte('\n')
+	}
+
+	if _, err := sw.w.Write(sw.frame.Bytes()); err != nil {
+		return err
+	}
+	if sw.flusher != nil {
+		sw.flusher.Flush()
+	}
+	return nil
+}
+
+// sseFieldValue removes the characters that would end or corrupt an SSE
+// field line, CR, LF, and NUL, and replaces invalid UTF-8, which clients
+// decode the stream as.
+func sseFieldValue(v string) string {
+	if utf8.ValidString(v) && !strings.ContainsAny(v, "\r\n\x00") {
+		return v
+	}
+	return strings.Map(func(r rune) rune {
+		if r == '\r' || r == '\n' || r == 0 {
+			return -1
+		}
+		return r
+	}, v)
+}
+
+// tooLargeEvent returns the error event sent in place of evt, whose JSON
+// is size bytes, over the limit max. It keeps evt's identity and turn
+// state so clients still see the turn end.
+func tooLargeEvent(evt *translator.ADKEvent, size, max int) *translator.ADKEvent {
+	r := translator.NewErrorEvent(evt.InvocationID, eventTooLargeCode,
+		fmt.Sprintf("event of %d bytes exceeds the %d-byte stream event limit", size, max))
+	r.ID = evt.ID
+	r.Time = evt.Time
+	r.Author = evt.Author
+	r.Branch = evt.Branch
+	r.Partial = evt.Partial
+	r.TurnComplete = evt.TurnComplete
+	r.Interrupted = evt.Interrupted
+	r.FinishReason = evt.FinishReason
+	return r
+}
+
+// gzipStream compresses a streaming response while still delivering each
+// event promptly: Flush drains the compressor before flushing the underlying
+// connection.
+type gzipStream struct {
+	gz      *gzip.Writer
+	flusher http.Flusher
+}
+
+func newGzipStream(w io.Writer, flusher http.Flusher) *gzipStream {
+	return &gzipStream{gz: gzip.NewWriter(w), flusher: flusher}
+}
+
+func (g *gzipStream) Write(p []byte) (int, error) { return g.gz.Write(p) }
+
+func (g *gzipStream) Flush() {
+	if err := g.gz.Flush(); err != nil {
+		return
+	}
+	g.flusher.Flush()
+}
+
+// Close writes the gzip trailer.
+func (g *gzipStream) Close() error { return g.gz.Close() }
+
+// acceptsGzip reports whether the request's Accept-Encoding permits gzip,
+// treating an explicit q=0 as a refusal.
+func acceptsGzip(r *http.Request) bool {
+	for _, field := range r.Header.Values("Accept-Encoding") {
+		for _, enc := range strings.Split(field, ",") {
+			name, params, _ := strings.Cut(enc, ";")
+			if !strings.EqualFold(strings.TrimSpace(name), "gzip") {
+				continue
+			}
+			if qv, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+				if q, err := strconv.ParseFloat(qv, 64); err == nil && q == 0 {
+					return false
+				}
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// acceptsNDJSON reports whether the request asks for NDJSON output.
+func acceptsNDJSON(r *http.Request) bool {
+	for _, field := range r.Header.Values("Accept") {
+		for _, typ := range strings.Split(field, ",") {
+			name, _, _ := strings.Cut(typ, ";")
+			if strings.EqualFold(strings.TrimSpace(name), ndjsonContentType) {
+				return true
+			}
+		}
+	}
+	return false
+}
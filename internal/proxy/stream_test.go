@@ -0,0 +1,278 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/innomon/adk2goose/gooseclient"
+	"github.com/innomon/adk2goose/translator"
+	"google.golang.org/genai"
+)
+
+func TestSSEWriter_Framing(t *testing.T) {
+	var b strings.Builder
+	sw := newSSEWriter(&b, nil)
+
+	evt := translator.NewErrorEvent("inv-1", "CODE", "line one\nline two")
+	if err := sw.write(evt); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := sw.write(evt); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	frames := strings.Split(strings.TrimSuffix(b.String(), "\n\n"), "\n\n")
+	if len(frames) != 2 {
+		t.Fatalf("expected 2 frames, got %d: %q", len(frames), b.String())
+	}
+	for _, frame := range frames {
+		payload, ok := strings.CutPrefix(frame, "data: ")
+		if !ok || strings.Contains(payload, "\n") {
+			t.Fatalf("malformed frame %q", frame)
+		}
+		var decoded translator.ADKEvent
+		if err := json.Unmarshal([]byte(payload), &decoded); err != nil {
+			t.Fatalf("decode frame: %v", err)
+		}
+		if decoded.ErrorMessage != "line one\nline two" {
+			t.Errorf("unexpected error message %q", decoded.ErrorMessage)
+		}
+	}
+}
+
+// frameWriter records each Write as one chunk.
+type frameWriter struct{ chunks []string }
+
+func (fw *frameWriter) Write(p []byte) (int, error) {
+	fw.chunks = append(fw.chunks, string(p))
+	return len(p), nil
+}
+
+// parseSSEFrame strictly parses one SSE frame, returning its ID and data.
+func parseSSEFrame(t *testing.T, frame string) (id, data string) {
+	t.Helper()
+	body, ok := strings.CutSuffix(frame, "\n\n")
+	if !ok || strings.ContainsRune(body, '\r') {
+		t.Fatalf("malformed frame %q", frame)
+	}
+	lines := strings.Split(body, "\n")
+	if len(lines) == 2 {
+		if id, ok = strings.CutPrefix(lines[0], "id: "); !ok || id == "" {
+			t.Fatalf("malformed id line in %q", frame)
+		}
+		lines = lines[1:]
+	}
+	if data, ok = strings.CutPrefix(lines[0], "data: "); len(lines) != 1 || !ok {
+		t.Fatalf("malformed frame %q", frame)
+	}
+	return id, data
+}
+
+func FuzzSSEWriter(f *testing.F) {
+	f.Add("inv-1:1", "hello", "")
+	f.Add("a\nb\r\nc", "line one\nline two\r\n\n", "data: injected\n\n")
+	f.Add("", "\u2028\u2029</script>", "\x00\xff\xfe")
+	f.Add("\n", strings.Repeat("x", 1<<16), ":comment\n\nid: 9")
+	f.Fuzz(func(t *testing.T, invocationID, text, message string) {
+		var fw frameWriter
+		sw := newSSEWriter(&fw, nil)
+		fanout := (&turnFanouts{}).start(SessionKey{App: "myapp", User: "user1", ID: "s1"}, invocationID, func() {})
+		evt := translator.NewContentEvent(invocationID, genai.NewContentFromText(text, genai.RoleModel))
+		evt.ErrorMessage = message
+		if err := sw.writePublished(fanout, evt); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		id := invocationID + ":1"
+		if len(fw.chunks) != 1 {
+			t.Fatalf("expected the frame in one write, got %d", len(fw.chunks))
+		}
+		gotID, data := parseSSEFrame(t, fw.chunks[0])
+		if sent, _, _ := fanout.join(0); len(sent) != 1 || string(sent[0]) != data {
+			t.Errorf("expected attached clients to get the written JSON, got %q", sent)
+		}
+		if !utf8.ValidString(gotID) || strings.ContainsAny(gotID, "\r\n\x00") {
+			t.Errorf("id %q is not a valid SSE field value", gotID)
+		}
+		if utf8.ValidString(id) && !strings.ContainsAny(id, "\r\n\x00") && gotID != id {
+			t.Errorf("expected id %q, got %q", id, gotID)
+		}
+		var decoded translator.ADKEvent
+		if err := json.Unmarshal([]byte(data), &decoded); err != nil {
+			t.Fatalf("decode frame: %v", err)
+		}
+		if utf8.ValidString(text) && decoded.Content.Parts[0].Text != text {
+			t.Errorf("text did not round-trip: %q != %q", decoded.Content.Parts[0].Text, text)
+		}
+		if utf8.ValidString(message) && decoded.ErrorMessage != message {
+			t.Errorf("error message did not round-trip: %q != %q", decoded.ErrorMessage, message)
+		}
+	})
+}
+
+func TestSSEWriter_MaxEventSize(t *testing.T) {
+	for _, ndjson := range []bool{false, true} {
+		var fw frameWriter
+		sw := newSSEWriter(&fw, nil)
+		if ndjson {
+			sw = newNDJSONWriter(&fw, nil)
+		}
+		sw.maxEvent = 1024
+		fanout := (&turnFanouts{}).start(SessionKey{App: "myapp", User: "user1", ID: "s1"}, "inv-1", func() {})
+
+		small := translator.NewContentEvent("inv-1", genai.NewContentFromText("short", genai.RoleModel))
+		large := translator.NewContentEvent("inv-1", genai.NewContentFromText(strings.Repeat("x", 4096), genai.RoleModel))
+		large.ID = "evt-large"
+		large.TurnComplete = true
+		for _, evt := range []*translator.ADKEvent{small, large} {
+			if err := sw.writePublished(fanout, evt); err != nil {
+				t.Fatalf("write: %v", err)
+			}
+		}
+		// Attached and resuming clients get the same replacement.
+		if sent, _, _ := fanout.join(0); len(sent) != 2 || len(sent[1]) > sw.maxEvent || !strings.Contains(string(sent[1]), eventTooLargeCode) {
+			t.Errorf("expected the replacement kept for resumption, got %q", sent)
+		}
+
+		var events []translator.ADKEvent
+		for _, chunk := range fw.chunks {
+			data := strings.TrimSuffix(chunk, "\n")
+			if !ndjson {
+				_, data = parseSSEFrame(t, chunk)
+			}
+			if len(data) > sw.maxEvent {
+				t.Errorf("event of %d bytes exceeds the limit", len(data))
+			}
+			var evt translator.ADKEvent
+			if err := json.Unmarshal([]byte(data), &evt); err != nil {
+				t.Fatalf("decode %q: %v", chunk, err)
+			}
+			events = append(events, evt)
+		}
+		if len(events) != 2 || events[0].Content == nil || events[0].ErrorCode != "" {
+			t.Fatalf("expected the small event unchanged, got %+v", events)
+		}
+		if got := events[1]; got.ErrorCode != eventTooLargeCode || got.ID != "evt-large" || !got.TurnComplete || got.Content != nil {
+			t.Errorf("expected an %s event in place of the large one, got %+v", eventTooLargeCode, got)
+		}
+	}
+}
+
+// benchmarkSSE is a representative streamed text chunk.
+var benchmarkSSE = gooseclient.SSEEvent{
+	Type: "Message",
+	Message: &gooseclient.GooseMessage{
+		Role:    "assistant",
+		Content: []gooseclient.MessageContent{{Type: "text", Text: strings.Repeat("streamed token ", 8)}},
+	},
+}
+
+// BenchmarkSSEWrite_Marshal measures the previous write path: a fresh event,
+// json.Marshal, and fmt.Fprintf per event.
+func BenchmarkSSEWrite_Marshal(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		evt, _ := translator.GooseSSEEventToADKEvent(&benchmarkSSE, "inv-bench")
+		data, err := json.Marshal(evt)
+		if err != nil {
+			b.Fatal(err)
+		}
+		fmt.Fprintf(io.Discard, "data: %s\n\n", data)
+	}
+}
+
+// BenchmarkSSEWrite_Reused measures the run_sse write path: a reused
+// encoder and pooled events, shared with the turn's fanout.
+func BenchmarkSSEWrite_Reused(b *testing.B) {
+	sw := newSSEWriter(io.Discard, nil)
+	turns := &turnFanouts{}
+	key := SessionKey{App: "myapp", User: "user1", ID: "s1"}
+	fanout := turns.start(key, "inv-bench", func() {})
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if i%1000 == 0 {
+			// Bound the events the fanout keeps, as turns do.
+			fanout = turns.start(key, "inv-bench", func() {})
+		}
+		evt, _ := translator.GooseSSEEventToADKEvent(&benchmarkSSE, "inv-bench")
+		if err := sw.writePublished(fanout, evt); err != nil {
+			b.Fatal(err)
+		}
+		translator.ReleaseEvent(evt)
+	}
+}
+
+func TestAcceptsGzip(t *testing.T) {
+	for header, want := range map[string]bool{
+		"":                     false,
+		"gzip":                 true,
+		"deflate, GZIP":        true,
+		"br;q=1.0, gzip;q=0.5": true,
+		"gzip;q=0":             false,
+		"identity":             false,
+	} {
+		r := httptest.NewRequest(http.MethodPost, "/", nil)
+		if header != "" {
+			r.Header.Set("Accept-Encoding", header)
+		}
+		if got := acceptsGzip(r); got != want {
+			t.Errorf("acceptsGzip(%q) = %v, want %v", header, got, want)
+		}
+	}
+}
+
+func TestNDJSONWriter_Framing(t *testing.T) {
+	var b strings.Builder
+	sw := newNDJSONWriter(&b, nil)
+
+	evt := translator.NewErrorEvent("inv-1", "CODE", "line one\nline two")
+	for range 2 {
+		if err := sw.write(evt); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+
+	lines := strings.Split(strings.TrimSuffix(b.String(), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines, got %d: %q", len(lines), b.String())
+	}
+	for _, line := range lines {
+		var decoded translator.ADKEvent
+		if err := json.Unmarshal([]byte(line), &decoded); err != nil {
+			t.Fatalf("decode line %q: %v", line, err)
+		}
+	}
+}
+
+func TestRunSSE_NDJSON(t *testing.T) {
+	_, proxySrv := setupProxy(t)
+	sessionID := createSession(t, proxySrv.URL, "myapp", "user1")
+
+	body, _ := json.Marshal(map[string]any{"new_message": map[string]any{"role": "user", "parts": []map[string]any{{"text": "hi"}}}})
+	req, _ := http.NewRequest(http.MethodPost,
+		fmt.Sprintf("%s/apps/myapp/users/user1/sessions/%s/run_sse", proxySrv.URL, sessionID), strings.NewReader(string(body)))
+	req.Header.Set("Accept", "application/x-ndjson")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("POST run_sse: %v", err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "application/x-ndjson" {
+		t.Fatalf("expected NDJSON content type, got %q", ct)
+	}
+
+	data, _ := io.ReadAll(resp.Body)
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 event lines, got %q", data)
+	}
+	var last map[string]any
+	if err := json.Unmarshal([]byte(lines[1]), &last); err != nil || last["turnComplete"] != true {
+		t.Fatalf("expected the turn-complete event last, got %q (%v)", lines[1], err)
+	}
+}
@@ -0,0 +1,77 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// newTapHub returns a hub that mirrors every event of a session's turns to
+// admin observers.
+func newTapHub() *pushHub {
+	return &pushHub{
+		subs:        make(map[string]map[chan []byte]struct{}),
+		subscribers: tapSubscribers,
+		dropped:     droppedTapEvents,
+	}
+}
+
+// handleAdminTap streams a copy of every event the session's turns send to
+// the ADK client, as SSE, until the observer disconnects or the session is
+// deleted. The client's stream is unaffected; a slow observer loses events
+// instead of holding up the turn. ?app= and ?user= pick the session when
+// its ID is used by more than one app or user.
+func (h *Handler) handleAdminTap(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("session")
+	app, user := r.URL.Query().Get("app"), r.URL.Query().Get("user")
+
+	var matches []SessionKey
+	for key := range h.sessions.ListMappedSessions() {
+		if key.ID == id && (app == "" || key.App == app) && (user == "" || key.User == user) {
+			matches = append(matches, key)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		writeError(w, http.StatusNotFound, fmt.Sprintf("%v: %s", ErrSessionNotFound, id))
+		return
+	case 1:
+	default:
+		writeError(w, http.StatusConflict, fmt.Sprintf("session %s exists for several apps or users; set ?app= and ?user=", id))
+		return
+	}
+	key := matches[0].String()
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "streaming not supported")
+		return
+	}
+
+	events := h.tap.subscribe(key)
+	defer h.tap.unsubscribe(key, events)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	ping := time.NewTicker(pushPingInterval)
+	defer ping.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ping.C:
+			fmt.Fprint(w, ": ping\n\n")
+			flusher.Flush()
+		case data, ok := <-events:
+			if !ok {
+				return
+			}
+			fmt.Fprintf(w, "data: %s\n\n", data)
+			flusher.Flush()
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package proxy
+
+import (
+	"github.com/innomon/adk2goose/internal/config"
+	"github.com/innomon/adk2goose/translator"
+	"google.golang.org/genai"
+)
+
+// includeThoughts reports whether thought parts should reach the client. A
+// request's generation_config.thinkingConfig.includeThoughts overrides the
+// app's stripThoughts setting.
+func includeThoughts(app config.AppConfig, gc *genai.GenerationConfig) bool {
+	if gc != nil && gc.ThinkingConfig != nil {
+		return gc.ThinkingConfig.IncludeThoughts
+	}
+	return !app.StripThoughts
+}
+
+// stripThoughts removes thought parts from evt's content, along with the
+// redacted-thinking metadata that describes them. It reports whether the
+// event still has anything to deliver.
+func stripThoughts(evt *translator.ADKEvent) bool {
+	if evt.Content == nil {
+		return true
+	}
+	parts := evt.Content.Parts[:0]
+	for _, p := range evt.Content.Parts {
+		if !p.Thought {
+			parts = append(parts, p)
+		}
+	}
+	evt.Content.Parts = parts
+	delete(evt.CustomMetadata, translator.RedactedThinkingMetadataKey)
+
+	return len(parts) > 0 || evt.TurnComplete || evt.ErrorCode != "" || evt.UsageMetadata != nil
+}
@@ -0,0 +1,170 @@
+package proxy
+
+import (
+	"encoding/json"
+	"path"
+	"strings"
+
+	"github.com/innomon/adk2goose/gooseclient"
+	"github.com/innomon/adk2goose/internal/config"
+	"github.com/innomon/adk2goose/internal/transform"
+	"github.com/innomon/adk2goose/translator"
+)
+
+// toolResultState applies an app's state rules and the configured transform
+// rules to the results of a turn's Goose tool calls. Tool responses carry
+// only the call ID, so it remembers the tool name of each request it sees.
+type toolResultState struct {
+	rules      []config.StateRule
+	transforms []transform.Rule
+	names      map[string]string // tool call ID → tool name
+}
+
+func newToolResultState(rules []config.StateRule, transforms []transform.Rule) *toolResultState {
+	if len(rules) == 0 && len(transforms) == 0 {
+		return nil
+	}
+	return &toolResultState{rules: rules, transforms: transforms, names: make(map[string]string)}
+}
+
+// extract returns the state delta the rules pull out of msg's tool
+// responses, or nil if there is none. It must see every message of the
+// turn, in order.
+func (s *toolResultState) extract(msg *gooseclient.GooseMessage) map[string]any {
+	if s == nil {
+		return nil
+	}
+	var delta map[string]any
+	for _, mc := range msg.Content {
+		if name := toolName(mc); name != "" {
+			s.names[mc.ID] = name
+			continue
+		}
+		if mc.Type != "toolResponse" || mc.ToolResult == nil || mc.ToolResult.IsError || mc.ToolResult.StructuredContent == nil {
+			continue
+		}
+		name := s.names[mc.ID]
+		for _, rule := range s.rules {
+			if ok, _ := path.Match(rule.Tool, name); !ok {
+				continue
+			}
+			value, ok := lookupField(mc.ToolResult.StructuredContent, rule.Field)
+			if !ok {
+				continue
+			}
+			if delta == nil {
+				delta = make(map[string]any)
+			}
+			delta[rule.StateKey()] = value
+		}
+	}
+	return delta
+}
+
+// reshape replaces the FunctionResponse payloads in evt, translated from
+// msg, of tools with a transform rule by the rule's output. Rules read the
+// result's structured_content or, failing that, its text parsed as JSON;
+// other results and errors are left as they are.
+func (s *toolResultState) reshape(msg *gooseclient.GooseMessage, evt *translator.ADKEvent) {
+	if s == nil || len(s.transforms) == 0 || evt.Content == nil {
+		return
+	}
+	for _, mc := range msg.Content {
+		if mc.Type != "toolResponse" || mc.ToolResult == nil || mc.ToolResult.IsError {
+			continue
+		}
+		rule := transform.Find(s.transforms, s.names[mc.ID])
+		if rule == nil {
+			continue
+		}
+		input, ok := toolResultDocument(mc.ToolResult)
+		if !ok {
+			continue
+		}
+		for _, part := range evt.Content.Parts {
+			if part.FunctionResponse != nil && part.FunctionResponse.ID == mc.ID {
+				part.FunctionResponse.Response = rule.Apply(input)
+			}
+		}
+	}
+}
+
+// flattenToolResults replaces the FunctionResponse payloads in evt,
+// translated from msg, of results with structured_content by the result's
+// text under "result", as for results without it.
+func flattenToolResults(msg *gooseclient.GooseMessage, evt *translator.ADKEvent) {
+	if evt.Content == nil {
+		return
+	}
+	for _, mc := range msg.Content {
+		if mc.Type != "toolResponse" || mc.ToolResult == nil || mc.ToolResult.StructuredContent == nil {
+			continue
+		}
+		for _, part := range evt.Content.Parts {
+			if part.FunctionResponse != nil && part.FunctionResponse.ID == mc.ID {
+				part.FunctionResponse.Response = map[string]any{"result": toolResultText(mc.ToolResult)}
+			}
+		}
+	}
+}
+
+// toolResultText returns a result's first text content, or its
+// structured_content as JSON.
+func toolResultText(tr *gooseclient.ToolResult) string {
+	for _, c := range tr.Content {
+		if c.Type == "text" && c.Text != "" {
+			return c.Text
+		}
+	}
+	b, _ := json.Marshal(tr.StructuredContent)
+	return string(b)
+}
+
+// toolResultDocument returns the JSON document a tool result carries.
+func toolResultDocument(tr *gooseclient.ToolResult) (any, bool) {
+	if tr.StructuredContent != nil {
+		return tr.StructuredContent, true
+	}
+	for _, c := range tr.Content {
+		if c.Type != "text" {
+			continue
+		}
+		var doc any
+		if err := json.Unmarshal([]byte(c.Text), &doc); err == nil {
+			return doc, true
+		}
+		break
+	}
+	return nil, false
+}
+
+// lookupField returns the value at the dot-separated path field in m.
+func lookupField(m map[string]any, field string) (any, bool) {
+	var value any = m
+	for _, name := range strings.Split(field, ".") {
+		obj, ok := value.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		if value, ok = obj[name]; !ok {
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+// addStateDelta merges delta into evt's stateDelta.
+func addStateDelta(evt *translator.ADKEvent, delta map[string]any) {
+	if len(delta) == 0 {
+		return
+	}
+	if evt.Actions == nil {
+		evt.Actions = &translator.ADKEventActions{}
+	}
+	if evt.Actions.StateDelta == nil {
+		evt.Actions.StateDelta = make(map[string]any, len(delta))
+	}
+	for k, v := range delta {
+		evt.Actions.StateDelta[k] = v
+	}
+}
@@ -0,0 +1,203 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/innomon/adk2goose/gooseclient"
+	"github.com/innomon/adk2goose/internal/config"
+	"github.com/innomon/adk2goose/internal/policy"
+	"github.com/innomon/adk2goose/translator"
+	"google.golang.org/genai"
+)
+
+// AddArgumentHook registers a hook that runs against the arguments of every
+// Goose tool call, after the app's configured argument rules.
+func (h *Handler) AddArgumentHook(hook policy.ArgumentHook) {
+	h.argHooks = append(h.argHooks, hook)
+}
+
+// enforceToolPolicy removes tool requests that are denied by the app's tool
+// policy or rejected by an argument hook from msg, and returns ADK events
+// explaining why the tools were blocked. Confirmation requests the app's
+// approval policy can decide are answered on the user's behalf and removed
+// as well; the rest are left in msg so they escalate to the ADK client.
+//
+// In approve mode Goose announces a call as a toolRequest and then asks for
+// it in a toolConfirmationRequest with the same ID, and only the latter can
+// be answered. A blocked call is reported the first time either part is
+// seen and denied on its confirmation request; blocked holds the IDs of the
+// turn's blocked calls, so the other part is dropped without a second
+// report. It fails if Goose cannot be given an answer: a call the proxy
+// cannot deny must not be left to run, so the turn has to end.
+func (h *Handler) enforceToolPolicy(ctx context.Context, key SessionKey, gooseSessionID, invocationID string, msg *gooseclient.GooseMessage, denied map[string]bool) ([]*translator.ADKEvent, error) {
+	var blocked []*translator.ADKEvent
+	kept := make([]gooseclient.MessageContent, 0, len(msg.Content))
+	for _, mc := range msg.Content {
+		if mc.PartialToolRequest() {
+			// Pieces of a call to a denied tool are dropped; the complete
+			// call is blocked when it arrives.
+			if allowed, _ := h.cfg.App(key.App).ToolPolicy.Check(mc.ToolCall.Name); allowed {
+				kept = append(kept, mc)
+			}
+			continue
+		}
+		name := toolName(mc)
+		if name == "" {
+			kept = append(kept, mc)
+			continue
+		}
+		if denied[mc.ID] {
+			if mc.Type == "toolConfirmationRequest" {
+				if err := h.confirmTool(ctx, gooseSessionID, mc.ID, false); err != nil {
+					return blocked, err
+				}
+			}
+			continue
+		}
+		args := toolArguments(mc)
+		code, reason := h.checkToolCall(key, name, args)
+		if code == "" && mc.Type == "toolConfirmationRequest" {
+			switch h.cfg.App(key.App).Approval.Decide(key.User, name, args) {
+			case policy.ApprovalApprove:
+				log.Printf("session %s: auto-approved tool call %s (%s)", gooseSessionID, mc.ID, name)
+				if err := h.confirmTool(ctx, gooseSessionID, mc.ID, true); err != nil {
+					return blocked, err
+				}
+				continue
+			case policy.ApprovalDeny:
+				code, reason = "TOOL_DENIED", fmt.Sprintf("tool %q denied by approval policy", name)
+			}
+		}
+		if code == "" {
+			kept = append(kept, mc)
+			continue
+		}
+
+		log.Printf("session %s: blocked tool call %s: %s", gooseSessionID, mc.ID, reason)
+		denied[mc.ID] = true
+		if mc.Type == "toolConfirmationRequest" {
+			if err := h.confirmTool(ctx, gooseSessionID, mc.ID, false); err != nil {
+				return blocked, err
+			}
+		}
+		h.publishLifecycle(config.WebhookToolDenied, key, map[string]any{
+			"invocationId": invocationID,
+			"tool":         name,
+			"errorCode":    code,
+			"reason":       reason,
+		})
+		blocked = append(blocked, translator.NewErrorEvent(invocationID, code, reason))
+	}
+	msg.Content = kept
+
+	return blocked, nil
+}
+
+// isToolDenial reports whether an ADK error code reports a tool call blocked
+// by policy, which is delivered to webhooks as tool.denied rather than as an
+// error.
+func isToolDenial(code string) bool {
+	return code == "TOOL_DENIED" || code == "TOOL_ARGUMENT_REJECTED"
+}
+
+// confirmTool answers a pending Goose tool call, logging and returning any
+// failure.
+func (h *Handler) confirmTool(ctx context.Context, gooseSessionID, requestID string, approved bool) error {
+	err := h.client.ConfirmTool(ctx, &gooseclient.ToolConfirmationRequest{
+		SessionID: gooseSessionID,
+		RequestID: requestID,
+		Approved:  approved,
+	})
+	if err != nil {
+		log.Printf("confirm tool call %s (approved=%t): %v", requestID, approved, err)
+		return fmt.Errorf("answer tool call %s: %w", requestID, err)
+	}
+	return nil
+}
+
+// checkToolCall applies the app's tool policy and argument hooks to a tool
+// call. It returns an empty code if the call may proceed, otherwise an ADK
+// error code and the reason the call was blocked. Goose can only be told to
+// run or deny a call, not given other arguments, so a call whose arguments a
+// hook rewrote is blocked rather than approved as Goose asked for it.
+func (h *Handler) checkToolCall(key SessionKey, name string, args map[string]any) (code, reason string) {
+	appCfg := h.cfg.App(key.App)
+	if allowed, reason := appCfg.ToolPolicy.Check(name); !allowed {
+		return "TOOL_DENIED", reason
+	}
+
+	hooks := make([]policy.ArgumentHook, 0, len(appCfg.ArgumentRules)+len(h.argHooks))
+	for i := range appCfg.ArgumentRules {
+		hooks = append(hooks, appCfg.ArgumentRules[i].Hook(h.sessions.workingDirOf(key)))
+	}
+	hooks = append(hooks, h.argHooks...)
+
+	before, _ := json.Marshal(args)
+	for _, hook := range hooks {
+		if err := hook(name, args); err != nil {
+			return "TOOL_ARGUMENT_REJECTED", err.Error()
+		}
+	}
+	if after, _ := json.Marshal(args); !bytes.Equal(before, after) {
+		return "TOOL_ARGUMENT_REJECTED", fmt.Sprintf("tool %q arguments were rewritten by an argument hook, which Goose cannot be given", name)
+	}
+	return "", ""
+}
+
+// toolName returns the name of the tool a Goose content part asks to run, or
+// "" if the part is not a tool request. A piece of a tool request still
+// being streamed asks to run nothing yet; policies apply to the complete
+// request.
+func toolName(mc gooseclient.MessageContent) string {
+	switch mc.Type {
+	case "toolRequest":
+		if mc.ToolCall != nil && !mc.PartialToolRequest() {
+			return mc.ToolCall.Name
+		}
+	case "toolConfirmationRequest":
+		return mc.ToolName
+	}
+	return ""
+}
+
+// toolArguments returns the arguments of a Goose tool request part.
+func toolArguments(mc gooseclient.MessageContent) map[string]any {
+	if mc.Type == "toolRequest" && mc.ToolCall != nil {
+		return mc.ToolCall.Arguments
+	}
+	return mc.Arguments
+}
+
+// handleListTools returns the tools available to the session's Goose agent
+// as ADK function declarations, leaving out those the app's tool policy
+// denies.
+func (h *Handler) handleListTools(w http.ResponseWriter, r *http.Request) {
+	app := r.PathValue("app")
+	key := sessionKey(r)
+
+	gooseSessionID, ok := h.sessions.GetGooseSessionID(key)
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("%v: %s", ErrSessionNotFound, key))
+		return
+	}
+	tools, err := h.client.ListTools(r.Context(), gooseSessionID)
+	if err != nil {
+		writeError(w, http.StatusBadGateway, fmt.Sprintf("list tools: %v", err))
+		return
+	}
+
+	toolPolicy := h.cfg.App(app).ToolPolicy
+	decls := make([]*genai.FunctionDeclaration, 0, len(tools))
+	for i := range tools {
+		if allowed, _ := toolPolicy.Check(tools[i].Name); !allowed {
+			continue
+		}
+		decls = append(decls, translator.GooseToolToADKFunctionDeclaration(&tools[i]))
+	}
+	writeJSON(w, http.StatusOK, decls)
+}
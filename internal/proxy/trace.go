@@ -0,0 +1,38 @@
+package proxy
+
+import (
+	"net/http"
+
+	"github.com/innomon/adk2goose/gooseclient"
+	"github.com/innomon/adk2goose/translator"
+)
+
+// traceMetadataKey carries, in the custom metadata of the first event of a
+// turn, the trace context its Goose requests were sent with.
+const traceMetadataKey = "goose:trace"
+
+// withTrace returns r with a context carrying the trace the request
+// continues, or starts, so every Goose request made for it joins the trace.
+// The correlation ID, taken from X-Correlation-ID or X-Request-ID if the
+// client sent one, is echoed in the response.
+func withTrace(w http.ResponseWriter, r *http.Request) *http.Request {
+	correlationID := r.Header.Get(gooseclient.CorrelationIDHeader)
+	if correlationID == "" {
+		correlationID = r.Header.Get("X-Request-ID")
+	}
+	tc := gooseclient.NewTraceContext(r.Header.Get("traceparent"), r.Header.Get("tracestate"), correlationID)
+	w.Header().Set(gooseclient.CorrelationIDHeader, tc.CorrelationID)
+	return r.WithContext(gooseclient.WithTraceContext(r.Context(), tc))
+}
+
+// stampTrace records on evt the trace context of the request it is sent for.
+func stampTrace(evt *translator.ADKEvent, r *http.Request) {
+	tc, ok := gooseclient.TraceContextFrom(r.Context())
+	if !ok {
+		return
+	}
+	if evt.CustomMetadata == nil {
+		evt.CustomMetadata = make(map[string]any)
+	}
+	evt.CustomMetadata[traceMetadataKey] = tc
+}
@@ -0,0 +1,82 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"unicode/utf8"
+
+	"github.com/innomon/adk2goose/translator"
+)
+
+// toolResultArtifactPrefix names the artifacts holding full tool results.
+const toolResultArtifactPrefix = "tool-results/"
+
+// truncateToolResults shortens function responses in evt whose result text
+// exceeds ToolResultMaxBytes. The full text is saved as a session artifact
+// and the response keeps a preview plus a reference to it. The artifact is
+// also reported in the event's artifactDelta. Structured responses are
+// measured by their JSON, which is saved whole and previewed as text.
+func (h *Handler) truncateToolResults(app, user, adkSessionID string, evt *translator.ADKEvent) {
+	limit := h.cfg.ToolResultMaxBytes
+	if limit <= 0 || evt.Content == nil {
+		return
+	}
+	for _, part := range evt.Content.Parts {
+		fr := part.FunctionResponse
+		if fr == nil {
+			continue
+		}
+		ext := ".txt"
+		result, ok := fr.Response["result"].(string)
+		if !ok || len(fr.Response) > 1 {
+			data, err := json.Marshal(fr.Response)
+			if err != nil {
+				continue
+			}
+			ext, result = ".json", string(data)
+		}
+		if len(result) <= limit {
+			continue
+		}
+
+		name := toolResultArtifactPrefix + fr.ID + ext
+		version, err := h.artifacts.saveData(SessionKey{App: app, User: user, ID: adkSessionID}.String(), name, []byte(result))
+		if err != nil {
+			log.Printf("session %s: spill tool result %s: %v", adkSessionID, fr.ID, err)
+			continue
+		}
+		truncatedToolResults.Inc()
+
+		if ext == ".json" {
+			fr.Response = make(map[string]any)
+		}
+		fr.Response["result"] = truncateUTF8(result, limit)
+		fr.Response["truncated"] = true
+		fr.Response["originalBytes"] = len(result)
+		fr.Response["artifact"] = name
+		fr.Response["artifactVersion"] = version
+		fr.Response["artifactUrl"] = fmt.Sprintf("/apps/%s/users/%s/sessions/%s/artifacts/%s/versions/%d",
+			url.PathEscape(app), url.PathEscape(user), url.PathEscape(adkSessionID), url.PathEscape(name), version)
+
+		if evt.Actions == nil {
+			evt.Actions = &translator.ADKEventActions{}
+		}
+		if evt.Actions.ArtifactDelta == nil {
+			evt.Actions.ArtifactDelta = make(map[string]int)
+		}
+		evt.Actions.ArtifactDelta[name] = version
+	}
+}
+
+// truncateUTF8 cuts s to at most n bytes without splitting a character.
+func truncateUTF8(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
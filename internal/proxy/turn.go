@@ -0,0 +1,72 @@
+package proxy
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/innomon/adk2goose/gooseclient"
+)
+
+// turnStats accumulates timings and activity for one run_sse turn.
+type turnStats struct {
+	start        time.Time
+	replyStarted time.Duration // until Goose accepted the /reply request
+	firstEvent   time.Duration // until the first Goose SSE event arrived
+	events       int
+	toolCalls    []string
+	llmCalls     int
+	totalTokens  int32
+}
+
+func newTurnStats() *turnStats {
+	return &turnStats{start: time.Now()}
+}
+
+// replyAccepted records that Goose has started streaming its reply.
+func (s *turnStats) replyAccepted() {
+	s.replyStarted = time.Since(s.start)
+}
+
+// observe records a Goose SSE event.
+func (s *turnStats) observe(sse *gooseclient.SSEEvent) {
+	if s.events == 0 {
+		s.firstEvent = time.Since(s.start)
+	}
+	s.events++
+
+	if sse.Message != nil {
+		for _, mc := range sse.Message.Content {
+			if name := toolName(mc); name != "" && mc.Type == "toolRequest" {
+				s.toolCalls = append(s.toolCalls, name)
+			}
+		}
+	}
+	if sse.TokenState != nil {
+		s.totalTokens = sse.TokenState.TotalTokens
+	}
+}
+
+// reportSlowTurn logs a structured warning if the turn exceeded the
+// configured duration or token thresholds.
+func (h *Handler) reportSlowTurn(s *turnStats, app, user, adkSessionID, invocationID string) {
+	elapsed := time.Since(s.start)
+	slowDuration := h.cfg.SlowTurnThreshold > 0 && elapsed >= h.cfg.SlowTurnThreshold
+	slowTokens := h.cfg.SlowTurnTokens > 0 && int(s.totalTokens) >= h.cfg.SlowTurnTokens
+	if !slowDuration && !slowTokens {
+		return
+	}
+
+	slog.Warn("slow turn",
+		"app", app,
+		"user", user,
+		"session", adkSessionID,
+		"invocation", invocationID,
+		"duration", elapsed,
+		"gooseReplyStart", s.replyStarted,
+		"gooseFirstEvent", s.firstEvent,
+		"events", s.events,
+		"llmCalls", s.llmCalls,
+		"toolCalls", s.toolCalls,
+		"totalTokens", s.totalTokens,
+	)
+}
@@ -0,0 +1,32 @@
+package proxy
+
+import "sync"
+
+// turnLocks ensures at most one turn runs per Goose session at a time, since
+// concurrent replies on one session would interleave its conversation.
+type turnLocks struct {
+	mu     sync.Mutex
+	active map[string]struct{}
+}
+
+// tryAcquire marks a turn as running on gooseSessionID, reporting false if
+// one already is.
+func (l *turnLocks) tryAcquire(gooseSessionID string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, busy := l.active[gooseSessionID]; busy {
+		return false
+	}
+	if l.active == nil {
+		l.active = make(map[string]struct{})
+	}
+	l.active[gooseSessionID] = struct{}{}
+	return true
+}
+
+// release ends the turn running on gooseSessionID.
+func (l *turnLocks) release(gooseSessionID string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.active, gooseSessionID)
+}
@@ -0,0 +1,187 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/innomon/adk2goose/internal/policy"
+	"google.golang.org/genai"
+)
+
+// uploadsDir is the folder, relative to the Goose working directory, that
+// file attachments are written to.
+const uploadsDir = "uploads"
+
+// attachment describes a file materialized for Goose, or one it has to
+// fetch itself.
+type attachment struct {
+	path     string // absolute path in the working directory, if written
+	uri      string // original fileData URI, if not downloaded
+	mimeType string
+	size     int
+}
+
+// materializeFiles returns content with its file parts written into the
+// uploads folder under root, in its subfolder sub if not empty, and replaced by a single leading text part
+// telling Goose where to find them. File parts are fileData parts and
+// inlineData parts that are not images; images stay inline since Goose
+// passes them to the model directly. fileData with a URI fetch allows is
+// downloaded, up to maxBytes if positive; other URIs are only listed in the
+// note. content itself is not modified; without file parts it is returned as is.
+func materializeFiles(ctx context.Context, content *genai.Content, root, sub string, fetch *egressPolicy, maxBytes int64) (*genai.Content, error) {
+	var files []attachment
+	var parts []*genai.Part
+	for _, part := range content.Parts {
+		switch {
+		case part != nil && part.InlineData != nil && !strings.HasPrefix(part.InlineData.MIMEType, "image/"):
+			p, err := writeUpload(root, sub, part.InlineData.DisplayName, part.InlineData.MIMEType, part.InlineData.Data)
+			if err != nil {
+				return nil, err
+			}
+			files = append(files, attachment{path: p, mimeType: part.InlineData.MIMEType, size: len(part.InlineData.Data)})
+		case part != nil && part.FileData != nil:
+			a, err := fetchFileData(ctx, root, sub, fetch, part.FileData, maxBytes)
+			if err != nil {
+				return nil, err
+			}
+			files = append(files, a)
+		default:
+			parts = append(parts, part)
+		}
+	}
+	if len(files) == 0 {
+		return content, nil
+	}
+	materializedFiles.Add(float64(len(files)))
+
+	note := genai.NewPartFromText(attachmentNote(files))
+	return &genai.Content{Role: content.Role, Parts: append([]*genai.Part{note}, parts...)}, nil
+}
+
+// fetchFileData downloads a fileData part whose URI fetch allows into the
+// uploads folder. Other URIs are left for Goose to resolve.
+func fetchFileData(ctx context.Context, root, sub string, fetch *egressPolicy, fd *genai.FileData, maxBytes int64) (attachment, error) {
+	u, err := url.Parse(fd.FileURI)
+	if err != nil || !fetch.allows(u) {
+		return attachment{uri: fd.FileURI, mimeType: fd.MIMEType}, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fd.FileURI, nil)
+	if err != nil {
+		return attachment{}, fmt.Errorf("fetch %s: %w", fd.FileURI, err)
+	}
+	resp, err := fetch.http.Do(req)
+	if err != nil {
+		return attachment{}, fmt.Errorf("fetch %s: %w", fd.FileURI, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return attachment{}, fmt.Errorf("fetch %s: status %d", fd.FileURI, resp.StatusCode)
+	}
+	body := io.Reader(resp.Body)
+	if maxBytes > 0 {
+		body = io.LimitReader(resp.Body, maxBytes+1)
+	}
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return attachment{}, fmt.Errorf("fetch %s: %w", fd.FileURI, err)
+	}
+	if maxBytes > 0 && int64(len(data)) > maxBytes {
+		return attachment{}, fmt.Errorf("fetch %s: file exceeds %d bytes", fd.FileURI, maxBytes)
+	}
+
+	name := fd.DisplayName
+	if name == "" {
+		name = path.Base(u.Path)
+	}
+	mimeType := fd.MIMEType
+	if mimeType == "" {
+		mimeType = resp.Header.Get("Content-Type")
+	}
+	p, err := writeUpload(root, sub, name, mimeType, data)
+	if err != nil {
+		return attachment{}, err
+	}
+	return attachment{path: p, mimeType: mimeType, size: len(data)}, nil
+}
+
+// writeUpload writes data into the uploads folder under root, or its
+// subfolder sub, and returns its absolute path, refusing to write through
+// symlinks that lead out of root. The file keeps its display name when it
+// has a usable one; a different file already stored under that name gets a
+// hash prefix.
+func writeUpload(root, sub, name, mimeType string, data []byte) (string, error) {
+	dir, err := filepath.Abs(filepath.Join(root, uploadsDir, sub))
+	if err != nil {
+		return "", fmt.Errorf("write upload: %w", err)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("write upload: %w", err)
+	}
+	if dir, err = policy.ResolveWithin(root, dir); err != nil {
+		return "", fmt.Errorf("write upload: %w", err)
+	}
+
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:4])
+	name = uploadName(name)
+	if name == "" {
+		ext, ok := inlineDataExtensions[mimeType]
+		if !ok {
+			ext = ".bin"
+		}
+		name = hash + ext
+	}
+
+	p := filepath.Join(dir, name)
+	if _, err := policy.ResolveWithin(dir, p); err != nil {
+		return "", fmt.Errorf("write upload: %w", err)
+	}
+	if existing, err := os.ReadFile(p); err == nil {
+		if bytes.Equal(existing, data) {
+			return p, nil
+		}
+		p = filepath.Join(dir, hash+"-"+name)
+		if _, err := policy.ResolveWithin(dir, p); err != nil {
+			return "", fmt.Errorf("write upload: %w", err)
+		}
+	}
+	if err := os.WriteFile(p, data, 0o644); err != nil {
+		return "", fmt.Errorf("write upload: %w", err)
+	}
+	return p, nil
+}
+
+// uploadName reduces a client-supplied file name to a safe base name, or ""
+// if nothing usable remains.
+func uploadName(name string) string {
+	name = filepath.Base(filepath.FromSlash(strings.ReplaceAll(name, `\`, "/")))
+	if name == "." || name == ".." || name == string(filepath.Separator) || strings.HasPrefix(name, ".") {
+		return ""
+	}
+	return name
+}
+
+// attachmentNote is the text Goose receives in place of the file parts.
+func attachmentNote(files []attachment) string {
+	var b strings.Builder
+	b.WriteString("The user attached the following files:")
+	for _, f := range files {
+		if f.path != "" {
+			fmt.Fprintf(&b, "\n- %s (%s, %d bytes)", f.path, f.mimeType, f.size)
+			continue
+		}
+		fmt.Fprintf(&b, "\n- %s (%s, not downloaded)", f.uri, f.mimeType)
+	}
+	return b.String()
+}
@@ -0,0 +1,248 @@
+package proxy
+
+import (
+	"cmp"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+
+	"github.com/innomon/adk2goose/gooseclient"
+	"github.com/innomon/adk2goose/translator"
+)
+
+const (
+	// estimatedCostMetadataKey is the customMetadata key under which a
+	// turn's final event reports its estimated cost.
+	estimatedCostMetadataKey = "goose:estimatedCost"
+
+	// estimatedCostTrailer carries a turn's estimated cost to clients that
+	// accept trailers.
+	estimatedCostTrailer = "X-Estimated-Cost"
+)
+
+// Usage is token usage and its estimated cost. Cost is zero when no price
+// is configured for the model.
+type Usage struct {
+	InputTokens   int64   `json:"inputTokens"`
+	OutputTokens  int64   `json:"outputTokens"`
+	EstimatedCost float64 `json:"estimatedCost"`
+}
+
+func (u *Usage) add(o Usage) {
+	u.InputTokens += o.InputTokens
+	u.OutputTokens += o.OutputTokens
+	u.EstimatedCost += o.EstimatedCost
+}
+
+// sessionUsage is a session's usage, with Goose's accumulated token counts
+// as of its last turn.
+type sessionUsage struct {
+	Usage
+	accumulatedInput, accumulatedOutput int32
+}
+
+// usageLedger accumulates token usage and estimated cost per session, user,
+// and app.
+type usageLedger struct {
+	mu       sync.Mutex
+	sessions map[SessionKey]*sessionUsage
+	users    map[SessionKey]*Usage // keyed by app and user
+	apps     map[string]*Usage
+}
+
+// usageTotals is the usage of a turn and the totals it adds to.
+type usageTotals struct {
+	Turn, Session, User, App Usage
+}
+
+// record adds a turn's usage, from the token state of its Finish event, to
+// its session's, user's, and app's. The turn's tokens are the growth of
+// Goose's accumulated counts since the session's last turn, or the token
+// state's own counts if Goose does not accumulate.
+func (l *usageLedger) record(key SessionKey, price func(in, out int64) float64, ts *gooseclient.TokenState) usageTotals {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.sessions == nil {
+		l.sessions = make(map[SessionKey]*sessionUsage)
+		l.users = make(map[SessionKey]*Usage)
+		l.apps = make(map[string]*Usage)
+	}
+	s, ok := l.sessions[key]
+	if !ok {
+		s = &sessionUsage{}
+		l.sessions[key] = s
+	}
+	userKey := SessionKey{App: key.App, User: key.User}
+	user, ok := l.users[userKey]
+	if !ok {
+		user = &Usage{}
+		l.users[userKey] = user
+	}
+	app, ok := l.apps[key.App]
+	if !ok {
+		app = &Usage{}
+		l.apps[key.App] = app
+	}
+
+	var turn Usage
+	if ts.AccumulatedInputTokens > 0 || ts.AccumulatedOutputTokens > 0 {
+		turn.InputTokens = int64(max(ts.AccumulatedInputTokens-s.accumulatedInput, 0))
+		turn.OutputTokens = int64(max(ts.AccumulatedOutputTokens-s.accumulatedOutput, 0))
+		s.accumulatedInput, s.accumulatedOutput = ts.AccumulatedInputTokens, ts.AccumulatedOutputTokens
+	} else {
+		turn.InputTokens = int64(ts.InputTokens)
+		turn.OutputTokens = int64(ts.OutputTokens)
+	}
+	if price != nil {
+		turn.EstimatedCost = price(turn.InputTokens, turn.OutputTokens)
+	}
+	s.add(turn)
+	user.add(turn)
+	app.add(turn)
+	return usageTotals{Turn: turn, Session: s.Usage, User: *user, App: *app}
+}
+
+// purgeUser removes user's session and user usage rows, in app or, if app
+// is empty, in every app, returning how many there were. With dryRun it
+// only counts them. App totals keep the user's usage, as they identify no
+// one.
+func (l *usageLedger) purgeUser(app, user string, dryRun bool) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	n := 0
+	for key := range l.sessions {
+		if (app == "" || key.App == app) && key.User == user {
+			n++
+			if !dryRun {
+				delete(l.sessions, key)
+			}
+		}
+	}
+	for key := range l.users {
+		if (app == "" || key.App == app) && key.User == user {
+			n++
+			if !dryRun {
+				delete(l.users, key)
+			}
+		}
+	}
+	return n
+}
+
+// UsageReport is the admin usage endpoint's response: usage per session,
+// and summed per user and per app.
+type UsageReport struct {
+	Sessions []SessionUsage `json:"sessions"`
+	Users    []UserUsage    `json:"users"`
+	Apps     []AppUsage     `json:"apps"`
+	Total    Usage          `json:"total"`
+}
+
+// SessionUsage is one session's entry in a UsageReport.
+type SessionUsage struct {
+	App     string `json:"app"`
+	User    string `json:"user"`
+	Session string `json:"session"`
+	Usage
+}
+
+// UserUsage is one user's entry in a UsageReport.
+type UserUsage struct {
+	App  string `json:"app"`
+	User string `json:"user"`
+	Usage
+}
+
+// AppUsage is one app's entry in a UsageReport.
+type AppUsage struct {
+	App string `json:"app"`
+	Usage
+}
+
+// report summarizes the ledger, limited to app if it is not empty.
+func (l *usageLedger) report(app string) UsageReport {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	rep := UsageReport{Sessions: []SessionUsage{}, Users: []UserUsage{}, Apps: []AppUsage{}}
+	for key, s := range l.sessions {
+		if app == "" || key.App == app {
+			rep.Sessions = append(rep.Sessions, SessionUsage{App: key.App, User: key.User, Session: key.ID, Usage: s.Usage})
+		}
+	}
+	for key, u := range l.users {
+		if app == "" || key.App == app {
+			rep.Users = append(rep.Users, UserUsage{App: key.App, User: key.User, Usage: *u})
+		}
+	}
+	for name, u := range l.apps {
+		if app == "" || name == app {
+			rep.Apps = append(rep.Apps, AppUsage{App: name, Usage: *u})
+			rep.Total.add(*u)
+		}
+	}
+
+	slices.SortFunc(rep.Sessions, func(a, b SessionUsage) int {
+		return cmp.Or(cmp.Compare(a.App, b.App), cmp.Compare(a.User, b.User), cmp.Compare(a.Session, b.Session))
+	})
+	slices.SortFunc(rep.Users, func(a, b UserUsage) int {
+		return cmp.Or(cmp.Compare(a.App, b.App), cmp.Compare(a.User, b.User))
+	})
+	slices.SortFunc(rep.Apps, func(a, b AppUsage) int {
+		return cmp.Compare(a.App, b.App)
+	})
+	return rep
+}
+
+// turnPrice returns the price function for the model serving a turn, or
+// nil if the model has no configured price.
+func (h *Handler) turnPrice(model string) func(in, out int64) float64 {
+	p, ok := h.cfg.Price(model)
+	if !ok {
+		return nil
+	}
+	return p.Cost
+}
+
+// recordTurnUsage adds a turn's usage to its session's, user's, and app's,
+// alerting budgets it crosses. If the model has a price, the estimated cost
+// is reported on the turn's final event and in the cost trailer.
+func (h *Handler) recordTurnUsage(w http.ResponseWriter, key SessionKey, model string, ts *gooseclient.TokenState, evt *translator.ADKEvent) {
+	price := h.turnPrice(model)
+	totals := h.usage.record(key, price, ts)
+	h.checkBudgets(key, totals)
+	if price == nil {
+		return
+	}
+	if evt.CustomMetadata == nil {
+		evt.CustomMetadata = make(map[string]any)
+	}
+	evt.CustomMetadata[estimatedCostMetadataKey] = map[string]any{
+		"model":   model,
+		"turn":    totals.Turn.EstimatedCost,
+		"session": totals.Session.EstimatedCost,
+	}
+	w.Header().Set(estimatedCostTrailer, formatCost(totals.Turn.EstimatedCost))
+}
+
+// acceptsTrailers reports whether the client asked for response trailers.
+func acceptsTrailers(r *http.Request) bool {
+	for _, te := range r.Header.Values("TE") {
+		if te == "trailers" {
+			return true
+		}
+	}
+	return false
+}
+
+// formatCost formats an estimated cost for the cost trailer.
+func formatCost(cost float64) string {
+	return strconv.FormatFloat(cost, 'f', -1, 64)
+}
+
+// handleAdminUsage reports token usage and estimated cost per session, user,
+// and app, optionally limited to ?app=.
+func (h *Handler) handleAdminUsage(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, h.usage.report(r.URL.Query().Get("app")))
+}
@@ -0,0 +1,257 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/innomon/adk2goose/translator"
+	"google.golang.org/genai"
+)
+
+var (
+	contentType = reflect.TypeFor[genai.Content]()
+	partType    = reflect.TypeFor[genai.Part]()
+	rawType     = reflect.TypeFor[json.RawMessage]()
+	unmarshaler = reflect.TypeFor[json.Unmarshaler]()
+)
+
+// partData lists the fields of a genai.Part that carry its data; a part
+// sets exactly one. Thought, thoughtSignature, and the like qualify it.
+var partData = []string{"text", "inlineData", "fileData", "functionCall", "functionResponse", "executableCode", "codeExecutionResult"}
+
+// validateBody checks a JSON request body against the ADK API shape of
+// v's type before it is decoded: objects may carry only the fields their
+// type declares, values must have the declared JSON types, and content
+// must have a known role and well-formed parts. Errors name the invalid
+// field by its path in the body, such as new_message.parts[1].inlineData.
+func validateBody(body []byte, v any) error {
+	if len(bytes.TrimSpace(body)) == 0 {
+		return nil
+	}
+	var raw json.RawMessage
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return fmt.Errorf("decode request: %v", err)
+	}
+	return checkValue("", raw, reflect.TypeOf(v))
+}
+
+// checkValue checks the JSON value raw, at path, against type t.
+func checkValue(path string, raw json.RawMessage, t reflect.Type) error {
+	if string(raw) == "null" {
+		return nil
+	}
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == rawType || reflect.PointerTo(t).Implements(unmarshaler) {
+		return nil
+	}
+
+	switch t.Kind() {
+	case reflect.Interface:
+		return nil
+	case reflect.Struct:
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &fields); err != nil {
+			return typeError(path, "an object")
+		}
+		if err := checkFields(path, fields, t); err != nil {
+			return err
+		}
+		switch t {
+		case contentType:
+			return checkContent(path, fields)
+		case partType:
+			return checkPart(path, fields)
+		}
+		return nil
+	case reflect.Map:
+		var entries map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &entries); err != nil {
+			return typeError(path, "an object")
+		}
+		for _, k := range sortedFields(entries) {
+			if err := checkValue(joinPath(path, k), entries[k], t.Elem()); err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			// Bytes are base64 strings.
+			return checkKind(path, raw, '"', "a base64 string")
+		}
+		var items []json.RawMessage
+		if err := json.Unmarshal(raw, &items); err != nil {
+			return typeError(path, "an array")
+		}
+		for i, item := range items {
+			if err := checkValue(fmt.Sprintf("%s[%d]", path, i), item, t.Elem()); err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.String:
+		return checkKind(path, raw, '"', "a string")
+	case reflect.Bool:
+		if s := string(raw); s != "true" && s != "false" {
+			return typeError(path, "a boolean")
+		}
+		return nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Float32, reflect.Float64:
+		var n json.Number
+		if err := json.Unmarshal(raw, &n); err != nil || raw[0] == '"' {
+			return typeError(path, "a number")
+		}
+		return nil
+	}
+	return nil
+}
+
+// checkFields checks an object's fields against struct type t, rejecting
+// fields t does not declare.
+func checkFields(path string, fields map[string]json.RawMessage, t reflect.Type) error {
+	known := jsonFields(t)
+	for _, name := range sortedFields(fields) {
+		ft, ok := known[name]
+		if !ok {
+			return fmt.Errorf("%s: unknown field", joinPath(path, name))
+		}
+		if err := checkValue(joinPath(path, name), fields[name], ft); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// jsonFields maps the JSON names of struct type t's fields, including
+// those of embedded structs, to their types.
+func jsonFields(t reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type)
+	for i := range t.NumField() {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				for n, t := range jsonFields(ft) {
+					fields[n] = t
+				}
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields[name] = f.Type
+	}
+	return fields
+}
+
+// contentRoles lists the roles ADK content may have. Histories carry
+// system and tool content as well as user and model content.
+var contentRoles = []string{genai.RoleUser, genai.RoleModel, translator.RoleSystem, translator.RoleTool, translator.RoleFunction}
+
+// checkContent checks a genai.Content's role.
+func checkContent(path string, fields map[string]json.RawMessage) error {
+	raw, ok := fields["role"]
+	if !ok {
+		return nil
+	}
+	var role string
+	json.Unmarshal(raw, &role)
+	if !slices.Contains(contentRoles, role) {
+		return fmt.Errorf("%s: role %q must be one of %s", joinPath(path, "role"), role, strings.Join(contentRoles, ", "))
+	}
+	return nil
+}
+
+// checkPart checks that a genai.Part carries exactly one kind of data, and
+// that the data has the fields it needs.
+func checkPart(path string, fields map[string]json.RawMessage) error {
+	var set []string
+	for _, name := range partData {
+		if raw, ok := fields[name]; ok && string(raw) != "null" {
+			set = append(set, name)
+		}
+	}
+	switch len(set) {
+	case 0:
+		return fmt.Errorf("%s: part has no data; set one of %s", path, strings.Join(partData, ", "))
+	case 1:
+	default:
+		return fmt.Errorf("%s: part sets both %s and %s; use one part for each", path, set[0], set[1])
+	}
+
+	var data map[string]json.RawMessage
+	json.Unmarshal(fields[set[0]], &data)
+	require := func(names ...string) error {
+		for _, name := range names {
+			if v, ok := data[name]; ok && string(v) != `""` && string(v) != "null" {
+				return nil
+			}
+		}
+		return fmt.Errorf("%s: %s is required", joinPath(joinPath(path, set[0]), names[0]), strings.Join(names, " or "))
+	}
+	switch set[0] {
+	case "inlineData":
+		if err := require("mimeType"); err != nil {
+			return err
+		}
+		return require("data")
+	case "fileData":
+		return require("fileUri")
+	case "functionCall":
+		return require("name")
+	case "functionResponse":
+		return require("name", "id")
+	}
+	return nil
+}
+
+// checkKind checks that raw starts with the JSON token first.
+func checkKind(path string, raw json.RawMessage, first byte, want string) error {
+	if len(raw) == 0 || raw[0] != first {
+		return typeError(path, want)
+	}
+	return nil
+}
+
+func typeError(path, want string) error {
+	if path == "" {
+		return fmt.Errorf("request body must be %s", want)
+	}
+	return fmt.Errorf("%s: must be %s", path, want)
+}
+
+func joinPath(path, field string) string {
+	if path == "" {
+		return field
+	}
+	return path + "." + field
+}
+
+func sortedFields(m map[string]json.RawMessage) []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,74 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/innomon/adk2goose/gooseclient"
+	"github.com/innomon/adk2goose/internal/buildinfo"
+)
+
+// ADKAPILevel is the level of the ADK REST API the proxy serves. It is
+// raised when a change to the routes or event shapes would be visible to
+// ADK clients.
+const ADKAPILevel = 1
+
+// gooseVersionTimeout bounds the Goose probe of a /version request, so that
+// an unresponsive Goose does not hold up the proxy's own answer.
+const gooseVersionTimeout = 2 * time.Second
+
+// VersionInfo is the response of GET /version.
+type VersionInfo struct {
+	buildinfo.Info
+	ADKAPILevel int          `json:"adkApiLevel"`
+	Goose       GooseVersion `json:"goose"`
+	// Features reports whether each experimental behavior is on.
+	Features map[string]bool `json:"features"`
+}
+
+// GooseVersion is the release of the Goose server the proxy forwards to,
+// or why it could not be told. The route is public, so the error does not
+// name the server.
+type GooseVersion struct {
+	Version string `json:"version,omitempty"`
+	// Legacy lists the older response shapes the proxy adapts for it.
+	Legacy   []string   `json:"legacy,omitempty"`
+	ProbedAt *time.Time `json:"probedAt,omitempty"`
+	Error    string     `json:"error,omitempty"`
+}
+
+// handleVersion reports the proxy's build, the release of the active Goose
+// server, and the state of the feature flags. A server not probed since the
+// proxy switched to it is probed now.
+func (h *Handler) handleVersion(w http.ResponseWriter, r *http.Request) {
+	v := VersionInfo{
+		Info:        buildinfo.Get(),
+		ADKAPILevel: ADKAPILevel,
+		Features:    h.cfg.Features.State(),
+	}
+	sv := h.client.ServerVersion()
+	if sv == nil {
+		ctx, cancel := context.WithTimeout(r.Context(), gooseVersionTimeout)
+		defer cancel()
+		var err error
+		if sv, err = h.client.ProbeVersion(ctx); err != nil {
+			log.Printf("version: %v", err)
+			v.Goose.Error = "Goose did not answer"
+			if errors.Is(err, gooseclient.ErrUnsupportedVersion) {
+				v.Goose.Error = gooseclient.ErrUnsupportedVersion.Error()
+			}
+		}
+	}
+	if sv != nil {
+		v.Goose.Version = sv.Version
+		v.Goose.Legacy = sv.Legacy
+		v.Goose.ProbedAt = &sv.ProbedAt
+		if sv.Version == "" {
+			v.Goose.Error = "this Goose release does not report its version"
+		}
+	}
+	writeJSON(w, http.StatusOK, v)
+}
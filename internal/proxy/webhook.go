@@ -0,0 +1,141 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/innomon/adk2goose/internal/config"
+)
+
+const (
+	// webhookTimeout bounds each POST to a webhook.
+	webhookTimeout = 10 * time.Second
+
+	// webhookAttempts is how many times a lifecycle event is delivered
+	// before it is dropped.
+	webhookAttempts = 4
+
+	// webhookSignatureHeader carries "sha256=" and the hex HMAC-SHA256 of a
+	// delivery's body, keyed with the webhook's secret.
+	webhookSignatureHeader = "X-Webhook-Signature"
+)
+
+var webhookClient = &http.Client{Timeout: webhookTimeout}
+
+// webhookRetryDelay is the wait before the first redelivery of a lifecycle
+// event; it doubles for each further attempt.
+var webhookRetryDelay = time.Second
+
+// LifecycleEvent is the JSON body of a lifecycle webhook delivery.
+type LifecycleEvent struct {
+	ID      string         `json:"id"`
+	Type    string         `json:"type"`
+	Time    time.Time      `json:"time"`
+	App     string         `json:"app"`
+	User    string         `json:"user"`
+	Session string         `json:"session"`
+	Data    map[string]any `json:"data,omitempty"`
+}
+
+// postWebhook POSTs payload as JSON to url. Responses other than 2xx are
+// errors.
+func postWebhook(ctx context.Context, url string, payload any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("encode webhook: %w", err)
+	}
+	_, err = sendWebhook(ctx, webhookClient, url, body, nil)
+	return err
+}
+
+// sendWebhook POSTs a JSON body to url with extra headers through client,
+// returning the response status.
+func sendWebhook(ctx context.Context, client *http.Client, url string, body []byte, header http.Header) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// publishLifecycle delivers a lifecycle event about the session key to the
+// webhooks subscribed to it, in the background.
+func (h *Handler) publishLifecycle(eventType string, key SessionKey, data map[string]any) {
+	var body []byte
+	for _, hook := range h.cfg.Webhooks {
+		if !hook.Wants(eventType) {
+			continue
+		}
+		if body == nil {
+			var err error
+			body, err = json.Marshal(LifecycleEvent{
+				ID:      h.newID("evt_"),
+				Type:    eventType,
+				Time:    time.Now().UTC(),
+				App:     key.App,
+				User:    key.User,
+				Session: key.ID,
+				Data:    data,
+			})
+			if err != nil {
+				log.Printf("encode %s webhook: %v", eventType, err)
+				return
+			}
+		}
+		go deliverLifecycle(hook, eventType, body)
+	}
+}
+
+// deliverLifecycle POSTs a lifecycle event to hook, signed if the hook has
+// a secret, retrying with backoff while delivery fails with a network
+// error, 429, or 5xx.
+func deliverLifecycle(hook config.Webhook, eventType string, body []byte) {
+	header := http.Header{"X-Webhook-Event": {eventType}}
+	if hook.Secret != "" {
+		header.Set(webhookSignatureHeader, signWebhook(hook.Secret, body))
+	}
+
+	delay := webhookRetryDelay
+	for attempt := 1; ; attempt++ {
+		status, err := sendWebhook(context.Background(), webhookClient, hook.URL, body, header)
+		if err == nil {
+			webhookDeliveries.Inc("delivered")
+			return
+		}
+		retryable := status == 0 || status == http.StatusTooManyRequests || status >= 500
+		if !retryable || attempt == webhookAttempts {
+			webhookDeliveries.Inc("failed")
+			log.Printf("%s webhook to %s failed after %d attempts: %v", eventType, hook.URL, attempt, err)
+			return
+		}
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// signWebhook returns the signature header value for body.
+func signWebhook(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
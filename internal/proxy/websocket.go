@@ -0,0 +1,60 @@
+package proxy
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// maxControlPayload bounds client messages; the push channel only expects
+// control frames from clients.
+const maxControlPayload = 4096
+
+// wsWriteTimeout bounds each write to a WebSocket client.
+const wsWriteTimeout = 10 * time.Second
+
+// errNotWebSocket is returned for a request that is not a WebSocket
+// upgrade.
+var errNotWebSocket = errors.New("not a websocket upgrade")
+
+// newUpgrader returns the WebSocket upgrader of the push channel. Browsers,
+// which send an Origin header, are only let in from the proxy's own origin
+// or a host in origins, so a page elsewhere cannot open a push channel with
+// the user's credentials; clients sending no Origin are not browsers.
+func newUpgrader(origins []string) *websocket.Upgrader {
+	return &websocket.Upgrader{
+		CheckOrigin: func(r *http.Request) bool {
+			origin := r.Header.Get("Origin")
+			if origin == "" {
+				return true
+			}
+			u, err := url.Parse(origin)
+			if err != nil {
+				return false
+			}
+			return strings.EqualFold(u.Host, r.Host) || hostListed(origins, u.Hostname())
+		},
+		Error: func(w http.ResponseWriter, r *http.Request, status int, reason error) {
+			writeError(w, status, reason.Error())
+		},
+	}
+}
+
+// upgradeWebSocket completes the opening handshake on w. On failure it has
+// already written an HTTP error response.
+func (h *Handler) upgradeWebSocket(w http.ResponseWriter, r *http.Request) (*websocket.Conn, error) {
+	if !websocket.IsWebSocketUpgrade(r) {
+		writeError(w, http.StatusUpgradeRequired, "websocket upgrade required")
+		return nil, errNotWebSocket
+	}
+	conn, err := h.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return nil, err
+	}
+	conn.SetReadLimit(maxControlPayload)
+	return conn, nil
+}
@@ -0,0 +1,176 @@
+package proxy
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/innomon/adk2goose/internal/config"
+	"github.com/innomon/adk2goose/internal/policy"
+)
+
+// workDirsDir holds the private working directories of users or sessions,
+// under the shared working directory.
+const workDirsDir = ".adk2goose/workdirs"
+
+// IsolateWorkingDirs makes the manager start each Goose agent in a private
+// subdirectory of its working directory: one per user of an app, or one per
+// session, as mode is config.WorkingDirIsolationUser or
+// config.WorkingDirIsolationSession. Any other mode shares the working
+// directory. It must be called before the manager is used.
+func (sm *SessionManager) IsolateWorkingDirs(mode string) {
+	sm.isolation = mode
+}
+
+// WorkingDirFor returns the directory the agents of session key work in,
+// creating it, readable by the proxy's user only, if it is private.
+func (sm *SessionManager) WorkingDirFor(key SessionKey) (string, error) {
+	dir := sm.workingDirOf(key)
+	if dir == sm.workingDir {
+		return dir, nil
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", fmt.Errorf("create working dir of ADK session %s: %w", key, err)
+	}
+	// Another user's agent may have swapped a directory on the way for a
+	// symlink to its own.
+	root, err := filepath.EvalSymlinks(sm.workingDir)
+	if err != nil {
+		return "", fmt.Errorf("resolve working dir: %w", err)
+	}
+	resolved, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return "", fmt.Errorf("resolve working dir of ADK session %s: %w", key, err)
+	}
+	rel, err := filepath.Rel(sm.workingDir, dir)
+	if err != nil || resolved != filepath.Join(root, rel) {
+		return "", fmt.Errorf("working dir of ADK session %s: %w", key, policy.ErrPathEscape)
+	}
+	return dir, nil
+}
+
+// workingDirOf returns the directory the agents of session key work in,
+// without creating it.
+func (sm *SessionManager) workingDirOf(key SessionKey) string {
+	switch sm.isolation {
+	case config.WorkingDirIsolationUser:
+		return sm.userWorkingDir(key.App, key.User)
+	case config.WorkingDirIsolationSession:
+		return filepath.Join(sm.userWorkingDir(key.App, key.User), dirName(key.ID))
+	}
+	return sm.workingDir
+}
+
+// userWorkingDir returns the directory holding the private working
+// directories of user in app.
+func (sm *SessionManager) userWorkingDir(app, user string) string {
+	return filepath.Join(sm.workingDir, workDirsDir, dirName(app), dirName(user))
+}
+
+// removeWorkingDir deletes the private working directory of session key.
+// Shared and per-user directories outlive the session.
+func (sm *SessionManager) removeWorkingDir(key SessionKey) error {
+	if sm.isolation != config.WorkingDirIsolationSession {
+		return nil
+	}
+	return os.RemoveAll(sm.workingDirOf(key))
+}
+
+// RemoveUserWorkingDirs deletes the private working directories of user in
+// app, or in every app if app is empty, with their sessions' directories.
+func (sm *SessionManager) RemoveUserWorkingDirs(app, user string) error {
+	if sm.isolation != config.WorkingDirIsolationUser && sm.isolation != config.WorkingDirIsolationSession {
+		return nil
+	}
+	apps := []string{dirName(app)}
+	if app == "" {
+		entries, err := os.ReadDir(filepath.Join(sm.workingDir, workDirsDir))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		apps = apps[:0]
+		for _, e := range entries {
+			if e.IsDir() {
+				apps = append(apps, e.Name())
+			}
+		}
+	}
+	for _, name := range apps {
+		if err := os.RemoveAll(filepath.Join(sm.workingDir, workDirsDir, name, dirName(user))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FilesSubdir returns the subfolder of the uploads and inline data folders
+// that receives the files sent in session key. In the shared working
+// directory each user of an app has their own, so their files can be found
+// when they are purged; private directories need none.
+func (sm *SessionManager) FilesSubdir(key SessionKey) string {
+	if sm.workingDirOf(key) != sm.workingDir {
+		return ""
+	}
+	return filepath.Join(dirName(key.App), dirName(key.User))
+}
+
+// RemoveUserFiles deletes the files user sent in app, or in every app if app
+// is empty, that are kept in the shared working directory, and returns how
+// many there were. With dryRun it only counts them.
+func (sm *SessionManager) RemoveUserFiles(app, user string, dryRun bool) (int, error) {
+	if sm.isolation == config.WorkingDirIsolationUser || sm.isolation == config.WorkingDirIsolationSession {
+		return 0, nil
+	}
+	n := 0
+	for _, folder := range []string{uploadsDir, inlineDataDir} {
+		base := filepath.Join(sm.workingDir, folder)
+		apps := []string{dirName(app)}
+		if app == "" {
+			entries, err := os.ReadDir(base)
+			if err != nil && !os.IsNotExist(err) {
+				return n, err
+			}
+			apps = apps[:0]
+			for _, e := range entries {
+				if e.IsDir() {
+					apps = append(apps, e.Name())
+				}
+			}
+		}
+		for _, name := range apps {
+			dir := filepath.Join(base, name, dirName(user))
+			err := filepath.WalkDir(dir, func(_ string, d os.DirEntry, err error) error {
+				if err == nil && d.Type().IsRegular() {
+					n++
+				}
+				return err
+			})
+			if err != nil && !os.IsNotExist(err) {
+				return n, err
+			}
+			if dryRun {
+				continue
+			}
+			if err := os.RemoveAll(dir); err != nil {
+				return n, err
+			}
+		}
+	}
+	return n, nil
+}
+
+// dirName escapes an app, user, or session ID into a single path element
+// that cannot name a parent directory or reach into another one. Escaping
+// keeps distinct IDs apart, as a lone "%" is never the escape of one.
+func dirName(s string) string {
+	name := url.PathEscape(s)
+	switch {
+	case name == "":
+		return "%"
+	case strings.Trim(name, ".") == "":
+		return strings.ReplaceAll(name, ".", "%2E")
+	}
+	return name
+}
@@ -0,0 +1,35 @@
+package secrets
+
+import (
+	"os"
+	"slices"
+	"strings"
+)
+
+// ownCredentials are the variables holding the proxy's own credentials:
+// its Goose and admin secrets and those it reads secret managers with.
+// Goose never needs them, and a tool it runs could read them.
+var ownCredentials = []string{
+	"GOOSE_SECRET_KEY",
+	"GOOSE_SERVER__SECRET_KEY",
+	"ADMIN_TOKEN",
+	"RUN_CALLBACK_SECRET",
+	"SENTRY_DSN",
+	"TLS_KEY",
+	"VAULT_TOKEN",
+	"AWS_ACCESS_KEY_ID",
+	"AWS_SECRET_ACCESS_KEY",
+	"AWS_SESSION_TOKEN",
+	"GOOGLE_OAUTH_ACCESS_TOKEN",
+}
+
+// ChildEnviron returns the environment for a process the proxy starts: its
+// own environment without its credentials, plus extra. A credential the
+// process does need can be given back in extra.
+func ChildEnviron(extra ...string) []string {
+	env := slices.DeleteFunc(os.Environ(), func(kv string) bool {
+		name, _, _ := strings.Cut(kv, "=")
+		return slices.Contains(ownCredentials, name)
+	})
+	return append(env, extra...)
+}
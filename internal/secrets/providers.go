@@ -0,0 +1,270 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// VaultConfig locates a HashiCorp Vault server and the token to read it
+// with.
+type VaultConfig struct {
+	Addr      string // VAULT_ADDR
+	Token     string // VAULT_TOKEN
+	Namespace string // VAULT_NAMESPACE, for Vault Enterprise
+}
+
+func vaultFromEnv() VaultConfig {
+	return VaultConfig{
+		Addr:      os.Getenv("VAULT_ADDR"),
+		Token:     os.Getenv("VAULT_TOKEN"),
+		Namespace: os.Getenv("VAULT_NAMESPACE"),
+	}
+}
+
+// vault reads the fields of the secret at path, from a KV v1 or v2 engine.
+func (r *Resolver) vault(ctx context.Context, path string) (map[string]any, error) {
+	if r.Vault.Addr == "" {
+		return nil, fmt.Errorf("VAULT_ADDR is not set")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimRight(r.Vault.Addr, "/")+"/v1/"+strings.TrimLeft(path, "/"), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Vault-Token", r.Vault.Token)
+	if r.Vault.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", r.Vault.Namespace)
+	}
+	var resp struct {
+		Data map[string]any `json:"data"`
+	}
+	if err := r.do(req, &resp); err != nil {
+		return nil, err
+	}
+	// KV v2 nests the secret's fields next to their metadata.
+	if inner, ok := resp.Data["data"].(map[string]any); ok {
+		if _, ok := resp.Data["metadata"]; ok {
+			return inner, nil
+		}
+	}
+	return resp.Data, nil
+}
+
+// AWSConfig holds the region and credentials AWS Secrets Manager requests
+// are signed with. Only static credentials from the environment are
+// supported: not shared credentials files, instance metadata, ECS task
+// roles, or web identity tokens.
+type AWSConfig struct {
+	Region          string // AWS_REGION or AWS_DEFAULT_REGION
+	Endpoint        string // AWS_ENDPOINT_URL_SECRETS_MANAGER or AWS_ENDPOINT_URL; the regional endpoint if empty
+	AccessKeyID     string // AWS_ACCESS_KEY_ID
+	SecretAccessKey string // AWS_SECRET_ACCESS_KEY
+	SessionToken    string // AWS_SESSION_TOKEN
+}
+
+func awsFromEnv() AWSConfig {
+	c := AWSConfig{
+		Region:          os.Getenv("AWS_REGION"),
+		Endpoint:        os.Getenv("AWS_ENDPOINT_URL_SECRETS_MANAGER"),
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	if c.Region == "" {
+		c.Region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	if c.Endpoint == "" {
+		c.Endpoint = os.Getenv("AWS_ENDPOINT_URL")
+	}
+	return c
+}
+
+// aws reads the SecretString of the secret id from AWS Secrets Manager.
+func (r *Resolver) aws(ctx context.Context, id string) (string, error) {
+	if r.AWS.Region == "" || r.AWS.AccessKeyID == "" || r.AWS.SecretAccessKey == "" {
+		return "", fmt.Errorf("AWS_REGION and AWS credentials are not set")
+	}
+	endpoint := r.AWS.Endpoint
+	if endpoint == "" {
+		endpoint = "https://secretsmanager." + r.AWS.Region + ".amazonaws.com"
+	}
+	body, _ := json.Marshal(map[string]string{"SecretId": id})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(endpoint, "/")+"/", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "secretsmanager.GetSecretValue")
+	r.AWS.sign(req, "secretsmanager", body, time.Now().UTC())
+
+	var resp struct {
+		SecretString string `json:"SecretString"`
+	}
+	if err := r.do(req, &resp); err != nil {
+		return "", err
+	}
+	if resp.SecretString == "" {
+		return "", fmt.Errorf("secret has no SecretString")
+	}
+	return resp.SecretString, nil
+}
+
+// sign adds an AWS Signature Version 4 for service to req, whose body is
+// body. The query, which Secrets Manager requests have none of, is signed
+// as is rather than canonicalized.
+func (c AWSConfig) sign(req *http.Request, service string, body []byte, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	if c.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", c.SessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(req.Header.Get(name))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	canonical := strings.Join([]string{
+		req.Method, path, req.URL.RawQuery, canonicalHeaders.String(), signedHeaders, hexSHA256(body),
+	}, "\n")
+
+	scope := date + "/" + c.Region + "/" + service + "/aws4_request"
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hexSHA256([]byte(canonical))
+	key := hmacSHA256([]byte("AWS4"+c.SecretAccessKey), date)
+	for _, part := range []string{c.Region, service, "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, toSign))
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+c.AccessKeyID+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+// GCPConfig locates GCP Secret Manager and the OAuth token to read it
+// with.
+type GCPConfig struct {
+	Endpoint string // https://secretmanager.googleapis.com if empty
+	// Token is an OAuth access token (GOOGLE_OAUTH_ACCESS_TOKEN). Without
+	// one, a token of the instance's service account is fetched from
+	// MetadataURL, the GCE metadata server by default.
+	Token       string
+	MetadataURL string
+}
+
+func gcpFromEnv() GCPConfig {
+	return GCPConfig{Token: os.Getenv("GOOGLE_OAUTH_ACCESS_TOKEN")}
+}
+
+// gcp reads the payload of the secret version name, the latest version if
+// name does not name one.
+func (r *Resolver) gcp(ctx context.Context, name string) (string, error) {
+	if !strings.Contains(name, "/versions/") {
+		name += "/versions/latest"
+	}
+	token := r.GCP.Token
+	if token == "" {
+		var err error
+		if token, err = r.gcpMetadataToken(ctx); err != nil {
+			return "", fmt.Errorf("gcp access token: %w", err)
+		}
+	}
+	endpoint := r.GCP.Endpoint
+	if endpoint == "" {
+		endpoint = "https://secretmanager.googleapis.com"
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimRight(endpoint, "/")+"/v1/"+name+":access", nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	var resp struct {
+		Payload struct {
+			Data string `json:"data"`
+		} `json:"payload"`
+	}
+	if err := r.do(req, &resp); err != nil {
+		return "", err
+	}
+	data, err := base64.StdEncoding.DecodeString(resp.Payload.Data)
+	if err != nil {
+		return "", fmt.Errorf("decode payload: %w", err)
+	}
+	return string(data), nil
+}
+
+// gcpMetadataToken fetches an access token of the instance's default
+// service account.
+func (r *Resolver) gcpMetadataToken(ctx context.Context) (string, error) {
+	u := r.GCP.MetadataURL
+	if u == "" {
+		u = "http://metadata.google.internal"
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimRight(u, "/")+"/computeMetadata/v1/instance/service-accounts/default/token", nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+	var resp struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := r.do(req, &resp); err != nil {
+		return "", err
+	}
+	return resp.AccessToken, nil
+}
+
+// do sends req and decodes its JSON response into result.
+func (r *Resolver) do(req *http.Request, result any) error {
+	client := r.HTTP
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s: status %d: %s", req.URL.Host, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return fmt.Errorf("%s: decode response: %w", req.URL.Host, err)
+	}
+	return nil
+}
+
+func hexSHA256(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	m := hmac.New(sha256.New, key)
+	m.Write([]byte(data))
+	return m.Sum(nil)
+}
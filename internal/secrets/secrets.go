@@ -0,0 +1,208 @@
+// Package secrets resolves credentials given as references to HashiCorp
+// Vault, AWS Secrets Manager, GCP Secret Manager, or a file, and keeps
+// them fresh, so that they need not sit in plaintext environment variables.
+//
+// A reference is one of:
+//
+//	vault://<path>#<field>               KV v1 or v2 path, e.g. secret/data/adk2goose#goose_key
+//	awssm://<secret id or ARN>[#<field>] SecretString, or one field of it as JSON
+//	gcpsm://projects/<p>/secrets/<s>[/versions/<v>][#<field>]
+//	file://<path>[#<field>]
+//
+// Any other value is a literal secret.
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/innomon/adk2goose/internal/metrics"
+)
+
+var refreshes = metrics.NewCounterVec(
+	"secret_refreshes_total",
+	"Refreshes of secrets read from a secret manager, by result (unchanged, changed, or failed, keeping the previous value).",
+	"result")
+
+// Resolver reads referenced secrets from their managers.
+type Resolver struct {
+	HTTP  *http.Client
+	Vault VaultConfig
+	AWS   AWSConfig
+	GCP   GCPConfig
+}
+
+// FromEnv returns a Resolver configured from each manager's usual
+// environment variables.
+func FromEnv() *Resolver {
+	return &Resolver{
+		HTTP:  &http.Client{Timeout: 10 * time.Second},
+		Vault: vaultFromEnv(),
+		AWS:   awsFromEnv(),
+		GCP:   gcpFromEnv(),
+	}
+}
+
+// IsReference reports whether s names a secret held elsewhere rather than
+// being one.
+func IsReference(s string) bool {
+	for _, scheme := range []string{"vault://", "awssm://", "gcpsm://", "file://"} {
+		if strings.HasPrefix(s, scheme) {
+			return true
+		}
+	}
+	return false
+}
+
+// Resolve returns the secret ref names, or ref itself if it is a literal.
+func (r *Resolver) Resolve(ctx context.Context, ref string) (string, error) {
+	scheme, rest, ok := strings.Cut(ref, "://")
+	if !ok || !IsReference(ref) {
+		return ref, nil
+	}
+	name, field, _ := strings.Cut(rest, "#")
+	var (
+		value string
+		err   error
+	)
+	switch scheme {
+	case "vault":
+		if field == "" {
+			return "", fmt.Errorf("secret %s: vault references need a #field", ref)
+		}
+		fields, err := r.vault(ctx, name)
+		if err != nil {
+			return "", fmt.Errorf("secret %s: %w", ref, err)
+		}
+		return stringField(fields, field, ref)
+	case "awssm":
+		value, err = r.aws(ctx, name)
+	case "gcpsm":
+		value, err = r.gcp(ctx, name)
+	case "file":
+		var data []byte
+		data, err = os.ReadFile(name)
+		value = strings.TrimRight(string(data), "\r\n")
+	}
+	if err != nil {
+		return "", fmt.Errorf("secret %s: %w", ref, err)
+	}
+	if field == "" {
+		return value, nil
+	}
+	var fields map[string]any
+	if err := json.Unmarshal([]byte(value), &fields); err != nil {
+		return "", fmt.Errorf("secret %s: field %q of a value that is not a JSON object", ref, field)
+	}
+	return stringField(fields, field, ref)
+}
+
+// stringField returns the string field of a secret's JSON fields.
+func stringField(fields map[string]any, field, ref string) (string, error) {
+	v, ok := fields[field].(string)
+	if !ok {
+		return "", fmt.Errorf("secret %s: no string field %q", ref, field)
+	}
+	return v, nil
+}
+
+// Secret is a credential that may change while the proxy runs.
+type Secret struct {
+	ref      string
+	resolver *Resolver
+	value    atomic.Pointer[string]
+
+	mu       sync.Mutex
+	onChange []func(value string)
+}
+
+// Load resolves ref, which may be a literal, into a Secret.
+func (r *Resolver) Load(ctx context.Context, ref string) (*Secret, error) {
+	s := &Secret{ref: ref, resolver: r}
+	value, err := r.Resolve(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	s.value.Store(&value)
+	return s, nil
+}
+
+// Value returns the current value of the secret.
+func (s *Secret) Value() string {
+	return *s.value.Load()
+}
+
+// OnChange registers fn to be called with the new value each time a
+// refresh changes the secret.
+func (s *Secret) OnChange(fn func(value string)) {
+	s.mu.Lock()
+	s.onChange = append(s.onChange, fn)
+	s.mu.Unlock()
+}
+
+// Refresh reads a referenced secret again, reporting whether it changed. A
+// literal never changes. On error the previous value stays in use.
+func (s *Secret) Refresh(ctx context.Context) (bool, error) {
+	if !IsReference(s.ref) {
+		return false, nil
+	}
+	value, err := s.resolver.Resolve(ctx, s.ref)
+	if err != nil {
+		return false, err
+	}
+	if value == s.Value() {
+		return false, nil
+	}
+	s.value.Store(&value)
+	s.mu.Lock()
+	fns := s.onChange
+	s.mu.Unlock()
+	for _, fn := range fns {
+		fn(value)
+	}
+	return true, nil
+}
+
+// Refresh refreshes the referenced secrets every interval until ctx is
+// done. Failures are logged and retried on the next tick.
+func Refresh(ctx context.Context, interval time.Duration, secrets ...*Secret) {
+	var refs []*Secret
+	for _, s := range secrets {
+		if s != nil && IsReference(s.ref) {
+			refs = append(refs, s)
+		}
+	}
+	if interval <= 0 || len(refs) == 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		for _, s := range refs {
+			changed, err := s.Refresh(ctx)
+			switch {
+			case err != nil:
+				log.Printf("refresh %v", err)
+				refreshes.Inc("failed")
+			case changed:
+				log.Printf("secret %s changed", s.ref)
+				refreshes.Inc("changed")
+			default:
+				refreshes.Inc("unchanged")
+			}
+		}
+	}
+}
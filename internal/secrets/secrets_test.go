@@ -0,0 +1,182 @@
+package secrets
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestResolve(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/secret/data/adk2goose", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "vault-token" {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{"data": map[string]any{
+			"data":     map[string]any{"goose_key": "from-vault"},
+			"metadata": map[string]any{"version": 3},
+		}})
+	})
+	mux.HandleFunc("POST /", func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		if r.Header.Get("X-Amz-Target") != "secretsmanager.GetSecretValue" ||
+			!strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKID/") ||
+			!strings.Contains(auth, "/eu-west-1/secretsmanager/aws4_request, SignedHeaders=") ||
+			!strings.Contains(auth, "x-amz-date") {
+			http.Error(w, "bad signature", http.StatusForbidden)
+			return
+		}
+		var body struct{ SecretId string }
+		json.NewDecoder(r.Body).Decode(&body)
+		json.NewEncoder(w).Encode(map[string]string{"SecretString": `{"goose_key": "from-aws:` + body.SecretId + `"}`})
+	})
+	mux.HandleFunc("GET /computeMetadata/v1/instance/service-accounts/default/token", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{"access_token": "gcp-token"})
+	})
+	mux.HandleFunc("GET /v1/projects/p/secrets/goose/versions/latest:access", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer gcp-token" {
+			http.Error(w, "unauthenticated", http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{"payload": map[string]string{"data": base64.StdEncoding.EncodeToString([]byte("from-gcp"))}})
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	file := filepath.Join(t.TempDir(), "secret")
+	os.WriteFile(file, []byte("from-file\n"), 0o600)
+
+	r := &Resolver{
+		Vault: VaultConfig{Addr: srv.URL, Token: "vault-token"},
+		AWS:   AWSConfig{Region: "eu-west-1", Endpoint: srv.URL, AccessKeyID: "AKID", SecretAccessKey: "secret"},
+		GCP:   GCPConfig{Endpoint: srv.URL, MetadataURL: srv.URL},
+	}
+	for ref, want := range map[string]string{
+		"plain-value": "plain-value",
+		"vault://secret/data/adk2goose#goose_key": "from-vault",
+		"awssm://prod/goose#goose_key":            "from-aws:prod/goose",
+		"gcpsm://projects/p/secrets/goose":        "from-gcp",
+		"file://" + file:                          "from-file",
+	} {
+		got, err := r.Resolve(context.Background(), ref)
+		if err != nil || got != want {
+			t.Errorf("Resolve(%q) = %q, %v; want %q", ref, got, err, want)
+		}
+	}
+	for _, ref := range []string{"vault://secret/data/adk2goose", "vault://secret/data/adk2goose#missing", "awssm://prod/goose#missing"} {
+		if _, err := r.Resolve(context.Background(), ref); err == nil {
+			t.Errorf("Resolve(%q): expected an error", ref)
+		}
+	}
+}
+
+func TestSecretRefresh(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "secret")
+	os.WriteFile(file, []byte("v1"), 0o600)
+
+	s, err := FromEnv().Load(context.Background(), "file://"+file)
+	if err != nil || s.Value() != "v1" {
+		t.Fatalf("load: %q, %v", s.Value(), err)
+	}
+	var seen []string
+	s.OnChange(func(v string) { seen = append(seen, v) })
+
+	if changed, err := s.Refresh(context.Background()); changed || err != nil {
+		t.Fatalf("expected an unchanged secret, got %v, %v", changed, err)
+	}
+	os.WriteFile(file, []byte("v2"), 0o600)
+	if changed, err := s.Refresh(context.Background()); !changed || err != nil {
+		t.Fatalf("expected a changed secret, got %v, %v", changed, err)
+	}
+	os.Remove(file)
+	if _, err := s.Refresh(context.Background()); err == nil {
+		t.Fatal("expected an error for a missing secret")
+	}
+	if s.Value() != "v2" || len(seen) != 1 || seen[0] != "v2" {
+		t.Fatalf("expected v2 kept and announced once, got %q and %v", s.Value(), seen)
+	}
+}
+
+func TestChildEnviron(t *testing.T) {
+	t.Setenv("ADMIN_TOKEN", "admin")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "aws")
+	t.Setenv("ADK2GOOSE_TEST_KEPT", "kept")
+
+	env := ChildEnviron("GOOSE_PROVIDER=anthropic", "AWS_SECRET_ACCESS_KEY=for-goose")
+	for _, kv := range env {
+		if strings.HasPrefix(kv, "ADMIN_TOKEN=") || kv == "AWS_SECRET_ACCESS_KEY=aws" {
+			t.Errorf("expected the proxy's credentials removed, got %s", kv)
+		}
+	}
+	for _, want := range []string{"ADK2GOOSE_TEST_KEPT=kept", "GOOSE_PROVIDER=anthropic", "AWS_SECRET_ACCESS_KEY=for-goose"} {
+		if !slices.Contains(env, want) {
+			t.Errorf("expected %s in the environment", want)
+		}
+	}
+}
+
+// TestAWSSign checks the signer against AWS's published Signature Version 4
+// test suite: get-vanilla, post-vanilla, and post-x-www-form-urlencoded.
+func TestAWSSign(t *testing.T) {
+	creds := AWSConfig{
+		Region:          "us-east-1",
+		AccessKeyID:     "AKIDEXAMPLE",
+		SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+	}
+	now := time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)
+
+	tests := []struct {
+		name         string
+		method, body string
+		header       map[string]string
+		want         string
+	}{
+		{
+			name:   "get-vanilla",
+			method: http.MethodGet,
+			want: "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, " +
+				"SignedHeaders=host;x-amz-date, Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31",
+		},
+		{
+			name:   "post-vanilla",
+			method: http.MethodPost,
+			want: "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, " +
+				"SignedHeaders=host;x-amz-date, Signature=5da7c1a2acd57cee7505fc6676e4e544621c30862966e37dddb68e92efbe5d6b",
+		},
+		{
+			name:   "post-x-www-form-urlencoded",
+			method: http.MethodPost,
+			body:   "Param1=value1",
+			header: map[string]string{"Content-Type": "application/x-www-form-urlencoded"},
+			want: "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, " +
+				"SignedHeaders=content-type;host;x-amz-date, Signature=ff11897932ad3f4e8b18135d722051e5ac45fc38421b1da7b9d196a0fe09473a",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, "https://example.amazonaws.com/", strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for name, value := range tt.header {
+				req.Header.Set(name, value)
+			}
+			creds.sign(req, "service", []byte(tt.body), now)
+			if got := req.Header.Get("X-Amz-Date"); got != "20150830T123600Z" {
+				t.Errorf("X-Amz-Date = %s", got)
+			}
+			if got := req.Header.Get("Authorization"); got != tt.want {
+				t.Errorf("Authorization =\n  %s\nwant\n  %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package secrets
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log"
+	"sync/atomic"
+)
+
+// Certificate is a TLS certificate whose PEM certificate chain and private
+// key are secrets, so that a renewed certificate is served without a
+// restart.
+type Certificate struct {
+	cert, key *Secret
+	current   atomic.Pointer[tls.Certificate]
+}
+
+// NewCertificate parses the certificate chain and key, and parses them
+// again whenever either changes. A pair that does not parse, such as while
+// only one of the two has been refreshed, leaves the previous one in use.
+func NewCertificate(cert, key *Secret) (*Certificate, error) {
+	c := &Certificate{cert: cert, key: key}
+	if err := c.load(); err != nil {
+		return nil, err
+	}
+	reload := func(string) {
+		if err := c.load(); err != nil {
+			log.Printf("%v (keeping the previous certificate)", err)
+			return
+		}
+		log.Printf("tls certificate reloaded")
+	}
+	cert.OnChange(reload)
+	key.OnChange(reload)
+	return c, nil
+}
+
+func (c *Certificate) load() error {
+	pair, err := tls.X509KeyPair([]byte(c.cert.Value()), []byte(c.key.Value()))
+	if err != nil {
+		return fmt.Errorf("tls certificate: %w", err)
+	}
+	c.current.Store(&pair)
+	return nil
+}
+
+// GetCertificate returns the current certificate, for tls.Config.
+func (c *Certificate) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return c.current.Load(), nil
+}
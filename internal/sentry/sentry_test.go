@@ -0,0 +1,57 @@
+package sentry
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCapture(t *testing.T) {
+	var auth, path string
+	var got map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth, path = r.Header.Get("X-Sentry-Auth"), r.URL.Path
+		json.NewDecoder(r.Body).Decode(&got)
+	}))
+	t.Cleanup(srv.Close)
+
+	c, err := New(strings.Replace(srv.URL, "://", "://pub:sec@", 1)+"/prefix/42", "staging")
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	id, err := c.Capture(&Event{
+		Message: "boom",
+		Type:    "panic",
+		Value:   "boom",
+		Stack:   Callers(0),
+		Tags:    map[string]string{"session": "s1"},
+	})
+	if err != nil {
+		t.Fatalf("Capture: %v", err)
+	}
+
+	if path != "/prefix/api/42/store/" {
+		t.Errorf("unexpected store path %q", path)
+	}
+	if !strings.Contains(auth, "sentry_key=pub") || !strings.Contains(auth, "sentry_secret=sec") {
+		t.Errorf("unexpected auth header %q", auth)
+	}
+	if got["event_id"] != id || got["environment"] != "staging" || got["tags"].(map[string]any)["session"] != "s1" {
+		t.Errorf("unexpected event %+v", got)
+	}
+	exc := got["exception"].(map[string]any)["values"].([]any)[0].(map[string]any)
+	frames := exc["stacktrace"].(map[string]any)["frames"].([]any)
+	if last := frames[len(frames)-1].(map[string]any); last["function"] != "TestCapture" || last["in_app"] != true {
+		t.Errorf("expected the capturing function as the last frame, got %+v", last)
+	}
+}
+
+func TestNew_InvalidDSN(t *testing.T) {
+	for _, dsn := range []string{"ftp://k@host/1", "https://host/1", "https://k@host/"} {
+		if _, err := New(dsn, ""); err == nil {
+			t.Errorf("expected an error for %q", dsn)
+		}
+	}
+}
@@ -0,0 +1,246 @@
+// Package supervisor runs a local goosed process for the proxy, restarting
+// it when it exits, so the proxy and its Goose backend deploy as one unit.
+package supervisor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/innomon/adk2goose/internal/metrics"
+	"github.com/innomon/adk2goose/internal/secrets"
+)
+
+// Restart backoff: the delay after a crash starts at minRestartDelay and
+// doubles up to maxRestartDelay; a process that stayed up for stableAfter
+// resets it.
+const (
+	minRestartDelay = 500 * time.Millisecond
+	maxRestartDelay = 30 * time.Second
+	stableAfter     = time.Minute
+)
+
+// stopTimeout is how long goosed gets to exit after being interrupted.
+const stopTimeout = 5 * time.Second
+
+// readyPollInterval is how often a starting goosed is probed for readiness.
+const readyPollInterval = 100 * time.Millisecond
+
+var restartsTotal = metrics.NewCounterVec(
+	"goosed_restarts_total",
+	"Supervised goosed processes restarted after exiting, by port.",
+	"port",
+)
+
+// Config describes the goosed process to run.
+type Config struct {
+	// Binary is the path of the goosed executable.
+	Binary string
+	// Args are its arguments. Empty means "agent".
+	Args []string
+	// Env holds extra KEY=VALUE environment variables, on top of the
+	// proxy's own environment less its credentials.
+	Env []string
+	// Port is the port goosed listens on, on 127.0.0.1.
+	Port int
+	// SecretKey is the key goosed requires in X-Secret-Key.
+	SecretKey string
+	// ReadyTimeout bounds how long a started goosed may take to answer
+	// /status. Zero means 30 seconds.
+	ReadyTimeout time.Duration
+}
+
+// Supervisor runs and restarts one goosed process.
+type Supervisor struct {
+	cfg  Config
+	http *http.Client
+
+	mu    sync.Mutex
+	ready chan struct{} // closed once the current process answers /status
+	up    bool
+}
+
+// New returns a Supervisor for the process described by cfg. Call Run to
+// start it.
+func New(cfg Config) *Supervisor {
+	if len(cfg.Args) == 0 {
+		cfg.Args = []string{"agent"}
+	}
+	if cfg.ReadyTimeout <= 0 {
+		cfg.ReadyTimeout = 30 * time.Second
+	}
+	return &Supervisor{
+		cfg:   cfg,
+		http:  &http.Client{Timeout: time.Second},
+		ready: make(chan struct{}),
+	}
+}
+
+// BaseURL returns the URL the supervised goosed serves on.
+func (s *Supervisor) BaseURL() string {
+	return "http://127.0.0.1:" + strconv.Itoa(s.cfg.Port)
+}
+
+// Ready reports whether the current goosed process answers /status.
+func (s *Supervisor) Ready() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.up
+}
+
+// WaitReady blocks until goosed is ready, or ctx is done.
+func (s *Supervisor) WaitReady(ctx context.Context) error {
+	s.mu.Lock()
+	ready := s.ready
+	s.mu.Unlock()
+	select {
+	case <-ready:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Run starts goosed and restarts it whenever it exits or fails to become
+// ready, until ctx is done, when it stops the process and returns. It
+// returns early only if goosed cannot be started at all.
+func (s *Supervisor) Run(ctx context.Context) error {
+	delay := minRestartDelay
+	for {
+		started := time.Now()
+		err := s.runOnce(ctx)
+		if ctx.Err() != nil {
+			return nil
+		}
+		var execErr *exec.Error
+		if errors.As(err, &execErr) || errors.Is(err, os.ErrNotExist) || errors.Is(err, os.ErrPermission) {
+			return fmt.Errorf("start goosed: %w", err)
+		}
+		if time.Since(started) >= stableAfter {
+			delay = minRestartDelay
+		}
+		log.Printf("goosed on port %d exited: %v; restarting in %s", s.cfg.Port, err, delay)
+		restartsTotal.Inc(strconv.Itoa(s.cfg.Port))
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return nil
+		}
+		delay = min(2*delay, maxRestartDelay)
+	}
+}
+
+// runOnce runs one goosed process until it exits, fails to become ready,
+// or ctx is done.
+func (s *Supervisor) runOnce(ctx context.Context) error {
+	procCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	cmd := exec.CommandContext(procCtx, s.cfg.Binary, s.cfg.Args...)
+	cmd.Env = secrets.ChildEnviron(s.cfg.Env...)
+	cmd.Env = append(cmd.Env,
+		"GOOSE_PORT="+strconv.Itoa(s.cfg.Port),
+		"GOOSE_SERVER__SECRET_KEY="+s.cfg.SecretKey,
+	)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	// Stopping asks goosed to shut down, killing it if it has not within
+	// stopTimeout.
+	cmd.Cancel = func() error { return cmd.Process.Signal(os.Interrupt) }
+	cmd.WaitDelay = stopTimeout
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	log.Printf("started goosed (pid %d) on port %d", cmd.Process.Pid, s.cfg.Port)
+
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+	defer s.setDown()
+
+	readyCtx, cancelReady := context.WithTimeout(procCtx, s.cfg.ReadyTimeout)
+	defer cancelReady()
+	select {
+	case err := <-s.awaitReady(readyCtx):
+		if err != nil {
+			cancel()
+			<-exited
+			return fmt.Errorf("not ready within %s: %w", s.cfg.ReadyTimeout, err)
+		}
+	case err := <-exited:
+		return exitError(err)
+	}
+	s.setUp()
+	log.Printf("goosed on port %d is ready", s.cfg.Port)
+
+	return exitError(<-exited)
+}
+
+// awaitReady polls goosed's /status until it answers 200, reporting nil,
+// or ctx ends, reporting ctx's error.
+func (s *Supervisor) awaitReady(ctx context.Context) <-chan error {
+	done := make(chan error, 1)
+	go func() {
+		ticker := time.NewTicker(readyPollInterval)
+		defer ticker.Stop()
+		for {
+			if s.probe(ctx) {
+				done <- nil
+				return
+			}
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				done <- ctx.Err()
+				return
+			}
+		}
+	}()
+	return done
+}
+
+// probe reports whether goosed answers /status.
+func (s *Supervisor) probe(ctx context.Context) bool {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.BaseURL()+"/status", nil)
+	if err != nil {
+		return false
+	}
+	resp, err := s.http.Do(req)
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+	return resp.StatusCode == http.StatusOK
+}
+
+func (s *Supervisor) setUp() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.up = true
+	close(s.ready)
+}
+
+// setDown marks the process gone; WaitReady then waits for the next one.
+func (s *Supervisor) setDown() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.up {
+		s.up = false
+		s.ready = make(chan struct{})
+	}
+}
+
+// exitError describes how goosed exited; a clean exit is still an error,
+// as goosed is expected to run until stopped.
+func exitError(err error) error {
+	if err == nil {
+		return errors.New("exited with status 0")
+	}
+	return err
+}
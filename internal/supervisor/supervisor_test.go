@@ -0,0 +1,114 @@
+package supervisor
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestMain doubles as a fake goosed when the supervisor starts the test
+// binary with fakeGoosedEnv set.
+func TestMain(m *testing.M) {
+	if os.Getenv(fakeGoosedEnv) == "1" {
+		fakeGoosed()
+		return
+	}
+	os.Exit(m.Run())
+}
+
+const fakeGoosedEnv = "SUPERVISOR_FAKE_GOOSED"
+
+// fakeGoosed serves /status on GOOSE_PORT and exits with status 1 on
+// /crash.
+func fakeGoosed() {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /status", func(w http.ResponseWriter, r *http.Request) {
+		if os.Getenv("GOOSE_SERVER__SECRET_KEY") != "secret" {
+			http.Error(w, "missing secret", http.StatusInternalServerError)
+			return
+		}
+		if _, ok := os.LookupEnv("ADMIN_TOKEN"); ok {
+			http.Error(w, "given the proxy's admin token", http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte("ok"))
+	})
+	mux.HandleFunc("GET /crash", func(w http.ResponseWriter, r *http.Request) {
+		os.Exit(1)
+	})
+	http.ListenAndServe("127.0.0.1:"+os.Getenv("GOOSE_PORT"), mux)
+	os.Exit(2)
+}
+
+// freePort returns a port nothing is listening on.
+func freePort(t *testing.T) int {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+func TestSupervisor_RestartsOnCrash(t *testing.T) {
+	t.Setenv("ADMIN_TOKEN", "admin")
+	port := freePort(t)
+	sup := New(Config{
+		Binary:    os.Args[0],
+		Env:       []string{fakeGoosedEnv + "=1"},
+		Port:      port,
+		SecretKey: "secret",
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan error, 1)
+	go func() { stopped <- sup.Run(ctx) }()
+
+	waitCtx, cancelWait := context.WithTimeout(ctx, 10*time.Second)
+	defer cancelWait()
+	if err := sup.WaitReady(waitCtx); err != nil {
+		t.Fatalf("goosed not ready: %v", err)
+	}
+	if !strings.HasSuffix(sup.BaseURL(), ":"+strconv.Itoa(port)) {
+		t.Errorf("unexpected base URL %s", sup.BaseURL())
+	}
+
+	before := restartsTotal.Value(strconv.Itoa(port))
+	if resp, err := http.Get(sup.BaseURL() + "/crash"); err == nil {
+		resp.Body.Close()
+	}
+	for sup.Ready() {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := sup.WaitReady(waitCtx); err != nil {
+		t.Fatalf("goosed not restarted: %v", err)
+	}
+	if got := restartsTotal.Value(strconv.Itoa(port)); got != before+1 {
+		t.Errorf("expected one restart counted, got %v", got-before)
+	}
+
+	cancel()
+	select {
+	case err := <-stopped:
+		if err != nil {
+			t.Errorf("Run: %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("Run did not return after cancellation")
+	}
+	if sup.Ready() {
+		t.Error("expected goosed stopped")
+	}
+}
+
+func TestSupervisor_MissingBinary(t *testing.T) {
+	sup := New(Config{Binary: "/nonexistent/goosed", Port: freePort(t)})
+	if err := sup.Run(context.Background()); err == nil {
+		t.Fatal("expected an error for a missing binary")
+	}
+}
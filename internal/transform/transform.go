@@ -0,0 +1,226 @@
+// Package transform reshapes Goose tool results with declarative rules
+// before they are surfaced to ADK clients as FunctionResponse payloads.
+package transform
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// Rule reshapes the results of matching tools. Response is a template for
+// the new payload: strings starting with "$" are JSONPath expressions
+// evaluated against the tool's result, objects are templates in turn, and
+// any other value is copied as is. Fields whose expression matches nothing
+// are left out.
+//
+// The supported JSONPath subset is the root "$" followed by ".name",
+// "['name']", "[index]", and "[*]" steps; a step after "[*]" applies to
+// every element, so "$.items[*].id" lists the items' IDs.
+type Rule struct {
+	// Tool is a path.Match pattern selecting the tools the rule applies to.
+	Tool     string         `json:"tool"`
+	Response map[string]any `json:"response"`
+
+	compiled map[string]any // Response with expressions parsed
+}
+
+// Compile validates the rule and parses its expressions. It must be called
+// before Apply.
+func (r *Rule) Compile() error {
+	if r.Tool == "" || r.Response == nil {
+		return fmt.Errorf("transform rule requires both tool and response")
+	}
+	if _, err := path.Match(r.Tool, ""); err != nil {
+		return fmt.Errorf("transform rule tool pattern %q: %w", r.Tool, err)
+	}
+	compiled, err := compileTemplate(r.Response)
+	if err != nil {
+		return fmt.Errorf("transform rule for %s: %w", r.Tool, err)
+	}
+	r.compiled = compiled.(map[string]any)
+	return nil
+}
+
+// Matches reports whether the rule applies to the named tool.
+func (r *Rule) Matches(toolName string) bool {
+	ok, _ := path.Match(r.Tool, toolName)
+	return ok
+}
+
+// Apply builds the rule's response payload from a tool result.
+func (r *Rule) Apply(result any) map[string]any {
+	out, _ := evalTemplate(r.compiled, result)
+	m, _ := out.(map[string]any)
+	return m
+}
+
+// Find returns the first rule matching the named tool, or nil.
+func Find(rules []Rule, toolName string) *Rule {
+	for i := range rules {
+		if rules[i].Matches(toolName) {
+			return &rules[i]
+		}
+	}
+	return nil
+}
+
+// LoadFile reads and compiles a JSON array of rules.
+func LoadFile(file string) ([]Rule, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("read transform rules: %w", err)
+	}
+	var rules []Rule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("parse transform rules %s: %w", file, err)
+	}
+	for i := range rules {
+		if err := rules[i].Compile(); err != nil {
+			return nil, err
+		}
+	}
+	return rules, nil
+}
+
+// step is one step of a JSONPath expression: a field name, an index, or a
+// wildcard over array elements.
+type step struct {
+	name     string
+	index    int
+	isIndex  bool
+	wildcard bool
+}
+
+// expr is a parsed JSONPath expression.
+type expr []step
+
+func compileTemplate(tmpl any) (any, error) {
+	switch v := tmpl.(type) {
+	case string:
+		if !strings.HasPrefix(v, "$") {
+			return v, nil
+		}
+		return parsePath(v)
+	case map[string]any:
+		out := make(map[string]any, len(v))
+		for k, sub := range v {
+			c, err := compileTemplate(sub)
+			if err != nil {
+				return nil, err
+			}
+			out[k] = c
+		}
+		return out, nil
+	default:
+		return v, nil
+	}
+}
+
+// evalTemplate evaluates a compiled template against doc, reporting false
+// if it is an expression that matched nothing.
+func evalTemplate(tmpl, doc any) (any, bool) {
+	switch v := tmpl.(type) {
+	case expr:
+		return v.eval(doc)
+	case map[string]any:
+		out := make(map[string]any, len(v))
+		for k, sub := range v {
+			if value, ok := evalTemplate(sub, doc); ok {
+				out[k] = value
+			}
+		}
+		return out, true
+	default:
+		return v, true
+	}
+}
+
+func parsePath(s string) (expr, error) {
+	rest := strings.TrimPrefix(s, "$")
+	var e expr
+	for rest != "" {
+		switch {
+		case strings.HasPrefix(rest, "."):
+			rest = rest[1:]
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			if end == 0 {
+				return nil, fmt.Errorf("path %q: empty field name", s)
+			}
+			e = append(e, step{name: rest[:end]})
+			rest = rest[end:]
+		case strings.HasPrefix(rest, "["):
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("path %q: unterminated [", s)
+			}
+			inner := rest[1:end]
+			rest = rest[end+1:]
+			switch {
+			case inner == "*":
+				e = append(e, step{wildcard: true})
+			case len(inner) >= 2 && inner[0] == '\'' && inner[len(inner)-1] == '\'':
+				e = append(e, step{name: inner[1 : len(inner)-1]})
+			default:
+				n, err := strconv.Atoi(inner)
+				if err != nil {
+					return nil, fmt.Errorf("path %q: invalid index %q", s, inner)
+				}
+				e = append(e, step{index: n, isIndex: true})
+			}
+		default:
+			return nil, fmt.Errorf("path %q: unexpected %q", s, rest)
+		}
+	}
+	return e, nil
+}
+
+func (e expr) eval(doc any) (any, bool) {
+	if len(e) == 0 {
+		return doc, true
+	}
+	st, rest := e[0], e[1:]
+	switch {
+	case st.wildcard:
+		items, ok := doc.([]any)
+		if !ok {
+			return nil, false
+		}
+		out := make([]any, 0, len(items))
+		for _, item := range items {
+			if v, ok := rest.eval(item); ok {
+				out = append(out, v)
+			}
+		}
+		return out, true
+	case st.isIndex:
+		items, ok := doc.([]any)
+		if !ok {
+			return nil, false
+		}
+		i := st.index
+		if i < 0 {
+			i += len(items)
+		}
+		if i < 0 || i >= len(items) {
+			return nil, false
+		}
+		return rest.eval(items[i])
+	default:
+		obj, ok := doc.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		v, ok := obj[st.name]
+		if !ok {
+			return nil, false
+		}
+		return rest.eval(v)
+	}
+}
@@ -0,0 +1,48 @@
+package transform
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+)
+
+func TestRuleApply(t *testing.T) {
+	rule := Rule{Tool: "github__*", Response: map[string]any{
+		"title":  "$.issue.title",
+		"labels": "$.issue.labels[*].name",
+		"first":  "$['issue'].labels[0].name",
+		"last":   "$.issue.labels[-1].name",
+		"meta":   map[string]any{"source": "github", "number": "$.issue.number"},
+		"absent": "$.issue.assignee",
+		"whole":  "$.ok",
+	}}
+	if err := rule.Compile(); err != nil {
+		t.Fatalf("Compile: %v", err)
+	}
+	if !rule.Matches("github__get_issue") || rule.Matches("developer__shell") {
+		t.Fatal("unexpected tool matching")
+	}
+
+	var result any
+	json.Unmarshal([]byte(`{"ok": true, "issue": {"title": "Crash", "number": 7, "labels": [{"name": "bug"}, {"name": "p1"}]}}`), &result)
+	got := rule.Apply(result)
+	want := "map[first:bug labels:[bug p1] last:p1 meta:map[number:7 source:github] title:Crash whole:true]"
+	if fmt.Sprint(got) != want {
+		t.Errorf("Apply = %v, want %s", got, want)
+	}
+}
+
+func TestRuleCompileErrors(t *testing.T) {
+	for _, rule := range []Rule{
+		{Response: map[string]any{"a": "$.a"}},
+		{Tool: "x"},
+		{Tool: "[", Response: map[string]any{}},
+		{Tool: "x", Response: map[string]any{"a": "$.a[b]"}},
+		{Tool: "x", Response: map[string]any{"a": "$.a[0"}},
+		{Tool: "x", Response: map[string]any{"a": "$..a"}},
+	} {
+		if err := rule.Compile(); err == nil {
+			t.Errorf("expected an error compiling %+v", rule)
+		}
+	}
+}
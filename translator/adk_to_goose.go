@@ -0,0 +1,267 @@
+package translator
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"github.com/innomon/adk2goose/gooseclient"
+	"google.golang.org/genai"
+)
+
+// ADKContentToGooseMessage converts an ADK genai.Content into a Goose message
+// using the default options.
+func ADKContentToGooseMessage(content *genai.Content) *gooseclient.GooseMessage {
+	return defaultTranslator.ADKContentToGooseMessage(content)
+}
+
+// Roles that ADK histories may carry besides genai.RoleUser and
+// genai.RoleModel. RoleFunction is the older name for RoleTool.
+const (
+	RoleSystem   = "system"
+	RoleTool     = "tool"
+	RoleFunction = "function"
+)
+
+// ADKContentToGooseMessage converts an ADK genai.Content into a Goose message.
+// Goose conversations have only user and assistant messages: model content
+// becomes an assistant message; tool content, whose function responses
+// become toolResponse content, a user message as Goose sends tool results;
+// and system content a user message visible only to the agent, injecting
+// it as context. Use ADKSystemInstructions to apply system content to the
+// agent's system prompt instead.
+func (t *Translator) ADKContentToGooseMessage(content *genai.Content) *gooseclient.GooseMessage {
+	role := "user"
+	userVisible := true
+	switch content.Role {
+	case genai.RoleModel:
+		role = "assistant"
+	case RoleSystem:
+		userVisible = false
+	}
+
+	// Parts are converted one at a time so Goose content keeps the ADK
+	// order, which interleaved multimodal prompts depend on.
+	handlers := adkPartHandlers()
+	var parts []gooseclient.MessageContent
+	for _, part := range content.Parts {
+		parts = append(parts, adkPartToGooseContent(handlers, part)...)
+	}
+
+	if !t.opts.PreservePartOrder {
+		parts = toolResponsesFirst(parts)
+	}
+
+	return &gooseclient.GooseMessage{
+		Role:    role,
+		Created: t.now().Unix(),
+		Content: parts,
+		Metadata: &gooseclient.MessageMetadata{
+			UserVisible:  userVisible,
+			AgentVisible: true,
+		},
+	}
+}
+
+// adkPartToGooseContent converts one ADK part into Goose content. A part
+// normally carries one kind of data; one that sets several yields content
+// for each, in a fixed order.
+func adkPartToGooseContent(handlers []namedADKPartHandler, part *genai.Part) []gooseclient.MessageContent {
+	if mcs, ok := customGooseContent(handlers, part); ok {
+		return mcs
+	}
+	if part.Thought {
+		return []gooseclient.MessageContent{adkThoughtToGooseContent(part)}
+	}
+	var parts []gooseclient.MessageContent
+	if part.Text != "" {
+		parts = append(parts, gooseclient.MessageContent{
+			Type: "text",
+			Text: part.Text,
+		})
+	}
+	if part.FunctionCall != nil {
+		parts = append(parts, gooseclient.MessageContent{
+			Type: "toolRequest",
+			ID:   part.FunctionCall.ID,
+			ToolCall: &gooseclient.ToolCall{
+				Name:      part.FunctionCall.Name,
+				Arguments: part.FunctionCall.Args,
+			},
+		})
+	}
+	if part.FunctionResponse != nil {
+		respText, _ := json.Marshal(part.FunctionResponse.Response)
+		parts = append(parts, gooseclient.MessageContent{
+			Type: "toolResponse",
+			ID:   part.FunctionResponse.ID,
+			ToolResult: &gooseclient.ToolResult{
+				Content: []gooseclient.MessageContent{
+					{Type: "text", Text: string(respText)},
+				},
+				IsError: false,
+			},
+		})
+	}
+	if part.InlineData != nil {
+		parts = append(parts, gooseclient.MessageContent{
+			Type:     "image",
+			Data:     base64.StdEncoding.EncodeToString(part.InlineData.Data),
+			MimeType: part.InlineData.MIMEType,
+		})
+	}
+	return parts
+}
+
+// customGooseContent converts part with the first registered handler that
+// accepts it.
+func customGooseContent(handlers []namedADKPartHandler, part *genai.Part) ([]gooseclient.MessageContent, bool) {
+	for _, h := range handlers {
+		if mcs, ok := h.fn(part); ok {
+			return mcs, true
+		}
+	}
+	return nil, false
+}
+
+// ADKRunSSERequestToReplyRequest converts a session ID and ADK content into a
+// Goose ReplyRequest suitable for the streaming reply endpoint, using the
+// default options.
+func ADKRunSSERequestToReplyRequest(sessionID string, content *genai.Content) *gooseclient.ReplyRequest {
+	return defaultTranslator.ADKRunSSERequestToReplyRequest(sessionID, content)
+}
+
+// ADKRunSSERequestToReplyRequest converts a session ID and ADK content into a
+// Goose ReplyRequest suitable for the streaming reply endpoint.
+func (t *Translator) ADKRunSSERequestToReplyRequest(sessionID string, content *genai.Content) *gooseclient.ReplyRequest {
+	msg := t.ADKContentToGooseMessage(content)
+	return &gooseclient.ReplyRequest{
+		UserMessage: msg,
+		SessionID:   sessionID,
+	}
+}
+
+// ADKEventsToGooseConversation rebuilds a Goose conversation from ADK event
+// history using the default options.
+func ADKEventsToGooseConversation(events []*ADKEvent) []gooseclient.GooseMessage {
+	return defaultTranslator.ADKEventsToGooseConversation(events)
+}
+
+// ADKEventsToGooseConversation rebuilds a Goose conversation from ADK event
+// history, oldest first, for ReplyRequest.ConversationSoFar. Partial events,
+// events without content, and system content, which belongs in the system
+// prompt (see ADKSystemInstructions), are skipped.
+func (t *Translator) ADKEventsToGooseConversation(events []*ADKEvent) []gooseclient.GooseMessage {
+	var messages []gooseclient.GooseMessage
+	for _, evt := range events {
+		if evt.Partial || evt.Content == nil || evt.Content.Role == RoleSystem {
+			continue
+		}
+		msg := t.ADKContentToGooseMessage(evt.Content)
+		if len(msg.Content) == 0 {
+			continue
+		}
+		if evt.Time != 0 {
+			msg.Created = evt.Time
+		}
+		messages = append(messages, *msg)
+	}
+	return messages
+}
+
+// ADKSystemInstructions returns the text of the system-role content in ADK
+// event history, oldest first and separated by blank lines, for extending
+// the system prompt of the Goose agent the history is replayed to. It
+// returns "" if the history has none.
+func ADKSystemInstructions(events []*ADKEvent) string {
+	var texts []string
+	for _, evt := range events {
+		if evt.Partial || evt.Content == nil || evt.Content.Role != RoleSystem {
+			continue
+		}
+		for _, part := range evt.Content.Parts {
+			if part.Text != "" && !part.Thought {
+				texts = append(texts, part.Text)
+			}
+		}
+	}
+	return strings.Join(texts, "\n\n")
+}
+
+// generationParamNames maps genai.GenerationConfig JSON fields to the Goose
+// provider request parameters with the same meaning.
+var generationParamNames = map[string]string{
+	"temperature":      "temperature",
+	"topP":             "top_p",
+	"topK":             "top_k",
+	"maxOutputTokens":  "max_tokens",
+	"stopSequences":    "stop",
+	"seed":             "seed",
+	"presencePenalty":  "presence_penalty",
+	"frequencyPenalty": "frequency_penalty",
+}
+
+// toolResponsesFirst moves toolResponse content ahead of the rest of a
+// message, stably, since many providers require tool results to directly
+// follow the assistant's tool calls.
+func toolResponsesFirst(parts []gooseclient.MessageContent) []gooseclient.MessageContent {
+	sorted := make([]gooseclient.MessageContent, 0, len(parts))
+	for _, mc := range parts {
+		if mc.Type == "toolResponse" {
+			sorted = append(sorted, mc)
+		}
+	}
+	for _, mc := range parts {
+		if mc.Type != "toolResponse" {
+			sorted = append(sorted, mc)
+		}
+	}
+	return sorted
+}
+
+// adkThoughtToGooseContent converts an ADK thought part back into Goose
+// thinking content. A thought with a signature but no text is the redacted
+// form produced by GooseMessageToADKContent.
+func adkThoughtToGooseContent(part *genai.Part) gooseclient.MessageContent {
+	if part.Text == "" && len(part.ThoughtSignature) > 0 {
+		return gooseclient.MessageContent{
+			Type: "redactedThinking",
+			Data: string(part.ThoughtSignature),
+		}
+	}
+	return gooseclient.MessageContent{
+		Type:      "thinking",
+		Thinking:  part.Text,
+		Signature: string(part.ThoughtSignature),
+	}
+}
+
+// ADKGenerationConfigToGooseParams converts an ADK generation config into
+// Goose provider request parameters. Fields Goose has no equivalent for are
+// returned, sorted, in ignored.
+func ADKGenerationConfigToGooseParams(cfg *genai.GenerationConfig) (params map[string]any, ignored []string) {
+	if cfg == nil {
+		return nil, nil
+	}
+
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		return nil, nil
+	}
+	var fields map[string]any
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, nil
+	}
+
+	params = make(map[string]any)
+	for field, value := range fields {
+		if name, ok := generationParamNames[field]; ok {
+			params[name] = value
+			continue
+		}
+		ignored = append(ignored, field)
+	}
+	sort.Strings(ignored)
+	return params, ignored
+}
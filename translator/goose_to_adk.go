@@ -0,0 +1,382 @@
+package translator
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"maps"
+	"sync"
+
+	"github.com/innomon/adk2goose/gooseclient"
+	"google.golang.org/genai"
+)
+
+// ADKEvent represents an event in the ADK REST API SSE stream.
+type ADKEvent struct {
+	ID             string                                      `json:"id"`
+	Time           int64                                       `json:"time"`
+	InvocationID   string                                      `json:"invocationId"`
+	Branch         string                                      `json:"branch"`
+	Author         string                                      `json:"author"`
+	Partial        bool                                        `json:"partial"`
+	Content        *genai.Content                              `json:"content,omitempty"`
+	TurnComplete   bool                                        `json:"turnComplete"`
+	Interrupted    bool                                        `json:"interrupted"`
+	FinishReason   genai.FinishReason                          `json:"finishReason,omitempty"`
+	ErrorCode      string                                      `json:"errorCode,omitempty"`
+	ErrorMessage   string                                      `json:"errorMessage,omitempty"`
+	Actions        *ADKEventActions                            `json:"actions,omitempty"`
+	UsageMetadata  *genai.GenerateContentResponseUsageMetadata `json:"usageMetadata,omitempty"`
+	CustomMetadata map[string]any                              `json:"customMetadata,omitempty"`
+}
+
+// ADKEventActions holds state and artifact changes associated with an ADK
+// event.
+type ADKEventActions struct {
+	StateDelta map[string]any `json:"stateDelta,omitempty"`
+	// ArtifactDelta maps artifact names to the versions saved by the event.
+	ArtifactDelta map[string]int `json:"artifactDelta,omitempty"`
+}
+
+// GooseSSEEventToADKEvent converts a Goose SSE event into an ADK REST event
+// using the default options.
+func GooseSSEEventToADKEvent(sse *gooseclient.SSEEvent, invocationID string) (*ADKEvent, error) {
+	return defaultTranslator.GooseSSEEventToADKEvent(sse, invocationID)
+}
+
+// GooseSSEEventToADKEvent converts a Goose SSE event into an ADK REST event.
+// It returns nil for events with no ADK equivalent.
+func (t *Translator) GooseSSEEventToADKEvent(sse *gooseclient.SSEEvent, invocationID string) (*ADKEvent, error) {
+	switch sse.Type {
+	case "Message":
+		content := t.GooseMessageToADKContent(sse.Message)
+		evt := t.newEvent(invocationID)
+		evt.Content = content
+		if redacted := redactedThinkingPayloads(sse.Message); len(redacted) > 0 && !t.opts.StripThoughts {
+			evt.CustomMetadata = map[string]any{RedactedThinkingMetadataKey: redacted}
+		}
+		if sse.Message.ID != "" {
+			if evt.CustomMetadata == nil {
+				evt.CustomMetadata = make(map[string]any, 1)
+			}
+			evt.CustomMetadata[GooseMessageIDMetadataKey] = sse.Message.ID
+		}
+		// Pieces of a streaming tool call are superseded by the complete
+		// call, so they are kept out of history.
+		evt.Partial = hasPartialToolRequest(sse.Message)
+		return evt, nil
+
+	case "Finish":
+		evt := t.newEvent(invocationID)
+		evt.TurnComplete = true
+		applyFinishReason(evt, sse.Reason)
+		if sse.TokenState != nil {
+			evt.UsageMetadata = GooseTokenStateToUsageMetadata(sse.TokenState)
+		}
+		return evt, nil
+
+	case "Error":
+		return t.NewErrorEvent(invocationID, "GOOSE_ERROR", sse.Error), nil
+
+	case "Notification":
+		if sse.Notification == nil {
+			return nil, nil
+		}
+		// Notifications are transient progress updates, so they are marked
+		// partial to keep ADK clients from persisting them in history.
+		evt := t.NewMetadataEvent(invocationID, NotificationMetadataKey, map[string]any{
+			"requestId": sse.RequestID,
+			"method":    sse.Notification.Method,
+			"params":    sse.Notification.Params,
+		})
+		evt.Partial = true
+		return evt, nil
+
+	case "Ping", "ModelChange":
+		return nil, nil
+
+	default:
+		dropped("event", sse.Type)
+		return nil, nil
+	}
+}
+
+// applyFinishReason maps a Goose finish reason onto a turn-complete event.
+// Truncation is also reported as an error so clients that only check
+// errorCode notice it; cancellation marks the turn interrupted.
+func applyFinishReason(evt *ADKEvent, reason string) {
+	switch reason {
+	case "", "stop", "tool":
+		evt.FinishReason = genai.FinishReasonStop
+	case "length":
+		evt.FinishReason = genai.FinishReasonMaxTokens
+		evt.ErrorCode = string(genai.FinishReasonMaxTokens)
+		evt.ErrorMessage = "response truncated at the model's output token limit"
+	case "cancelled":
+		evt.Interrupted = true
+	default:
+		evt.FinishReason = genai.FinishReasonOther
+	}
+}
+
+// NewErrorEvent builds an ADK event reporting an error raised by Goose or by
+// the proxy itself.
+func NewErrorEvent(invocationID, code, message string) *ADKEvent {
+	return defaultTranslator.NewErrorEvent(invocationID, code, message)
+}
+
+// NewErrorEvent builds an ADK event reporting an error raised by Goose or by
+// the bridge itself.
+func (t *Translator) NewErrorEvent(invocationID, code, message string) *ADKEvent {
+	evt := t.newEvent(invocationID)
+	evt.ErrorCode = code
+	evt.ErrorMessage = message
+	return evt
+}
+
+// NewContentEvent builds an ADK event carrying content.
+func NewContentEvent(invocationID string, content *genai.Content) *ADKEvent {
+	return defaultTranslator.NewContentEvent(invocationID, content)
+}
+
+// NewContentEvent builds an ADK event carrying content.
+func (t *Translator) NewContentEvent(invocationID string, content *genai.Content) *ADKEvent {
+	evt := t.newEvent(invocationID)
+	evt.Content = content
+	return evt
+}
+
+// NewMetadataEvent builds a content-free ADK event carrying value under key
+// in its custom metadata.
+func NewMetadataEvent(invocationID, key string, value any) *ADKEvent {
+	return defaultTranslator.NewMetadataEvent(invocationID, key, value)
+}
+
+// NewMetadataEvent builds a content-free ADK event carrying value under key
+// in its custom metadata.
+func (t *Translator) NewMetadataEvent(invocationID, key string, value any) *ADKEvent {
+	evt := t.newEvent(invocationID)
+	evt.CustomMetadata = map[string]any{key: value}
+	return evt
+}
+
+// eventPool recycles ADKEvent structs on the streaming hot path.
+var eventPool = sync.Pool{New: func() any { return new(ADKEvent) }}
+
+// newEvent returns a pooled ADKEvent stamped with a fresh ID and timestamp.
+func (t *Translator) newEvent(invocationID string) *ADKEvent {
+	evt := eventPool.Get().(*ADKEvent)
+	evt.ID = t.newID()
+	evt.Time = t.now().Unix()
+	evt.InvocationID = invocationID
+	evt.Author = t.opts.Author
+	if evt.Author == "" {
+		evt.Author = "goose"
+	}
+	return evt
+}
+
+// ReleaseEvent returns evt to the pool used by the translator's event
+// constructors. Callers must not use or retain evt afterwards; events that
+// are stored or shared must simply not be released.
+func ReleaseEvent(evt *ADKEvent) {
+	if evt == nil {
+		return
+	}
+	*evt = ADKEvent{}
+	eventPool.Put(evt)
+}
+
+// GooseMessageToADKContent converts a Goose message into a genai Content
+// using the default options.
+func GooseMessageToADKContent(msg *gooseclient.GooseMessage) *genai.Content {
+	return defaultTranslator.GooseMessageToADKContent(msg)
+}
+
+// GooseMessageToADKContent converts a Goose message into a genai Content.
+func (t *Translator) GooseMessageToADKContent(msg *gooseclient.GooseMessage) *genai.Content {
+	role := msg.Role
+	if role == "assistant" {
+		role = "model"
+	}
+
+	var parts []*genai.Part
+	for _, mc := range msg.Content {
+		if fn, ok := gooseContentHandler(mc.Type); ok {
+			parts = append(parts, fn(&mc)...)
+			continue
+		}
+		switch mc.Type {
+		case "text":
+			parts = append(parts, genai.NewPartFromText(mc.Text))
+
+		case "toolRequest":
+			part := &genai.Part{
+				FunctionCall: &genai.FunctionCall{
+					ID:   mc.ID,
+					Name: mc.ToolCall.Name,
+					Args: mc.ToolCall.Arguments,
+				},
+			}
+			// A call still being streamed has the arguments formed so
+			// far (see ToolCallStream) and is marked to continue.
+			if mc.PartialToolRequest() {
+				part.FunctionCall.WillContinue = genai.Ptr(true)
+			}
+			parts = append(parts, part)
+
+		case "toolResponse":
+			part := &genai.Part{
+				FunctionResponse: &genai.FunctionResponse{
+					ID:       mc.ID,
+					Name:     "",
+					Response: toolResultResponse(mc.ToolResult),
+				},
+			}
+			parts = append(parts, part)
+			// Images returned by the tool (e.g. screenshots) follow the
+			// response as inline data.
+			if mc.ToolResult != nil {
+				for i := range mc.ToolResult.Content {
+					if img := gooseImageToADKPart(&mc.ToolResult.Content[i]); img != nil {
+						parts = append(parts, img)
+					}
+				}
+			}
+
+		case "image":
+			if img := gooseImageToADKPart(&mc); img != nil {
+				parts = append(parts, img)
+			}
+
+		case "toolConfirmationRequest":
+			parts = append(parts, &genai.Part{
+				FunctionCall: GooseConfirmationToADKFunctionCall(&mc),
+			})
+
+		case "thinking", "reasoning":
+			if t.opts.StripThoughts {
+				continue
+			}
+			text := mc.Thinking
+			if text == "" {
+				text = mc.Text
+			}
+			part := genai.NewPartFromText(text)
+			part.Thought = true
+			if mc.Signature != "" {
+				part.ThoughtSignature = []byte(mc.Signature)
+			}
+			parts = append(parts, part)
+
+		case "redactedThinking":
+			if t.opts.StripThoughts {
+				continue
+			}
+			// The reasoning is encrypted by the model provider; the opaque
+			// payload rides in ThoughtSignature so it can be replayed intact.
+			parts = append(parts, &genai.Part{
+				Thought:          true,
+				ThoughtSignature: []byte(mc.Data),
+			})
+
+		default:
+			dropped("content", mc.Type)
+		}
+	}
+
+	return &genai.Content{Parts: parts, Role: role}
+}
+
+// NotificationMetadataKey is the event customMetadata key carrying an MCP
+// notification (tool progress or log message) relayed by Goose.
+const NotificationMetadataKey = "goose:notification"
+
+// RedactedThinkingMetadataKey is the event customMetadata key listing the
+// opaque payloads of redacted thought parts in the event's content, in order.
+// A thought part with a signature but no text is redacted.
+const RedactedThinkingMetadataKey = "goose:redactedThinking"
+
+// redactedThinkingPayloads returns the opaque data of every redactedThinking
+// item in msg.
+func redactedThinkingPayloads(msg *gooseclient.GooseMessage) []string {
+	var payloads []string
+	for _, mc := range msg.Content {
+		if mc.Type == "redactedThinking" {
+			payloads = append(payloads, mc.Data)
+		}
+	}
+	return payloads
+}
+
+// gooseImageToADKPart decodes a Goose image content item into an inline data
+// part. It returns nil for non-image content or undecodable data.
+func gooseImageToADKPart(mc *gooseclient.MessageContent) *genai.Part {
+	if mc.Type != "image" || mc.Data == "" {
+		return nil
+	}
+	data, err := base64.StdEncoding.DecodeString(mc.Data)
+	if err != nil {
+		return nil
+	}
+	return genai.NewPartFromBytes(data, mc.MimeType)
+}
+
+// GooseTokenStateToUsageMetadata converts Goose token state into genai usage metadata.
+func GooseTokenStateToUsageMetadata(ts *gooseclient.TokenState) *genai.GenerateContentResponseUsageMetadata {
+	return &genai.GenerateContentResponseUsageMetadata{
+		PromptTokenCount:     ts.InputTokens,
+		CandidatesTokenCount: ts.OutputTokens,
+		TotalTokenCount:      ts.TotalTokens,
+	}
+}
+
+// toolResultResponse returns the FunctionResponse payload for a Goose tool
+// result: its structured_content as is, so agents can read typed fields,
+// or else its text under "result".
+func toolResultResponse(tr *gooseclient.ToolResult) map[string]any {
+	if tr != nil && tr.StructuredContent != nil {
+		return maps.Clone(tr.StructuredContent)
+	}
+	return map[string]any{"result": extractToolResultText(tr)}
+}
+
+// extractToolResultText extracts a text representation from a ToolResult.
+func extractToolResultText(tr *gooseclient.ToolResult) string {
+	if tr == nil {
+		return ""
+	}
+	for _, c := range tr.Content {
+		if c.Type == "text" && c.Text != "" {
+			return c.Text
+		}
+	}
+	if tr.StructuredContent != nil {
+		b, err := json.Marshal(tr.StructuredContent)
+		if err == nil {
+			return string(b)
+		}
+	}
+	return ""
+}
+
+// GooseToolToADKFunctionDeclaration describes a Goose tool as an ADK function
+// declaration. The tool's JSON schema is used when Goose reports one;
+// otherwise the parameters are declared by name only.
+func GooseToolToADKFunctionDeclaration(tool *gooseclient.ToolInfo) *genai.FunctionDeclaration {
+	decl := &genai.FunctionDeclaration{
+		Name:        tool.Name,
+		Description: tool.Description,
+	}
+	if tool.InputSchema != nil {
+		decl.ParametersJsonSchema = tool.InputSchema
+		return decl
+	}
+	decl.Parameters = &genai.Schema{Type: genai.TypeObject}
+	if len(tool.Parameters) > 0 {
+		decl.Parameters.Properties = make(map[string]*genai.Schema, len(tool.Parameters))
+		for _, name := range tool.Parameters {
+			decl.Parameters.Properties[name] = &genai.Schema{}
+		}
+	}
+	return decl
+}
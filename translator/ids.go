@@ -0,0 +1,106 @@
+package translator
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+	"sync"
+	"time"
+)
+
+// crockford is the Crockford base32 alphabet ULIDs are written in.
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// ULIDSource generates ULIDs: 26-character, lexically sortable IDs made of a
+// 48-bit millisecond timestamp and 80 random bits. IDs generated within the
+// same millisecond increment the previous random bits, so they stay unique
+// and ordered under concurrency. It is safe for concurrent use.
+type ULIDSource struct {
+	now     func() time.Time
+	entropy io.Reader
+
+	mu   sync.Mutex
+	ms   uint64
+	rand [10]byte
+}
+
+// NewULIDSource returns a ULIDSource reading the time from now and random
+// bits from entropy. Nil now means time.Now, and nil entropy means
+// crypto/rand. Fixed sources make the generated IDs deterministic, for
+// tests.
+func NewULIDSource(now func() time.Time, entropy io.Reader) *ULIDSource {
+	if now == nil {
+		now = time.Now
+	}
+	if entropy == nil {
+		entropy = rand.Reader
+	}
+	return &ULIDSource{now: now, entropy: entropy}
+}
+
+// New returns a fresh ULID. If entropy fails, the previous random bits are
+// incremented instead, which keeps the IDs unique but makes them guessable.
+func (s *ULIDSource) New() string {
+	ms := uint64(s.now().UnixMilli())
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if ms <= s.ms {
+		// Same millisecond, or the clock went back: stay monotonic.
+		ms = s.ms
+		if !s.increment() {
+			ms++
+			s.read()
+		}
+	} else {
+		s.read()
+	}
+	s.ms = ms
+
+	var id [16]byte
+	binary.BigEndian.PutUint16(id[0:2], uint16(ms>>32))
+	binary.BigEndian.PutUint32(id[2:6], uint32(ms))
+	copy(id[6:], s.rand[:])
+	return encodeULID(id)
+}
+
+// read replaces the random bits with fresh entropy, or increments them if
+// there is none.
+func (s *ULIDSource) read() {
+	if _, err := io.ReadFull(s.entropy, s.rand[:]); err != nil {
+		s.increment()
+	}
+}
+
+// increment adds one to the random bits, reporting false if they wrapped.
+func (s *ULIDSource) increment() bool {
+	for i := len(s.rand) - 1; i >= 0; i-- {
+		s.rand[i]++
+		if s.rand[i] != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// encodeULID writes the 128 bits of a ULID as 26 base32 characters, the
+// first of which holds only the top 3 bits.
+func encodeULID(id [16]byte) string {
+	hi := binary.BigEndian.Uint64(id[0:8])
+	lo := binary.BigEndian.Uint64(id[8:16])
+	var b [26]byte
+	for i := len(b) - 1; i >= 0; i-- {
+		b[i] = crockford[lo&31]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(b[:])
+}
+
+// defaultULIDs backs NewULID.
+var defaultULIDs = NewULIDSource(nil, nil)
+
+// NewULID returns a fresh ULID from the current time and crypto/rand.
+func NewULID() string {
+	return defaultULIDs.New()
+}
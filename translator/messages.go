@@ -0,0 +1,61 @@
+package translator
+
+import (
+	"strconv"
+
+	"github.com/innomon/adk2goose/gooseclient"
+)
+
+// GooseMessageIDMetadataKey is the event customMetadata key carrying the ID
+// of the Goose message the event was translated from.
+const GooseMessageIDMetadataKey = "goose:messageId"
+
+// MessageEvents ties the events of one turn to the Goose messages they come
+// from. It derives event IDs from Goose message IDs, which are stable when a
+// stream is retried or history is fetched again, unlike generated IDs, and
+// drops tool calls and results Goose delivers more than once. Use one per
+// turn; it is not safe for concurrent use. The zero value is ready to use.
+type MessageEvents struct {
+	chunks map[string]int      // events stamped per message ID
+	tools  map[string]struct{} // complete tool requests and responses seen, by type and ID
+}
+
+// Dedupe removes the tool requests and responses in msg that were already
+// delivered in the turn. It reports whether msg has any content left.
+func (m *MessageEvents) Dedupe(msg *gooseclient.GooseMessage) bool {
+	kept := msg.Content[:0]
+	for _, mc := range msg.Content {
+		if (mc.Type == "toolRequest" || mc.Type == "toolResponse") && mc.ID != "" && !mc.PartialToolRequest() {
+			key := mc.Type + "/" + mc.ID
+			if _, ok := m.tools[key]; ok {
+				continue
+			}
+			if m.tools == nil {
+				m.tools = make(map[string]struct{})
+			}
+			m.tools[key] = struct{}{}
+		}
+		kept = append(kept, mc)
+	}
+	msg.Content = kept
+	return len(kept) > 0
+}
+
+// Stamp sets the ID of evt, translated from msg, from msg's ID: the first
+// event of a message takes the message ID, and later ones, such as further
+// streamed chunks, the message ID with "_1", "_2", and so on appended. It
+// leaves evt alone if msg has no ID.
+func (m *MessageEvents) Stamp(evt *ADKEvent, msg *gooseclient.GooseMessage) {
+	if msg == nil || msg.ID == "" {
+		return
+	}
+	if m.chunks == nil {
+		m.chunks = make(map[string]int)
+	}
+	n := m.chunks[msg.ID]
+	m.chunks[msg.ID] = n + 1
+	evt.ID = msg.ID
+	if n > 0 {
+		evt.ID += "_" + strconv.Itoa(n)
+	}
+}
@@ -0,0 +1,28 @@
+package translator
+
+import (
+	"log"
+	"sync"
+
+	"github.com/innomon/adk2goose/internal/metrics"
+)
+
+// droppedItems counts Goose events and content parts the translator has no
+// mapping for. A rising count usually means the Goose protocol has drifted.
+var droppedItems = metrics.NewCounterVec(
+	"translator_dropped_total",
+	"Goose SSE events and message content parts dropped because their type is not recognized.",
+	"kind", "type")
+
+// reportedDrops remembers which unknown types have been logged, so each is
+// logged once per process while still being counted every time.
+var reportedDrops sync.Map
+
+// dropped records an untranslatable item of the given kind ("event" or
+// "content") and Goose type.
+func dropped(kind, typ string) {
+	droppedItems.Inc(kind, typ)
+	if _, seen := reportedDrops.LoadOrStore(kind+"\x00"+typ, struct{}{}); !seen {
+		log.Printf("translator: dropping Goose %s of unknown type %q", kind, typ)
+	}
+}
@@ -0,0 +1,85 @@
+package translator
+
+import (
+	"sync"
+
+	"github.com/innomon/adk2goose/gooseclient"
+	"google.golang.org/genai"
+)
+
+// GooseContentHandler converts a Goose content item of a registered type
+// into ADK parts. Returning no parts drops the item. The raw JSON of types
+// gooseclient does not model is in mc.Raw.
+type GooseContentHandler func(mc *gooseclient.MessageContent) []*genai.Part
+
+// ADKPartHandler converts an ADK part into Goose content. It reports false
+// to leave the part to the next handler or the built-in mapping. Content
+// types gooseclient does not model can be built by setting Raw.
+type ADKPartHandler func(part *genai.Part) ([]gooseclient.MessageContent, bool)
+
+// registry holds the custom content handlers shared by every Translator.
+var registry struct {
+	mu    sync.RWMutex
+	goose map[string]GooseContentHandler
+	adk   []namedADKPartHandler
+}
+
+type namedADKPartHandler struct {
+	name string
+	fn   ADKPartHandler
+}
+
+// RegisterGooseContentHandler maps Goose content of contentType, such as a
+// type introduced by an extension, to ADK parts with fn. It overrides the
+// built-in mapping of that type and replaces an earlier handler for it; a
+// nil fn removes the handler.
+func RegisterGooseContentHandler(contentType string, fn GooseContentHandler) {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	if fn == nil {
+		delete(registry.goose, contentType)
+		return
+	}
+	if registry.goose == nil {
+		registry.goose = make(map[string]GooseContentHandler)
+	}
+	registry.goose[contentType] = fn
+}
+
+// RegisterADKPartHandler adds fn, under name, to the handlers tried on each
+// ADK part before the built-in mapping, in registration order. Registering
+// an existing name replaces that handler in place; a nil fn removes it.
+func RegisterADKPartHandler(name string, fn ADKPartHandler) {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	for i, h := range registry.adk {
+		if h.name != name {
+			continue
+		}
+		if fn == nil {
+			registry.adk = append(registry.adk[:i:i], registry.adk[i+1:]...)
+		} else {
+			registry.adk[i].fn = fn
+		}
+		return
+	}
+	if fn != nil {
+		registry.adk = append(registry.adk, namedADKPartHandler{name, fn})
+	}
+}
+
+// gooseContentHandler returns the handler registered for contentType.
+func gooseContentHandler(contentType string) (GooseContentHandler, bool) {
+	registry.mu.RLock()
+	defer registry.mu.RUnlock()
+	fn, ok := registry.goose[contentType]
+	return fn, ok
+}
+
+// adkPartHandlers returns the registered ADK part handlers in order. The
+// returned slice must not be modified.
+func adkPartHandlers() []namedADKPartHandler {
+	registry.mu.RLock()
+	defer registry.mu.RUnlock()
+	return registry.adk
+}
@@ -0,0 +1,118 @@
+package translator
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/innomon/adk2goose/gooseclient"
+)
+
+// ToolCallStream rebuilds the arguments of tool calls Goose streams in
+// pieces, so each partial function call event carries the arguments formed
+// so far rather than only the latest fragment. Use one per turn; it is not
+// safe for concurrent use. The zero value is ready to use.
+type ToolCallStream struct {
+	args map[string]*strings.Builder
+}
+
+// Accumulate records the argument fragments of msg's partial tool requests
+// and sets each one's Arguments to the arguments so far, parsed leniently:
+// unterminated strings, objects, and arrays are closed, and a trailing
+// incomplete key or value is left out. A complete tool request ends the
+// stream of its call.
+func (s *ToolCallStream) Accumulate(msg *gooseclient.GooseMessage) {
+	if msg == nil {
+		return
+	}
+	for i := range msg.Content {
+		mc := &msg.Content[i]
+		if mc.Type != "toolRequest" || mc.ToolCall == nil {
+			continue
+		}
+		if !mc.PartialToolRequest() {
+			delete(s.args, mc.ID)
+			continue
+		}
+		if s.args == nil {
+			s.args = make(map[string]*strings.Builder)
+		}
+		b, ok := s.args[mc.ID]
+		if !ok {
+			b = new(strings.Builder)
+			s.args[mc.ID] = b
+		}
+		b.WriteString(mc.ToolCall.ArgumentsDelta)
+		mc.ToolCall.Arguments = parsePartialArgs(b.String())
+	}
+}
+
+// hasPartialToolRequest reports whether msg carries a tool request that is
+// still being streamed.
+func hasPartialToolRequest(msg *gooseclient.GooseMessage) bool {
+	for i := range msg.Content {
+		if msg.Content[i].PartialToolRequest() {
+			return true
+		}
+	}
+	return false
+}
+
+// parsePartialArgs parses the prefix of a JSON object, returning the
+// longest complete-able part of it, or nil if there is none yet.
+func parsePartialArgs(text string) map[string]any {
+	for end := len(text); end > 0; end-- {
+		closed, ok := closeJSON(text[:end])
+		if !ok {
+			continue
+		}
+		var args map[string]any
+		if json.Unmarshal([]byte(closed), &args) == nil {
+			return args
+		}
+	}
+	return nil
+}
+
+// closeJSON terminates the open string, arrays, and objects of a JSON
+// prefix. It reports false if the prefix ends inside an escape sequence,
+// which cannot be closed.
+func closeJSON(prefix string) (string, bool) {
+	var open []byte
+	inString, escaped := false, false
+	for i := 0; i < len(prefix); i++ {
+		c := prefix[i]
+		switch {
+		case escaped:
+			escaped = false
+		case inString:
+			switch c {
+			case '\\':
+				escaped = true
+			case '"':
+				inString = false
+			}
+		case c == '"':
+			inString = true
+		case c == '{':
+			open = append(open, '}')
+		case c == '[':
+			open = append(open, ']')
+		case (c == '}' || c == ']') && len(open) > 0:
+			open = open[:len(open)-1]
+		}
+	}
+	if escaped {
+		return "", false
+	}
+
+	var b strings.Builder
+	b.Grow(len(prefix) + len(open) + 1)
+	b.WriteString(prefix)
+	if inString {
+		b.WriteByte('"')
+	}
+	for i := len(open) - 1; i >= 0; i-- {
+		b.WriteByte(open[i])
+	}
+	return b.String(), true
+}
@@ -3,10 +3,14 @@ package translator
 import (
 	"encoding/json"
 
-	"github.com/innomon/adk2goose/internal/gooseclient"
+	"github.com/innomon/adk2goose/gooseclient"
 	"google.golang.org/genai"
 )
 
+// ConfirmationFunctionName is the function call name ADK clients use to ask a
+// user to confirm a pending tool call.
+const ConfirmationFunctionName = "adk_request_confirmation"
+
 // ADKToolToGooseToolInfo converts an ADK tool declaration to a description string
 // suitable for logging/display. Goose manages its own tools via extensions,
 // so this is primarily informational.
@@ -46,3 +50,24 @@ func ADKFunctionResponseToGooseToolResult(fr *genai.FunctionResponse) *gooseclie
 		IsError: false,
 	}
 }
+
+// GooseConfirmationToADKFunctionCall converts a Goose toolConfirmationRequest
+// into an ADK request-confirmation function call. The call ID matches the
+// Goose request ID so the client's answer can be routed back to Goose.
+func GooseConfirmationToADKFunctionCall(mc *gooseclient.MessageContent) *genai.FunctionCall {
+	return &genai.FunctionCall{
+		ID:   mc.ID,
+		Name: ConfirmationFunctionName,
+		Args: map[string]any{
+			"originalFunctionCall": map[string]any{
+				"id":   mc.ID,
+				"name": mc.ToolName,
+				"args": mc.Arguments,
+			},
+			"toolConfirmation": map[string]any{
+				"hint":      mc.Prompt,
+				"confirmed": false,
+			},
+		},
+	}
+}
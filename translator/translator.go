@@ -0,0 +1,71 @@
+// Package translator maps between the ADK REST API's events and contents
+// and the Goose server's messages and SSE events. It is independent of the
+// proxy, so other ADK↔Goose bridges can reuse the mapping.
+//
+// The package-level functions use DefaultOptions; create a Translator with
+// New to change the author name, thought filtering, part ordering, or the
+// clock and ID source stamped on events.
+package translator
+
+import "time"
+
+// Options configures a Translator. The zero value is usable: it stamps
+// events with author "goose", the current time, and ULID-based IDs, keeps
+// thoughts, and moves tool responses ahead of other content in messages
+// sent to Goose.
+type Options struct {
+	// Author is set on every event the translator creates. Empty means
+	// "goose".
+	Author string
+
+	// StripThoughts drops thinking and redacted-thinking content when
+	// translating Goose messages to ADK.
+	StripThoughts bool
+
+	// PreservePartOrder keeps the ADK part order exactly when building Goose
+	// messages. Otherwise tool responses are moved ahead of other content,
+	// as many providers require.
+	PreservePartOrder bool
+
+	// Now returns the time stamped on events and messages. Nil means
+	// time.Now.
+	Now func() time.Time
+
+	// NewID returns a fresh event ID. Nil means "evt_" followed by a ULID
+	// stamped with Now.
+	NewID func() string
+}
+
+// DefaultOptions returns the options the package-level functions use.
+func DefaultOptions() Options {
+	return Options{PreservePartOrder: true}
+}
+
+// Translator converts between ADK and Goose representations according to
+// its Options. It is safe for concurrent use.
+type Translator struct {
+	opts Options
+	ids  *ULIDSource
+}
+
+// New returns a Translator configured by opts.
+func New(opts Options) *Translator {
+	return &Translator{opts: opts, ids: NewULIDSource(opts.Now, nil)}
+}
+
+// defaultTranslator backs the package-level functions.
+var defaultTranslator = New(DefaultOptions())
+
+func (t *Translator) now() time.Time {
+	if t.opts.Now != nil {
+		return t.opts.Now()
+	}
+	return time.Now()
+}
+
+func (t *Translator) newID() string {
+	if t.opts.NewID != nil {
+		return t.opts.NewID()
+	}
+	return "evt_" + t.ids.New()
+}
@@ -0,0 +1,778 @@
+package translator
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/innomon/adk2goose/gooseclient"
+	"google.golang.org/genai"
+)
+
+func TestADKContentToGooseMessage_Text(t *testing.T) {
+	content := &genai.Content{
+		Role:  "user",
+		Parts: []*genai.Part{genai.NewPartFromText("hello")},
+	}
+
+	msg := ADKContentToGooseMessage(content)
+
+	if msg.Role != "user" {
+		t.Errorf("expected role %q, got %q", "user", msg.Role)
+	}
+	if len(msg.Content) != 1 {
+		t.Fatalf("expected 1 content part, got %d", len(msg.Content))
+	}
+	if msg.Content[0].Type != "text" {
+		t.Errorf("expected type %q, got %q", "text", msg.Content[0].Type)
+	}
+	if msg.Content[0].Text != "hello" {
+		t.Errorf("expected text %q, got %q", "hello", msg.Content[0].Text)
+	}
+}
+
+func TestADKContentToGooseMessage_FunctionCall(t *testing.T) {
+	content := &genai.Content{
+		Role: "model",
+		Parts: []*genai.Part{
+			{FunctionCall: &genai.FunctionCall{
+				ID:   "call1",
+				Name: "search",
+				Args: map[string]any{"query": "test"},
+			}},
+		},
+	}
+
+	msg := ADKContentToGooseMessage(content)
+
+	if msg.Role != "assistant" {
+		t.Errorf("expected role %q, got %q", "assistant", msg.Role)
+	}
+	if msg.Content[0].Type != "toolRequest" {
+		t.Errorf("expected type %q, got %q", "toolRequest", msg.Content[0].Type)
+	}
+	if msg.Content[0].ToolCall.Name != "search" {
+		t.Errorf("expected tool name %q, got %q", "search", msg.Content[0].ToolCall.Name)
+	}
+	if msg.Content[0].ToolCall.Arguments["query"] != "test" {
+		t.Errorf("expected argument query=%q, got %v", "test", msg.Content[0].ToolCall.Arguments["query"])
+	}
+}
+
+func TestGooseMessageToADKContent_Text(t *testing.T) {
+	msg := &gooseclient.GooseMessage{
+		Role: "assistant",
+		Content: []gooseclient.MessageContent{
+			{Type: "text", Text: "hello world"},
+		},
+	}
+
+	content := GooseMessageToADKContent(msg)
+
+	if content.Role != "model" {
+		t.Errorf("expected role %q, got %q", "model", content.Role)
+	}
+	if len(content.Parts) != 1 {
+		t.Fatalf("expected 1 part, got %d", len(content.Parts))
+	}
+	if content.Parts[0].Text != "hello world" {
+		t.Errorf("expected text %q, got %q", "hello world", content.Parts[0].Text)
+	}
+}
+
+func TestGooseMessageToADKContent_Image(t *testing.T) {
+	msg := &gooseclient.GooseMessage{
+		Role: "assistant",
+		Content: []gooseclient.MessageContent{
+			{Type: "image", Data: "iVBORw0K", MimeType: "image/png"},
+			{Type: "toolResponse", ID: "call-1", ToolResult: &gooseclient.ToolResult{
+				Content: []gooseclient.MessageContent{
+					{Type: "text", Text: "screenshot taken"},
+					{Type: "image", Data: "/9j/4A==", MimeType: "image/jpeg"},
+				},
+			}},
+		},
+	}
+
+	content := GooseMessageToADKContent(msg)
+
+	if len(content.Parts) != 3 {
+		t.Fatalf("expected 3 parts, got %d", len(content.Parts))
+	}
+	img := content.Parts[0].InlineData
+	if img == nil || img.MIMEType != "image/png" || string(img.Data) != "\x89PNG\r\n" {
+		t.Errorf("expected decoded PNG inline data, got %+v", img)
+	}
+	if content.Parts[1].FunctionResponse == nil {
+		t.Fatalf("expected function response second, got %+v", content.Parts[1])
+	}
+	if shot := content.Parts[2].InlineData; shot == nil || shot.MIMEType != "image/jpeg" {
+		t.Errorf("expected tool result image as inline data, got %+v", shot)
+	}
+}
+
+func TestGooseMessageToADKContent_StructuredToolResult(t *testing.T) {
+	structured := map[string]any{"temperature": 21.5, "unit": "C", "tags": []any{"indoor"}}
+	msg := &gooseclient.GooseMessage{
+		Role: "user",
+		Content: []gooseclient.MessageContent{
+			{Type: "toolResponse", ID: "call-1", ToolResult: &gooseclient.ToolResult{
+				Content:           []gooseclient.MessageContent{{Type: "text", Text: "21.5 C"}},
+				StructuredContent: structured,
+			}},
+			{Type: "toolResponse", ID: "call-2", ToolResult: &gooseclient.ToolResult{
+				Content: []gooseclient.MessageContent{{Type: "text", Text: "done"}},
+			}},
+		},
+	}
+
+	content := GooseMessageToADKContent(msg)
+	if got := content.Parts[0].FunctionResponse.Response; !reflect.DeepEqual(got, structured) {
+		t.Errorf("expected the structured content as the response, got %+v", got)
+	}
+	content.Parts[0].FunctionResponse.Response["unit"] = "F"
+	if structured["unit"] != "C" {
+		t.Error("expected the response to be a copy of the structured content")
+	}
+	if got := content.Parts[1].FunctionResponse.Response; got["result"] != "done" {
+		t.Errorf("expected the text result, got %+v", got)
+	}
+}
+
+func TestGooseSSEEventToADKEvent_Message(t *testing.T) {
+	sse := &gooseclient.SSEEvent{
+		Type: "Message",
+		Message: &gooseclient.GooseMessage{
+			Role: "assistant",
+			Content: []gooseclient.MessageContent{
+				{Type: "text", Text: "response text"},
+			},
+		},
+	}
+
+	evt, err := GooseSSEEventToADKEvent(sse, "inv-1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if evt == nil {
+		t.Fatal("expected non-nil event")
+	}
+	if evt.Content == nil {
+		t.Fatal("expected non-nil content")
+	}
+	if evt.Content.Parts[0].Text != "response text" {
+		t.Errorf("expected text %q, got %q", "response text", evt.Content.Parts[0].Text)
+	}
+}
+
+func TestGooseSSEEventToADKEvent_Finish(t *testing.T) {
+	sse := &gooseclient.SSEEvent{
+		Type: "Finish",
+		TokenState: &gooseclient.TokenState{
+			InputTokens:  100,
+			OutputTokens: 50,
+			TotalTokens:  150,
+		},
+	}
+
+	evt, err := GooseSSEEventToADKEvent(sse, "inv-2")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !evt.TurnComplete {
+		t.Error("expected TurnComplete to be true")
+	}
+	if evt.UsageMetadata == nil {
+		t.Fatal("expected non-nil UsageMetadata")
+	}
+}
+
+func TestGooseSSEEventToADKEvent_FinishReason(t *testing.T) {
+	tests := []struct {
+		reason      string
+		want        genai.FinishReason
+		errorCode   string
+		interrupted bool
+	}{
+		{reason: "stop", want: genai.FinishReasonStop},
+		{reason: "tool", want: genai.FinishReasonStop},
+		{reason: "length", want: genai.FinishReasonMaxTokens, errorCode: "MAX_TOKENS"},
+		{reason: "cancelled", interrupted: true},
+		{reason: "something_new", want: genai.FinishReasonOther},
+	}
+	for _, tt := range tests {
+		evt, _ := GooseSSEEventToADKEvent(&gooseclient.SSEEvent{Type: "Finish", Reason: tt.reason}, "inv-1")
+		if evt.FinishReason != tt.want || evt.ErrorCode != tt.errorCode || evt.Interrupted != tt.interrupted {
+			t.Errorf("reason %q: got finishReason=%q errorCode=%q interrupted=%v", tt.reason, evt.FinishReason, evt.ErrorCode, evt.Interrupted)
+		}
+	}
+}
+
+func TestGooseSSEEventToADKEvent_Error(t *testing.T) {
+	sse := &gooseclient.SSEEvent{
+		Type:  "Error",
+		Error: "something failed",
+	}
+
+	evt, err := GooseSSEEventToADKEvent(sse, "inv-3")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if evt.ErrorCode != "GOOSE_ERROR" {
+		t.Errorf("expected error code %q, got %q", "GOOSE_ERROR", evt.ErrorCode)
+	}
+	if evt.ErrorMessage != "something failed" {
+		t.Errorf("expected error message %q, got %q", "something failed", evt.ErrorMessage)
+	}
+}
+
+func TestGooseSSEEventToADKEvent_Ping(t *testing.T) {
+	sse := &gooseclient.SSEEvent{
+		Type: "Ping",
+	}
+
+	evt, err := GooseSSEEventToADKEvent(sse, "inv-4")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if evt != nil {
+		t.Errorf("expected nil event for Ping, got %+v", evt)
+	}
+}
+
+func TestGooseToolCallToADKFunctionCall(t *testing.T) {
+	tc := &gooseclient.ToolCall{
+		Name:      "read_file",
+		Arguments: map[string]any{"path": "/tmp/test"},
+	}
+
+	result := GooseToolCallToADKFunctionCall("tc1", tc)
+
+	if result.ID != "tc1" {
+		t.Errorf("expected ID %q, got %q", "tc1", result.ID)
+	}
+	if result.Name != "read_file" {
+		t.Errorf("expected name %q, got %q", "read_file", result.Name)
+	}
+	if result.Args["path"] != "/tmp/test" {
+		t.Errorf("expected path %q, got %v", "/tmp/test", result.Args["path"])
+	}
+}
+
+func TestGooseMessageToADKContent_ToolConfirmationRequest(t *testing.T) {
+	msg := &gooseclient.GooseMessage{
+		Role: "assistant",
+		Content: []gooseclient.MessageContent{
+			{
+				Type:      "toolConfirmationRequest",
+				ID:        "req-1",
+				ToolName:  "developer__shell",
+				Arguments: map[string]any{"command": "make"},
+				Prompt:    "Allow running make?",
+			},
+		},
+	}
+
+	content := GooseMessageToADKContent(msg)
+
+	if len(content.Parts) != 1 || content.Parts[0].FunctionCall == nil {
+		t.Fatalf("expected 1 function call part, got %+v", content.Parts)
+	}
+	fc := content.Parts[0].FunctionCall
+	if fc.Name != ConfirmationFunctionName {
+		t.Errorf("expected name %q, got %q", ConfirmationFunctionName, fc.Name)
+	}
+	if fc.ID != "req-1" {
+		t.Errorf("expected ID %q, got %q", "req-1", fc.ID)
+	}
+	original, _ := fc.Args["originalFunctionCall"].(map[string]any)
+	if original["name"] != "developer__shell" {
+		t.Errorf("expected original call name developer__shell, got %v", original["name"])
+	}
+}
+
+func TestADKGenerationConfigToGooseParams(t *testing.T) {
+	cfg := &genai.GenerationConfig{
+		Temperature:      genai.Ptr[float32](0.2),
+		MaxOutputTokens:  1024,
+		StopSequences:    []string{"END"},
+		ResponseMIMEType: "application/json",
+		CandidateCount:   2,
+	}
+
+	params, ignored := ADKGenerationConfigToGooseParams(cfg)
+
+	if len(params) != 3 {
+		t.Fatalf("expected 3 params, got %v", params)
+	}
+	if params["max_tokens"] != float64(1024) {
+		t.Errorf("expected max_tokens=1024, got %v", params["max_tokens"])
+	}
+	if _, ok := params["temperature"]; !ok {
+		t.Error("expected temperature to be mapped")
+	}
+	if len(ignored) != 2 || ignored[0] != "candidateCount" || ignored[1] != "responseMimeType" {
+		t.Errorf("expected candidateCount and responseMimeType to be ignored, got %v", ignored)
+	}
+}
+
+func TestRedactedThinking_RoundTrip(t *testing.T) {
+	sse := &gooseclient.SSEEvent{
+		Type: "Message",
+		Message: &gooseclient.GooseMessage{
+			Role: "assistant",
+			Content: []gooseclient.MessageContent{
+				{Type: "thinking", Thinking: "let me check", Signature: "sig-1"},
+				{Type: "redactedThinking", Data: "opaque-blob"},
+				{Type: "text", Text: "done"},
+			},
+		},
+	}
+
+	evt, err := GooseSSEEventToADKEvent(sse, "inv-1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	redacted := evt.Content.Parts[1]
+	if !redacted.Thought || redacted.Text != "" || string(redacted.ThoughtSignature) != "opaque-blob" {
+		t.Fatalf("expected redacted thought part carrying the payload, got %+v", redacted)
+	}
+	if got, _ := evt.CustomMetadata[RedactedThinkingMetadataKey].([]string); len(got) != 1 || got[0] != "opaque-blob" {
+		t.Errorf("expected redacted payload in custom metadata, got %v", evt.CustomMetadata)
+	}
+
+	msg := ADKContentToGooseMessage(evt.Content)
+	if len(msg.Content) != 3 {
+		t.Fatalf("expected 3 content items, got %d", len(msg.Content))
+	}
+	if c := msg.Content[0]; c.Type != "thinking" || c.Thinking != "let me check" || c.Signature != "sig-1" {
+		t.Errorf("expected thinking round-trip, got %+v", c)
+	}
+	if c := msg.Content[1]; c.Type != "redactedThinking" || c.Data != "opaque-blob" {
+		t.Errorf("expected redactedThinking round-trip, got %+v", c)
+	}
+}
+
+func TestGooseSSEEventToADKEvent_Notification(t *testing.T) {
+	var sse gooseclient.SSEEvent
+	payload := `{"type":"Notification","request_id":"call-1","message":{"method":"notifications/progress","params":{"progress":3,"total":10}}}`
+	if err := json.Unmarshal([]byte(payload), &sse); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if sse.Message != nil || sse.Notification == nil {
+		t.Fatalf("expected notification to be decoded separately from messages, got %+v", sse)
+	}
+
+	evt, err := GooseSSEEventToADKEvent(&sse, "inv-1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if evt == nil || !evt.Partial || evt.Content != nil {
+		t.Fatalf("expected partial metadata-only event, got %+v", evt)
+	}
+	note, _ := evt.CustomMetadata[NotificationMetadataKey].(map[string]any)
+	if note["requestId"] != "call-1" || note["method"] != "notifications/progress" {
+		t.Errorf("unexpected notification metadata: %+v", note)
+	}
+	if params, _ := note["params"].(map[string]any); params["progress"] != float64(3) {
+		t.Errorf("expected progress params, got %+v", note["params"])
+	}
+}
+
+func TestDroppedItemsAreCounted(t *testing.T) {
+	before := droppedItems.Value("event", "FutureEvent")
+	evt, err := GooseSSEEventToADKEvent(&gooseclient.SSEEvent{Type: "FutureEvent"}, "inv-1")
+	if evt != nil || err != nil {
+		t.Fatalf("expected unknown event to be dropped, got %+v, %v", evt, err)
+	}
+	if got := droppedItems.Value("event", "FutureEvent"); got != before+1 {
+		t.Errorf("expected dropped event counter to increase, got %v", got)
+	}
+
+	before = droppedItems.Value("content", "hologram")
+	content := GooseMessageToADKContent(&gooseclient.GooseMessage{
+		Role:    "assistant",
+		Content: []gooseclient.MessageContent{{Type: "hologram"}, {Type: "text", Text: "hi"}},
+	})
+	if len(content.Parts) != 1 {
+		t.Fatalf("expected only the text part, got %d parts", len(content.Parts))
+	}
+	if got := droppedItems.Value("content", "hologram"); got != before+1 {
+		t.Errorf("expected dropped content counter to increase, got %v", got)
+	}
+}
+
+func TestTranslatorOptions_AuthorClockAndIDs(t *testing.T) {
+	fixed := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	n := 0
+	tr := New(Options{
+		Author: "bridge",
+		Now:    func() time.Time { return fixed },
+		NewID:  func() string { n++; return fmt.Sprintf("id-%d", n) },
+	})
+
+	evt, err := tr.GooseSSEEventToADKEvent(&gooseclient.SSEEvent{Type: "Finish", Reason: "stop"}, "inv-1")
+	if err != nil {
+		t.Fatalf("translate: %v", err)
+	}
+	if evt.Author != "bridge" || evt.ID != "id-1" || evt.Time != fixed.Unix() || evt.InvocationID != "inv-1" {
+		t.Errorf("unexpected event stamp %+v", evt)
+	}
+	if errEvt := tr.NewErrorEvent("inv-1", "CODE", "msg"); errEvt.ID != "id-2" || errEvt.Author != "bridge" {
+		t.Errorf("unexpected error event stamp %+v", errEvt)
+	}
+	if msg := tr.ADKContentToGooseMessage(genai.NewContentFromText("hi", genai.RoleUser)); msg.Created != fixed.Unix() {
+		t.Errorf("expected message created at %d, got %d", fixed.Unix(), msg.Created)
+	}
+
+	if evt := NewErrorEvent("inv-1", "CODE", "msg"); evt.Author != "goose" {
+		t.Errorf("expected the default author goose, got %q", evt.Author)
+	}
+}
+
+func TestTranslatorOptions_StripThoughts(t *testing.T) {
+	msg := &gooseclient.GooseMessage{
+		Role: "assistant",
+		Content: []gooseclient.MessageContent{
+			{Type: "thinking", Thinking: "hmm"},
+			{Type: "redactedThinking", Data: "opaque"},
+			{Type: "text", Text: "answer"},
+		},
+	}
+
+	evt, _ := New(Options{StripThoughts: true}).GooseSSEEventToADKEvent(&gooseclient.SSEEvent{Type: "Message", Message: msg}, "inv-1")
+	if len(evt.Content.Parts) != 1 || evt.Content.Parts[0].Text != "answer" {
+		t.Fatalf("expected only the answer, got %+v", evt.Content.Parts)
+	}
+	if evt.CustomMetadata[RedactedThinkingMetadataKey] != nil {
+		t.Errorf("expected no redacted thinking metadata, got %+v", evt.CustomMetadata)
+	}
+
+	if content := GooseMessageToADKContent(msg); len(content.Parts) != 3 {
+		t.Errorf("expected the default to keep thoughts, got %d parts", len(content.Parts))
+	}
+}
+
+func TestTranslatorOptions_PartOrder(t *testing.T) {
+	content := &genai.Content{
+		Role: "user",
+		Parts: []*genai.Part{
+			genai.NewPartFromText("here is the result"),
+			{FunctionResponse: &genai.FunctionResponse{ID: "call-1", Name: "search", Response: map[string]any{"ok": true}}},
+		},
+	}
+
+	types := func(msg *gooseclient.GooseMessage) []string {
+		var out []string
+		for _, mc := range msg.Content {
+			out = append(out, mc.Type)
+		}
+		return out
+	}
+	if got := types(New(Options{PreservePartOrder: true}).ADKContentToGooseMessage(content)); !slices.Equal(got, []string{"text", "toolResponse"}) {
+		t.Errorf("expected ADK order preserved, got %v", got)
+	}
+	if got := types(New(Options{}).ADKContentToGooseMessage(content)); !slices.Equal(got, []string{"toolResponse", "text"}) {
+		t.Errorf("expected the tool response first, got %v", got)
+	}
+}
+
+func TestADKContentToGooseMessage_MixedOrder(t *testing.T) {
+	content := &genai.Content{
+		Role: "user",
+		Parts: []*genai.Part{
+			genai.NewPartFromBytes([]byte("png-1"), "image/png"),
+			genai.NewPartFromText("compare this image"),
+			{FunctionResponse: &genai.FunctionResponse{ID: "call-1", Name: "fetch", Response: map[string]any{"ok": true}}},
+			genai.NewPartFromText("with this one"),
+			genai.NewPartFromBytes([]byte("png-2"), "image/png"),
+			{Thought: true, Text: "thinking"},
+			{FunctionCall: &genai.FunctionCall{ID: "call-2", Name: "search"}},
+		},
+	}
+
+	want := []string{"image:png-1", "text:compare this image", "toolResponse:call-1", "text:with this one", "image:png-2", "thinking:thinking", "toolRequest:call-2"}
+	describe := func(msg *gooseclient.GooseMessage) []string {
+		var out []string
+		for _, mc := range msg.Content {
+			switch mc.Type {
+			case "image":
+				data, _ := base64.StdEncoding.DecodeString(mc.Data)
+				out = append(out, "image:"+string(data))
+			case "text":
+				out = append(out, "text:"+mc.Text)
+			case "thinking":
+				out = append(out, "thinking:"+mc.Thinking)
+			default:
+				out = append(out, mc.Type+":"+mc.ID)
+			}
+		}
+		return out
+	}
+	if got := describe(ADKContentToGooseMessage(content)); !slices.Equal(got, want) {
+		t.Errorf("expected ADK order\n%v, got\n%v", want, got)
+	}
+
+	conversation := ADKEventsToGooseConversation([]*ADKEvent{{Content: content}})
+	if len(conversation) != 1 || !slices.Equal(describe(&conversation[0]), want) {
+		t.Errorf("expected history to keep ADK order, got %+v", conversation)
+	}
+}
+
+func TestADKContentToGooseMessage_Roles(t *testing.T) {
+	for role, want := range map[string]string{
+		genai.RoleUser:  "user",
+		genai.RoleModel: "assistant",
+		RoleSystem:      "user",
+		RoleTool:        "user",
+		RoleFunction:    "user",
+		"":              "user",
+	} {
+		msg := ADKContentToGooseMessage(&genai.Content{Role: role, Parts: []*genai.Part{genai.NewPartFromText("x")}})
+		if msg.Role != want {
+			t.Errorf("role %q: expected Goose role %q, got %q", role, want, msg.Role)
+		}
+		if msg.Metadata.UserVisible != (role != RoleSystem) || !msg.Metadata.AgentVisible {
+			t.Errorf("role %q: unexpected visibility %+v", role, msg.Metadata)
+		}
+	}
+
+	tool := ADKContentToGooseMessage(&genai.Content{Role: RoleTool, Parts: []*genai.Part{
+		{FunctionResponse: &genai.FunctionResponse{ID: "call-1", Name: "search", Response: map[string]any{"hits": 3}}},
+	}})
+	if len(tool.Content) != 1 || tool.Content[0].Type != "toolResponse" || tool.Content[0].ID != "call-1" {
+		t.Errorf("expected a toolResponse message, got %+v", tool.Content)
+	}
+}
+
+func TestADKSystemInstructions(t *testing.T) {
+	events := []*ADKEvent{
+		{Content: &genai.Content{Role: RoleSystem, Parts: []*genai.Part{genai.NewPartFromText("Be brief.")}}},
+		{Content: genai.NewContentFromText("hi", genai.RoleUser)},
+		{Content: &genai.Content{Role: RoleTool, Parts: []*genai.Part{{FunctionResponse: &genai.FunctionResponse{ID: "call-1", Name: "search"}}}}},
+		{Content: &genai.Content{Role: RoleSystem, Parts: []*genai.Part{genai.NewPartFromText("Use metric units.")}}},
+		{Partial: true, Content: &genai.Content{Role: RoleSystem, Parts: []*genai.Part{genai.NewPartFromText("partial")}}},
+	}
+
+	if got := ADKSystemInstructions(events); got != "Be brief.\n\nUse metric units." {
+		t.Errorf("unexpected system instructions %q", got)
+	}
+	var roles []string
+	for _, msg := range ADKEventsToGooseConversation(events) {
+		roles = append(roles, msg.Role+":"+msg.Content[0].Type)
+	}
+	if !slices.Equal(roles, []string{"user:text", "user:toolResponse"}) {
+		t.Errorf("expected system content left out of the conversation, got %v", roles)
+	}
+}
+
+func TestCustomContentHandlers(t *testing.T) {
+	RegisterGooseContentHandler("frameContent", func(mc *gooseclient.MessageContent) []*genai.Part {
+		var frame struct {
+			URL string `json:"url"`
+		}
+		if err := json.Unmarshal(mc.Raw, &frame); err != nil {
+			return nil
+		}
+		return []*genai.Part{genai.NewPartFromURI(frame.URL, "text/html")}
+	})
+	RegisterADKPartHandler("frame", func(part *genai.Part) ([]gooseclient.MessageContent, bool) {
+		if part.FileData == nil || part.FileData.MIMEType != "text/html" {
+			return nil, false
+		}
+		raw, _ := json.Marshal(map[string]string{"type": "frameContent", "url": part.FileData.FileURI})
+		return []gooseclient.MessageContent{{Type: "frameContent", Raw: raw}}, true
+	})
+	t.Cleanup(func() {
+		RegisterGooseContentHandler("frameContent", nil)
+		RegisterADKPartHandler("frame", nil)
+	})
+
+	var msg gooseclient.GooseMessage
+	data := `{"role":"assistant","content":[{"type":"frameContent","url":"https://example.com/app"},{"type":"text","text":"hi"}]}`
+	if err := json.Unmarshal([]byte(data), &msg); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	content := GooseMessageToADKContent(&msg)
+	if len(content.Parts) != 2 || content.Parts[0].FileData == nil || content.Parts[0].FileData.FileURI != "https://example.com/app" {
+		t.Fatalf("expected the frame as file data, got %+v", content.Parts)
+	}
+
+	back := ADKContentToGooseMessage(content)
+	out, err := json.Marshal(back.Content)
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	want := `[{"type":"frameContent","url":"https://example.com/app"},{"type":"text","text":"hi"}]`
+	if string(out) != want {
+		t.Errorf("expected %s, got %s", want, out)
+	}
+}
+
+func TestADKEventsToGooseConversation(t *testing.T) {
+	events := []*ADKEvent{
+		{Time: 10, Author: "user", Content: genai.NewContentFromText("list the files", genai.RoleUser)},
+		{Time: 11, Author: "goose", Partial: true, Content: genai.NewContentFromText("Let me", genai.RoleModel)},
+		{Time: 12, Author: "goose", Content: &genai.Content{Role: genai.RoleModel, Parts: []*genai.Part{
+			{FunctionCall: &genai.FunctionCall{ID: "call-1", Name: "developer__shell", Args: map[string]any{"command": "ls"}}},
+		}}},
+		{Time: 13, Author: "goose", TurnComplete: true},
+		{Time: 14, Author: "goose", Content: &genai.Content{Role: genai.RoleModel}},
+	}
+
+	messages := ADKEventsToGooseConversation(events)
+	if len(messages) != 2 {
+		t.Fatalf("expected 2 messages, got %+v", messages)
+	}
+	if messages[0].Role != "user" || messages[0].Created != 10 || messages[0].Content[0].Text != "list the files" {
+		t.Errorf("unexpected user message %+v", messages[0])
+	}
+	if messages[1].Role != "assistant" || messages[1].Created != 12 || messages[1].Content[0].Type != "toolRequest" {
+		t.Errorf("unexpected assistant message %+v", messages[1])
+	}
+}
+
+func TestToolCallStream(t *testing.T) {
+	piece := func(delta string) *gooseclient.GooseMessage {
+		return &gooseclient.GooseMessage{ID: "msg-1", Role: "assistant", Content: []gooseclient.MessageContent{{
+			Type: "toolRequest", ID: "call-1", ToolCall: &gooseclient.ToolCall{Name: "developer__shell", ArgumentsDelta: delta},
+		}}}
+	}
+
+	var stream ToolCallStream
+	for _, tc := range []struct {
+		delta string
+		want  string
+	}{
+		{`{"comm`, `{}`},
+		{`and": "ls -`, `{"command":"ls -"}`},
+		{`la", "cwd": ["/tm`, `{"command":"ls -la","cwd":["/tm"]}`},
+		{`p"], "env": {"A": tr`, `{"command":"ls -la","cwd":["/tmp"],"env":{}}`},
+	} {
+		msg := piece(tc.delta)
+		stream.Accumulate(msg)
+		got, _ := json.Marshal(msg.Content[0].ToolCall.Arguments)
+		if string(got) != tc.want {
+			t.Errorf("after %q: expected arguments %s, got %s", tc.delta, tc.want, got)
+		}
+
+		evt, err := GooseSSEEventToADKEvent(&gooseclient.SSEEvent{Type: "Message", Message: msg}, "inv-1")
+		if err != nil {
+			t.Fatalf("translate: %v", err)
+		}
+		fc := evt.Content.Parts[0].FunctionCall
+		if !evt.Partial || fc.WillContinue == nil || !*fc.WillContinue || fc.ID != "call-1" {
+			t.Errorf("expected a partial call that continues, got %+v / %+v", evt, fc)
+		}
+	}
+
+	complete := &gooseclient.GooseMessage{ID: "msg-1", Role: "assistant", Content: []gooseclient.MessageContent{{
+		Type: "toolRequest", ID: "call-1", ToolCall: &gooseclient.ToolCall{Name: "developer__shell", Arguments: map[string]any{"command": "ls -la"}},
+	}}}
+	stream.Accumulate(complete)
+	if len(stream.args) != 0 {
+		t.Errorf("expected the complete call to end its stream, got %v", stream.args)
+	}
+	evt, _ := GooseSSEEventToADKEvent(&gooseclient.SSEEvent{Type: "Message", Message: complete}, "inv-1")
+	if fc := evt.Content.Parts[0].FunctionCall; evt.Partial || fc.WillContinue != nil || fc.Args["command"] != "ls -la" {
+		t.Errorf("expected the complete call, got %+v / %+v", evt, fc)
+	}
+}
+
+func TestParsePartialArgs(t *testing.T) {
+	for text, want := range map[string]string{
+		``:                      `null`,
+		`{`:                     `{}`,
+		`{"a": "x\`:             `{"a":"x"}`,
+		`{"a": "\u00`:           `{"a":""}`,
+		`{"a": 1,`:              `{"a":1}`,
+		`{"a": [1, {"b": null`:  `{"a":[1,{"b":null}]}`,
+		`{"a": "}]\"{", "b": 2`: `{"a":"}]\"{","b":2}`,
+	} {
+		got, _ := json.Marshal(parsePartialArgs(text))
+		if string(got) != want {
+			t.Errorf("parsePartialArgs(%q) = %s, want %s", text, got, want)
+		}
+	}
+}
+
+func TestMessageEvents(t *testing.T) {
+	var m MessageEvents
+	chunk := &gooseclient.GooseMessage{ID: "msg-1", Role: "assistant", Content: []gooseclient.MessageContent{{Type: "text", Text: "hi"}}}
+	var ids []string
+	for range 3 {
+		evt, _ := GooseSSEEventToADKEvent(&gooseclient.SSEEvent{Type: "Message", Message: chunk}, "inv-1")
+		m.Stamp(evt, chunk)
+		ids = append(ids, evt.ID)
+		if evt.CustomMetadata[GooseMessageIDMetadataKey] != "msg-1" {
+			t.Errorf("expected the Goose message ID in metadata, got %+v", evt.CustomMetadata)
+		}
+	}
+	if !slices.Equal(ids, []string{"msg-1", "msg-1_1", "msg-1_2"}) {
+		t.Errorf("unexpected event IDs %v", ids)
+	}
+	evt := NewContentEvent("inv-1", genai.NewContentFromText("x", genai.RoleModel))
+	generated := evt.ID
+	m.Stamp(evt, &gooseclient.GooseMessage{Role: "assistant"})
+	if evt.ID != generated {
+		t.Errorf("expected a message without an ID to keep the generated event ID, got %q", evt.ID)
+	}
+
+	call := func() *gooseclient.GooseMessage {
+		return &gooseclient.GooseMessage{ID: "msg-2", Role: "assistant", Content: []gooseclient.MessageContent{
+			{Type: "text", Text: "running"},
+			{Type: "toolRequest", ID: "call-1", ToolCall: &gooseclient.ToolCall{Name: "shell", ArgumentsDelta: "{"}},
+			{Type: "toolRequest", ID: "call-1", ToolCall: &gooseclient.ToolCall{Name: "shell", Arguments: map[string]any{}}},
+		}}
+	}
+	first := call()
+	if !m.Dedupe(first) || len(first.Content) != 3 {
+		t.Fatalf("expected the first delivery kept, got %+v", first.Content)
+	}
+	again := call()
+	if !m.Dedupe(again) || len(again.Content) != 2 || again.Content[1].ToolCall.ArgumentsDelta == "" {
+		t.Errorf("expected only the complete tool request dropped, got %+v", again.Content)
+	}
+	response := &gooseclient.GooseMessage{Role: "user", Content: []gooseclient.MessageContent{{Type: "toolResponse", ID: "call-1"}}}
+	if !m.Dedupe(response) {
+		t.Error("expected the tool response kept")
+	}
+	if m.Dedupe(&gooseclient.GooseMessage{Role: "user", Content: []gooseclient.MessageContent{{Type: "toolResponse", ID: "call-1"}}}) {
+		t.Error("expected the re-delivered tool response dropped")
+	}
+}
+
+func TestULIDSource(t *testing.T) {
+	// The timestamp of the example in the ULID specification.
+	now := time.UnixMilli(1469918176385)
+	ids := NewULIDSource(func() time.Time { return now }, bytes.NewReader(make([]byte, 10)))
+
+	first, second := ids.New(), ids.New()
+	if first != "01ARYZ6S410000000000000000" {
+		t.Errorf("unexpected ULID %q", first)
+	}
+	if second != "01ARYZ6S410000000000000001" {
+		t.Errorf("expected the same millisecond to increment the random bits, got %q", second)
+	}
+
+	// Entropy is exhausted, and the clock goes back: IDs still increase.
+	now = now.Add(-time.Second)
+	if third := ids.New(); third <= second {
+		t.Errorf("expected %q to sort after %q", third, second)
+	}
+
+	seen := make(map[string]bool)
+	for range 1000 {
+		id := NewULID()
+		if len(id) != 26 || seen[id] {
+			t.Fatalf("unexpected or duplicate ULID %q", id)
+		}
+		seen[id] = true
+	}
+}